@@ -35,6 +35,59 @@ type ErrorData struct {
 	Count int
 }
 
+// ErrorDetail is the count of the errors of an aggregation with the same response code, API
+// and path.
+type ErrorDetail struct {
+	Code  int    `json:"code"`
+	APIID string `json:"api_id"`
+	Path  string `json:"path"`
+	Count int    `json:"count"`
+}
+
+type errorDetailKey struct {
+	code  int
+	apiID string
+	path  string
+}
+
+// topErrorDetails returns the limit error details with the highest counts, by decreasing count.
+func topErrorDetails(counts map[errorDetailKey]int, limit int) []ErrorDetail {
+	details := make([]ErrorDetail, 0, len(counts))
+	for key, count := range counts {
+		details = append(details, ErrorDetail{Code: key.code, APIID: key.apiID, Path: key.path, Count: count})
+	}
+	sort.Slice(details, func(i, j int) bool {
+		if details[i].Count != details[j].Count {
+			return details[i].Count > details[j].Count
+		}
+		if details[i].Code != details[j].Code {
+			return details[i].Code < details[j].Code
+		}
+		if details[i].APIID != details[j].APIID {
+			return details[i].APIID < details[j].APIID
+		}
+		return details[i].Path < details[j].Path
+	})
+	if len(details) > limit {
+		details = details[:limit]
+	}
+	return details
+}
+
+// MergeTopErrors adds the TopErrors of from to the ones of f, keeping the limit leading ones. It's
+// meant to be called on the stored aggregate, with the aggregate of the records being written.
+// As only the leading error sources are stored, the counts of the sources which drop out of the
+// top and come back later are approximate.
+func (f *AnalyticsRecordAggregate) MergeTopErrors(from *AnalyticsRecordAggregate, limit int) {
+	counts := make(map[errorDetailKey]int, len(f.TopErrors)+len(from.TopErrors))
+	for _, details := range [][]ErrorDetail{f.TopErrors, from.TopErrors} {
+		for _, detail := range details {
+			counts[errorDetailKey{code: detail.Code, apiID: detail.APIID, path: detail.Path}] += detail.Count
+		}
+	}
+	f.TopErrors = topErrorDetails(counts, limit)
+}
+
 type Counter struct {
 	Hits                 int       `json:"hits"`
 	Success              int       `json:"success"`
@@ -58,12 +111,18 @@ type Counter struct {
 	TotalLatency int64   `json:"total_latency"`
 	Latency      float64 `json:"latency"`
 
+	// Approximate latency percentiles, only computed when latency percentiles are tracked.
+	LatencyP50    float64  `json:"latency_p50" gorm:"-:all"`
+	LatencyP95    float64  `json:"latency_p95" gorm:"-:all"`
+	LatencyP99    float64  `json:"latency_p99" gorm:"-:all"`
+	LatencyDigest *TDigest `json:"latency_digest,omitempty" bson:"latencydigest,omitempty" gorm:"-:all"`
+
 	ErrorMap  map[string]int `json:"error_map" sql:"-"`
 	ErrorList []ErrorData    `json:"error_list" sql:"-"`
 }
 
 type GraphRecordAggregate struct {
-	AnalyticsRecordAggregate
+	AnalyticsRecordAggregate `bson:",inline"`
 
 	Types      map[string]*Counter
 	Fields     map[string]*Counter
@@ -76,6 +135,7 @@ type AggregateFieldList struct {
 	APIID         []Counter
 	OauthIDs      []Counter
 	Geo           []Counter
+	NodeIDs       []Counter
 	Tags          []Counter
 	Errors        []Counter
 	Endpoints     []Counter
@@ -102,6 +162,7 @@ type AnalyticsRecordAggregate struct {
 	APIID    map[string]*Counter
 	OauthIDs map[string]*Counter
 	Geo      map[string]*Counter
+	NodeIDs  map[string]*Counter
 	Tags     map[string]*Counter
 
 	Endpoints map[string]*Counter
@@ -114,9 +175,19 @@ type AnalyticsRecordAggregate struct {
 
 	Total Counter
 
+	// TopErrors are the leading error sources of the aggregation, only kept when the error details
+	// are tracked.
+	TopErrors []ErrorDetail `json:"top_errors,omitempty" bson:"toperrors,omitempty"`
+
 	ExpireAt time.Time `bson:"expireAt" json:"expireAt"`
 	LastTime time.Time
 	Mixed    bool `bson:"-" json:"-"`
+
+	// trackLatencyPercentiles determines if the counters keep a latency digest.
+	trackLatencyPercentiles bool
+	// topErrorsLimit is the number of TopErrors kept, 0 if the error details aren't tracked.
+	topErrorsLimit int
+	errorDetails   map[errorDetailKey]int
 }
 
 func (f *AnalyticsRecordAggregate) TableName() string {
@@ -279,6 +350,7 @@ func (f AnalyticsRecordAggregate) New() AnalyticsRecordAggregate {
 	thisF.APIKeys = make(map[string]*Counter)
 	thisF.OauthIDs = make(map[string]*Counter)
 	thisF.Geo = make(map[string]*Counter)
+	thisF.NodeIDs = make(map[string]*Counter)
 	thisF.Tags = make(map[string]*Counter)
 	thisF.Endpoints = make(map[string]*Counter)
 	thisF.KeyEndpoint = make(map[string]map[string]*Counter)
@@ -304,10 +376,10 @@ func (f *AnalyticsRecordAggregate) generateBSONFromProperty(parent, thisUnit str
 	newUpdate["$set"].(model.DBM)[constructor+"identifier"] = incVal.Identifier
 	newUpdate["$set"].(model.DBM)[constructor+"humanidentifier"] = incVal.HumanIdentifier
 	newUpdate["$set"].(model.DBM)[constructor+"lasttime"] = incVal.LastTime
-	newUpdate["$set"].(model.DBM)[constructor+"openconnections"] = incVal.OpenConnections
-	newUpdate["$set"].(model.DBM)[constructor+"closedconnections"] = incVal.ClosedConnections
-	newUpdate["$set"].(model.DBM)[constructor+"bytesin"] = incVal.BytesIn
-	newUpdate["$set"].(model.DBM)[constructor+"bytesout"] = incVal.BytesOut
+	newUpdate["$inc"].(model.DBM)[constructor+"openconnections"] = incVal.OpenConnections
+	newUpdate["$inc"].(model.DBM)[constructor+"closedconnections"] = incVal.ClosedConnections
+	newUpdate["$inc"].(model.DBM)[constructor+"bytesin"] = incVal.BytesIn
+	newUpdate["$inc"].(model.DBM)[constructor+"bytesout"] = incVal.BytesOut
 	newUpdate["$max"].(model.DBM)[constructor+"maxlatency"] = incVal.MaxLatency
 	// Don't update min latency in case of errors
 	if incVal.Hits != incVal.ErrorTotal {
@@ -350,6 +422,17 @@ func (f *AnalyticsRecordAggregate) latencySetter(parent, thisUnit string, newUpd
 	newUpdate["$set"].(model.DBM)[constructor+"latency"] = counter.Latency
 	newUpdate["$set"].(model.DBM)[constructor+"upstreamlatency"] = counter.UpstreamLatency
 
+	if counter.LatencyDigest != nil {
+		counter.LatencyP50 = counter.LatencyDigest.Quantile(0.50)
+		counter.LatencyP95 = counter.LatencyDigest.Quantile(0.95)
+		counter.LatencyP99 = counter.LatencyDigest.Quantile(0.99)
+
+		newUpdate["$set"].(model.DBM)[constructor+"latencyp50"] = counter.LatencyP50
+		newUpdate["$set"].(model.DBM)[constructor+"latencyp95"] = counter.LatencyP95
+		newUpdate["$set"].(model.DBM)[constructor+"latencyp99"] = counter.LatencyP99
+		newUpdate["$set"].(model.DBM)[constructor+"latencydigest"] = counter.LatencyDigest
+	}
+
 	return newUpdate
 }
 
@@ -368,7 +451,13 @@ func fnLatencySetter(counter *Counter) *Counter {
 }
 
 func (g *GraphRecordAggregate) Dimensions() []Dimension {
-	dimensions := g.AnalyticsRecordAggregate.Dimensions()
+	return append(g.AnalyticsRecordAggregate.Dimensions(), g.graphDimensions()...)
+}
+
+// graphDimensions returns the dimensions specific to the graph records: the types, fields,
+// operation types and root fields.
+func (g *GraphRecordAggregate) graphDimensions() []Dimension {
+	var dimensions []Dimension
 	for key, inc := range g.Types {
 		dimensions = append(dimensions, Dimension{Name: "types", Value: key, Counter: fnLatencySetter(inc)})
 	}
@@ -388,6 +477,61 @@ func (g *GraphRecordAggregate) Dimensions() []Dimension {
 	return dimensions
 }
 
+// TableName returns the Mongo collection of the graph aggregations of the organisation, or the
+// mixed collection.
+func (g *GraphRecordAggregate) TableName() string {
+	if g.Mixed {
+		return GraphAggregateMixedCollectionName
+	}
+	return "z_tyk_graph_analyticz_aggregate_" + g.OrgID
+}
+
+// AsChange returns the Mongo update of the aggregation, incrementing the counters of the types,
+// fields, operation types and root fields along with the ones of AnalyticsRecordAggregate.AsChange.
+// The records without operation type aren't counted in the operations.
+func (g *GraphRecordAggregate) AsChange() model.DBM {
+	newUpdate := g.AnalyticsRecordAggregate.AsChange()
+	for _, d := range g.graphDimensions() {
+		if d.Value == "" {
+			continue
+		}
+		newUpdate = g.generateBSONFromProperty(d.Name, d.Value, d.Counter, newUpdate)
+	}
+	return newUpdate
+}
+
+// AsTimeUpdate returns the Mongo update of the averages and lists of the stored aggregation, like
+// AnalyticsRecordAggregate.AsTimeUpdate, along with the ones of the graph dimensions. It also sets
+// the `errorrate` of the graph dimensions and of the total, the ratio of their errors to their
+// hits.
+func (g *GraphRecordAggregate) AsTimeUpdate() model.DBM {
+	newUpdate := g.AnalyticsRecordAggregate.AsTimeUpdate()
+
+	graphCounters := map[string]map[string]*Counter{
+		"types":      g.Types,
+		"fields":     g.Fields,
+		"operation":  g.Operation,
+		"rootfields": g.RootFields,
+	}
+	for name, counters := range graphCounters {
+		for key, counter := range counters {
+			newUpdate["$set"].(model.DBM)[name+"."+key+".errorrate"] = errorRate(counter)
+		}
+		newUpdate["$set"].(model.DBM)["lists."+name] = g.getRecords(name, counters, newUpdate)
+	}
+	newUpdate["$set"].(model.DBM)["total.errorrate"] = errorRate(&g.Total)
+
+	return newUpdate
+}
+
+// errorRate returns the ratio of the errors of the counter to its hits, 0 without hits.
+func errorRate(counter *Counter) float64 {
+	if counter.Hits == 0 {
+		return 0
+	}
+	return float64(counter.ErrorTotal) / float64(counter.Hits)
+}
+
 func (f *AnalyticsRecordAggregate) Dimensions() (dimensions []Dimension) {
 	for key, inc := range f.APIID {
 		dimensions = append(dimensions, Dimension{"apiid", key, fnLatencySetter(inc)})
@@ -413,6 +557,10 @@ func (f *AnalyticsRecordAggregate) Dimensions() (dimensions []Dimension) {
 		dimensions = append(dimensions, Dimension{"geo", key, fnLatencySetter(inc)})
 	}
 
+	for key, inc := range f.NodeIDs {
+		dimensions = append(dimensions, Dimension{"nodeids", key, fnLatencySetter(inc)})
+	}
+
 	for key, inc := range f.Tags {
 		dimensions = append(dimensions, Dimension{"tags", key, fnLatencySetter(inc)})
 	}
@@ -468,6 +616,71 @@ func (f *AnalyticsRecordAggregate) AsChange() (newUpdate model.DBM) {
 	return newUpdate
 }
 
+// The strategies merging the fields of the aggregations that can't be incremented, when several
+// updates are written to the same aggregation.
+const (
+	// MergeStrategySet keeps the value of the last update. It's the default.
+	MergeStrategySet = "set"
+	// MergeStrategyMax keeps the greatest value.
+	MergeStrategyMax = "max"
+	// MergeStrategyMin keeps the lowest value.
+	MergeStrategyMin = "min"
+)
+
+// MergeableAggregateFields are the counter fields whose merge strategy can be configured.
+var MergeableAggregateFields = []string{"lasttime", "identifier", "humanidentifier"}
+
+// ValidateMergeStrategies checks that strategies only sets valid strategies of mergeable fields.
+func ValidateMergeStrategies(strategies map[string]string) error {
+	for field, strategy := range strategies {
+		if !isMergeableAggregateField(field) {
+			return fmt.Errorf("merge strategy of unsupported field %q", field)
+		}
+		switch strategy {
+		case MergeStrategySet, MergeStrategyMax, MergeStrategyMin:
+		default:
+			return fmt.Errorf("invalid merge strategy %q of field %q", strategy, field)
+		}
+	}
+	return nil
+}
+
+func isMergeableAggregateField(field string) bool {
+	for _, mergeable := range MergeableAggregateFields {
+		if field == mergeable {
+			return true
+		}
+	}
+	return false
+}
+
+// AsChangeWithMergeStrategies returns the update of AsChange, merging the fields of strategies
+// with their strategy instead of overwriting them. The counters are always incremented.
+func (f *AnalyticsRecordAggregate) AsChangeWithMergeStrategies(strategies map[string]string) model.DBM {
+	newUpdate := f.AsChange()
+	if len(strategies) == 0 {
+		return newUpdate
+	}
+
+	setter := newUpdate["$set"].(model.DBM)
+	for key, value := range setter {
+		field := key[strings.LastIndex(key, ".")+1:]
+		strategy, ok := strategies[field]
+		if !ok || strategy == MergeStrategySet {
+			continue
+		}
+
+		operator := "$" + strategy
+		if newUpdate[operator] == nil {
+			newUpdate[operator] = model.DBM{}
+		}
+		newUpdate[operator].(model.DBM)[key] = value
+		delete(setter, key)
+	}
+
+	return newUpdate
+}
+
 func (f *AnalyticsRecordAggregate) SetErrorList(parent, thisUnit string, counter *Counter, newUpdate model.DBM) {
 	constructor := parent + "." + thisUnit + "."
 	if parent == "" {
@@ -504,7 +717,10 @@ func (f *AnalyticsRecordAggregate) getRecords(fieldName string, data map[string]
 		f.SetErrorList(fieldName, thisUnit, incVal, newUpdate)
 		newUpdate = f.generateSetterForTime(fieldName, thisUnit, newTime, newUpdate)
 		newUpdate = f.latencySetter(fieldName, thisUnit, newUpdate, incVal)
-		result = append(result, *incVal)
+		listCounter := *incVal
+		// the digest is already stored in the counter, there's no need to duplicate it in the lists
+		listCounter.LatencyDigest = nil
+		result = append(result, listCounter)
 	}
 
 	return result
@@ -530,6 +746,8 @@ func (f *AnalyticsRecordAggregate) AsTimeUpdate() model.DBM {
 
 	newUpdate["$set"].(model.DBM)["lists.geo"] = f.getRecords("geo", f.Geo, newUpdate)
 
+	newUpdate["$set"].(model.DBM)["lists.nodeids"] = f.getRecords("nodeids", f.NodeIDs, newUpdate)
+
 	newUpdate["$set"].(model.DBM)["lists.tags"] = f.getRecords("tags", f.Tags, newUpdate)
 
 	newUpdate["$set"].(model.DBM)["lists.endpoints"] = f.getRecords("endpoints", f.Endpoints, newUpdate)
@@ -546,6 +764,10 @@ func (f *AnalyticsRecordAggregate) AsTimeUpdate() model.DBM {
 
 	newUpdate["$set"].(model.DBM)["lists.apiendpoints"] = f.getRecords("apiendpoints", f.ApiEndpoint, newUpdate)
 
+	if f.TopErrors != nil {
+		newUpdate["$set"].(model.DBM)["toperrors"] = f.TopErrors
+	}
+
 	var newTime float64
 
 	if f.Total.Hits > 0 {
@@ -558,6 +780,49 @@ func (f *AnalyticsRecordAggregate) AsTimeUpdate() model.DBM {
 	return newUpdate
 }
 
+// MergeLatencyDigests merges the latency digests of the counters of from into the matching
+// counters of f, so the percentiles set by AsTimeUpdate account for both. It's meant to be
+// called on the stored aggregate, with the aggregate of the records being written.
+func (f *AnalyticsRecordAggregate) MergeLatencyDigests(from *AnalyticsRecordAggregate) {
+	mergeCounterDigests := func(to, from map[string]*Counter) {
+		for key, counter := range from {
+			if toCounter, ok := to[key]; ok && toCounter != nil {
+				mergeLatencyDigest(toCounter, counter)
+			}
+		}
+	}
+
+	mergeCounterDigests(f.APIID, from.APIID)
+	mergeCounterDigests(f.Errors, from.Errors)
+	mergeCounterDigests(f.Versions, from.Versions)
+	mergeCounterDigests(f.APIKeys, from.APIKeys)
+	mergeCounterDigests(f.OauthIDs, from.OauthIDs)
+	mergeCounterDigests(f.Geo, from.Geo)
+	mergeCounterDigests(f.NodeIDs, from.NodeIDs)
+	mergeCounterDigests(f.Tags, from.Tags)
+	mergeCounterDigests(f.Endpoints, from.Endpoints)
+	mergeCounterDigests(f.ApiEndpoint, from.ApiEndpoint)
+	for key, counters := range from.KeyEndpoint {
+		mergeCounterDigests(f.KeyEndpoint[key], counters)
+	}
+	for key, counters := range from.OauthEndpoint {
+		mergeCounterDigests(f.OauthEndpoint[key], counters)
+	}
+	mergeLatencyDigest(&f.Total, &from.Total)
+}
+
+// mergeLatencyDigest merges the latency digest of from into the one of to.
+func mergeLatencyDigest(to, from *Counter) {
+	if from.LatencyDigest == nil {
+		return
+	}
+	if to.LatencyDigest == nil {
+		to.LatencyDigest = from.LatencyDigest.Clone()
+		return
+	}
+	to.LatencyDigest.Merge(from.LatencyDigest)
+}
+
 // DiscardAggregations this method discard the aggregations of X field specified in the aggregated pump configuration
 func (f *AnalyticsRecordAggregate) DiscardAggregations(fields []string) {
 	for _, field := range fields {
@@ -574,6 +839,8 @@ func (f *AnalyticsRecordAggregate) DiscardAggregations(fields []string) {
 			f.OauthIDs = make(map[string]*Counter)
 		case "Geo", "geo":
 			f.Geo = make(map[string]*Counter)
+		case "NodeIDs", "nodeids":
+			f.NodeIDs = make(map[string]*Counter)
 		case "Tags", "tags":
 			f.Tags = make(map[string]*Counter)
 		case "Endpoints", "endpoints":
@@ -695,8 +962,29 @@ func AggregateGraphData(data []interface{}, dbIdentifier string, aggregationTime
 	return aggregateMap
 }
 
+// AggregateOptions are the optional, and more expensive, details tracked by the aggregations.
+type AggregateOptions struct {
+	// TrackLatencyPercentiles makes the counters keep a latency digest, used to compute the
+	// latency percentiles.
+	TrackLatencyPercentiles bool
+	// TopErrors is the number of leading error sources, by response code, API and path, kept in
+	// the TopErrors of the aggregations. 0 disables them.
+	TopErrors int
+}
+
 // AggregateData calculates aggregated data, returns map orgID => aggregated analytics data
 func AggregateData(data []interface{}, trackAllPaths bool, ignoreTagPrefixList []string, dbIdentifier string, aggregationTime int) map[string]AnalyticsRecordAggregate {
+	return AggregateDataWithOptions(data, trackAllPaths, ignoreTagPrefixList, dbIdentifier, aggregationTime, AggregateOptions{})
+}
+
+// AggregateDataWithLatencyPercentiles works as AggregateData, but the counters also keep a latency
+// digest used to compute the latency percentiles.
+func AggregateDataWithLatencyPercentiles(data []interface{}, trackAllPaths bool, ignoreTagPrefixList []string, dbIdentifier string, aggregationTime int) map[string]AnalyticsRecordAggregate {
+	return AggregateDataWithOptions(data, trackAllPaths, ignoreTagPrefixList, dbIdentifier, aggregationTime, AggregateOptions{TrackLatencyPercentiles: true})
+}
+
+// AggregateDataWithOptions works as AggregateData, also tracking the details of options.
+func AggregateDataWithOptions(data []interface{}, trackAllPaths bool, ignoreTagPrefixList []string, dbIdentifier string, aggregationTime int, options AggregateOptions) map[string]AnalyticsRecordAggregate {
 	analyticsPerOrg := make(map[string]AnalyticsRecordAggregate)
 	for _, v := range data {
 		thisV := v.(AnalyticsRecord)
@@ -727,11 +1015,23 @@ func AggregateData(data []interface{}, trackAllPaths bool, ignoreTagPrefixList [
 			thisAggregate.OrgID = orgID
 			thisAggregate.LastTime = thisV.TimeStamp
 			thisAggregate.Total.ErrorMap = make(map[string]int)
+			thisAggregate.trackLatencyPercentiles = options.TrackLatencyPercentiles
+			if options.TopErrors > 0 {
+				thisAggregate.topErrorsLimit = options.TopErrors
+				thisAggregate.errorDetails = make(map[errorDetailKey]int)
+			}
 		}
 		thisAggregate, _ = incrementAggregate(&thisAggregate, &thisV, trackAllPaths, ignoreTagPrefixList)
 		analyticsPerOrg[orgID] = thisAggregate
 	}
 
+	for orgID, aggregate := range analyticsPerOrg {
+		if aggregate.topErrorsLimit > 0 {
+			aggregate.TopErrors = topErrorDetails(aggregate.errorDetails, aggregate.topErrorsLimit)
+			analyticsPerOrg[orgID] = aggregate
+		}
+	}
+
 	return analyticsPerOrg
 }
 
@@ -784,6 +1084,14 @@ func incrementAggregate(aggregate *AnalyticsRecordAggregate, record *AnalyticsRe
 			TotalLatency:         record.Latency.Total,
 			ErrorMap:             make(map[string]int),
 		}
+		if aggregate.trackLatencyPercentiles {
+			thisCounter.LatencyDigest = NewTDigest()
+			thisCounter.LatencyDigest.Add(float64(record.Latency.Total))
+			if aggregate.Total.LatencyDigest == nil {
+				aggregate.Total.LatencyDigest = NewTDigest()
+			}
+			aggregate.Total.LatencyDigest.Add(float64(record.Latency.Total))
+		}
 		aggregate.Total.Hits++
 		aggregate.Total.TotalRequestTime += float64(record.RequestTime)
 
@@ -794,6 +1102,9 @@ func incrementAggregate(aggregate *AnalyticsRecordAggregate, record *AnalyticsRe
 			thisCounter.ErrorMap[strconv.Itoa(record.ResponseCode)]++
 			aggregate.Total.ErrorTotal++
 			aggregate.Total.ErrorMap[strconv.Itoa(record.ResponseCode)]++
+			if aggregate.topErrorsLimit > 0 {
+				aggregate.errorDetails[errorDetailKey{code: record.ResponseCode, apiID: record.APIID, path: record.Path}]++
+			}
 		}
 
 		if (record.ResponseCode < 300) && (record.ResponseCode >= 200) {
@@ -919,6 +1230,14 @@ func incrementAggregate(aggregate *AnalyticsRecordAggregate, record *AnalyticsRe
 					aggregate.Geo[record.Geo.Country.ISOCode].Identifier = record.Geo.Country.ISOCode
 					aggregate.Geo[record.Geo.Country.ISOCode].HumanIdentifier = record.Geo.Country.ISOCode
 				}
+			case "NodeID":
+				val, ok := value.(string)
+				if val != "" && ok {
+					c := incrementOrSetUnit(&thisCounter, aggregate.NodeIDs[val])
+					aggregate.NodeIDs[val] = c
+					aggregate.NodeIDs[val].Identifier = val
+					aggregate.NodeIDs[val].HumanIdentifier = val
+				}
 
 			case "Tags":
 				for _, thisTag := range record.Tags {
@@ -966,6 +1285,9 @@ func incrementOrSetUnit(b, c *Counter) *Counter {
 		for k, v := range base.ErrorMap {
 			newCounter.ErrorMap[k] = v
 		}
+		if base.LatencyDigest != nil {
+			newCounter.LatencyDigest = base.LatencyDigest.Clone()
+		}
 		c = &newCounter
 	} else {
 		c.Hits += base.Hits
@@ -997,6 +1319,7 @@ func incrementOrSetUnit(b, c *Counter) *Counter {
 
 		c.TotalLatency += base.TotalLatency
 		c.TotalUpstreamLatency += base.TotalUpstreamLatency
+		mergeLatencyDigest(c, &base)
 
 	}
 
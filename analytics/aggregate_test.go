@@ -535,15 +535,15 @@ func TestAnalyticsRecordAggregate_generateBSONFromProperty(t *testing.T) {
 			givenValue: "total",
 			expected: model.DBM{
 				"$set": model.DBM{
-					"test.total.bytesin":           int64(0),
-					"test.total.bytesout":          int64(0),
-					"test.total.humanidentifier":   "",
-					"test.total.identifier":        "",
-					"test.total.lasttime":          currentTime,
-					"test.total.openconnections":   int64(0),
-					"test.total.closedconnections": int64(0),
+					"test.total.humanidentifier": "",
+					"test.total.identifier":      "",
+					"test.total.lasttime":        currentTime,
 				},
 				"$inc": model.DBM{
+					"test.total.bytesin":              int64(0),
+					"test.total.bytesout":             int64(0),
+					"test.total.openconnections":      int64(0),
+					"test.total.closedconnections":    int64(0),
 					"test.total.errormap.200":         int(1),
 					"test.total.errortotal":           int(0),
 					"test.total.hits":                 int(2),
@@ -585,15 +585,15 @@ func TestAnalyticsRecordAggregate_generateBSONFromProperty(t *testing.T) {
 			givenValue: "total",
 			expected: model.DBM{
 				"$set": model.DBM{
-					"test.total.bytesin":           int64(0),
-					"test.total.bytesout":          int64(0),
-					"test.total.humanidentifier":   "",
-					"test.total.identifier":        "test",
-					"test.total.lasttime":          currentTime,
-					"test.total.openconnections":   int64(0),
-					"test.total.closedconnections": int64(0),
+					"test.total.humanidentifier": "",
+					"test.total.identifier":      "test",
+					"test.total.lasttime":        currentTime,
 				},
 				"$inc": model.DBM{
+					"test.total.bytesin":              int64(0),
+					"test.total.bytesout":             int64(0),
+					"test.total.openconnections":      int64(0),
+					"test.total.closedconnections":    int64(0),
 					"test.total.errormap.500":         int(2),
 					"test.total.errortotal":           int(2),
 					"test.total.hits":                 int(2),
@@ -633,15 +633,15 @@ func TestAnalyticsRecordAggregate_generateBSONFromProperty(t *testing.T) {
 			givenValue: "noname",
 			expected: model.DBM{
 				"$set": model.DBM{
-					"noname.bytesin":           int64(0),
-					"noname.bytesout":          int64(0),
-					"noname.humanidentifier":   "",
-					"noname.identifier":        "test",
-					"noname.lasttime":          currentTime,
-					"noname.openconnections":   int64(0),
-					"noname.closedconnections": int64(0),
+					"noname.humanidentifier": "",
+					"noname.identifier":      "test",
+					"noname.lasttime":        currentTime,
 				},
 				"$inc": model.DBM{
+					"noname.bytesin":              int64(0),
+					"noname.bytesout":             int64(0),
+					"noname.openconnections":      int64(0),
+					"noname.closedconnections":    int64(0),
 					"noname.errormap.500":         int(2),
 					"noname.errortotal":           int(2),
 					"noname.hits":                 int(2),
@@ -871,6 +871,18 @@ func TestAnalyticsRecordAggregate_AsChange(t *testing.T) {
 			},
 			expected: model.DBM{
 				"$inc": model.DBM{
+					"total.bytesin":                    int64(0),
+					"total.bytesout":                   int64(0),
+					"total.closedconnections":          int64(0),
+					"total.openconnections":            int64(0),
+					"versions.v1.bytesin":              int64(0),
+					"versions.v1.bytesout":             int64(0),
+					"versions.v1.closedconnections":    int64(0),
+					"versions.v1.openconnections":      int64(0),
+					"versions.v2.bytesin":              int64(0),
+					"versions.v2.bytesout":             int64(0),
+					"versions.v2.closedconnections":    int64(0),
+					"versions.v2.openconnections":      int64(0),
 					"total.hits":                       int(2),
 					"total.success":                    int(2),
 					"total.errortotal":                 int(0),
@@ -907,34 +919,22 @@ func TestAnalyticsRecordAggregate_AsChange(t *testing.T) {
 					"versions.v2.maxupstreamlatency": int64(100),
 				},
 				"$set": model.DBM{
-					"expireAt":                      currentTime,
-					"lasttime":                      currentTime,
-					"timestamp":                     currentTime,
-					"total.lasttime":                currentTime,
-					"timeid.day":                    currentTime.Day(),
-					"timeid.hour":                   currentTime.Hour(),
-					"timeid.month":                  currentTime.Month(),
-					"timeid.year":                   currentTime.Year(),
-					"total.bytesin":                 int64(0),
-					"total.bytesout":                int64(0),
-					"total.closedconnections":       int64(0),
-					"total.openconnections":         int64(0),
-					"total.humanidentifier":         "",
-					"total.identifier":              "",
-					"versions.v1.bytesin":           int64(0),
-					"versions.v1.bytesout":          int64(0),
-					"versions.v1.lasttime":          currentTime,
-					"versions.v1.humanidentifier":   "",
-					"versions.v1.identifier":        "",
-					"versions.v1.closedconnections": int64(0),
-					"versions.v1.openconnections":   int64(0),
-					"versions.v2.bytesin":           int64(0),
-					"versions.v2.bytesout":          int64(0),
-					"versions.v2.lasttime":          currentTime,
-					"versions.v2.humanidentifier":   "",
-					"versions.v2.identifier":        "",
-					"versions.v2.closedconnections": int64(0),
-					"versions.v2.openconnections":   int64(0),
+					"expireAt":                    currentTime,
+					"lasttime":                    currentTime,
+					"timestamp":                   currentTime,
+					"total.lasttime":              currentTime,
+					"timeid.day":                  currentTime.Day(),
+					"timeid.hour":                 currentTime.Hour(),
+					"timeid.month":                currentTime.Month(),
+					"timeid.year":                 currentTime.Year(),
+					"total.humanidentifier":       "",
+					"total.identifier":            "",
+					"versions.v1.lasttime":        currentTime,
+					"versions.v1.humanidentifier": "",
+					"versions.v1.identifier":      "",
+					"versions.v2.lasttime":        currentTime,
+					"versions.v2.humanidentifier": "",
+					"versions.v2.identifier":      "",
 				},
 			},
 		},
@@ -1004,6 +1004,18 @@ func TestAnalyticsRecordAggregate_AsChange(t *testing.T) {
 			},
 			expected: model.DBM{
 				"$inc": model.DBM{
+					"total.bytesin":                   int64(0),
+					"total.bytesout":                  int64(0),
+					"total.closedconnections":         int64(0),
+					"total.openconnections":           int64(0),
+					"apiid.api1.bytesin":              int64(0),
+					"apiid.api1.bytesout":             int64(0),
+					"apiid.api1.closedconnections":    int64(0),
+					"apiid.api1.openconnections":      int64(0),
+					"apiid.api2.bytesin":              int64(0),
+					"apiid.api2.bytesout":             int64(0),
+					"apiid.api2.closedconnections":    int64(0),
+					"apiid.api2.openconnections":      int64(0),
 					"total.hits":                      int(4),
 					"total.success":                   int(1),
 					"total.errortotal":                int(3),
@@ -1042,34 +1054,22 @@ func TestAnalyticsRecordAggregate_AsChange(t *testing.T) {
 					"apiid.api2.maxupstreamlatency": int64(100),
 				},
 				"$set": model.DBM{
-					"expireAt":                     currentTime,
-					"lasttime":                     currentTime,
-					"timestamp":                    currentTime,
-					"total.lasttime":               currentTime,
-					"timeid.day":                   currentTime.Day(),
-					"timeid.hour":                  currentTime.Hour(),
-					"timeid.month":                 currentTime.Month(),
-					"timeid.year":                  currentTime.Year(),
-					"total.bytesin":                int64(0),
-					"total.bytesout":               int64(0),
-					"total.closedconnections":      int64(0),
-					"total.openconnections":        int64(0),
-					"total.humanidentifier":        "",
-					"total.identifier":             "",
-					"apiid.api1.bytesin":           int64(0),
-					"apiid.api1.bytesout":          int64(0),
-					"apiid.api1.closedconnections": int64(0),
-					"apiid.api1.openconnections":   int64(0),
-					"apiid.api1.humanidentifier":   "",
-					"apiid.api1.identifier":        "",
-					"apiid.api1.lasttime":          currentTime,
-					"apiid.api2.bytesin":           int64(0),
-					"apiid.api2.bytesout":          int64(0),
-					"apiid.api2.closedconnections": int64(0),
-					"apiid.api2.openconnections":   int64(0),
-					"apiid.api2.humanidentifier":   "",
-					"apiid.api2.identifier":        "",
-					"apiid.api2.lasttime":          currentTime,
+					"expireAt":                   currentTime,
+					"lasttime":                   currentTime,
+					"timestamp":                  currentTime,
+					"total.lasttime":             currentTime,
+					"timeid.day":                 currentTime.Day(),
+					"timeid.hour":                currentTime.Hour(),
+					"timeid.month":               currentTime.Month(),
+					"timeid.year":                currentTime.Year(),
+					"total.humanidentifier":      "",
+					"total.identifier":           "",
+					"apiid.api1.humanidentifier": "",
+					"apiid.api1.identifier":      "",
+					"apiid.api1.lasttime":        currentTime,
+					"apiid.api2.humanidentifier": "",
+					"apiid.api2.identifier":      "",
+					"apiid.api2.lasttime":        currentTime,
 				},
 			},
 		},
@@ -1185,6 +1185,7 @@ func TestAnalyticsRecordAggregate_AsTimeUpdate(t *testing.T) {
 					"lists.endpoints": []Counter{},
 					"lists.errors":    []Counter{},
 					"lists.geo":       []Counter{},
+					"lists.nodeids":   []Counter{},
 					"lists.oauthids":  []Counter{},
 					"lists.tags":      []Counter{},
 					"lists.versions":  []Counter{},
@@ -1238,3 +1239,131 @@ func TestAnalyticsRecordAggregate_AsTimeUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestAggregateDataWithLatencyPercentiles(t *testing.T) {
+	// latencies from 1 to 1000ms, half of them on each partial update of the same aggregation
+	firstBatch, secondBatch := []interface{}{}, []interface{}{}
+	for i := 1; i <= 1000; i++ {
+		record := AnalyticsRecord{
+			OrgID:        "ORG123",
+			APIID:        "api1",
+			ResponseCode: 200,
+			TimeStamp:    time.Now(),
+			Latency:      Latency{Total: int64(i)},
+		}
+		if i%2 == 0 {
+			firstBatch = append(firstBatch, record)
+		} else {
+			secondBatch = append(secondBatch, record)
+		}
+	}
+
+	stored := AggregateDataWithLatencyPercentiles(firstBatch, false, nil, "", 60)["ORG123"]
+	update := AggregateDataWithLatencyPercentiles(secondBatch, false, nil, "", 60)["ORG123"]
+	stored.MergeLatencyDigests(&update)
+
+	newUpdate := stored.AsTimeUpdate()
+	set := newUpdate["$set"].(model.DBM)
+
+	for _, counter := range []*Counter{&stored.Total, stored.APIID["api1"]} {
+		assert.Equal(t, float64(1000), counter.LatencyDigest.Count())
+		assert.InDelta(t, 500, counter.LatencyP50, 10)
+		assert.InDelta(t, 950, counter.LatencyP95, 10)
+		assert.InDelta(t, 990, counter.LatencyP99, 10)
+	}
+	assert.Equal(t, stored.Total.LatencyP95, set["total.latencyp95"])
+	assert.Equal(t, stored.APIID["api1"].LatencyP99, set["apiid.api1.latencyp99"])
+	assert.NotNil(t, set["apiid.api1.latencydigest"])
+
+	// the lists don't duplicate the digests
+	for _, counter := range set["lists.apiid"].([]Counter) {
+		assert.Nil(t, counter.LatencyDigest)
+		assert.NotZero(t, counter.LatencyP99)
+	}
+
+	// percentiles are not tracked by default
+	aggregate := AggregateData(firstBatch, false, nil, "", 60)["ORG123"]
+	assert.Nil(t, aggregate.Total.LatencyDigest)
+	assert.Nil(t, aggregate.APIID["api1"].LatencyDigest)
+	assert.NotContains(t, aggregate.AsTimeUpdate()["$set"].(model.DBM), "total.latencyp50")
+}
+
+func TestAggregateDataWithTopErrors(t *testing.T) {
+	errors := []struct {
+		code  int
+		apiID string
+		path  string
+		count int
+	}{
+		{code: 500, apiID: "api1", path: "/orders", count: 5},
+		{code: 404, apiID: "api1", path: "/orders/1", count: 3},
+		{code: 404, apiID: "api2", path: "/orders/1", count: 4},
+		{code: 401, apiID: "api1", path: "/orders", count: 2},
+		{code: 429, apiID: "api2", path: "/login", count: 1},
+	}
+	data := []interface{}{}
+	for _, e := range errors {
+		for i := 0; i < e.count; i++ {
+			data = append(data, AnalyticsRecord{OrgID: "ORG123", APIID: e.apiID, Path: e.path, ResponseCode: e.code, TimeStamp: time.Now()})
+		}
+	}
+	// the successful requests aren't error sources
+	for i := 0; i < 10; i++ {
+		data = append(data, AnalyticsRecord{OrgID: "ORG123", APIID: "api1", Path: "/orders", ResponseCode: 200, TimeStamp: time.Now()})
+	}
+
+	aggregate := AggregateDataWithOptions(data, false, nil, "", 60, AggregateOptions{TopErrors: 3})["ORG123"]
+	assert.Equal(t, []ErrorDetail{
+		{Code: 500, APIID: "api1", Path: "/orders", Count: 5},
+		{Code: 404, APIID: "api2", Path: "/orders/1", Count: 4},
+		{Code: 404, APIID: "api1", Path: "/orders/1", Count: 3},
+	}, aggregate.TopErrors)
+	assert.Equal(t, 15, aggregate.Total.ErrorTotal)
+	assert.Equal(t, aggregate.TopErrors, aggregate.AsTimeUpdate()["$set"].(model.DBM)["toperrors"])
+
+	// the next update of the same aggregation is merged in, keeping the top 3
+	update := AggregateDataWithOptions([]interface{}{
+		AnalyticsRecord{OrgID: "ORG123", APIID: "api1", Path: "/orders", ResponseCode: 401, TimeStamp: time.Now()},
+		AnalyticsRecord{OrgID: "ORG123", APIID: "api1", Path: "/orders", ResponseCode: 401, TimeStamp: time.Now()},
+		AnalyticsRecord{OrgID: "ORG123", APIID: "api1", Path: "/orders", ResponseCode: 500, TimeStamp: time.Now()},
+	}, false, nil, "", 60, AggregateOptions{TopErrors: 3})["ORG123"]
+	aggregate.MergeTopErrors(&update, 3)
+	assert.Equal(t, []ErrorDetail{
+		{Code: 500, APIID: "api1", Path: "/orders", Count: 6},
+		{Code: 404, APIID: "api2", Path: "/orders/1", Count: 4},
+		{Code: 404, APIID: "api1", Path: "/orders/1", Count: 3},
+	}, aggregate.TopErrors)
+
+	// they aren't tracked by default
+	aggregate = AggregateData(data, false, nil, "", 60)["ORG123"]
+	assert.Nil(t, aggregate.TopErrors)
+	assert.NotContains(t, aggregate.AsTimeUpdate()["$set"], "toperrors")
+}
+
+func TestAnalyticsRecordAggregate_AsChangeWithMergeStrategies(t *testing.T) {
+	currentTime := time.Date(2023, 0o4, 0o4, 10, 0, 0, 0, time.UTC)
+	aggregate := &AnalyticsRecordAggregate{TimeStamp: currentTime, LastTime: currentTime}
+	aggregate.Total = Counter{Hits: 1, Identifier: "total", LastTime: currentTime}
+
+	assert.Equal(t, aggregate.AsChange(), aggregate.AsChangeWithMergeStrategies(nil))
+
+	update := aggregate.AsChangeWithMergeStrategies(map[string]string{
+		"lasttime":   MergeStrategyMax,
+		"identifier": MergeStrategyMin,
+	})
+	assert.Equal(t, currentTime, update["$max"].(model.DBM)["lasttime"])
+	assert.Equal(t, currentTime, update["$max"].(model.DBM)["total.lasttime"])
+	assert.Equal(t, "total", update["$min"].(model.DBM)["total.identifier"])
+	assert.NotContains(t, update["$set"], "lasttime")
+	assert.NotContains(t, update["$set"], "total.lasttime")
+	assert.NotContains(t, update["$set"], "total.identifier")
+	assert.Contains(t, update["$set"], "total.humanidentifier")
+	assert.Equal(t, 1, update["$inc"].(model.DBM)["total.hits"])
+}
+
+func TestValidateMergeStrategies(t *testing.T) {
+	assert.Nil(t, ValidateMergeStrategies(nil))
+	assert.Nil(t, ValidateMergeStrategies(map[string]string{"lasttime": MergeStrategyMax, "identifier": MergeStrategySet}))
+	assert.EqualError(t, ValidateMergeStrategies(map[string]string{"hits": MergeStrategyMax}), `merge strategy of unsupported field "hits"`)
+	assert.EqualError(t, ValidateMergeStrategies(map[string]string{"lasttime": "latest"}), `invalid merge strategy "latest" of field "lasttime"`)
+}
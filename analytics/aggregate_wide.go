@@ -0,0 +1,100 @@
+package analytics
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// AggregateWideSQLTable is the table of the wide aggregate rows.
+const AggregateWideSQLTable = "tyk_aggregated_wide"
+
+// SQLAnalyticsRecordAggregateWide is a denormalized aggregate row, counting the records of an API
+// with a response code in a time bucket. Unlike SQLAnalyticsRecordAggregate, which keys the
+// counters by dimension, every row can be queried directly by BI tools. The averages are the
+// totals divided by the hits.
+type SQLAnalyticsRecordAggregateWide struct {
+	ID string `gorm:"primaryKey"`
+
+	TimeStamp    int64  `json:"timestamp"`
+	OrgID        string `json:"org_id"`
+	APIID        string `json:"api_id"`
+	APIName      string `json:"api_name"`
+	ResponseCode int    `json:"response_code"`
+
+	Hits                 int     `json:"hits"`
+	Success              int     `json:"success"`
+	ErrorTotal           int     `json:"error" gorm:"column:error"`
+	TotalRequestTime     float64 `json:"total_request_time"`
+	TotalLatency         int64   `json:"total_latency"`
+	TotalUpstreamLatency int64   `json:"total_upstream_latency"`
+}
+
+func (f *SQLAnalyticsRecordAggregateWide) TableName() string {
+	return AggregateWideSQLTable
+}
+
+// AggregateWideData aggregates the records into one wide row per time bucket, org, API and
+// response code. The buckets are of aggregationTime minutes, 60 for hourly buckets or 1 for per
+// minute ones. The graph records and the records without org are skipped, like in AggregateData.
+func AggregateWideData(data []interface{}, aggregationTime int) []SQLAnalyticsRecordAggregateWide {
+	rows := make(map[string]*SQLAnalyticsRecordAggregateWide)
+	for _, v := range data {
+		record := v.(AnalyticsRecord)
+		// the network records have no response code, and aren't hits
+		if record.OrgID == "" || record.IsGraphRecord() || record.ResponseCode == -1 {
+			continue
+		}
+
+		timestamp := setAggregateTimestamp("", record.TimeStamp, aggregationTime).Unix()
+		id := hex.EncodeToString([]byte(fmt.Sprintf("%v", timestamp) + record.OrgID + record.APIID + fmt.Sprintf("%v", record.ResponseCode)))
+		row, found := rows[id]
+		if !found {
+			row = &SQLAnalyticsRecordAggregateWide{
+				ID:           id,
+				TimeStamp:    timestamp,
+				OrgID:        record.OrgID,
+				APIID:        record.APIID,
+				ResponseCode: record.ResponseCode,
+			}
+			rows[id] = row
+		}
+		if record.APIName != "" {
+			row.APIName = record.APIName
+		}
+
+		row.Hits++
+		if record.ResponseCode >= 400 {
+			row.ErrorTotal++
+		}
+		if record.ResponseCode >= 200 && record.ResponseCode < 300 {
+			row.Success++
+		}
+		row.TotalRequestTime += float64(record.RequestTime)
+		row.TotalLatency += record.Latency.Total
+		row.TotalUpstreamLatency += record.Latency.Upstream
+	}
+
+	wide := make([]SQLAnalyticsRecordAggregateWide, 0, len(rows))
+	for _, row := range rows {
+		wide = append(wide, *row)
+	}
+	sort.Slice(wide, func(i, j int) bool {
+		return wide[i].ID < wide[j].ID
+	})
+	return wide
+}
+
+// WideOnConflictAssignments returns the assignments adding the counters of the wide rows of
+// tempTable to the ones already in tableName.
+func WideOnConflictAssignments(tableName, tempTable string) map[string]interface{} {
+	assignments := map[string]interface{}{
+		"api_name": gorm.Expr(tempTable + ".api_name"),
+	}
+	for _, colName := range []string{"hits", "success", "error", "total_request_time", "total_latency", "total_upstream_latency"} {
+		assignments[colName] = gorm.Expr(tableName + "." + colName + " + " + tempTable + "." + colName)
+	}
+	return assignments
+}
@@ -2,8 +2,12 @@ package analytics
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"mime"
 	"net"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
@@ -33,6 +37,9 @@ type NetworkStats struct {
 	BytesOut         int64 `json:"bytes_out"`
 }
 
+// NetworkStatsColumns are the SQL columns of the network stats of the records.
+var NetworkStatsColumns = []string{"network_open_connections", "network_closed_connections", "network_bytes_in", "network_bytes_out"}
+
 type Latency struct {
 	Total    int64 `json:"total"`
 	Upstream int64 `json:"upstream"`
@@ -74,6 +81,9 @@ type AnalyticsRecord struct {
 	ExpireAt      time.Time      `bson:"expireAt" json:"expireAt"`
 	ApiSchema     string         `json:"api_schema" bson:"-" gorm:"-:all"` //nolint
 
+	// the fields derived from the record by the pump
+	Enrichment `bson:",inline" msgpack:",inline" structs:",flatten" gorm:"-:all"`
+
 	GraphQLStats   GraphQLStats `json:"graphql_stats" bson:"-" gorm:"-:all"`
 	CollectionName string       `json:"-" bson:"-" gorm:"-:all"`
 }
@@ -165,6 +175,16 @@ func (g *GeoData) GetFieldNames() []string {
 }
 
 func (a *AnalyticsRecord) GetFieldNames() []string {
+	return a.fieldNames(false)
+}
+
+// GetJSONFieldNames returns the field names as GetFieldNames, with a single column for each of
+// the complex fields: GeoData, NetworkStats, Latency and Tags.
+func (a *AnalyticsRecord) GetJSONFieldNames() []string {
+	return a.fieldNames(true)
+}
+
+func (a *AnalyticsRecord) fieldNames(complexAsJSON bool) []string {
 	fields := []string{
 		"Method",
 		"Host",
@@ -189,9 +209,13 @@ func (a *AnalyticsRecord) GetFieldNames() []string {
 		"RawResponse",
 		"IPAddress",
 	}
-	fields = append(fields, a.Geo.GetFieldNames()...)
-	fields = append(fields, a.Network.GetFieldNames()...)
-	fields = append(fields, a.Latency.GetFieldNames()...)
+	if complexAsJSON {
+		fields = append(fields, "GeoData", "NetworkStats", "Latency")
+	} else {
+		fields = append(fields, a.Geo.GetFieldNames()...)
+		fields = append(fields, a.Network.GetFieldNames()...)
+		fields = append(fields, a.Latency.GetFieldNames()...)
+	}
 	return append(fields, "Tags", "Alias", "TrackPath", "ExpireAt", "ApiSchema")
 }
 
@@ -236,6 +260,16 @@ func (g *GeoData) GetLineValues() []string {
 }
 
 func (a *AnalyticsRecord) GetLineValues() []string {
+	return a.lineValues(false)
+}
+
+// GetJSONLineValues returns the values as GetLineValues, with the complex fields JSON encoded in
+// a single value each, so they can be decoded back.
+func (a *AnalyticsRecord) GetJSONLineValues() []string {
+	return a.lineValues(true)
+}
+
+func (a *AnalyticsRecord) lineValues(complexAsJSON bool) []string {
 	fields := []string{}
 	fields = append(fields, a.Method, a.Host, a.Path, a.RawPath)
 	fields = append(fields, strconv.FormatUint(uint64(a.ContentLength), 10))
@@ -250,10 +284,18 @@ func (a *AnalyticsRecord) GetLineValues() []string {
 	fields = append(fields, a.APIVersion, a.APIName, a.APIID, a.OrgID, a.OauthID)
 	fields = append(fields, strconv.FormatUint(uint64(a.RequestTime), 10))
 	fields = append(fields, a.RawRequest, a.RawResponse, a.IPAddress)
-	fields = append(fields, a.Geo.GetLineValues()...)
-	fields = append(fields, a.Network.GetLineValues()...)
-	fields = append(fields, a.Latency.GetLineValues()...)
-	fields = append(fields, strings.Join(a.Tags[:], ";"))
+	if complexAsJSON {
+		tags := a.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		fields = append(fields, jsonValue(a.Geo), jsonValue(a.Network), jsonValue(a.Latency), jsonValue(tags))
+	} else {
+		fields = append(fields, a.Geo.GetLineValues()...)
+		fields = append(fields, a.Network.GetLineValues()...)
+		fields = append(fields, a.Latency.GetLineValues()...)
+		fields = append(fields, strings.Join(a.Tags[:], ";"))
+	}
 	fields = append(fields, a.Alias)
 	fields = append(fields, strconv.FormatBool(a.TrackPath))
 	fields = append(fields, a.ExpireAt.String())
@@ -262,6 +304,15 @@ func (a *AnalyticsRecord) GetLineValues() []string {
 	return fields
 }
 
+// jsonValue returns v JSON encoded, or "" if it can't be encoded.
+func jsonValue(v interface{}) string {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
 func (a *AnalyticsRecord) TrimRawData(size int) {
 	// trim RawResponse
 	a.RawResponse = trimString(size, a.RawResponse)
@@ -296,6 +347,16 @@ func (a *AnalyticsRecord) SetExpiry(expiresInSeconds int64) {
 	a.ExpireAt = t2
 }
 
+// SetTTL sets the expiry of the record to ttl after its timestamp, or after now if it doesn't have
+// any.
+func (a *AnalyticsRecord) SetTTL(ttl time.Duration) {
+	from := a.TimeStamp
+	if from.IsZero() {
+		from = time.Now()
+	}
+	a.ExpireAt = from.Add(ttl)
+}
+
 func trimString(size int, value string) string {
 	trimBuffer := bytes.Buffer{}
 	defer trimBuffer.Reset()
@@ -315,7 +376,10 @@ func trimString(size int, value string) string {
 func (a *AnalyticsRecord) TimestampToProto(newRecord *analyticsproto.AnalyticsRecord) {
 	// save original location
 	newRecord.TimeStamp = timestamppb.New(a.TimeStamp)
-	newRecord.ExpireAt = timestamppb.New(a.ExpireAt)
+	// the expiry is kept in epoch milliseconds, and left unset when there's none
+	if millis := ExpireAtMillis(a.ExpireAt); millis != 0 {
+		newRecord.ExpireAt = timestamppb.New(time.UnixMilli(millis))
+	}
 	newRecord.TimeZone = a.TimeStamp.Location().String()
 }
 
@@ -323,13 +387,18 @@ func (a *AnalyticsRecord) TimeStampFromProto(protoRecord analyticsproto.Analytic
 	// get timestamp in original location
 	loc, err := time.LoadLocation(protoRecord.TimeZone)
 	if err != nil {
+		// e.g. a zone abbreviation, the instant is kept in UTC
 		log.Error(err)
-		return
+		loc = time.UTC
 	}
 
 	// assign timestamp in original location
 	a.TimeStamp = protoRecord.TimeStamp.AsTime().In(loc)
-	a.ExpireAt = protoRecord.ExpireAt.AsTime().In(loc)
+	// an unset expiry is no expiry, not the epoch
+	a.ExpireAt = time.Time{}
+	if protoRecord.ExpireAt != nil {
+		a.ExpireAt = ExpireAtFromMillis(protoRecord.ExpireAt.AsTime().UnixMilli())
+	}
 }
 
 func (a *AnalyticsRecord) GetGeo(ipStr string, GeoIPDB *maxminddb.Reader) {
@@ -377,10 +446,159 @@ func (a *AnalyticsRecord) IsGraphRecord() bool {
 	return a.GraphQLStats.IsGraphQL
 }
 
+// TagValue returns the value of the first `key:value` or `key-value` tag of the record.
+func (a *AnalyticsRecord) TagValue(key string) (string, bool) {
+	for _, tag := range a.Tags {
+		for _, sep := range []string{":", "-"} {
+			if value := strings.TrimPrefix(tag, key+sep); value != tag && value != "" {
+				return value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// SetLatencyBreakdown promotes the nested latency into the flat LatencyTotal and LatencyUpstream
+// fields, and computes LatencyGateway as the time spent in the gateway (total - upstream).
+func (a *AnalyticsRecord) SetLatencyBreakdown() {
+	a.LatencyTotal = a.Latency.Total
+	a.LatencyUpstream = a.Latency.Upstream
+	a.LatencyGateway = a.Latency.Total - a.Latency.Upstream
+	if a.LatencyGateway < 0 {
+		a.LatencyGateway = 0
+	}
+}
+
+// BackfillRequestLine populates Method and Path from the request line of the raw request when
+// they are empty. Malformed request lines leave the record untouched.
+func (a *AnalyticsRecord) BackfillRequestLine(raw *RawData) {
+	if (a.Method != "" && a.Path != "") || a.RawRequest == "" {
+		return
+	}
+
+	method, path, ok := parseRequestLine(raw.Request())
+	if !ok {
+		log.Debug("Unable to backfill method and path: malformed request line")
+		return
+	}
+
+	if a.Method == "" {
+		a.Method = method
+	}
+	if a.Path == "" {
+		a.Path = path
+	}
+}
+
+// SetResponseContentLength populates ResponseContentLength from the Content-Length header of the
+// raw response. Malformed responses, or responses without a Content-Length header, leave the
+// record untouched.
+func (a *AnalyticsRecord) SetResponseContentLength(raw *RawData) {
+	resp := raw.Response()
+	if resp == nil {
+		return
+	}
+
+	if resp.ContentLength >= 0 {
+		a.ResponseContentLength = resp.ContentLength
+	}
+}
+
+// SetResponseContentType populates ResponseContentType with the media type of the Content-Type
+// header of the raw response, lowercased and without its parameters, e.g. `application/json` for
+// `application/json; charset=utf-8`. Malformed responses, or responses without a valid
+// Content-Type header, leave the record untouched.
+func (a *AnalyticsRecord) SetResponseContentType(raw *RawData) {
+	header := raw.ResponseHeader()
+	if header == nil {
+		return
+	}
+
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		return
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		log.Debug("Unable to set the response content type: ", err)
+		return
+	}
+	a.ResponseContentType = mediaType
+}
+
+// decodeRawData returns the base64 decoded value of the raw data, or the raw data itself if it
+// isn't base64 encoded.
+func decodeRawData(raw string) string {
+	decoded, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return raw
+	}
+	return string(decoded)
+}
+
+func parseRequestLine(rawRequest string) (method, path string, ok bool) {
+	requestLine := rawRequest
+	if i := strings.IndexByte(requestLine, '\n'); i >= 0 {
+		requestLine = requestLine[:i]
+	}
+	parts := strings.Split(strings.TrimRight(requestLine, "\r"), " ")
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "HTTP/") {
+		return "", "", false
+	}
+
+	method = parts[0]
+	for _, c := range method {
+		if c < 'A' || c > 'Z' {
+			return "", "", false
+		}
+	}
+	if method == "" {
+		return "", "", false
+	}
+
+	target, err := url.ParseRequestURI(parts[1])
+	if err != nil {
+		return "", "", false
+	}
+	path = target.Path
+	if path == "" {
+		path = "/"
+	}
+	return method, path, true
+}
+
+// fields returns the fields of the record, with the fields of its Enrichment in place of it, as
+// they're inlined in its JSON.
+func (a *AnalyticsRecord) fields() []*structs.Field {
+	fields := []*structs.Field{}
+	for _, field := range structs.Fields(a) {
+		if field.Name() == "Enrichment" {
+			fields = append(fields, field.Fields()...)
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// KeepFields sets the fields whose JSON tag isn't in allowedFields to their zero value. The
+// fields without JSON tag, like the collection name, are kept.
+func (a *AnalyticsRecord) KeepFields(allowedFields []string) {
+	for _, field := range a.fields() {
+		fieldTag := strings.Split(field.Tag("json"), ",")[0]
+		if fieldTag == "" || fieldTag == "-" || stringInSlice(fieldTag, allowedFields) {
+			continue
+		}
+		if err := field.Zero(); err != nil {
+			log.Error("Unable to ignore "+field.Name()+" field: ", err)
+		}
+	}
+}
+
 func (a *AnalyticsRecord) RemoveIgnoredFields(ignoreFields []string) {
 	for _, fieldToIgnore := range ignoreFields {
 		found := false
-		for _, field := range structs.Fields(a) {
+		for _, field := range a.fields() {
 			fieldTag := field.Tag("json")
 			if fieldTag == fieldToIgnore {
 				// setting field to default value
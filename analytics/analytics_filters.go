@@ -1,5 +1,11 @@
 package analytics
 
+import (
+	"net"
+	"path"
+	"strings"
+)
+
 type AnalyticsFilters struct {
 	// Filters pump data by the whitelisted org_ids.
 	OrgsIDs []string `json:"org_ids"`
@@ -13,6 +19,23 @@ type AnalyticsFilters struct {
 	SkippedAPIIDs []string `json:"skip_api_ids"`
 	// Filters pump data by the blacklisted response_codes.
 	SkippedResponseCodes []int `json:"skip_response_codes"`
+	// Filters pump data by the whitelisted hosts. The hosts can be glob patterns, e.g.
+	// `*.example.com`.
+	Hosts []string `json:"hosts"`
+	// Filters pump data by the blacklisted hosts. The hosts can be glob patterns, e.g.
+	// `*.internal`.
+	SkippedHosts []string `json:"skip_hosts"`
+	// Filters out the records tagged as `replayed`, so they aren't counted twice. E.g. by the
+	// aggregate pumps.
+	SkipReplayed bool `json:"skip_replayed"`
+	// Filters out the records flagged by the PII detection as containing PII.
+	SkipPII bool `json:"skip_pii"`
+	// Filters out the records not flagged by the PII detection as containing PII, e.g. for a sink
+	// with stricter access controls.
+	OnlyPII bool `json:"only_pii"`
+	// Filters out the records other than the batch summary ones, e.g. for a monitoring sink
+	// receiving the summaries only.
+	OnlyBatchSummary bool `json:"only_batch_summary"`
 }
 
 func (filters AnalyticsFilters) ShouldFilter(record AnalyticsRecord) bool {
@@ -23,18 +46,30 @@ func (filters AnalyticsFilters) ShouldFilter(record AnalyticsRecord) bool {
 		return true
 	case len(filters.SkippedResponseCodes) > 0 && intInSlice(record.ResponseCode, filters.SkippedResponseCodes):
 		return true
+	case len(filters.SkippedHosts) > 0 && hostMatches(record.Host, filters.SkippedHosts):
+		return true
+	case filters.SkipReplayed && record.IsReplayed():
+		return true
+	case filters.SkipPII && record.ContainsPII:
+		return true
+	case filters.OnlyPII && !record.ContainsPII:
+		return true
+	case filters.OnlyBatchSummary && !record.IsBatchSummary():
+		return true
 	case len(filters.APIIDs) > 0 && !stringInSlice(record.APIID, filters.APIIDs):
 		return true
 	case len(filters.OrgsIDs) > 0 && !stringInSlice(record.OrgID, filters.OrgsIDs):
 		return true
 	case len(filters.ResponseCodes) > 0 && !intInSlice(record.ResponseCode, filters.ResponseCodes):
 		return true
+	case len(filters.Hosts) > 0 && !hostMatches(record.Host, filters.Hosts):
+		return true
 	}
 	return false
 }
 
 func (filters AnalyticsFilters) HasFilter() bool {
-	if len(filters.SkippedAPIIDs) == 0 && len(filters.SkippedOrgsIDs) == 0 && len(filters.ResponseCodes) == 0 && len(filters.APIIDs) == 0 && len(filters.OrgsIDs) == 0 && len(filters.SkippedResponseCodes) == 0 {
+	if len(filters.SkippedAPIIDs) == 0 && len(filters.SkippedOrgsIDs) == 0 && len(filters.ResponseCodes) == 0 && len(filters.APIIDs) == 0 && len(filters.OrgsIDs) == 0 && len(filters.SkippedResponseCodes) == 0 && len(filters.Hosts) == 0 && len(filters.SkippedHosts) == 0 && !filters.SkipReplayed && !filters.SkipPII && !filters.OnlyPII && !filters.OnlyBatchSummary {
 		return false
 	}
 	return true
@@ -57,3 +92,27 @@ func intInSlice(a int, list []int) bool {
 	}
 	return false
 }
+
+// hostMatches reports whether the host, or its hostname when it has a port, matches one of the
+// patterns, case insensitively. The patterns are path.Match patterns, e.g. `*.example.com`.
+func hostMatches(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if pattern == host || pattern == hostname {
+			return true
+		}
+		if matched, _ := path.Match(pattern, host); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, hostname); matched {
+			return true
+		}
+	}
+	return false
+}
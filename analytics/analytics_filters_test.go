@@ -81,6 +81,13 @@ func TestShouldFilter(t *testing.T) {
 			},
 			expectedFiltering: true,
 		},
+		{
+			testName: "skip_replayed not replayed",
+			filter: AnalyticsFilters{
+				SkipReplayed: true,
+			},
+			expectedFiltering: false,
+		},
 		{
 			testName:          "no filter",
 			filter:            AnalyticsFilters{},
@@ -119,4 +126,122 @@ func TestHasFilter(t *testing.T) {
 	if hasFilter == false {
 		t.Fatal("HasFilter should be true.")
 	}
+
+	filter = AnalyticsFilters{
+		SkipReplayed: true,
+	}
+	hasFilter = filter.HasFilter()
+	if hasFilter == false {
+		t.Fatal("HasFilter should be true.")
+	}
+
+	filter = AnalyticsFilters{
+		OnlyPII: true,
+	}
+	hasFilter = filter.HasFilter()
+	if hasFilter == false {
+		t.Fatal("HasFilter should be true.")
+	}
+}
+
+func TestShouldFilter_PII(t *testing.T) {
+	record := AnalyticsRecord{APIID: "apiid123"}
+	piiRecord := AnalyticsRecord{APIID: "apiid123", Enrichment: Enrichment{ContainsPII: true, PIICategories: []string{"email"}}}
+
+	skip := AnalyticsFilters{SkipPII: true}
+	assert.False(t, skip.ShouldFilter(record))
+	assert.True(t, skip.ShouldFilter(piiRecord))
+
+	only := AnalyticsFilters{OnlyPII: true}
+	assert.True(t, only.ShouldFilter(record))
+	assert.False(t, only.ShouldFilter(piiRecord))
+}
+
+func TestShouldFilter_Hosts(t *testing.T) {
+	tcs := []struct {
+		testName          string
+		filter            AnalyticsFilters
+		host              string
+		expectedFiltering bool
+	}{
+		{
+			testName:          "allowed host",
+			filter:            AnalyticsFilters{Hosts: []string{"api.example.com"}},
+			host:              "api.example.com",
+			expectedFiltering: false,
+		},
+		{
+			testName:          "other host",
+			filter:            AnalyticsFilters{Hosts: []string{"api.example.com"}},
+			host:              "admin.example.com",
+			expectedFiltering: true,
+		},
+		{
+			testName:          "allowed wildcard host",
+			filter:            AnalyticsFilters{Hosts: []string{"*.example.com"}},
+			host:              "eu.api.example.com",
+			expectedFiltering: false,
+		},
+		{
+			testName:          "wildcard doesn't match the bare domain",
+			filter:            AnalyticsFilters{Hosts: []string{"*.example.com"}},
+			host:              "example.com",
+			expectedFiltering: true,
+		},
+		{
+			testName:          "host with port",
+			filter:            AnalyticsFilters{Hosts: []string{"api.example.com"}},
+			host:              "api.example.com:8080",
+			expectedFiltering: false,
+		},
+		{
+			testName:          "pattern with port",
+			filter:            AnalyticsFilters{Hosts: []string{"api.example.com:80*"}},
+			host:              "api.example.com:8443",
+			expectedFiltering: true,
+		},
+		{
+			testName:          "case insensitive",
+			filter:            AnalyticsFilters{Hosts: []string{"API.example.com"}},
+			host:              "api.EXAMPLE.com",
+			expectedFiltering: false,
+		},
+		{
+			testName:          "skipped host",
+			filter:            AnalyticsFilters{SkippedHosts: []string{"admin.example.com"}},
+			host:              "admin.example.com",
+			expectedFiltering: true,
+		},
+		{
+			testName:          "skipped wildcard host",
+			filter:            AnalyticsFilters{SkippedHosts: []string{"*.internal"}},
+			host:              "billing.internal:9000",
+			expectedFiltering: true,
+		},
+		{
+			testName:          "not skipped host",
+			filter:            AnalyticsFilters{SkippedHosts: []string{"*.internal"}},
+			host:              "api.example.com",
+			expectedFiltering: false,
+		},
+		{
+			testName:          "skipped hosts over allowed hosts",
+			filter:            AnalyticsFilters{Hosts: []string{"*.example.com"}, SkippedHosts: []string{"admin.example.com"}},
+			host:              "admin.example.com",
+			expectedFiltering: true,
+		},
+		{
+			testName:          "invalid pattern",
+			filter:            AnalyticsFilters{Hosts: []string{"[api.example.com"}},
+			host:              "api.example.com",
+			expectedFiltering: true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.True(t, tc.filter.HasFilter())
+			assert.Equal(t, tc.expectedFiltering, tc.filter.ShouldFilter(AnalyticsRecord{Host: tc.host}))
+		})
+	}
 }
@@ -1,6 +1,7 @@
 package analytics
 
 import (
+	"encoding/base64"
 	"fmt"
 	"testing"
 	"time"
@@ -93,6 +94,28 @@ func TestAnalyticsRecord_RemoveIgnoredFields(t *testing.T) {
 	}
 }
 
+func TestAnalyticsRecord_KeepFields(t *testing.T) {
+	record := AnalyticsRecord{
+		APIID:          "api123",
+		APIKey:         "api_key_123",
+		OrgID:          "org_123",
+		ResponseCode:   200,
+		Tags:           []string{"tag1"},
+		Latency:        Latency{Total: 10, Upstream: 8},
+		Geo:            GeoData{City: City{GeoNameID: 1}},
+		CollectionName: "z_tyk_analyticz_org_123",
+	}
+
+	record.KeepFields([]string{"api_id", "response_code", "latency"})
+
+	assert.Equal(t, AnalyticsRecord{
+		APIID:          "api123",
+		ResponseCode:   200,
+		Latency:        Latency{Total: 10, Upstream: 8},
+		CollectionName: "z_tyk_analyticz_org_123",
+	}, record)
+}
+
 func TestAnalyticsRecord_Base(t *testing.T) {
 	rec := &AnalyticsRecord{}
 
@@ -176,3 +199,265 @@ func TestAnalyticsRecord_GetLineValues(t *testing.T) {
 		}
 	}
 }
+
+func TestAnalyticsRecord_GetJSONLineValues(t *testing.T) {
+	rec := &AnalyticsRecord{
+		APIID:   "api123",
+		Tags:    []string{"tag1", "tag2"},
+		Latency: Latency{Total: 10, Upstream: 8},
+	}
+	rec.Geo.Country.ISOCode = "GB"
+
+	names := rec.GetJSONFieldNames()
+	values := rec.GetJSONLineValues()
+	assert.Equal(t, 30, len(names))
+	assert.Equal(t, len(names), len(values))
+
+	cells := map[string]string{}
+	for i, name := range names {
+		cells[name] = values[i]
+	}
+	assert.Equal(t, "api123", cells["APIID"])
+	assert.Equal(t, `["tag1","tag2"]`, cells["Tags"])
+	assert.Equal(t, `{"total":10,"upstream":8}`, cells["Latency"])
+	assert.Equal(t, `{"open_connections":0,"closed_connections":0,"bytes_in":0,"bytes_out":0}`, cells["NetworkStats"])
+	assert.Contains(t, cells["GeoData"], `"iso_code":"GB"`)
+
+	// the records without tags have an empty list
+	for i, value := range (&AnalyticsRecord{}).GetJSONLineValues() {
+		if names[i] == "Tags" {
+			assert.Equal(t, "[]", value)
+		}
+	}
+}
+
+func TestAnalyticsRecord_BackfillRequestLine(t *testing.T) {
+	rawRequest := "POST /users/123?active=true HTTP/1.1\r\nHost: localhost:8080\r\n\r\n"
+
+	tcs := []struct {
+		testName       string
+		record         AnalyticsRecord
+		expectedMethod string
+		expectedPath   string
+	}{
+		{
+			testName:       "base64 encoded raw request",
+			record:         AnalyticsRecord{RawRequest: base64.StdEncoding.EncodeToString([]byte(rawRequest))},
+			expectedMethod: "POST",
+			expectedPath:   "/users/123",
+		},
+		{
+			testName:       "plain raw request",
+			record:         AnalyticsRecord{RawRequest: rawRequest},
+			expectedMethod: "POST",
+			expectedPath:   "/users/123",
+		},
+		{
+			testName:       "absolute request target",
+			record:         AnalyticsRecord{RawRequest: "GET http://localhost:8080/status HTTP/1.1\r\n\r\n"},
+			expectedMethod: "GET",
+			expectedPath:   "/status",
+		},
+		{
+			testName:       "only missing path",
+			record:         AnalyticsRecord{Method: "PUT", RawRequest: rawRequest},
+			expectedMethod: "PUT",
+			expectedPath:   "/users/123",
+		},
+		{
+			testName:       "fields already set",
+			record:         AnalyticsRecord{Method: "GET", Path: "/original", RawRequest: rawRequest},
+			expectedMethod: "GET",
+			expectedPath:   "/original",
+		},
+		{
+			testName: "malformed request line",
+			record:   AnalyticsRecord{RawRequest: "this is not a request"},
+		},
+		{
+			testName: "invalid method",
+			record:   AnalyticsRecord{RawRequest: "get / HTTP/1.1\r\n\r\n"},
+		},
+		{
+			testName: "empty raw request",
+			record:   AnalyticsRecord{},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			record := tc.record
+			record.BackfillRequestLine(NewRawData(&record))
+
+			assert.Equal(t, tc.expectedMethod, record.Method)
+			assert.Equal(t, tc.expectedPath, record.Path)
+		})
+	}
+}
+
+func TestAnalyticsRecord_SetLatencyBreakdown(t *testing.T) {
+	tcs := []struct {
+		testName         string
+		latency          Latency
+		expectedGateway  int64
+		expectedTotal    int64
+		expectedUpstream int64
+	}{
+		{
+			testName:         "total and upstream",
+			latency:          Latency{Total: 120, Upstream: 100},
+			expectedTotal:    120,
+			expectedUpstream: 100,
+			expectedGateway:  20,
+		},
+		{
+			testName:        "no upstream",
+			latency:         Latency{Total: 15},
+			expectedTotal:   15,
+			expectedGateway: 15,
+		},
+		{
+			testName:         "upstream greater than total",
+			latency:          Latency{Total: 10, Upstream: 12},
+			expectedTotal:    10,
+			expectedUpstream: 12,
+			expectedGateway:  0,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			record := AnalyticsRecord{Latency: tc.latency}
+			record.SetLatencyBreakdown()
+
+			assert.Equal(t, tc.expectedTotal, record.LatencyTotal)
+			assert.Equal(t, tc.expectedUpstream, record.LatencyUpstream)
+			assert.Equal(t, tc.expectedGateway, record.LatencyGateway)
+		})
+	}
+}
+
+func TestAnalyticsRecord_SetResponseContentLength(t *testing.T) {
+	rawResponse := "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 17\r\n\r\n{\"status\":\"ok\"}"
+
+	tcs := []struct {
+		testName       string
+		record         AnalyticsRecord
+		expectedLength int64
+	}{
+		{
+			testName:       "base64 encoded raw response",
+			record:         AnalyticsRecord{ContentLength: 42, RawResponse: base64.StdEncoding.EncodeToString([]byte(rawResponse))},
+			expectedLength: 17,
+		},
+		{
+			testName:       "plain raw response",
+			record:         AnalyticsRecord{ContentLength: 42, RawResponse: rawResponse},
+			expectedLength: 17,
+		},
+		{
+			testName:       "truncated body",
+			record:         AnalyticsRecord{RawResponse: "HTTP/1.1 200 OK\r\nContent-Length: 2048\r\n\r\n{\"sta"},
+			expectedLength: 2048,
+		},
+		{
+			testName: "no content length header",
+			record:   AnalyticsRecord{RawResponse: "HTTP/1.1 204 No Content\r\n\r\n"},
+		},
+		{
+			testName: "malformed raw response",
+			record:   AnalyticsRecord{RawResponse: "this is not a response"},
+		},
+		{
+			testName: "empty raw response",
+			record:   AnalyticsRecord{},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			record := tc.record
+			record.SetResponseContentLength(NewRawData(&record))
+
+			assert.Equal(t, tc.expectedLength, record.ResponseContentLength)
+			assert.Equal(t, tc.record.ContentLength, record.ContentLength)
+		})
+	}
+}
+
+func TestAnalyticsRecord_SetResponseContentType(t *testing.T) {
+	jsonResponse := "HTTP/1.1 200 OK\r\nContent-Type: application/json; charset=utf-8\r\nContent-Length: 15\r\n\r\n{\"status\":\"ok\"}"
+	htmlResponse := "HTTP/1.1 200 OK\r\nContent-Type: Text/HTML\r\n\r\n<html><body>ok</body></html>"
+
+	tcs := []struct {
+		testName     string
+		record       AnalyticsRecord
+		expectedType string
+	}{
+		{
+			testName:     "json response",
+			record:       AnalyticsRecord{RawResponse: base64.StdEncoding.EncodeToString([]byte(jsonResponse))},
+			expectedType: "application/json",
+		},
+		{
+			testName:     "html response",
+			record:       AnalyticsRecord{RawResponse: htmlResponse},
+			expectedType: "text/html",
+		},
+		{
+			testName: "no content type header",
+			record:   AnalyticsRecord{RawResponse: "HTTP/1.1 204 No Content\r\n\r\n"},
+		},
+		{
+			testName: "invalid content type",
+			record:   AnalyticsRecord{RawResponse: "HTTP/1.1 200 OK\r\nContent-Type: ;charset=utf-8\r\n\r\n"},
+		},
+		{
+			testName: "malformed raw response",
+			record:   AnalyticsRecord{RawResponse: "this is not a response"},
+		},
+		{
+			testName: "no raw response",
+			record:   AnalyticsRecord{},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			record := tc.record
+			record.SetResponseContentType(NewRawData(&record))
+
+			assert.Equal(t, tc.expectedType, record.ResponseContentType)
+		})
+	}
+}
+
+func TestAnalyticsRecord_TagValue(t *testing.T) {
+	record := AnalyticsRecord{Tags: []string{"key-abc", "env:prod", "trace_id-123", "empty:"}}
+
+	value, ok := record.TagValue("env")
+	assert.True(t, ok)
+	assert.Equal(t, "prod", value)
+
+	value, ok = record.TagValue("trace_id")
+	assert.True(t, ok)
+	assert.Equal(t, "123", value)
+
+	_, ok = record.TagValue("empty")
+	assert.False(t, ok)
+
+	_, ok = record.TagValue("missing")
+	assert.False(t, ok)
+}
+
+func TestAnalyticsRecord_SetTTL(t *testing.T) {
+	timestamp := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	record := AnalyticsRecord{TimeStamp: timestamp, ExpireAt: timestamp.Add(time.Minute)}
+	record.SetTTL(24 * time.Hour)
+	assert.Equal(t, timestamp.Add(24*time.Hour), record.ExpireAt)
+
+	// without timestamp, the TTL starts now
+	record = AnalyticsRecord{}
+	record.SetTTL(time.Hour)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), record.ExpireAt, time.Minute)
+}
@@ -0,0 +1,93 @@
+package analytics
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// BatchSummaryTag tags the synthetic records summarising the records of a purge, so they can be
+	// told apart from the other records with the filters.
+	BatchSummaryTag = "batch_summary"
+
+	// BatchRecordsTag is the key of the tag of a batch summary holding the number of records of the
+	// batch.
+	BatchRecordsTag = "batch_records"
+	// BatchResponseCodeTagPrefix prefixes the keys of the tags of a batch summary holding the number
+	// of records of the batch for each response code, e.g. `batch_response_code_200:12`.
+	BatchResponseCodeTagPrefix = "batch_response_code_"
+)
+
+// BatchSummary accumulates the records of the batches of a purge, for the synthetic record
+// summarising them. Its zero value is an empty summary.
+type BatchSummary struct {
+	records       int
+	responseCodes map[int]int
+	requestTime   int64
+	latency       Latency
+}
+
+// Add adds the records of keys to the summary. The keys that aren't an AnalyticsRecord are left
+// out.
+func (s *BatchSummary) Add(keys []interface{}) {
+	if s.responseCodes == nil {
+		s.responseCodes = map[int]int{}
+	}
+	for _, key := range keys {
+		record, ok := key.(AnalyticsRecord)
+		if !ok {
+			continue
+		}
+		s.records++
+		s.responseCodes[record.ResponseCode]++
+		s.requestTime += record.RequestTime
+		s.latency.Total += record.Latency.Total
+		s.latency.Upstream += record.Latency.Upstream
+	}
+}
+
+// Records returns the number of records added to the summary.
+func (s *BatchSummary) Records() int {
+	return s.records
+}
+
+// Record returns the synthetic record summarising the records added, timestamped at. It's tagged
+// with BatchSummaryTag, the number of records and their number for each response code, as
+// `key:value` tags. Its RequestTime and Latency are the totals of the records.
+func (s *BatchSummary) Record(at time.Time) AnalyticsRecord {
+	summary := AnalyticsRecord{
+		TimeStamp:   at,
+		Day:         at.Day(),
+		Month:       at.Month(),
+		Year:        at.Year(),
+		Hour:        at.Hour(),
+		RequestTime: s.requestTime,
+		Latency:     s.latency,
+	}
+
+	codes := make([]int, 0, len(s.responseCodes))
+	for code := range s.responseCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	summary.Tags = append(summary.Tags, BatchSummaryTag, BatchRecordsTag+":"+strconv.Itoa(s.records))
+	for _, code := range codes {
+		summary.Tags = append(summary.Tags, BatchResponseCodeTagPrefix+strconv.Itoa(code)+":"+strconv.Itoa(s.responseCodes[code]))
+	}
+	return summary
+}
+
+// NewBatchSummary returns a synthetic record summarising the records of a batch, timestamped at,
+// as BatchSummary.Record does.
+func NewBatchSummary(keys []interface{}, at time.Time) AnalyticsRecord {
+	var summary BatchSummary
+	summary.Add(keys)
+	return summary.Record(at)
+}
+
+// IsBatchSummary reports whether the record is tagged with BatchSummaryTag.
+func (a *AnalyticsRecord) IsBatchSummary() bool {
+	return stringInSlice(BatchSummaryTag, a.Tags)
+}
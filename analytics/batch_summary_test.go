@@ -0,0 +1,75 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBatchSummary(t *testing.T) {
+	at := time.Date(2022, time.March, 14, 9, 30, 0, 0, time.UTC)
+	keys := []interface{}{
+		AnalyticsRecord{ResponseCode: 200, RequestTime: 10, Latency: Latency{Total: 10, Upstream: 7}},
+		AnalyticsRecord{ResponseCode: 200, RequestTime: 20, Latency: Latency{Total: 20, Upstream: 15}},
+		AnalyticsRecord{ResponseCode: 500, RequestTime: 5, Latency: Latency{Total: 5, Upstream: 1}},
+		AnalyticsRecord{ResponseCode: 404, RequestTime: 1, Latency: Latency{Total: 1}},
+		"not a record",
+	}
+
+	summary := NewBatchSummary(keys, at)
+
+	assert.True(t, summary.IsBatchSummary())
+	assert.Equal(t, at, summary.TimeStamp)
+	assert.Equal(t, 14, summary.Day)
+	assert.Equal(t, time.March, summary.Month)
+	assert.Equal(t, 2022, summary.Year)
+	assert.Equal(t, 9, summary.Hour)
+	assert.Equal(t, int64(36), summary.RequestTime)
+	assert.Equal(t, Latency{Total: 36, Upstream: 23}, summary.Latency)
+	assert.Equal(t, []string{
+		BatchSummaryTag,
+		"batch_records:4",
+		"batch_response_code_200:2",
+		"batch_response_code_404:1",
+		"batch_response_code_500:1",
+	}, summary.Tags)
+
+	value, found := summary.TagValue(BatchResponseCodeTagPrefix + "200")
+	assert.True(t, found)
+	assert.Equal(t, "2", value)
+}
+
+func TestNewBatchSummary_EmptyBatch(t *testing.T) {
+	summary := NewBatchSummary(nil, time.Now())
+
+	assert.True(t, summary.IsBatchSummary())
+	assert.Equal(t, []string{BatchSummaryTag, "batch_records:0"}, summary.Tags)
+	assert.Zero(t, summary.RequestTime)
+	assert.Zero(t, summary.Latency)
+}
+
+func TestShouldFilter_BatchSummary(t *testing.T) {
+	record := AnalyticsRecord{APIID: "apiid123", ResponseCode: 200}
+	summary := NewBatchSummary([]interface{}{record}, time.Now())
+
+	only := AnalyticsFilters{OnlyBatchSummary: true}
+	assert.True(t, only.HasFilter())
+	assert.True(t, only.ShouldFilter(record))
+	assert.False(t, only.ShouldFilter(summary))
+}
+
+func TestBatchSummary_Add(t *testing.T) {
+	at := time.Now()
+	var summary BatchSummary
+	summary.Add([]interface{}{AnalyticsRecord{ResponseCode: 200, RequestTime: 10}})
+	summary.Add([]interface{}{AnalyticsRecord{ResponseCode: 200, RequestTime: 20}, AnalyticsRecord{ResponseCode: 500, RequestTime: 5}})
+
+	assert.Equal(t, 3, summary.Records())
+	// the batches are summarised as a single one
+	assert.Equal(t, NewBatchSummary([]interface{}{
+		AnalyticsRecord{ResponseCode: 200, RequestTime: 10},
+		AnalyticsRecord{ResponseCode: 200, RequestTime: 20},
+		AnalyticsRecord{ResponseCode: 500, RequestTime: 5},
+	}, at), summary.Record(at))
+}
@@ -0,0 +1,159 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxTaggedBodySize is the size, in bytes, above which request bodies aren't parsed by
+// the BodyTagger when no limit is configured.
+const DefaultMaxTaggedBodySize = 64 << 10
+
+// BodyTagger adds the values of fields of the JSON request body of the records as tags.
+type BodyTagger struct {
+	fields      []bodyTagField
+	maxBodySize int
+}
+
+type bodyTagField struct {
+	tag  string
+	path []interface{}
+}
+
+// NewBodyTagger returns a BodyTagger adding, for each tag of fields, the `<tag>:<value>` tag
+// with the value at its path in the request body. Paths are simple JSONPath expressions made of
+// keys and array indexes, e.g. `$.tenant.id` or `$.items[0].sku`. Bodies bigger than
+// maxBodySize bytes are skipped; it defaults to DefaultMaxTaggedBodySize.
+func NewBodyTagger(fields map[string]string, maxBodySize int) (*BodyTagger, error) {
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultMaxTaggedBodySize
+	}
+
+	t := &BodyTagger{maxBodySize: maxBodySize}
+	for tag, path := range fields {
+		if tag == "" {
+			return nil, fmt.Errorf("empty tag for path %q", path)
+		}
+		segments, err := parseJSONPath(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %q of tag %q: %w", path, tag, err)
+		}
+		t.fields = append(t.fields, bodyTagField{tag: tag, path: segments})
+	}
+	sort.Slice(t.fields, func(i, j int) bool {
+		return t.fields[i].tag < t.fields[j].tag
+	})
+	return t, nil
+}
+
+// parseJSONPath splits path into its keys (strings) and array indexes (ints).
+func parseJSONPath(path string) ([]interface{}, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("it must start with $")
+	}
+
+	segments := []interface{}{}
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("empty key")
+			}
+			segments = append(segments, key)
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [")
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid index %q", rest[1:end])
+			}
+			segments = append(segments, index)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q", rest[0])
+		}
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("it doesn't select any field")
+	}
+	return segments, nil
+}
+
+// Tags returns the tags of the fields found in the JSON body. Non JSON bodies, bodies bigger
+// than the limit, and fields which are missing or aren't a string, number or boolean are
+// ignored.
+func (t *BodyTagger) Tags(body []byte) []string {
+	if len(body) == 0 || len(body) > t.maxBodySize {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil
+	}
+
+	tags := []string{}
+	for _, field := range t.fields {
+		value, ok := lookupJSONPath(document, field.path)
+		if !ok {
+			continue
+		}
+		tags = append(tags, field.tag+":"+value)
+	}
+	return tags
+}
+
+func lookupJSONPath(document interface{}, path []interface{}) (string, bool) {
+	current := document
+	for _, segment := range path {
+		switch s := segment.(type) {
+		case string:
+			object, ok := current.(map[string]interface{})
+			if !ok {
+				return "", false
+			}
+			if current, ok = object[s]; !ok {
+				return "", false
+			}
+		case int:
+			array, ok := current.([]interface{})
+			if !ok || s >= len(array) {
+				return "", false
+			}
+			current = array[s]
+		}
+	}
+
+	switch value := current.(type) {
+	case string:
+		return value, value != ""
+	case json.Number:
+		return value.String(), true
+	case bool:
+		return strconv.FormatBool(value), true
+	}
+	return "", false
+}
+
+// TagRequestBody appends the tags extracted by t from the raw request body to the record tags.
+func (a *AnalyticsRecord) TagRequestBody(raw *RawData, t *BodyTagger) {
+	if a.RawRequest == "" {
+		return
+	}
+	a.Tags = append(a.Tags, t.Tags(raw.RequestBody())...)
+}
@@ -0,0 +1,84 @@
+package analytics
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyticsRecord_TagRequestBody(t *testing.T) {
+	body := `{"tenant": {"id": "acme", "plan": {"tier": 2}}, "items": [{"sku": "A-1"}, {"sku": "B-2"}], "trial": false, "notes": null}`
+	rawRequest := "POST /orders HTTP/1.1\r\nHost: localhost:8080\r\nContent-Type: application/json\r\n\r\n" + body
+
+	tagger, err := NewBodyTagger(map[string]string{
+		"tenant_id":    "$.tenant.id",
+		"tier":         "$.tenant.plan.tier",
+		"second_sku":   "$.items[1].sku",
+		"trial":        "$.trial",
+		"notes":        "$.notes",
+		"tenant":       "$.tenant",
+		"missing":      "$.tenant.name",
+		"out_of_range": "$.items[5].sku",
+	}, 0)
+	assert.Nil(t, err)
+
+	tcs := []struct {
+		testName     string
+		record       AnalyticsRecord
+		expectedTags []string
+	}{
+		{
+			testName:     "base64 encoded raw request",
+			record:       AnalyticsRecord{RawRequest: base64.StdEncoding.EncodeToString([]byte(rawRequest)), Tags: []string{"key-abc"}},
+			expectedTags: []string{"key-abc", "second_sku:B-2", "tenant_id:acme", "tier:2", "trial:false"},
+		},
+		{
+			testName:     "plain raw request",
+			record:       AnalyticsRecord{RawRequest: rawRequest},
+			expectedTags: []string{"second_sku:B-2", "tenant_id:acme", "tier:2", "trial:false"},
+		},
+		{
+			testName:     "non JSON body",
+			record:       AnalyticsRecord{RawRequest: "POST /form HTTP/1.1\r\n\r\ntenant=acme", Tags: []string{"key-abc"}},
+			expectedTags: []string{"key-abc"},
+		},
+		{
+			testName: "no body",
+			record:   AnalyticsRecord{RawRequest: "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"},
+		},
+		{
+			testName: "empty raw request",
+			record:   AnalyticsRecord{},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			record := tc.record
+			record.TagRequestBody(NewRawData(&record), tagger)
+			assert.Equal(t, tc.expectedTags, record.Tags)
+		})
+	}
+}
+
+func TestBodyTagger_MaxBodySize(t *testing.T) {
+	tagger, err := NewBodyTagger(map[string]string{"tenant_id": "$.tenant_id"}, 32)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"tenant_id:acme"}, tagger.Tags([]byte(`{"tenant_id": "acme"}`)))
+	assert.Nil(t, tagger.Tags([]byte(`{"tenant_id": "acme", "padding": "`+strings.Repeat("x", 32)+`"}`)))
+}
+
+func TestNewBodyTagger_InvalidPath(t *testing.T) {
+	for _, path := range []string{"", "tenant.id", "$", "$.", "$.items[", "$.items[-1]", "$.items[a]", "$..id", "$tenant"} {
+		t.Run(path, func(t *testing.T) {
+			_, err := NewBodyTagger(map[string]string{"tenant_id": path}, 0)
+			assert.NotNil(t, err)
+		})
+	}
+
+	_, err := NewBodyTagger(map[string]string{"": "$.id"}, 0)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,78 @@
+package analytics
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultBotUserAgents are the user agent substrings used to detect bots when none are
+// configured.
+var DefaultBotUserAgents = []string{
+	"bot",
+	"crawler",
+	"spider",
+	"slurp",
+	"crawl",
+	"headlesschrome",
+	"facebookexternalhit",
+	"curl",
+	"wget",
+	"python-requests",
+}
+
+// BotDetector classifies user agents as bots, matching them against a list of case insensitive
+// substrings and regular expressions.
+type BotDetector struct {
+	substrings []string
+	patterns   []*regexp.Regexp
+}
+
+// NewBotDetector returns a BotDetector matching the given substrings and regular expressions.
+// If both are empty, DefaultBotUserAgents are used.
+func NewBotDetector(substrings, patterns []string) (*BotDetector, error) {
+	if len(substrings) == 0 && len(patterns) == 0 {
+		substrings = DefaultBotUserAgents
+	}
+
+	d := &BotDetector{}
+	for _, substring := range substrings {
+		if substring == "" {
+			continue
+		}
+		d.substrings = append(d.substrings, strings.ToLower(substring))
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user agent pattern %q: %w", pattern, err)
+		}
+		d.patterns = append(d.patterns, re)
+	}
+	return d, nil
+}
+
+// IsBot reports whether userAgent matches any of the substrings or patterns of the detector.
+func (d *BotDetector) IsBot(userAgent string) bool {
+	if userAgent == "" {
+		return false
+	}
+
+	lower := strings.ToLower(userAgent)
+	for _, substring := range d.substrings {
+		if strings.Contains(lower, substring) {
+			return true
+		}
+	}
+	for _, re := range d.patterns {
+		if re.MatchString(userAgent) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetIsBot sets IsBot according to the classification of the record user agent.
+func (a *AnalyticsRecord) SetIsBot(d *BotDetector) {
+	a.IsBot = d.IsBot(a.UserAgent)
+}
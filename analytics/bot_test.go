@@ -0,0 +1,99 @@
+package analytics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBotDetector_IsBot(t *testing.T) {
+	tcs := []struct {
+		testName   string
+		substrings []string
+		patterns   []string
+		userAgent  string
+		expected   bool
+	}{
+		{
+			testName:  "googlebot with default list",
+			userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			expected:  true,
+		},
+		{
+			testName:  "bingbot with default list",
+			userAgent: "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+			expected:  true,
+		},
+		{
+			testName:  "yahoo slurp with default list",
+			userAgent: "Mozilla/5.0 (compatible; Yahoo! Slurp; http://help.yahoo.com/help/us/ysearch/slurp)",
+			expected:  true,
+		},
+		{
+			testName:  "curl with default list",
+			userAgent: "curl/7.88.1",
+			expected:  true,
+		},
+		{
+			testName:  "chrome with default list",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36",
+			expected:  false,
+		},
+		{
+			testName:  "firefox with default list",
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/118.0",
+			expected:  false,
+		},
+		{
+			testName:  "safari with default list",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+			expected:  false,
+		},
+		{
+			testName:  "empty user agent",
+			userAgent: "",
+			expected:  false,
+		},
+		{
+			testName:   "custom substring",
+			substrings: []string{"Monitor"},
+			userAgent:  "uptime-monitor/1.0",
+			expected:   true,
+		},
+		{
+			testName:   "custom substrings replace the default list",
+			substrings: []string{"monitor"},
+			userAgent:  "Googlebot/2.1",
+			expected:   false,
+		},
+		{
+			testName:  "custom pattern",
+			patterns:  []string{`^Synthetic-\d+$`},
+			userAgent: "Synthetic-42",
+			expected:  true,
+		},
+		{
+			testName:  "custom pattern not matching",
+			patterns:  []string{`^Synthetic-\d+$`},
+			userAgent: "Synthetic-check",
+			expected:  false,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			detector, err := NewBotDetector(tc.substrings, tc.patterns)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, detector.IsBot(tc.userAgent))
+
+			record := AnalyticsRecord{UserAgent: tc.userAgent}
+			record.SetIsBot(detector)
+			assert.Equal(t, tc.expected, record.IsBot)
+		})
+	}
+}
+
+func TestNewBotDetector_InvalidPattern(t *testing.T) {
+	_, err := NewBotDetector(nil, []string{"("})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,69 @@
+package analytics
+
+import (
+	"net/http"
+	"strings"
+)
+
+// The cache statuses of the records.
+const (
+	CacheStatusHit    = "hit"
+	CacheStatusMiss   = "miss"
+	CacheStatusBypass = "bypass"
+)
+
+// TykCachedResponseHeader is the header set by the gateway on the responses served from its cache.
+// It's only set on the hits.
+const TykCachedResponseHeader = "X-Tyk-Cached-Response"
+
+// DefaultCacheStatusHeaders are the response headers the cache status is read from by default:
+// the one set by the gateway on the responses served from its cache, then the ones of the usual
+// caching proxies.
+var DefaultCacheStatusHeaders = []string{TykCachedResponseHeader, "X-Cache-Status", "X-Cache", "CF-Cache-Status"}
+
+// SetCacheStatus populates CacheStatus from the first of headers found in the raw response, when
+// its value can be classified as a hit, a miss or a bypass. Since the gateway only sets its header
+// on the hits, the response is a miss when none of the headers is classified and the gateway header
+// is one of them but is absent. It's left untouched otherwise.
+func (a *AnalyticsRecord) SetCacheStatus(raw *RawData, headers []string) {
+	header := raw.ResponseHeader()
+	if header == nil {
+		return
+	}
+	for _, name := range headers {
+		if value := header.Get(name); value != "" {
+			if status := ClassifyCacheStatus(value); status != "" {
+				a.CacheStatus = status
+				return
+			}
+		}
+	}
+	for _, name := range headers {
+		if http.CanonicalHeaderKey(name) == TykCachedResponseHeader && header.Get(name) == "" {
+			a.CacheStatus = CacheStatusMiss
+			return
+		}
+	}
+}
+
+// ClassifyCacheStatus returns the cache status of a cache header value, e.g. `hit` for `HIT`,
+// `TCP_HIT` or `Hit from cloudfront`, or "" if it's unknown. When the header lists the statuses of
+// several caches, e.g. `MISS, HIT`, the last one, closest to the client, is used. The gateway sets
+// its header to `1`.
+func ClassifyCacheStatus(value string) string {
+	values := strings.Split(value, ",")
+	value = strings.ToUpper(strings.TrimSpace(values[len(values)-1]))
+	switch {
+	case value == "1" || value == "TRUE":
+		return CacheStatusHit
+	// the stale and revalidated responses are served from the cache too
+	case strings.Contains(value, "HIT"), value == "STALE", value == "UPDATING", value == "REVALIDATED":
+		return CacheStatusHit
+	case strings.Contains(value, "MISS"), value == "EXPIRED":
+		return CacheStatusMiss
+	case strings.Contains(value, "PASS"), value == "DYNAMIC", value == "NONE", value == "UNCACHEABLE":
+		return CacheStatusBypass
+	default:
+		return ""
+	}
+}
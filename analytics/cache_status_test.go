@@ -0,0 +1,111 @@
+package analytics
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyCacheStatus(t *testing.T) {
+	for value, expected := range map[string]string{
+		"1":                    CacheStatusHit,
+		"HIT":                  CacheStatusHit,
+		"hit":                  CacheStatusHit,
+		"TCP_HIT":              CacheStatusHit,
+		"Hit from cloudfront":  CacheStatusHit,
+		"STALE":                CacheStatusHit,
+		"REVALIDATED":          CacheStatusHit,
+		"MISS, HIT":            CacheStatusHit,
+		"MISS":                 CacheStatusMiss,
+		"Miss from cloudfront": CacheStatusMiss,
+		"EXPIRED":              CacheStatusMiss,
+		"HIT, MISS":            CacheStatusMiss,
+		"BYPASS":               CacheStatusBypass,
+		"PASS":                 CacheStatusBypass,
+		"DYNAMIC":              CacheStatusBypass,
+		"":                     "",
+		"unknown":              "",
+	} {
+		assert.Equal(t, expected, ClassifyCacheStatus(value), value)
+	}
+}
+
+func TestAnalyticsRecord_SetCacheStatus(t *testing.T) {
+	response := func(headers string) string {
+		return base64.StdEncoding.EncodeToString([]byte("HTTP/1.1 200 OK\r\n" + headers + "Content-Length: 0\r\n\r\n"))
+	}
+
+	tcs := []struct {
+		testName       string
+		rawResponse    string
+		headers        []string
+		expectedStatus string
+	}{
+		{
+			testName:       "gateway cache",
+			rawResponse:    response("X-Tyk-Cached-Response: 1\r\n"),
+			expectedStatus: CacheStatusHit,
+		},
+		{
+			testName:       "nginx miss",
+			rawResponse:    response("X-Cache-Status: MISS\r\n"),
+			expectedStatus: CacheStatusMiss,
+		},
+		{
+			testName:       "cloudflare bypass",
+			rawResponse:    response("CF-Cache-Status: BYPASS\r\n"),
+			expectedStatus: CacheStatusBypass,
+		},
+		{
+			testName:       "first known header",
+			rawResponse:    response("X-Cache: Hit from cloudfront\r\nX-Cache-Status: unknown\r\n"),
+			expectedStatus: CacheStatusHit,
+		},
+		{
+			testName:       "plain raw response",
+			rawResponse:    "HTTP/1.1 200 OK\r\nX-Cache: MISS\r\n\r\n",
+			expectedStatus: CacheStatusMiss,
+		},
+		{
+			testName:       "no cache header",
+			rawResponse:    response(""),
+			expectedStatus: CacheStatusMiss,
+		},
+		{
+			testName:       "unknown proxy header",
+			rawResponse:    response("X-Cache-Status: unknown\r\n"),
+			expectedStatus: CacheStatusMiss,
+		},
+		{
+			testName:    "no cache header without the gateway header",
+			rawResponse: response(""),
+			headers:     []string{"X-Cache-Status", "X-Cache"},
+		},
+		{
+			testName:       "lowercase gateway header",
+			rawResponse:    response(""),
+			headers:        []string{"x-tyk-cached-response"},
+			expectedStatus: CacheStatusMiss,
+		},
+		{
+			testName: "no raw response",
+		},
+		{
+			testName:    "malformed raw response",
+			rawResponse: "not a response",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			record := AnalyticsRecord{RawResponse: tc.rawResponse}
+			headers := tc.headers
+			if headers == nil {
+				headers = DefaultCacheStatusHeaders
+			}
+			record.SetCacheStatus(NewRawData(&record), headers)
+			assert.Equal(t, tc.expectedStatus, record.CacheStatus)
+		})
+	}
+}
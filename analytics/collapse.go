@@ -0,0 +1,60 @@
+package analytics
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fingerprint identifies the request of the record and its response code, regardless of when it
+// was made and how long it took. Identical requests have the same fingerprint.
+func (a *AnalyticsRecord) Fingerprint() string {
+	return strings.Join([]string{
+		a.Method,
+		a.Host,
+		a.Path,
+		a.RawPath,
+		strconv.FormatInt(a.ContentLength, 10),
+		a.UserAgent,
+		strconv.Itoa(a.ResponseCode),
+		a.APIKey,
+		a.APIVersion,
+		a.APIID,
+		a.OrgID,
+		a.OauthID,
+		a.IPAddress,
+		a.Alias,
+	}, "\x00")
+}
+
+// CollapseRecords collapses each run of consecutive records with the same fingerprint, made within
+// window of the first record of the run, into that first record. Its OccurrenceCount is set to the
+// number of records of the run, 1 for the records that aren't collapsed.
+func CollapseRecords(records []interface{}, window time.Duration) []interface{} {
+	collapsed := make([]interface{}, 0, len(records))
+
+	var first AnalyticsRecord
+	var fingerprint string
+	for i, key := range records {
+		record := key.(AnalyticsRecord)
+		recordFingerprint := record.Fingerprint()
+		elapsed := record.TimeStamp.Sub(first.TimeStamp)
+		if elapsed < 0 {
+			elapsed = -elapsed
+		}
+		if i > 0 && recordFingerprint == fingerprint && elapsed <= window {
+			first.OccurrenceCount++
+			continue
+		}
+
+		if i > 0 {
+			collapsed = append(collapsed, first)
+		}
+		first, fingerprint = record, recordFingerprint
+		first.OccurrenceCount = 1
+	}
+	if len(records) > 0 {
+		collapsed = append(collapsed, first)
+	}
+	return collapsed
+}
@@ -0,0 +1,72 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollapseRecords(t *testing.T) {
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	get := AnalyticsRecord{Method: "GET", Path: "/get", APIID: "api1", ResponseCode: 200, IPAddress: "10.0.0.1"}
+	post := AnalyticsRecord{Method: "POST", Path: "/post", APIID: "api1", ResponseCode: 201, IPAddress: "10.0.0.1"}
+	at := func(record AnalyticsRecord, offset time.Duration, requestTime int64) AnalyticsRecord {
+		record.TimeStamp = now.Add(offset)
+		record.RequestTime = requestTime
+		return record
+	}
+	withCount := func(record AnalyticsRecord, count int) AnalyticsRecord {
+		record.OccurrenceCount = count
+		return record
+	}
+
+	tcs := []struct {
+		testName string
+		records  []interface{}
+		expected []interface{}
+	}{
+		{
+			testName: "a run of identical records",
+			records:  []interface{}{at(get, 0, 10), at(get, time.Second, 12), at(get, 2*time.Second, 11)},
+			expected: []interface{}{withCount(at(get, 0, 10), 3)},
+		},
+		{
+			testName: "only consecutive records",
+			records:  []interface{}{at(get, 0, 10), at(get, 0, 10), at(post, 0, 10), at(get, 0, 10)},
+			expected: []interface{}{withCount(at(get, 0, 10), 2), withCount(at(post, 0, 10), 1), withCount(at(get, 0, 10), 1)},
+		},
+		{
+			testName: "outside the window",
+			records:  []interface{}{at(get, 0, 10), at(get, 4*time.Second, 10), at(get, 6*time.Second, 10)},
+			expected: []interface{}{withCount(at(get, 0, 10), 2), withCount(at(get, 6*time.Second, 10), 1)},
+		},
+		{
+			testName: "different response codes",
+			records:  []interface{}{at(get, 0, 10), at(AnalyticsRecord{Method: "GET", Path: "/get", APIID: "api1", ResponseCode: 500, IPAddress: "10.0.0.1"}, 0, 10)},
+			expected: []interface{}{withCount(at(get, 0, 10), 1), withCount(at(AnalyticsRecord{Method: "GET", Path: "/get", APIID: "api1", ResponseCode: 500, IPAddress: "10.0.0.1"}, 0, 10), 1)},
+		},
+		{
+			testName: "no records",
+			records:  []interface{}{},
+			expected: []interface{}{},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expected, CollapseRecords(tc.records, 5*time.Second))
+		})
+	}
+}
+
+func TestAnalyticsRecord_Fingerprint(t *testing.T) {
+	record := AnalyticsRecord{Method: "GET", Path: "/get", APIKey: "key1", TimeStamp: time.Now(), RequestTime: 10}
+	other := record
+	other.TimeStamp = record.TimeStamp.Add(time.Second)
+	other.RequestTime = 20
+	assert.Equal(t, record.Fingerprint(), other.Fingerprint())
+
+	other.APIKey = "key2"
+	assert.NotEqual(t, record.Fingerprint(), other.Fingerprint())
+}
@@ -0,0 +1,23 @@
+package analytics
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SetCorrelationID populates CorrelationID from the first of headers found in the raw request, or
+// in the raw response when the request has none of them. It's left untouched when none of them
+// can be found.
+func (a *AnalyticsRecord) SetCorrelationID(raw *RawData, headers []string) {
+	for _, header := range []http.Header{raw.RequestHeader(), raw.ResponseHeader()} {
+		if header == nil {
+			continue
+		}
+		for _, name := range headers {
+			if value := strings.TrimSpace(header.Get(name)); value != "" {
+				a.CorrelationID = value
+				return
+			}
+		}
+	}
+}
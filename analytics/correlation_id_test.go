@@ -0,0 +1,70 @@
+package analytics
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyticsRecord_SetCorrelationID(t *testing.T) {
+	rawRequest := "GET /get HTTP/1.1\r\nHost: localhost:8080\r\nX-Correlation-ID: req-123\r\n\r\n"
+	rawRequestWithoutID := "GET /get HTTP/1.1\r\nHost: localhost:8080\r\n\r\n"
+	rawResponse := "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nX-Request-ID: resp-456\r\n\r\n{}"
+	headers := []string{"X-Correlation-ID", "X-Request-ID"}
+
+	tcs := []struct {
+		testName string
+		headers  []string
+		record   AnalyticsRecord
+		expected string
+	}{
+		{
+			testName: "request header",
+			headers:  headers,
+			record: AnalyticsRecord{
+				RawRequest:  base64.StdEncoding.EncodeToString([]byte(rawRequest)),
+				RawResponse: base64.StdEncoding.EncodeToString([]byte(rawResponse)),
+			},
+			expected: "req-123",
+		},
+		{
+			testName: "response header fallback",
+			headers:  headers,
+			record: AnalyticsRecord{
+				RawRequest:  base64.StdEncoding.EncodeToString([]byte(rawRequestWithoutID)),
+				RawResponse: base64.StdEncoding.EncodeToString([]byte(rawResponse)),
+			},
+			expected: "resp-456",
+		},
+		{
+			testName: "plain raw data",
+			headers:  []string{"x-request-id"},
+			record:   AnalyticsRecord{RawRequest: rawRequest, RawResponse: rawResponse},
+			expected: "resp-456",
+		},
+		{
+			testName: "headers in order",
+			headers:  []string{"X-Request-ID", "X-Correlation-ID"},
+			record:   AnalyticsRecord{RawRequest: rawRequest},
+			expected: "req-123",
+		},
+		{
+			testName: "not found",
+			headers:  []string{"X-Trace-ID"},
+			record:   AnalyticsRecord{RawRequest: rawRequest, RawResponse: rawResponse},
+		},
+		{
+			testName: "no raw data",
+			headers:  headers,
+			record:   AnalyticsRecord{},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			tc.record.SetCorrelationID(NewRawData(&tc.record), tc.headers)
+			assert.Equal(t, tc.expected, tc.record.CorrelationID)
+		})
+	}
+}
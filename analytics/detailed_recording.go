@@ -0,0 +1,56 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// DetailedRecordingSampler keeps the raw request and response of a share of the records of each
+// org, so every org can tune its body capture independently.
+type DetailedRecordingSampler struct {
+	rates map[string]float64
+
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+// NewDetailedRecordingSampler returns a DetailedRecordingSampler keeping the raw data of the share
+// of the records of each org of rates, from 0 (none) to 1 (all). The records of the other orgs
+// keep their raw data.
+func NewDetailedRecordingSampler(rates map[string]float64) (*DetailedRecordingSampler, error) {
+	for orgID, rate := range rates {
+		if rate < 0 || rate > 1 || math.IsNaN(rate) {
+			return nil, fmt.Errorf("invalid detailed recording rate %v of org %q, it must be between 0 and 1", rate, orgID)
+		}
+	}
+	return &DetailedRecordingSampler{rates: rates, counts: make(map[string]uint64)}, nil
+}
+
+// Keep returns whether the next record of the org keeps its raw data. The records are kept evenly,
+// e.g. one of every 10 with a rate of 0.1, rather than randomly.
+func (s *DetailedRecordingSampler) Keep(orgID string) bool {
+	rate, ok := s.rates[orgID]
+	if !ok || rate == 1 {
+		return true
+	}
+	if rate == 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	count := s.counts[orgID]
+	s.counts[orgID] = count + 1
+	s.mu.Unlock()
+	// kept each time the kept share reaches the next whole record
+	return math.Floor(float64(count+1)*rate) > math.Floor(float64(count)*rate)
+}
+
+// SampleDetailedRecording removes the raw request and response of the record unless s keeps the
+// raw data of the next record of its org.
+func (a *AnalyticsRecord) SampleDetailedRecording(s *DetailedRecordingSampler) {
+	if !s.Keep(a.OrgID) {
+		a.RawRequest = ""
+		a.RawResponse = ""
+	}
+}
@@ -0,0 +1,52 @@
+package analytics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyticsRecord_SampleDetailedRecording(t *testing.T) {
+	sampler, err := NewDetailedRecordingSampler(map[string]float64{
+		"sampled": 0.25,
+		"none":    0,
+		"all":     1,
+	})
+	assert.Nil(t, err)
+
+	kept := map[string]int{}
+	for _, orgID := range []string{"sampled", "none", "all", "unlisted"} {
+		for i := 0; i < 100; i++ {
+			record := AnalyticsRecord{OrgID: orgID, RawRequest: "cmVxdWVzdA==", RawResponse: "cmVzcG9uc2U="}
+			record.SampleDetailedRecording(sampler)
+			if record.RawRequest != "" {
+				assert.Equal(t, "cmVzcG9uc2U=", record.RawResponse)
+				kept[orgID]++
+			} else {
+				assert.Empty(t, record.RawResponse)
+			}
+		}
+	}
+
+	assert.Equal(t, map[string]int{"sampled": 25, "all": 100, "unlisted": 100}, kept)
+}
+
+func TestDetailedRecordingSampler_Keep(t *testing.T) {
+	sampler, err := NewDetailedRecordingSampler(map[string]float64{"org1": 0.5})
+	assert.Nil(t, err)
+
+	// evenly kept
+	var kept []bool
+	for i := 0; i < 4; i++ {
+		kept = append(kept, sampler.Keep("org1"))
+	}
+	assert.Equal(t, []bool{false, true, false, true}, kept)
+}
+
+func TestNewDetailedRecordingSampler_Invalid(t *testing.T) {
+	_, err := NewDetailedRecordingSampler(map[string]float64{"org1": 1.5})
+	assert.EqualError(t, err, `invalid detailed recording rate 1.5 of org "org1", it must be between 0 and 1`)
+
+	_, err = NewDetailedRecordingSampler(map[string]float64{"org1": -0.1})
+	assert.NotNil(t, err)
+}
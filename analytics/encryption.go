@@ -0,0 +1,142 @@
+package analytics
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// rawDataEncryptionPrefix prefixes the encrypted raw data, which has the format
+// `enc:v1:<key id>:<base64 nonce + ciphertext>`.
+const rawDataEncryptionPrefix = "enc:v1:"
+
+// ErrRawDataNotEncrypted is returned when decrypting a value that isn't encrypted.
+var ErrRawDataNotEncrypted = errors.New("raw data is not encrypted")
+
+// RawDataEncryptor encrypts the raw request and response of the records with AES-GCM.
+type RawDataEncryptor struct {
+	keyID string
+	aead  cipher.AEAD
+}
+
+// NewRawDataEncryptor returns a RawDataEncryptor using key, which must be 16, 24 or 32 bytes
+// long to select AES-128, AES-192 or AES-256. keyID is stored alongside the encrypted data so
+// readers can pick the right key after a rotation.
+func NewRawDataEncryptor(keyID string, key []byte) (*RawDataEncryptor, error) {
+	if strings.Contains(keyID, ":") {
+		return nil, fmt.Errorf("invalid key id %q: it can't contain ':'", keyID)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &RawDataEncryptor{keyID: keyID, aead: aead}, nil
+}
+
+// Encrypt returns the encrypted value of plaintext.
+func (e *RawDataEncryptor) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	// the key id is authenticated, so it can't be swapped
+	sealed := e.aead.Seal(nonce, nonce, []byte(plaintext), []byte(e.keyID))
+	return rawDataEncryptionPrefix + e.keyID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// EncryptRawData encrypts the non empty RawRequest and RawResponse of the record.
+func (a *AnalyticsRecord) EncryptRawData(e *RawDataEncryptor) error {
+	for _, raw := range []*string{&a.RawRequest, &a.RawResponse} {
+		if *raw == "" || IsRawDataEncrypted(*raw) {
+			continue
+		}
+		encrypted, err := e.Encrypt(*raw)
+		if err != nil {
+			return err
+		}
+		*raw = encrypted
+	}
+	return nil
+}
+
+// DecryptRawData decrypts the RawRequest and RawResponse of the record, using the key that
+// matches their key id from keys. Values that aren't encrypted are left untouched.
+func (a *AnalyticsRecord) DecryptRawData(keys map[string][]byte) error {
+	for _, raw := range []*string{&a.RawRequest, &a.RawResponse} {
+		decrypted, err := DecryptRawData(*raw, keys)
+		if errors.Is(err, ErrRawDataNotEncrypted) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		*raw = decrypted
+	}
+	return nil
+}
+
+// IsRawDataEncrypted reports whether value was encrypted by a RawDataEncryptor.
+func IsRawDataEncrypted(value string) bool {
+	return strings.HasPrefix(value, rawDataEncryptionPrefix)
+}
+
+// RawDataKeyID returns the id of the key used to encrypt value.
+func RawDataKeyID(value string) (string, error) {
+	keyID, _, err := splitEncryptedRawData(value)
+	return keyID, err
+}
+
+// DecryptRawData returns the plaintext of an encrypted value, using the key that matches its
+// key id from keys.
+func DecryptRawData(value string, keys map[string][]byte) (string, error) {
+	keyID, payload, err := splitEncryptedRawData(value)
+	if err != nil {
+		return "", err
+	}
+	key, ok := keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("no key found for key id %q", keyID)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted raw data: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("invalid encrypted raw data: too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func splitEncryptedRawData(value string) (keyID, payload string, err error) {
+	if !IsRawDataEncrypted(value) {
+		return "", "", ErrRawDataNotEncrypted
+	}
+	keyID, payload, found := strings.Cut(strings.TrimPrefix(value, rawDataEncryptionPrefix), ":")
+	if !found {
+		return "", "", errors.New("invalid encrypted raw data: missing key id")
+	}
+	return keyID, payload, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
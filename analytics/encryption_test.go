@@ -0,0 +1,80 @@
+package analytics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyticsRecord_EncryptRawData(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	encryptor, err := NewRawDataEncryptor("key1", key)
+	assert.Nil(t, err)
+
+	record := AnalyticsRecord{
+		RawRequest:  "GET /path HTTP/1.1\r\nHost: example.com\r\n\r\n",
+		RawResponse: "HTTP/1.1 200 OK\r\n\r\n{\"secret\":true}",
+	}
+	original := record
+
+	err = record.EncryptRawData(encryptor)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(record.RawRequest, "enc:v1:key1:"))
+	assert.True(t, strings.HasPrefix(record.RawResponse, "enc:v1:key1:"))
+	assert.NotContains(t, record.RawResponse, "secret")
+
+	keyID, err := RawDataKeyID(record.RawRequest)
+	assert.Nil(t, err)
+	assert.Equal(t, "key1", keyID)
+
+	t.Run("encrypting twice is a noop", func(t *testing.T) {
+		encrypted := record
+		assert.Nil(t, encrypted.EncryptRawData(encryptor))
+		assert.Equal(t, record, encrypted)
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		decrypted := record
+		err := decrypted.DecryptRawData(map[string][]byte{"old": []byte("fedcba9876543210"), "key1": key})
+		assert.Nil(t, err)
+		assert.Equal(t, original, decrypted)
+	})
+
+	t.Run("unknown key id", func(t *testing.T) {
+		decrypted := record
+		assert.NotNil(t, decrypted.DecryptRawData(map[string][]byte{"old": key}))
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		_, err := DecryptRawData(record.RawRequest, map[string][]byte{"key1": []byte("fedcba9876543210")})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("tampered key id", func(t *testing.T) {
+		tampered := strings.Replace(record.RawRequest, "enc:v1:key1:", "enc:v1:key2:", 1)
+		_, err := DecryptRawData(tampered, map[string][]byte{"key2": key})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestAnalyticsRecord_EncryptRawDataEmpty(t *testing.T) {
+	encryptor, err := NewRawDataEncryptor("key1", []byte("0123456789abcdef"))
+	assert.Nil(t, err)
+
+	record := AnalyticsRecord{}
+	assert.Nil(t, record.EncryptRawData(encryptor))
+	assert.Equal(t, "", record.RawRequest)
+
+	_, err = DecryptRawData("not encrypted", map[string][]byte{})
+	assert.ErrorIs(t, err, ErrRawDataNotEncrypted)
+	assert.Nil(t, record.DecryptRawData(map[string][]byte{}))
+}
+
+func TestNewRawDataEncryptor(t *testing.T) {
+	_, err := NewRawDataEncryptor("key1", []byte("too short"))
+	assert.NotNil(t, err)
+
+	_, err = NewRawDataEncryptor("key:1", []byte("0123456789abcdef"))
+	assert.NotNil(t, err)
+}
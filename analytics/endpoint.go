@@ -0,0 +1,26 @@
+package analytics
+
+import "strings"
+
+// DefaultEndpointTagPrefix is the prefix of the tag holding the matched endpoint.
+const DefaultEndpointTagPrefix = "endpoint:"
+
+// SetEndpoint populates Endpoint with the matched route of the record, read from its first tag
+// starting with tagPrefix, e.g. `endpoint:/users/{id}`. Without such a tag, the path of the
+// records tracked by the gateway (TrackPath), which is the listen path of their endpoint, is used
+// instead. It's left untouched otherwise.
+func (a *AnalyticsRecord) SetEndpoint(tagPrefix string) {
+	for _, tag := range a.Tags {
+		if !strings.HasPrefix(tag, tagPrefix) {
+			continue
+		}
+		if endpoint := strings.TrimSpace(strings.TrimPrefix(tag, tagPrefix)); endpoint != "" {
+			a.Endpoint = endpoint
+			return
+		}
+	}
+
+	if a.TrackPath && a.Path != "" {
+		a.Endpoint = a.Path
+	}
+}
@@ -0,0 +1,66 @@
+package analytics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyticsRecord_SetEndpoint(t *testing.T) {
+	tcs := []struct {
+		testName  string
+		record    AnalyticsRecord
+		tagPrefix string
+		expected  string
+	}{
+		{
+			testName:  "endpoint tag",
+			record:    AnalyticsRecord{Path: "/users/42", Tags: []string{"key-1", "endpoint:/users/{id}"}},
+			tagPrefix: DefaultEndpointTagPrefix,
+			expected:  "/users/{id}",
+		},
+		{
+			testName:  "first endpoint tag",
+			record:    AnalyticsRecord{Tags: []string{"endpoint:/users/{id}", "endpoint:/users"}},
+			tagPrefix: DefaultEndpointTagPrefix,
+			expected:  "/users/{id}",
+		},
+		{
+			testName:  "empty endpoint tag",
+			record:    AnalyticsRecord{Tags: []string{"endpoint:", "endpoint: /users "}},
+			tagPrefix: DefaultEndpointTagPrefix,
+			expected:  "/users",
+		},
+		{
+			testName:  "custom prefix",
+			record:    AnalyticsRecord{Tags: []string{"endpoint:/users", "route-/users/{id}"}},
+			tagPrefix: "route-",
+			expected:  "/users/{id}",
+		},
+		{
+			testName:  "tag over tracked path",
+			record:    AnalyticsRecord{Path: "/users/42", TrackPath: true, Tags: []string{"endpoint:/users/{id}"}},
+			tagPrefix: DefaultEndpointTagPrefix,
+			expected:  "/users/{id}",
+		},
+		{
+			testName:  "tracked path",
+			record:    AnalyticsRecord{Path: "/users/{id}", TrackPath: true},
+			tagPrefix: DefaultEndpointTagPrefix,
+			expected:  "/users/{id}",
+		},
+		{
+			testName:  "untracked path",
+			record:    AnalyticsRecord{Path: "/users/42", Tags: []string{"key-1"}},
+			tagPrefix: DefaultEndpointTagPrefix,
+			expected:  "",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			tc.record.SetEndpoint(tc.tagPrefix)
+			assert.Equal(t, tc.expected, tc.record.Endpoint)
+		})
+	}
+}
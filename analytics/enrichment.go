@@ -0,0 +1,96 @@
+package analytics
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnrichmentColumn is the column of the enrichment fields of the records, for the pumps storing
+// them in a single JSON column.
+const EnrichmentColumn = "enrichment"
+
+// LatencyFieldNames are the flat latency fields of the records, for the pumps storing them in
+// their own columns, and LatencyColumns their SQL columns.
+var (
+	LatencyFieldNames = []string{"LatencyTotal", "LatencyUpstream", "LatencyGateway"}
+	LatencyColumns    = []string{"latencytotal", "latencyupstream", "latencygateway"}
+)
+
+// Enrichment holds the fields the pump derives from the records, e.g. from their latency or their
+// raw data, rather than the gateway. It's embedded in AnalyticsRecord, so its fields are read and
+// set as the record fields and inlined in the JSON, BSON and msgpack documents, but they aren't
+// columns of the SQL tables or the CSV files, so the existing tables and files keep their columns.
+// The fields are ignored by gorm one by one, as it embeds the struct fields even when they're
+// ignored.
+type Enrichment struct {
+	LatencyTotal    int64 `json:"latency_total" gorm:"-:all"`
+	LatencyUpstream int64 `json:"latency_upstream" gorm:"-:all"`
+	LatencyGateway  int64 `json:"latency_gateway" gorm:"-:all"`
+
+	IsBot bool `json:"is_bot" gorm:"-:all"`
+
+	RecordSizeBytes int64 `json:"record_size_bytes" gorm:"-:all"`
+
+	ResponseContentLength int64 `json:"response_content_length" gorm:"-:all"`
+
+	TLSVersion string `json:"tls_version" gorm:"-:all"`
+	TLSCipher  string `json:"tls_cipher" gorm:"-:all"`
+
+	Scheme string `json:"scheme" gorm:"-:all"`
+	Port   int    `json:"port" gorm:"-:all"`
+
+	IsGRPC     bool `json:"is_grpc" gorm:"-:all"`
+	GRPCStatus int  `json:"grpc_status" gorm:"-:all"`
+
+	OccurrenceCount int    `json:"occurrence_count" gorm:"-:all"`
+	ProcessedBy     string `json:"processed_by" gorm:"-:all"`
+	CorrelationID   string `json:"correlation_id" gorm:"-:all"`
+	JWTSubject      string `json:"jwt_subject" gorm:"-:all"`
+	Endpoint        string `json:"endpoint" gorm:"-:all"`
+
+	Browser    string `json:"browser" gorm:"-:all"`
+	OS         string `json:"os" gorm:"-:all"`
+	DeviceType string `json:"device_type" gorm:"-:all"`
+
+	ContainsPII   bool     `json:"contains_pii" gorm:"-:all"`
+	PIICategories []string `json:"pii_categories" gorm:"-:all"`
+
+	LatencyDNS          int64  `json:"latency_dns" gorm:"-:all"`
+	LatencyConnect      int64  `json:"latency_connect" gorm:"-:all"`
+	LatencyTLS          int64  `json:"latency_tls" gorm:"-:all"`
+	ResponseContentType string `json:"response_content_type" gorm:"-:all"`
+	NodeID              string `json:"node_id" gorm:"-:all"`
+
+	TagMap      map[string]string `json:"tag_map" gorm:"-:all"`
+	CacheStatus string            `json:"cache_status" gorm:"-:all"`
+}
+
+// LatencyLineValues returns the flat latency fields of e, in the order of LatencyFieldNames.
+func (e *Enrichment) LatencyLineValues() []string {
+	return []string{
+		strconv.FormatInt(e.LatencyTotal, 10),
+		strconv.FormatInt(e.LatencyUpstream, 10),
+		strconv.FormatInt(e.LatencyGateway, 10),
+	}
+}
+
+// JSONValue returns the JSON document of the fields of e which are set, `{}` if none is.
+func (e *Enrichment) JSONValue() string {
+	document := map[string]interface{}{}
+	v := reflect.ValueOf(e).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.IsZero() || ((field.Kind() == reflect.Slice || field.Kind() == reflect.Map) && field.Len() == 0) {
+			continue
+		}
+		document[strings.Split(t.Field(i).Tag.Get("json"), ",")[0]] = field.Interface()
+	}
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return "{}"
+	}
+	return string(encoded)
+}
@@ -0,0 +1,43 @@
+package analytics
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/fatih/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnrichment_JSONValue(t *testing.T) {
+	assert.Equal(t, "{}", (&Enrichment{}).JSONValue())
+
+	e := Enrichment{LatencyTotal: 120, IsBot: true}
+	assert.Equal(t, `{"is_bot":true,"latency_total":120}`, e.JSONValue())
+}
+
+func TestAnalyticsRecord_EnrichmentFields(t *testing.T) {
+	record := AnalyticsRecord{APIID: "api1", Enrichment: Enrichment{LatencyTotal: 120, LatencyGateway: 20}}
+
+	// the enrichment fields aren't columns of the CSV files
+	assert.NotContains(t, record.GetFieldNames(), "LatencyTotal")
+	assert.Len(t, record.GetLineValues(), len(record.GetFieldNames()))
+
+	// they're inlined in the JSON documents and the maps of the record
+	document := map[string]interface{}{}
+	encoded, err := json.Marshal(record)
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(encoded, &document))
+	assert.Equal(t, float64(120), document["latency_total"])
+	assert.NotContains(t, document, "Enrichment")
+
+	assert.Equal(t, int64(120), structs.Map(record)["LatencyTotal"])
+
+	// and they're ignored by their JSON name
+	record.RemoveIgnoredFields([]string{"latency_total"})
+	assert.Equal(t, int64(0), record.LatencyTotal)
+	assert.Equal(t, int64(20), record.LatencyGateway)
+
+	kept := AnalyticsRecord{APIID: "api1", Enrichment: Enrichment{LatencyTotal: 120, IsBot: true}}
+	kept.KeepFields([]string{"api_id", "is_bot"})
+	assert.Equal(t, AnalyticsRecord{APIID: "api1", Enrichment: Enrichment{IsBot: true}}, kept)
+}
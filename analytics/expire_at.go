@@ -0,0 +1,26 @@
+package analytics
+
+import "time"
+
+// ExpireAtMillis returns the expiry as epoch milliseconds, the precision the serializers keep it
+// with. The zero time, no expiry, is 0.
+func ExpireAtMillis(expireAt time.Time) int64 {
+	if expireAt.IsZero() {
+		return 0
+	}
+	return expireAt.UnixMilli()
+}
+
+// ExpireAtFromMillis returns the UTC expiry of epoch milliseconds. 0 is the zero time, no expiry.
+func ExpireAtFromMillis(millis int64) time.Time {
+	if millis == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(millis).UTC()
+}
+
+// NormalizeExpireAt sets ExpireAt as it round-trips through the serializers: in UTC, with
+// millisecond precision, and the zero time for no expiry.
+func (a *AnalyticsRecord) NormalizeExpireAt() {
+	a.ExpireAt = ExpireAtFromMillis(ExpireAtMillis(a.ExpireAt))
+}
@@ -1,6 +1,18 @@
 package analytics
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"unicode/utf8"
+
 	"github.com/TykTechnologies/storage/persistent/model"
 )
 
@@ -11,6 +23,23 @@ import (
 // value passed to db.Table()
 var GraphSQLTableName string
 
+// RedactedGraphVariable replaces the values of the redacted GraphQL variables.
+const RedactedGraphVariable = "[REDACTED]"
+
+// GraphVariablesLimits caps the size of the GraphQL variables stored by ToGraphRecord, and
+// redacts the sensitive ones.
+type GraphVariablesLimits struct {
+	// MaxSize is the size, in bytes, the decoded variables are truncated to. 0 means no limit.
+	MaxSize int
+	// RedactedNames are the names of the variables, or of the fields of their input objects, whose
+	// values are replaced with RedactedGraphVariable. They're case insensitive.
+	RedactedNames []string
+}
+
+// StoredGraphVariables are the limits applied to the variables by ToGraphRecord. The zero value
+// stores the variables as they are.
+var StoredGraphVariables GraphVariablesLimits
+
 type GraphRecord struct {
 	Types map[string][]string `gorm:"types"`
 
@@ -21,6 +50,9 @@ type GraphRecord struct {
 	RootFields    []string     `gorm:"root_fields"`
 	Errors        []GraphError `gorm:"errors"`
 	HasErrors     bool         `gorm:"has_errors"`
+	// ResponseObjectCounts holds the number of objects returned by the list fields of the
+	// response data, keyed by their dot separated path. E.g. `characters.results`.
+	ResponseObjectCounts map[string]int `gorm:"response_object_counts"`
 }
 
 // TableName is used by both the sql orm and mongo driver the table name and collection name used for operations on this model
@@ -60,13 +92,188 @@ func (a *AnalyticsRecord) ToGraphRecord() GraphRecord {
 		AnalyticsRecord: *a,
 		RootFields:      a.GraphQLStats.RootFields,
 		Types:           a.GraphQLStats.Types,
-		Errors:          a.GraphQLStats.Errors,
+		Errors:          normalizeGraphErrors(a.GraphQLStats.Errors),
 		HasErrors:       a.GraphQLStats.HasErrors,
-		Variables:       a.GraphQLStats.Variables,
+		Variables:       StoredGraphVariables.Apply(a.GraphQLStats.Variables),
 		OperationType:   opType,
+
+		ResponseObjectCounts: graphResponseObjectCounts(a.RawResponse),
 	}
 	if a.ResponseCode >= 400 {
 		record.HasErrors = true
 	}
 	return record
 }
+
+// Apply returns the variables redacted and truncated. The variables may be base64 encoded (as
+// the gateway stores them) or plain JSON, and are returned in the same form. Variables which
+// aren't valid JSON can't be redacted, but are still truncated.
+func (l GraphVariablesLimits) Apply(variables string) string {
+	if variables == "" || (l.MaxSize <= 0 && len(l.RedactedNames) == 0) {
+		return variables
+	}
+
+	raw := variables
+	encoded := false
+	if decoded, err := base64.StdEncoding.DecodeString(variables); err == nil && json.Valid(decoded) {
+		raw = string(decoded)
+		encoded = true
+	}
+
+	if len(l.RedactedNames) > 0 {
+		raw = redactGraphVariables(raw, l.RedactedNames)
+	}
+	if l.MaxSize > 0 && len(raw) > l.MaxSize {
+		end := l.MaxSize
+		// don't split a multi-byte character
+		for end > 0 && !utf8.RuneStart(raw[end]) {
+			end--
+		}
+		raw = raw[:end]
+	}
+
+	if encoded {
+		return base64.StdEncoding.EncodeToString([]byte(raw))
+	}
+	return raw
+}
+
+func redactGraphVariables(raw string, names []string) string {
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.UseNumber()
+	var variables interface{}
+	if err := decoder.Decode(&variables); err != nil {
+		return raw
+	}
+
+	redacted := make(map[string]bool, len(names))
+	for _, name := range names {
+		redacted[strings.ToLower(name)] = true
+	}
+	redactGraphValue(variables, redacted)
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(variables); err != nil {
+		return raw
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func redactGraphValue(value interface{}, redacted map[string]bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if redacted[strings.ToLower(key)] {
+				v[key] = RedactedGraphVariable
+				continue
+			}
+			redactGraphValue(field, redacted)
+		}
+	case []interface{}:
+		for _, item := range v {
+			redactGraphValue(item, redacted)
+		}
+	}
+}
+
+// normalizeGraphErrors returns a copy of the errors where the whole number path segments, decoded
+// from JSON as float64, are converted to int. String segments are kept as they are.
+func normalizeGraphErrors(graphErrors []GraphError) []GraphError {
+	if graphErrors == nil {
+		return nil
+	}
+
+	normalized := make([]GraphError, len(graphErrors))
+	for i, graphError := range graphErrors {
+		normalized[i] = GraphError{Message: graphError.Message}
+		if graphError.Path == nil {
+			continue
+		}
+		normalized[i].Path = make([]interface{}, len(graphError.Path))
+		for j, segment := range graphError.Path {
+			if f, ok := segment.(float64); ok && f == math.Trunc(f) {
+				segment = int(f)
+			}
+			normalized[i].Path[j] = segment
+		}
+	}
+	return normalized
+}
+
+// graphResponseObjectCounts returns the length of the lists of the data of a raw GraphQL
+// response, keyed by their dot separated path. The objects are walked down, but not the list
+// items. It returns nil if the response can't be parsed or has no lists.
+func graphResponseObjectCounts(rawResponse string) map[string]int {
+	body := rawResponseBody(rawResponse)
+	if body == nil {
+		return nil
+	}
+
+	var payload struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	countGraphListFields(payload.Data, "", counts)
+	if len(counts) == 0 {
+		return nil
+	}
+	return counts
+}
+
+// rawResponseBody returns the de-chunked body of a raw response, which may be base64 encoded
+// (as the gateway stores it) or plain. Chunked bodies missing their last chunk, or whose
+// Transfer-Encoding header was dropped, are de-chunked too. It returns nil if the response can't
+// be parsed.
+func rawResponseBody(rawResponse string) []byte {
+	if rawResponse == "" {
+		return nil
+	}
+	responseBytes, err := base64.StdEncoding.DecodeString(rawResponse)
+	if err != nil {
+		responseBytes = []byte(rawResponse)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(responseBytes)), nil)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	chunked := len(resp.TransferEncoding) > 0 && resp.TransferEncoding[0] == "chunked"
+	body, err := io.ReadAll(resp.Body)
+	if err != nil && !(chunked && errors.Is(err, io.ErrUnexpectedEOF)) {
+		return nil
+	}
+	if !chunked && !json.Valid(body) {
+		if dechunked, ok := dechunk(body); ok {
+			return dechunked
+		}
+	}
+	return body
+}
+
+// dechunk decodes a chunked body, tolerating a missing last chunk. It returns false if the body
+// isn't chunked.
+func dechunk(body []byte) ([]byte, bool) {
+	dechunked, err := io.ReadAll(httputil.NewChunkedReader(bytes.NewReader(body)))
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, false
+	}
+	return dechunked, len(dechunked) > 0
+}
+
+func countGraphListFields(fields map[string]interface{}, prefix string, counts map[string]int) {
+	for name, value := range fields {
+		switch v := value.(type) {
+		case []interface{}:
+			counts[prefix+name] = len(v)
+		case map[string]interface{}:
+			countGraphListFields(v, prefix+name+".", counts)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package analytics
 
 import (
 	"encoding/base64"
+	"fmt"
 	"testing"
 	"time"
 
@@ -179,3 +180,264 @@ func TestAnalyticsRecord_ToGraphRecordNew(t *testing.T) {
 		})
 	}
 }
+
+func TestAnalyticsRecord_ToGraphRecordErrorPath(t *testing.T) {
+	record := AnalyticsRecord{
+		ResponseCode: 200,
+		GraphQLStats: GraphQLStats{
+			IsGraphQL: true,
+			HasErrors: true,
+			Errors: []GraphError{
+				{
+					Message: "sample error",
+					// numbers decoded from JSON are float64
+					Path: []interface{}{"characters", float64(1), "name", 1.5},
+				},
+				{
+					Message: "error without path",
+				},
+			},
+		},
+	}
+
+	gotten := record.ToGraphRecord()
+
+	expected := []GraphError{
+		{
+			Message: "sample error",
+			Path:    []interface{}{"characters", 1, "name", 1.5},
+		},
+		{
+			Message: "error without path",
+		},
+	}
+	if diff := cmp.Diff(expected, gotten.Errors); diff != "" {
+		t.Fatal(diff)
+	}
+	if _, ok := gotten.Errors[0].Path[1].(int); !ok {
+		t.Fatalf("expected path index to be int, got %T", gotten.Errors[0].Path[1])
+	}
+	// the original record is not modified
+	if _, ok := record.GraphQLStats.Errors[0].Path[1].(float64); !ok {
+		t.Fatal("original record errors shouldn't be modified")
+	}
+}
+
+func TestAnalyticsRecord_ToGraphRecordResponseObjectCounts(t *testing.T) {
+	tcs := []struct {
+		name     string
+		response string
+		encode   bool
+		expected map[string]int
+	}{
+		{
+			name:     "top level list",
+			response: `{"data":{"listCharacters":[{"name":"Rick"},{"name":"Morty"},{"name":"Summer"}]}}`,
+			encode:   true,
+			expected: map[string]int{"listCharacters": 3},
+		},
+		{
+			name:     "nested lists",
+			response: `{"data":{"characters":{"info":{"count":2},"results":[{"name":"Rick","episode":[{"id":"1"}]},{"name":"Morty"}]},"empty":[]}}`,
+			encode:   true,
+			expected: map[string]int{"characters.results": 2, "empty": 0},
+		},
+		{
+			name:     "plain raw response",
+			response: `{"data":{"listCharacters":[{"name":"Rick"}]}}`,
+			expected: map[string]int{"listCharacters": 1},
+		},
+		{
+			name:     "no lists",
+			response: `{"data":{"character":{"name":"Rick"}}}`,
+			encode:   true,
+		},
+		{
+			name:     "missing data",
+			response: `{"errors":[{"message":"sample error"}]}`,
+			encode:   true,
+		},
+		{
+			name:     "null fields",
+			response: `{"data":{"characters":null}}`,
+			encode:   true,
+		},
+		{
+			name:     "invalid json",
+			response: `{"data":`,
+			encode:   true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rawResponse := fmt.Sprintf(responseTemplate, len(tc.response), tc.response)
+			if tc.encode {
+				rawResponse = base64.StdEncoding.EncodeToString([]byte(rawResponse))
+			}
+			record := AnalyticsRecord{
+				ResponseCode: 200,
+				RawResponse:  rawResponse,
+				GraphQLStats: GraphQLStats{IsGraphQL: true},
+			}
+
+			gotten := record.ToGraphRecord()
+			if diff := cmp.Diff(tc.expected, gotten.ResponseObjectCounts); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestAnalyticsRecord_ToGraphRecordChunkedResponse(t *testing.T) {
+	const (
+		body          = `{"data":{"characters":{"results":[{"name":"Rick"},{"name":"Morty"}]},"episodes":[{"id":"1"}]}}`
+		chunkedHeader = "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nContent-Type: application/json\r\n\r\n"
+	)
+	chunks := ""
+	for i := 0; i < len(body); i += 16 {
+		end := i + 16
+		if end > len(body) {
+			end = len(body)
+		}
+		chunks += fmt.Sprintf("%x\r\n%s\r\n", end-i, body[i:end])
+	}
+
+	plain := AnalyticsRecord{
+		ResponseCode: 200,
+		RawResponse:  base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(responseTemplate, len(body), body))),
+		GraphQLStats: GraphQLStats{IsGraphQL: true},
+	}
+	expected := map[string]int{"characters.results": 2, "episodes": 1}
+	if diff := cmp.Diff(expected, plain.ToGraphRecord().ResponseObjectCounts); diff != "" {
+		t.Fatal(diff)
+	}
+
+	tcs := []struct {
+		name        string
+		rawResponse string
+	}{
+		{
+			name:        "chunked",
+			rawResponse: chunkedHeader + chunks + "0\r\n\r\n",
+		},
+		{
+			name:        "missing last chunk",
+			rawResponse: chunkedHeader + chunks,
+		},
+		{
+			name:        "missing transfer encoding header",
+			rawResponse: "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\n\r\n" + chunks + "0\r\n\r\n",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			record := plain
+			record.RawResponse = base64.StdEncoding.EncodeToString([]byte(tc.rawResponse))
+
+			gotten := record.ToGraphRecord()
+			if diff := cmp.Diff(expected, gotten.ResponseObjectCounts); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestAnalyticsRecord_ToGraphRecordVariablesLimits(t *testing.T) {
+	variables := `{"id":"123","password":"secret","input":{"name":"Rick","Token":"abc","tags":[{"token":"def"}]}}`
+
+	tcs := []struct {
+		name      string
+		limits    GraphVariablesLimits
+		variables string
+		encode    bool
+		expected  string
+	}{
+		{
+			name:      "no limits",
+			variables: variables,
+			encode:    true,
+			expected:  variables,
+		},
+		{
+			name:      "redacted names",
+			limits:    GraphVariablesLimits{RedactedNames: []string{"password", "token"}},
+			variables: variables,
+			encode:    true,
+			expected:  `{"id":"123","input":{"Token":"[REDACTED]","name":"Rick","tags":[{"token":"[REDACTED]"}]},"password":"[REDACTED]"}`,
+		},
+		{
+			name:      "redacted names of plain variables",
+			limits:    GraphVariablesLimits{RedactedNames: []string{"password"}},
+			variables: `{"password":"secret","count":10}`,
+			expected:  `{"count":10,"password":"[REDACTED]"}`,
+		},
+		{
+			name:      "oversized variables",
+			limits:    GraphVariablesLimits{MaxSize: 16},
+			variables: variables,
+			encode:    true,
+			expected:  `{"id":"123","pas`,
+		},
+		{
+			name:      "variables under the max size",
+			limits:    GraphVariablesLimits{MaxSize: 1024},
+			variables: variables,
+			encode:    true,
+			expected:  variables,
+		},
+		{
+			name:      "truncation doesn't split characters",
+			limits:    GraphVariablesLimits{MaxSize: 10},
+			variables: `{"name":"Été"}`,
+			expected:  `{"name":"`,
+		},
+		{
+			name:      "redacted then truncated",
+			limits:    GraphVariablesLimits{MaxSize: 20, RedactedNames: []string{"id"}},
+			variables: variables,
+			encode:    true,
+			expected:  `{"id":"[REDACTED]","`,
+		},
+		{
+			name:      "invalid json is only truncated",
+			limits:    GraphVariablesLimits{MaxSize: 8, RedactedNames: []string{"password"}},
+			variables: `{"password":`,
+			expected:  `{"passwo`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			StoredGraphVariables = tc.limits
+			defer func() {
+				StoredGraphVariables = GraphVariablesLimits{}
+			}()
+
+			stored := tc.variables
+			if tc.encode {
+				stored = base64.StdEncoding.EncodeToString([]byte(tc.variables))
+			}
+			record := AnalyticsRecord{
+				ResponseCode: 200,
+				GraphQLStats: GraphQLStats{IsGraphQL: true, Variables: stored},
+			}
+
+			gotten := record.ToGraphRecord().Variables
+			if tc.encode {
+				decoded, err := base64.StdEncoding.DecodeString(gotten)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gotten = string(decoded)
+			}
+			if diff := cmp.Diff(tc.expected, gotten); diff != "" {
+				t.Fatal(diff)
+			}
+			// the original record is not modified
+			if record.GraphQLStats.Variables != stored {
+				t.Fatal("original record variables shouldn't be modified")
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package analytics
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+const (
+	grpcStatusHeader = "Grpc-Status"
+	// the flag and the length prefixing each gRPC message
+	grpcFrameHeaderSize = 5
+	// the flag of the trailers frames of gRPC-Web
+	grpcWebTrailersFlag = 0x80
+)
+
+// SetGRPCStatus detects the gRPC records, whose raw response has an `application/grpc` content
+// type, and populates IsGRPC and GRPCStatus. The status is read from the `grpc-status` header of
+// trailers-only responses, the `grpc-status` trailer, or the trailer lines following the messages
+// of the body. Records which aren't gRPC are left untouched, and the status of gRPC records
+// without a `grpc-status` is left to 0 (OK).
+func (a *AnalyticsRecord) SetGRPCStatus(raw *RawData) {
+	resp := raw.Response()
+	if resp == nil || !isGRPCContentType(resp.Header.Get("Content-Type")) {
+		return
+	}
+	a.IsGRPC = true
+
+	if status, ok := grpcStatus(resp.Header.Get(grpcStatusHeader)); ok {
+		a.GRPCStatus = status
+		return
+	}
+	if status, ok := grpcStatus(resp.Trailer.Get(grpcStatusHeader)); ok {
+		a.GRPCStatus = status
+		return
+	}
+
+	// otherwise the trailers may have been dumped after the messages, as header lines, or in the
+	// trailers frame of gRPC-Web
+	if status, ok := grpcTrailerStatus(raw.ResponseBody()); ok {
+		a.GRPCStatus = status
+	}
+}
+
+// isGRPCContentType reports whether contentType is a gRPC content type, e.g. `application/grpc`
+// or `application/grpc+proto`.
+func isGRPCContentType(contentType string) bool {
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	return contentType == "application/grpc" || strings.HasPrefix(contentType, "application/grpc+") ||
+		strings.HasPrefix(contentType, "application/grpc;") || strings.HasPrefix(contentType, "application/grpc-web")
+}
+
+func grpcStatus(value string) (int, bool) {
+	status, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || status < 0 {
+		return 0, false
+	}
+	return status, true
+}
+
+// grpcTrailerStatus returns the status of the trailers of a gRPC body: the header lines of its
+// gRPC-Web trailers frames, or the header lines following its length-prefixed messages. The
+// content of the messages isn't read.
+func grpcTrailerStatus(body []byte) (int, bool) {
+	status, found := 0, false
+	for len(body) >= grpcFrameHeaderSize {
+		length := int(binary.BigEndian.Uint32(body[1:grpcFrameHeaderSize]))
+		if length > len(body)-grpcFrameHeaderSize {
+			break
+		}
+		if body[0]&grpcWebTrailersFlag != 0 {
+			if s, ok := grpcStatusLine(body[grpcFrameHeaderSize : grpcFrameHeaderSize+length]); ok {
+				status, found = s, true
+			}
+		}
+		body = body[grpcFrameHeaderSize+length:]
+	}
+	if s, ok := grpcStatusLine(body); ok {
+		return s, true
+	}
+	return status, found
+}
+
+// grpcStatusLine returns the status of the last `grpc-status: <status>` header line of lines.
+func grpcStatusLine(lines []byte) (int, bool) {
+	status, found := 0, false
+	for _, line := range strings.Split(string(lines), "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), grpcStatusHeader) {
+			continue
+		}
+		if s, ok := grpcStatus(value); ok {
+			status, found = s, true
+		}
+	}
+	return status, found
+}
@@ -0,0 +1,84 @@
+package analytics
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyticsRecord_SetGRPCStatus(t *testing.T) {
+	tcs := []struct {
+		testName       string
+		rawResponse    string
+		expectedIsGRPC bool
+		expectedStatus int
+	}{
+		{
+			testName:       "trailers only response",
+			rawResponse:    "HTTP/2.0 200 OK\r\nContent-Type: application/grpc\r\nGrpc-Status: 5\r\nGrpc-Message: not found\r\n\r\n",
+			expectedIsGRPC: true,
+			expectedStatus: 5,
+		},
+		{
+			testName:       "chunked response trailer",
+			rawResponse:    "HTTP/1.1 200 OK\r\nContent-Type: application/grpc+proto\r\nTransfer-Encoding: chunked\r\nTrailer: Grpc-Status\r\n\r\n5\r\n\x00\x00\x00\x00\x00\r\n0\r\ngrpc-status: 14\r\n\r\n",
+			expectedIsGRPC: true,
+			expectedStatus: 14,
+		},
+		{
+			testName:       "trailers dumped after the body",
+			rawResponse:    "HTTP/2.0 200 OK\r\nContent-Type: application/grpc\r\n\r\n\x00\x00\x00\x00\x00\r\ngrpc-status: 13\r\ngrpc-message: internal\r\n",
+			expectedIsGRPC: true,
+			expectedStatus: 13,
+		},
+		{
+			testName:       "grpc-web trailers frame",
+			rawResponse:    "HTTP/1.1 200 OK\r\nContent-Type: application/grpc-web+proto\r\n\r\n\x80\x00\x00\x00\x0fgrpc-status:16\r\n",
+			expectedIsGRPC: true,
+			expectedStatus: 16,
+		},
+		{
+			testName:       "grpc-web message and trailers frames",
+			rawResponse:    "HTTP/1.1 200 OK\r\nContent-Type: application/grpc-web\r\n\r\n\x00\x00\x00\x00\x02hi\x80\x00\x00\x00\x10grpc-status: 7\r\n",
+			expectedIsGRPC: true,
+			expectedStatus: 7,
+		},
+		{
+			testName:       "status line within a message",
+			rawResponse:    "HTTP/2.0 200 OK\r\nContent-Type: application/grpc\r\n\r\n\x00\x00\x00\x00\x10grpc-status: 3\r\n",
+			expectedIsGRPC: true,
+		},
+		{
+			testName:       "ok",
+			rawResponse:    "HTTP/2.0 200 OK\r\nContent-Type: application/grpc\r\nGrpc-Status: 0\r\n\r\n",
+			expectedIsGRPC: true,
+		},
+		{
+			testName:       "missing status",
+			rawResponse:    "HTTP/2.0 200 OK\r\nContent-Type: application/grpc\r\n\r\n",
+			expectedIsGRPC: true,
+		},
+		{
+			testName:    "not grpc",
+			rawResponse: "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nGrpc-Status: 5\r\n\r\n{}",
+		},
+		{
+			testName:    "malformed raw response",
+			rawResponse: "not a response",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			for _, rawResponse := range []string{tc.rawResponse, base64.StdEncoding.EncodeToString([]byte(tc.rawResponse))} {
+				record := AnalyticsRecord{ResponseCode: 200, RawResponse: rawResponse}
+				record.SetGRPCStatus(NewRawData(&record))
+
+				assert.Equal(t, tc.expectedIsGRPC, record.IsGRPC)
+				assert.Equal(t, tc.expectedStatus, record.GRPCStatus)
+				assert.Equal(t, 200, record.ResponseCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultJWTHeader       = "Authorization"
+	DefaultJWTSubjectClaim = "sub"
+)
+
+// JWTClaimsExtractor reads the claims of the JWTs of the raw requests, without verifying their
+// signature: the gateway already did.
+type JWTClaimsExtractor struct {
+	header       string
+	subjectClaim string
+	claims       []string
+}
+
+// NewJWTClaimsExtractor returns a JWTClaimsExtractor reading the JWT from header, with or without
+// the `Bearer ` prefix. The subjectClaim populates JWTSubject and each of claims adds the
+// `<claim>:<value>` tag. header and subjectClaim default to DefaultJWTHeader and
+// DefaultJWTSubjectClaim.
+func NewJWTClaimsExtractor(header, subjectClaim string, claims []string) *JWTClaimsExtractor {
+	if header == "" {
+		header = DefaultJWTHeader
+	}
+	if subjectClaim == "" {
+		subjectClaim = DefaultJWTSubjectClaim
+	}
+	return &JWTClaimsExtractor{header: header, subjectClaim: subjectClaim, claims: claims}
+}
+
+// jwtPayload returns the decoded claims of token, a JWT with or without the `Bearer ` prefix, or
+// nil if it isn't a JWT.
+func jwtPayload(token string) map[string]interface{} {
+	token = strings.TrimSpace(token)
+	if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		token = strings.TrimSpace(token[7:])
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	claims := map[string]interface{}{}
+	if err := decoder.Decode(&claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
+// claimValue returns the value of a string, number or boolean claim. The lists of strings, e.g.
+// the `scp` claim, are space separated.
+func claimValue(claim interface{}) (string, bool) {
+	switch value := claim.(type) {
+	case string:
+		return value, value != ""
+	case json.Number:
+		return value.String(), true
+	case bool:
+		return strconv.FormatBool(value), true
+	case []interface{}:
+		items := []string{}
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return "", false
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, " "), len(items) > 0
+	}
+	return "", false
+}
+
+// SetJWTClaims populates JWTSubject and tags the record with the claims extracted by e from the
+// JWT of the raw request. The records without a raw request or a JWT are left untouched.
+func (a *AnalyticsRecord) SetJWTClaims(raw *RawData, e *JWTClaimsExtractor) {
+	header := raw.RequestHeader()
+	if header == nil {
+		return
+	}
+	claims := jwtPayload(header.Get(e.header))
+	if claims == nil {
+		return
+	}
+
+	if subject, ok := claimValue(claims[e.subjectClaim]); ok {
+		a.JWTSubject = subject
+	}
+	for _, claim := range e.claims {
+		if value, ok := claimValue(claims[claim]); ok {
+			a.Tags = append(a.Tags, claim+":"+value)
+		}
+	}
+}
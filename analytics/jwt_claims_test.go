@@ -0,0 +1,69 @@
+package analytics
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyticsRecord_SetJWTClaims(t *testing.T) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-123","scope":"read write","scp":["read","write"],"tenant":42,"admin":false,"nested":{"a":1}}`))
+	token := header + "." + payload + ".c2lnbmF0dXJl"
+	rawRequest := func(headerLine string) string {
+		return "GET /get HTTP/1.1\r\nHost: localhost:8080\r\n" + headerLine + "\r\n\r\n"
+	}
+
+	tcs := []struct {
+		testName        string
+		extractor       *JWTClaimsExtractor
+		record          AnalyticsRecord
+		expectedSubject string
+		expectedTags    []string
+	}{
+		{
+			testName:        "bearer token",
+			extractor:       NewJWTClaimsExtractor("", "", []string{"scope", "tenant", "admin", "missing", "nested"}),
+			record:          AnalyticsRecord{RawRequest: base64.StdEncoding.EncodeToString([]byte(rawRequest("Authorization: Bearer " + token)))},
+			expectedSubject: "user-123",
+			expectedTags:    []string{"scope:read write", "tenant:42", "admin:false"},
+		},
+		{
+			testName:        "custom header without prefix",
+			extractor:       NewJWTClaimsExtractor("X-Id-Token", "", []string{"scp"}),
+			record:          AnalyticsRecord{RawRequest: rawRequest("X-Id-Token: " + token), Tags: []string{"key-abc"}},
+			expectedSubject: "user-123",
+			expectedTags:    []string{"key-abc", "scp:read write"},
+		},
+		{
+			testName:        "custom subject claim",
+			extractor:       NewJWTClaimsExtractor("", "tenant", nil),
+			record:          AnalyticsRecord{RawRequest: rawRequest("Authorization: bearer " + token)},
+			expectedSubject: "42",
+		},
+		{
+			testName:  "not a jwt",
+			extractor: NewJWTClaimsExtractor("", "", []string{"scope"}),
+			record:    AnalyticsRecord{RawRequest: rawRequest("Authorization: Basic dXNlcjpwYXNz")},
+		},
+		{
+			testName:  "invalid payload",
+			extractor: NewJWTClaimsExtractor("", "", []string{"scope"}),
+			record:    AnalyticsRecord{RawRequest: rawRequest("Authorization: Bearer " + header + ".bm90IGpzb24.c2ln")},
+		},
+		{
+			testName:  "no raw request",
+			extractor: NewJWTClaimsExtractor("", "", []string{"scope"}),
+			record:    AnalyticsRecord{},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			tc.record.SetJWTClaims(NewRawData(&tc.record), tc.extractor)
+			assert.Equal(t, tc.expectedSubject, tc.record.JWTSubject)
+			assert.Equal(t, tc.expectedTags, tc.record.Tags)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+const (
+	KeyHashSHA256     = "sha256"
+	KeyHashSHA512     = "sha512"
+	KeyHashHMACSHA256 = "hmac-sha256"
+)
+
+// KeyHashFunc hashes value with salt. It must be deterministic, so the same key always yields
+// the same token.
+type KeyHashFunc func(salt, value []byte) []byte
+
+var (
+	keyHashFuncsMu sync.RWMutex
+	keyHashFuncs   = map[string]KeyHashFunc{
+		KeyHashSHA256: func(salt, value []byte) []byte {
+			sum := sha256.Sum256(append(append([]byte{}, salt...), value...))
+			return sum[:]
+		},
+		KeyHashSHA512: func(salt, value []byte) []byte {
+			sum := sha512.Sum512(append(append([]byte{}, salt...), value...))
+			return sum[:]
+		},
+		KeyHashHMACSHA256: func(salt, value []byte) []byte {
+			mac := hmac.New(sha256.New, salt)
+			mac.Write(value)
+			return mac.Sum(nil)
+		},
+	}
+)
+
+// RegisterKeyHashFunc makes a hashing algorithm available to NewKeyHasher under name, replacing
+// any previous algorithm with the same name.
+func RegisterKeyHashFunc(name string, fn KeyHashFunc) {
+	keyHashFuncsMu.Lock()
+	defer keyHashFuncsMu.Unlock()
+	keyHashFuncs[name] = fn
+}
+
+// KeyHasher anonymizes the API keys and OAuth ids of the records, replacing them with a hex
+// encoded token.
+type KeyHasher struct {
+	hash KeyHashFunc
+	salt []byte
+}
+
+// NewKeyHasher returns a KeyHasher using the registered algorithm, which defaults to
+// hmac-sha256.
+func NewKeyHasher(algorithm, salt string) (*KeyHasher, error) {
+	if algorithm == "" {
+		algorithm = KeyHashHMACSHA256
+	}
+
+	keyHashFuncsMu.RLock()
+	fn, ok := keyHashFuncs[algorithm]
+	keyHashFuncsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown key hashing algorithm %q", algorithm)
+	}
+
+	return &KeyHasher{hash: fn, salt: []byte(salt)}, nil
+}
+
+// Hash returns the token of value. Empty values are kept as they are.
+func (h *KeyHasher) Hash(value string) string {
+	if value == "" {
+		return ""
+	}
+	return hex.EncodeToString(h.hash(h.salt, []byte(value)))
+}
+
+// HashKeys replaces the API key and the OAuth id of the record with their tokens.
+func (a *AnalyticsRecord) HashKeys(h *KeyHasher) {
+	a.APIKey = h.Hash(a.APIKey)
+	a.OauthID = h.Hash(a.OauthID)
+}
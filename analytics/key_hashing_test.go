@@ -0,0 +1,58 @@
+package analytics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyHasher(t *testing.T) {
+	for _, algorithm := range []string{"", KeyHashSHA256, KeyHashSHA512, KeyHashHMACSHA256} {
+		t.Run(algorithm, func(t *testing.T) {
+			hasher, err := NewKeyHasher(algorithm, "salt")
+			assert.Nil(t, err)
+
+			token := hasher.Hash("key1")
+			assert.NotEqual(t, "key1", token)
+			assert.Equal(t, token, hasher.Hash("key1"))
+			assert.NotEqual(t, token, hasher.Hash("key2"))
+			assert.Equal(t, "", hasher.Hash(""))
+
+			otherSalt, err := NewKeyHasher(algorithm, "other")
+			assert.Nil(t, err)
+			assert.NotEqual(t, token, otherSalt.Hash("key1"))
+		})
+	}
+
+	hmacHasher, err := NewKeyHasher(KeyHashHMACSHA256, "salt")
+	assert.Nil(t, err)
+	assert.Equal(t, "36b1628d2f365d3dab5ad08200f2721f665b9c24f773f4f996e256c18faa2ea9", hmacHasher.Hash("key1"))
+
+	_, err = NewKeyHasher("md5", "salt")
+	assert.EqualError(t, err, `unknown key hashing algorithm "md5"`)
+}
+
+func TestRegisterKeyHashFunc(t *testing.T) {
+	RegisterKeyHashFunc("reverse", func(salt, value []byte) []byte {
+		reversed := make([]byte, len(value))
+		for i, b := range value {
+			reversed[len(value)-1-i] = b
+		}
+		return append(append([]byte{}, salt...), reversed...)
+	})
+
+	hasher, err := NewKeyHasher("reverse", "s")
+	assert.Nil(t, err)
+	assert.Equal(t, "73636261", hasher.Hash("abc"))
+}
+
+func TestAnalyticsRecord_HashKeys(t *testing.T) {
+	hasher, err := NewKeyHasher(KeyHashSHA256, "salt")
+	assert.Nil(t, err)
+
+	record := AnalyticsRecord{APIKey: "key1", OauthID: "client1", APIID: "api1"}
+	record.HashKeys(hasher)
+	assert.Equal(t, hasher.Hash("key1"), record.APIKey)
+	assert.Equal(t, hasher.Hash("client1"), record.OauthID)
+	assert.Equal(t, "api1", record.APIID)
+}
@@ -0,0 +1,44 @@
+package analytics
+
+import (
+	"math"
+	"strconv"
+)
+
+const (
+	DefaultLatencyDNSTag     = "latency_dns"
+	DefaultLatencyConnectTag = "latency_connect"
+	DefaultLatencyTLSTag     = "latency_tls"
+)
+
+// LatencyPhasesTags are the keys of the tags the latency sub-phases of the records are read from,
+// as `key:value` or `key-value` with the value in milliseconds. Empty keys aren't read.
+type LatencyPhasesTags struct {
+	DNSTag     string
+	ConnectTag string
+	TLSTag     string
+}
+
+// SetLatencyPhases populates LatencyDNS, LatencyConnect and LatencyTLS from the tags of the record.
+// The phases whose tag is missing, or isn't a positive number of milliseconds, are left at zero.
+// Fractions of milliseconds are rounded.
+func (a *AnalyticsRecord) SetLatencyPhases(tags LatencyPhasesTags) {
+	a.LatencyDNS = a.latencyTagValue(tags.DNSTag)
+	a.LatencyConnect = a.latencyTagValue(tags.ConnectTag)
+	a.LatencyTLS = a.latencyTagValue(tags.TLSTag)
+}
+
+func (a *AnalyticsRecord) latencyTagValue(key string) int64 {
+	if key == "" {
+		return 0
+	}
+	value, found := a.TagValue(key)
+	if !found {
+		return 0
+	}
+	ms, err := strconv.ParseFloat(value, 64)
+	if err != nil || ms < 0 || math.IsInf(ms, 0) {
+		return 0
+	}
+	return int64(math.Round(ms))
+}
@@ -0,0 +1,71 @@
+package analytics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyticsRecord_SetLatencyPhases(t *testing.T) {
+	defaultTags := LatencyPhasesTags{DNSTag: DefaultLatencyDNSTag, ConnectTag: DefaultLatencyConnectTag, TLSTag: DefaultLatencyTLSTag}
+
+	tcs := []struct {
+		testName        string
+		tags            LatencyPhasesTags
+		record          AnalyticsRecord
+		expectedDNS     int64
+		expectedConnect int64
+		expectedTLS     int64
+	}{
+		{
+			testName:        "tags",
+			tags:            defaultTags,
+			record:          AnalyticsRecord{Tags: []string{"key-abc", "latency_dns:3", "latency_connect-12", "latency_tls:25"}},
+			expectedDNS:     3,
+			expectedConnect: 12,
+			expectedTLS:     25,
+		},
+		{
+			testName:        "custom tags",
+			tags:            LatencyPhasesTags{DNSTag: "dns", ConnectTag: "connect", TLSTag: "handshake"},
+			record:          AnalyticsRecord{Tags: []string{"dns:1", "connect:2", "handshake:3"}},
+			expectedDNS:     1,
+			expectedConnect: 2,
+			expectedTLS:     3,
+		},
+		{
+			testName:        "fractions are rounded",
+			tags:            defaultTags,
+			record:          AnalyticsRecord{Tags: []string{"latency_dns:0.4", "latency_connect:1.6"}},
+			expectedDNS:     0,
+			expectedConnect: 2,
+		},
+		{
+			testName:        "plain http, no tls tag",
+			tags:            defaultTags,
+			record:          AnalyticsRecord{Tags: []string{"latency_dns:4", "latency_connect:8"}},
+			expectedDNS:     4,
+			expectedConnect: 8,
+		},
+		{
+			testName: "no tags",
+			tags:     defaultTags,
+			record:   AnalyticsRecord{},
+		},
+		{
+			testName: "invalid values",
+			tags:     defaultTags,
+			record:   AnalyticsRecord{Tags: []string{"latency_dns:fast", "latency_connect:-5", "latency_tls:+Inf"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			record := tc.record
+			record.SetLatencyPhases(tc.tags)
+			assert.Equal(t, tc.expectedDNS, record.LatencyDNS)
+			assert.Equal(t, tc.expectedConnect, record.LatencyConnect)
+			assert.Equal(t, tc.expectedTLS, record.LatencyTLS)
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package analytics
+
+import "strings"
+
+// DefaultNodeIDTagPrefix is the prefix of the tag holding the id of the gateway node.
+const DefaultNodeIDTagPrefix = "node:"
+
+// SetNodeID populates NodeID with the id of the gateway node which emitted the record, read from
+// its first tag starting with tagPrefix, e.g. `node:gw-1`. It's left untouched without such a tag.
+func (a *AnalyticsRecord) SetNodeID(tagPrefix string) {
+	for _, tag := range a.Tags {
+		if !strings.HasPrefix(tag, tagPrefix) {
+			continue
+		}
+		if nodeID := strings.TrimSpace(strings.TrimPrefix(tag, tagPrefix)); nodeID != "" {
+			a.NodeID = nodeID
+			return
+		}
+	}
+}
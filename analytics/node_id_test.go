@@ -0,0 +1,83 @@
+package analytics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyticsRecord_SetNodeID(t *testing.T) {
+	tcs := []struct {
+		testName       string
+		tagPrefix      string
+		record         AnalyticsRecord
+		expectedNodeID string
+	}{
+		{
+			testName:       "node tag",
+			tagPrefix:      DefaultNodeIDTagPrefix,
+			record:         AnalyticsRecord{Tags: []string{"key-abc", "node:gw-eu-1", "org-123"}},
+			expectedNodeID: "gw-eu-1",
+		},
+		{
+			testName:       "first non empty node tag",
+			tagPrefix:      DefaultNodeIDTagPrefix,
+			record:         AnalyticsRecord{Tags: []string{"node: ", "node:gw-2", "node:gw-3"}},
+			expectedNodeID: "gw-2",
+		},
+		{
+			testName:       "custom prefix",
+			tagPrefix:      "instance-",
+			record:         AnalyticsRecord{Tags: []string{"node:gw-1", "instance-i-0abc"}},
+			expectedNodeID: "i-0abc",
+		},
+		{
+			testName:  "no node tag",
+			tagPrefix: DefaultNodeIDTagPrefix,
+			record:    AnalyticsRecord{Tags: []string{"key-abc"}},
+		},
+		{
+			testName:       "existing node id untouched",
+			tagPrefix:      DefaultNodeIDTagPrefix,
+			record:         AnalyticsRecord{Enrichment: Enrichment{NodeID: "gw-0"}},
+			expectedNodeID: "gw-0",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			record := tc.record
+			record.SetNodeID(tc.tagPrefix)
+
+			assert.Equal(t, tc.expectedNodeID, record.NodeID)
+		})
+	}
+}
+
+func TestAggregate_NodeIDs(t *testing.T) {
+	records := []interface{}{
+		AnalyticsRecord{OrgID: "ORG123", APIID: "123", Enrichment: Enrichment{NodeID: "gw-1"}, ResponseCode: 200},
+		AnalyticsRecord{OrgID: "ORG123", APIID: "123", Enrichment: Enrichment{NodeID: "gw-1"}, ResponseCode: 500},
+		AnalyticsRecord{OrgID: "ORG123", APIID: "123", Enrichment: Enrichment{NodeID: "gw-2"}, ResponseCode: 200},
+		AnalyticsRecord{OrgID: "ORG123", APIID: "123", ResponseCode: 200},
+	}
+
+	aggregations := AggregateData(records, false, []string{}, "", 60)
+	aggregation := aggregations["ORG123"]
+
+	assert.Len(t, aggregation.NodeIDs, 2)
+	assert.Equal(t, 2, aggregation.NodeIDs["gw-1"].Hits)
+	assert.Equal(t, 1, aggregation.NodeIDs["gw-1"].ErrorTotal)
+	assert.Equal(t, 1, aggregation.NodeIDs["gw-2"].Hits)
+
+	dimensions := map[string]int{}
+	for _, d := range aggregation.Dimensions() {
+		if d.Name == "nodeids" {
+			dimensions[d.Value] = d.Counter.Hits
+		}
+	}
+	assert.Equal(t, map[string]int{"gw-1": 2, "gw-2": 1}, dimensions)
+
+	aggregation.DiscardAggregations([]string{"nodeids"})
+	assert.Empty(t, aggregation.NodeIDs)
+}
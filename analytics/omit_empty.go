@@ -0,0 +1,72 @@
+package analytics
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// NonEmptyFields returns the document of the record without its empty fields: the empty strings,
+// the zero numbers and booleans, the zero timestamps and the empty lists, maps and embedded
+// documents. The fields are named like the Mongo drivers name them, after their bson tag or
+// their lowercased name.
+func (a *AnalyticsRecord) NonEmptyFields() map[string]interface{} {
+	return nonEmptyDocument(reflect.ValueOf(a).Elem())
+}
+
+func nonEmptyDocument(v reflect.Value) map[string]interface{} {
+	document := map[string]interface{}{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("bson"), ",")
+		name := tag[0]
+		if name == "-" {
+			continue
+		}
+		value := v.Field(i)
+		if len(tag) > 1 && tag[1] == "inline" {
+			for k, inlined := range nonEmptyDocument(value) {
+				document[k] = inlined
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		if value.Kind() == reflect.Struct && value.Type() != timeType {
+			if embedded := nonEmptyDocument(value); len(embedded) > 0 {
+				document[name] = embedded
+			}
+			continue
+		}
+		if !IsEmptyValue(value.Interface()) {
+			document[name] = value.Interface()
+		}
+	}
+	return document
+}
+
+// IsEmptyValue returns whether value is an empty string, a zero number or boolean, a zero
+// timestamp, an empty list or map, or nil.
+func IsEmptyValue(value interface{}) bool {
+	if t, ok := value.(time.Time); ok {
+		return t.IsZero()
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
@@ -0,0 +1,52 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyticsRecord_NonEmptyFields(t *testing.T) {
+	timestamp := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	record := AnalyticsRecord{
+		Method:       "GET",
+		ResponseCode: 200,
+		TimeStamp:    timestamp,
+		Month:        time.March,
+		Geo: GeoData{
+			Country: Country{ISOCode: "ES"},
+			City:    City{Names: map[string]string{}},
+		},
+		Tags:         []string{"tag1"},
+		TrackPath:    true,
+		GraphQLStats: GraphQLStats{IsGraphQL: true},
+		Enrichment:   Enrichment{Browser: "Firefox"},
+	}
+	record.SetObjectID("id")
+
+	assert.Equal(t, map[string]interface{}{
+		"method":       "GET",
+		"responsecode": 200,
+		"timestamp":    timestamp,
+		"month":        time.March,
+		"geo": map[string]interface{}{
+			"country": map[string]interface{}{"isocode": "ES"},
+		},
+		"tags":      []string{"tag1"},
+		"trackpath": true,
+		// the enrichment fields are inlined
+		"browser": "Firefox",
+	}, record.NonEmptyFields())
+
+	assert.Equal(t, map[string]interface{}{}, (&AnalyticsRecord{Tags: []string{}}).NonEmptyFields())
+}
+
+func TestIsEmptyValue(t *testing.T) {
+	for _, value := range []interface{}{nil, "", 0, int64(0), 0.0, false, time.Time{}, []string{}, map[string]string{}, (*int)(nil)} {
+		assert.True(t, IsEmptyValue(value), "%#v", value)
+	}
+	for _, value := range []interface{}{"a", 1, 0.5, true, time.Now(), []string{""}, map[string]float64{"lat": 0}} {
+		assert.False(t, IsEmptyValue(value), "%#v", value)
+	}
+}
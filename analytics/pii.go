@@ -0,0 +1,84 @@
+package analytics
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// DefaultMaxPIIBodySize is the number of bytes of the request bodies scanned by the PIIDetector
+// when no limit is configured.
+const DefaultMaxPIIBodySize = 64 << 10
+
+// DefaultPIIPatterns are the regular expressions of the PII categories detected when none are
+// configured.
+var DefaultPIIPatterns = map[string]string{
+	"email":       `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	"credit_card": `\b(?:\d{4}[ -]?){3}\d{1,4}\b`,
+	"ssn":         `\b\d{3}-\d{2}-\d{4}\b`,
+}
+
+// PIIDetector flags the request bodies containing personal data, matching them against a
+// regular expression per PII category.
+type PIIDetector struct {
+	categories  []piiCategory
+	maxBodySize int
+}
+
+type piiCategory struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// NewPIIDetector returns a PIIDetector matching the regular expressions of patterns, keyed by
+// category. If patterns is empty, DefaultPIIPatterns are used. Only the first maxBodySize bytes
+// of the bodies are scanned; it defaults to DefaultMaxPIIBodySize.
+func NewPIIDetector(patterns map[string]string, maxBodySize int) (*PIIDetector, error) {
+	if len(patterns) == 0 {
+		patterns = DefaultPIIPatterns
+	}
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultMaxPIIBodySize
+	}
+
+	d := &PIIDetector{maxBodySize: maxBodySize}
+	for name, pattern := range patterns {
+		if name == "" {
+			return nil, fmt.Errorf("empty category for pattern %q", pattern)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q of category %q: %w", pattern, name, err)
+		}
+		d.categories = append(d.categories, piiCategory{name: name, pattern: re})
+	}
+	sort.Slice(d.categories, func(i, j int) bool {
+		return d.categories[i].name < d.categories[j].name
+	})
+	return d, nil
+}
+
+// Categories returns the sorted categories of the PII found in body.
+func (d *PIIDetector) Categories(body []byte) []string {
+	if len(body) > d.maxBodySize {
+		body = body[:d.maxBodySize]
+	}
+
+	var categories []string
+	for _, category := range d.categories {
+		if category.pattern.Match(body) {
+			categories = append(categories, category.name)
+		}
+	}
+	return categories
+}
+
+// DetectPII sets ContainsPII and PIICategories according to the PII found by d in the raw
+// request body.
+func (a *AnalyticsRecord) DetectPII(raw *RawData, d *PIIDetector) {
+	if a.RawRequest == "" {
+		return
+	}
+	a.PIICategories = d.Categories(raw.RequestBody())
+	a.ContainsPII = len(a.PIICategories) > 0
+}
@@ -0,0 +1,74 @@
+package analytics
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyticsRecord_DetectPII(t *testing.T) {
+	detector, err := NewPIIDetector(nil, 0)
+	assert.Nil(t, err)
+
+	rawRequest := func(body string) string {
+		request := "POST /payments HTTP/1.1\r\nHost: localhost:8080\r\nContent-Type: application/json\r\n\r\n" + body
+		return base64.StdEncoding.EncodeToString([]byte(request))
+	}
+
+	tcs := []struct {
+		testName           string
+		record             AnalyticsRecord
+		expectedPII        bool
+		expectedCategories []string
+	}{
+		{
+			testName:           "email and card number",
+			record:             AnalyticsRecord{RawRequest: rawRequest(`{"email": "jane.doe@example.com", "card": "4111 1111 1111 1111", "amount": 1200}`)},
+			expectedPII:        true,
+			expectedCategories: []string{"credit_card", "email"},
+		},
+		{
+			testName:           "ssn",
+			record:             AnalyticsRecord{RawRequest: rawRequest(`{"ssn": "078-05-1120"}`)},
+			expectedPII:        true,
+			expectedCategories: []string{"ssn"},
+		},
+		{
+			testName: "no pii",
+			record:   AnalyticsRecord{RawRequest: rawRequest(`{"order_id": 12345, "amount": 1200, "date": "2024-03-01"}`)},
+		},
+		{
+			testName: "pii in the headers only",
+			record:   AnalyticsRecord{RawRequest: base64.StdEncoding.EncodeToString([]byte("GET / HTTP/1.1\r\nFrom: jane.doe@example.com\r\n\r\n"))},
+		},
+		{
+			testName: "no raw request",
+			record:   AnalyticsRecord{},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			tc.record.DetectPII(NewRawData(&tc.record), detector)
+			assert.Equal(t, tc.expectedPII, tc.record.ContainsPII)
+			assert.Equal(t, tc.expectedCategories, tc.record.PIICategories)
+		})
+	}
+}
+
+func TestPIIDetector_Categories(t *testing.T) {
+	detector, err := NewPIIDetector(map[string]string{"phone": `\+\d{10,14}`}, 64)
+	assert.Nil(t, err)
+
+	// the configured patterns replace the default ones
+	assert.Equal(t, []string{"phone"}, detector.Categories([]byte(`{"phone": "+34600000000", "email": "jane.doe@example.com"}`)))
+	// only the first max body size bytes are scanned
+	assert.Nil(t, detector.Categories([]byte(`{"notes": "`+strings.Repeat("a", 64)+`", "phone": "+34600000000"}`)))
+
+	_, err = NewPIIDetector(map[string]string{"phone": `(`}, 0)
+	assert.NotNil(t, err)
+	_, err = NewPIIDetector(map[string]string{"": `\d+`}, 0)
+	assert.NotNil(t, err)
+}
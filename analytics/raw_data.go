@@ -0,0 +1,118 @@
+package analytics
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// RawData is the raw request and response of a record, decoded and parsed at most once for all
+// the enrichments reading them. They may be base64 encoded (as the gateway stores them) or plain.
+// Each part is only parsed the first time it's read.
+type RawData struct {
+	rawRequest  string
+	rawResponse string
+
+	requestDecoded bool
+	request        string
+	requestParsed  bool
+	parsedRequest  *http.Request
+
+	responseParsed bool
+	response       *http.Response
+	responseBody   []byte
+}
+
+// NewRawData returns the RawData of the raw request and response of a.
+func NewRawData(a *AnalyticsRecord) *RawData {
+	return &RawData{rawRequest: a.RawRequest, rawResponse: a.RawResponse}
+}
+
+// Request returns the decoded raw request, or "" if the record has none.
+func (r *RawData) Request() string {
+	if !r.requestDecoded {
+		r.requestDecoded = true
+		if r.rawRequest != "" {
+			r.request = decodeRawData(r.rawRequest)
+		}
+	}
+	return r.request
+}
+
+// ParsedRequest returns the parsed raw request, or nil if it's missing or can't be parsed.
+func (r *RawData) ParsedRequest() *http.Request {
+	if !r.requestParsed {
+		r.requestParsed = true
+		if request := r.Request(); request != "" {
+			r.parsedRequest, _ = http.ReadRequest(bufio.NewReader(strings.NewReader(request)))
+		}
+	}
+	return r.parsedRequest
+}
+
+// RequestHeader returns the headers of the raw request, or nil if it's missing or can't be parsed.
+func (r *RawData) RequestHeader() http.Header {
+	if req := r.ParsedRequest(); req != nil {
+		return req.Header
+	}
+	return nil
+}
+
+// RequestBody returns the body of the raw request, or nil if it has none.
+func (r *RawData) RequestBody() []byte {
+	request := r.Request()
+	for _, separator := range []string{"\r\n\r\n", "\n\n"} {
+		if i := strings.Index(request, separator); i >= 0 {
+			return []byte(request[i+len(separator):])
+		}
+	}
+	return nil
+}
+
+// Response returns the parsed raw response, with its body read so its trailers are set, or nil if
+// it's missing or can't be parsed.
+func (r *RawData) Response() *http.Response {
+	if !r.responseParsed {
+		r.responseParsed = true
+		r.parseResponse()
+	}
+	return r.response
+}
+
+// ResponseBody returns the de-chunked body of the raw response, or nil if it's missing or can't
+// be read.
+func (r *RawData) ResponseBody() []byte {
+	r.Response()
+	return r.responseBody
+}
+
+// ResponseHeader returns the headers of the raw response, or nil if it's missing or can't be
+// parsed.
+func (r *RawData) ResponseHeader() http.Header {
+	if resp := r.Response(); resp != nil {
+		return resp.Header
+	}
+	return nil
+}
+
+func (r *RawData) parseResponse() {
+	if r.rawResponse == "" {
+		return
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(decodeRawData(r.rawResponse))), nil)
+	if err != nil {
+		log.Debug("Unable to parse the raw response: ", err)
+		return
+	}
+	defer resp.Body.Close()
+	r.response = resp
+
+	// the trailers are read along with the body of the chunked responses
+	body, err := io.ReadAll(resp.Body)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return
+	}
+	r.responseBody = body
+}
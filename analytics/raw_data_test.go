@@ -0,0 +1,39 @@
+package analytics
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRawData(t *testing.T) {
+	rawRequest := "POST /users HTTP/1.1\r\nHost: example.com\r\nX-Request-Id: abc\r\n\r\n{\"name\":\"jane\"}"
+	rawResponse := "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 2\r\n\r\n{}"
+	record := AnalyticsRecord{
+		RawRequest:  base64.StdEncoding.EncodeToString([]byte(rawRequest)),
+		RawResponse: rawResponse,
+	}
+	raw := NewRawData(&record)
+
+	assert.Equal(t, rawRequest, raw.Request())
+	assert.Equal(t, "abc", raw.RequestHeader().Get("X-Request-Id"))
+	assert.Equal(t, []byte(`{"name":"jane"}`), raw.RequestBody())
+	assert.Equal(t, "application/json", raw.ResponseHeader().Get("Content-Type"))
+	assert.Equal(t, []byte("{}"), raw.ResponseBody())
+
+	// parsed once
+	assert.Same(t, raw.ParsedRequest(), raw.ParsedRequest())
+	assert.Same(t, raw.Response(), raw.Response())
+
+	t.Run("missing or malformed", func(t *testing.T) {
+		raw := NewRawData(&AnalyticsRecord{RawResponse: "not a response"})
+		assert.Empty(t, raw.Request())
+		assert.Nil(t, raw.ParsedRequest())
+		assert.Nil(t, raw.RequestHeader())
+		assert.Nil(t, raw.RequestBody())
+		assert.Nil(t, raw.Response())
+		assert.Nil(t, raw.ResponseHeader())
+		assert.Nil(t, raw.ResponseBody())
+	})
+}
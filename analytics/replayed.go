@@ -0,0 +1,17 @@
+package analytics
+
+// ReplayedTag tags the records written again to the analytics storage after their first write,
+// e.g. when they're replayed from a backup, so they can be told apart from the original ones.
+const ReplayedTag = "replayed"
+
+// MarkReplayed tags the record with ReplayedTag, once.
+func (a *AnalyticsRecord) MarkReplayed() {
+	if !a.IsReplayed() {
+		a.Tags = append(a.Tags, ReplayedTag)
+	}
+}
+
+// IsReplayed reports whether the record is tagged with ReplayedTag.
+func (a *AnalyticsRecord) IsReplayed() bool {
+	return stringInSlice(ReplayedTag, a.Tags)
+}
@@ -0,0 +1,40 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyticsRecord_MarkReplayed(t *testing.T) {
+	record := AnalyticsRecord{Tags: []string{"key-abc"}}
+	assert.False(t, record.IsReplayed())
+
+	record.MarkReplayed()
+	record.MarkReplayed()
+	assert.True(t, record.IsReplayed())
+	assert.Equal(t, []string{"key-abc", ReplayedTag}, record.Tags)
+}
+
+func TestSkipReplayedAggregation(t *testing.T) {
+	timestamp := time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+	replayed := AnalyticsRecord{APIID: "api1", OrgID: "org1", ResponseCode: 200, TimeStamp: timestamp}
+	replayed.MarkReplayed()
+	records := []interface{}{
+		AnalyticsRecord{APIID: "api1", OrgID: "org1", ResponseCode: 200, TimeStamp: timestamp},
+		AnalyticsRecord{APIID: "api1", OrgID: "org1", ResponseCode: 200, TimeStamp: timestamp},
+		replayed,
+	}
+
+	filters := AnalyticsFilters{SkipReplayed: true}
+	filtered := []interface{}{}
+	for _, record := range records {
+		if !filters.ShouldFilter(record.(AnalyticsRecord)) {
+			filtered = append(filtered, record)
+		}
+	}
+
+	assert.Equal(t, 3, AggregateData(records, false, nil, "", 60)["org1"].Total.Hits)
+	assert.Equal(t, 2, AggregateData(filtered, false, nil, "", 60)["org1"].Total.Hits)
+}
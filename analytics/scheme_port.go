@@ -0,0 +1,73 @@
+package analytics
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// defaultPorts are the ports used when the host has no explicit port, per scheme.
+var defaultPorts = map[string]int{
+	"http":  80,
+	"https": 443,
+	"ws":    80,
+	"wss":   443,
+}
+
+// SetSchemeAndPort populates Scheme and Port from the host and the raw request of the record.
+//
+// The scheme is read, in order, from a scheme prefixing the host (e.g. `https://host`), the
+// absolute URI of the raw request line, and the X-Forwarded-Proto header of the raw request. If
+// none is set, it's `https` when the record has a TLS version or the port is 443, and `http`
+// otherwise. The port is the explicit port of the host, or the default port of the scheme.
+// Bracketed IPv6 hosts (e.g. `[::1]:8443`) are supported; unbracketed ones have no explicit port.
+func (a *AnalyticsRecord) SetSchemeAndPort(raw *RawData) {
+	host := a.Host
+	scheme := ""
+	if strings.Contains(host, "://") {
+		if u, err := url.Parse(host); err == nil && u.Scheme != "" {
+			scheme, host = u.Scheme, u.Host
+		}
+	}
+
+	if req := raw.ParsedRequest(); req != nil {
+		if host == "" {
+			host = req.Host
+		}
+		if scheme == "" {
+			scheme = req.URL.Scheme
+		}
+		if scheme == "" {
+			scheme = strings.TrimSpace(strings.Split(req.Header.Get("X-Forwarded-Proto"), ",")[0])
+		}
+	}
+
+	port := hostPort(host)
+	scheme = strings.ToLower(scheme)
+	if scheme == "" {
+		scheme = "http"
+		if a.TLSVersion != "" || port == 443 {
+			scheme = "https"
+		}
+	}
+	if port == 0 {
+		port = defaultPorts[scheme]
+	}
+
+	a.Scheme = scheme
+	a.Port = port
+}
+
+// hostPort returns the explicit port of host, or 0 if it has none.
+func hostPort(host string) int {
+	_, portValue, err := net.SplitHostPort(host)
+	if err != nil {
+		return 0
+	}
+	port, err := strconv.Atoi(portValue)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0
+	}
+	return port
+}
@@ -0,0 +1,104 @@
+package analytics
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyticsRecord_SetSchemeAndPort(t *testing.T) {
+	tcs := []struct {
+		testName       string
+		record         AnalyticsRecord
+		expectedScheme string
+		expectedPort   int
+	}{
+		{
+			testName:       "https with explicit port",
+			record:         AnalyticsRecord{Host: "https://api.example.com:8443"},
+			expectedScheme: "https",
+			expectedPort:   8443,
+		},
+		{
+			testName:       "http default port",
+			record:         AnalyticsRecord{Host: "api.example.com"},
+			expectedScheme: "http",
+			expectedPort:   80,
+		},
+		{
+			testName:       "https default port",
+			record:         AnalyticsRecord{Host: "HTTPS://api.example.com"},
+			expectedScheme: "https",
+			expectedPort:   443,
+		},
+		{
+			testName:       "explicit port 443",
+			record:         AnalyticsRecord{Host: "api.example.com:443"},
+			expectedScheme: "https",
+			expectedPort:   443,
+		},
+		{
+			testName:       "tls version",
+			record:         AnalyticsRecord{Host: "api.example.com", Enrichment: Enrichment{TLSVersion: "TLS1.3"}},
+			expectedScheme: "https",
+			expectedPort:   443,
+		},
+		{
+			testName:       "IPv6 host with port",
+			record:         AnalyticsRecord{Host: "[2001:db8::1]:8080"},
+			expectedScheme: "http",
+			expectedPort:   8080,
+		},
+		{
+			testName:       "IPv6 host without port",
+			record:         AnalyticsRecord{Host: "https://[2001:db8::1]"},
+			expectedScheme: "https",
+			expectedPort:   443,
+		},
+		{
+			testName:       "unbracketed IPv6 host",
+			record:         AnalyticsRecord{Host: "2001:db8::1"},
+			expectedScheme: "http",
+			expectedPort:   80,
+		},
+		{
+			testName: "forwarded proto of the raw request",
+			record: AnalyticsRecord{
+				Host:       "api.example.com:9000",
+				RawRequest: base64.StdEncoding.EncodeToString([]byte("GET / HTTP/1.1\r\nHost: api.example.com:9000\r\nX-Forwarded-Proto: https, http\r\n\r\n")),
+			},
+			expectedScheme: "https",
+			expectedPort:   9000,
+		},
+		{
+			testName:       "absolute URI of the raw request",
+			record:         AnalyticsRecord{RawRequest: "GET wss://[::1]:7000/socket HTTP/1.1\r\nHost: [::1]:7000\r\n\r\n"},
+			expectedScheme: "wss",
+			expectedPort:   7000,
+		},
+		{
+			testName:       "host of the raw request",
+			record:         AnalyticsRecord{RawRequest: "GET / HTTP/1.1\r\nHost: [::1]\r\n\r\n"},
+			expectedScheme: "http",
+			expectedPort:   80,
+		},
+		{
+			testName:       "invalid port",
+			record:         AnalyticsRecord{Host: "api.example.com:99999"},
+			expectedScheme: "http",
+			expectedPort:   80,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			record := tc.record
+			record.SetSchemeAndPort(NewRawData(&record))
+
+			assert.Equal(t, tc.expectedScheme, record.Scheme)
+			assert.Equal(t, tc.expectedPort, record.Port)
+			assert.Equal(t, tc.record.Host, record.Host)
+		})
+	}
+}
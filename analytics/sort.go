@@ -0,0 +1,14 @@
+package analytics
+
+import "sort"
+
+// SortByTimestamp returns a copy of records sorted by TimeStamp, oldest first. The records with
+// the same timestamp keep their order. records itself is left untouched, as it may be shared.
+func SortByTimestamp(records []interface{}) []interface{} {
+	sorted := make([]interface{}, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].(AnalyticsRecord).TimeStamp.Before(sorted[j].(AnalyticsRecord).TimeStamp)
+	})
+	return sorted
+}
@@ -0,0 +1,33 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortByTimestamp(t *testing.T) {
+	now := time.Now()
+	records := []interface{}{
+		AnalyticsRecord{APIID: "api3", TimeStamp: now.Add(2 * time.Second)},
+		AnalyticsRecord{APIID: "api1", TimeStamp: now},
+		AnalyticsRecord{APIID: "api2a", TimeStamp: now.Add(time.Second)},
+		AnalyticsRecord{APIID: "api0", TimeStamp: now.Add(-time.Second)},
+		AnalyticsRecord{APIID: "api2b", TimeStamp: now.Add(time.Second)},
+		AnalyticsRecord{APIID: "api2c", TimeStamp: now.Add(time.Second)},
+	}
+	original := make([]interface{}, len(records))
+	copy(original, records)
+
+	sorted := SortByTimestamp(records)
+	apiIDs := []string{}
+	for _, record := range sorted {
+		apiIDs = append(apiIDs, record.(AnalyticsRecord).APIID)
+	}
+	// the records with the same timestamp keep their order
+	assert.Equal(t, []string{"api0", "api1", "api2a", "api2b", "api2c", "api3"}, apiIDs)
+	assert.Equal(t, original, records)
+
+	assert.Empty(t, SortByTimestamp(nil))
+}
@@ -0,0 +1,52 @@
+package analytics
+
+import "strings"
+
+// SetTagMap moves the `key:value` tags of the record into TagMap, so the sinks can store them as
+// a map rather than as flat strings. Only the tags of keys are moved, or all the `key:value` tags
+// without keys. The other tags, and the ones with an empty key or value, are left in Tags. The
+// first value of a key wins. With keepTags, the moved tags are kept in Tags too.
+func (a *AnalyticsRecord) SetTagMap(keys []string, keepTags bool) {
+	var remaining []string
+	for _, tag := range a.Tags {
+		key, value, ok := splitTag(tag)
+		if !ok || (len(keys) > 0 && !containsString(keys, key)) {
+			remaining = append(remaining, tag)
+			continue
+		}
+		if a.TagMap == nil {
+			a.TagMap = make(map[string]string)
+		}
+		if _, found := a.TagMap[key]; !found {
+			a.TagMap[key] = value
+		}
+		if keepTags {
+			remaining = append(remaining, tag)
+		}
+	}
+	if a.TagMap != nil {
+		a.Tags = remaining
+	}
+}
+
+// splitTag splits a `key:value` tag, whose key doesn't contain spaces.
+func splitTag(tag string) (key, value string, ok bool) {
+	i := strings.Index(tag, ":")
+	if i <= 0 || i == len(tag)-1 {
+		return "", "", false
+	}
+	key, value = tag[:i], tag[i+1:]
+	if strings.ContainsAny(key, " \t") {
+		return "", "", false
+	}
+	return key, value, true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
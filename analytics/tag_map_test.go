@@ -0,0 +1,71 @@
+package analytics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyticsRecord_SetTagMap(t *testing.T) {
+	tcs := []struct {
+		testName       string
+		keys           []string
+		keepTags       bool
+		tags           []string
+		expectedTagMap map[string]string
+		expectedTags   []string
+	}{
+		{
+			testName:       "mixed tags",
+			tags:           []string{"key-abc", "team:payments", "org-123", "env:prod", "url:http://example.com"},
+			expectedTagMap: map[string]string{"team": "payments", "env": "prod", "url": "http://example.com"},
+			expectedTags:   []string{"key-abc", "org-123"},
+		},
+		{
+			testName:       "not key value tags",
+			tags:           []string{"key-abc", ":value", "key:", "two words:value", "beta"},
+			expectedTags:   []string{"key-abc", ":value", "key:", "two words:value", "beta"},
+			expectedTagMap: nil,
+		},
+		{
+			testName:       "first value wins",
+			tags:           []string{"team:payments", "team:search"},
+			expectedTagMap: map[string]string{"team": "payments"},
+			expectedTags:   nil,
+		},
+		{
+			testName:       "keys",
+			keys:           []string{"team"},
+			tags:           []string{"team:payments", "env:prod", "key-abc"},
+			expectedTagMap: map[string]string{"team": "payments"},
+			expectedTags:   []string{"env:prod", "key-abc"},
+		},
+		{
+			testName:       "keep tags",
+			keepTags:       true,
+			tags:           []string{"team:payments", "key-abc"},
+			expectedTagMap: map[string]string{"team": "payments"},
+			expectedTags:   []string{"team:payments", "key-abc"},
+		},
+		{
+			testName: "no tags",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			record := AnalyticsRecord{Tags: tc.tags}
+			record.SetTagMap(tc.keys, tc.keepTags)
+			assert.Equal(t, tc.expectedTagMap, record.TagMap)
+			assert.Equal(t, tc.expectedTags, record.Tags)
+		})
+	}
+}
+
+func TestAnalyticsRecord_TagMapJSONValue(t *testing.T) {
+	record := AnalyticsRecord{Enrichment: Enrichment{TagMap: map[string]string{"team": "payments", "env": "prod"}}}
+	assert.Equal(t, `{"tag_map":{"env":"prod","team":"payments"}}`, record.Enrichment.JSONValue())
+
+	record = AnalyticsRecord{Enrichment: Enrichment{TagMap: map[string]string{}}}
+	assert.Equal(t, "{}", record.Enrichment.JSONValue())
+}
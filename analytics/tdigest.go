@@ -0,0 +1,153 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+)
+
+// defaultTDigestCompression bounds the number of centroids of a TDigest to roughly
+// 2 * compression, trading accuracy for size.
+const defaultTDigestCompression = 100
+
+// Centroid is a cluster of observations of a TDigest.
+type Centroid struct {
+	Mean  float64 `json:"mean"`
+	Count float64 `json:"count"`
+}
+
+// TDigest is a merging t-digest, used to approximate the percentiles of a distribution with a
+// bounded amount of memory. Digests can be merged, which allows percentiles to be computed
+// across partial aggregations.
+type TDigest struct {
+	Compression float64    `json:"compression"`
+	Min         float64    `json:"min"`
+	Max         float64    `json:"max"`
+	Centroids   []Centroid `json:"centroids"`
+}
+
+// NewTDigest returns an empty TDigest with the default compression.
+func NewTDigest() *TDigest {
+	return &TDigest{Compression: defaultTDigestCompression}
+}
+
+// Count returns the number of observations of the digest.
+func (d *TDigest) Count() float64 {
+	var count float64
+	for _, c := range d.Centroids {
+		count += c.Count
+	}
+	return count
+}
+
+// Add adds a single observation to the digest.
+func (d *TDigest) Add(value float64) {
+	if len(d.Centroids) == 0 || value < d.Min {
+		d.Min = value
+	}
+	if len(d.Centroids) == 0 || value > d.Max {
+		d.Max = value
+	}
+	d.Centroids = append(d.Centroids, Centroid{Mean: value, Count: 1})
+	if float64(len(d.Centroids)) > 10*d.compression() {
+		d.compress()
+	}
+}
+
+// Merge adds all the observations of other to the digest.
+func (d *TDigest) Merge(other *TDigest) {
+	if other == nil || len(other.Centroids) == 0 {
+		return
+	}
+	if len(d.Centroids) == 0 || other.Min < d.Min {
+		d.Min = other.Min
+	}
+	if len(d.Centroids) == 0 || other.Max > d.Max {
+		d.Max = other.Max
+	}
+	d.Centroids = append(d.Centroids, other.Centroids...)
+	if float64(len(d.Centroids)) > 10*d.compression() {
+		d.compress()
+	}
+}
+
+// Clone returns a deep copy of the digest.
+func (d *TDigest) Clone() *TDigest {
+	clone := *d
+	clone.Centroids = append([]Centroid(nil), d.Centroids...)
+	return &clone
+}
+
+// Quantile returns the approximate value below which the q fraction of the observations fall,
+// with q between 0 and 1. It returns 0 if the digest is empty.
+func (d *TDigest) Quantile(q float64) float64 {
+	d.compress()
+
+	n := len(d.Centroids)
+	if n == 0 {
+		return 0
+	}
+	q = math.Max(0, math.Min(1, q))
+	if n == 1 {
+		return d.Min + (d.Max-d.Min)*q
+	}
+
+	total := d.Count()
+	index := q * total
+
+	// below the center of the first centroid, interpolate from the min value
+	first := d.Centroids[0]
+	if index < first.Count/2 {
+		return d.Min + (first.Mean-d.Min)*index/(first.Count/2)
+	}
+
+	cumulative := 0.0
+	for i := 0; i < n-1; i++ {
+		left, right := d.Centroids[i], d.Centroids[i+1]
+		leftCenter := cumulative + left.Count/2
+		rightCenter := cumulative + left.Count + right.Count/2
+		if index <= rightCenter {
+			return left.Mean + (right.Mean-left.Mean)*(index-leftCenter)/(rightCenter-leftCenter)
+		}
+		cumulative += left.Count
+	}
+
+	// above the center of the last centroid, interpolate to the max value
+	last := d.Centroids[n-1]
+	lastCenter := total - last.Count/2
+	return last.Mean + (d.Max-last.Mean)*(index-lastCenter)/(last.Count/2)
+}
+
+func (d *TDigest) compression() float64 {
+	if d.Compression <= 0 {
+		return defaultTDigestCompression
+	}
+	return d.Compression
+}
+
+// compress sorts the centroids and merges the adjacent ones, keeping the centroids close to
+// the tails small so the extreme percentiles remain accurate.
+func (d *TDigest) compress() {
+	if len(d.Centroids) < 2 {
+		return
+	}
+	sort.Slice(d.Centroids, func(i, j int) bool {
+		return d.Centroids[i].Mean < d.Centroids[j].Mean
+	})
+
+	total := d.Count()
+	compression := d.compression()
+	merged := d.Centroids[:1]
+	cumulative := 0.0
+	for _, c := range d.Centroids[1:] {
+		current := &merged[len(merged)-1]
+		q := (cumulative + (current.Count+c.Count)/2) / total
+		if current.Count+c.Count <= 4*total*q*(1-q)/compression {
+			current.Mean += (c.Mean - current.Mean) * c.Count / (current.Count + c.Count)
+			current.Count += c.Count
+			continue
+		}
+		cumulative += current.Count
+		merged = append(merged, c)
+	}
+	d.Centroids = merged
+}
@@ -0,0 +1,70 @@
+package analytics
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTDigest_Quantile(t *testing.T) {
+	digest := NewTDigest()
+	// a shuffled uniform distribution of the values 1 to 10000
+	for _, v := range rand.New(rand.NewSource(1)).Perm(10000) {
+		digest.Add(float64(v + 1))
+	}
+
+	assert.Equal(t, float64(10000), digest.Count())
+	assert.LessOrEqual(t, len(digest.Centroids), 10*defaultTDigestCompression)
+
+	tcs := []struct {
+		quantile float64
+		expected float64
+	}{
+		{quantile: 0, expected: 1},
+		{quantile: 0.5, expected: 5000},
+		{quantile: 0.95, expected: 9500},
+		{quantile: 0.99, expected: 9900},
+		{quantile: 1, expected: 10000},
+	}
+
+	for _, tc := range tcs {
+		assert.InDelta(t, tc.expected, digest.Quantile(tc.quantile), 10000*0.01, "quantile %v", tc.quantile)
+	}
+}
+
+func TestTDigest_Merge(t *testing.T) {
+	whole := NewTDigest()
+	first := NewTDigest()
+	second := NewTDigest()
+	for i := 1; i <= 1000; i++ {
+		whole.Add(float64(i))
+		if i%2 == 0 {
+			first.Add(float64(i))
+		} else {
+			second.Add(float64(i))
+		}
+	}
+
+	merged := first.Clone()
+	merged.Merge(second)
+	merged.Merge(nil)
+
+	assert.Equal(t, whole.Count(), merged.Count())
+	assert.Equal(t, float64(1), merged.Min)
+	assert.Equal(t, float64(1000), merged.Max)
+	for _, q := range []float64{0.5, 0.95, 0.99} {
+		assert.InDelta(t, whole.Quantile(q), merged.Quantile(q), 1000*0.01, "quantile %v", q)
+	}
+
+	// merging doesn't modify the merged digest
+	assert.Equal(t, float64(500), second.Count())
+}
+
+func TestTDigest_Empty(t *testing.T) {
+	digest := NewTDigest()
+	assert.Equal(t, float64(0), digest.Quantile(0.5))
+
+	digest.Add(42)
+	assert.Equal(t, float64(42), digest.Quantile(0.99))
+}
@@ -0,0 +1,41 @@
+package analytics
+
+const (
+	DefaultTLSVersionTag = "tls_version"
+	DefaultTLSCipherTag  = "tls_cipher"
+)
+
+// TLSInfoSources are the tags, and the raw request headers, the TLS version and cipher of the
+// records are read from. The tags are read as `key:value` or `key-value`, and take precedence
+// over the headers. Empty sources aren't read.
+type TLSInfoSources struct {
+	VersionTag    string
+	CipherTag     string
+	VersionHeader string
+	CipherHeader  string
+}
+
+// SetTLSInfo populates TLSVersion and TLSCipher from the tags or the raw request headers of the
+// record. They're left empty when they can't be found.
+func (a *AnalyticsRecord) SetTLSInfo(raw *RawData, sources TLSInfoSources) {
+	if sources.VersionTag != "" {
+		a.TLSVersion, _ = a.TagValue(sources.VersionTag)
+	}
+	if sources.CipherTag != "" {
+		a.TLSCipher, _ = a.TagValue(sources.CipherTag)
+	}
+	if (a.TLSVersion != "" || sources.VersionHeader == "") && (a.TLSCipher != "" || sources.CipherHeader == "") {
+		return
+	}
+
+	header := raw.RequestHeader()
+	if header == nil {
+		return
+	}
+	if a.TLSVersion == "" && sources.VersionHeader != "" {
+		a.TLSVersion = header.Get(sources.VersionHeader)
+	}
+	if a.TLSCipher == "" && sources.CipherHeader != "" {
+		a.TLSCipher = header.Get(sources.CipherHeader)
+	}
+}
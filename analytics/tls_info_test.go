@@ -0,0 +1,81 @@
+package analytics
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyticsRecord_SetTLSInfo(t *testing.T) {
+	rawRequest := "GET /get HTTP/1.1\r\nHost: localhost:8080\r\nX-SSL-Protocol: TLSv1.2\r\nX-SSL-Cipher: ECDHE-RSA-AES128-GCM-SHA256\r\n\r\n"
+	defaultSources := TLSInfoSources{VersionTag: DefaultTLSVersionTag, CipherTag: DefaultTLSCipherTag}
+	headerSources := TLSInfoSources{
+		VersionTag:    DefaultTLSVersionTag,
+		CipherTag:     DefaultTLSCipherTag,
+		VersionHeader: "X-SSL-Protocol",
+		CipherHeader:  "X-SSL-Cipher",
+	}
+
+	tcs := []struct {
+		testName        string
+		sources         TLSInfoSources
+		record          AnalyticsRecord
+		expectedVersion string
+		expectedCipher  string
+	}{
+		{
+			testName:        "tags",
+			sources:         defaultSources,
+			record:          AnalyticsRecord{Tags: []string{"key-abc", "tls_version:TLS1.3", "tls_cipher-TLS_AES_128_GCM_SHA256"}},
+			expectedVersion: "TLS1.3",
+			expectedCipher:  "TLS_AES_128_GCM_SHA256",
+		},
+		{
+			testName:        "custom tags",
+			sources:         TLSInfoSources{VersionTag: "tls", CipherTag: "cipher"},
+			record:          AnalyticsRecord{Tags: []string{"tls:TLS1.3", "cipher:TLS_CHACHA20_POLY1305_SHA256"}},
+			expectedVersion: "TLS1.3",
+			expectedCipher:  "TLS_CHACHA20_POLY1305_SHA256",
+		},
+		{
+			testName:        "headers",
+			sources:         headerSources,
+			record:          AnalyticsRecord{RawRequest: base64.StdEncoding.EncodeToString([]byte(rawRequest))},
+			expectedVersion: "TLSv1.2",
+			expectedCipher:  "ECDHE-RSA-AES128-GCM-SHA256",
+		},
+		{
+			testName:        "tags take precedence over headers",
+			sources:         headerSources,
+			record:          AnalyticsRecord{Tags: []string{"tls_version:TLS1.3"}, RawRequest: rawRequest},
+			expectedVersion: "TLS1.3",
+			expectedCipher:  "ECDHE-RSA-AES128-GCM-SHA256",
+		},
+		{
+			testName: "headers not configured",
+			sources:  defaultSources,
+			record:   AnalyticsRecord{RawRequest: rawRequest},
+		},
+		{
+			testName: "absent",
+			sources:  headerSources,
+			record:   AnalyticsRecord{Tags: []string{"key-abc"}, RawRequest: "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"},
+		},
+		{
+			testName: "malformed raw request",
+			sources:  headerSources,
+			record:   AnalyticsRecord{RawRequest: "not a request"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			record := tc.record
+			record.SetTLSInfo(NewRawData(&record), tc.sources)
+
+			assert.Equal(t, tc.expectedVersion, record.TLSVersion)
+			assert.Equal(t, tc.expectedCipher, record.TLSCipher)
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package analytics
+
+import (
+	"strings"
+
+	"github.com/mssola/useragent"
+)
+
+// The device types of SetUserAgentFamilies.
+const (
+	DeviceTypeDesktop = "desktop"
+	DeviceTypeMobile  = "mobile"
+	DeviceTypeTablet  = "tablet"
+	DeviceTypeBot     = "bot"
+	DeviceTypeOther   = "other"
+)
+
+// SetUserAgentFamilies populates Browser, OS and DeviceType from the user agent of the record,
+// e.g. `Chrome`, `Windows` and `desktop`. The browser of the non browser clients is their
+// product, e.g. `curl`, and their OS is empty. The records without a user agent are left
+// untouched.
+func (a *AnalyticsRecord) SetUserAgentFamilies() {
+	if a.UserAgent == "" {
+		return
+	}
+
+	ua := useragent.New(a.UserAgent)
+	a.Browser, _ = ua.Browser()
+	a.OS = ua.OSInfo().Name
+	platform := ua.Platform()
+	// the iPads report `OS`, and the iPhones `iPhone OS`
+	if platform == "iPhone" || platform == "iPad" || platform == "iPod" || platform == "iPod touch" {
+		a.OS = "iOS"
+	}
+
+	switch {
+	case ua.Bot():
+		a.DeviceType = DeviceTypeBot
+	case platform == "iPad" || strings.Contains(a.UserAgent, "Tablet") ||
+		(a.OS == "Android" && !strings.Contains(a.UserAgent, "Mobile")):
+		// the Android tablets don't have the `Mobile` token of the phones
+		a.DeviceType = DeviceTypeTablet
+	case ua.Mobile():
+		a.DeviceType = DeviceTypeMobile
+	case a.OS != "":
+		a.DeviceType = DeviceTypeDesktop
+	default:
+		a.DeviceType = DeviceTypeOther
+	}
+}
@@ -0,0 +1,99 @@
+package analytics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyticsRecord_SetUserAgentFamilies(t *testing.T) {
+	tcs := []struct {
+		testName   string
+		userAgent  string
+		browser    string
+		os         string
+		deviceType string
+	}{
+		{
+			testName:   "chrome on windows",
+			userAgent:  "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36",
+			browser:    "Chrome",
+			os:         "Windows",
+			deviceType: DeviceTypeDesktop,
+		},
+		{
+			testName:   "edge on windows",
+			userAgent:  "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36 Edg/118.0.2088.46",
+			browser:    "Edge",
+			os:         "Windows",
+			deviceType: DeviceTypeDesktop,
+		},
+		{
+			testName:   "safari on mac",
+			userAgent:  "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15",
+			browser:    "Safari",
+			os:         "Mac OS X",
+			deviceType: DeviceTypeDesktop,
+		},
+		{
+			testName:   "firefox on linux",
+			userAgent:  "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/118.0",
+			browser:    "Firefox",
+			os:         "Ubuntu",
+			deviceType: DeviceTypeDesktop,
+		},
+		{
+			testName:   "safari on iphone",
+			userAgent:  "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+			browser:    "Safari",
+			os:         "iOS",
+			deviceType: DeviceTypeMobile,
+		},
+		{
+			testName:   "safari on ipad",
+			userAgent:  "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			browser:    "Safari",
+			os:         "iOS",
+			deviceType: DeviceTypeTablet,
+		},
+		{
+			testName:   "chrome on android phone",
+			userAgent:  "Mozilla/5.0 (Linux; Android 13; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Mobile Safari/537.36",
+			browser:    "Chrome",
+			os:         "Android",
+			deviceType: DeviceTypeMobile,
+		},
+		{
+			testName:   "chrome on android tablet",
+			userAgent:  "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36",
+			browser:    "Chrome",
+			os:         "Android",
+			deviceType: DeviceTypeTablet,
+		},
+		{
+			testName:   "crawler",
+			userAgent:  "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			browser:    "Googlebot",
+			deviceType: DeviceTypeBot,
+		},
+		{
+			testName:   "non browser client",
+			userAgent:  "curl/8.1.2",
+			browser:    "curl",
+			deviceType: DeviceTypeOther,
+		},
+		{
+			testName: "no user agent",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			record := AnalyticsRecord{UserAgent: tc.userAgent}
+			record.SetUserAgentFamilies()
+			assert.Equal(t, tc.browser, record.Browser)
+			assert.Equal(t, tc.os, record.OS)
+			assert.Equal(t, tc.deviceType, record.DeviceType)
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gocraft/health"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk-pump/storage"
+)
+
+// analyticsSource is an additional key the analytics records are read from.
+type analyticsSource struct {
+	key   string
+	store storage.AnalyticsStorage
+}
+
+// AnalyticsSources are the sources of the analytics_sources configuration.
+var AnalyticsSources []analyticsSource
+
+// setupAnalyticsSources builds the analytics sources. The sources with their own storage config
+// get their own connection, the others read from AnalyticsStore.
+func setupAnalyticsSources() {
+	AnalyticsSources = nil
+	for _, sourceConf := range SystemConfig.AnalyticsSources {
+		if sourceConf.Key == "" {
+			log.WithFields(logrus.Fields{
+				"prefix": mainPrefix,
+			}).Error("Analytics source without key (skipping)")
+			continue
+		}
+
+		store := AnalyticsStore
+		if sourceConf.StorageConfig != nil {
+			sourceStore := &storage.RedisClusterStorageManager{Dedicated: true}
+			sourceStore.Init(*sourceConf.StorageConfig)
+			store = sourceStore
+		}
+		AnalyticsSources = append(AnalyticsSources, analyticsSource{key: sourceConf.Key, store: store})
+	}
+
+	if len(AnalyticsSources) > 0 {
+		log.WithFields(logrus.Fields{
+			"prefix": mainPrefix,
+		}).Info("Reading the analytics from ", len(AnalyticsSources), " additional sources")
+	}
+}
+
+// purgeAnalyticsKey reads the records of the key from store, in every serialization format, and
+// sends them to the pumps.
+func purgeAnalyticsKey(store storage.AnalyticsStorage, analyticsKeyName string, chunkSize int64, expire time.Duration, omitDetails bool, job *health.Job, startTime time.Time, secInterval int) {
+	for _, serializerMethod := range AnalyticsSerializers {
+		analyticsKeyName += serializerMethod.GetSuffix()
+		AnalyticsValues := store.GetAndDeleteSet(analyticsKeyName, chunkSize, expire)
+		if len(AnalyticsValues) > 0 {
+			processAnalyticsValues(AnalyticsValues, serializerMethod, analyticsKeyName, omitDetails, job, startTime, secInterval)
+		}
+	}
+}
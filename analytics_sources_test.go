@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/TykTechnologies/tyk-pump/pumps"
+	"github.com/TykTechnologies/tyk-pump/serializer"
+	"github.com/TykTechnologies/tyk-pump/storage"
+)
+
+// listsStore is an analytics storage holding lists of values in memory.
+type listsStore struct {
+	storage.RedisClusterStorageManager
+	lists map[string][]interface{}
+}
+
+func (s *listsStore) GetAndDeleteSet(setName string, chunkSize int64, expire time.Duration) []interface{} {
+	values := s.lists[setName]
+	delete(s.lists, setName)
+	return values
+}
+
+func TestPurgeAnalyticsSources(t *testing.T) {
+	msgpackSerializer := serializer.NewAnalyticsSerializer(serializer.MSGP_SERIALIZER)
+	defer func(serializers []serializer.AnalyticsSerializer) {
+		AnalyticsSerializers = serializers
+	}(AnalyticsSerializers)
+	AnalyticsSerializers = []serializer.AnalyticsSerializer{msgpackSerializer}
+
+	encode := func(apiID string) interface{} {
+		encoded, err := msgpackSerializer.Encode(&analytics.AnalyticsRecord{APIID: apiID})
+		assert.Nil(t, err)
+		return string(encoded)
+	}
+
+	// two keys of the same Redis, and one of another Redis
+	shared := &listsStore{lists: map[string][]interface{}{
+		"analytics-eu": {encode("api1"), encode("api2")},
+		"analytics-us": {encode("api3")},
+	}}
+	other := &listsStore{lists: map[string][]interface{}{
+		"analytics-eu": {encode("api4")},
+	}}
+	AnalyticsSources = []analyticsSource{
+		{key: "analytics-eu", store: shared},
+		{key: "analytics-us", store: shared},
+		{key: "analytics-eu", store: other},
+	}
+	defer func() {
+		AnalyticsSources = nil
+	}()
+
+	mockedPump := &MockedPump{}
+	Pumps = []pumps.Pump{mockedPump}
+	for _, source := range AnalyticsSources {
+		purgeAnalyticsKey(source.store, source.key, 0, time.Minute, false, instrument.NewJob("TestJob"), time.Now(), 2)
+	}
+
+	assert.Equal(t, 4, mockedPump.CounterRequest)
+	assert.Empty(t, shared.lists)
+	assert.Empty(t, other.lists)
+}
+
+func TestSetupAnalyticsSources(t *testing.T) {
+	defer func(store storage.AnalyticsStorage) {
+		AnalyticsStore = store
+		SystemConfig.AnalyticsSources = nil
+		AnalyticsSources = nil
+	}(AnalyticsStore)
+	AnalyticsStore = &storage.RedisClusterStorageManager{}
+	SystemConfig.AnalyticsSources = []AnalyticsSourceConf{
+		{Key: "analytics-eu"},
+		{Key: ""},
+		{Key: "analytics-us", StorageConfig: &storage.RedisStorageConfig{Host: "redis-us", Port: 6379, RedisKeyPrefix: "us-"}},
+	}
+	setupAnalyticsSources()
+
+	assert.Len(t, AnalyticsSources, 2)
+	assert.Equal(t, "analytics-eu", AnalyticsSources[0].key)
+	assert.Equal(t, AnalyticsStore, AnalyticsSources[0].store)
+
+	assert.Equal(t, "analytics-us", AnalyticsSources[1].key)
+	store, ok := AnalyticsSources[1].store.(*storage.RedisClusterStorageManager)
+	if assert.True(t, ok) {
+		assert.True(t, store.Dedicated)
+		assert.Equal(t, "redis-us", store.Config.Host)
+		assert.Equal(t, "us-", store.KeyPrefix)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gocraft/health"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+// batchSummaries accumulates the records of the purges, by the job of each purge, until their
+// summary is written. The purges of the purge loop and of the Kafka source run concurrently, each
+// with its own job.
+type batchSummaries struct {
+	mu        sync.Mutex
+	summaries map[*health.Job]*analytics.BatchSummary
+}
+
+var purgeSummaries = &batchSummaries{summaries: map[*health.Job]*analytics.BatchSummary{}}
+
+// add adds the records of keys to the summary of the purge of job.
+func (s *batchSummaries) add(job *health.Job, keys []interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary, ok := s.summaries[job]
+	if !ok {
+		summary = &analytics.BatchSummary{}
+		s.summaries[job] = summary
+	}
+	summary.Add(keys)
+}
+
+// take removes and returns the summary of the purge of job, or nil if it has none.
+func (s *batchSummaries) take(job *health.Job) *analytics.BatchSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary := s.summaries[job]
+	delete(s.summaries, job)
+	return summary
+}
+
+// writeBatchSummary writes the summary of the records of the purge of job to the
+// BatchSummaryPumps. The purges without records have no summary.
+func writeBatchSummary(job *health.Job, startTime time.Time, secInterval int) {
+	summary := purgeSummaries.take(job)
+	if summary == nil || summary.Records() == 0 {
+		return
+	}
+	job.Event("batch_summary")
+	writeToSelectedPumps(BatchSummaryPumps, []interface{}{summary.Record(time.Now())}, job, startTime, secInterval)
+}
+
+// processBatchSummary writes the summary of the purge of job once its records are processed,
+// through the Dispatcher if it's set, or right away otherwise.
+func processBatchSummary(job *health.Job, startTime time.Time, secInterval int) {
+	if Dispatcher == nil {
+		writeBatchSummary(job, startTime, secInterval)
+		return
+	}
+
+	Dispatcher.dispatch(analyticsBatch{
+		job:          job,
+		startTime:    startTime,
+		secInterval:  secInterval,
+		batchSummary: true,
+	})
+}
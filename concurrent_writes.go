@@ -0,0 +1,115 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gocraft/health"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk-pump/pumps"
+)
+
+const defaultConcurrentWritesQueueSize = 10
+
+// pumpBatch is a batch of records queued for a pump.
+type pumpBatch struct {
+	keys       []interface{}
+	purgeDelay int
+	startTime  time.Time
+	job        *health.Job
+}
+
+// concurrentWriter writes the batches to each pump from its own queue, so a slow pump only delays
+// its own batches. A pump writes a single batch at a time, and the workers bound the writes in
+// flight across the pumps.
+type concurrentWriter struct {
+	queues  map[pumps.Pump]chan pumpBatch
+	workers chan struct{}
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// ConcurrentWriter is the writer of the batches, set when concurrent_writes is enabled.
+var ConcurrentWriter *concurrentWriter
+
+// setupConcurrentWrites starts the ConcurrentWriter of the pumps if concurrent_writes is enabled.
+func setupConcurrentWrites() {
+	conf := SystemConfig.ConcurrentWrites
+	if !conf.Enabled {
+		return
+	}
+
+	ConcurrentWriter = newConcurrentWriter(Pumps, conf.Workers, conf.QueueSize)
+	log.WithFields(logrus.Fields{
+		"prefix": mainPrefix,
+	}).Infof("Concurrent writes enabled, %d workers", cap(ConcurrentWriter.workers))
+}
+
+// newConcurrentWriter returns a started writer of pmps. workers and queueSize default to the
+// number of pumps and 10.
+func newConcurrentWriter(pmps []pumps.Pump, workers, queueSize int) *concurrentWriter {
+	if workers <= 0 {
+		workers = len(pmps)
+	}
+	if queueSize <= 0 {
+		queueSize = defaultConcurrentWritesQueueSize
+	}
+
+	w := &concurrentWriter{
+		queues:  make(map[pumps.Pump]chan pumpBatch, len(pmps)),
+		workers: make(chan struct{}, workers),
+	}
+	for _, pmp := range pmps {
+		queue := make(chan pumpBatch, queueSize)
+		w.queues[pmp] = queue
+		w.wg.Add(1)
+		go w.run(pmp, queue)
+	}
+	return w
+}
+
+func (w *concurrentWriter) run(pmp pumps.Pump, queue chan pumpBatch) {
+	defer w.wg.Done()
+	for batch := range queue {
+		w.workers <- struct{}{}
+		var wg sync.WaitGroup
+		wg.Add(1)
+		execPumpWriting(&wg, pmp, &batch.keys, batch.purgeDelay, batch.startTime, batch.job, pumps.AcquireGoroutine())
+		<-w.workers
+	}
+}
+
+// write queues the batch for the pump without waiting for it to be written. If the queue of the
+// pump is full, it waits for a free slot, holding the next batches back. It must be called with
+// writeMu held.
+func (w *concurrentWriter) write(pmp pumps.Pump, batch pumpBatch) {
+	queue := w.queues[pmp]
+	select {
+	case queue <- batch:
+		return
+	default:
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix": mainPrefix,
+	}).Warning("The queue of ", pmp.GetName(), " is full, waiting for it to write its queued batches")
+	if batch.job != nil {
+		batch.job.Event("pump_queue_full")
+	}
+	queue <- batch
+}
+
+// close stops accepting batches and waits until the queued ones are written. The batches written
+// afterwards are written synchronously.
+func (w *concurrentWriter) close() {
+	writeMu.Lock()
+	if !w.closed {
+		w.closed = true
+		for _, queue := range w.queues {
+			close(queue)
+		}
+	}
+	writeMu.Unlock()
+	w.wg.Wait()
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/TykTechnologies/tyk-pump/pumps"
+)
+
+// SlowPump takes delay to write every batch, and keeps track of its writes in flight.
+type SlowPump struct {
+	name     string
+	delay    time.Duration
+	inFlight *int32
+	maxSeen  *int32
+	writes   int32
+	pumps.CommonPumpConfig
+}
+
+func (p *SlowPump) GetName() string {
+	return p.name
+}
+
+func (p *SlowPump) New() pumps.Pump {
+	return &SlowPump{}
+}
+
+func (p *SlowPump) Init(config interface{}) error {
+	return nil
+}
+
+func (p *SlowPump) WriteData(ctx context.Context, keys []interface{}) error {
+	inFlight := atomic.AddInt32(p.inFlight, 1)
+	for {
+		maxSeen := atomic.LoadInt32(p.maxSeen)
+		if inFlight <= maxSeen || atomic.CompareAndSwapInt32(p.maxSeen, maxSeen, inFlight) {
+			break
+		}
+	}
+	time.Sleep(p.delay)
+	atomic.AddInt32(p.inFlight, -1)
+	atomic.AddInt32(&p.writes, 1)
+	return nil
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	fastPump := &RecordingPump{}
+	slowPump := &BlockingPump{release: make(chan struct{})}
+	Pumps = []pumps.Pump{fastPump, slowPump}
+	ConcurrentWriter = newConcurrentWriter(Pumps, 0, 2)
+	defer func() {
+		ConcurrentWriter = nil
+	}()
+
+	keys := []interface{}{analytics.AnalyticsRecord{APIID: "api1"}}
+	write := func() chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			writeToPumps(keys, instrument.NewJob("TestJob"), time.Now(), 2)
+		}()
+		return done
+	}
+
+	fastRecords := func() int {
+		fastPump.mu.Lock()
+		defer fastPump.mu.Unlock()
+		return len(fastPump.Records)
+	}
+	for i := 0; i < 3; i++ {
+		// the batches are queued, without waiting for the slow pump
+		select {
+		case <-write():
+		case <-time.After(time.Second):
+			t.Fatal("the writes were blocked by the slow pump")
+		}
+
+		// the fast pump isn't blocked by the slow one
+		assert.Eventually(t, func() bool {
+			return fastRecords() == i+1
+		}, time.Second, 5*time.Millisecond)
+		if i == 0 {
+			// the slow pump is writing the first batch
+			assert.Eventually(t, func() bool {
+				return len(ConcurrentWriter.queues[slowPump]) == 0
+			}, time.Second, 5*time.Millisecond)
+		}
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&slowPump.writes))
+
+	// the slow pump writes one batch and queues two, the next one waits for a free slot
+	done := write()
+	select {
+	case <-done:
+		t.Fatal("the batch was sent to a full queue")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(slowPump.release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the batch wasn't queued once the slow pump freed a slot")
+	}
+
+	// the queued batches are written on close
+	ConcurrentWriter.close()
+	assert.Equal(t, int32(4), atomic.LoadInt32(&slowPump.writes))
+
+	// once closed, the batches are written synchronously
+	writeToPumps(keys, instrument.NewJob("TestJob"), time.Now(), 2)
+	assert.Equal(t, int32(5), atomic.LoadInt32(&slowPump.writes))
+}
+
+func TestConcurrentWritesWorkers(t *testing.T) {
+	var inFlight, maxSeen int32
+	Pumps = []pumps.Pump{}
+	for _, name := range []string{"slow1", "slow2", "slow3"} {
+		Pumps = append(Pumps, &SlowPump{name: name, delay: 20 * time.Millisecond, inFlight: &inFlight, maxSeen: &maxSeen})
+	}
+	ConcurrentWriter = newConcurrentWriter(Pumps, 2, 0)
+	defer func() {
+		ConcurrentWriter = nil
+	}()
+
+	keys := []interface{}{analytics.AnalyticsRecord{APIID: "api1"}}
+	for i := 0; i < 3; i++ {
+		writeToPumps(keys, instrument.NewJob("TestJob"), time.Now(), 2)
+	}
+	ConcurrentWriter.close()
+
+	// every batch is written, with no more than 2 writes in flight
+	for _, pmp := range Pumps {
+		assert.Equal(t, int32(3), atomic.LoadInt32(&pmp.(*SlowPump).writes))
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxSeen))
+}
+
+func TestWriteToPumpsMaxGoroutines(t *testing.T) {
+	pumps.SetMaxGoroutines(3)
+	defer pumps.SetMaxGoroutines(0)
+
+	var inFlight, maxSeen int32
+	slowPumps := make([]*SlowPump, 10)
+	Pumps = nil
+	for i := range slowPumps {
+		slowPumps[i] = &SlowPump{name: "slow", delay: 20 * time.Millisecond, inFlight: &inFlight, maxSeen: &maxSeen}
+		Pumps = append(Pumps, slowPumps[i])
+	}
+	defer func() {
+		Pumps = nil
+	}()
+
+	writeToPumps([]interface{}{analytics.AnalyticsRecord{APIID: "api1"}}, instrument.NewJob("TestJob"), time.Now(), 10)
+
+	for _, pmp := range slowPumps {
+		assert.Equal(t, int32(1), atomic.LoadInt32(&pmp.writes))
+	}
+	// the 3 goroutines, and the purge loop writing once they're all busy
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxSeen), int32(4))
+	// the slots are released once the goroutines return
+	assert.Eventually(t, func() bool {
+		return pumps.ActiveGoroutines() == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestWriteToPumpsMaxGoroutinesTimeout(t *testing.T) {
+	pumps.SetMaxGoroutines(1)
+	defer pumps.SetMaxGoroutines(0)
+
+	var inFlight, maxSeen int32
+	slowPump := &SlowPump{name: "slow", delay: 1500 * time.Millisecond, inFlight: &inFlight, maxSeen: &maxSeen}
+	slowPump.SetTimeout(1)
+	Pumps = []pumps.Pump{slowPump}
+	defer func() {
+		Pumps = nil
+	}()
+
+	writeToPumps([]interface{}{analytics.AnalyticsRecord{APIID: "api1"}}, instrument.NewJob("TestJob"), time.Now(), 10)
+
+	// the write timed out, but the slot is held until WriteData returns
+	assert.Equal(t, 1, pumps.ActiveGoroutines())
+	assert.Eventually(t, func() bool {
+		return pumps.ActiveGoroutines() == 0
+	}, 2*time.Second, time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&slowPump.writes))
+}
+
+func TestConcurrentWritesMaxGoroutines(t *testing.T) {
+	pumps.SetMaxGoroutines(1)
+	defer pumps.SetMaxGoroutines(0)
+
+	var inFlight, maxSeen int32
+	Pumps = []pumps.Pump{}
+	for _, name := range []string{"slow1", "slow2", "slow3"} {
+		Pumps = append(Pumps, &SlowPump{name: name, delay: 20 * time.Millisecond, inFlight: &inFlight, maxSeen: &maxSeen})
+	}
+	ConcurrentWriter = newConcurrentWriter(Pumps, 3, 0)
+	defer func() {
+		ConcurrentWriter = nil
+		Pumps = nil
+	}()
+
+	keys := []interface{}{analytics.AnalyticsRecord{APIID: "api1"}}
+	for i := 0; i < 3; i++ {
+		writeToPumps(keys, instrument.NewJob("TestJob"), time.Now(), 2)
+	}
+	ConcurrentWriter.close()
+
+	// the workers share the goroutine slots with the other writes
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxSeen))
+}
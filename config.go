@@ -100,6 +100,11 @@ type PumpConfig struct {
 	// The field names must be the same as the JSON tags of the analytics record fields.
 	// For example: `["api_key", "api_version"]`.
 	IgnoreFields []string `json:"ignore_fields"`
+	// Fields defines an allow list of analytics fields written to the pump. The rest of the fields
+	// are set to their zero value, which reduces the payload sent to sinks that only need a subset
+	// of the fields. The field names must be the same as the JSON tags of the analytics record
+	// fields. For example: `["api_id", "response_code", "timestamp"]`.
+	Fields []string `json:"fields"`
 	// Meta is a map of configuration values that are specific to each pump. For example, the
 	// `csv` pump requires a `csv_dir` value to be set, that need to be set in the `meta` map.
 	Meta map[string]interface{} `json:"meta"`
@@ -107,6 +112,95 @@ type PumpConfig struct {
 	DecodeRawRequest bool `json:"raw_request_decoded"`
 	// Setting this to true allows the Raw Response to be decoded from base 64 for all pumps. This is set to false by default.
 	DecodeRawResponse bool `json:"raw_response_decoded"`
+	// Defines an allow list of API IDs whose records keep their raw_request and raw_response
+	// fields. The records of any other API have them removed. This can also be set globally,
+	// and the pump level value takes precedence. For example:
+	// ```{.json}
+	// "csv": {
+	//   "type": "csv",
+	//   "detailed_recording_api_ids": ["api1","api2"],
+	//   "meta": {
+	//     "csv_dir": "./"
+	//   }
+	// }
+	// ```
+	DetailedRecordingAPIIDs []string `json:"detailed_recording_api_ids"`
+	// Logs one of every `log_sample_rate` records successfully written by the pump, at debug
+	// level. This is useful to check what a pump is writing without logging every record. 0,
+	// the default, disables the sampling.
+	LogSampleRate int `json:"log_sample_rate"`
+	// Collapses the runs of identical consecutive records, made within `collapse_window` seconds
+	// of the first record of the run, into that first record. Its `occurrence_count` field is set to the
+	// number of records it represents, 1 for the records that aren't collapsed. This reduces the
+	// volume written for clients sending bursts of identical requests. The records are identical
+	// when they have the same method, host, path, response code, API, key, IP address and user
+	// agent. 0, the default, disables the collapsing.
+	CollapseWindow int `json:"collapse_window"`
+	// Setting this to true sorts each batch of records by timestamp, oldest first, before it's
+	// written to the pump, for the sinks which expect the records in order, like event logs. The
+	// records with the same timestamp keep their order. Defaults to `false`.
+	SortByTimestamp bool `json:"sort_by_timestamp"`
+	// Writes one of every `rate` records to the pump, to reduce the volume of sinks which don't
+	// need all the traffic. With `keep_errors`, the records with an error response code, 400 or
+	// above, are all written and only the successes are sampled. The sampled out records are
+	// counted as dropped with the `sampled` reason. For example:
+	// ```{.json}
+	// "sampling": {
+	//   "rate": 10,
+	//   "keep_errors": true
+	// }
+	// ```
+	Sampling pumps.SamplingConf `json:"sampling"`
+	// Samples the logs of the failed writes of the pump, so a backend rejecting the data doesn't
+	// flood the logs with identical errors. The first `first` occurrences of each error are
+	// logged, and always its first one, then one of every `every`, with the number of identical
+	// errors suppressed since the last one logged. Past 100 distinct messages, the new ones are
+	// sampled together as `other errors`. The remaining suppressed count is logged once the pump
+	// writes successfully again, which restarts the sampling. Defaults to logging every error.
+	// For example:
+	// ```{.json}
+	// "error_log_sampling": {
+	//   "first": 5,
+	//   "every": 100
+	// }
+	// ```
+	ErrorLogSampling pumps.ErrorLogSamplingConf `json:"error_log_sampling"`
+	// Sets the `processed_by` field of the records written to the pump to its name in `pumps`,
+	// e.g. `csv`, to know which pump processed a record in a setup with multiple sinks. Each pump
+	// gets its own copy of the records, so the other pumps aren't affected. Defaults to `false`.
+	ProcessedBy bool `json:"processed_by"`
+	// The number of times the initialisation of the pump is retried when it fails, e.g. because its
+	// backend isn't reachable yet when the pump starts. Defaults to 0, the pump is skipped on the
+	// first failure.
+	InitRetries int `json:"init_retries"`
+	// The number of seconds between the retries of the initialisation. Defaults to 5.
+	InitRetryInterval int `json:"init_retry_interval"`
+	// The keys, in `pumps`, of the pumps this pump depends on. They're initialised before it, and
+	// the pump is skipped if any of them isn't configured or fails to initialise. E.g.
+	// `["mongo"]` for a `mongo-pump-aggregate` pump sharing the database of the `mongo` pump.
+	// Cyclic dependencies are a configuration error.
+	DependsOn []string `json:"depends_on"`
+	// Buffers on disk the batches the pump fails to write, e.g. while its backend is unreachable,
+	// and forwards them in order once it's reachable again. For example:
+	// ```{.json}
+	// "disk_buffer": {
+	//   "path": "/var/lib/tyk-pump/buffer/elasticsearch",
+	//   "max_size_bytes": 1073741824,
+	//   "drain_interval": 10
+	// }
+	// ```
+	DiskBuffer pumps.DiskBufferConf `json:"disk_buffer"`
+	// Buffers in memory the records of the batches written to an aggregate pump, and writes them
+	// as a single batch every `flush_interval` seconds, merging the updates of the same buckets.
+	// The buffered records are written on shutdown. Only the aggregate pumps support it, the other
+	// pumps configured with it are skipped. For example:
+	// ```{.json}
+	// "aggregate_buffer": {
+	//   "flush_interval": 60,
+	//   "max_records": 100000
+	// }
+	// ```
+	AggregateBuffer pumps.AggregateBufferConf `json:"aggregate_buffer"`
 }
 
 type UptimeConf struct {
@@ -150,6 +244,212 @@ type UptimeConf struct {
 	UptimeType string `json:"uptime_type"`
 }
 
+type RawDataEncryptionConf struct {
+	// The base64 encoded AES key used to encrypt the raw data. It must decode to 16, 24 or 32 bytes
+	// to select AES-128, AES-192 or AES-256. Setting it enables the encryption.
+	Key string `json:"key"`
+	// The id of the key, stored alongside the encrypted data so readers can pick the right key
+	// after a rotation. It can't contain `:`.
+	KeyID string `json:"key_id"`
+}
+
+type BotDetectionConf struct {
+	// Setting this to true sets the `is_bot` field of the records whose user agent matches any of
+	// `user_agents` or `user_agent_patterns`.
+	Enabled bool `json:"enabled"`
+	// Case insensitive substrings of the user agents of bots. E.g. "googlebot". When neither this
+	// nor `user_agent_patterns` is set, a default list of common bots and crawlers is used.
+	UserAgents []string `json:"user_agents"`
+	// Regular expressions matching the user agents of bots. E.g. `^Synthetic-\d+$`.
+	UserAgentPatterns []string `json:"user_agent_patterns"`
+}
+
+type RequestBodyTagsConf struct {
+	// The tags to add, mapped to the JSONPath of their value in the request body. E.g.
+	// `{"tenant_id": "$.tenant.id"}` tags the records with `tenant_id:<value>`. Paths are made of
+	// keys and array indexes, e.g. `$.items[0].sku`. Setting it enables the extraction.
+	Fields map[string]string `json:"fields"`
+	// The size, in bytes, above which request bodies aren't parsed. Defaults to 65536.
+	MaxBodySize int `json:"max_body_size"`
+}
+
+type PIIDetectionConf struct {
+	// Setting this to true sets the `contains_pii` and `pii_categories` fields of the records
+	// whose request body matches any of `patterns`.
+	Enabled bool `json:"enabled"`
+	// The regular expressions of the PII, keyed by their category. E.g.
+	// `{"iban": "\\b[A-Z]{2}\\d{2}[A-Z0-9]{11,30}\\b"}`. Defaults to the `email`, `credit_card`
+	// and `ssn` categories.
+	Patterns map[string]string `json:"patterns"`
+	// The number of bytes of the request bodies scanned. Defaults to 65536.
+	MaxBodySize int `json:"max_body_size"`
+}
+
+type TLSInfoConf struct {
+	// Setting this to true populates the `tls_version` and `tls_cipher` fields.
+	Enabled bool `json:"enabled"`
+	// The key of the tag holding the TLS version, read as `key:value` or `key-value`. Defaults to
+	// `tls_version`.
+	VersionTag string `json:"version_tag"`
+	// The key of the tag holding the TLS cipher. Defaults to `tls_cipher`.
+	CipherTag string `json:"cipher_tag"`
+	// The raw request header holding the TLS version, read when the tag is missing. E.g.
+	// `X-SSL-Protocol`, set by a TLS terminating load balancer.
+	VersionHeader string `json:"version_header"`
+	// The raw request header holding the TLS cipher, read when the tag is missing. E.g.
+	// `X-SSL-Cipher`.
+	CipherHeader string `json:"cipher_header"`
+}
+
+type LatencyPhasesConf struct {
+	// Setting this to true populates the `latency_dns`, `latency_connect` and `latency_tls`
+	// fields.
+	Enabled bool `json:"enabled"`
+	// The key of the tag holding the DNS lookup time in milliseconds, read as `key:value` or
+	// `key-value`. Defaults to `latency_dns`.
+	DNSTag string `json:"dns_tag"`
+	// The key of the tag holding the connection time in milliseconds. Defaults to
+	// `latency_connect`.
+	ConnectTag string `json:"connect_tag"`
+	// The key of the tag holding the TLS handshake time in milliseconds. Defaults to
+	// `latency_tls`.
+	TLSTag string `json:"tls_tag"`
+}
+
+type CacheStatusConf struct {
+	// Setting this to true populates the `cache_status` field of the records.
+	Enabled bool `json:"enabled"`
+	// The response headers holding the cache status, checked in order. Defaults to
+	// `["X-Tyk-Cached-Response", "X-Cache-Status", "X-Cache", "CF-Cache-Status"]`.
+	Headers []string `json:"headers"`
+}
+
+type CorrelationIDConf struct {
+	// The headers holding the correlation id, checked in order in the raw request and then in the
+	// raw response. E.g. `X-Correlation-ID`. Setting it enables the extraction.
+	Headers []string `json:"headers"`
+}
+
+type JWTClaimsConf struct {
+	// Setting this to true populates the `jwt_subject` field, and the tags of `claims`, from the
+	// JWT of the raw request.
+	Enabled bool `json:"enabled"`
+	// The raw request header holding the JWT, with or without the `Bearer ` prefix. Defaults to
+	// `Authorization`.
+	Header string `json:"header"`
+	// The claim populating the `jwt_subject` field. Defaults to `sub`.
+	SubjectClaim string `json:"subject_claim"`
+	// The claims added as `<claim>:<value>` tags. E.g. `["scope", "tenant"]`.
+	Claims []string `json:"claims"`
+}
+
+type EndpointConf struct {
+	// Setting this to true populates the `endpoint` field of the records.
+	Enabled bool `json:"enabled"`
+	// The prefix of the tag holding the matched endpoint. Defaults to `endpoint:`.
+	TagPrefix string `json:"tag_prefix"`
+}
+
+type NodeIDConf struct {
+	// Setting this to true populates the `node_id` field of the records.
+	Enabled bool `json:"enabled"`
+	// The prefix of the tag holding the id of the gateway node. Defaults to `node:`.
+	TagPrefix string `json:"tag_prefix"`
+}
+
+type TagMapConf struct {
+	// Setting this to true moves the `key:value` tags of the records into their `tag_map` field.
+	Enabled bool `json:"enabled"`
+	// The keys of the tags moved into the map. Defaults to all the `key:value` tags.
+	Keys []string `json:"keys"`
+	// Keeps the moved tags in the `tags` field too, so the `tags` aggregation, the pumps reading
+	// the tags, e.g. the SQL `tag_columns`, and the pumps without a map still find them. Setting
+	// this to false removes them from `tags`. Defaults to `true`.
+	KeepTags *bool `json:"keep_tags"`
+}
+
+// keepTags reports whether the moved tags are kept in the `tags` field, true unless KeepTags is
+// set to false.
+func (c TagMapConf) keepTags() bool {
+	return c.KeepTags == nil || *c.KeepTags
+}
+
+type KeyHashingConf struct {
+	// Setting this to true replaces the `api_key` and `oauth_id` of the records with a token before
+	// they're sent to the pumps.
+	Enabled bool `json:"enabled"`
+	// The hashing algorithm: `hmac-sha256` (the default), `sha256` or `sha512`.
+	Algorithm string `json:"algorithm"`
+	// The salt of the hash, or the key of the HMAC. Keep it secret and don't change it, otherwise
+	// the tokens of the same key won't match anymore.
+	Salt string `json:"salt"`
+	// The names of the pumps, as set in `pumps`, which receive the keys unhashed. E.g. internal
+	// sinks which need the original keys.
+	BypassPumps []string `json:"bypass_pumps"`
+}
+
+type FilterRouteConf struct {
+	// The records matching these filters are sent, all of them, to `full_pump`. They have the same
+	// structure as the `filters` of the pumps.
+	Filters analytics.AnalyticsFilters `json:"filters"`
+	// The name of the pump, as set in `pumps`, receiving the records matching `filters`.
+	FullPump string `json:"full_pump"`
+	// The name of the pump, as set in `pumps`, receiving a sample of the other records.
+	SampledPump string `json:"sampled_pump"`
+	// The sampled pump receives one of every `sample_rate` records not matching `filters`.
+	// Defaults to 1, all of them.
+	SampleRate int `json:"sample_rate"`
+}
+
+type GraphQLVariablesConf struct {
+	// The size, in bytes, the decoded variables are truncated to. 0, the default, means no limit.
+	// Truncated variables are usually not valid JSON anymore.
+	MaxSize int `json:"max_size"`
+	// The names of the variables, or of the fields of their input objects, whose values are
+	// replaced with `[REDACTED]`. They're case insensitive and redacted before the truncation.
+	RedactedNames []string `json:"redacted_names"`
+}
+
+type ConcurrentWritesConf struct {
+	// Enables the concurrent writes.
+	Enabled bool `json:"enabled"`
+	// The maximum number of batches written at the same time, across the pumps. Defaults to the
+	// number of pumps.
+	Workers int `json:"workers"`
+	// The number of batches queued per pump while it writes the previous ones. When the queue of a
+	// pump is full, the next batches wait for it to free up. Defaults to 10.
+	QueueSize int `json:"queue_size"`
+}
+
+type KafkaSourceConf struct {
+	// The list of brokers used to discover the partitions of the topic. E.g. "localhost:9092".
+	// Setting it, along with `topic`, enables the source.
+	Brokers []string `json:"brokers"`
+	// The topic the analytics records are consumed from.
+	Topic string `json:"topic"`
+	// The consumer group of the pump. Offsets are committed to the group once the records were
+	// sent to the pumps. Defaults to `tyk-pump`.
+	GroupID string `json:"group_id"`
+	// Where a consumer group without committed offsets starts consuming: `first` (the oldest
+	// offset) or `last` (only new messages). Defaults to `first`.
+	StartOffset string `json:"start_offset"`
+	// The serialization format of the messages: `msgpack` or `protobuf`. Defaults to `msgpack`.
+	Format string `json:"format"`
+	// The maximum number of records sent to the pumps at a time. Defaults to `1000`. A batch is
+	// also sent every `purge_delay` seconds, even if it isn't full.
+	BatchSize int `json:"batch_size"`
+}
+
+type AnalyticsSourceConf struct {
+	// The Redis key the analytics records are read from, without the key prefix of its storage.
+	// E.g. `tyk-system-analytics-eu`.
+	Key string `json:"key"`
+	// The Redis connection of the key, with the same structure as `analytics_storage_config`. The
+	// Redis environment variables don't apply to it. Defaults to the connection of
+	// `analytics_storage_config`.
+	StorageConfig *storage.RedisStorageConfig `json:"storage_config"`
+}
+
 type TykPumpConfiguration struct {
 	// The number of seconds the Pump waits between checking for analytics data and purge it from
 	// Redis.
@@ -161,6 +461,43 @@ type TykPumpConfiguration struct {
 	// The number of seconds for the analytics records TTL. It only works if `purge_chunk` is
 	// enabled. Defaults to `60` seconds.
 	StorageExpirationTime int64 `json:"storage_expiration_time"`
+	// The number of chunks of analytics records, read from the analytics storage, buffered while
+	// the pumps write the previous ones. Reading from the storage pauses while the buffer is full,
+	// so a slow pump throttles the reads instead of growing the memory. 0, the default, writes
+	// each chunk before reading the next one.
+	ProcessingBufferSize int `json:"processing_buffer_size"`
+	// Writes the batches to each pump from its own queue, so a slow pump doesn't delay the writes
+	// of the others. By default, every batch is written to all the pumps before the next one.
+	// ```{.json}
+	// "concurrent_writes": {
+	//   "enabled": true,
+	//   "workers": 4,
+	//   "queue_size": 10
+	// }
+	// ```
+	ConcurrentWrites ConcurrentWritesConf `json:"concurrent_writes"`
+	// The maximum number of goroutines writing to the pumps at a time, shared by all the pumps:
+	// the writes of each chunk to the pumps, including the Kafka source and the workers of
+	// `concurrent_writes`, the concurrent inserts of the Mongo pumps, and the background writes of
+	// `disk_buffer` and `s3-parquet`. A write holds its goroutine until the pump returns, even past
+	// its timeout. When the limit is reached, the writes of the chunks run in the goroutine
+	// dispatching them instead, and the workers and background writes wait, so the goroutines stay
+	// bounded regardless of the number of pumps. 0, the default, doesn't limit them.
+	MaxGoroutines int `json:"max_goroutines"`
+	// Runs the whole processing of the records, the filters, the enrichments and the sampling of
+	// the pumps, but logs the number of records each pump would write instead of writing them.
+	// Useful to try new filters or configurations. The records are still read, and removed, from
+	// the analytics storage. The pumps are still initialised, so they connect to their backends and
+	// may create their tables, indexes or topics, but the disk buffers of the pumps aren't opened,
+	// so their buffered batches aren't forwarded. Defaults to false.
+	DryRun bool `json:"dry_run"`
+	// The names of the pumps, as set in `pumps`, which receive a synthetic record summarising the
+	// records of each purge, tagged `batch_summary`, with the number of records and their number
+	// for each response code as `batch_records:<n>` and `batch_response_code_<code>:<n>` tags, and
+	// their total request time and latency. The summary is written once the records of the purge
+	// are written, and the other pumps don't receive it. Keep the other records away from a
+	// monitoring sink with the `only_batch_summary` filter.
+	BatchSummaryPumps []string `json:"batch_summary_pumps"`
 	// Setting this to `false` will create a pump that pushes uptime data to Uptime Pump, so the
 	// Dashboard can read it. Disable by setting to `true`.
 	DontPurgeUptimeData bool       `json:"dont_purge_uptime_data"`
@@ -193,6 +530,17 @@ type TykPumpConfiguration struct {
 	//   },
 	// ```
 	AnalyticsStorageConfig storage.RedisStorageConfig `json:"analytics_storage_config"`
+	// Additional Redis keys the analytics records are read from, for the deployments sharding
+	// their analytics across several keys or Redis instances. Each purge reads the keys in turn,
+	// after the keys of the Tyk Gateway, and their records go through the same processing. For
+	// example:
+	// ```{.json}
+	//   "analytics_sources": [
+	//     {"key": "tyk-system-analytics-eu"},
+	//     {"key": "tyk-system-analytics", "storage_config": {"host": "redis-us", "port": 6379}}
+	//   ],
+	// ```
+	AnalyticsSources []AnalyticsSourceConf `json:"analytics_sources"`
 	// Connection string for StatsD monitoring for information please see the
 	// [Instrumentation docs](https://tyk.io/docs/basic-config-and-security/report-monitor-trigger-events/instrumentation/).
 	StatsdConnectionString string `json:"statsd_connection_string"`
@@ -202,7 +550,9 @@ type TykPumpConfiguration struct {
 	// `warn`. By default, the log level is `info`.
 	LogLevel string `json:"log_level"`
 	// Set the logger format. The possible values are: `text` and `json`. By default, the log
-	// format is `text`.
+	// format is `text`. With `json` each log entry is a JSON object with the `time`, `level`, `msg`
+	// and `prefix` keys. The entries of the writes to the pumps also have the `pump` name, the
+	// `batch_size`, the `duration` of the write in milliseconds and the `error`, if any.
 	LogFormat string `json:"log_format"`
 	// TYKCONFIGHEADERSTART
 	// HEADER Health Check
@@ -217,6 +567,16 @@ type TykPumpConfiguration struct {
 	// Setting this to true will avoid writing raw_request and raw_response fields for each request
 	// in pumps. Defaults to false.
 	OmitDetailedRecording bool `json:"omit_detailed_recording"`
+	// The share of the records of each org, by org id, which keep their raw_request and
+	// raw_response fields, from 0 (none) to 1 (all), so high volume orgs can keep a small sample of
+	// the bodies. The records of the orgs not listed keep them. For example:
+	// ```{.json}
+	// "detailed_recording_rates": {
+	//   "5e9d9544a1dcd60001d0ed20": 0.01,
+	//   "5e9d9544a1dcd60001d0ed21": 0
+	// }
+	// ```
+	DetailedRecordingRates map[string]float64 `json:"detailed_recording_rates"`
 	// Defines maximum size (in bytes) for Raw Request and Raw Response logs, this value defaults
 	// to 0. If it is not set then tyk-pump will not trim any data and will store the full
 	// information. This can also be set at a pump level. For example:
@@ -234,6 +594,12 @@ type TykPumpConfiguration struct {
 	OmitConfigFile bool `json:"omit_config_file"`
 	// Enable debugging of Tyk Pump by exposing profiling information, the same as the gateway https://tyk.io/docs/troubleshooting/tyk-gateway/profiling/
 	HTTPProfile bool `json:"enable_http_profiler"`
+	// Setting this enables the `/loglevel` endpoint on the health check port, to read (`GET`) and
+	// change (`PUT`) the log level at runtime, without a restart. The requests must have this
+	// secret in their `X-Tyk-Authorization` header. The body of the `PUT` requests is the new
+	// `level`, and optionally the `duration` after which the previous level is restored, e.g.
+	// `{"level": "debug", "duration": "10m"}`.
+	LogLevelSecret string `json:"log_level_secret"`
 
 	// Setting this to true allows the Raw Request to be decoded from base 64
 	// for all pumps. This is set to false by default.
@@ -241,6 +607,314 @@ type TykPumpConfiguration struct {
 
 	// Setting this to true allows the Raw Response to be decoded from base 64 for all pumps. This is set to false by default.
 	DecodeRawResponse bool `json:"raw_response_decoded"`
+
+	// The maximum number of seconds the Pump waits for a graceful shutdown, once a SIGINT or
+	// SIGTERM is received. The window covers the last writes of the Kafka source and heartbeat,
+	// the buffered and queued batches, and the shutdown of the pumps. Pumps that haven't finished
+	// their in-flight writes and shutdown within this window are abandoned and the process exits.
+	// Their unflushed records are lost, as there's no dead-letter sink to send them to. Defaults
+	// to `0`, which means that the Pump waits forever.
+	ShutdownTimeout int `json:"shutdown_timeout"`
+
+	// Defines an allow list of API IDs whose records keep their raw_request and raw_response
+	// fields in all pumps. The records of any other API have them removed. This can also be set
+	// at a pump level.
+	DetailedRecordingAPIIDs []string `json:"detailed_recording_api_ids"`
+
+	// Setting this to true populates the `method` and `path` fields from the request line of the
+	// raw request, when the gateway didn't set them. Defaults to `false`.
+	BackfillRequestLine bool `json:"backfill_request_line"`
+
+	// Setting this to true populates the flat `latency_total`, `latency_upstream` and
+	// `latency_gateway` fields from the nested `latency` field, for sinks that prefer flat
+	// schemas. `latency_gateway` is the time spent in the gateway (total - upstream). Defaults to
+	// `false`.
+	LatencyBreakdown bool `json:"latency_breakdown"`
+
+	// Setting this to true populates the `response_content_length` field from the
+	// `Content-Length` header of the raw response, so the request (`content_length`) and
+	// response sizes can be queried separately. Records without a raw response, or whose raw
+	// response has no `Content-Length` header, are left untouched. Defaults to `false`.
+	ResponseContentLength bool `json:"response_content_length"`
+
+	// Setting this to true populates the `response_content_type` field with the media type of the
+	// `Content-Type` header of the raw response, without its parameters, e.g. `application/json`
+	// for `application/json; charset=utf-8`. Records without a raw response, or whose raw
+	// response has no valid `Content-Type` header, are left untouched. Defaults to `false`.
+	ResponseContentType bool `json:"response_content_type"`
+
+	// Populates the `cache_status` field of the records with `hit`, `miss` or `bypass`, read from
+	// the cache header of the raw response set by the gateway or a caching proxy, e.g.
+	// `X-Cache-Status: HIT`. The gateway only sets `X-Tyk-Cached-Response` on its hits, so the
+	// responses without it, and without another known cache header, are misses. The other records
+	// without a raw response, or whose cache header is missing or unknown, are left untouched.
+	// For example:
+	// ```{.json}
+	// "cache_status": {
+	//   "enabled": true,
+	//   "headers": ["X-Tyk-Cached-Response", "X-Cache"]
+	// }
+	// ```
+	CacheStatus CacheStatusConf `json:"cache_status"`
+
+	// Setting this to true populates the `scheme` and `port` fields from the host and the raw
+	// request of the records. The scheme is read from the host, the raw request line or its
+	// `X-Forwarded-Proto` header, and otherwise derived from the TLS version and the port. Hosts
+	// without an explicit port get the default port of the scheme. Defaults to `false`.
+	SchemeAndPort bool `json:"scheme_and_port"`
+
+	// Setting this to true detects the gRPC records, whose raw response has an `application/grpc`
+	// content type, and populates the `is_grpc` and `grpc_status` fields from the `grpc-status`
+	// header or trailer of the raw response, so gRPC errors can be told apart from the HTTP 200s
+	// carrying them. Defaults to `false`.
+	GRPCStatus bool `json:"grpc_status"`
+
+	// Setting this to true populates the `record_size_bytes` field with the size of the record as
+	// serialized by the gateway, raw request and response included. This is useful for capacity
+	// planning. Defaults to `false`.
+	RecordSize bool `json:"record_size"`
+
+	// Defines a list of request paths whose records are dropped before being sent to any pump,
+	// e.g. health checks hit by synthetic monitors. Each entry matches the record path or raw
+	// path exactly, or as a glob pattern (e.g. `/healthz*`). Dropped records are counted in the
+	// `record_ignored` instrumentation event and the `tyk_pump_dropped_records_total` metric.
+	IgnorePaths []string `json:"ignore_paths"`
+
+	// Defines the retention, in seconds, of the records in all the sinks supporting expiry. It
+	// sets the `expireAt` field of the records to their timestamp plus the TTL, overriding the
+	// expiry set by the gateway. The Mongo selective and aggregate pumps expire their documents
+	// on this field. Defaults to 0, which keeps the expiry set by the gateway.
+	RecordTTL int `json:"record_ttl"`
+
+	// Defines how far in the future, in seconds, the timestamp of the records can be, e.g.
+	// because of a skewed clock in the gateway. The records dated further in the future are
+	// handled according to `future_timestamp_policy` and counted in the
+	// `tyk_pump_future_records_total` metric. Defaults to 0, which disables the check.
+	MaxFutureSkew int `json:"max_future_skew"`
+
+	// The policy of the records dated further in the future than `max_future_skew`: `clamp` sets
+	// their timestamp to the current time and `drop` drops them. Defaults to `clamp`.
+	FutureTimestampPolicy string `json:"future_timestamp_policy"`
+
+	// Defines the interval, in seconds, of the summary log of the records dropped per reason and
+	// pump. The dropped records are also counted in the `tyk_pump_dropped_records_total`
+	// Prometheus metric. Defaults to 300 seconds and a negative value disables the summary.
+	DroppedRecordsLogInterval int `json:"dropped_records_log_interval"`
+
+	// Defines the window, in seconds, of the rolling error rate of the writes of each pump: the
+	// ratio of its failed writes, including the timed out ones, to all its writes within the last
+	// `write_error_rate_window` seconds. It's exposed in the `tyk_pump_write_error_rate`
+	// Prometheus gauge and in the `write_error_rates` of the health check endpoint. Defaults to 0,
+	// which disables it.
+	WriteErrorRateWindow int `json:"write_error_rate_window"`
+
+	// Defines the interval, in seconds, of the synthetic heartbeat records written to the
+	// `heartbeat_pumps`, to monitor the liveness of the whole pipeline. The heartbeat records are
+	// tagged with `tyk-pump-heartbeat`, their method is `HEARTBEAT` and their path
+	// `/tyk-pump-heartbeat`. Defaults to 0, which disables the heartbeat.
+	HeartbeatInterval int `json:"heartbeat_interval"`
+	// The names of the pumps, as set in `pumps`, which receive the heartbeat records. The other
+	// pumps don't receive them.
+	HeartbeatPumps []string `json:"heartbeat_pumps"`
+
+	// Encrypts the raw_request and raw_response fields with AES-GCM before they are written by any
+	// pump. The encrypted values have the format `enc:v1:<key_id>:<base64 nonce and ciphertext>`.
+	// For example:
+	// ```{.json}
+	// "raw_data_encryption": {
+	//   "key_id": "2023-10",
+	//   "key": "<base64 encoded 32 bytes key>"
+	// }
+	// ```
+	RawDataEncryption RawDataEncryptionConf `json:"raw_data_encryption"`
+
+	// Consumes analytics records from a Kafka topic, besides the analytics storage, and sends them
+	// to the pumps. For example:
+	// ```{.json}
+	// "kafka_source": {
+	//   "brokers": ["localhost:9092"],
+	//   "topic": "tyk-analytics",
+	//   "group_id": "tyk-pump",
+	//   "format": "msgpack"
+	// }
+	// ```
+	KafkaSource KafkaSourceConf `json:"kafka_source"`
+
+	// Classifies the records as bot traffic from their user agent, setting their `is_bot` field.
+	// This is useful to separate human and bot traffic in dashboards. For example:
+	// ```{.json}
+	// "bot_detection": {
+	//   "enabled": true,
+	//   "user_agents": ["googlebot", "bingbot", "uptime-monitor"],
+	//   "user_agent_patterns": ["^Synthetic-\\d+$"]
+	// }
+	// ```
+	BotDetection BotDetectionConf `json:"bot_detection"`
+
+	// Tags the records with business fields of their JSON request body, e.g. a tenant id. It
+	// requires the gateway to record the raw request. Non JSON bodies, and fields which are
+	// missing or aren't a string, number or boolean, are ignored. For example:
+	// ```{.json}
+	// "request_body_tags": {
+	//   "fields": {
+	//     "tenant_id": "$.tenant.id"
+	//   },
+	//   "max_body_size": 16384
+	// }
+	// ```
+	RequestBodyTags RequestBodyTagsConf `json:"request_body_tags"`
+
+	// Flags the records whose request body contains PII, setting their `contains_pii` field and
+	// the categories found in `pii_categories`, e.g. to route them to stricter sinks with the
+	// filters of the pumps. It requires the gateway to record the raw request. For example:
+	// ```{.json}
+	// "pii_detection": {
+	//   "enabled": true,
+	//   "patterns": {
+	//     "email": "[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\\.[A-Za-z]{2,}",
+	//     "phone": "\\+\\d{10,14}"
+	//   }
+	// }
+	// ```
+	PIIDetection PIIDetectionConf `json:"pii_detection"`
+
+	// Promotes the TLS version and cipher of the requests, captured by the gateway in tags or by a
+	// load balancer in headers, into the structured `tls_version` and `tls_cipher` fields for
+	// security dashboards. They stay empty when they can't be found. For example:
+	// ```{.json}
+	// "tls_info": {
+	//   "enabled": true,
+	//   "version_tag": "tls_version",
+	//   "cipher_tag": "tls_cipher",
+	//   "version_header": "X-SSL-Protocol",
+	//   "cipher_header": "X-SSL-Cipher"
+	// }
+	// ```
+	TLSInfo TLSInfoConf `json:"tls_info"`
+
+	// Promotes the DNS lookup, connection and TLS handshake times of the upstream requests,
+	// recorded by the gateway in tags, into the structured `latency_dns`, `latency_connect` and
+	// `latency_tls` fields, in milliseconds. They stay zero when the tags are missing. For
+	// example:
+	// ```{.json}
+	// "latency_phases": {
+	//   "enabled": true,
+	//   "dns_tag": "latency_dns",
+	//   "connect_tag": "latency_connect",
+	//   "tls_tag": "latency_tls"
+	// }
+	// ```
+	LatencyPhases LatencyPhasesConf `json:"latency_phases"`
+
+	// Populates the `correlation_id` field of the records from the raw request headers, or the raw
+	// response headers when the request doesn't have any of them, for distributed tracing. For
+	// example:
+	// ```{.json}
+	// "correlation_id": {
+	//   "headers": ["X-Correlation-ID", "X-Request-ID"]
+	// }
+	// ```
+	CorrelationID CorrelationIDConf `json:"correlation_id"`
+
+	// Populates the `jwt_subject` field (the consumer identity) and tags of the records from the
+	// claims of the JWT of the raw request. The signature of the JWT isn't verified, the gateway
+	// already did. For example:
+	// ```{.json}
+	// "jwt_claims": {
+	//   "enabled": true,
+	//   "header": "Authorization",
+	//   "claims": ["scope"]
+	// }
+	// ```
+	JWTClaims JWTClaimsConf `json:"jwt_claims"`
+
+	// Populates the `endpoint` field of the records with their matched route, for grouping them by
+	// endpoint rather than by path. It's read from the tag added by the gateway, e.g.
+	// `endpoint:/users/{id}`, or else taken from the path of the records tracked with
+	// `track_endpoint`. For example:
+	// ```{.json}
+	// "endpoint": {
+	//   "enabled": true,
+	//   "tag_prefix": "endpoint:"
+	// }
+	// ```
+	Endpoint EndpointConf `json:"endpoint"`
+
+	// Populates the `node_id` field of the records with the id of the gateway node which emitted
+	// them, read from the tag added by the gateway, e.g. `node:gw-1`, for per-node analytics. The
+	// aggregate pumps aggregate the records per node too, as the `nodeids` dimension. For example:
+	// ```{.json}
+	// "node_id": {
+	//   "enabled": true,
+	//   "tag_prefix": "node:"
+	// }
+	// ```
+	NodeID NodeIDConf `json:"node_id"`
+
+	// Moves the `key:value` tags of the records, e.g. `team:payments`, into their `tag_map` field,
+	// so the pumps store them as a map instead of a list of strings. The moved tags are kept in
+	// `tags` too, unless `keep_tags` is false. For example:
+	// ```{.json}
+	// "tag_map": {
+	//   "enabled": true,
+	//   "keys": ["team", "env"]
+	// }
+	// ```
+	TagMap TagMapConf `json:"tag_map"`
+
+	// Setting this to true populates the `browser`, `os` and `device_type` fields from the user
+	// agent of the records, e.g. `Firefox`, `Android` and `mobile`, so the traffic can be grouped
+	// by client family rather than by raw user agent. The device type is one of `desktop`,
+	// `mobile`, `tablet`, `bot` and `other`. Defaults to `false`, skipping the parsing.
+	UserAgentFamilies bool `json:"user_agent_families"`
+
+	// Anonymizes the API keys and OAuth ids of the records, replacing them with a deterministic
+	// token, so the same key always yields the same token. The hashing is done once, before the
+	// records are sent to the pumps. For example:
+	// ```{.json}
+	// "key_hashing": {
+	//   "enabled": true,
+	//   "algorithm": "hmac-sha256",
+	//   "salt": "<secret>",
+	//   "bypass_pumps": ["internal-audit"]
+	// }
+	// ```
+	KeyHashing KeyHashingConf `json:"key_hashing"`
+
+	// Limits the GraphQL variables stored by the GraphQL pumps (`mongo-graph` and `sql-graph`),
+	// which can be huge or sensitive. For example:
+	// ```{.json}
+	// "graphql_variables": {
+	//   "max_size": 1024,
+	//   "redacted_names": ["password", "token"]
+	// }
+	// ```
+	GraphQLVariables GraphQLVariablesConf `json:"graphql_variables"`
+
+	// Routes the records between two pumps: the records matching the filters of the route go to
+	// its full pump, and a sample of the others to its sampled pump. This keeps full fidelity for
+	// a small subset of the traffic, and sampled data for the rest. The pumps' own filters still
+	// apply, and a pump can only be part of one route. For example:
+	// ```{.json}
+	// "filter_routes": [
+	//   {
+	//     "filters": {"api_ids": ["payments"]},
+	//     "full_pump": "mongo-full",
+	//     "sampled_pump": "mongo-sampled",
+	//     "sample_rate": 10
+	//   }
+	// ]
+	// ```
+	FilterRoutes []FilterRouteConf `json:"filter_routes"`
+
+	// The names of the pumps, as set in `pumps`, receiving the GraphQL records, in a dedicated
+	// sink. When it's set, the GraphQL records are only sent to these pumps, and the other records
+	// to the rest of the pumps. The graph pumps (`mongo-graph`, `sql-graph` and
+	// `sql-graph-aggregate`) convert the records to the GraphQL shape. For example:
+	// ```{.json}
+	// "graph_pumps": ["mongo-graph"]
+	// ```
+	GraphPumps []string `json:"graph_pumps"`
 }
 
 func LoadConfig(filePath *string, configStruct *TykPumpConfiguration) {
@@ -334,6 +1008,11 @@ func (cfg *TykPumpConfiguration) LoadPumpsByEnv() error {
 		if overrideErr != nil {
 			log.Error("Failed to process environment variables for ", PUMPS_ENV_PREFIX+"_"+pmpName, " with err: ", overrideErr)
 		}
+		//Then the lists and maps, which can be named after their json keys or hold JSON values.
+		typedErr := pumps.ProcessTypedEnvVars(PUMPS_ENV_PREFIX+"_"+pmpName, &pmp)
+		if typedErr != nil {
+			log.Error("Failed to process typed environment variables for ", PUMPS_ENV_PREFIX+"_"+pmpName, " with err: ", typedErr)
+		}
 
 		//init the meta map
 		if len(pmp.Meta) == 0 {
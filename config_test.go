@@ -131,3 +131,31 @@ func TestIgnoreConfig(t *testing.T) {
 		assert.Equal(t, 5, initialConfig.PurgeDelay, "Nonexistent config file should not affect the configuration")
 	})
 }
+
+func TestConfigTypedEnv(t *testing.T) {
+	testEnvVars := map[string]string{
+		PUMPS_ENV_PREFIX + "_CSV_FILTERS_APIIDS":              "a, b, c",
+		PUMPS_ENV_PREFIX + "_CSV_FILTERS_ORG_IDS":             "org1,org2",
+		PUMPS_ENV_PREFIX + "_CSV_FILTERS_SKIP_RESPONSE_CODES": "[500,503]",
+		PUMPS_ENV_PREFIX + "_CSV_IGNORE_FIELDS":               `["api_key","raw_request"]`,
+		PUMPS_ENV_PREFIX + "_CSV_TIMEOUT":                     "5",
+	}
+	for env, val := range testEnvVars {
+		os.Setenv(env, val)
+	}
+	defer func() {
+		for env := range testEnvVars {
+			os.Unsetenv(env)
+		}
+	}()
+
+	cfg := &TykPumpConfiguration{}
+	assert.Nil(t, cfg.LoadPumpsByEnv())
+
+	pmp := cfg.Pumps["CSV"]
+	assert.Equal(t, []string{"a", "b", "c"}, pmp.Filters.APIIDs)
+	assert.Equal(t, []string{"org1", "org2"}, pmp.Filters.OrgsIDs)
+	assert.Equal(t, []int{500, 503}, pmp.Filters.SkippedResponseCodes)
+	assert.Equal(t, []string{"api_key", "raw_request"}, pmp.IgnoreFields)
+	assert.Equal(t, 5, pmp.Timeout)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gocraft/health"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk-pump/serializer"
+)
+
+// analyticsBatch is a chunk of analytics values read from the analytics storage, waiting to be
+// decoded and written to the pumps.
+type analyticsBatch struct {
+	values           []interface{}
+	serializerMethod serializer.AnalyticsSerializer
+	analyticsKeyName string
+	omitDetails      bool
+	job              *health.Job
+	startTime        time.Time
+	secInterval      int
+	// set on the batch ending a purge, which writes the summary of the purge instead of values
+	batchSummary bool
+}
+
+// batchDispatcher processes the batches read from the analytics storage in the background. Its
+// buffer is bounded, so the reader blocks, and stops pulling from the storage, while the pumps
+// can't keep up.
+type batchDispatcher struct {
+	batches   chan analyticsBatch
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Dispatcher is the dispatcher of the purge loop, set when processing_buffer_size is set.
+var Dispatcher *batchDispatcher
+
+// newBatchDispatcher returns a started dispatcher buffering up to size batches.
+func newBatchDispatcher(size int) *batchDispatcher {
+	d := &batchDispatcher{
+		batches: make(chan analyticsBatch, size),
+		done:    make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+func (d *batchDispatcher) run() {
+	defer close(d.done)
+	for batch := range d.batches {
+		if batch.batchSummary {
+			writeBatchSummary(batch.job, batch.startTime, batch.secInterval)
+			continue
+		}
+		PreprocessAnalyticsValues(batch.values, batch.serializerMethod, batch.analyticsKeyName, batch.omitDetails, batch.job, batch.startTime, batch.secInterval)
+	}
+}
+
+// dispatch queues the batch, blocking while the buffer is full.
+func (d *batchDispatcher) dispatch(batch analyticsBatch) {
+	select {
+	case d.batches <- batch:
+		return
+	default:
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix": mainPrefix,
+	}).Warning("The pumps can't keep up, pausing the analytics storage reads")
+	batch.job.Event("reader_throttled")
+	d.batches <- batch
+}
+
+// close stops accepting batches and waits until the buffered ones are processed.
+func (d *batchDispatcher) close() {
+	d.closeOnce.Do(func() {
+		close(d.batches)
+	})
+	<-d.done
+}
+
+// processAnalyticsValues processes the values read from the analytics storage, through the
+// Dispatcher if it's set, or right away otherwise.
+func processAnalyticsValues(values []interface{}, serializerMethod serializer.AnalyticsSerializer, analyticsKeyName string, omitDetails bool, job *health.Job, startTime time.Time, secInterval int) {
+	if Dispatcher == nil {
+		PreprocessAnalyticsValues(values, serializerMethod, analyticsKeyName, omitDetails, job, startTime, secInterval)
+		return
+	}
+
+	Dispatcher.dispatch(analyticsBatch{
+		values:           values,
+		serializerMethod: serializerMethod,
+		analyticsKeyName: analyticsKeyName,
+		omitDetails:      omitDetails,
+		job:              job,
+		startTime:        startTime,
+		secInterval:      secInterval,
+	})
+}
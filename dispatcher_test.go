@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/TykTechnologies/tyk-pump/pumps"
+	"github.com/TykTechnologies/tyk-pump/serializer"
+)
+
+// BlockingPump blocks every write until it's released.
+type BlockingPump struct {
+	release chan struct{}
+	writes  int32
+	pumps.CommonPumpConfig
+}
+
+func (p *BlockingPump) GetName() string {
+	return "Blocking Pump"
+}
+
+func (p *BlockingPump) New() pumps.Pump {
+	return &BlockingPump{}
+}
+
+func (p *BlockingPump) Init(config interface{}) error {
+	return nil
+}
+
+func (p *BlockingPump) WriteData(ctx context.Context, keys []interface{}) error {
+	<-p.release
+	atomic.AddInt32(&p.writes, 1)
+	return nil
+}
+
+func TestBatchDispatcherBackpressure(t *testing.T) {
+	blockingPump := &BlockingPump{release: make(chan struct{})}
+	Pumps = []pumps.Pump{blockingPump}
+
+	msgpackSerializer := serializer.NewAnalyticsSerializer(serializer.MSGP_SERIALIZER)
+	encoded, err := msgpackSerializer.Encode(&analytics.AnalyticsRecord{APIID: "api1"})
+	assert.Nil(t, err)
+
+	const bufferSize = 2
+	Dispatcher = newBatchDispatcher(bufferSize)
+	defer func() {
+		Dispatcher = nil
+	}()
+
+	// the reader dispatches the batches as fast as it can
+	var dispatched int32
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for i := 0; i < 10; i++ {
+			processAnalyticsValues([]interface{}{string(encoded)}, msgpackSerializer, "analytics", false, instrument.NewJob("TestJob"), time.Now(), 2)
+			atomic.AddInt32(&dispatched, 1)
+		}
+	}()
+
+	// with the pump stuck, the reader is paused once the buffer is full: one batch is being
+	// written, bufferSize are buffered and the next is waiting for room
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&dispatched) == bufferSize+1
+	}, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(bufferSize+1), atomic.LoadInt32(&dispatched))
+	assert.LessOrEqual(t, len(Dispatcher.batches), bufferSize)
+
+	// each write makes room for one more batch
+	blockingPump.release <- struct{}{}
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&dispatched) == bufferSize+2
+	}, time.Second, 10*time.Millisecond)
+
+	// once the pump catches up, every batch is written
+	close(blockingPump.release)
+	<-readerDone
+	Dispatcher.close()
+	assert.Equal(t, int32(10), atomic.LoadInt32(&blockingPump.writes))
+}
+
+func TestProcessAnalyticsValuesWithoutDispatcher(t *testing.T) {
+	mockedPump := &MockedPump{}
+	Pumps = []pumps.Pump{mockedPump}
+
+	msgpackSerializer := serializer.NewAnalyticsSerializer(serializer.MSGP_SERIALIZER)
+	encoded, err := msgpackSerializer.Encode(&analytics.AnalyticsRecord{APIID: "api1"})
+	assert.Nil(t, err)
+
+	// the values are written before returning
+	processAnalyticsValues([]interface{}{string(encoded)}, msgpackSerializer, "analytics", false, instrument.NewJob("TestJob"), time.Now(), 2)
+	assert.Equal(t, 1, mockedPump.CounterRequest)
+}
+
+func TestBatchDispatcherBatchSummary(t *testing.T) {
+	recordingPump := &RecordingPump{}
+	Pumps = []pumps.Pump{recordingPump}
+	BatchSummaryPumps = []pumps.Pump{recordingPump}
+	Dispatcher = newBatchDispatcher(10)
+	defer func() {
+		Dispatcher = nil
+		Pumps = nil
+		BatchSummaryPumps = nil
+	}()
+
+	msgpackSerializer := serializer.NewAnalyticsSerializer(serializer.MSGP_SERIALIZER)
+	encoded, err := msgpackSerializer.Encode(&analytics.AnalyticsRecord{APIID: "api1"})
+	assert.Nil(t, err)
+
+	job := instrument.NewJob("TestJob")
+	for i := 0; i < 3; i++ {
+		processAnalyticsValues([]interface{}{string(encoded)}, msgpackSerializer, "analytics", false, job, time.Now(), 2)
+	}
+	processBatchSummary(job, time.Now(), 2)
+	Dispatcher.close()
+
+	// the summary follows the records of the purge it summarises
+	assert.Len(t, recordingPump.Records, 4)
+	summary := recordingPump.Records[3]
+	assert.True(t, summary.IsBatchSummary())
+	assert.Contains(t, summary.Tags, "batch_records:3")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// The reasons why records are dropped before, or while, being written by the pumps.
+const (
+	// dropReasonDecodeError is used for the records that couldn't be decoded.
+	dropReasonDecodeError = "decode_error"
+	// dropReasonIgnoredPath is used for the records matching ignore_paths.
+	dropReasonIgnoredPath = "ignored_path"
+	// dropReasonFiltered is used for the records discarded by the filters of a pump.
+	dropReasonFiltered = "filtered"
+	// dropReasonSampled is used for the records sampled out by the sampling of a pump.
+	dropReasonSampled = "sampled"
+	// dropReasonWriteError is used for the records of a batch whose write failed.
+	dropReasonWriteError = "write_error"
+	// dropReasonTimeout is used for the records of a batch whose write timed out.
+	dropReasonTimeout = "timeout"
+)
+
+const defaultDroppedRecordsLogInterval = 5 * time.Minute
+
+// droppedRecordsCounter counts the dropped records, per reason and pump. The pump is empty for
+// the records dropped before being sent to the pumps.
+var droppedRecordsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "tyk_pump_dropped_records_total",
+		Help: "Analytics records dropped by the pump, per reason",
+	},
+	[]string{"reason", "pump"},
+)
+
+func init() {
+	prometheus.MustRegister(droppedRecordsCounter)
+}
+
+type droppedRecordsKey struct {
+	reason string
+	pump   string
+}
+
+// droppedRecords accumulates the records dropped since the last summary log.
+var droppedRecords = struct {
+	sync.Mutex
+	counts map[droppedRecordsKey]int
+}{counts: map[droppedRecordsKey]int{}}
+
+// recordsDropped counts count records dropped for reason by pump.
+func recordsDropped(reason, pump string, count int) {
+	if count <= 0 {
+		return
+	}
+	droppedRecordsCounter.WithLabelValues(reason, pump).Add(float64(count))
+
+	droppedRecords.Lock()
+	droppedRecords.counts[droppedRecordsKey{reason: reason, pump: pump}] += count
+	droppedRecords.Unlock()
+}
+
+// logDroppedRecords logs the records dropped since the previous call, per reason and pump, and
+// resets their counts. Nothing is logged if no record was dropped.
+func logDroppedRecords() {
+	droppedRecords.Lock()
+	counts := droppedRecords.counts
+	droppedRecords.counts = map[droppedRecordsKey]int{}
+	droppedRecords.Unlock()
+
+	keys := make([]droppedRecordsKey, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].reason != keys[j].reason {
+			return keys[i].reason < keys[j].reason
+		}
+		return keys[i].pump < keys[j].pump
+	})
+
+	for _, key := range keys {
+		fields := logrus.Fields{
+			"prefix": mainPrefix,
+			"reason": key.reason,
+		}
+		if key.pump != "" {
+			fields["pump"] = key.pump
+		}
+		log.WithFields(fields).Info("Dropped ", counts[key], " records")
+	}
+}
+
+// StartDroppedRecordsLog logs the summary of the dropped records every interval until ctx is
+// done. A negative interval disables the summary.
+func StartDroppedRecordsLog(ctx context.Context, interval time.Duration) {
+	if interval < 0 {
+		return
+	}
+	if interval == 0 {
+		interval = defaultDroppedRecordsLogInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			logDroppedRecords()
+		case <-ctx.Done():
+			logDroppedRecords()
+			return
+		}
+	}
+}
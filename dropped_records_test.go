@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/TykTechnologies/tyk-pump/logger"
+	"github.com/TykTechnologies/tyk-pump/pumps"
+	"github.com/TykTechnologies/tyk-pump/serializer"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// FailingPump fails every write, after Delay or when the context is done.
+type FailingPump struct {
+	Delay time.Duration
+	pumps.CommonPumpConfig
+}
+
+func (p *FailingPump) GetName() string {
+	return "Failing Pump"
+}
+
+func (p *FailingPump) New() pumps.Pump {
+	return &FailingPump{}
+}
+
+func (p *FailingPump) Init(config interface{}) error {
+	return nil
+}
+
+func (p *FailingPump) WriteData(ctx context.Context, keys []interface{}) error {
+	select {
+	case <-time.After(p.Delay):
+		return errors.New("backend unavailable")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func droppedRecordsCount(reason, pump string) float64 {
+	return testutil.ToFloat64(droppedRecordsCounter.WithLabelValues(reason, pump))
+}
+
+func TestDroppedRecords(t *testing.T) {
+	msgpackSerializer := serializer.NewAnalyticsSerializer(serializer.MSGP_SERIALIZER)
+	encode := func(record analytics.AnalyticsRecord) interface{} {
+		encoded, err := msgpackSerializer.Encode(&record)
+		assert.Nil(t, err)
+		return string(encoded)
+	}
+
+	t.Run("decode error", func(t *testing.T) {
+		Pumps = []pumps.Pump{&MockedPump{}}
+		before := droppedRecordsCount(dropReasonDecodeError, "")
+
+		values := []interface{}{"not msgpack", encode(analytics.AnalyticsRecord{Path: "/get"})}
+		PreprocessAnalyticsValues(values, msgpackSerializer, "analytics", false, instrument.NewJob("TestJob"), time.Now(), 2)
+
+		assert.Equal(t, before+1, droppedRecordsCount(dropReasonDecodeError, ""))
+	})
+
+	t.Run("ignored path", func(t *testing.T) {
+		SystemConfig.IgnorePaths = []string{"/healthz"}
+		defer func() {
+			SystemConfig.IgnorePaths = nil
+		}()
+		Pumps = []pumps.Pump{&MockedPump{}}
+		before := droppedRecordsCount(dropReasonIgnoredPath, "")
+
+		values := []interface{}{encode(analytics.AnalyticsRecord{Path: "/healthz"}), encode(analytics.AnalyticsRecord{Path: "/get"})}
+		PreprocessAnalyticsValues(values, msgpackSerializer, "analytics", false, instrument.NewJob("TestJob"), time.Now(), 2)
+
+		assert.Equal(t, before+1, droppedRecordsCount(dropReasonIgnoredPath, ""))
+	})
+
+	t.Run("filtered", func(t *testing.T) {
+		mockedPump := &MockedPump{}
+		mockedPump.SetFilters(analytics.AnalyticsFilters{SkippedResponseCodes: []int{200}})
+		before := droppedRecordsCount(dropReasonFiltered, mockedPump.GetName())
+
+		keys := []interface{}{
+			analytics.AnalyticsRecord{ResponseCode: 200},
+			analytics.AnalyticsRecord{ResponseCode: 200},
+			analytics.AnalyticsRecord{ResponseCode: 500},
+		}
+		filterData(mockedPump, keys)
+
+		assert.Equal(t, before+2, droppedRecordsCount(dropReasonFiltered, mockedPump.GetName()))
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		failingPump := &FailingPump{}
+		before := droppedRecordsCount(dropReasonWriteError, failingPump.GetName())
+
+		keys := []interface{}{analytics.AnalyticsRecord{}, analytics.AnalyticsRecord{}}
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		execPumpWriting(&wg, failingPump, &keys, 2, time.Now(), nil, func() {})
+
+		assert.Equal(t, before+2, droppedRecordsCount(dropReasonWriteError, failingPump.GetName()))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		slowPump := &FailingPump{Delay: 5 * time.Second}
+		slowPump.SetTimeout(1)
+		before := droppedRecordsCount(dropReasonTimeout, slowPump.GetName())
+
+		keys := []interface{}{analytics.AnalyticsRecord{}}
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		execPumpWriting(&wg, slowPump, &keys, 2, time.Now(), nil, func() {})
+
+		// the write gives up after the timeout, the pump returns shortly after
+		assert.Eventually(t, func() bool {
+			return droppedRecordsCount(dropReasonTimeout, slowPump.GetName()) == before+1
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestLogDroppedRecords(t *testing.T) {
+	hook := test.NewLocal(log)
+	logDroppedRecords()
+	hook.Reset()
+
+	recordsDropped(dropReasonWriteError, "Failing Pump", 3)
+	recordsDropped(dropReasonIgnoredPath, "", 1)
+	recordsDropped(dropReasonWriteError, "Failing Pump", 2)
+	recordsDropped(dropReasonFiltered, "Mocked Pump", 0)
+	logDroppedRecords()
+
+	entries := hook.AllEntries()
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "Dropped 1 records", entries[0].Message)
+	assert.Equal(t, dropReasonIgnoredPath, entries[0].Data["reason"])
+	assert.NotContains(t, entries[0].Data, "pump")
+	assert.Equal(t, "Dropped 5 records", entries[1].Message)
+	assert.Equal(t, dropReasonWriteError, entries[1].Data["reason"])
+	assert.Equal(t, "Failing Pump", entries[1].Data["pump"])
+
+	// the counts are reset after each summary
+	hook.Reset()
+	logDroppedRecords()
+	assert.Empty(t, hook.AllEntries())
+}
+
+func TestExecPumpWritingJSONLogs(t *testing.T) {
+	var buf bytes.Buffer
+	log.Out = &buf
+	assert.Nil(t, logger.SetFormat(logger.JSONFormat))
+	defer func() {
+		log.Out = os.Stderr
+		assert.Nil(t, logger.SetFormat(logger.TextFormat))
+	}()
+
+	failingPump := &FailingPump{}
+	keys := []interface{}{analytics.AnalyticsRecord{}, analytics.AnalyticsRecord{}}
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	execPumpWriting(&wg, failingPump, &keys, 2, time.Now(), nil, func() {})
+
+	// every line is a JSON entry, the one of the write has the fields of the write
+	var writeEntry map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		entry := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &entry), line)
+		if _, ok := entry[logger.FieldPump]; ok {
+			writeEntry = entry
+		}
+	}
+	assert.NotNil(t, writeEntry)
+	assert.Equal(t, "Failing Pump", writeEntry[logger.FieldPump])
+	assert.Equal(t, float64(2), writeEntry[logger.FieldBatchSize])
+	assert.Contains(t, writeEntry, logger.FieldDuration)
+	assert.Equal(t, "backend unavailable", writeEntry[logger.FieldError])
+	assert.Equal(t, "warning", writeEntry["level"])
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk-pump/pumps"
+)
+
+// dryRunCounter counts the records the pumps would have written in dry run mode.
+type dryRunCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// DryRunWrites are the records each pump would have written since the pump started, by pump name.
+var DryRunWrites = &dryRunCounter{counts: map[string]int{}}
+
+// dryRunWrite replaces the write of keys to pmp in dry run mode, logging and counting them.
+func dryRunWrite(pmp pumps.Pump, keys []interface{}) {
+	total := DryRunWrites.add(pmp.GetName(), len(keys))
+	log.WithFields(logrus.Fields{
+		"prefix": mainPrefix,
+	}).Infof("Dry run: would write %d records to %s (%d in total)", len(keys), pmp.GetName(), total)
+}
+
+func (c *dryRunCounter) add(name string, n int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[name] += n
+	return c.counts[name]
+}
+
+// get returns the records counted for the pump name.
+func (c *dryRunCounter) get(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[name]
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/TykTechnologies/tyk-pump/pumps"
+)
+
+func TestWriteToPumpsDryRun(t *testing.T) {
+	SystemConfig.DryRun = true
+	defer func() {
+		SystemConfig.DryRun = false
+		Pumps = nil
+	}()
+
+	var inFlight, maxSeen int32
+	filteredPump := &SlowPump{name: "dry-run-filtered", inFlight: &inFlight, maxSeen: &maxSeen}
+	filteredPump.SetFilters(analytics.AnalyticsFilters{SkippedAPIIDs: []string{"api2"}})
+	sampledPump := &SlowPump{name: "dry-run-sampled", inFlight: &inFlight, maxSeen: &maxSeen}
+	sampledPump.SetSampling(pumps.SamplingConf{Rate: 3})
+	Pumps = []pumps.Pump{filteredPump, sampledPump}
+
+	keys := []interface{}{
+		analytics.AnalyticsRecord{APIID: "api1"},
+		analytics.AnalyticsRecord{APIID: "api2"},
+		analytics.AnalyticsRecord{APIID: "api3"},
+	}
+	writeToPumps(keys, instrument.NewJob("TestJob"), time.Now(), 2)
+	writeToPumps(keys, instrument.NewJob("TestJob"), time.Now(), 2)
+
+	// nothing is written
+	assert.Equal(t, int32(0), atomic.LoadInt32(&filteredPump.writes))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&sampledPump.writes))
+	// but the filters and the sampling are still applied
+	assert.Equal(t, 4, DryRunWrites.get("dry-run-filtered"))
+	assert.Equal(t, 2, DryRunWrites.get("dry-run-sampled"))
+}
+
+func TestInitialisePumpsDryRunDiskBuffer(t *testing.T) {
+	defer func() {
+		SystemConfig = TykPumpConfiguration{}
+		Pumps = nil
+	}()
+
+	for _, dryRun := range []bool{false, true} {
+		SystemConfig = TykPumpConfiguration{
+			DryRun:              dryRun,
+			DontPurgeUptimeData: true,
+			Pumps: map[string]PumpConfig{
+				"dummy": {Type: "dummy", DiskBuffer: pumps.DiskBufferConf{Path: t.TempDir()}},
+			},
+		}
+		initialisePumps()
+		assert.Len(t, Pumps, 1)
+
+		// the buffer, and its drain loop, are only started outside of the dry runs
+		bufferedPmp, buffered := Pumps[0].(*pumps.DiskBufferedPump)
+		assert.Equal(t, !dryRun, buffered)
+		if buffered {
+			assert.Nil(t, bufferedPmp.Shutdown())
+		}
+	}
+}
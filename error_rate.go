@@ -0,0 +1,121 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk-pump/server"
+)
+
+// writeErrorRateGauge is the rolling error rate of the writes of each pump, between 0 and 1.
+var writeErrorRateGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "tyk_pump_write_error_rate",
+		Help: "Ratio of the failed writes of the pump to all its writes within the error rate window",
+	},
+	[]string{"pump"},
+)
+
+func init() {
+	prometheus.MustRegister(writeErrorRateGauge)
+}
+
+// writeOutcome is the result of a write of a pump.
+type writeOutcome struct {
+	at     time.Time
+	failed bool
+}
+
+// errorRateTracker keeps the outcomes of the writes of each pump within window, to compute their
+// rolling error rate.
+type errorRateTracker struct {
+	mu       sync.Mutex
+	window   time.Duration
+	outcomes map[string][]writeOutcome
+}
+
+// WriteErrorRates tracks the error rate of the writes, set when write_error_rate_window is set.
+// The writes read it from their own goroutines, which may outlive a setup, so it's atomic.
+var WriteErrorRates atomic.Pointer[errorRateTracker]
+
+// setupWriteErrorRates starts tracking the error rate of the writes if write_error_rate_window is
+// set, and adds the rates to the health check response.
+func setupWriteErrorRates() {
+	WriteErrorRates.Store(nil)
+	if SystemConfig.WriteErrorRateWindow <= 0 {
+		return
+	}
+
+	tracker := newErrorRateTracker(time.Duration(SystemConfig.WriteErrorRateWindow) * time.Second)
+	server.SetHealthInfo("write_error_rates", func() interface{} {
+		return tracker.rates(time.Now())
+	})
+	WriteErrorRates.Store(tracker)
+	log.WithFields(logrus.Fields{
+		"prefix": mainPrefix,
+	}).Infof("Tracking the write error rate of the pumps over %d seconds", SystemConfig.WriteErrorRateWindow)
+}
+
+func newErrorRateTracker(window time.Duration) *errorRateTracker {
+	return &errorRateTracker{
+		window:   window,
+		outcomes: map[string][]writeOutcome{},
+	}
+}
+
+// record adds the outcome of a write of pump at now, and updates its gauge.
+func (t *errorRateTracker) record(pump string, failed bool, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.outcomes[pump] = append(t.outcomes[pump], writeOutcome{at: now, failed: failed})
+	writeErrorRateGauge.WithLabelValues(pump).Set(t.rateLocked(pump, now))
+}
+
+// rate returns the ratio of the failed writes of pump to all its writes within the window before
+// now, 0 if there is none.
+func (t *errorRateTracker) rate(pump string, now time.Time) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rateLocked(pump, now)
+}
+
+// rates returns the rate of every pump which has written, and updates their gauges.
+func (t *errorRateTracker) rates(now time.Time) map[string]float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rates := make(map[string]float64, len(t.outcomes))
+	for pump := range t.outcomes {
+		rates[pump] = t.rateLocked(pump, now)
+		writeErrorRateGauge.WithLabelValues(pump).Set(rates[pump])
+	}
+	return rates
+}
+
+// rateLocked discards the outcomes of pump older than the window and returns its rate. It must be
+// called with mu held.
+func (t *errorRateTracker) rateLocked(pump string, now time.Time) float64 {
+	outcomes := t.outcomes[pump]
+	start := 0
+	for start < len(outcomes) && now.Sub(outcomes[start].at) > t.window {
+		start++
+	}
+	outcomes = outcomes[start:]
+	t.outcomes[pump] = outcomes
+
+	if len(outcomes) == 0 {
+		return 0
+	}
+	failed := 0
+	for _, outcome := range outcomes {
+		if outcome.failed {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(outcomes))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/TykTechnologies/tyk-pump/pumps"
+	"github.com/TykTechnologies/tyk-pump/server"
+)
+
+func TestErrorRateTracker(t *testing.T) {
+	tracker := newErrorRateTracker(time.Minute)
+	now := time.Now()
+
+	assert.Equal(t, 0.0, tracker.rate("pump", now))
+
+	tracker.record("pump", true, now)
+	tracker.record("pump", false, now.Add(30*time.Second))
+	tracker.record("pump", false, now.Add(40*time.Second))
+	tracker.record("pump", true, now.Add(50*time.Second))
+	assert.Equal(t, 0.5, tracker.rate("pump", now.Add(50*time.Second)))
+	assert.Equal(t, 0.5, testutil.ToFloat64(writeErrorRateGauge.WithLabelValues("pump")))
+
+	// the first failure is out of the window
+	assert.InDelta(t, 1.0/3, tracker.rate("pump", now.Add(80*time.Second)), 0.0001)
+	// and then the successes
+	assert.Equal(t, 1.0, tracker.rate("pump", now.Add(105*time.Second)))
+	assert.Equal(t, 0.0, tracker.rate("pump", now.Add(2*time.Minute)))
+
+	// the pumps are tracked separately
+	tracker.record("other", false, now)
+	assert.Equal(t, map[string]float64{"pump": 0.0, "other": 0.0}, tracker.rates(now.Add(2*time.Minute)))
+}
+
+// ScriptedPump fails the writes for which Failures is true, in order, and succeeds afterwards.
+type ScriptedPump struct {
+	Failures []bool
+	writes   int
+	pumps.CommonPumpConfig
+}
+
+func (p *ScriptedPump) GetName() string {
+	return "Scripted Pump"
+}
+
+func (p *ScriptedPump) New() pumps.Pump {
+	return &ScriptedPump{}
+}
+
+func (p *ScriptedPump) Init(config interface{}) error {
+	return nil
+}
+
+func (p *ScriptedPump) WriteData(ctx context.Context, keys []interface{}) error {
+	defer func() { p.writes++ }()
+	if p.writes < len(p.Failures) && p.Failures[p.writes] {
+		return errors.New("backend unavailable")
+	}
+	return nil
+}
+
+func TestWriteErrorRates(t *testing.T) {
+	WriteErrorRates.Store(newErrorRateTracker(time.Minute))
+	defer func() {
+		WriteErrorRates.Store(nil)
+	}()
+
+	recordingPump := &RecordingPump{}
+	failingPump := &FailingPump{}
+	scriptedPump := &ScriptedPump{Failures: []bool{true, false, true, false, false, false, false, true}}
+	Pumps = []pumps.Pump{recordingPump, failingPump, scriptedPump}
+
+	keys := []interface{}{analytics.AnalyticsRecord{APIID: "api1"}}
+	for i := 0; i < 8; i++ {
+		writeToPumps(keys, nil, time.Now(), 2)
+	}
+
+	now := time.Now()
+	assert.Equal(t, 0.0, WriteErrorRates.Load().rate(recordingPump.GetName(), now))
+	assert.Equal(t, 1.0, WriteErrorRates.Load().rate(failingPump.GetName(), now))
+	assert.Equal(t, 3.0/8, WriteErrorRates.Load().rate(scriptedPump.GetName(), now))
+	assert.Equal(t, 3.0/8, testutil.ToFloat64(writeErrorRateGauge.WithLabelValues(scriptedPump.GetName())))
+
+	// the rates are back to 0 once the failures are out of the window
+	assert.Equal(t, 0.0, WriteErrorRates.Load().rate(failingPump.GetName(), now.Add(2*time.Minute)))
+}
+
+func TestWriteErrorRatesPumpKeys(t *testing.T) {
+	WriteErrorRates.Store(newErrorRateTracker(time.Minute))
+	defer func() {
+		WriteErrorRates.Store(nil)
+		PumpKeys = map[pumps.Pump]string{}
+	}()
+
+	// two pumps of the same type are told apart by their keys
+	primary := &ScriptedPump{Failures: []bool{true, true}}
+	secondary := &ScriptedPump{}
+	Pumps = []pumps.Pump{primary, secondary}
+	PumpKeys = map[pumps.Pump]string{primary: "primary", secondary: "secondary"}
+
+	keys := []interface{}{analytics.AnalyticsRecord{APIID: "api1"}}
+	for i := 0; i < 2; i++ {
+		writeToPumps(keys, nil, time.Now(), 2)
+	}
+
+	now := time.Now()
+	assert.Equal(t, map[string]float64{"primary": 1, "secondary": 0}, WriteErrorRates.Load().rates(now))
+}
+
+func TestWriteErrorRatesHealthCheck(t *testing.T) {
+	SystemConfig.WriteErrorRateWindow = 60
+	defer func() {
+		SystemConfig.WriteErrorRateWindow = 0
+		WriteErrorRates.Store(nil)
+	}()
+	setupWriteErrorRates()
+	WriteErrorRates.Load().record("Recording Pump", false, time.Now())
+	WriteErrorRates.Load().record("Failing Pump", true, time.Now())
+
+	rw := httptest.NewRecorder()
+	server.Healthcheck(rw, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	response := struct {
+		Status          string             `json:"status"`
+		WriteErrorRates map[string]float64 `json:"write_error_rates"`
+	}{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &response))
+	assert.Equal(t, "ok", response.Status)
+	assert.Equal(t, map[string]float64{"Recording Pump": 0, "Failing Pump": 1}, response.WriteErrorRates)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/TykTechnologies/tyk-pump/pumps"
+)
+
+// filterRoute splits the records between a pump receiving the records matching the filters, at
+// full fidelity, and a pump receiving a sample of the others.
+type filterRoute struct {
+	filters     analytics.AnalyticsFilters
+	fullPump    pumps.Pump
+	sampledPump pumps.Pump
+	sampleRate  int
+	// unsampled counts the records skipped since the last sampled one, across the batches. It's
+	// guarded by writeMu.
+	unsampled int
+}
+
+// FilterRoutes are the routes of the filter_routes configuration.
+var FilterRoutes []*filterRoute
+
+// setupFilterRoutes builds the filter routes, looking up their pumps by configuration key. A
+// pump that failed to initialise is left out of its route, and a pump can only be part of one
+// route.
+func setupFilterRoutes(pumpsByKey map[string]pumps.Pump) {
+	FilterRoutes = nil
+	routed := map[string]bool{}
+
+	for _, routeConf := range SystemConfig.FilterRoutes {
+		route := &filterRoute{filters: routeConf.Filters, sampleRate: routeConf.SampleRate}
+		for _, key := range []string{routeConf.FullPump, routeConf.SampledPump} {
+			if routed[key] {
+				log.WithFields(logrus.Fields{
+					"prefix": mainPrefix,
+				}).Error("Pump ", key, " is part of several filter routes (skipping route)")
+				route = nil
+				break
+			}
+		}
+		if route == nil {
+			continue
+		}
+
+		route.fullPump = pumpsByKey[routeConf.FullPump]
+		route.sampledPump = pumpsByKey[routeConf.SampledPump]
+		if route.fullPump == nil || route.sampledPump == nil {
+			log.WithFields(logrus.Fields{
+				"prefix": mainPrefix,
+			}).Warning("Filter route pumps ", routeConf.FullPump, " and ", routeConf.SampledPump, " aren't both initialised")
+		}
+		routed[routeConf.FullPump] = true
+		routed[routeConf.SampledPump] = true
+		FilterRoutes = append(FilterRoutes, route)
+	}
+}
+
+// routeKeys returns, for the pumps of the filter routes, the indexes of the keys they receive:
+// the records matching the route filters for its full pump, and one of every sample_rate of the
+// others for its sampled pump.
+func routeKeys(keys []interface{}) map[pumps.Pump][]int {
+	if len(FilterRoutes) == 0 {
+		return nil
+	}
+
+	routed := map[pumps.Pump][]int{}
+	for _, route := range FilterRoutes {
+		full := []int{}
+		sampled := []int{}
+		for i, key := range keys {
+			record, ok := key.(analytics.AnalyticsRecord)
+			if !ok {
+				continue
+			}
+			if !route.filters.ShouldFilter(record) {
+				full = append(full, i)
+				continue
+			}
+			route.unsampled++
+			if route.unsampled >= route.sampleRate {
+				route.unsampled = 0
+				sampled = append(sampled, i)
+			}
+		}
+
+		if route.fullPump != nil {
+			routed[route.fullPump] = full
+		}
+		if route.sampledPump != nil {
+			routed[route.sampledPump] = sampled
+		}
+	}
+	return routed
+}
+
+// selectKeys returns the keys at indexes.
+func selectKeys(keys []interface{}, indexes []int) []interface{} {
+	selected := make([]interface{}, len(indexes))
+	for i, index := range indexes {
+		selected[i] = keys[index]
+	}
+	return selected
+}
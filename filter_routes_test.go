@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/TykTechnologies/tyk-pump/pumps"
+)
+
+func TestWriteToPumpsFilterRoutes(t *testing.T) {
+	SystemConfig.FilterRoutes = []FilterRouteConf{
+		{
+			Filters:     analytics.AnalyticsFilters{APIIDs: []string{"payments"}},
+			FullPump:    "full",
+			SampledPump: "sampled",
+			SampleRate:  3,
+		},
+	}
+	defer func() {
+		SystemConfig.FilterRoutes = nil
+		FilterRoutes = nil
+	}()
+
+	fullPump := &RecordingPump{}
+	sampledPump := &RecordingPump{}
+	otherPump := &RecordingPump{}
+	Pumps = []pumps.Pump{fullPump, sampledPump, otherPump}
+	setupFilterRoutes(map[string]pumps.Pump{"full": fullPump, "sampled": sampledPump, "other": otherPump})
+
+	keys := []interface{}{}
+	for i := 0; i < 10; i++ {
+		apiID := "catalog"
+		if i%4 == 0 {
+			apiID = "payments"
+		}
+		keys = append(keys, analytics.AnalyticsRecord{APIID: apiID, RequestTime: int64(i)})
+	}
+
+	writeToPumps(keys, instrument.NewJob("TestJob"), time.Now(), 2)
+
+	requestTimes := func(records []analytics.AnalyticsRecord) []int64 {
+		times := []int64{}
+		for _, record := range records {
+			times = append(times, record.RequestTime)
+		}
+		return times
+	}
+	// the matched records reach the full pump
+	assert.Equal(t, []int64{0, 4, 8}, requestTimes(fullPump.Records))
+	// one of every 3 other records reach the sampled pump
+	assert.Equal(t, []int64{3, 7}, requestTimes(sampledPump.Records))
+	// the pumps outside of the routes get all the records
+	assert.Len(t, otherPump.Records, 10)
+
+	// the sampling goes on across the batches
+	writeToPumps(keys[:3], instrument.NewJob("TestJob"), time.Now(), 2)
+	assert.Equal(t, []int64{0, 4, 8, 0}, requestTimes(fullPump.Records))
+	assert.Equal(t, []int64{3, 7, 2}, requestTimes(sampledPump.Records))
+}
+
+func TestSetupFilterRoutes(t *testing.T) {
+	SystemConfig.FilterRoutes = []FilterRouteConf{
+		{FullPump: "full", SampledPump: "sampled"},
+		{FullPump: "sampled", SampledPump: "other"},
+		{FullPump: "missing", SampledPump: "other"},
+	}
+	defer func() {
+		SystemConfig.FilterRoutes = nil
+		FilterRoutes = nil
+	}()
+
+	fullPump := &RecordingPump{}
+	sampledPump := &RecordingPump{}
+	otherPump := &RecordingPump{}
+	setupFilterRoutes(map[string]pumps.Pump{"full": fullPump, "sampled": sampledPump, "other": otherPump})
+
+	// the second route reuses a pump of the first one, the third misses its full pump
+	assert.Len(t, FilterRoutes, 2)
+	assert.Equal(t, fullPump, FilterRoutes[0].fullPump)
+	assert.Nil(t, FilterRoutes[1].fullPump)
+	assert.Equal(t, otherPump, FilterRoutes[1].sampledPump)
+
+	routed := routeKeys([]interface{}{analytics.AnalyticsRecord{}, analytics.AnalyticsRecord{}})
+	assert.Equal(t, map[pumps.Pump][]int{fullPump: {0, 1}, sampledPump: {}, otherPump: {}}, routed)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+// The policies of the records dated further in the future than max_future_skew.
+const (
+	// futureTimestampClamp sets the timestamp of the records to the current time.
+	futureTimestampClamp = "clamp"
+	// futureTimestampDrop drops the records.
+	futureTimestampDrop = "drop"
+)
+
+// dropReasonFutureTimestamp is used for the records dropped by the drop future_timestamp_policy.
+const dropReasonFutureTimestamp = "future_timestamp"
+
+// futureRecordsCounter counts the records dated further in the future than max_future_skew, per
+// applied policy.
+var futureRecordsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "tyk_pump_future_records_total",
+		Help: "Analytics records dated further in the future than max_future_skew, per policy",
+	},
+	[]string{"policy"},
+)
+
+func init() {
+	prometheus.MustRegister(futureRecordsCounter)
+}
+
+// setupFutureTimestamps validates future_timestamp_policy, which defaults to clamp.
+func setupFutureTimestamps() {
+	switch SystemConfig.FutureTimestampPolicy {
+	case "":
+		SystemConfig.FutureTimestampPolicy = futureTimestampClamp
+	case futureTimestampClamp, futureTimestampDrop:
+	default:
+		log.WithFields(logrus.Fields{
+			"prefix": mainPrefix,
+		}).Fatalf("Invalid future_timestamp_policy %q, must be %s or %s", SystemConfig.FutureTimestampPolicy, futureTimestampClamp, futureTimestampDrop)
+	}
+}
+
+// checkFutureTimestamp applies future_timestamp_policy to the record if it's dated more than
+// max_future_skew seconds after now. It reports whether the record must be kept.
+func checkFutureTimestamp(record *analytics.AnalyticsRecord, now time.Time) bool {
+	maxSkew := time.Duration(SystemConfig.MaxFutureSkew) * time.Second
+	if maxSkew <= 0 || !record.TimeStamp.After(now.Add(maxSkew)) {
+		return true
+	}
+
+	if SystemConfig.FutureTimestampPolicy == futureTimestampDrop {
+		futureRecordsCounter.WithLabelValues(futureTimestampDrop).Inc()
+		recordsDropped(dropReasonFutureTimestamp, "", 1)
+		return false
+	}
+
+	futureRecordsCounter.WithLabelValues(futureTimestampClamp).Inc()
+	record.TimeStamp = now
+	return true
+}
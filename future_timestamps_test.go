@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/TykTechnologies/tyk-pump/pumps"
+	"github.com/TykTechnologies/tyk-pump/serializer"
+)
+
+func TestPreprocessAnalyticsValuesFutureTimestamps(t *testing.T) {
+	defer func() {
+		SystemConfig.MaxFutureSkew = 0
+		SystemConfig.FutureTimestampPolicy = ""
+	}()
+
+	now := time.Now()
+	timestamps := []time.Time{now.Add(-time.Hour), now.Add(30 * time.Second), now.Add(time.Hour)}
+	msgpackSerializer := serializer.NewAnalyticsSerializer(serializer.MSGP_SERIALIZER)
+	values := []interface{}{}
+	for i, timestamp := range timestamps {
+		encoded, err := msgpackSerializer.Encode(&analytics.AnalyticsRecord{APIID: string(rune('a' + i)), TimeStamp: timestamp})
+		assert.Nil(t, err)
+		values = append(values, string(encoded))
+	}
+
+	tcs := []struct {
+		policy          string
+		expectedAPIIDs  []string
+		expectedDropped float64
+	}{
+		{policy: "", expectedAPIIDs: []string{"a", "b", "c"}},
+		{policy: futureTimestampClamp, expectedAPIIDs: []string{"a", "b", "c"}},
+		{policy: futureTimestampDrop, expectedAPIIDs: []string{"a", "b"}, expectedDropped: 1},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.policy, func(t *testing.T) {
+			SystemConfig.MaxFutureSkew = 60
+			SystemConfig.FutureTimestampPolicy = tc.policy
+			setupFutureTimestamps()
+			policy := SystemConfig.FutureTimestampPolicy
+			counted := testutil.ToFloat64(futureRecordsCounter.WithLabelValues(policy))
+			dropped := testutil.ToFloat64(droppedRecordsCounter.WithLabelValues(dropReasonFutureTimestamp, ""))
+
+			recordingPump := &RecordingPump{}
+			Pumps = []pumps.Pump{recordingPump}
+			PreprocessAnalyticsValues(values, msgpackSerializer, "analytics", false, instrument.NewJob("TestJob"), time.Now(), 2)
+
+			apiIDs := []string{}
+			for _, record := range recordingPump.Records {
+				apiIDs = append(apiIDs, record.APIID)
+				switch record.APIID {
+				case "a", "b":
+					// within the skew, the timestamps are kept
+					assert.True(t, record.TimeStamp.Equal(timestamps[record.APIID[0]-'a']))
+				case "c":
+					// clamped to now
+					assert.WithinDuration(t, time.Now(), record.TimeStamp, 5*time.Second)
+				}
+			}
+			assert.Equal(t, tc.expectedAPIIDs, apiIDs)
+			assert.Equal(t, counted+1, testutil.ToFloat64(futureRecordsCounter.WithLabelValues(policy)))
+			assert.Equal(t, dropped+tc.expectedDropped, testutil.ToFloat64(droppedRecordsCounter.WithLabelValues(dropReasonFutureTimestamp, "")))
+		})
+	}
+}
+
+func TestCheckFutureTimestampDisabled(t *testing.T) {
+	now := time.Now()
+	record := analytics.AnalyticsRecord{TimeStamp: now.Add(24 * time.Hour)}
+	assert.True(t, checkFutureTimestamp(&record, now))
+	assert.True(t, record.TimeStamp.Equal(now.Add(24*time.Hour)))
+}
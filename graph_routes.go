@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/TykTechnologies/tyk-pump/pumps"
+)
+
+// GraphPumps are the pumps of the graph_pumps configuration. When it's set, they receive the
+// GraphQL records only, and the other pumps the rest.
+var GraphPumps map[pumps.Pump]bool
+
+// setupGraphPumps looks up the graph pumps by configuration key. A pump that failed to initialise
+// is left out.
+func setupGraphPumps(pumpsByKey map[string]pumps.Pump) {
+	GraphPumps = nil
+	if len(SystemConfig.GraphPumps) == 0 {
+		return
+	}
+
+	GraphPumps = map[pumps.Pump]bool{}
+	for _, key := range SystemConfig.GraphPumps {
+		pmp, ok := pumpsByKey[key]
+		if !ok {
+			log.WithFields(logrus.Fields{
+				"prefix": mainPrefix,
+			}).Warning("Graph pump ", key, " isn't initialised")
+			continue
+		}
+		GraphPumps[pmp] = true
+	}
+}
+
+// graphRouteKeys returns the keys of pmp when the graph pumps are set: the GraphQL records for
+// a graph pump, which converts them with ToGraphRecord, and the others for the rest of the pumps.
+func graphRouteKeys(pmp pumps.Pump, keys []interface{}) []interface{} {
+	isGraphPump := GraphPumps[pmp]
+	selected := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		record, ok := key.(analytics.AnalyticsRecord)
+		if ok && record.IsGraphRecord() == isGraphPump {
+			selected = append(selected, key)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/TykTechnologies/tyk-pump/pumps"
+)
+
+// GraphRecordingPump converts the records it receives to graph records, as the graph pumps do.
+type GraphRecordingPump struct {
+	GraphRecords []analytics.GraphRecord
+	pumps.CommonPumpConfig
+}
+
+func (p *GraphRecordingPump) GetName() string {
+	return "Graph Recording Pump"
+}
+
+func (p *GraphRecordingPump) New() pumps.Pump {
+	return &GraphRecordingPump{}
+}
+
+func (p *GraphRecordingPump) Init(config interface{}) error {
+	return nil
+}
+
+func (p *GraphRecordingPump) WriteData(ctx context.Context, keys []interface{}) error {
+	for _, key := range keys {
+		record := key.(analytics.AnalyticsRecord)
+		p.GraphRecords = append(p.GraphRecords, record.ToGraphRecord())
+	}
+	return nil
+}
+
+func TestWriteToPumpsGraphPumps(t *testing.T) {
+	defer func() {
+		GraphPumps = nil
+		SystemConfig.GraphPumps = nil
+	}()
+
+	graphPump := &GraphRecordingPump{}
+	otherPump := &RecordingPump{}
+	Pumps = []pumps.Pump{graphPump, otherPump}
+	SystemConfig.GraphPumps = []string{"graph", "missing"}
+	setupGraphPumps(map[string]pumps.Pump{"graph": graphPump, "other": otherPump})
+	assert.Equal(t, map[pumps.Pump]bool{graphPump: true}, GraphPumps)
+
+	graphRecord := analytics.AnalyticsRecord{
+		APIID: "graph-api",
+		GraphQLStats: analytics.GraphQLStats{
+			IsGraphQL:     true,
+			OperationType: analytics.OperationQuery,
+			RootFields:    []string{"country"},
+		},
+	}
+	plainRecord := analytics.AnalyticsRecord{APIID: "rest-api"}
+	writeToPumps([]interface{}{graphRecord, plainRecord}, instrument.NewJob("TestJob"), time.Now(), 2)
+
+	// the graph record is converted by the graph pump
+	assert.Len(t, graphPump.GraphRecords, 1)
+	assert.Equal(t, "graph-api", graphPump.GraphRecords[0].AnalyticsRecord.APIID)
+	assert.Equal(t, "Query", graphPump.GraphRecords[0].OperationType)
+	assert.Equal(t, []string{"country"}, graphPump.GraphRecords[0].RootFields)
+
+	// the plain record goes to the rest of the pumps
+	assert.Len(t, otherPump.Records, 1)
+	assert.Equal(t, "rest-api", otherPump.Records[0].APIID)
+
+	// without graph pumps, all the pumps receive all the records
+	SystemConfig.GraphPumps = nil
+	setupGraphPumps(map[string]pumps.Pump{"graph": graphPump, "other": otherPump})
+	assert.Nil(t, GraphPumps)
+	writeToPumps([]interface{}{graphRecord, plainRecord}, instrument.NewJob("TestJob"), time.Now(), 2)
+	assert.Len(t, otherPump.Records, 3)
+}
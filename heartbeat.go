@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+// HeartbeatTag is the tag of the synthetic heartbeat records.
+const HeartbeatTag = "tyk-pump-heartbeat"
+
+// newHeartbeatRecord returns a heartbeat record timestamped at now. Its path is the heartbeat
+// tag and its host the hostname of the pump, so it can be told apart from the API traffic.
+func newHeartbeatRecord(now time.Time) analytics.AnalyticsRecord {
+	hostname, _ := os.Hostname()
+	now = now.UTC()
+	return analytics.AnalyticsRecord{
+		Method:    "HEARTBEAT",
+		Host:      hostname,
+		Path:      "/" + HeartbeatTag,
+		RawPath:   "/" + HeartbeatTag,
+		Day:       now.Day(),
+		Month:     now.Month(),
+		Year:      now.Year(),
+		Hour:      now.Hour(),
+		TimeStamp: now,
+		Tags:      []string{HeartbeatTag},
+	}
+}
+
+// StartHeartbeat writes a heartbeat record to the HeartbeatPumps each interval until ctx is done,
+// so its absence downstream can be alerted on. A zero or negative interval disables the heartbeat.
+func StartHeartbeat(ctx context.Context, interval time.Duration, purgeDelay int) {
+	if interval <= 0 {
+		return
+	}
+	if len(HeartbeatPumps) == 0 {
+		log.WithFields(logrus.Fields{
+			"prefix": mainPrefix,
+		}).Warning("heartbeat_interval is set but no pump is listed in heartbeat_pumps, the heartbeat is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			job := instrument.NewJob("Heartbeat")
+			log.WithFields(logrus.Fields{
+				"prefix": mainPrefix,
+			}).Debug("Writing heartbeat record")
+			writeToSelectedPumps(HeartbeatPumps, []interface{}{newHeartbeatRecord(now)}, job, now, purgeDelay)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/pumps"
+)
+
+func TestStartHeartbeat(t *testing.T) {
+	recordingPump := &RecordingPump{}
+	otherPump := &RecordingPump{}
+	Pumps = []pumps.Pump{recordingPump, otherPump}
+	HeartbeatPumps = []pumps.Pump{recordingPump}
+	defer func() {
+		HeartbeatPumps = nil
+	}()
+
+	records := func() int {
+		recordingPump.mu.Lock()
+		defer recordingPump.mu.Unlock()
+		return len(recordingPump.Records)
+	}
+
+	const interval = 50 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		defer close(done)
+		StartHeartbeat(ctx, interval, 2)
+	}()
+
+	// a heartbeat is written every interval
+	assert.Eventually(t, func() bool {
+		return records() >= 3
+	}, time.Second, 5*time.Millisecond)
+	assert.GreaterOrEqual(t, time.Since(start), 3*interval)
+
+	cancel()
+	<-done
+	written := records()
+	time.Sleep(2 * interval)
+	assert.Equal(t, written, records(), "no heartbeat is written once stopped")
+	assert.Empty(t, otherPump.Records, "the heartbeat is only written to the heartbeat pumps")
+
+	recordingPump.mu.Lock()
+	defer recordingPump.mu.Unlock()
+	for i, record := range recordingPump.Records {
+		assert.Equal(t, []string{HeartbeatTag}, record.Tags)
+		assert.Equal(t, "HEARTBEAT", record.Method)
+		assert.Equal(t, "/"+HeartbeatTag, record.Path)
+		if i > 0 {
+			assert.GreaterOrEqual(t, record.TimeStamp.Sub(recordingPump.Records[i-1].TimeStamp), interval/2)
+		}
+	}
+}
+
+func TestStartHeartbeatDisabled(t *testing.T) {
+	recordingPump := &RecordingPump{}
+	Pumps = []pumps.Pump{recordingPump}
+
+	// returns right away
+	StartHeartbeat(context.Background(), 0, 2)
+	assert.Empty(t, recordingPump.Records)
+
+	// no pump receives the heartbeat
+	HeartbeatPumps = nil
+	StartHeartbeat(context.Background(), time.Millisecond, 2)
+	assert.Empty(t, recordingPump.Records)
+}
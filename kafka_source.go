@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk-pump/serializer"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+var kafkaSourcePrefix = "kafka-source"
+
+const (
+	kafkaSourceDefaultGroupID   = "tyk-pump"
+	kafkaSourceDefaultBatchSize = 1000
+)
+
+// kafkaSourceReader is the part of kafka.Reader used by the Kafka source.
+type kafkaSourceReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// KafkaSource consumes analytics records from a Kafka topic and sends them to the pumps.
+type KafkaSource struct {
+	conf          KafkaSourceConf
+	reader        kafkaSourceReader
+	serializer    serializer.AnalyticsSerializer
+	flushInterval time.Duration
+	// fetchBackOff spaces the fetches out while they fail.
+	fetchBackOff backoff.BackOff
+	log          *logrus.Entry
+}
+
+// NewKafkaSource returns a KafkaSource consuming from the configured topic, or nil if the source
+// isn't configured.
+func NewKafkaSource(conf KafkaSourceConf, flushInterval time.Duration) (*KafkaSource, error) {
+	if len(conf.Brokers) == 0 || conf.Topic == "" {
+		return nil, nil
+	}
+	if conf.GroupID == "" {
+		conf.GroupID = kafkaSourceDefaultGroupID
+	}
+
+	var startOffset int64
+	switch conf.StartOffset {
+	case "", "first":
+		startOffset = kafka.FirstOffset
+	case "last":
+		startOffset = kafka.LastOffset
+	default:
+		return nil, errors.New("invalid kafka_source.start_offset value: " + conf.StartOffset)
+	}
+
+	switch conf.Format {
+	case "", serializer.MSGP_SERIALIZER, serializer.PROTOBUF_SERIALIZER:
+	default:
+		return nil, errors.New("invalid kafka_source.format value: " + conf.Format)
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     conf.Brokers,
+		Topic:       conf.Topic,
+		GroupID:     conf.GroupID,
+		StartOffset: startOffset,
+		MinBytes:    1,
+		MaxBytes:    10e6,
+	})
+
+	return newKafkaSource(conf, reader, flushInterval), nil
+}
+
+func newKafkaSource(conf KafkaSourceConf, reader kafkaSourceReader, flushInterval time.Duration) *KafkaSource {
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = kafkaSourceDefaultBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+
+	fetchBackOff := backoff.NewExponentialBackOff()
+	// the fetches are retried as long as the source runs
+	fetchBackOff.MaxElapsedTime = 0
+
+	return &KafkaSource{
+		conf:          conf,
+		reader:        reader,
+		serializer:    serializer.NewAnalyticsSerializer(conf.Format),
+		flushInterval: flushInterval,
+		fetchBackOff:  fetchBackOff,
+		log:           log.WithField("prefix", kafkaSourcePrefix),
+	}
+}
+
+// Start consumes the topic until ctx is done. The offsets of a batch are committed once it's
+// handed to the pumps, whether their writes succeed or not, and with concurrent_writes before the
+// queued writes are done. So the failed writes aren't retried from Kafka: the records are
+// delivered at most once to the pumps failing to write them. The fetches failing are retried
+// with an exponential backoff.
+func (k *KafkaSource) Start(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	k.log.Info("Consuming analytics from topic: ", k.conf.Topic)
+
+	for {
+		messages, err := k.fetchBatch(ctx)
+		if len(messages) > 0 {
+			k.dispatch(messages)
+		}
+		if err != nil {
+			wait := k.fetchBackOff.NextBackOff()
+			k.log.Error("Error fetching Kafka message, retrying in ", wait, ": ", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(wait):
+			}
+		} else {
+			k.fetchBackOff.Reset()
+		}
+
+		if ctx.Err() != nil {
+			if err := k.reader.Close(); err != nil {
+				k.log.Error("Error closing the Kafka reader: ", err)
+			}
+			return
+		}
+	}
+}
+
+// fetchBatch returns the messages fetched until the batch size or the flush interval is reached,
+// or the fetch error ending the batch early, if any.
+func (k *KafkaSource) fetchBatch(ctx context.Context) ([]kafka.Message, error) {
+	fetchCtx, cancel := context.WithTimeout(ctx, k.flushInterval)
+	defer cancel()
+
+	var messages []kafka.Message
+	for len(messages) < k.conf.BatchSize {
+		msg, err := k.reader.FetchMessage(fetchCtx)
+		if err != nil {
+			if fetchCtx.Err() == nil {
+				return messages, err
+			}
+			break
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// dispatch sends the records of messages to the pumps and commits their offsets.
+func (k *KafkaSource) dispatch(messages []kafka.Message) {
+	job := instrument.NewJob("KafkaSourceRecordsPurge")
+	startTime := time.Now()
+
+	values := make([]interface{}, len(messages))
+	for i, msg := range messages {
+		values[i] = string(msg.Value)
+	}
+	PreprocessAnalyticsValues(values, k.serializer, k.conf.Topic, SystemConfig.OmitDetailedRecording, job, startTime, int(k.flushInterval.Seconds()))
+	writeBatchSummary(job, startTime, int(k.flushInterval.Seconds()))
+
+	if err := k.reader.CommitMessages(context.Background(), messages...); err != nil {
+		k.log.Error("Error committing Kafka offsets: ", err)
+	}
+	k.log.Debug("Consumed ", len(messages), " records")
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/TykTechnologies/tyk-pump/pumps"
+	"github.com/TykTechnologies/tyk-pump/serializer"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeKafkaReader serves the queued messages, blocking until ctx is done once they're consumed.
+// With err, every fetch fails.
+type fakeKafkaReader struct {
+	mu        sync.Mutex
+	messages  []kafka.Message
+	committed []kafka.Message
+	closed    bool
+	err       error
+	fetches   int
+}
+
+func (r *fakeKafkaReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	r.fetches++
+	if r.err != nil {
+		r.mu.Unlock()
+		return kafka.Message{}, r.err
+	}
+	if len(r.messages) > 0 {
+		msg := r.messages[0]
+		r.messages = r.messages[1:]
+		r.mu.Unlock()
+		return msg, nil
+	}
+	r.mu.Unlock()
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeKafkaReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = append(r.committed, msgs...)
+	return nil
+}
+
+func (r *fakeKafkaReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+func (r *fakeKafkaReader) committedCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.committed)
+}
+
+func (r *fakeKafkaReader) fetchCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.fetches
+}
+
+func TestKafkaSource(t *testing.T) {
+	tcs := []struct {
+		testName string
+		format   string
+	}{
+		{testName: "msgpack", format: serializer.MSGP_SERIALIZER},
+		{testName: "protobuf", format: serializer.PROTOBUF_SERIALIZER},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			mockedPump := &MockedPump{}
+			Pumps = []pumps.Pump{mockedPump}
+
+			recordSerializer := serializer.NewAnalyticsSerializer(tc.format)
+			reader := &fakeKafkaReader{}
+			for i := 0; i < 5; i++ {
+				encoded, err := recordSerializer.Encode(&analytics.AnalyticsRecord{APIID: "api1", OrgID: "org1"})
+				assert.Nil(t, err)
+				reader.messages = append(reader.messages, kafka.Message{Offset: int64(i), Value: encoded})
+			}
+
+			source := newKafkaSource(KafkaSourceConf{Topic: "analytics", Format: tc.format, BatchSize: 2}, reader, 50*time.Millisecond)
+
+			wg := sync.WaitGroup{}
+			wg.Add(1)
+			ctx, cancel := context.WithCancel(context.Background())
+			go source.Start(ctx, &wg)
+
+			assert.Eventually(t, func() bool { return reader.committedCount() == 5 }, time.Second, 10*time.Millisecond)
+			cancel()
+			assert.True(t, waitWithTimeout(&wg, time.Second))
+
+			assert.Equal(t, 5, mockedPump.CounterRequest)
+			assert.True(t, reader.closed)
+		})
+	}
+}
+
+// slowWritePump records how many records it had been written when it was shut down.
+type slowWritePump struct {
+	MockedPump
+	writtenAtShutdown int
+}
+
+func (p *slowWritePump) WriteData(ctx context.Context, keys []interface{}) error {
+	time.Sleep(50 * time.Millisecond)
+	return p.MockedPump.WriteData(ctx, keys)
+}
+
+func (p *slowWritePump) Shutdown() error {
+	p.writtenAtShutdown = p.CounterRequest
+	return p.MockedPump.Shutdown()
+}
+
+func TestKafkaSourceShutdown(t *testing.T) {
+	pump := &slowWritePump{}
+	Pumps = []pumps.Pump{pump}
+
+	recordSerializer := serializer.NewAnalyticsSerializer(serializer.MSGP_SERIALIZER)
+	reader := &fakeKafkaReader{}
+	for i := 0; i < 5; i++ {
+		encoded, err := recordSerializer.Encode(&analytics.AnalyticsRecord{APIID: "api1", OrgID: "org1"})
+		assert.Nil(t, err)
+		reader.messages = append(reader.messages, kafka.Message{Offset: int64(i), Value: encoded})
+	}
+	source := newKafkaSource(KafkaSourceConf{Topic: "analytics", BatchSize: 10}, reader, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	Producers.Add(1)
+	go source.Start(ctx, &Producers)
+	cancel()
+
+	// the pumps are shut down once the batch fetched before the cancellation is written
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	assert.True(t, checkShutdown(ctx, &wg))
+	assert.True(t, pump.TurnedOff)
+	assert.Equal(t, 5, pump.writtenAtShutdown)
+	assert.Equal(t, 5, reader.committedCount())
+}
+
+func TestKafkaSourceFetchBackOff(t *testing.T) {
+	reader := &fakeKafkaReader{err: errors.New("broker unavailable")}
+	source := newKafkaSource(KafkaSourceConf{Topic: "analytics"}, reader, time.Second)
+	source.fetchBackOff = backoff.NewConstantBackOff(100 * time.Millisecond)
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	go source.Start(ctx, &wg)
+	time.Sleep(350 * time.Millisecond)
+	cancel()
+	assert.True(t, waitWithTimeout(&wg, time.Second))
+
+	// the failing fetches are spaced out rather than retried right away
+	assert.GreaterOrEqual(t, reader.fetchCount(), 2)
+	assert.LessOrEqual(t, reader.fetchCount(), 5)
+	assert.True(t, reader.closed)
+}
+
+func TestNewKafkaSource(t *testing.T) {
+	source, err := NewKafkaSource(KafkaSourceConf{}, time.Second)
+	assert.Nil(t, err)
+	assert.Nil(t, source)
+
+	_, err = NewKafkaSource(KafkaSourceConf{Brokers: []string{"localhost:9092"}, Topic: "analytics", StartOffset: "invalid"}, time.Second)
+	assert.NotNil(t, err)
+
+	_, err = NewKafkaSource(KafkaSourceConf{Brokers: []string{"localhost:9092"}, Topic: "analytics", Format: "invalid"}, time.Second)
+	assert.NotNil(t, err)
+
+	source, err = NewKafkaSource(KafkaSourceConf{Brokers: []string{"localhost:9092"}, Topic: "analytics"}, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, kafkaSourceDefaultGroupID, source.conf.GroupID)
+	assert.Equal(t, kafkaSourceDefaultBatchSize, source.conf.BatchSize)
+	assert.Nil(t, source.reader.Close())
+}
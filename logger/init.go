@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"fmt"
 	"os"
 	"strings"
 
@@ -9,6 +10,22 @@ import (
 
 var log = logrus.New()
 
+// The fields of the entries logged for the writes to the pumps, so they're consistent across the
+// JSON logs. The duration is in milliseconds.
+const (
+	FieldPump      = "pump"
+	FieldBatchSize = "batch_size"
+	FieldDuration  = "duration"
+	// the key of logrus WithError
+	FieldError = "error"
+)
+
+// The log formats of SetFormat.
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
 func init() {
 	log.Level = level(os.Getenv("TYK_LOGLEVEL"))
 	log.Formatter = formatter()
@@ -27,6 +44,22 @@ func level(level string) logrus.Level {
 	}
 }
 
+// ParseLevel returns the level named level, one of error, warn, info and debug.
+func ParseLevel(level string) (logrus.Level, error) {
+	switch strings.ToLower(level) {
+	case "error":
+		return logrus.ErrorLevel, nil
+	case "warn", "warning":
+		return logrus.WarnLevel, nil
+	case "info":
+		return logrus.InfoLevel, nil
+	case "debug":
+		return logrus.DebugLevel, nil
+	default:
+		return logrus.InfoLevel, fmt.Errorf("invalid log level %q, must be error, warn, info or debug", level)
+	}
+}
+
 func formatter() *logrus.TextFormatter {
 	formatter := new(logrus.TextFormatter)
 	formatter.TimestampFormat = `Jan 02 15:04:05`
@@ -35,6 +68,24 @@ func formatter() *logrus.TextFormatter {
 	return formatter
 }
 
+func jsonFormatter() *logrus.JSONFormatter {
+	return &logrus.JSONFormatter{TimestampFormat: "2006-01-02T15:04:05.000Z07:00"}
+}
+
+// SetFormat switches the logger to the text or JSON format. With the JSON format each entry is a
+// JSON object with the `time`, `level` and `msg` keys, along with its fields.
+func SetFormat(format string) error {
+	switch strings.ToLower(format) {
+	case "", TextFormat:
+		log.Formatter = formatter()
+	case JSONFormat:
+		log.Formatter = jsonFormatter()
+	default:
+		return fmt.Errorf("invalid log format %q, must be text or json", format)
+	}
+	return nil
+}
+
 func GetLogger() *logrus.Logger {
 	return log
 }
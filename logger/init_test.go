@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -93,3 +95,47 @@ func Test_GetLogger(t *testing.T) {
 		})
 	}
 }
+
+func TestSetFormat(t *testing.T) {
+	defer func() {
+		log.Formatter = formatter()
+		log.Out = os.Stderr
+	}()
+
+	var buf strings.Builder
+	log.Out = &buf
+
+	if err := SetFormat("json"); err != nil {
+		t.Fatal(err)
+	}
+	log.WithFields(logrus.Fields{
+		"prefix":       "main",
+		FieldPump:      "CSV Pump",
+		FieldBatchSize: 10,
+		FieldDuration:  5,
+	}).WithError(errors.New("write failed")).Warning("Error Writing to: CSV Pump")
+
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(buf.String()), &entry); err != nil {
+		t.Fatalf("the log entry %q isn't valid JSON: %v", buf.String(), err)
+	}
+	for _, key := range []string{"time", "level", "msg", "prefix", FieldPump, FieldBatchSize, FieldDuration, FieldError} {
+		if _, ok := entry[key]; !ok {
+			t.Errorf("the log entry doesn't have the %q key: %v", key, entry)
+		}
+	}
+	if entry[FieldError] != "write failed" || entry["level"] != "warning" {
+		t.Errorf("unexpected log entry: %v", entry)
+	}
+
+	if err := SetFormat("text"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := log.Formatter.(*logrus.TextFormatter); !ok {
+		t.Errorf("expected the text formatter, got %T", log.Formatter)
+	}
+
+	if err := SetFormat("xml"); err == nil {
+		t.Error("expected an error for an invalid format")
+	}
+}
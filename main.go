@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path"
 	"strings"
 	"sync"
 	"syscall"
@@ -29,6 +30,36 @@ var UptimeStorage storage.AnalyticsStorage
 var Pumps []pumps.Pump
 var UptimePump pumps.UptimePump
 var AnalyticsSerializers []serializer.AnalyticsSerializer
+var RawDataEncryptor *analytics.RawDataEncryptor
+var BotDetector *analytics.BotDetector
+var BodyTagger *analytics.BodyTagger
+var PIIDetector *analytics.PIIDetector
+var DetailedRecordingSampler *analytics.DetailedRecordingSampler
+var TLSInfoSources *analytics.TLSInfoSources
+var LatencyPhasesTags *analytics.LatencyPhasesTags
+var CorrelationIDHeaders []string
+var CacheStatusHeaders []string
+var EndpointTagPrefix string
+var NodeIDTagPrefix string
+var JWTClaimsExtractor *analytics.JWTClaimsExtractor
+var KeyHasher *analytics.KeyHasher
+
+// KeyHashingBypass holds the pumps receiving the keys of the records unhashed.
+var KeyHashingBypass = map[pumps.Pump]bool{}
+
+// PumpKeys holds the keys of the pumps in the pumps configuration, which tell apart the pumps of
+// the same type.
+var PumpKeys = map[pumps.Pump]string{}
+
+// HeartbeatPumps holds the pumps receiving the heartbeat records.
+var HeartbeatPumps []pumps.Pump
+
+// BatchSummaryPumps holds the pumps receiving the summaries of the purges.
+var BatchSummaryPumps []pumps.Pump
+
+// Producers tracks the goroutines writing to the pumps besides the purge loop (the Kafka source and
+// the heartbeat), so the pumps are only shut down once they've stopped.
+var Producers sync.WaitGroup
 
 var log = logger.GetLogger()
 
@@ -54,8 +85,10 @@ func Init() {
 	kingpin.Parse()
 	LoadConfig(conf, &SystemConfig)
 
-	if SystemConfig.LogFormat == "json" {
-		log.Formatter = &logrus.JSONFormatter{}
+	if err := logger.SetFormat(SystemConfig.LogFormat); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": mainPrefix,
+		}).Error(err)
 	}
 
 	envDemo := os.Getenv("TYK_PMP_BUILDDEMODATA")
@@ -117,6 +150,219 @@ func setupAnalyticsStore() {
 	UptimeStorage.Init(uptimeConf)
 }
 
+func setupRawDataEncryption() {
+	RawDataEncryptor = nil
+	encryptionConf := SystemConfig.RawDataEncryption
+	if encryptionConf.Key == "" {
+		return
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encryptionConf.Key)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": mainPrefix,
+		}).Fatal("Invalid raw_data_encryption key, it must be base64 encoded: ", err)
+	}
+	RawDataEncryptor, err = analytics.NewRawDataEncryptor(encryptionConf.KeyID, key)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": mainPrefix,
+		}).Fatal("Couldn't setup the raw data encryption: ", err)
+	}
+	log.WithFields(logrus.Fields{
+		"prefix": mainPrefix,
+	}).Info("Raw data encryption enabled with key id: ", encryptionConf.KeyID)
+}
+
+func setupBotDetection() {
+	BotDetector = nil
+	detectionConf := SystemConfig.BotDetection
+	if !detectionConf.Enabled {
+		return
+	}
+
+	var err error
+	BotDetector, err = analytics.NewBotDetector(detectionConf.UserAgents, detectionConf.UserAgentPatterns)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": mainPrefix,
+		}).Fatal("Couldn't setup the bot detection: ", err)
+	}
+}
+
+func setupRequestBodyTags() {
+	BodyTagger = nil
+	tagsConf := SystemConfig.RequestBodyTags
+	if len(tagsConf.Fields) == 0 {
+		return
+	}
+
+	var err error
+	BodyTagger, err = analytics.NewBodyTagger(tagsConf.Fields, tagsConf.MaxBodySize)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": mainPrefix,
+		}).Fatal("Couldn't setup the request body tags: ", err)
+	}
+}
+
+func setupDetailedRecordingRates() {
+	DetailedRecordingSampler = nil
+	if len(SystemConfig.DetailedRecordingRates) == 0 {
+		return
+	}
+
+	var err error
+	DetailedRecordingSampler, err = analytics.NewDetailedRecordingSampler(SystemConfig.DetailedRecordingRates)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": mainPrefix,
+		}).Fatal("Couldn't setup the detailed recording rates: ", err)
+	}
+}
+
+func setupPIIDetection() {
+	PIIDetector = nil
+	detectionConf := SystemConfig.PIIDetection
+	if !detectionConf.Enabled {
+		return
+	}
+
+	var err error
+	PIIDetector, err = analytics.NewPIIDetector(detectionConf.Patterns, detectionConf.MaxBodySize)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": mainPrefix,
+		}).Fatal("Couldn't setup the PII detection: ", err)
+	}
+}
+
+func setupTLSInfo() {
+	TLSInfoSources = nil
+	tlsConf := SystemConfig.TLSInfo
+	if !tlsConf.Enabled {
+		return
+	}
+
+	TLSInfoSources = &analytics.TLSInfoSources{
+		VersionTag:    tlsConf.VersionTag,
+		CipherTag:     tlsConf.CipherTag,
+		VersionHeader: tlsConf.VersionHeader,
+		CipherHeader:  tlsConf.CipherHeader,
+	}
+	if TLSInfoSources.VersionTag == "" {
+		TLSInfoSources.VersionTag = analytics.DefaultTLSVersionTag
+	}
+	if TLSInfoSources.CipherTag == "" {
+		TLSInfoSources.CipherTag = analytics.DefaultTLSCipherTag
+	}
+}
+
+func setupLatencyPhases() {
+	LatencyPhasesTags = nil
+	phasesConf := SystemConfig.LatencyPhases
+	if !phasesConf.Enabled {
+		return
+	}
+
+	LatencyPhasesTags = &analytics.LatencyPhasesTags{
+		DNSTag:     phasesConf.DNSTag,
+		ConnectTag: phasesConf.ConnectTag,
+		TLSTag:     phasesConf.TLSTag,
+	}
+	if LatencyPhasesTags.DNSTag == "" {
+		LatencyPhasesTags.DNSTag = analytics.DefaultLatencyDNSTag
+	}
+	if LatencyPhasesTags.ConnectTag == "" {
+		LatencyPhasesTags.ConnectTag = analytics.DefaultLatencyConnectTag
+	}
+	if LatencyPhasesTags.TLSTag == "" {
+		LatencyPhasesTags.TLSTag = analytics.DefaultLatencyTLSTag
+	}
+}
+
+func setupGraphQLVariables() {
+	analytics.StoredGraphVariables = analytics.GraphVariablesLimits{
+		MaxSize:       SystemConfig.GraphQLVariables.MaxSize,
+		RedactedNames: SystemConfig.GraphQLVariables.RedactedNames,
+	}
+}
+
+func setupCorrelationID() {
+	CorrelationIDHeaders = nil
+	for _, header := range SystemConfig.CorrelationID.Headers {
+		if header = strings.TrimSpace(header); header != "" {
+			CorrelationIDHeaders = append(CorrelationIDHeaders, header)
+		}
+	}
+}
+
+func setupCacheStatus() {
+	CacheStatusHeaders = nil
+	if !SystemConfig.CacheStatus.Enabled {
+		return
+	}
+
+	for _, header := range SystemConfig.CacheStatus.Headers {
+		if header = strings.TrimSpace(header); header != "" {
+			CacheStatusHeaders = append(CacheStatusHeaders, header)
+		}
+	}
+	if len(CacheStatusHeaders) == 0 {
+		CacheStatusHeaders = analytics.DefaultCacheStatusHeaders
+	}
+}
+
+func setupJWTClaims() {
+	JWTClaimsExtractor = nil
+	claimsConf := SystemConfig.JWTClaims
+	if !claimsConf.Enabled {
+		return
+	}
+
+	JWTClaimsExtractor = analytics.NewJWTClaimsExtractor(claimsConf.Header, claimsConf.SubjectClaim, claimsConf.Claims)
+}
+
+func setupEndpoint() {
+	EndpointTagPrefix = ""
+	if !SystemConfig.Endpoint.Enabled {
+		return
+	}
+
+	EndpointTagPrefix = SystemConfig.Endpoint.TagPrefix
+	if EndpointTagPrefix == "" {
+		EndpointTagPrefix = analytics.DefaultEndpointTagPrefix
+	}
+}
+
+func setupNodeID() {
+	NodeIDTagPrefix = ""
+	if !SystemConfig.NodeID.Enabled {
+		return
+	}
+
+	NodeIDTagPrefix = SystemConfig.NodeID.TagPrefix
+	if NodeIDTagPrefix == "" {
+		NodeIDTagPrefix = analytics.DefaultNodeIDTagPrefix
+	}
+}
+
+func setupKeyHashing() {
+	KeyHasher = nil
+	hashingConf := SystemConfig.KeyHashing
+	if !hashingConf.Enabled {
+		return
+	}
+
+	var err error
+	KeyHasher, err = analytics.NewKeyHasher(hashingConf.Algorithm, hashingConf.Salt)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": mainPrefix,
+		}).Fatal("Couldn't setup the key hashing: ", err)
+	}
+}
+
 func storeVersion() {
 	var versionStore = &storage.RedisClusterStorageManager{}
 	versionConf := SystemConfig.AnalyticsStorageConfig
@@ -128,8 +374,28 @@ func storeVersion() {
 
 func initialisePumps() {
 	Pumps = []pumps.Pump{}
+	PumpKeys = map[pumps.Pump]string{}
+	KeyHashingBypass = map[pumps.Pump]bool{}
+	HeartbeatPumps = nil
+	BatchSummaryPumps = nil
+	pumpsByKey := map[string]pumps.Pump{}
+
+	order, err := pumpInitOrder(SystemConfig.Pumps)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": mainPrefix,
+		}).Fatal("Pump load error: ", err)
+	}
+
+	for _, key := range order {
+		pmp := SystemConfig.Pumps[key]
+		if dependency := failedPumpDependency(pmp, pumpsByKey); dependency != "" {
+			log.WithFields(logrus.Fields{
+				"prefix": mainPrefix,
+			}).Error("Pump load error (skipping): ", key, " depends on ", dependency, " which isn't loaded")
+			continue
+		}
 
-	for key, pmp := range SystemConfig.Pumps {
 		pumpTypeName := pmp.Type
 		if pumpTypeName == "" {
 			pumpTypeName = key
@@ -147,9 +413,39 @@ func initialisePumps() {
 			thisPmp.SetOmitDetailedRecording(pmp.OmitDetailedRecording)
 			thisPmp.SetMaxRecordSize(pmp.MaxRecordSize)
 			thisPmp.SetIgnoreFields(pmp.IgnoreFields)
+			thisPmp.SetAllowedFields(pmp.Fields)
+			thisPmp.SetCollapseWindow(pmp.CollapseWindow)
+			thisPmp.SetSortByTimestamp(pmp.SortByTimestamp)
+			thisPmp.SetSampling(pmp.Sampling)
+			thisPmp.SetErrorLogSampling(pmp.ErrorLogSampling)
+			if pmp.ProcessedBy {
+				thisPmp.SetProcessedBy(key)
+			}
+			thisPmp.SetLogSampleRate(pmp.LogSampleRate)
 			thisPmp.SetDecodingRequest(pmp.DecodeRawRequest)
 			thisPmp.SetDecodingResponse(pmp.DecodeRawResponse)
-			initErr := thisPmp.Init(pmp.Meta)
+			thisPmp.SetDetailedRecordingAPIIDs(pmp.DetailedRecordingAPIIDs)
+			var initErr error
+			if pmp.AggregateBuffer.FlushInterval > 0 && !pumps.IsAggregatePump(thisPmp) {
+				initErr = fmt.Errorf("aggregate_buffer is only supported by the aggregate pumps, not %s", pumpTypeName)
+			} else {
+				initErr = initPumpWithRetries(thisPmp, pmp.Meta, pmp.InitRetries, pumpInitRetryInterval(pmp.InitRetryInterval))
+			}
+			if initErr == nil && pmp.DiskBuffer.Path != "" && SystemConfig.DryRun {
+				// the buffer would forward its batches to the pump in the background
+				log.WithFields(logrus.Fields{
+					"prefix": mainPrefix,
+				}).Info("Dry run: not opening the disk buffer of ", thisPmp.GetName())
+			} else if initErr == nil && pmp.DiskBuffer.Path != "" {
+				var bufferedPmp *pumps.DiskBufferedPump
+				bufferedPmp, initErr = pumps.NewDiskBufferedPump(thisPmp, pmp.DiskBuffer)
+				if initErr == nil {
+					thisPmp = bufferedPmp
+				}
+			}
+			if initErr == nil && pmp.AggregateBuffer.FlushInterval > 0 {
+				thisPmp = pumps.NewAggregateBufferedPump(thisPmp, pmp.AggregateBuffer)
+			}
 			if initErr != nil {
 				log.WithField("pump", thisPmp.GetName()).Error("Pump init error (skipping): ", initErr)
 			} else {
@@ -157,6 +453,17 @@ func initialisePumps() {
 					"prefix": mainPrefix,
 				}).Info("Init Pump: ", key)
 				Pumps = append(Pumps, thisPmp)
+				pumpsByKey[key] = thisPmp
+				PumpKeys[thisPmp] = key
+				if stringInSlice(key, SystemConfig.KeyHashing.BypassPumps) {
+					KeyHashingBypass[thisPmp] = true
+				}
+				if stringInSlice(key, SystemConfig.HeartbeatPumps) {
+					HeartbeatPumps = append(HeartbeatPumps, thisPmp)
+				}
+				if stringInSlice(key, SystemConfig.BatchSummaryPumps) {
+					BatchSummaryPumps = append(BatchSummaryPumps, thisPmp)
+				}
 			}
 		}
 	}
@@ -166,6 +473,8 @@ func initialisePumps() {
 			"prefix": mainPrefix,
 		}).Fatal("No pumps configured")
 	}
+	setupFilterRoutes(pumpsByKey)
+	setupGraphPumps(pumpsByKey)
 
 	if !SystemConfig.DontPurgeUptimeData {
 		initialiseUptimePump()
@@ -173,19 +482,50 @@ func initialisePumps() {
 
 }
 
+// defaultInitRetryInterval is the interval between the retries of the pumps initialisation when
+// init_retry_interval isn't set.
+const defaultInitRetryInterval = 5 * time.Second
+
+func pumpInitRetryInterval(seconds int) time.Duration {
+	if seconds <= 0 {
+		return defaultInitRetryInterval
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// initPumpWithRetries initialises the pump, retrying up to retries times, waiting interval between
+// the attempts, while Init fails. It returns the error of the last attempt.
+func initPumpWithRetries(pmp pumps.Pump, meta interface{}, retries int, interval time.Duration) error {
+	err := pmp.Init(meta)
+	for attempt := 1; err != nil && attempt <= retries; attempt++ {
+		log.WithFields(logrus.Fields{
+			"prefix": mainPrefix,
+		}).Warningf("Pump %s init failed, retrying in %v (%d/%d): %v", pmp.GetName(), interval, attempt, retries, err)
+		time.Sleep(interval)
+		err = pmp.Init(meta)
+	}
+	return err
+}
+
 func initialiseUptimePump() {
 	log.WithFields(logrus.Fields{
 		"prefix": mainPrefix,
 	}).Info("'dont_purge_uptime_data' set to false, attempting to start Uptime pump! ")
 
+	var err error
 	switch SystemConfig.UptimePumpConfig.UptimeType {
 	case "sql":
 		UptimePump = &pumps.SQLPump{IsUptime: true}
-		UptimePump.Init(SystemConfig.UptimePumpConfig.SQLConf)
+		err = UptimePump.Init(SystemConfig.UptimePumpConfig.SQLConf)
 
 	default:
 		UptimePump = &pumps.MongoPump{IsUptime: true}
-		UptimePump.Init(SystemConfig.UptimePumpConfig.MongoConf)
+		err = UptimePump.Init(SystemConfig.UptimePumpConfig.MongoConf)
+	}
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": mainPrefix,
+		}).Fatal("Uptime pump init error: ", err)
 	}
 
 	log.WithFields(logrus.Fields{
@@ -209,21 +549,26 @@ func StartPurgeLoop(wg *sync.WaitGroup, ctx context.Context, secInterval int, ch
 				analyticsKeyName = fmt.Sprintf("%v_%v", storage.ANALYTICS_KEYNAME, i)
 			}
 
-			for _, serializerMethod := range AnalyticsSerializers {
-				analyticsKeyName += serializerMethod.GetSuffix()
-				AnalyticsValues := AnalyticsStore.GetAndDeleteSet(analyticsKeyName, chunkSize, expire)
-				if len(AnalyticsValues) > 0 {
-					PreprocessAnalyticsValues(AnalyticsValues, serializerMethod, analyticsKeyName, omitDetails, job, startTime, secInterval)
-				}
-			}
-
+			purgeAnalyticsKey(AnalyticsStore, analyticsKeyName, chunkSize, expire, omitDetails, job, startTime, secInterval)
+		}
+		for _, source := range AnalyticsSources {
+			purgeAnalyticsKey(source.store, source.key, chunkSize, expire, omitDetails, job, startTime, secInterval)
+		}
+		if len(BatchSummaryPumps) > 0 {
+			processBatchSummary(job, startTime, secInterval)
 		}
 
 		job.Timing("purge_time_all", time.Since(startTime).Nanoseconds())
 
 		if !SystemConfig.DontPurgeUptimeData {
 			UptimeValues := UptimeStorage.GetAndDeleteSet(storage.UptimeAnalytics_KEYNAME, chunkSize, expire)
-			UptimePump.WriteUptimeData(UptimeValues)
+			if SystemConfig.DryRun {
+				log.WithFields(logrus.Fields{
+					"prefix": mainPrefix,
+				}).Infof("Dry run: would write %d uptime records to %s", len(UptimeValues), UptimePump.GetName())
+			} else {
+				UptimePump.WriteUptimeData(UptimeValues)
+			}
 		}
 
 		if checkShutdown(ctx, wg) {
@@ -233,9 +578,9 @@ func StartPurgeLoop(wg *sync.WaitGroup, ctx context.Context, secInterval int, ch
 }
 
 func PreprocessAnalyticsValues(AnalyticsValues []interface{}, serializerMethod serializer.AnalyticsSerializer, analyticsKeyName string, omitDetails bool, job *health.Job, startTime time.Time, secInterval int) {
-	keys := make([]interface{}, len(AnalyticsValues))
+	keys := make([]interface{}, 0, len(AnalyticsValues))
 
-	for i, v := range AnalyticsValues {
+	for _, v := range AnalyticsValues {
 		decoded := analytics.AnalyticsRecord{}
 		err := serializerMethod.Decode([]byte(v.(string)), &decoded)
 
@@ -247,23 +592,171 @@ func PreprocessAnalyticsValues(AnalyticsValues []interface{}, serializerMethod s
 				"prefix":       mainPrefix,
 				"analytic_key": analyticsKeyName,
 			}).Error("Couldn't unmarshal analytics data:", err)
+			recordsDropped(dropReasonDecodeError, "", 1)
+			continue
+		}
+		if SystemConfig.RecordSize {
+			decoded.RecordSizeBytes = int64(len(v.(string)))
+		}
+		enrichRecord(&decoded)
+		if isIgnoredPath(decoded, SystemConfig.IgnorePaths) {
+			job.Event("record_ignored")
+			recordsDropped(dropReasonIgnoredPath, "", 1)
 			continue
 		}
-		keys[i] = interface{}(decoded)
+		if !checkFutureTimestamp(&decoded, time.Now()) {
+			job.Event("record_future_timestamp")
+			continue
+		}
+		if DetailedRecordingSampler != nil {
+			decoded.SampleDetailedRecording(DetailedRecordingSampler)
+		}
+		keys = append(keys, interface{}(decoded))
 		job.Event("record")
 	}
+	if len(BatchSummaryPumps) > 0 {
+		purgeSummaries.add(job, keys)
+	}
 	// Send to pumps
 	writeToPumps(keys, job, startTime, int(secInterval))
 }
 
+// enrichRecord applies the globally configured enrichments to a freshly decoded record, before
+// it's sent to the pumps.
+func enrichRecord(record *analytics.AnalyticsRecord) {
+	if SystemConfig.RecordTTL > 0 {
+		record.SetTTL(time.Duration(SystemConfig.RecordTTL) * time.Second)
+	}
+	// the raw request and response are parsed once, by the first enrichment reading them
+	raw := analytics.NewRawData(record)
+	if SystemConfig.BackfillRequestLine {
+		record.BackfillRequestLine(raw)
+	}
+	if SystemConfig.LatencyBreakdown {
+		record.SetLatencyBreakdown()
+	}
+	if SystemConfig.ResponseContentLength {
+		record.SetResponseContentLength(raw)
+	}
+	if SystemConfig.ResponseContentType {
+		record.SetResponseContentType(raw)
+	}
+	if len(CacheStatusHeaders) > 0 {
+		record.SetCacheStatus(raw, CacheStatusHeaders)
+	}
+	if BotDetector != nil {
+		record.SetIsBot(BotDetector)
+	}
+	if BodyTagger != nil {
+		record.TagRequestBody(raw, BodyTagger)
+	}
+	if PIIDetector != nil {
+		record.DetectPII(raw, PIIDetector)
+	}
+	if TLSInfoSources != nil {
+		record.SetTLSInfo(raw, *TLSInfoSources)
+	}
+	if LatencyPhasesTags != nil {
+		record.SetLatencyPhases(*LatencyPhasesTags)
+	}
+	if len(CorrelationIDHeaders) > 0 {
+		record.SetCorrelationID(raw, CorrelationIDHeaders)
+	}
+	if JWTClaimsExtractor != nil {
+		record.SetJWTClaims(raw, JWTClaimsExtractor)
+	}
+	if EndpointTagPrefix != "" {
+		record.SetEndpoint(EndpointTagPrefix)
+	}
+	if NodeIDTagPrefix != "" {
+		record.SetNodeID(NodeIDTagPrefix)
+	}
+	if SystemConfig.UserAgentFamilies {
+		record.SetUserAgentFamilies()
+	}
+	if SystemConfig.SchemeAndPort {
+		record.SetSchemeAndPort(raw)
+	}
+	if SystemConfig.GRPCStatus {
+		record.SetGRPCStatus(raw)
+	}
+	// last, so the enrichments above still read the moved tags
+	if SystemConfig.TagMap.Enabled {
+		record.SetTagMap(SystemConfig.TagMap.Keys, SystemConfig.TagMap.keepTags())
+	}
+}
+
+// isIgnoredPath reports whether the path or raw path of the record matches any of patterns,
+// either exactly or as a glob pattern.
+func isIgnoredPath(record analytics.AnalyticsRecord, patterns []string) bool {
+	for _, pattern := range patterns {
+		for _, p := range []string{record.Path, record.RawPath} {
+			if p == "" {
+				continue
+			}
+			if matched, err := path.Match(pattern, p); p == pattern || (err == nil && matched) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func checkShutdown(ctx context.Context, wg *sync.WaitGroup) bool {
 	shutdown := false
 	select {
 	case <-ctx.Done():
-		log.WithFields(logrus.Fields{
-			"prefix": mainPrefix,
-		}).Info("Shutting down ", len(Pumps), " pumps...")
-		for _, pmp := range Pumps {
+		// the steps below share a single shutdown_timeout window
+		deadline := shutdownDeadline()
+		// the producers stop on the same context, wait for their last write
+		flushed := waitUntil(&Producers, deadline)
+		if flushed && Dispatcher != nil {
+			// write the buffered batches before shutting the pumps down
+			flushed = runUntil(deadline, Dispatcher.close)
+		}
+		if flushed && ConcurrentWriter != nil {
+			// write the queued batches before shutting the pumps down
+			flushed = runUntil(deadline, ConcurrentWriter.close)
+		}
+		var abandoned []string
+		if flushed {
+			log.WithFields(logrus.Fields{
+				"prefix": mainPrefix,
+			}).Info("Shutting down ", len(Pumps), " pumps...")
+			abandoned = shutdownPumps(Pumps, deadline)
+		} else {
+			// the batches are still being written, the pumps can't be shut down under them
+			for _, pmp := range Pumps {
+				abandoned = append(abandoned, pmp.GetName())
+			}
+		}
+		if len(abandoned) > 0 {
+			log.WithFields(logrus.Fields{
+				"prefix": mainPrefix,
+			}).Warning("Shutdown timeout reached, abandoning pumps: ", strings.Join(abandoned, ", "))
+		}
+		wg.Done()
+		shutdown = true
+	default:
+	}
+	return shutdown
+}
+
+// shutdownPumps gracefully stops every pump concurrently. If deadline isn't zero, it returns once
+// the deadline is reached, with the names of the pumps that didn't finish on time. Their unflushed
+// records are lost, there's no dead-letter sink to hand them off to.
+func shutdownPumps(pmps []pumps.Pump, deadline time.Time) []string {
+	var mu sync.Mutex
+	pending := make(map[pumps.Pump]bool, len(pmps))
+	for _, pmp := range pmps {
+		pending[pmp] = true
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(pmps))
+	for _, pmp := range pmps {
+		go func(pmp pumps.Pump) {
+			defer wg.Done()
 			if err := pmp.Shutdown(); err != nil {
 				log.WithFields(logrus.Fields{
 					"prefix": mainPrefix,
@@ -273,21 +766,122 @@ func checkShutdown(ctx context.Context, wg *sync.WaitGroup) bool {
 					"prefix": mainPrefix,
 				}).Info(pmp.GetName() + " gracefully stopped.")
 			}
+			mu.Lock()
+			delete(pending, pmp)
+			mu.Unlock()
+		}(pmp)
+	}
+
+	if waitUntil(&wg, deadline) {
+		return nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	abandoned := []string{}
+	for _, pmp := range pmps {
+		if pending[pmp] {
+			abandoned = append(abandoned, pmp.GetName())
 		}
-		wg.Done()
-		shutdown = true
-	default:
 	}
-	return shutdown
+	return abandoned
 }
 
+// shutdownDeadline returns the deadline of a graceful shutdown starting now, or the zero time
+// without shutdown_timeout.
+func shutdownDeadline() time.Time {
+	if SystemConfig.ShutdownTimeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(SystemConfig.ShutdownTimeout) * time.Second)
+}
+
+// runUntil runs f and waits for it to return. It returns false if the deadline is reached first,
+// leaving f running. A zero deadline waits forever.
+func runUntil(deadline time.Time, f func()) bool {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		f()
+	}()
+	return waitUntil(&wg, deadline)
+}
+
+// waitWithTimeout waits for the wait group to finish. It returns false if the timeout is
+// reached first. A timeout of 0 waits forever.
+func waitWithTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	if timeout <= 0 {
+		return waitUntil(wg, time.Time{})
+	}
+	return waitUntil(wg, time.Now().Add(timeout))
+}
+
+// waitUntil waits for the wait group to finish. It returns false if the deadline is reached
+// first. A zero deadline waits forever.
+func waitUntil(wg *sync.WaitGroup, deadline time.Time) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	if deadline.IsZero() {
+		<-done
+		return true
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// writeMu serializes the writes of the purge loop and the Kafka source.
+var writeMu sync.Mutex
+
 func writeToPumps(keys []interface{}, job *health.Job, startTime time.Time, purgeDelay int) {
+	writeToSelectedPumps(Pumps, keys, job, startTime, purgeDelay)
+}
+
+// writeToSelectedPumps writes keys to pmps, a subset of Pumps.
+func writeToSelectedPumps(pmps []pumps.Pump, keys []interface{}, job *health.Job, startTime time.Time, purgeDelay int) {
+	writeMu.Lock()
+	defer writeMu.Unlock()
 	// Send to pumps
-	if Pumps != nil {
+	if pmps != nil {
+		hashedKeys := hashKeys(keys)
+		routed := routeKeys(keys)
+		concurrent := ConcurrentWriter != nil && !ConcurrentWriter.closed
 		var wg sync.WaitGroup
-		wg.Add(len(Pumps))
-		for _, pmp := range Pumps {
-			go execPumpWriting(&wg, pmp, &keys, purgeDelay, startTime, job)
+		for _, pmp := range pmps {
+			pumpKeys := &hashedKeys
+			if KeyHashingBypass[pmp] {
+				pumpKeys = &keys
+			}
+			if indexes, ok := routed[pmp]; ok {
+				selected := selectKeys(*pumpKeys, indexes)
+				pumpKeys = &selected
+			}
+			if GraphPumps != nil {
+				selected := graphRouteKeys(pmp, *pumpKeys)
+				pumpKeys = &selected
+			}
+			if concurrent {
+				ConcurrentWriter.write(pmp, pumpBatch{keys: *pumpKeys, purgeDelay: purgeDelay, startTime: startTime, job: job})
+				continue
+			}
+			wg.Add(1)
+			if release, ok := pumps.TryAcquireGoroutine(); ok {
+				go execPumpWriting(&wg, pmp, pumpKeys, purgeDelay, startTime, job, release)
+			} else {
+				// no goroutine slot is free, the write holds the next pumps back instead
+				execPumpWriting(&wg, pmp, pumpKeys, purgeDelay, startTime, job, nil)
+			}
 		}
 		wg.Wait()
 	} else {
@@ -297,15 +891,53 @@ func writeToPumps(keys []interface{}, job *health.Job, startTime time.Time, purg
 	}
 }
 
+// pumpKey returns the key of pmp in the pumps configuration, or its name if it has none.
+func pumpKey(pmp pumps.Pump) string {
+	if key, ok := PumpKeys[pmp]; ok {
+		return key
+	}
+	return pmp.GetName()
+}
+
+// hashKeys returns a copy of keys with the API keys and OAuth ids hashed, or keys itself if the
+// key hashing isn't enabled.
+func hashKeys(keys []interface{}) []interface{} {
+	if KeyHasher == nil {
+		return keys
+	}
+
+	hashedKeys := make([]interface{}, len(keys))
+	for i, key := range keys {
+		record := key.(analytics.AnalyticsRecord)
+		record.HashKeys(KeyHasher)
+		hashedKeys[i] = record
+	}
+	return hashedKeys
+}
+
 func filterData(pump pumps.Pump, keys []interface{}) []interface{} {
 
 	shouldTrim := SystemConfig.MaxRecordSize != 0 || pump.GetMaxRecordSize() != 0
 	filters := pump.GetFilters()
 	ignoreFields := pump.GetIgnoreFields()
+	allowedFields := pump.GetAllowedFields()
 	getDecodingResponse := pump.GetDecodedResponse()
 	getDecodingRequest := pump.GetDecodedRequest()
+	detailedRecordingAPIIDs := pump.GetDetailedRecordingAPIIDs()
+	processedBy := pump.GetProcessedBy()
+	isSampled := pump.GetSampling().Rate > 1
+	if len(detailedRecordingAPIIDs) == 0 {
+		detailedRecordingAPIIDs = SystemConfig.DetailedRecordingAPIIDs
+	}
+	// sorted first, so the identical records are collapsed in timestamp order
+	if pump.GetSortByTimestamp() {
+		keys = analytics.SortByTimestamp(keys)
+	}
+	if collapseWindow := pump.GetCollapseWindow(); collapseWindow > 0 {
+		keys = analytics.CollapseRecords(keys, time.Duration(collapseWindow)*time.Second)
+	}
 	// Checking to see if all the config options are empty/false
-	if !getDecodingRequest && !getDecodingResponse && !filters.HasFilter() && !pump.GetOmitDetailedRecording() && !shouldTrim && len(ignoreFields) == 0 {
+	if !getDecodingRequest && !getDecodingResponse && !filters.HasFilter() && !pump.GetOmitDetailedRecording() && !shouldTrim && len(ignoreFields) == 0 && len(allowedFields) == 0 && len(detailedRecordingAPIIDs) == 0 && RawDataEncryptor == nil && processedBy == "" && !isSampled {
 		return keys
 	}
 
@@ -313,10 +945,12 @@ func filterData(pump pumps.Pump, keys []interface{}) []interface{} {
 	copy(filteredKeys, keys)
 
 	newLenght := 0
+	filtered := 0
+	sampled := 0
 
 	for _, key := range keys {
 		decoded := key.(analytics.AnalyticsRecord)
-		if pump.GetOmitDetailedRecording() {
+		if pump.GetOmitDetailedRecording() || (len(detailedRecordingAPIIDs) > 0 && !stringInSlice(decoded.APIID, detailedRecordingAPIIDs)) {
 			decoded.RawRequest = ""
 			decoded.RawResponse = ""
 		} else {
@@ -329,11 +963,23 @@ func filterData(pump pumps.Pump, keys []interface{}) []interface{} {
 			}
 		}
 		if filters.ShouldFilter(decoded) {
+			filtered++
+			continue
+		}
+		if isSampled && !pump.SampleRecord(decoded) {
+			sampled++
 			continue
 		}
 		if len(ignoreFields) > 0 {
 			decoded.RemoveIgnoredFields(ignoreFields)
 		}
+		if len(allowedFields) > 0 {
+			decoded.KeepFields(allowedFields)
+		}
+		// decoded is the copy of the record of this pump
+		if processedBy != "" {
+			decoded.ProcessedBy = processedBy
+		}
 		// DECODING RAW REQUEST AND RESPONSE FROM BASE 64
 		if getDecodingRequest {
 			rawRequest, err := base64.StdEncoding.DecodeString(decoded.RawRequest)
@@ -347,14 +993,39 @@ func filterData(pump pumps.Pump, keys []interface{}) []interface{} {
 				decoded.RawResponse = string(rawResponse)
 			}
 		}
+		// ENCRYPTING RAW REQUEST AND RESPONSE, ONCE THEY ARE IN THEIR FINAL FORM
+		if RawDataEncryptor != nil {
+			if err := decoded.EncryptRawData(RawDataEncryptor); err != nil {
+				// never write the raw data in clear if it's supposed to be encrypted
+				log.WithFields(logrus.Fields{
+					"prefix": mainPrefix,
+				}).Error("Couldn't encrypt raw data: ", err)
+				decoded.RawRequest = ""
+				decoded.RawResponse = ""
+			}
+		}
 		filteredKeys[newLenght] = decoded
 		newLenght++
 	}
+	recordsDropped(dropReasonFiltered, pump.GetName(), filtered)
+	recordsDropped(dropReasonSampled, pump.GetName(), sampled)
 	filteredKeys = filteredKeys[:newLenght]
 	return filteredKeys
 }
 
-func execPumpWriting(wg *sync.WaitGroup, pmp pumps.Pump, keys *[]interface{}, purgeDelay int, startTime time.Time, job *health.Job) {
+func stringInSlice(a string, list []string) bool {
+	for _, b := range list {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
+// execPumpWriting writes keys to pmp. The write runs in its own goroutine, which calls release once
+// WriteData returns, even past the timeout of the pump, so the goroutine slots stay taken until the
+// pumps are done writing. With a nil release, it runs in the calling goroutine.
+func execPumpWriting(wg *sync.WaitGroup, pmp pumps.Pump, keys *[]interface{}, purgeDelay int, startTime time.Time, job *health.Job, release func()) {
 	timer := time.AfterFunc(time.Duration(purgeDelay)*time.Second, func() {
 		if pmp.GetTimeout() == 0 {
 			log.WithFields(logrus.Fields{
@@ -387,28 +1058,80 @@ func execPumpWriting(wg *sync.WaitGroup, pmp pumps.Pump, keys *[]interface{}, pu
 
 	defer cancel()
 
-	go func(ch chan error, ctx context.Context, pmp pumps.Pump, keys *[]interface{}) {
+	writeStart := time.Now()
+	batchSize := len(*keys)
+	write := func() {
 		filteredKeys := filterData(pmp, *keys)
-		ch <- pmp.WriteData(ctx, filteredKeys)
-	}(ch, ctx, pmp, keys)
+		if SystemConfig.DryRun {
+			dryRunWrite(pmp, filteredKeys)
+			ch <- nil
+			return
+		}
+		err := pmp.WriteData(ctx, filteredKeys)
+		if err == nil {
+			pmp.LogSampledRecords(filteredKeys)
+		} else if ctx.Err() == context.DeadlineExceeded {
+			recordsDropped(dropReasonTimeout, pmp.GetName(), len(filteredKeys))
+		} else {
+			recordsDropped(dropReasonWriteError, pmp.GetName(), len(filteredKeys))
+		}
+		if tracker := WriteErrorRates.Load(); tracker != nil {
+			tracker.record(pumpKey(pmp), err != nil, time.Now())
+		}
+		ch <- err
+	}
+	done := ctx.Done()
+	if release != nil {
+		go func() {
+			defer release()
+			write()
+		}()
+	} else {
+		write()
+		// the write returned, even if it ran past the timeout
+		done = nil
+	}
 
+	writeLog := func() *logrus.Entry {
+		return log.WithFields(logrus.Fields{
+			"prefix":              mainPrefix,
+			logger.FieldPump:      pmp.GetName(),
+			logger.FieldBatchSize: batchSize,
+			logger.FieldDuration:  time.Since(writeStart).Milliseconds(),
+		})
+	}
+	// the failed writes are logged unless error_log_sampling suppresses them
+	sampledErrorLog := func(err error) *logrus.Entry {
+		logged, suppressed := pmp.SampleErrorLog(err.Error())
+		if !logged {
+			return nil
+		}
+		entry := writeLog().WithError(err)
+		if suppressed > 0 {
+			entry = entry.WithField("suppressed", suppressed)
+		}
+		return entry
+	}
 	select {
 	case err := <-ch:
 		if err != nil {
-			log.WithFields(logrus.Fields{
-				"prefix": mainPrefix,
-			}).Warning("Error Writing to: ", pmp.GetName(), " - Error:", err)
+			if entry := sampledErrorLog(err); entry != nil {
+				entry.Warning("Error Writing to: ", pmp.GetName(), " - Error:", err)
+			}
+		} else {
+			for msg, suppressed := range pmp.ResetErrorLogSampling() {
+				writeLog().WithField("suppressed", suppressed).Warningf("Suppressed %d errors writing to %s: %s", suppressed, pmp.GetName(), msg)
+			}
+			writeLog().Debug("Wrote to: ", pmp.GetName())
 		}
-	case <-ctx.Done():
+	case <-done:
 		switch ctx.Err() {
 		case context.Canceled:
-			log.WithFields(logrus.Fields{
-				"prefix": mainPrefix,
-			}).Warning("The writing to ", pmp.GetName(), " have got canceled.")
+			writeLog().WithError(ctx.Err()).Warning("The writing to ", pmp.GetName(), " have got canceled.")
 		case context.DeadlineExceeded:
-			log.WithFields(logrus.Fields{
-				"prefix": mainPrefix,
-			}).Warning("Timeout Writing to: ", pmp.GetName())
+			if entry := sampledErrorLog(ctx.Err()); entry != nil {
+				entry.Warning("Timeout Writing to: ", pmp.GetName())
+			}
 		}
 	}
 	if job != nil {
@@ -419,7 +1142,7 @@ func execPumpWriting(wg *sync.WaitGroup, pmp pumps.Pump, keys *[]interface{}, pu
 func main() {
 	Init()
 	SetupInstrumentation()
-	go server.ServeHealthCheck(SystemConfig.HealthCheckEndpointName, SystemConfig.HealthCheckEndpointPort, SystemConfig.HTTPProfile)
+	go server.ServeHealthCheck(SystemConfig.HealthCheckEndpointName, SystemConfig.HealthCheckEndpointPort, SystemConfig.HTTPProfile, SystemConfig.LogLevelSecret)
 
 	// Store version which will be read by dashboard and sent to
 	// vclu(version check and licecnse utilisation) service
@@ -427,9 +1150,35 @@ func main() {
 
 	// Create the store
 	setupAnalyticsStore()
+	setupAnalyticsSources()
+
+	setupRawDataEncryption()
+	setupFutureTimestamps()
+
+	setupBotDetection()
+	setupRequestBodyTags()
+	setupPIIDetection()
+	setupDetailedRecordingRates()
+	setupTLSInfo()
+	setupLatencyPhases()
+	setupCorrelationID()
+	setupCacheStatus()
+	setupJWTClaims()
+	setupEndpoint()
+	setupNodeID()
+	setupKeyHashing()
+	setupGraphQLVariables()
 
+	pumps.SetMaxGoroutines(SystemConfig.MaxGoroutines)
+	if SystemConfig.DryRun {
+		log.WithFields(logrus.Fields{
+			"prefix": mainPrefix,
+		}).Warning("Dry run enabled, the records won't be written to the pumps")
+	}
 	// prime the pumps
 	initialisePumps()
+	setupConcurrentWrites()
+	setupWriteErrorRates()
 	if *demoMode != "" {
 		log.Info("BUILDING DEMO DATA AND EXITING...")
 		log.Warning("Starting from date: ", time.Now().AddDate(0, 0, -30))
@@ -451,16 +1200,43 @@ func main() {
 		"prefix": mainPrefix,
 	}).Infof("Starting purge loop @%d, chunk size %d", SystemConfig.PurgeDelay, SystemConfig.PurgeChunk)
 
+	if SystemConfig.ProcessingBufferSize > 0 {
+		Dispatcher = newBatchDispatcher(SystemConfig.ProcessingBufferSize)
+	}
+
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	ctx, cancel := context.WithCancel(context.Background())
+	go StartDroppedRecordsLog(ctx, time.Duration(SystemConfig.DroppedRecordsLogInterval)*time.Second)
+	Producers.Add(1)
+	go func() {
+		defer Producers.Done()
+		StartHeartbeat(ctx, time.Duration(SystemConfig.HeartbeatInterval)*time.Second, SystemConfig.PurgeDelay)
+	}()
 	go StartPurgeLoop(&wg, ctx, SystemConfig.PurgeDelay, SystemConfig.PurgeChunk, time.Duration(SystemConfig.StorageExpirationTime)*time.Second, SystemConfig.OmitDetailedRecording)
 
+	kafkaSource, err := NewKafkaSource(SystemConfig.KafkaSource, time.Duration(SystemConfig.PurgeDelay)*time.Second)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": mainPrefix,
+		}).Fatal("Couldn't setup the Kafka source: ", err)
+	}
+	if kafkaSource != nil {
+		Producers.Add(1)
+		go kafkaSource.Start(ctx, &Producers)
+	}
+
 	termChan := make(chan os.Signal, 1)
 	signal.Notify(termChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	<-termChan // Blocks here until either SIGINT or SIGTERM is received.
 	cancel()   // cancel the context
-	wg.Wait()  // wait till all the pumps finish
+	// wait till all the pumps finish or the shutdown timeout is reached, the graceful shutdown of
+	// the purge loop starts once it sees the cancellation and fits in the same window
+	if !waitWithTimeout(&wg, time.Duration(SystemConfig.ShutdownTimeout)*time.Second) {
+		log.WithFields(logrus.Fields{
+			"prefix": mainPrefix,
+		}).Warning("Graceful shutdown didn't finish within ", SystemConfig.ShutdownTimeout, " seconds, exiting.")
+	}
 	log.WithFields(logrus.Fields{
 		"prefix": mainPrefix,
 	}).Info("Tyk-pump stopped.")
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 
 	"os"
 	"os/signal"
@@ -12,6 +13,9 @@ import (
 
 	"github.com/TykTechnologies/tyk-pump/analytics"
 	"github.com/TykTechnologies/tyk-pump/pumps"
+	"github.com/TykTechnologies/tyk-pump/serializer"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -148,6 +152,76 @@ func TestOmitDetailsFilterData(t *testing.T) {
 	}
 }
 
+func TestDetailedRecordingAPIIDsFilterData(t *testing.T) {
+	keys := make([]interface{}, 2)
+	keys[0] = analytics.AnalyticsRecord{APIID: "api111", RawResponse: "test", RawRequest: "test"}
+	keys[1] = analytics.AnalyticsRecord{APIID: "api123", RawResponse: "test", RawRequest: "test"}
+
+	assertDetailed := func(t *testing.T, filteredKeys []interface{}) {
+		t.Helper()
+		assert.Len(t, filteredKeys, 2)
+
+		notListed := filteredKeys[0].(analytics.AnalyticsRecord)
+		assert.Empty(t, notListed.RawRequest)
+		assert.Empty(t, notListed.RawResponse)
+
+		listed := filteredKeys[1].(analytics.AnalyticsRecord)
+		assert.Equal(t, "test", listed.RawRequest)
+		assert.Equal(t, "test", listed.RawResponse)
+	}
+
+	t.Run("pump config", func(t *testing.T) {
+		mockedPump := &MockedPump{}
+		mockedPump.SetDetailedRecordingAPIIDs([]string{"api123"})
+
+		assertDetailed(t, filterData(mockedPump, keys))
+	})
+
+	t.Run("global config", func(t *testing.T) {
+		SystemConfig.DetailedRecordingAPIIDs = []string{"api123"}
+		defer func() {
+			SystemConfig.DetailedRecordingAPIIDs = nil
+		}()
+
+		assertDetailed(t, filterData(&MockedPump{}, keys))
+	})
+
+	t.Run("not set", func(t *testing.T) {
+		filteredKeys := filterData(&MockedPump{}, keys)
+		for _, key := range filteredKeys {
+			record := key.(analytics.AnalyticsRecord)
+			assert.Equal(t, "test", record.RawRequest)
+			assert.Equal(t, "test", record.RawResponse)
+		}
+	})
+}
+
+func TestRawDataEncryptionFilterData(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	encryptor, err := analytics.NewRawDataEncryptor("key1", key)
+	assert.Nil(t, err)
+	RawDataEncryptor = encryptor
+	defer func() {
+		RawDataEncryptor = nil
+	}()
+
+	mockedPump := &MockedPump{}
+	mockedPump.SetMaxRecordSize(5)
+
+	keys := []interface{}{analytics.AnalyticsRecord{APIID: "api1", RawRequest: "raw_request", RawResponse: "raw_response"}}
+	filteredKeys := filterData(mockedPump, keys)
+	assert.Len(t, filteredKeys, 1)
+
+	record := filteredKeys[0].(analytics.AnalyticsRecord)
+	assert.True(t, analytics.IsRawDataEncrypted(record.RawRequest))
+	assert.True(t, analytics.IsRawDataEncrypted(record.RawResponse))
+
+	// the raw data is trimmed before being encrypted
+	assert.Nil(t, record.DecryptRawData(map[string][]byte{"key1": key}))
+	assert.Equal(t, "raw_r", record.RawRequest)
+	assert.Equal(t, "raw_r", record.RawResponse)
+}
+
 func TestWriteDataWithFilters(t *testing.T) {
 	mockedPump := &MockedPump{}
 	mockedPump.SetFilters(
@@ -273,6 +347,183 @@ func TestShutdown(t *testing.T) {
 	}
 }
 
+type SlowShutdownPump struct {
+	MockedPump
+	shutdownDelay time.Duration
+}
+
+func (p *SlowShutdownPump) GetName() string {
+	return "Slow Shutdown Pump"
+}
+
+func (p *SlowShutdownPump) Shutdown() error {
+	time.Sleep(p.shutdownDelay)
+	return p.MockedPump.Shutdown()
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	fastPump := &MockedPump{}
+	slowPump := &SlowShutdownPump{shutdownDelay: 5 * time.Second}
+
+	t.Run("slow pump exceeds the timeout", func(t *testing.T) {
+		start := time.Now()
+		abandoned := shutdownPumps([]pumps.Pump{fastPump, slowPump}, time.Now().Add(100*time.Millisecond))
+
+		assert.Less(t, time.Since(start), slowPump.shutdownDelay)
+		assert.Equal(t, []string{slowPump.GetName()}, abandoned)
+		assert.True(t, fastPump.TurnedOff)
+	})
+
+	t.Run("no timeout configured", func(t *testing.T) {
+		slowPump := &SlowShutdownPump{shutdownDelay: 50 * time.Millisecond}
+		abandoned := shutdownPumps([]pumps.Pump{slowPump}, time.Time{})
+
+		assert.Empty(t, abandoned)
+		assert.True(t, slowPump.TurnedOff)
+	})
+
+	t.Run("checkShutdown honours shutdown_timeout", func(t *testing.T) {
+		SystemConfig.ShutdownTimeout = 1
+		defer func() {
+			SystemConfig.ShutdownTimeout = 0
+		}()
+		slowPump := &SlowShutdownPump{shutdownDelay: 5 * time.Second}
+		Pumps = []pumps.Pump{slowPump}
+
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		start := time.Now()
+		assert.True(t, checkShutdown(ctx, &wg))
+		assert.True(t, waitWithTimeout(&wg, time.Second))
+		assert.Less(t, time.Since(start), slowPump.shutdownDelay)
+	})
+
+	t.Run("checkShutdown shares the window between its steps", func(t *testing.T) {
+		SystemConfig.ShutdownTimeout = 1
+		defer func() {
+			SystemConfig.ShutdownTimeout = 0
+		}()
+		slowPump := &SlowShutdownPump{shutdownDelay: 5 * time.Second}
+		Pumps = []pumps.Pump{slowPump}
+
+		// a producer taking most of the window to write its last batch
+		Producers.Add(1)
+		go func() {
+			defer Producers.Done()
+			time.Sleep(700 * time.Millisecond)
+		}()
+
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		start := time.Now()
+		assert.True(t, checkShutdown(ctx, &wg))
+		elapsed := time.Since(start)
+		assert.GreaterOrEqual(t, elapsed, time.Second)
+		assert.Less(t, elapsed, 1500*time.Millisecond)
+	})
+
+	t.Run("producers exceeding the timeout abandon the pumps", func(t *testing.T) {
+		SystemConfig.ShutdownTimeout = 1
+		defer func() {
+			SystemConfig.ShutdownTimeout = 0
+		}()
+		pump := &MockedPump{}
+		Pumps = []pumps.Pump{pump}
+
+		release := make(chan struct{})
+		Producers.Add(1)
+		go func() {
+			defer Producers.Done()
+			<-release
+		}()
+		defer close(release)
+
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		assert.True(t, checkShutdown(ctx, &wg))
+		// the pump isn't shut down under the producer still writing to it
+		assert.False(t, pump.TurnedOff)
+	})
+}
+
+func TestIsIgnoredPath(t *testing.T) {
+	patterns := []string{"/healthz", "/status/*", "/[bad"}
+
+	tcs := []struct {
+		testName string
+		record   analytics.AnalyticsRecord
+		expected bool
+	}{
+		{
+			testName: "exact match",
+			record:   analytics.AnalyticsRecord{Path: "/healthz"},
+			expected: true,
+		},
+		{
+			testName: "glob match",
+			record:   analytics.AnalyticsRecord{Path: "/status/ready"},
+			expected: true,
+		},
+		{
+			testName: "raw path match",
+			record:   analytics.AnalyticsRecord{Path: "/", RawPath: "/healthz"},
+			expected: true,
+		},
+		{
+			testName: "malformed pattern matches exactly",
+			record:   analytics.AnalyticsRecord{Path: "/[bad"},
+			expected: true,
+		},
+		{
+			testName: "glob doesn't match nested paths",
+			record:   analytics.AnalyticsRecord{Path: "/status/ready/deep"},
+			expected: false,
+		},
+		{
+			testName: "no match",
+			record:   analytics.AnalyticsRecord{Path: "/api/users"},
+			expected: false,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expected, isIgnoredPath(tc.record, patterns))
+		})
+	}
+}
+
+func TestPreprocessAnalyticsValuesIgnorePaths(t *testing.T) {
+	SystemConfig.IgnorePaths = []string{"/healthz", "/status/*"}
+	defer func() {
+		SystemConfig.IgnorePaths = nil
+	}()
+	mockedPump := &MockedPump{}
+	Pumps = []pumps.Pump{mockedPump}
+
+	msgpackSerializer := serializer.NewAnalyticsSerializer(serializer.MSGP_SERIALIZER)
+	values := []interface{}{}
+	for _, path := range []string{"/healthz", "/status/ready", "/api/users", "/healthz/deep"} {
+		encoded, err := msgpackSerializer.Encode(&analytics.AnalyticsRecord{Path: path})
+		assert.Nil(t, err)
+		values = append(values, string(encoded))
+	}
+
+	job := instrument.NewJob("TestJob")
+	PreprocessAnalyticsValues(values, msgpackSerializer, "analytics", false, job, time.Now(), 2)
+
+	assert.Equal(t, 2, mockedPump.CounterRequest)
+}
+
 func TestIgnoreFieldsFilterData(t *testing.T) {
 	keys := make([]interface{}, 1)
 	record := analytics.AnalyticsRecord{APIID: "api111", RawResponse: "test", RawRequest: "test", OrgID: "321", ResponseCode: 200, RequestTime: 123}
@@ -322,6 +573,93 @@ func TestIgnoreFieldsFilterData(t *testing.T) {
 	}
 }
 
+func TestAllowedFieldsFilterData(t *testing.T) {
+	record := analytics.AnalyticsRecord{APIID: "api111", RawResponse: "test", RawRequest: "test", OrgID: "321", ResponseCode: 200, RequestTime: 123}
+	keys := []interface{}{record}
+
+	mockedPump := &MockedPump{}
+	mockedPump.SetAllowedFields([]string{"api_id", "response_code"})
+	otherPump := &MockedPump{}
+
+	filteredKeys := filterData(mockedPump, keys)
+	assert.Equal(t, []interface{}{analytics.AnalyticsRecord{APIID: "api111", ResponseCode: 200}}, filteredKeys)
+
+	// the other pumps get the full records
+	assert.Equal(t, keys, filterData(otherPump, keys))
+	assert.Equal(t, record, keys[0])
+}
+
+func TestCollapseWindowFilterData(t *testing.T) {
+	now := time.Now()
+	keys := []interface{}{}
+	for i := 0; i < 3; i++ {
+		keys = append(keys, analytics.AnalyticsRecord{APIID: "api1", Path: "/get", ResponseCode: 200, TimeStamp: now.Add(time.Duration(i) * time.Millisecond)})
+	}
+	keys = append(keys, analytics.AnalyticsRecord{APIID: "api1", Path: "/get", ResponseCode: 500, TimeStamp: now})
+
+	mockedPump := &MockedPump{}
+	mockedPump.SetCollapseWindow(1)
+	filteredKeys := filterData(mockedPump, keys)
+	assert.Len(t, filteredKeys, 2)
+	assert.Equal(t, 3, filteredKeys[0].(analytics.AnalyticsRecord).OccurrenceCount)
+	assert.Equal(t, 1, filteredKeys[1].(analytics.AnalyticsRecord).OccurrenceCount)
+
+	// the other pumps get every record
+	assert.Equal(t, keys, filterData(&MockedPump{}, keys))
+}
+
+func TestSortByTimestampExecPumpWriting(t *testing.T) {
+	now := time.Now()
+	keys := []interface{}{
+		analytics.AnalyticsRecord{APIID: "api2", TimeStamp: now.Add(time.Second)},
+		analytics.AnalyticsRecord{APIID: "api1", TimeStamp: now},
+		analytics.AnalyticsRecord{APIID: "api3", TimeStamp: now.Add(time.Second)},
+	}
+	sortedPump := &RecordingPump{}
+	sortedPump.SetSortByTimestamp(true)
+	otherPump := &RecordingPump{}
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	execPumpWriting(&wg, sortedPump, &keys, 2, time.Now(), nil, func() {})
+	execPumpWriting(&wg, otherPump, &keys, 2, time.Now(), nil, func() {})
+	wg.Wait()
+
+	apiIDs := func(records []analytics.AnalyticsRecord) []string {
+		ids := []string{}
+		for _, record := range records {
+			ids = append(ids, record.APIID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"api1", "api2", "api3"}, apiIDs(sortedPump.Records))
+	// the batch shared with the other pumps isn't reordered
+	assert.Equal(t, []string{"api2", "api1", "api3"}, apiIDs(otherPump.Records))
+	assert.Equal(t, "api2", keys[0].(analytics.AnalyticsRecord).APIID)
+}
+
+func TestSamplingFilterData(t *testing.T) {
+	keys := []interface{}{}
+	for i := 0; i < 20; i++ {
+		keys = append(keys, analytics.AnalyticsRecord{APIID: "api1", ResponseCode: 200})
+		keys = append(keys, analytics.AnalyticsRecord{APIID: "api1", ResponseCode: 503})
+	}
+
+	mockedPump := &MockedPump{}
+	mockedPump.SetSampling(pumps.SamplingConf{Rate: 5, KeepErrors: true})
+	filteredKeys := filterData(mockedPump, keys)
+
+	codes := map[int]int{}
+	for _, key := range filteredKeys {
+		codes[key.(analytics.AnalyticsRecord).ResponseCode]++
+	}
+	// all the errors survive, one of every five successes
+	assert.Equal(t, map[int]int{200: 4, 503: 20}, codes)
+
+	// the other pumps get every record
+	assert.Equal(t, keys, filterData(&MockedPump{}, keys))
+}
+
 func TestDecodedKey(t *testing.T) {
 	keys := make([]interface{}, 1)
 	record := analytics.AnalyticsRecord{APIID: "api111", RawResponse: "RGVjb2RlZFJlc3BvbnNl", RawRequest: "RGVjb2RlZFJlcXVlc3Q="}
@@ -378,3 +716,471 @@ func TestDecodedKey(t *testing.T) {
 		})
 	}
 }
+
+type RecordingPump struct {
+	mu      sync.Mutex
+	Records []analytics.AnalyticsRecord
+	pumps.CommonPumpConfig
+}
+
+func (p *RecordingPump) GetName() string {
+	return "Recording Pump"
+}
+
+func (p *RecordingPump) New() pumps.Pump {
+	return &RecordingPump{}
+}
+
+func (p *RecordingPump) Init(config interface{}) error {
+	return nil
+}
+
+func (p *RecordingPump) WriteData(ctx context.Context, keys []interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, key := range keys {
+		p.Records = append(p.Records, key.(analytics.AnalyticsRecord))
+	}
+	return nil
+}
+
+func TestWriteToPumpsKeyHashing(t *testing.T) {
+	var err error
+	KeyHasher, err = analytics.NewKeyHasher(analytics.KeyHashHMACSHA256, "salt")
+	assert.Nil(t, err)
+	hashingPump := &RecordingPump{}
+	bypassPump := &RecordingPump{}
+	KeyHashingBypass = map[pumps.Pump]bool{bypassPump: true}
+	defer func() {
+		KeyHasher = nil
+	}()
+	Pumps = []pumps.Pump{hashingPump, bypassPump}
+
+	keys := []interface{}{
+		analytics.AnalyticsRecord{APIID: "api1", APIKey: "key1", OauthID: "client1"},
+		analytics.AnalyticsRecord{APIID: "api1", APIKey: "key1"},
+		analytics.AnalyticsRecord{APIID: "api1", APIKey: "key2"},
+	}
+	writeToPumps(keys, instrument.NewJob("TestJob"), time.Now(), 2)
+
+	assert.Len(t, hashingPump.Records, 3)
+	token := KeyHasher.Hash("key1")
+	assert.Equal(t, token, hashingPump.Records[0].APIKey)
+	assert.Equal(t, KeyHasher.Hash("client1"), hashingPump.Records[0].OauthID)
+	assert.Equal(t, token, hashingPump.Records[1].APIKey)
+	assert.Equal(t, "", hashingPump.Records[1].OauthID)
+	assert.Equal(t, KeyHasher.Hash("key2"), hashingPump.Records[2].APIKey)
+	assert.NotEqual(t, token, hashingPump.Records[2].APIKey)
+
+	assert.Equal(t, []analytics.AnalyticsRecord{
+		{APIID: "api1", APIKey: "key1", OauthID: "client1"},
+		{APIID: "api1", APIKey: "key1"},
+		{APIID: "api1", APIKey: "key2"},
+	}, bypassPump.Records)
+	assert.Equal(t, "key1", keys[0].(analytics.AnalyticsRecord).APIKey)
+}
+
+func TestWriteToPumpsProcessedBy(t *testing.T) {
+	csvPump := &RecordingPump{}
+	csvPump.SetProcessedBy("csv")
+	mongoPump := &RecordingPump{}
+	mongoPump.SetProcessedBy("mongo")
+	otherPump := &RecordingPump{}
+	Pumps = []pumps.Pump{csvPump, mongoPump, otherPump}
+
+	keys := []interface{}{
+		analytics.AnalyticsRecord{APIID: "api1"},
+		analytics.AnalyticsRecord{APIID: "api2"},
+	}
+	writeToPumps(keys, instrument.NewJob("TestJob"), time.Now(), 2)
+
+	for _, tc := range []struct {
+		pump     *RecordingPump
+		expected string
+	}{
+		{pump: csvPump, expected: "csv"},
+		{pump: mongoPump, expected: "mongo"},
+		{pump: otherPump, expected: ""},
+	} {
+		assert.Len(t, tc.pump.Records, 2)
+		for _, record := range tc.pump.Records {
+			assert.Equal(t, tc.expected, record.ProcessedBy)
+		}
+	}
+
+	// the batch shared by the pumps isn't modified
+	for _, key := range keys {
+		assert.Equal(t, "", key.(analytics.AnalyticsRecord).ProcessedBy)
+	}
+}
+
+// FlakyPump fails to initialise until its backend is available, after Failures attempts.
+type FlakyPump struct {
+	Failures int
+	Attempts int
+	pumps.CommonPumpConfig
+}
+
+func (p *FlakyPump) GetName() string {
+	return "Flaky Pump"
+}
+
+func (p *FlakyPump) New() pumps.Pump {
+	return &FlakyPump{}
+}
+
+func (p *FlakyPump) Init(config interface{}) error {
+	p.Attempts++
+	if p.Attempts <= p.Failures {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (p *FlakyPump) WriteData(ctx context.Context, keys []interface{}) error {
+	return nil
+}
+
+func TestInitPumpWithRetries(t *testing.T) {
+	tcs := []struct {
+		testName         string
+		failures         int
+		retries          int
+		expectedErr      bool
+		expectedAttempts int
+	}{
+		{testName: "backend available", failures: 0, retries: 0, expectedAttempts: 1},
+		{testName: "no retries", failures: 1, retries: 0, expectedErr: true, expectedAttempts: 1},
+		{testName: "available after retries", failures: 3, retries: 3, expectedAttempts: 4},
+		{testName: "retries exhausted", failures: 5, retries: 3, expectedErr: true, expectedAttempts: 4},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			pmp := &FlakyPump{Failures: tc.failures}
+			err := initPumpWithRetries(pmp, nil, tc.retries, time.Millisecond)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expectedAttempts, pmp.Attempts)
+		})
+	}
+}
+
+func TestInitialisePumpsAggregateBuffer(t *testing.T) {
+	defer func() {
+		SystemConfig = TykPumpConfiguration{}
+		Pumps = nil
+	}()
+
+	SystemConfig = TykPumpConfiguration{
+		DontPurgeUptimeData: true,
+		Pumps: map[string]PumpConfig{
+			"buffered": {Type: "dummy", AggregateBuffer: pumps.AggregateBufferConf{FlushInterval: 60}},
+			"plain":    {Type: "dummy"},
+		},
+	}
+	initialisePumps()
+
+	// the aggregate buffer is refused on the other pumps
+	assert.Len(t, Pumps, 1)
+	assert.Equal(t, "plain", PumpKeys[Pumps[0]])
+}
+
+func TestInitialisePumpsKeyHashingBypass(t *testing.T) {
+	defer func() {
+		SystemConfig = TykPumpConfiguration{}
+		Pumps = nil
+	}()
+
+	SystemConfig = TykPumpConfiguration{
+		DontPurgeUptimeData: true,
+		KeyHashing:          KeyHashingConf{BypassPumps: []string{"raw"}},
+		Pumps: map[string]PumpConfig{
+			"raw":    {Type: "dummy"},
+			"hashed": {Type: "dummy"},
+		},
+	}
+	// the pumps of a previous initialisation don't bypass the hashing anymore
+	initialisePumps()
+	initialisePumps()
+
+	assert.Len(t, KeyHashingBypass, 1)
+	for pmp := range KeyHashingBypass {
+		assert.Equal(t, "raw", PumpKeys[pmp])
+	}
+}
+
+func TestSetupDisabledEnrichments(t *testing.T) {
+	defer func() {
+		SystemConfig = TykPumpConfiguration{}
+	}()
+
+	SystemConfig = TykPumpConfiguration{
+		BotDetection:  BotDetectionConf{Enabled: true},
+		PIIDetection:  PIIDetectionConf{Enabled: true},
+		TLSInfo:       TLSInfoConf{Enabled: true},
+		LatencyPhases: LatencyPhasesConf{Enabled: true},
+		JWTClaims:     JWTClaimsConf{Enabled: true},
+		KeyHashing:    KeyHashingConf{Enabled: true, Algorithm: analytics.KeyHashHMACSHA256, Salt: "salt"},
+	}
+	setupBotDetection()
+	setupPIIDetection()
+	setupTLSInfo()
+	setupLatencyPhases()
+	setupJWTClaims()
+	setupKeyHashing()
+	assert.NotNil(t, BotDetector)
+	assert.NotNil(t, PIIDetector)
+	assert.NotNil(t, TLSInfoSources)
+	assert.NotNil(t, LatencyPhasesTags)
+	assert.NotNil(t, JWTClaimsExtractor)
+	assert.NotNil(t, KeyHasher)
+
+	// a reload with the enrichments disabled clears them
+	SystemConfig = TykPumpConfiguration{}
+	setupBotDetection()
+	setupPIIDetection()
+	setupTLSInfo()
+	setupLatencyPhases()
+	setupJWTClaims()
+	setupKeyHashing()
+	assert.Nil(t, BotDetector)
+	assert.Nil(t, PIIDetector)
+	assert.Nil(t, TLSInfoSources)
+	assert.Nil(t, LatencyPhasesTags)
+	assert.Nil(t, JWTClaimsExtractor)
+	assert.Nil(t, KeyHasher)
+}
+
+func TestPumpInitRetryInterval(t *testing.T) {
+	assert.Equal(t, defaultInitRetryInterval, pumpInitRetryInterval(0))
+	assert.Equal(t, 2*time.Second, pumpInitRetryInterval(2))
+}
+
+func TestPreprocessAnalyticsValuesRecordTTL(t *testing.T) {
+	defer func() {
+		SystemConfig.RecordTTL = 0
+	}()
+
+	timestamp := time.Now().Truncate(time.Second).Add(-time.Hour)
+	gatewayExpiry := timestamp.Add(7 * 24 * time.Hour)
+	msgpackSerializer := serializer.NewAnalyticsSerializer(serializer.MSGP_SERIALIZER)
+	encoded, err := msgpackSerializer.Encode(&analytics.AnalyticsRecord{APIID: "api1", OrgID: "org1", TimeStamp: timestamp, ExpireAt: gatewayExpiry})
+	assert.Nil(t, err)
+	values := []interface{}{string(encoded)}
+
+	tcs := []struct {
+		testName       string
+		recordTTL      int
+		expectedExpiry time.Time
+	}{
+		{testName: "gateway expiry", expectedExpiry: gatewayExpiry},
+		{testName: "record_ttl", recordTTL: 3600, expectedExpiry: timestamp.Add(time.Hour)},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			SystemConfig.RecordTTL = tc.recordTTL
+			recordingPump := &RecordingPump{}
+			Pumps = []pumps.Pump{recordingPump}
+
+			PreprocessAnalyticsValues(values, msgpackSerializer, "analytics", false, instrument.NewJob("TestJob"), time.Now(), 2)
+
+			assert.Len(t, recordingPump.Records, 1)
+			assert.True(t, tc.expectedExpiry.Equal(recordingPump.Records[0].ExpireAt))
+
+			// the aggregates, e.g. of the Mongo aggregate pump, expire with their records
+			keys := []interface{}{recordingPump.Records[0]}
+			aggregate := analytics.AggregateData(keys, false, nil, "", 60)["org1"]
+			assert.True(t, tc.expectedExpiry.Equal(aggregate.ExpireAt))
+		})
+	}
+}
+
+func TestPreprocessAnalyticsValuesTagMap(t *testing.T) {
+	defer func() {
+		SystemConfig.TagMap = TagMapConf{}
+		Pumps = nil
+	}()
+
+	msgpackSerializer := serializer.NewAnalyticsSerializer(serializer.MSGP_SERIALIZER)
+	encoded, err := msgpackSerializer.Encode(&analytics.AnalyticsRecord{APIID: "api1", OrgID: "org1", TimeStamp: time.Now(), Tags: []string{"key-abc", "team:payments"}})
+	assert.Nil(t, err)
+	values := []interface{}{string(encoded)}
+
+	keepTags := false
+	tcs := []struct {
+		testName     string
+		conf         TagMapConf
+		expectedTags []string
+	}{
+		{testName: "keep_tags by default", conf: TagMapConf{Enabled: true}, expectedTags: []string{"key-abc", "team:payments"}},
+		{testName: "keep_tags false", conf: TagMapConf{Enabled: true, KeepTags: &keepTags}, expectedTags: []string{"key-abc"}},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			SystemConfig.TagMap = tc.conf
+			recordingPump := &RecordingPump{}
+			Pumps = []pumps.Pump{recordingPump}
+
+			PreprocessAnalyticsValues(values, msgpackSerializer, "analytics", false, instrument.NewJob("TestJob"), time.Now(), 2)
+
+			assert.Len(t, recordingPump.Records, 1)
+			record := recordingPump.Records[0]
+			assert.Equal(t, map[string]string{"team": "payments"}, record.TagMap)
+			assert.Equal(t, tc.expectedTags, record.Tags)
+
+			// the tags aggregation, and its ignore_tag_prefix_list, only see the tags kept
+			aggregate := analytics.AggregateData([]interface{}{record}, false, []string{"key-"}, "", 60)["org1"]
+			_, found := aggregate.Tags["team:payments"]
+			assert.Equal(t, len(tc.expectedTags) == 2, found)
+			assert.NotContains(t, aggregate.Tags, "key-abc")
+		})
+	}
+}
+
+func TestPreprocessAnalyticsValuesRecordSize(t *testing.T) {
+	SystemConfig.RecordSize = true
+	defer func() {
+		SystemConfig.RecordSize = false
+	}()
+
+	records := []analytics.AnalyticsRecord{
+		{APIID: "api1", Path: "/get"},
+		{APIID: "api1", Path: "/post", RawRequest: "UE9TVCAvcG9zdCBIVFRQLzEuMQ0KDQp7fQ==", RawResponse: "SFRUUC8xLjEgMjAwIE9LDQoNCnsic3RhdHVzIjoib2sifQ=="},
+	}
+
+	for _, serializerType := range []string{serializer.MSGP_SERIALIZER, serializer.PROTOBUF_SERIALIZER} {
+		t.Run(serializerType, func(t *testing.T) {
+			recordingPump := &RecordingPump{}
+			Pumps = []pumps.Pump{recordingPump}
+
+			analyticsSerializer := serializer.NewAnalyticsSerializer(serializerType)
+			values := []interface{}{}
+			sizes := []int64{}
+			for i := range records {
+				encoded, err := analyticsSerializer.Encode(&records[i])
+				assert.Nil(t, err)
+				values = append(values, string(encoded))
+				sizes = append(sizes, int64(len(encoded)))
+			}
+
+			PreprocessAnalyticsValues(values, analyticsSerializer, "analytics", false, instrument.NewJob("TestJob"), time.Now(), 2)
+
+			assert.Len(t, recordingPump.Records, 2)
+			for i, record := range recordingPump.Records {
+				assert.Equal(t, sizes[i], record.RecordSizeBytes)
+			}
+			assert.Greater(t, recordingPump.Records[1].RecordSizeBytes, recordingPump.Records[0].RecordSizeBytes)
+		})
+	}
+}
+
+func TestPreprocessAnalyticsValuesDetailedRecordingRates(t *testing.T) {
+	SystemConfig.DetailedRecordingRates = map[string]float64{"org1": 0.5, "org2": 0}
+	setupDetailedRecordingRates()
+	defer func() {
+		SystemConfig.DetailedRecordingRates = nil
+		setupDetailedRecordingRates()
+	}()
+
+	msgpackSerializer := serializer.NewAnalyticsSerializer(serializer.MSGP_SERIALIZER)
+	values := []interface{}{}
+	for _, orgID := range []string{"org1", "org2", "org3"} {
+		for i := 0; i < 4; i++ {
+			encoded, err := msgpackSerializer.Encode(&analytics.AnalyticsRecord{OrgID: orgID, APIID: "api1", RawRequest: "cmVxdWVzdA==", RawResponse: "cmVzcG9uc2U="})
+			assert.Nil(t, err)
+			values = append(values, string(encoded))
+		}
+	}
+	recordingPump := &RecordingPump{}
+	Pumps = []pumps.Pump{recordingPump}
+
+	PreprocessAnalyticsValues(values, msgpackSerializer, "analytics", false, instrument.NewJob("TestJob"), time.Now(), 2)
+
+	// all the records are written, only some with their raw data
+	assert.Len(t, recordingPump.Records, 12)
+	withBodies := map[string]int{}
+	for _, record := range recordingPump.Records {
+		if record.RawRequest != "" && record.RawResponse != "" {
+			withBodies[record.OrgID]++
+		}
+	}
+	assert.Equal(t, map[string]int{"org1": 2, "org3": 4}, withBodies)
+}
+
+func TestPreprocessAnalyticsValuesBatchSummary(t *testing.T) {
+	msgpackSerializer := serializer.NewAnalyticsSerializer(serializer.MSGP_SERIALIZER)
+	encode := func(records ...analytics.AnalyticsRecord) []interface{} {
+		values := []interface{}{}
+		for _, record := range records {
+			encoded, err := msgpackSerializer.Encode(&record)
+			assert.Nil(t, err)
+			values = append(values, string(encoded))
+		}
+		return values
+	}
+
+	monitoringPump := &RecordingPump{}
+	monitoringPump.SetFilters(analytics.AnalyticsFilters{OnlyBatchSummary: true})
+	recordingPump := &RecordingPump{}
+	Pumps = []pumps.Pump{monitoringPump, recordingPump}
+	BatchSummaryPumps = []pumps.Pump{monitoringPump}
+	defer func() {
+		Pumps = nil
+		BatchSummaryPumps = nil
+	}()
+
+	// a purge reading two analytics keys
+	job := instrument.NewJob("TestJob")
+	PreprocessAnalyticsValues(encode(
+		analytics.AnalyticsRecord{APIID: "api1", ResponseCode: 200, RequestTime: 12, Latency: analytics.Latency{Total: 12, Upstream: 10}},
+		analytics.AnalyticsRecord{APIID: "api1", ResponseCode: 200, RequestTime: 8, Latency: analytics.Latency{Total: 8, Upstream: 6}},
+	), msgpackSerializer, "analytics", false, job, time.Now(), 2)
+	PreprocessAnalyticsValues(encode(
+		analytics.AnalyticsRecord{APIID: "api2", ResponseCode: 502, RequestTime: 30, Latency: analytics.Latency{Total: 30, Upstream: 29}},
+	), msgpackSerializer, "analytics_1", false, job, time.Now(), 2)
+	assert.Empty(t, monitoringPump.Records)
+	processBatchSummary(job, time.Now(), 2)
+
+	assert.Len(t, recordingPump.Records, 3)
+	// a single summary for the whole purge, to the batch summary pumps only
+	assert.Len(t, monitoringPump.Records, 1)
+	summary := monitoringPump.Records[0]
+	assert.True(t, summary.IsBatchSummary())
+	assert.Equal(t, []string{analytics.BatchSummaryTag, "batch_records:3", "batch_response_code_200:2", "batch_response_code_502:1"}, summary.Tags)
+	assert.Equal(t, int64(50), summary.RequestTime)
+	assert.Equal(t, analytics.Latency{Total: 50, Upstream: 45}, summary.Latency)
+
+	// the summary is written once
+	processBatchSummary(job, time.Now(), 2)
+	assert.Len(t, monitoringPump.Records, 1)
+}
+
+func TestExecPumpWritingErrorLogSampling(t *testing.T) {
+	hook := test.NewLocal(log)
+
+	scriptedPump := &ScriptedPump{Failures: []bool{true, true, true, true, true, true, true, false}}
+	scriptedPump.SetErrorLogSampling(pumps.ErrorLogSamplingConf{First: 2, Every: 3})
+	keys := []interface{}{analytics.AnalyticsRecord{}}
+	for i := 0; i < len(scriptedPump.Failures); i++ {
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		execPumpWriting(&wg, scriptedPump, &keys, 2, time.Now(), nil, func() {})
+	}
+
+	var warnings []*logrus.Entry
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel {
+			warnings = append(warnings, entry)
+		}
+	}
+	// the 1st, 2nd and 5th errors are logged, then the 2 suppressed after the 5th on success
+	if assert.Len(t, warnings, 4) {
+		assert.NotContains(t, warnings[0].Data, "suppressed")
+		assert.NotContains(t, warnings[1].Data, "suppressed")
+		assert.Equal(t, 2, warnings[2].Data["suppressed"])
+		assert.Equal(t, "Suppressed 2 errors writing to Scripted Pump: backend unavailable", warnings[3].Message)
+		assert.Equal(t, 2, warnings[3].Data["suppressed"])
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/TykTechnologies/tyk-pump/pumps"
+)
+
+// pumpInitOrder returns the keys of the pumps in the order they must be initialised: each pump
+// after the pumps it depends on, and otherwise by key, so the order is deterministic. The
+// dependencies which aren't configured are ignored here, the pumps depending on them are skipped
+// when they're initialised. It returns an error if the dependencies have a cycle.
+func pumpInitOrder(configs map[string]PumpConfig) ([]string, error) {
+	keys := make([]string, 0, len(configs))
+	for key := range configs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	order := make([]string, 0, len(keys))
+
+	var visit func(key string, path []string) error
+	visit = func(key string, path []string) error {
+		switch state[key] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("cyclic pump dependencies: %s", strings.Join(append(path, key), " -> "))
+		}
+
+		state[key] = visiting
+		for _, dependency := range configs[key].DependsOn {
+			if _, ok := configs[dependency]; !ok {
+				continue
+			}
+			if err := visit(dependency, append(path, key)); err != nil {
+				return err
+			}
+		}
+		state[key] = visited
+		order = append(order, key)
+		return nil
+	}
+
+	for _, key := range keys {
+		if err := visit(key, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// failedPumpDependency returns the first of the dependencies of the pump which isn't in loaded,
+// because it isn't configured or failed to load, or an empty string if they're all loaded.
+func failedPumpDependency(conf PumpConfig, loaded map[string]pumps.Pump) string {
+	for _, dependency := range conf.DependsOn {
+		if _, ok := loaded[dependency]; !ok {
+			return dependency
+		}
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/pumps"
+)
+
+// initOrder is the order in which the OrderedPumps are initialised.
+var initOrder []string
+
+// OrderedPump records its initialisation in initOrder, and fails it if its meta has `fail` set.
+type OrderedPump struct {
+	pumps.CommonPumpConfig
+}
+
+func (p *OrderedPump) GetName() string {
+	return "Ordered Pump"
+}
+
+func (p *OrderedPump) New() pumps.Pump {
+	return &OrderedPump{}
+}
+
+func (p *OrderedPump) Init(config interface{}) error {
+	meta := config.(map[string]interface{})
+	initOrder = append(initOrder, meta["key"].(string))
+	if meta["fail"] == true {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (p *OrderedPump) WriteData(ctx context.Context, keys []interface{}) error {
+	return nil
+}
+
+func TestPumpInitOrder(t *testing.T) {
+	order, err := pumpInitOrder(map[string]PumpConfig{
+		"mongo-aggregate": {DependsOn: []string{"mongo"}},
+		"mongo":           {},
+		"csv":             {},
+		"alerts":          {DependsOn: []string{"mongo-aggregate", "csv"}},
+		"stdout":          {DependsOn: []string{"missing"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mongo", "mongo-aggregate", "csv", "alerts", "stdout"}, order)
+
+	_, err = pumpInitOrder(map[string]PumpConfig{
+		"a": {DependsOn: []string{"b"}},
+		"b": {DependsOn: []string{"c"}},
+		"c": {DependsOn: []string{"a"}},
+	})
+	assert.EqualError(t, err, "cyclic pump dependencies: a -> b -> c -> a")
+}
+
+func TestInitialisePumpsDependsOn(t *testing.T) {
+	pumps.AvailablePumps["ordered"] = &OrderedPump{}
+	defer delete(pumps.AvailablePumps, "ordered")
+
+	previousConfig := SystemConfig
+	defer func() {
+		SystemConfig = previousConfig
+		initOrder = nil
+	}()
+
+	pump := func(key string, fail bool, dependsOn ...string) PumpConfig {
+		return PumpConfig{
+			Type:      "ordered",
+			Meta:      map[string]interface{}{"key": key, "fail": fail},
+			DependsOn: dependsOn,
+		}
+	}
+
+	tcs := []struct {
+		testName      string
+		pumps         map[string]PumpConfig
+		expectedOrder []string
+		expectedPumps int
+	}{
+		{
+			testName: "dependency chain",
+			pumps: map[string]PumpConfig{
+				"c": pump("c", false, "b"),
+				"b": pump("b", false, "a"),
+				"a": pump("a", false),
+			},
+			expectedOrder: []string{"a", "b", "c"},
+			expectedPumps: 3,
+		},
+		{
+			testName: "failed dependency",
+			pumps: map[string]PumpConfig{
+				"c": pump("c", false, "b"),
+				"b": pump("b", false, "a"),
+				"a": pump("a", true),
+				"d": pump("d", false),
+			},
+			// b and c are skipped without being initialised
+			expectedOrder: []string{"a", "d"},
+			expectedPumps: 1,
+		},
+		{
+			testName: "failed dependency in the middle of the chain",
+			pumps: map[string]PumpConfig{
+				"c": pump("c", false, "b"),
+				"b": pump("b", true, "a"),
+				"a": pump("a", false),
+			},
+			expectedOrder: []string{"a", "b"},
+			expectedPumps: 1,
+		},
+		{
+			testName: "missing dependency",
+			pumps: map[string]PumpConfig{
+				"a": pump("a", false, "missing"),
+				"b": pump("b", false),
+			},
+			expectedOrder: []string{"b"},
+			expectedPumps: 1,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			initOrder = nil
+			SystemConfig = TykPumpConfiguration{Pumps: tc.pumps, DontPurgeUptimeData: true}
+			initialisePumps()
+			assert.Equal(t, tc.expectedOrder, initOrder)
+			assert.Len(t, Pumps, tc.expectedPumps)
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package pumps
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	aggregateBufferPrefix = "aggregate-buffer"
+
+	aggregateBufferDefaultBufferedBatches = 10
+	aggregateBufferDefaultMaxBuffered     = 1000000
+)
+
+// AggregateBufferConf buffers in memory the records written to an aggregate pump, to write them
+// as one batch every flush interval and on shutdown.
+type AggregateBufferConf struct {
+	// The number of seconds between the writes of the buffered records. Setting it enables the
+	// buffer.
+	FlushInterval int `json:"flush_interval" mapstructure:"flush_interval"`
+	// The number of buffered records triggering a write before the flush interval. Defaults to 0,
+	// no limit.
+	MaxRecords int `json:"max_records" mapstructure:"max_records"`
+	// The maximum number of records kept buffered while the writes fail. The oldest records beyond
+	// it are dropped. Defaults to 10 times max_records, or 1000000 without max_records.
+	MaxBufferedRecords int `json:"max_buffered_records" mapstructure:"max_buffered_records"`
+}
+
+// IsAggregatePump reports whether pmp is one of the aggregate pumps, the only ones supporting the
+// aggregate buffer.
+func IsAggregatePump(pmp Pump) bool {
+	switch pmp.(type) {
+	case *MongoAggregatePump, *SQLAggregatePump, *GraphMongoAggregatePump, *GraphSQLAggregatePump:
+		return true
+	}
+	return false
+}
+
+// AggregateBufferedPump buffers in memory the batches written to its Pump, and writes them as a
+// single batch every flush interval, so the aggregate pumps merge the partial buckets of the
+// batches, the records of the same org and aggregation period, into a single update of each
+// bucket. The buffered records are written on shutdown, before the Pump is shut down, so they
+// aren't lost. If a write fails, the records are kept buffered for the next one, up to
+// max_buffered_records.
+type AggregateBufferedPump struct {
+	Pump
+
+	conf AggregateBufferConf
+	log  *logrus.Entry
+
+	// writeMu serializes the writes to the Pump.
+	writeMu  sync.Mutex
+	bufferMu sync.Mutex
+	buffer   []interface{}
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewAggregateBufferedPump returns the initialised pmp buffering its batches as set by conf, and
+// starts the flush loop.
+func NewAggregateBufferedPump(pmp Pump, conf AggregateBufferConf) *AggregateBufferedPump {
+	if conf.MaxBufferedRecords <= 0 {
+		conf.MaxBufferedRecords = aggregateBufferDefaultMaxBuffered
+		if conf.MaxRecords > 0 {
+			conf.MaxBufferedRecords = aggregateBufferDefaultBufferedBatches * conf.MaxRecords
+		}
+	}
+
+	p := &AggregateBufferedPump{
+		Pump: pmp,
+		conf: conf,
+		log:  log.WithField("prefix", aggregateBufferPrefix).WithField("pump", pmp.GetName()),
+		stop: make(chan struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.flushLoop(time.Duration(conf.FlushInterval) * time.Second)
+	return p
+}
+
+// WriteData buffers the batch, and writes the buffered records if they reach max_records.
+func (p *AggregateBufferedPump) WriteData(ctx context.Context, data []interface{}) error {
+	p.bufferMu.Lock()
+	p.buffer = append(p.buffer, data...)
+	p.trimBuffer()
+	full := p.conf.MaxRecords > 0 && len(p.buffer) >= p.conf.MaxRecords
+	p.bufferMu.Unlock()
+
+	if full {
+		return p.flush(ctx)
+	}
+	return nil
+}
+
+// BufferedRecords returns the number of records in the buffer.
+func (p *AggregateBufferedPump) BufferedRecords() int {
+	p.bufferMu.Lock()
+	defer p.bufferMu.Unlock()
+	return len(p.buffer)
+}
+
+func (p *AggregateBufferedPump) flushLoop(interval time.Duration) {
+	defer p.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.timedFlush()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// timedFlush flushes the buffered records within the timeout of the Pump, if it has one.
+func (p *AggregateBufferedPump) timedFlush() {
+	ctx := context.Background()
+	if timeout := p.GetTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+	p.flush(ctx)
+}
+
+// flush writes the buffered records to the Pump as a single batch. They're put back in the buffer,
+// before the records buffered since, if the write fails.
+func (p *AggregateBufferedPump) flush(ctx context.Context) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+
+	p.bufferMu.Lock()
+	data := p.buffer
+	p.buffer = nil
+	p.bufferMu.Unlock()
+	if len(data) == 0 {
+		return nil
+	}
+
+	if err := p.Pump.WriteData(ctx, data); err != nil {
+		p.log.WithError(err).Warning("Write failed, keeping ", len(data), " records buffered")
+		p.bufferMu.Lock()
+		p.buffer = append(data, p.buffer...)
+		p.trimBuffer()
+		p.bufferMu.Unlock()
+		return err
+	}
+	p.log.Debug("Flushed ", len(data), " buffered records")
+	return nil
+}
+
+// trimBuffer drops the oldest buffered records beyond max_buffered_records. It must be called with
+// bufferMu held.
+func (p *AggregateBufferedPump) trimBuffer() {
+	max := p.conf.MaxBufferedRecords
+	if max <= 0 || len(p.buffer) <= max {
+		return
+	}
+	dropped := len(p.buffer) - max
+	p.log.Warning("Buffer full, dropping the ", dropped, " oldest records")
+	p.buffer = append([]interface{}(nil), p.buffer[dropped:]...)
+}
+
+// Shutdown stops the flush loop and writes the buffered records, then shuts the Pump down. The
+// records are lost if that last write fails.
+func (p *AggregateBufferedPump) Shutdown() error {
+	var err error
+	p.stopOnce.Do(func() {
+		close(p.stop)
+		p.wg.Wait()
+
+		if err = p.flush(context.Background()); err != nil {
+			p.log.WithError(err).Error("Flushing the buffered records on shutdown failed, ", p.BufferedRecords(), " records lost")
+		}
+	})
+	if shutdownErr := p.Pump.Shutdown(); shutdownErr != nil {
+		return shutdownErr
+	}
+	return err
+}
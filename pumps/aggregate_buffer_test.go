@@ -0,0 +1,123 @@
+package pumps
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+func TestAggregateBufferedPump(t *testing.T) {
+	backend := &outagePump{}
+	pmp := NewAggregateBufferedPump(backend, AggregateBufferConf{FlushInterval: 3600, MaxRecords: 4})
+	assert.Equal(t, "Outage Pump", pmp.GetName())
+
+	// the batches are buffered
+	assert.NoError(t, pmp.WriteData(context.TODO(), []interface{}{analytics.AnalyticsRecord{APIID: "a"}}))
+	assert.NoError(t, pmp.WriteData(context.TODO(), []interface{}{analytics.AnalyticsRecord{APIID: "b"}, analytics.AnalyticsRecord{APIID: "c"}}))
+	assert.Empty(t, backend.written)
+	assert.Equal(t, 3, pmp.BufferedRecords())
+
+	// and kept buffered when the write fails
+	backend.down = true
+	assert.Error(t, pmp.WriteData(context.TODO(), []interface{}{analytics.AnalyticsRecord{APIID: "d"}}))
+	assert.Equal(t, 4, pmp.BufferedRecords())
+
+	// until they're written as a single batch
+	backend.down = false
+	assert.NoError(t, pmp.WriteData(context.TODO(), []interface{}{analytics.AnalyticsRecord{APIID: "e"}}))
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, backend.written)
+	assert.Equal(t, 0, pmp.BufferedRecords())
+
+	// the records buffered at shutdown are written
+	assert.NoError(t, pmp.WriteData(context.TODO(), []interface{}{analytics.AnalyticsRecord{APIID: "f"}}))
+	assert.NoError(t, pmp.Shutdown())
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "f"}, backend.written)
+	assert.Equal(t, 0, pmp.BufferedRecords())
+}
+
+func TestAggregateBufferedPump_MaxBufferedRecords(t *testing.T) {
+	backend := &outagePump{down: true}
+	pmp := NewAggregateBufferedPump(backend, AggregateBufferConf{FlushInterval: 3600, MaxRecords: 2, MaxBufferedRecords: 3})
+
+	assert.NoError(t, pmp.WriteData(context.TODO(), []interface{}{analytics.AnalyticsRecord{APIID: "a"}}))
+	assert.Error(t, pmp.WriteData(context.TODO(), []interface{}{analytics.AnalyticsRecord{APIID: "b"}}))
+	assert.Error(t, pmp.WriteData(context.TODO(), []interface{}{analytics.AnalyticsRecord{APIID: "c"}, analytics.AnalyticsRecord{APIID: "d"}}))
+	// the oldest records are dropped while the writes fail
+	assert.Equal(t, 3, pmp.BufferedRecords())
+
+	backend.down = false
+	assert.NoError(t, pmp.Shutdown())
+	assert.Equal(t, []string{"b", "c", "d"}, backend.written)
+}
+
+func TestNewAggregateBufferedPump_Defaults(t *testing.T) {
+	pmp := NewAggregateBufferedPump(&outagePump{}, AggregateBufferConf{FlushInterval: 3600, MaxRecords: 100})
+	assert.Equal(t, 1000, pmp.conf.MaxBufferedRecords)
+	assert.NoError(t, pmp.Shutdown())
+
+	pmp = NewAggregateBufferedPump(&outagePump{}, AggregateBufferConf{FlushInterval: 3600})
+	assert.Equal(t, aggregateBufferDefaultMaxBuffered, pmp.conf.MaxBufferedRecords)
+	assert.NoError(t, pmp.Shutdown())
+}
+
+func TestIsAggregatePump(t *testing.T) {
+	assert.True(t, IsAggregatePump(&MongoAggregatePump{}))
+	assert.True(t, IsAggregatePump(&SQLAggregatePump{}))
+	assert.True(t, IsAggregatePump(&GraphMongoAggregatePump{}))
+	assert.True(t, IsAggregatePump(&GraphSQLAggregatePump{}))
+	assert.False(t, IsAggregatePump(&MongoPump{}))
+	assert.False(t, IsAggregatePump(&outagePump{}))
+}
+
+func TestAggregateBufferedPump_FlushInterval(t *testing.T) {
+	backend := &outagePump{}
+	pmp := NewAggregateBufferedPump(backend, AggregateBufferConf{FlushInterval: 1})
+
+	assert.NoError(t, pmp.WriteData(context.TODO(), []interface{}{analytics.AnalyticsRecord{APIID: "a"}}))
+	assert.Eventually(t, func() bool {
+		return pmp.BufferedRecords() == 0
+	}, 3*time.Second, 50*time.Millisecond)
+
+	assert.NoError(t, pmp.Shutdown())
+	assert.Equal(t, []string{"a"}, backend.written)
+}
+
+func TestAggregateBufferedPump_ShutdownMergesBuckets(t *testing.T) {
+	sqlPmp := &SQLAggregatePump{}
+	if err := sqlPmp.Init(map[string]interface{}{"type": "sqlite", "wide_rows": true}); err != nil {
+		t.Fatal("SQL Pump Aggregate couldn't be initialized with err: ", err)
+	}
+	defer func() {
+		if err := sqlPmp.db.Migrator().DropTable(analytics.AggregateWideSQLTable); err != nil {
+			t.Error(err)
+		}
+	}()
+	pmp := NewAggregateBufferedPump(sqlPmp, AggregateBufferConf{FlushInterval: 3600})
+
+	hour := time.Date(2019, 1, 1, 10, 15, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		batch := []interface{}{
+			analytics.AnalyticsRecord{OrgID: "1", APIID: "api1", ResponseCode: 200, RequestTime: 10, TimeStamp: hour.Add(time.Duration(i) * time.Minute)},
+		}
+		assert.NoError(t, pmp.WriteData(context.TODO(), batch))
+	}
+
+	// nothing is written before the shutdown
+	var count int64
+	assert.NoError(t, sqlPmp.db.Table(analytics.AggregateWideSQLTable).Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+
+	assert.NoError(t, pmp.Shutdown())
+
+	dbRecords := []analytics.SQLAnalyticsRecordAggregateWide{}
+	if err := sqlPmp.db.Table(analytics.AggregateWideSQLTable).Find(&dbRecords).Error; err != nil {
+		t.Fatal("Error getting analytics records from SQL")
+	}
+	assert.Len(t, dbRecords, 1)
+	assert.Equal(t, 3, dbRecords[0].Hits)
+	assert.Equal(t, float64(30), dbRecords[0].TotalRequestTime)
+}
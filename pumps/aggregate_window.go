@@ -0,0 +1,98 @@
+package pumps
+
+import (
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+// windowAggregate is the aggregate of the records written during a window.
+type windowAggregate struct {
+	TotalRecords int64
+	// ErrorRate is the percentage of the records with a response code >= 400, 0 if there isn't any
+	// record.
+	ErrorRate float64
+}
+
+// aggregateWindow aggregates the records written by a pump, and flushes the aggregate at a fixed
+// cadence, whatever the size and frequency of the batches. The window is reset on every flush.
+type aggregateWindow struct {
+	mu      sync.Mutex
+	records int64
+	errors  int64
+
+	flush    func(windowAggregate)
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// startAggregateWindow returns a window flushed to flush every interval, until it's closed.
+func startAggregateWindow(interval time.Duration, flush func(windowAggregate)) *aggregateWindow {
+	w := &aggregateWindow{
+		flush: flush,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				release := AcquireGoroutine()
+				w.flush(w.reset())
+				release()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// add aggregates the records of a batch into the window.
+func (w *aggregateWindow) add(data []interface{}) {
+	var records, errors int64
+	for _, v := range data {
+		record, ok := v.(analytics.AnalyticsRecord)
+		if !ok {
+			continue
+		}
+		records++
+		if record.ResponseCode >= 400 {
+			errors++
+		}
+	}
+
+	w.mu.Lock()
+	w.records += records
+	w.errors += errors
+	w.mu.Unlock()
+}
+
+// reset returns the aggregate of the window and starts a new one.
+func (w *aggregateWindow) reset() windowAggregate {
+	w.mu.Lock()
+	records, errors := w.records, w.errors
+	w.records, w.errors = 0, 0
+	w.mu.Unlock()
+
+	aggregate := windowAggregate{TotalRecords: records}
+	if records > 0 {
+		aggregate.ErrorRate = float64(errors) / float64(records) * 100
+	}
+	return aggregate
+}
+
+// close stops the flushes, and flushes the current window.
+func (w *aggregateWindow) close() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+		<-w.done
+		w.flush(w.reset())
+	})
+}
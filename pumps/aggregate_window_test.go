@@ -0,0 +1,88 @@
+package pumps
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+func TestAggregateWindow(t *testing.T) {
+	flushes := make(chan windowAggregate, 10)
+	interval := 100 * time.Millisecond
+	start := time.Now()
+	w := startAggregateWindow(interval, func(aggregate windowAggregate) {
+		flushes <- aggregate
+	})
+
+	w.add([]interface{}{
+		analytics.AnalyticsRecord{ResponseCode: 200},
+		analytics.AnalyticsRecord{ResponseCode: 404},
+	})
+	w.add([]interface{}{
+		analytics.AnalyticsRecord{ResponseCode: 500},
+		analytics.AnalyticsRecord{ResponseCode: 201},
+	})
+
+	// the batches are aggregated and flushed at the interval
+	select {
+	case aggregate := <-flushes:
+		assert.GreaterOrEqual(t, time.Since(start), interval)
+		assert.Equal(t, windowAggregate{TotalRecords: 4, ErrorRate: 50}, aggregate)
+	case <-time.After(time.Second):
+		t.Fatal("the aggregate wasn't flushed")
+	}
+
+	// the window is reset after each flush
+	select {
+	case aggregate := <-flushes:
+		assert.Equal(t, windowAggregate{}, aggregate)
+	case <-time.After(time.Second):
+		t.Fatal("the aggregate wasn't flushed")
+	}
+
+	// the current window is flushed on close
+	w.add([]interface{}{analytics.AnalyticsRecord{ResponseCode: 503}})
+	w.close()
+	w.close()
+	var total int64
+	for len(flushes) > 0 {
+		total += (<-flushes).TotalRecords
+	}
+	assert.Equal(t, int64(1), total)
+
+	select {
+	case <-flushes:
+		t.Fatal("the aggregate was flushed after close")
+	case <-time.After(2 * interval):
+	}
+}
+
+func TestAggregateWindow_Goroutines(t *testing.T) {
+	SetMaxGoroutines(1)
+	defer SetMaxGoroutines(0)
+
+	active := make(chan int, 10)
+	w := startAggregateWindow(50*time.Millisecond, func(aggregate windowAggregate) {
+		active <- ActiveGoroutines()
+	})
+	defer w.close()
+
+	// the flushes wait for a free goroutine
+	release := AcquireGoroutine()
+	select {
+	case <-active:
+		t.Fatal("the window was flushed while the goroutines were all taken")
+	case <-time.After(150 * time.Millisecond):
+	}
+	release()
+
+	select {
+	case n := <-active:
+		assert.Equal(t, 1, n)
+	case <-time.After(time.Second):
+		t.Fatal("the window wasn't flushed once the goroutine was released")
+	}
+}
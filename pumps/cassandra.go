@@ -0,0 +1,338 @@
+package pumps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+type CassandraPump struct {
+	conf        *CassandraConf
+	consistency gocql.Consistency
+	session     *gocql.Session
+	CommonPumpConfig
+}
+
+const (
+	cassandraPrefix              = "cassandra-pump"
+	cassandraDefaultENV          = PUMPS_ENV_PREFIX + "_CASSANDRA" + PUMPS_ENV_META_PREFIX
+	cassandraDefaultTable        = "tyk_analytics"
+	cassandraDefaultConsistency  = "LOCAL_QUORUM"
+	cassandraDefaultTimeout      = 10
+	cassandraDefaultBatchSize    = 50
+	cassandraDefaultMaxBatchSize = 50 * 1024
+)
+
+var cassandraIdentifier = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// @PumpConf Cassandra
+type CassandraConf struct {
+	EnvPrefix string `mapstructure:"meta_env_prefix"`
+	// The addresses of the Cassandra or ScyllaDB nodes used to discover the cluster. E.g.
+	// `["cassandra-1", "cassandra-2:9043"]`.
+	ContactPoints []string `json:"contact_points" mapstructure:"contact_points"`
+	// The keyspace of the table. It must exist.
+	Keyspace string `json:"keyspace" mapstructure:"keyspace"`
+	// The table the records are written to. Defaults to `tyk_analytics`.
+	Table string `json:"table" mapstructure:"table"`
+	// Setting this to true creates the table if it doesn't exist. Defaults to `false`.
+	CreateTable bool `json:"create_table" mapstructure:"create_table"`
+	// The consistency level of the writes, e.g. `ONE`, `QUORUM` or `LOCAL_QUORUM`. Defaults to
+	// `LOCAL_QUORUM`.
+	Consistency string `json:"consistency" mapstructure:"consistency"`
+	// The username used to authenticate. Setting it enables the password authentication.
+	Username string `json:"username" mapstructure:"username"`
+	// The password used to authenticate.
+	Password string `json:"password" mapstructure:"password"`
+	// The timeout of the connections and queries, in seconds. Defaults to 10.
+	Timeout int `json:"timeout" mapstructure:"timeout"`
+	// The maximum number of records of a batch. Defaults to 50.
+	BatchSize int `json:"batch_size" mapstructure:"batch_size"`
+	// The maximum size of a batch, in bytes, estimated from the size of the record values. Keep it
+	// under the `batch_size_fail_threshold_in_kb` of the cluster. Defaults to 51200.
+	MaxBatchSize int `json:"max_batch_size" mapstructure:"max_batch_size"`
+}
+
+// cassandraColumns are the columns of the table, in the order of the values of a row.
+var cassandraColumns = []string{
+	"org_id", "day", "timestamp", "id", "method", "host", "path", "raw_path", "content_length",
+	"user_agent", "response_code", "api_key", "api_version", "api_name", "api_id", "oauth_id",
+	"request_time", "raw_request", "raw_response", "ip_address", "tags", "alias", "latency_total",
+	"latency_upstream",
+}
+
+// cassandraRow is the row of a record, along with its estimated size.
+type cassandraRow struct {
+	values []interface{}
+	size   int
+}
+
+// cassandraPartition is the partition key of the rows, (org_id, day).
+type cassandraPartition struct {
+	orgID string
+	day   string
+}
+
+func (c *CassandraPump) New() Pump {
+	newPump := CassandraPump{}
+	return &newPump
+}
+
+func (c *CassandraPump) GetName() string {
+	return "Cassandra Pump"
+}
+
+func (c *CassandraPump) GetEnvPrefix() string {
+	return c.conf.EnvPrefix
+}
+
+func (c *CassandraPump) Init(conf interface{}) error {
+	c.conf = &CassandraConf{}
+	c.log = log.WithField("prefix", cassandraPrefix)
+
+	err := mapstructure.Decode(conf, &c.conf)
+	if err != nil {
+		c.log.Fatal("Failed to decode configuration: ", err)
+	}
+
+	processPumpEnvVars(c, c.log, c.conf, cassandraDefaultENV)
+
+	if err := c.setDefaults(); err != nil {
+		return err
+	}
+
+	cluster := gocql.NewCluster(c.conf.ContactPoints...)
+	cluster.Keyspace = c.conf.Keyspace
+	cluster.Consistency = c.consistency
+	cluster.Timeout = time.Duration(c.conf.Timeout) * time.Second
+	cluster.ConnectTimeout = cluster.Timeout
+	if c.conf.Username != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{
+			Username: c.conf.Username,
+			Password: c.conf.Password,
+		}
+	}
+
+	c.session, err = cluster.CreateSession()
+	if err != nil {
+		c.log.Error("Failed to connect to Cassandra: ", err)
+		return err
+	}
+
+	if c.conf.CreateTable {
+		if err := c.session.Query(c.createTableStatement()).Exec(); err != nil {
+			c.log.Error("Failed to create the table: ", err)
+			return err
+		}
+	}
+
+	c.log.Info(c.GetName() + " Initialized")
+	return nil
+}
+
+// setDefaults validates the configuration and sets the defaults of the missing options.
+func (c *CassandraPump) setDefaults() error {
+	if len(c.conf.ContactPoints) == 0 {
+		return errors.New("missing \"contact_points\" in pump configuration")
+	}
+	if c.conf.Keyspace == "" {
+		return errors.New("missing \"keyspace\" in pump configuration")
+	}
+	if c.conf.Table == "" {
+		c.conf.Table = cassandraDefaultTable
+	}
+	for _, identifier := range []string{c.conf.Keyspace, c.conf.Table} {
+		if !cassandraIdentifier.MatchString(identifier) {
+			return fmt.Errorf("invalid keyspace or table name %q", identifier)
+		}
+	}
+
+	if c.conf.Consistency == "" {
+		c.conf.Consistency = cassandraDefaultConsistency
+	}
+	consistency, err := gocql.ParseConsistencyWrapper(c.conf.Consistency)
+	if err != nil {
+		return err
+	}
+	c.consistency = consistency
+
+	if c.conf.Timeout <= 0 {
+		c.conf.Timeout = cassandraDefaultTimeout
+	}
+	if c.conf.BatchSize <= 0 {
+		c.conf.BatchSize = cassandraDefaultBatchSize
+	}
+	if c.conf.MaxBatchSize <= 0 {
+		c.conf.MaxBatchSize = cassandraDefaultMaxBatchSize
+	}
+	return nil
+}
+
+func (c *CassandraPump) createTableStatement() string {
+	return `CREATE TABLE IF NOT EXISTS ` + c.conf.Keyspace + `.` + c.conf.Table + ` (
+	org_id text,
+	day date,
+	timestamp timestamp,
+	id timeuuid,
+	method text,
+	host text,
+	path text,
+	raw_path text,
+	content_length bigint,
+	user_agent text,
+	response_code int,
+	api_key text,
+	api_version text,
+	api_name text,
+	api_id text,
+	oauth_id text,
+	request_time bigint,
+	raw_request text,
+	raw_response text,
+	ip_address text,
+	tags list<text>,
+	alias text,
+	latency_total bigint,
+	latency_upstream bigint,
+	PRIMARY KEY ((org_id, day), timestamp, id)
+) WITH CLUSTERING ORDER BY (timestamp DESC, id DESC)`
+}
+
+func (c *CassandraPump) insertStatement() string {
+	return "INSERT INTO " + c.conf.Keyspace + "." + c.conf.Table + " (" + strings.Join(cassandraColumns, ", ") +
+		") VALUES (" + strings.TrimSuffix(strings.Repeat("?, ", len(cassandraColumns)), ", ") + ")"
+}
+
+// newCassandraRow returns the row of record, in the order of cassandraColumns.
+func newCassandraRow(record analytics.AnalyticsRecord) cassandraRow {
+	timestamp := record.TimeStamp.UTC()
+	values := []interface{}{
+		record.OrgID,
+		time.Date(timestamp.Year(), timestamp.Month(), timestamp.Day(), 0, 0, 0, 0, time.UTC),
+		timestamp,
+		gocql.UUIDFromTime(timestamp),
+		record.Method,
+		record.Host,
+		record.Path,
+		record.RawPath,
+		record.ContentLength,
+		record.UserAgent,
+		record.ResponseCode,
+		record.APIKey,
+		record.APIVersion,
+		record.APIName,
+		record.APIID,
+		record.OauthID,
+		record.RequestTime,
+		record.RawRequest,
+		record.RawResponse,
+		record.IPAddress,
+		record.Tags,
+		record.Alias,
+		record.Latency.Total,
+		record.Latency.Upstream,
+	}
+
+	// the fixed size columns take roughly 64 bytes
+	size := 64
+	for _, value := range values {
+		switch v := value.(type) {
+		case string:
+			size += len(v)
+		case []string:
+			for _, tag := range v {
+				size += len(tag)
+			}
+		}
+	}
+	return cassandraRow{values: values, size: size}
+}
+
+// cassandraBatches groups the rows by partition, as batches spanning several partitions are
+// expensive for the coordinator, and splits each partition into batches of at most batchSize
+// rows and maxBatchSize bytes. A row bigger than maxBatchSize gets its own batch.
+func cassandraBatches(rows []cassandraRow, batchSize, maxBatchSize int) [][]cassandraRow {
+	partitions := map[cassandraPartition][]cassandraRow{}
+	keys := []cassandraPartition{}
+	for _, row := range rows {
+		key := cassandraPartition{
+			orgID: row.values[0].(string),
+			day:   row.values[1].(time.Time).Format("2006-01-02"),
+		}
+		if _, found := partitions[key]; !found {
+			keys = append(keys, key)
+		}
+		partitions[key] = append(partitions[key], row)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].orgID != keys[j].orgID {
+			return keys[i].orgID < keys[j].orgID
+		}
+		return keys[i].day < keys[j].day
+	})
+
+	batches := [][]cassandraRow{}
+	for _, key := range keys {
+		var batch []cassandraRow
+		size := 0
+		for _, row := range partitions[key] {
+			if len(batch) > 0 && (len(batch) >= batchSize || size+row.size > maxBatchSize) {
+				batches = append(batches, batch)
+				batch = nil
+				size = 0
+			}
+			batch = append(batch, row)
+			size += row.size
+		}
+		if len(batch) > 0 {
+			batches = append(batches, batch)
+		}
+	}
+	return batches
+}
+
+func (c *CassandraPump) WriteData(ctx context.Context, data []interface{}) error {
+	c.log.Debug("Attempting to write ", len(data), " records...")
+
+	rows := make([]cassandraRow, 0, len(data))
+	for _, v := range data {
+		record, ok := v.(analytics.AnalyticsRecord)
+		if !ok {
+			c.log.Error("Error while writing ", v, ": data not of type analytics.AnalyticsRecord")
+			continue
+		}
+		rows = append(rows, newCassandraRow(record))
+	}
+
+	statement := c.insertStatement()
+	for _, rowsBatch := range cassandraBatches(rows, c.conf.BatchSize, c.conf.MaxBatchSize) {
+		batch := c.session.NewBatch(gocql.UnloggedBatch).WithContext(ctx)
+		batch.SetConsistency(c.consistency)
+		for _, row := range rowsBatch {
+			batch.Query(statement, row.values...)
+		}
+		if err := c.session.ExecuteBatch(batch); err != nil {
+			c.log.Error("Failed to write the records: ", err)
+			return err
+		}
+	}
+
+	c.log.Info("Purged ", len(rows), " records...")
+	return nil
+}
+
+func (c *CassandraPump) Shutdown() error {
+	if c.session != nil {
+		c.session.Close()
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package pumps
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+const cassandraTestKeyspace = "tyk_pump_test"
+
+func TestCassandraPumpSetDefaults(t *testing.T) {
+	tcs := []struct {
+		testName    string
+		conf        CassandraConf
+		expectedErr string
+	}{
+		{
+			testName:    "missing contact points",
+			conf:        CassandraConf{Keyspace: "tyk"},
+			expectedErr: "missing \"contact_points\" in pump configuration",
+		},
+		{
+			testName:    "missing keyspace",
+			conf:        CassandraConf{ContactPoints: []string{"localhost"}},
+			expectedErr: "missing \"keyspace\" in pump configuration",
+		},
+		{
+			testName:    "invalid table",
+			conf:        CassandraConf{ContactPoints: []string{"localhost"}, Keyspace: "tyk", Table: "analytics; DROP TABLE users"},
+			expectedErr: "invalid keyspace or table name \"analytics; DROP TABLE users\"",
+		},
+		{
+			testName:    "invalid consistency",
+			conf:        CassandraConf{ContactPoints: []string{"localhost"}, Keyspace: "tyk", Consistency: "SOME"},
+			expectedErr: "invalid consistency \"SOME\"",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			conf := tc.conf
+			pmp := &CassandraPump{conf: &conf}
+			err := pmp.setDefaults()
+			assert.NotNil(t, err)
+			assert.Contains(t, err.Error(), tc.expectedErr)
+		})
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		pmp := &CassandraPump{conf: &CassandraConf{ContactPoints: []string{"localhost"}, Keyspace: "tyk"}}
+		assert.Nil(t, pmp.setDefaults())
+		assert.Equal(t, cassandraDefaultTable, pmp.conf.Table)
+		assert.Equal(t, gocql.LocalQuorum, pmp.consistency)
+		assert.Equal(t, cassandraDefaultTimeout, pmp.conf.Timeout)
+		assert.Equal(t, cassandraDefaultBatchSize, pmp.conf.BatchSize)
+		assert.Equal(t, cassandraDefaultMaxBatchSize, pmp.conf.MaxBatchSize)
+		assert.Equal(t, strings.Count(pmp.insertStatement(), "?"), len(cassandraColumns))
+	})
+}
+
+func TestCassandraBatches(t *testing.T) {
+	day1 := time.Date(2023, 10, 1, 23, 59, 0, 0, time.UTC)
+	day2 := time.Date(2023, 10, 2, 0, 1, 0, 0, time.UTC)
+
+	rows := []cassandraRow{}
+	for i := 0; i < 5; i++ {
+		rows = append(rows, newCassandraRow(analytics.AnalyticsRecord{OrgID: "org1", TimeStamp: day1}))
+	}
+	rows = append(rows,
+		newCassandraRow(analytics.AnalyticsRecord{OrgID: "org1", TimeStamp: day2}),
+		newCassandraRow(analytics.AnalyticsRecord{OrgID: "org2", TimeStamp: day1, RawRequest: strings.Repeat("x", 1000)}),
+		newCassandraRow(analytics.AnalyticsRecord{OrgID: "org2", TimeStamp: day1}),
+	)
+
+	batches := cassandraBatches(rows, 2, 1000)
+
+	sizes := []int{}
+	for _, batch := range batches {
+		sizes = append(sizes, len(batch))
+		// the rows of a batch share their partition
+		for _, row := range batch {
+			assert.Equal(t, batch[0].values[0], row.values[0])
+			assert.Equal(t, batch[0].values[1], row.values[1])
+		}
+	}
+	// org1 day1 split by count, org1 day2, org2 day1 split by size
+	assert.Equal(t, []int{2, 2, 1, 1, 1, 1}, sizes)
+	assert.Equal(t, time.Date(2023, 10, 2, 0, 0, 0, 0, time.UTC), batches[3][0].values[1])
+	assert.Equal(t, "org2", batches[4][0].values[0])
+}
+
+func TestNewCassandraRow(t *testing.T) {
+	timestamp := time.Date(2023, 10, 1, 12, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+	row := newCassandraRow(analytics.AnalyticsRecord{
+		OrgID:        "org1",
+		APIID:        "api1",
+		Path:         "/get",
+		ResponseCode: 200,
+		TimeStamp:    timestamp,
+		Tags:         []string{"tag1"},
+		Latency:      analytics.Latency{Total: 10, Upstream: 8},
+	})
+
+	assert.Len(t, row.values, len(cassandraColumns))
+	values := map[string]interface{}{}
+	for i, column := range cassandraColumns {
+		values[column] = row.values[i]
+	}
+	assert.Equal(t, "org1", values["org_id"])
+	assert.Equal(t, time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC), values["day"])
+	assert.Equal(t, timestamp.UTC(), values["timestamp"])
+	assert.Equal(t, timestamp.UTC(), values["id"].(gocql.UUID).Time())
+	assert.Equal(t, "api1", values["api_id"])
+	assert.Equal(t, 200, values["response_code"])
+	assert.Equal(t, []string{"tag1"}, values["tags"])
+	assert.Equal(t, int64(8), values["latency_upstream"])
+}
+
+func TestCassandraPumpWriteData(t *testing.T) {
+	cluster := gocql.NewCluster("localhost")
+	cluster.Timeout = 30 * time.Second
+	session, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal("Cassandra must be available on localhost:9042: ", err)
+	}
+	defer session.Close()
+	err = session.Query(`CREATE KEYSPACE IF NOT EXISTS ` + cassandraTestKeyspace + ` WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}`).Exec()
+	assert.Nil(t, err)
+	defer func() {
+		assert.Nil(t, session.Query(`DROP TABLE IF EXISTS `+cassandraTestKeyspace+`.`+cassandraDefaultTable).Exec())
+	}()
+
+	pmp := &CassandraPump{}
+	err = pmp.Init(map[string]interface{}{
+		"contact_points": []string{"localhost"},
+		"keyspace":       cassandraTestKeyspace,
+		"create_table":   true,
+		"consistency":    "ONE",
+		"batch_size":     3,
+		"timeout":        30,
+	})
+	assert.Nil(t, err)
+	defer pmp.Shutdown()
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	data := []interface{}{}
+	for i := 0; i < 10; i++ {
+		data = append(data, analytics.AnalyticsRecord{
+			OrgID:        "org1",
+			APIID:        "api1",
+			Path:         "/get",
+			ResponseCode: 200,
+			TimeStamp:    now.Add(-time.Duration(i) * time.Millisecond),
+		})
+	}
+	data = append(data, analytics.AnalyticsRecord{OrgID: "org2", APIID: "api2", ResponseCode: 500, TimeStamp: now})
+	assert.Nil(t, pmp.WriteData(context.Background(), data))
+
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var count int
+	assert.Nil(t, session.Query(`SELECT COUNT(*) FROM `+cassandraTestKeyspace+`.`+cassandraDefaultTable+` WHERE org_id = ? AND day = ?`, "org1", day).Scan(&count))
+	assert.Equal(t, 10, count)
+
+	var apiID string
+	var responseCode int
+	var timestamp time.Time
+	err = session.Query(`SELECT api_id, response_code, timestamp FROM `+cassandraTestKeyspace+`.`+cassandraDefaultTable+` WHERE org_id = ? AND day = ? LIMIT 1`, "org2", day).Scan(&apiID, &responseCode, &timestamp)
+	assert.Nil(t, err)
+	assert.Equal(t, "api2", apiID)
+	assert.Equal(t, 500, responseCode)
+	assert.Equal(t, now, timestamp.UTC())
+}
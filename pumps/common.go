@@ -1,6 +1,8 @@
 package pumps
 
 import (
+	"sync/atomic"
+
 	"github.com/TykTechnologies/tyk-pump/analytics"
 	"github.com/sirupsen/logrus"
 )
@@ -12,8 +14,19 @@ type CommonPumpConfig struct {
 	OmitDetailedRecording bool
 	log                   *logrus.Entry
 	ignoreFields          []string
+	allowedFields         []string
+	collapseWindow        int
+	sortByTimestamp       bool
+	processedBy           string
 	decodeResponseBase64  bool
 	decodeRequestBase64   bool
+	detailedRecordingAPIs []string
+	logSampleRate         int
+	logSampleCounter      uint64
+	sampling              SamplingConf
+	sampleCounter         uint64
+	errorLogSampling      ErrorLogSamplingConf
+	errorLogSampler       *errorLogSampler
 }
 
 func (p *CommonPumpConfig) SetFilters(filters analytics.AnalyticsFilters) {
@@ -65,6 +78,38 @@ func (p *CommonPumpConfig) GetIgnoreFields() []string {
 	return p.ignoreFields
 }
 
+func (p *CommonPumpConfig) SetAllowedFields(fields []string) {
+	p.allowedFields = fields
+}
+
+func (p *CommonPumpConfig) GetAllowedFields() []string {
+	return p.allowedFields
+}
+
+func (p *CommonPumpConfig) SetCollapseWindow(seconds int) {
+	p.collapseWindow = seconds
+}
+
+func (p *CommonPumpConfig) GetCollapseWindow() int {
+	return p.collapseWindow
+}
+
+func (p *CommonPumpConfig) SetSortByTimestamp(sort bool) {
+	p.sortByTimestamp = sort
+}
+
+func (p *CommonPumpConfig) GetSortByTimestamp() bool {
+	return p.sortByTimestamp
+}
+
+func (p *CommonPumpConfig) SetProcessedBy(name string) {
+	p.processedBy = name
+}
+
+func (p *CommonPumpConfig) GetProcessedBy() string {
+	return p.processedBy
+}
+
 func (p *CommonPumpConfig) SetDecodingResponse(decoding bool) {
 	p.decodeResponseBase64 = decoding
 }
@@ -80,3 +125,50 @@ func (p *CommonPumpConfig) GetDecodedRequest() bool {
 func (p *CommonPumpConfig) GetDecodedResponse() bool {
 	return p.decodeResponseBase64
 }
+
+func (p *CommonPumpConfig) SetDetailedRecordingAPIIDs(apiIDs []string) {
+	p.detailedRecordingAPIs = apiIDs
+}
+
+func (p *CommonPumpConfig) GetDetailedRecordingAPIIDs() []string {
+	return p.detailedRecordingAPIs
+}
+
+func (p *CommonPumpConfig) SetLogSampleRate(rate int) {
+	p.logSampleRate = rate
+}
+
+func (p *CommonPumpConfig) GetLogSampleRate() int {
+	return p.logSampleRate
+}
+
+// LogSampledRecords logs one of every log sample rate records, at debug level. It's called
+// after the records are successfully written, and the count is kept across writes.
+func (p *CommonPumpConfig) LogSampledRecords(records []interface{}) {
+	if p.logSampleRate <= 0 {
+		return
+	}
+	logger := p.log
+	if logger == nil {
+		logger = log.WithField("prefix", "pump")
+	}
+
+	rate := uint64(p.logSampleRate)
+	for _, record := range records {
+		if atomic.AddUint64(&p.logSampleCounter, 1)%rate != 0 {
+			continue
+		}
+		decoded, ok := record.(analytics.AnalyticsRecord)
+		if !ok {
+			continue
+		}
+		logger.WithFields(logrus.Fields{
+			"api_id":        decoded.APIID,
+			"org_id":        decoded.OrgID,
+			"method":        decoded.Method,
+			"path":          decoded.Path,
+			"response_code": decoded.ResponseCode,
+			"timestamp":     decoded.TimeStamp,
+		}).Debug("Sampled written record")
+	}
+}
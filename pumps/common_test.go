@@ -1,8 +1,12 @@
 package pumps
 
 import (
+	"strconv"
 	"testing"
 
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,3 +25,51 @@ func TestSetDecodingResponse(t *testing.T) {
 	assert.Equal(t, actualValue, pump.decodeResponseBase64)
 	assert.True(t, actualValue)
 }
+
+func TestLogSampledRecords(t *testing.T) {
+	records := make([]interface{}, 10)
+	for i := range records {
+		records[i] = analytics.AnalyticsRecord{APIID: "api" + strconv.Itoa(i)}
+	}
+
+	tcs := []struct {
+		testName        string
+		rate            int
+		expectedEntries int
+	}{
+		{testName: "disabled", rate: 0, expectedEntries: 0},
+		{testName: "every record", rate: 1, expectedEntries: 10},
+		{testName: "every 3 records", rate: 3, expectedEntries: 3},
+		{testName: "rate above records count", rate: 20, expectedEntries: 0},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			logger, hook := test.NewNullLogger()
+			logger.SetLevel(logrus.DebugLevel)
+
+			pump := &CommonPumpConfig{log: logger.WithField("prefix", "test")}
+			pump.SetLogSampleRate(tc.rate)
+			assert.Equal(t, tc.rate, pump.GetLogSampleRate())
+
+			pump.LogSampledRecords(records)
+			assert.Len(t, hook.AllEntries(), tc.expectedEntries)
+		})
+	}
+
+	t.Run("count kept across writes", func(t *testing.T) {
+		logger, hook := test.NewNullLogger()
+		logger.SetLevel(logrus.DebugLevel)
+
+		pump := &CommonPumpConfig{log: logger.WithField("prefix", "test")}
+		pump.SetLogSampleRate(4)
+
+		pump.LogSampledRecords(records[:3])
+		assert.Empty(t, hook.AllEntries())
+		pump.LogSampledRecords(records[3:])
+		entries := hook.AllEntries()
+		assert.Len(t, entries, 2)
+		assert.Equal(t, "api3", entries[0].Data["api_id"])
+		assert.Equal(t, "api7", entries[1].Data["api_id"])
+	})
+}
@@ -16,6 +16,7 @@ import (
 type CSVPump struct {
 	csvConf      *CSVConf
 	wroteHeaders bool
+	manifest     *fileManifest
 	CommonPumpConfig
 }
 
@@ -24,6 +25,24 @@ type CSVConf struct {
 	EnvPrefix string `mapstructure:"meta_env_prefix"`
 	// The directory and the filename where the CSV data will be stored.
 	CSVDir string `json:"csv_dir" mapstructure:"csv_dir"`
+	// Writes the complex fields, the geo data, network stats, latency and tags, JSON encoded in a
+	// single cell each instead of spreading them over several columns, so they can be decoded
+	// back. It changes the columns of the file, so it's better set before the file is created.
+	JSONComplexFields bool `json:"json_complex_fields" mapstructure:"json_complex_fields"`
+	// Adds the `LatencyTotal`, `LatencyUpstream` and `LatencyGateway` columns with the flat latency
+	// fields of `latency_breakdown`. It changes the columns of the file, so it's better set before the
+	// file is created.
+	LatencyColumns bool `json:"latency_columns" mapstructure:"latency_columns"`
+	// Adds an `Enrichment` column with the fields the pump derives from the records, e.g. the
+	// latency breakdown or the user agent families, as a JSON document of the fields which are set.
+	// It changes the columns of the file, so it's better set before the file is created.
+	EnrichmentColumn bool `json:"enrichment_column" mapstructure:"enrichment_column"`
+	// The path of a manifest of the CSV files, for the downstream ETL. It lists the path, the number
+	// of records, the time range and the size of each file, and it's rewritten after every write
+	// to an hourly file. Disabled by default.
+	ManifestPath string `json:"manifest_path" mapstructure:"manifest_path"`
+	// The format of the manifest, `json` or `csv`. Defaults to `json`.
+	ManifestFormat string `json:"manifest_format" mapstructure:"manifest_format"`
 }
 
 var csvPrefix = "csv-pump"
@@ -58,6 +77,14 @@ func (c *CSVPump) Init(conf interface{}) error {
 		c.log.Error(ferr.Error() + " dir: " + c.csvConf.CSVDir)
 	}
 
+	if c.csvConf.ManifestPath != "" {
+		c.manifest, err = openFileManifest(c.csvConf.ManifestPath, c.csvConf.ManifestFormat)
+		if err != nil {
+			c.log.Error("Failed to open the manifest: ", err)
+			return err
+		}
+	}
+
 	c.log.Info(c.GetName() + " Initialized")
 	return nil
 }
@@ -93,6 +120,15 @@ func (c *CSVPump) WriteData(ctx context.Context, data []interface{}) error {
 	if appendHeader {
 		startRecord := analytics.AnalyticsRecord{}
 		var headers = startRecord.GetFieldNames()
+		if c.csvConf.JSONComplexFields {
+			headers = startRecord.GetJSONFieldNames()
+		}
+		if c.csvConf.LatencyColumns {
+			headers = append(headers, analytics.LatencyFieldNames...)
+		}
+		if c.csvConf.EnrichmentColumn {
+			headers = append(headers, "Enrichment")
+		}
 
 		err := writer.Write(headers)
 		if err != nil {
@@ -109,6 +145,15 @@ func (c *CSVPump) WriteData(ctx context.Context, data []interface{}) error {
 		}
 
 		toWrite := decoded.GetLineValues()
+		if c.csvConf.JSONComplexFields {
+			toWrite = decoded.GetJSONLineValues()
+		}
+		if c.csvConf.LatencyColumns {
+			toWrite = append(toWrite, decoded.Enrichment.LatencyLineValues()...)
+		}
+		if c.csvConf.EnrichmentColumn {
+			toWrite = append(toWrite, decoded.Enrichment.JSONValue())
+		}
 		// toWrite := []string{
 		// 	decoded.Method,
 		// 	decoded.Path,
@@ -129,6 +174,22 @@ func (c *CSVPump) WriteData(ctx context.Context, data []interface{}) error {
 
 	}
 	writer.Flush()
+	if c.manifest != nil {
+		c.updateManifest(outfile, data)
+	}
 	c.log.Info("Purged ", len(data), " records...")
 	return nil
 }
+
+// updateManifest adds the records written to the file to the manifest.
+func (c *CSVPump) updateManifest(file *os.File, data []interface{}) {
+	info, err := file.Stat()
+	if err != nil {
+		c.log.Error("Failed to update the manifest: ", err)
+		return
+	}
+	first, last := recordsTimeRange(data)
+	if err := c.manifest.add(file.Name(), int64(len(data)), first, last, info.Size()); err != nil {
+		c.log.Error("Failed to update the manifest: ", err)
+	}
+}
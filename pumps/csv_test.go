@@ -3,12 +3,14 @@ package pumps
 import (
 	"context"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"os"
 	"reflect"
 	"testing"
 	"time"
 
+	"github.com/TykTechnologies/tyk-pump/analytics"
 	"github.com/TykTechnologies/tyk-pump/analytics/demo"
 	"github.com/stretchr/testify/assert"
 )
@@ -253,3 +255,82 @@ func GetFileAndRows(fname string) (*os.File, int, error) {
 	totalRows := len(filedata)
 	return openfile, totalRows, nil
 }
+
+func TestCSVPump_WriteDataJSONComplexFields(t *testing.T) {
+	c := &CSVPump{}
+	err := c.Init(map[string]interface{}{"csv_dir": "testingDirectory", "json_complex_fields": true})
+	assert.Nil(t, err)
+	defer os.RemoveAll(c.csvConf.CSVDir)
+
+	record := analytics.AnalyticsRecord{
+		APIID:   "api1",
+		Tags:    []string{"key-abc", "org-org1,eu"},
+		Network: analytics.NetworkStats{BytesIn: 10, BytesOut: 20},
+		Latency: analytics.Latency{Total: 12, Upstream: 10},
+	}
+	record.Geo.Country.ISOCode = "GB"
+	record.Geo.City.Names = map[string]string{"en": "London"}
+	record.Geo.Location.Latitude = 51.5
+	record.Geo.Location.TimeZone = "Europe/London"
+	assert.Nil(t, c.WriteData(context.Background(), []interface{}{record}))
+
+	curtime := time.Now()
+	fname := fmt.Sprintf("%d-%s-%d-%d.csv", curtime.Year(), curtime.Month().String(), curtime.Day(), curtime.Hour())
+	openfile, err := os.Open("./testingDirectory/" + fname)
+	assert.Nil(t, err)
+	defer openfile.Close()
+	rows, err := csv.NewReader(openfile).ReadAll()
+	assert.Nil(t, err)
+	assert.Len(t, rows, 2)
+
+	cells := map[string]string{}
+	for i, header := range rows[0] {
+		cells[header] = rows[1][i]
+	}
+	assert.Equal(t, "api1", cells["APIID"])
+
+	var geo analytics.GeoData
+	assert.Nil(t, json.Unmarshal([]byte(cells["GeoData"]), &geo))
+	assert.Equal(t, record.Geo, geo)
+
+	var network analytics.NetworkStats
+	assert.Nil(t, json.Unmarshal([]byte(cells["NetworkStats"]), &network))
+	assert.Equal(t, record.Network, network)
+
+	var latency analytics.Latency
+	assert.Nil(t, json.Unmarshal([]byte(cells["Latency"]), &latency))
+	assert.Equal(t, record.Latency, latency)
+
+	var tags []string
+	assert.Nil(t, json.Unmarshal([]byte(cells["Tags"]), &tags))
+	assert.Equal(t, record.Tags, tags)
+}
+
+func TestCSVPump_WriteDataEnrichmentColumns(t *testing.T) {
+	c := &CSVPump{}
+	err := c.Init(map[string]interface{}{"csv_dir": "testingDirectory", "latency_columns": true, "enrichment_column": true})
+	assert.Nil(t, err)
+	defer os.RemoveAll(c.csvConf.CSVDir)
+
+	records := []interface{}{
+		analytics.AnalyticsRecord{APIID: "api1", Enrichment: analytics.Enrichment{Browser: "Firefox", LatencyTotal: 120, LatencyGateway: 20}},
+		analytics.AnalyticsRecord{APIID: "api2"},
+	}
+	assert.Nil(t, c.WriteData(context.Background(), records))
+
+	curtime := time.Now()
+	fname := fmt.Sprintf("%d-%s-%d-%d.csv", curtime.Year(), curtime.Month().String(), curtime.Day(), curtime.Hour())
+	openfile, err := os.Open("./testingDirectory/" + fname)
+	assert.Nil(t, err)
+	defer openfile.Close()
+	rows, err := csv.NewReader(openfile).ReadAll()
+	assert.Nil(t, err)
+	assert.Len(t, rows, 3)
+
+	// the latency columns, then the enrichment fields in the last column only
+	headers := rows[0]
+	assert.Equal(t, []string{"LatencyTotal", "LatencyUpstream", "LatencyGateway", "Enrichment"}, headers[len(headers)-4:])
+	assert.NotContains(t, headers, "Browser")
+	assert.Equal(t, []string{"120", "0", "20", `{"browser":"Firefox","latency_gateway":20,"latency_total":120}`}, rows[1][len(headers)-4:])
+	assert.Equal(t, []string{"0", "0", "0", "{}"}, rows[2][len(headers)-4:])
+}
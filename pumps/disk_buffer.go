@@ -0,0 +1,242 @@
+package pumps
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/beeker1121/goque"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/vmihailenco/msgpack.v2"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+const (
+	diskBufferPrefix               = "disk-buffer"
+	defaultDiskBufferDrainInterval = 10 * time.Second
+)
+
+var errDiskBufferFull = errors.New("disk buffer full")
+
+// DiskBufferConf buffers on disk the batches a pump fails to write, to forward them once its
+// backend is reachable again.
+type DiskBufferConf struct {
+	// The directory of the buffer, an embedded LevelDB database. It must be specific to the pump.
+	// Setting it enables the buffer.
+	Path string `json:"path" mapstructure:"path"`
+	// The maximum size in bytes of the buffered batches. The batches beyond it are dropped.
+	// Defaults to 0, no limit.
+	MaxSizeBytes int64 `json:"max_size_bytes" mapstructure:"max_size_bytes"`
+	// The number of seconds between the attempts to forward the buffered batches. Defaults to 10.
+	DrainInterval int `json:"drain_interval" mapstructure:"drain_interval"`
+}
+
+// DiskBufferedPump writes the batches to its Pump and, when the write fails, persists them in an
+// embedded queue on disk. The buffered batches are forwarded in order, from a background loop,
+// once the Pump writes again. While batches are buffered, the new ones are buffered after them
+// to keep the order. The buffered batches survive the restarts.
+type DiskBufferedPump struct {
+	Pump
+
+	conf  DiskBufferConf
+	queue *goque.Queue
+	log   *logrus.Entry
+
+	// writeMu serializes the writes to the Pump and the changes to the queue.
+	writeMu sync.Mutex
+	size    int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewDiskBufferedPump opens the buffer of conf for the initialised pmp, and starts forwarding the
+// batches already buffered.
+func NewDiskBufferedPump(pmp Pump, conf DiskBufferConf) (*DiskBufferedPump, error) {
+	queue, err := goque.OpenQueue(conf.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &DiskBufferedPump{
+		Pump:  pmp,
+		conf:  conf,
+		queue: queue,
+		log:   log.WithField("prefix", diskBufferPrefix).WithField("pump", pmp.GetName()),
+		stop:  make(chan struct{}),
+	}
+	for offset := uint64(0); offset < queue.Length(); offset++ {
+		item, err := queue.PeekByOffset(offset)
+		if err != nil {
+			queue.Close()
+			return nil, err
+		}
+		p.size += int64(len(item.Value))
+	}
+	if queue.Length() > 0 {
+		p.log.Info(queue.Length(), " batches buffered, forwarding them")
+	}
+
+	interval := defaultDiskBufferDrainInterval
+	if conf.DrainInterval > 0 {
+		interval = time.Duration(conf.DrainInterval) * time.Second
+	}
+	p.wg.Add(1)
+	go p.drainLoop(interval)
+	return p, nil
+}
+
+// WriteData writes the batch to the Pump, or buffers it if the Pump fails or batches are already
+// buffered. It only fails if the batch can't be buffered.
+func (p *DiskBufferedPump) WriteData(ctx context.Context, data []interface{}) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+
+	if p.queue.Length() == 0 {
+		err := p.Pump.WriteData(ctx, data)
+		if err == nil {
+			return nil
+		}
+		p.log.WithError(err).Warning("Write failed, buffering ", len(data), " records")
+	}
+	return p.bufferLocked(data)
+}
+
+// bufferLocked persists the batch in the queue. It must be called with writeMu held.
+func (p *DiskBufferedPump) bufferLocked(data []interface{}) error {
+	records := make([]analytics.AnalyticsRecord, 0, len(data))
+	for _, v := range data {
+		if record, ok := v.(analytics.AnalyticsRecord); ok {
+			records = append(records, record)
+		}
+	}
+	encoded, err := msgpack.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	if p.conf.MaxSizeBytes > 0 && p.size+int64(len(encoded)) > p.conf.MaxSizeBytes {
+		p.log.Warning("Buffer full, dropping ", len(records), " records")
+		return errDiskBufferFull
+	}
+	if _, err := p.queue.Enqueue(encoded); err != nil {
+		return err
+	}
+	p.size += int64(len(encoded))
+	return nil
+}
+
+func (p *DiskBufferedPump) drainLoop(interval time.Duration) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			release := AcquireGoroutine()
+			p.drain()
+			release()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// drain forwards the buffered batches, oldest first, until the queue is empty or a write fails.
+// It returns the number of batches forwarded.
+func (p *DiskBufferedPump) drain() int {
+	forwarded := 0
+	for {
+		select {
+		case <-p.stop:
+			return forwarded
+		default:
+		}
+
+		ok, err := p.forwardNext()
+		if err != nil {
+			p.log.WithError(err).Debug("Forwarding failed, ", p.queue.Length(), " batches still buffered")
+			return forwarded
+		}
+		if !ok {
+			if forwarded > 0 {
+				p.log.Info("Forwarded ", forwarded, " buffered batches")
+			}
+			return forwarded
+		}
+		forwarded++
+	}
+}
+
+// forwardNext writes the oldest buffered batch to the Pump, and removes it from the queue once
+// written. It returns false if the queue is empty.
+func (p *DiskBufferedPump) forwardNext() (bool, error) {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+
+	item, err := p.queue.Peek()
+	if err == goque.ErrEmpty || err == goque.ErrOutOfBounds {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	records := []analytics.AnalyticsRecord{}
+	if err := msgpack.Unmarshal(item.Value, &records); err != nil {
+		// the batch can't ever be forwarded
+		p.log.WithError(err).Error("Dropping a buffered batch which can't be decoded")
+		return true, p.dequeueLocked(item)
+	}
+	data := make([]interface{}, len(records))
+	for i, record := range records {
+		data[i] = record
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout := p.GetTimeout(); timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+	if err := p.Pump.WriteData(ctx, data); err != nil {
+		return false, err
+	}
+	return true, p.dequeueLocked(item)
+}
+
+// dequeueLocked removes the item, the head of the queue. It must be called with writeMu held.
+func (p *DiskBufferedPump) dequeueLocked(item *goque.Item) error {
+	if _, err := p.queue.Dequeue(); err != nil {
+		return err
+	}
+	p.size -= int64(len(item.Value))
+	return nil
+}
+
+// BufferedBatches returns the number of batches in the buffer.
+func (p *DiskBufferedPump) BufferedBatches() uint64 {
+	return p.queue.Length()
+}
+
+// Shutdown stops the forwarding and closes the buffer, keeping the batches left for the next
+// start, then shuts the Pump down.
+func (p *DiskBufferedPump) Shutdown() error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+		p.wg.Wait()
+
+		p.writeMu.Lock()
+		if err := p.queue.Close(); err != nil {
+			p.log.WithError(err).Error("Closing the buffer failed")
+		}
+		p.writeMu.Unlock()
+	})
+	return p.Pump.Shutdown()
+}
@@ -0,0 +1,140 @@
+package pumps
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+// outagePump fails its writes while down, and records them otherwise.
+type outagePump struct {
+	down    bool
+	written []string
+	CommonPumpConfig
+}
+
+func (p *outagePump) GetName() string {
+	return "Outage Pump"
+}
+
+func (p *outagePump) New() Pump {
+	return &outagePump{}
+}
+
+func (p *outagePump) Init(config interface{}) error {
+	return nil
+}
+
+func (p *outagePump) WriteData(ctx context.Context, data []interface{}) error {
+	if p.down {
+		return errors.New("connection refused")
+	}
+	for _, v := range data {
+		p.written = append(p.written, v.(analytics.AnalyticsRecord).APIID)
+	}
+	return nil
+}
+
+func TestDiskBufferedPump(t *testing.T) {
+	conf := DiskBufferConf{Path: t.TempDir(), DrainInterval: 3600}
+	batch := func(apiIDs ...string) []interface{} {
+		data := []interface{}{}
+		for _, apiID := range apiIDs {
+			data = append(data, analytics.AnalyticsRecord{APIID: apiID, Path: "/" + apiID, TimeStamp: time.Now()})
+		}
+		return data
+	}
+
+	backend := &outagePump{}
+	pmp, err := NewDiskBufferedPump(backend, conf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Outage Pump", pmp.GetName())
+
+	// the batches are written directly while the backend is up
+	assert.NoError(t, pmp.WriteData(context.TODO(), batch("a")))
+	assert.Equal(t, []string{"a"}, backend.written)
+	assert.Equal(t, uint64(0), pmp.BufferedBatches())
+
+	// and buffered during the outage
+	backend.down = true
+	assert.NoError(t, pmp.WriteData(context.TODO(), batch("b", "c")))
+	assert.NoError(t, pmp.WriteData(context.TODO(), batch("d")))
+	assert.Equal(t, uint64(2), pmp.BufferedBatches())
+	assert.Equal(t, 0, pmp.drain())
+	assert.Equal(t, uint64(2), pmp.BufferedBatches())
+
+	// the buffered batches persist across a restart
+	assert.NoError(t, pmp.Shutdown())
+	pmp, err = NewDiskBufferedPump(backend, conf)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), pmp.BufferedBatches())
+
+	// the new batches are buffered after them, even once the backend is back up
+	backend.down = false
+	assert.NoError(t, pmp.WriteData(context.TODO(), batch("e")))
+	assert.Equal(t, []string{"a"}, backend.written)
+	assert.Equal(t, uint64(3), pmp.BufferedBatches())
+
+	// and drained in order
+	assert.Equal(t, 3, pmp.drain())
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, backend.written)
+	assert.Equal(t, uint64(0), pmp.BufferedBatches())
+	assert.Equal(t, int64(0), pmp.size)
+
+	assert.NoError(t, pmp.WriteData(context.TODO(), batch("f")))
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "f"}, backend.written)
+	assert.NoError(t, pmp.Shutdown())
+}
+
+func TestDiskBufferedPumpDrainLoop(t *testing.T) {
+	backend := &outagePump{down: true}
+	pmp, err := NewDiskBufferedPump(backend, DiskBufferConf{Path: t.TempDir(), DrainInterval: 1})
+	assert.NoError(t, err)
+	defer pmp.Shutdown()
+
+	assert.NoError(t, pmp.WriteData(context.TODO(), []interface{}{analytics.AnalyticsRecord{APIID: "a"}}))
+
+	// writeMu guards the backend from the forwarding
+	pmp.writeMu.Lock()
+	backend.down = false
+	pmp.writeMu.Unlock()
+
+	assert.Eventually(t, func() bool {
+		pmp.writeMu.Lock()
+		defer pmp.writeMu.Unlock()
+		return len(backend.written) == 1
+	}, 3*time.Second, 50*time.Millisecond)
+	assert.Equal(t, uint64(0), pmp.BufferedBatches())
+}
+
+func TestDiskBufferedPumpMaxSize(t *testing.T) {
+	backend := &outagePump{down: true}
+	record := []interface{}{analytics.AnalyticsRecord{APIID: "a", RawRequest: "GET / HTTP/1.1"}}
+	probe, err := NewDiskBufferedPump(backend, DiskBufferConf{Path: t.TempDir()})
+	assert.NoError(t, err)
+	assert.NoError(t, probe.WriteData(context.TODO(), record))
+	batchSize := probe.size
+	assert.NoError(t, probe.Shutdown())
+
+	pmp, err := NewDiskBufferedPump(backend, DiskBufferConf{Path: t.TempDir(), MaxSizeBytes: 2*batchSize + 1})
+	assert.NoError(t, err)
+	defer pmp.Shutdown()
+
+	// the batches beyond the size are dropped
+	assert.NoError(t, pmp.WriteData(context.TODO(), record))
+	assert.NoError(t, pmp.WriteData(context.TODO(), record))
+	assert.ErrorIs(t, pmp.WriteData(context.TODO(), record), errDiskBufferFull)
+	assert.Equal(t, uint64(2), pmp.BufferedBatches())
+
+	// and buffered again once drained
+	backend.down = false
+	assert.Equal(t, 2, pmp.drain())
+	backend.down = true
+	assert.NoError(t, pmp.WriteData(context.TODO(), record))
+	assert.Equal(t, uint64(1), pmp.BufferedBatches())
+}
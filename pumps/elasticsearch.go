@@ -68,6 +68,10 @@ type ElasticsearchConf struct {
 	AuthAPIKeyID string `json:"auth_api_key_id" mapstructure:"auth_api_key_id"`
 	// API Key used for APIKey auth in ES. It's send to ES in the Authorization header as ApiKey base64(auth_api_key_id:auth_api_key)
 	AuthAPIKey string `json:"auth_api_key" mapstructure:"auth_api_key"`
+	// Encoded API Key used for APIKey auth in ES, the base64 encoded `id:api_key` returned by ES
+	// when the key is created. It's send to ES in the Authorization header as ApiKey api_key. It
+	// can't be set along with the basic auth username and password.
+	APIKey string `json:"api_key" mapstructure:"api_key"`
 	// Basic auth username. It's send to ES in the Authorization header as username:password encoded in base64.
 	Username string `json:"auth_basic_username" mapstructure:"auth_basic_username"`
 	// Basic auth password. It's send to ES in the Authorization header as username:password encoded in base64.
@@ -80,6 +84,26 @@ type ElasticsearchConf struct {
 	SSLCertFile string `json:"ssl_cert_file" mapstructure:"ssl_cert_file"`
 	// Can be used to set custom key file for authentication with Elastic Search.
 	SSLKeyFile string `json:"ssl_key_file" mapstructure:"ssl_key_file"`
+	// If set to `true` will include a `location` field with the `lat` and `lon` of the record geo
+	// data, compatible with ES `geo_point` mappings. It's only added when the record has
+	// coordinates. Defaults to `false`.
+	GeoPoint bool `json:"geo_point" mapstructure:"geo_point"`
+	// The name of the ingest pipeline the documents will pass through before being indexed. It's
+	// set on every bulk item and index request. Not supported by ES 3.X.
+	Pipeline string `json:"pipeline" mapstructure:"pipeline"`
+	// If set to `true` the documents are indexed with external versioning, `version_type=external`,
+	// with the record timestamp in epoch milliseconds as the version. This way an out of order
+	// write never overwrites a newer document with the same _id: ES rejects it with a version
+	// conflict. It requires `generate_id`. Defaults to `false`.
+	ExternalVersion bool `json:"external_version" mapstructure:"external_version"`
+	// Set to `true` to add the network stats of the records to the documents, as the
+	// `network_open_connections`, `network_closed_connections`, `network_bytes_in` and
+	// `network_bytes_out` fields. Defaults to `false`.
+	NetworkStats bool `json:"network_stats" mapstructure:"network_stats"`
+	// Set to `true` to omit the empty fields of the documents: the empty strings, the zero
+	// numbers and the empty lists. This shrinks the documents of the records which don't have
+	// all of the fields. Defaults to `false`.
+	OmitEmptyFields bool `json:"omit_empty_fields" mapstructure:"omit_empty_fields"`
 }
 
 type ElasticsearchBulkConfig struct {
@@ -127,16 +151,40 @@ type Elasticsearch7Operator struct {
 type ApiKeyTransport struct {
 	APIKey   string
 	APIKeyID string
+	// EncodedAPIKey is the base64 encoded id:api_key, used instead of APIKeyID and APIKey.
+	EncodedAPIKey string
+	Transport     http.RoundTripper
 }
 
 // RoundTrip for ApiKeyTransport auth
 func (t *ApiKeyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
-	auth := t.APIKeyID + ":" + t.APIKey
-	key := base64.StdEncoding.EncodeToString([]byte(auth))
+	key := t.EncodedAPIKey
+	if key == "" {
+		auth := t.APIKeyID + ":" + t.APIKey
+		key = base64.StdEncoding.EncodeToString([]byte(auth))
+	}
 
+	r = r.Clone(r.Context())
 	r.Header.Set("Authorization", "ApiKey "+key)
 
-	return http.DefaultTransport.RoundTrip(r)
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return transport.RoundTrip(r)
+}
+
+// validateAPIKey checks that the encoded API key is the base64 encoding of id:api_key.
+func validateAPIKey(encoded string) error {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return errors.New("api_key must be base64 encoded")
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return errors.New("api_key must be the base64 encoding of id:api_key")
+	}
+	return nil
 }
 
 func (e *ElasticsearchPump) getOperator() (ElasticsearchOperator, error) {
@@ -146,12 +194,6 @@ func (e *ElasticsearchPump) getOperator() (ElasticsearchOperator, error) {
 	urls := strings.Split(conf.ElasticsearchURL, ",")
 
 	httpClient := http.DefaultClient
-	if conf.AuthAPIKey != "" && conf.AuthAPIKeyID != "" {
-		conf.Username = ""
-		conf.Password = ""
-		httpClient = &http.Client{Transport: &ApiKeyTransport{APIKey: conf.AuthAPIKey, APIKeyID: conf.AuthAPIKeyID}}
-	}
-
 	if conf.UseSSL {
 		tlsConf, err := e.GetTLSConfig()
 		if err != nil {
@@ -161,6 +203,15 @@ func (e *ElasticsearchPump) getOperator() (ElasticsearchOperator, error) {
 		httpClient = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConf}}
 	}
 
+	switch {
+	case conf.APIKey != "":
+		httpClient = &http.Client{Transport: &ApiKeyTransport{EncodedAPIKey: conf.APIKey, Transport: httpClient.Transport}}
+	case conf.AuthAPIKey != "" && conf.AuthAPIKeyID != "":
+		conf.Username = ""
+		conf.Password = ""
+		httpClient = &http.Client{Transport: &ApiKeyTransport{APIKey: conf.AuthAPIKey, APIKeyID: conf.AuthAPIKeyID, Transport: httpClient.Transport}}
+	}
+
 	switch conf.Version {
 	case "3":
 		op := new(Elasticsearch3Operator)
@@ -364,6 +415,29 @@ func (e *ElasticsearchPump) Init(config interface{}) error {
 		e.log.Fatal("Invalid version: ", err)
 	}
 
+	if e.esConf.Pipeline != "" {
+		if strings.TrimSpace(e.esConf.Pipeline) == "" {
+			return errors.New("pipeline can't be blank")
+		}
+		if e.esConf.Version == "3" {
+			return errors.New("pipeline isn't supported by Elasticsearch 3")
+		}
+		e.log.Info("Elasticsearch Pipeline: ", e.esConf.Pipeline)
+	}
+
+	if e.esConf.APIKey != "" {
+		if e.esConf.Username != "" || e.esConf.Password != "" {
+			return errors.New("api_key can't be set along with auth_basic_username and auth_basic_password")
+		}
+		if err := validateAPIKey(e.esConf.APIKey); err != nil {
+			return err
+		}
+	}
+
+	if e.esConf.ExternalVersion && !e.esConf.GenerateID {
+		return errors.New("external_version requires generate_id")
+	}
+
 	var re = regexp.MustCompile(`(.*)\/\/(.*):(.*)\@(.*)`)
 	printableURL := re.ReplaceAllString(e.esConf.ElasticsearchURL, `$1//***:***@$4`)
 
@@ -447,7 +521,7 @@ func getIndexName(esConf *ElasticsearchConf) string {
 	return indexName
 }
 
-func getMapping(datum analytics.AnalyticsRecord, extendedStatistics bool, generateID bool, decodeBase64 bool) (map[string]interface{}, string) {
+func getMapping(datum analytics.AnalyticsRecord, esConf *ElasticsearchConf) (map[string]interface{}, string) {
 	record := datum
 
 	mapping := map[string]interface{}{
@@ -468,9 +542,12 @@ func getMapping(datum analytics.AnalyticsRecord, extendedStatistics bool, genera
 		"content_length":   record.ContentLength,
 		"tags":             record.Tags,
 	}
+	if len(record.TagMap) > 0 {
+		mapping["tag_map"] = record.TagMap
+	}
 
-	if extendedStatistics {
-		if decodeBase64 {
+	if esConf.ExtendedStatistics {
+		if esConf.DecodeBase64 {
 			rawRequest, _ := base64.StdEncoding.DecodeString(record.RawRequest)
 			mapping["raw_request"] = string(rawRequest)
 			rawResponse, _ := base64.StdEncoding.DecodeString(record.RawResponse)
@@ -482,7 +559,30 @@ func getMapping(datum analytics.AnalyticsRecord, extendedStatistics bool, genera
 		mapping["user_agent"] = record.UserAgent
 	}
 
-	if generateID {
+	if esConf.NetworkStats {
+		for field, value := range networkStatsFields(record.Network) {
+			mapping[field] = value
+		}
+	}
+
+	if esConf.GeoPoint {
+		if location := record.Geo.Location; location.Latitude != 0 || location.Longitude != 0 {
+			mapping["location"] = map[string]float64{
+				"lat": location.Latitude,
+				"lon": location.Longitude,
+			}
+		}
+	}
+
+	if esConf.OmitEmptyFields {
+		for field, value := range mapping {
+			if analytics.IsEmptyValue(value) {
+				delete(mapping, field)
+			}
+		}
+	}
+
+	if esConf.GenerateID {
 		hasher := murmur3.New64()
 		hasher.Write([]byte(fmt.Sprintf("%d%s%s%s%s%s%d%s", record.TimeStamp.UnixNano(), record.Method, record.Path, record.IPAddress, record.APIID, record.OauthID, record.RequestTime, record.Alias)))
 
@@ -492,6 +592,15 @@ func getMapping(datum analytics.AnalyticsRecord, extendedStatistics bool, genera
 	return mapping, ""
 }
 
+// externalVersionType is the ES version type of the documents when external_version is enabled.
+const externalVersionType = "external"
+
+// documentVersion returns the external version of the document of record, its timestamp in epoch
+// milliseconds.
+func documentVersion(record analytics.AnalyticsRecord) int64 {
+	return record.TimeStamp.UnixNano() / int64(time.Millisecond)
+}
+
 func (e Elasticsearch3Operator) processData(ctx context.Context, data []interface{}, esConf *ElasticsearchConf) error {
 	index := e.esClient.Index().Index(getIndexName(esConf))
 
@@ -506,13 +615,20 @@ func (e Elasticsearch3Operator) processData(ctx context.Context, data []interfac
 			continue
 		}
 
-		mapping, id := getMapping(d, esConf.ExtendedStatistics, esConf.GenerateID, esConf.DecodeBase64)
+		mapping, id := getMapping(d, esConf)
 
 		if !esConf.DisableBulk {
 			r := elasticv3.NewBulkIndexRequest().Index(getIndexName(esConf)).Type(esConf.DocumentType).Id(id).Doc(mapping)
+			if esConf.ExternalVersion {
+				r = r.Version(documentVersion(d)).VersionType(externalVersionType)
+			}
 			e.bulkProcessor.Add(r)
 		} else {
-			_, err := index.BodyJson(mapping).Type(esConf.DocumentType).Id(id).DoC(ctx)
+			request := index.BodyJson(mapping).Type(esConf.DocumentType).Id(id)
+			if esConf.ExternalVersion {
+				request = request.Version(documentVersion(d)).VersionType(externalVersionType)
+			}
+			_, err := request.DoC(ctx)
 			if err != nil {
 				e.log.Error("Error while writing ", data[dataIndex], err)
 			}
@@ -542,13 +658,20 @@ func (e Elasticsearch5Operator) processData(ctx context.Context, data []interfac
 			continue
 		}
 
-		mapping, id := getMapping(d, esConf.ExtendedStatistics, esConf.GenerateID, esConf.DecodeBase64)
+		mapping, id := getMapping(d, esConf)
 
 		if !esConf.DisableBulk {
-			r := elasticv5.NewBulkIndexRequest().Index(getIndexName(esConf)).Type(esConf.DocumentType).Id(id).Doc(mapping)
+			r := elasticv5.NewBulkIndexRequest().Index(getIndexName(esConf)).Type(esConf.DocumentType).Id(id).Pipeline(esConf.Pipeline).Doc(mapping)
+			if esConf.ExternalVersion {
+				r = r.Version(documentVersion(d)).VersionType(externalVersionType)
+			}
 			e.bulkProcessor.Add(r)
 		} else {
-			_, err := index.BodyJson(mapping).Type(esConf.DocumentType).Id(id).Do(ctx)
+			request := index.BodyJson(mapping).Type(esConf.DocumentType).Id(id).Pipeline(esConf.Pipeline)
+			if esConf.ExternalVersion {
+				request = request.Version(documentVersion(d)).VersionType(externalVersionType)
+			}
+			_, err := request.Do(ctx)
 			if err != nil {
 				e.log.Error("Error while writing ", data[dataIndex], err)
 			}
@@ -578,13 +701,20 @@ func (e Elasticsearch6Operator) processData(ctx context.Context, data []interfac
 			continue
 		}
 
-		mapping, id := getMapping(d, esConf.ExtendedStatistics, esConf.GenerateID, esConf.DecodeBase64)
+		mapping, id := getMapping(d, esConf)
 
 		if !esConf.DisableBulk {
-			r := elasticv6.NewBulkIndexRequest().Index(getIndexName(esConf)).Type(esConf.DocumentType).Id(id).Doc(mapping)
+			r := elasticv6.NewBulkIndexRequest().Index(getIndexName(esConf)).Type(esConf.DocumentType).Id(id).Pipeline(esConf.Pipeline).Doc(mapping)
+			if esConf.ExternalVersion {
+				r = r.Version(documentVersion(d)).VersionType(externalVersionType)
+			}
 			e.bulkProcessor.Add(r)
 		} else {
-			_, err := index.BodyJson(mapping).Type(esConf.DocumentType).Id(id).Do(ctx)
+			request := index.BodyJson(mapping).Type(esConf.DocumentType).Id(id).Pipeline(esConf.Pipeline)
+			if esConf.ExternalVersion {
+				request = request.Version(documentVersion(d)).VersionType(externalVersionType)
+			}
+			_, err := request.Do(ctx)
 			if err != nil {
 				e.log.Error("Error while writing ", data[dataIndex], err)
 			}
@@ -618,13 +748,20 @@ func (e Elasticsearch7Operator) processData(ctx context.Context, data []interfac
 			continue
 		}
 
-		mapping, id := getMapping(d, esConf.ExtendedStatistics, esConf.GenerateID, esConf.DecodeBase64)
+		mapping, id := getMapping(d, esConf)
 
 		if !esConf.DisableBulk {
-			r := elasticv7.NewBulkIndexRequest().Index(getIndexName(esConf)).Id(id).Doc(mapping)
+			r := elasticv7.NewBulkIndexRequest().Index(getIndexName(esConf)).Id(id).Pipeline(esConf.Pipeline).Doc(mapping)
+			if esConf.ExternalVersion {
+				r = r.Version(documentVersion(d)).VersionType(externalVersionType)
+			}
 			e.bulkProcessor.Add(r)
 		} else {
-			_, err := index.BodyJson(mapping).Id(id).Do(ctx)
+			request := index.BodyJson(mapping).Id(id).Pipeline(esConf.Pipeline)
+			if esConf.ExternalVersion {
+				request = request.Version(documentVersion(d)).VersionType(externalVersionType)
+			}
+			_, err := request.Do(ctx)
 			if err != nil {
 				e.log.Error("Error while writing ", data[dataIndex], err)
 			}
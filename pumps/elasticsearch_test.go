@@ -2,6 +2,7 @@ package pumps
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -9,13 +10,24 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_getTLSConfig(t *testing.T) {
@@ -214,3 +226,320 @@ func getCertificate(certFile, keyFile string) []tls.Certificate {
 
 	return []tls.Certificate{cert}
 }
+
+func TestGetMapping_NetworkStats(t *testing.T) {
+	record := analytics.AnalyticsRecord{
+		APIID:   "api1",
+		Network: analytics.NetworkStats{OpenConnections: 1, ClosedConnection: 2, BytesIn: 300, BytesOut: 4000},
+	}
+
+	mapping, _ := getMapping(record, &ElasticsearchConf{NetworkStats: true})
+	assert.Equal(t, int64(1), mapping["network_open_connections"])
+	assert.Equal(t, int64(2), mapping["network_closed_connections"])
+	assert.Equal(t, int64(300), mapping["network_bytes_in"])
+	assert.Equal(t, int64(4000), mapping["network_bytes_out"])
+
+	mapping, _ = getMapping(record, &ElasticsearchConf{})
+	assert.NotContains(t, mapping, "network_bytes_in")
+}
+
+func TestGetMapping_OmitEmptyFields(t *testing.T) {
+	record := analytics.AnalyticsRecord{
+		Method:       "GET",
+		Path:         "/get",
+		ResponseCode: 200,
+		APIID:        "api1",
+		TimeStamp:    time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		Tags:         []string{},
+	}
+
+	mapping, _ := getMapping(record, &ElasticsearchConf{OmitEmptyFields: true, ExtendedStatistics: true})
+	assert.Equal(t, map[string]interface{}{
+		"@timestamp":    record.TimeStamp,
+		"http_method":   "GET",
+		"request_uri":   "/get",
+		"response_code": 200,
+		"api_id":        "api1",
+	}, mapping)
+
+	mapping, _ = getMapping(record, &ElasticsearchConf{})
+	assert.Contains(t, mapping, "api_key")
+	assert.Contains(t, mapping, "tags")
+}
+
+func TestGetMapping_TagMap(t *testing.T) {
+	record := analytics.AnalyticsRecord{APIID: "api1", Tags: []string{"key-abc"}, Enrichment: analytics.Enrichment{TagMap: map[string]string{"team": "payments"}}}
+	mapping, _ := getMapping(record, &ElasticsearchConf{})
+	assert.Equal(t, map[string]string{"team": "payments"}, mapping["tag_map"])
+	assert.Equal(t, []string{"key-abc"}, mapping["tags"])
+
+	mapping, _ = getMapping(analytics.AnalyticsRecord{APIID: "api1"}, &ElasticsearchConf{})
+	assert.NotContains(t, mapping, "tag_map")
+}
+
+func TestGetMapping_GeoPoint(t *testing.T) {
+	record := analytics.AnalyticsRecord{
+		APIID: "api1",
+		Geo: analytics.GeoData{
+			Location: analytics.Location{
+				Latitude:  51.5074,
+				Longitude: -0.1278,
+			},
+		},
+	}
+
+	t.Run("enabled with coordinates", func(t *testing.T) {
+		mapping, _ := getMapping(record, &ElasticsearchConf{GeoPoint: true})
+
+		location, ok := mapping["location"].(map[string]float64)
+		assert.True(t, ok)
+		assert.Equal(t, map[string]float64{"lat": 51.5074, "lon": -0.1278}, location)
+
+		// geo_point accepts objects with lat and lon
+		encoded, err := json.Marshal(mapping["location"])
+		assert.Nil(t, err)
+		assert.JSONEq(t, `{"lat":51.5074,"lon":-0.1278}`, string(encoded))
+	})
+
+	t.Run("enabled without coordinates", func(t *testing.T) {
+		mapping, _ := getMapping(analytics.AnalyticsRecord{APIID: "api1"}, &ElasticsearchConf{GeoPoint: true})
+		assert.NotContains(t, mapping, "location")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		mapping, _ := getMapping(record, &ElasticsearchConf{})
+		assert.NotContains(t, mapping, "location")
+	})
+}
+
+func TestElasticsearchPipeline(t *testing.T) {
+	var mu sync.Mutex
+	var bulkBodies []string
+	var indexURLs []*url.URL
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_bulk"):
+			body, _ := io.ReadAll(r.Body)
+			bulkBodies = append(bulkBodies, string(body))
+			fmt.Fprint(w, `{"took":1,"errors":false,"items":[]}`)
+		case r.Method == http.MethodPut || r.Method == http.MethodPost:
+			indexURLs = append(indexURLs, r.URL)
+			fmt.Fprint(w, `{"_index":"tyk_analytics","_id":"1","result":"created"}`)
+		default:
+			fmt.Fprint(w, `{"version":{"number":"7.10.0"}}`)
+		}
+	}))
+	defer server.Close()
+
+	records := []interface{}{analytics.AnalyticsRecord{APIID: "api1"}, analytics.AnalyticsRecord{APIID: "api2"}}
+
+	t.Run("bulk", func(t *testing.T) {
+		pmp := &ElasticsearchPump{}
+		err := pmp.Init(map[string]interface{}{
+			"elasticsearch_url": server.URL,
+			"version":           "7",
+			"pipeline":          "tyk-enrich",
+		})
+		assert.Nil(t, err)
+
+		assert.Nil(t, pmp.WriteData(context.Background(), records))
+		assert.Nil(t, pmp.Shutdown())
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Len(t, bulkBodies, 1)
+		// every index action of the bulk request names the pipeline
+		lines := strings.Split(strings.TrimSpace(bulkBodies[0]), "\n")
+		assert.Len(t, lines, 2*len(records))
+		for i := 0; i < len(lines); i += 2 {
+			var action map[string]map[string]interface{}
+			assert.Nil(t, json.Unmarshal([]byte(lines[i]), &action))
+			assert.Equal(t, "tyk-enrich", action["index"]["pipeline"])
+		}
+	})
+
+	t.Run("bulk disabled", func(t *testing.T) {
+		pmp := &ElasticsearchPump{}
+		err := pmp.Init(map[string]interface{}{
+			"elasticsearch_url": server.URL,
+			"version":           "7",
+			"pipeline":          "tyk-enrich",
+			"disable_bulk":      true,
+		})
+		assert.Nil(t, err)
+
+		assert.Nil(t, pmp.WriteData(context.Background(), records))
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Len(t, indexURLs, 2)
+		for _, u := range indexURLs {
+			assert.Equal(t, "tyk-enrich", u.Query().Get("pipeline"))
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		pmp := &ElasticsearchPump{}
+		err := pmp.Init(map[string]interface{}{"elasticsearch_url": server.URL, "version": "7", "pipeline": "  "})
+		assert.EqualError(t, err, "pipeline can't be blank")
+
+		err = pmp.Init(map[string]interface{}{"elasticsearch_url": server.URL, "version": "3", "pipeline": "tyk-enrich"})
+		assert.EqualError(t, err, "pipeline isn't supported by Elasticsearch 3")
+	})
+}
+
+func TestElasticsearchExternalVersion(t *testing.T) {
+	var mu sync.Mutex
+	var bulkBodies []string
+	var indexURLs []*url.URL
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_bulk"):
+			body := new(bytes.Buffer)
+			_, err := body.ReadFrom(r.Body)
+			assert.Nil(t, err)
+			bulkBodies = append(bulkBodies, body.String())
+			fmt.Fprint(w, `{"took":1,"errors":false,"items":[]}`)
+		case r.Method == http.MethodPut || r.Method == http.MethodPost:
+			indexURLs = append(indexURLs, r.URL)
+			fmt.Fprint(w, `{"_index":"tyk_analytics","_id":"1","result":"created"}`)
+		default:
+			fmt.Fprint(w, `{"version":{"number":"7.10.0"}}`)
+		}
+	}))
+	defer server.Close()
+
+	timeStamp := time.Date(2023, 5, 1, 10, 30, 0, 0, time.UTC)
+	records := []interface{}{analytics.AnalyticsRecord{APIID: "api1", TimeStamp: timeStamp}}
+	version := timeStamp.UnixNano() / int64(time.Millisecond)
+
+	t.Run("bulk", func(t *testing.T) {
+		pmp := &ElasticsearchPump{}
+		err := pmp.Init(map[string]interface{}{
+			"elasticsearch_url": server.URL,
+			"version":           "7",
+			"generate_id":       true,
+			"external_version":  true,
+		})
+		assert.Nil(t, err)
+
+		assert.Nil(t, pmp.WriteData(context.Background(), records))
+		assert.Nil(t, pmp.Shutdown())
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Len(t, bulkBodies, 1)
+		action := map[string]map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal([]byte(strings.SplitN(bulkBodies[0], "\n", 2)[0]), &action))
+		assert.Equal(t, float64(version), action["index"]["version"])
+		assert.Equal(t, "external", action["index"]["version_type"])
+		assert.NotEmpty(t, action["index"]["_id"])
+	})
+
+	t.Run("bulk disabled", func(t *testing.T) {
+		pmp := &ElasticsearchPump{}
+		err := pmp.Init(map[string]interface{}{
+			"elasticsearch_url": server.URL,
+			"version":           "7",
+			"generate_id":       true,
+			"external_version":  true,
+			"disable_bulk":      true,
+		})
+		assert.Nil(t, err)
+
+		assert.Nil(t, pmp.WriteData(context.Background(), records))
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Len(t, indexURLs, 1)
+		assert.Equal(t, fmt.Sprint(version), indexURLs[0].Query().Get("version"))
+		assert.Equal(t, "external", indexURLs[0].Query().Get("version_type"))
+	})
+
+	t.Run("without generate_id", func(t *testing.T) {
+		pmp := &ElasticsearchPump{}
+		err := pmp.Init(map[string]interface{}{"elasticsearch_url": server.URL, "version": "7", "external_version": true})
+		assert.EqualError(t, err, "external_version requires generate_id")
+	})
+}
+
+func TestElasticsearchAPIKey(t *testing.T) {
+	var mu sync.Mutex
+	var authHeaders []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		mu.Lock()
+		defer mu.Unlock()
+		authHeaders = append(authHeaders, r.Header.Get("Authorization"))
+		switch {
+		case r.Method == http.MethodPut || r.Method == http.MethodPost:
+			fmt.Fprint(w, `{"_index":"tyk_analytics","_id":"1","result":"created"}`)
+		default:
+			fmt.Fprint(w, `{"version":{"number":"7.10.0"}}`)
+		}
+	}))
+	defer server.Close()
+
+	apiKey := base64.StdEncoding.EncodeToString([]byte("key-id:key-secret"))
+
+	t.Run("api_key", func(t *testing.T) {
+		pmp := &ElasticsearchPump{}
+		err := pmp.Init(map[string]interface{}{
+			"elasticsearch_url": server.URL,
+			"version":           "7",
+			"api_key":           apiKey,
+			"disable_bulk":      true,
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, pmp.WriteData(context.Background(), []interface{}{analytics.AnalyticsRecord{APIID: "api1"}}))
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.NotEmpty(t, authHeaders)
+		for _, header := range authHeaders {
+			assert.Equal(t, "ApiKey "+apiKey, header)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		pmp := &ElasticsearchPump{}
+		err := pmp.Init(map[string]interface{}{"elasticsearch_url": server.URL, "version": "7", "api_key": "not base64!"})
+		assert.EqualError(t, err, "api_key must be base64 encoded")
+
+		err = pmp.Init(map[string]interface{}{
+			"elasticsearch_url": server.URL,
+			"version":           "7",
+			"api_key":           base64.StdEncoding.EncodeToString([]byte("key-secret")),
+		})
+		assert.EqualError(t, err, "api_key must be the base64 encoding of id:api_key")
+
+		err = pmp.Init(map[string]interface{}{
+			"elasticsearch_url":   server.URL,
+			"version":             "7",
+			"api_key":             apiKey,
+			"auth_basic_username": "elastic",
+			"auth_basic_password": "changeme",
+		})
+		assert.EqualError(t, err, "api_key can't be set along with auth_basic_username and auth_basic_password")
+	})
+}
+
+func TestApiKeyTransport(t *testing.T) {
+	var authHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &ApiKeyTransport{APIKeyID: "key-id", APIKey: "key-secret"}}
+	resp, err := client.Get(server.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "ApiKey "+base64.StdEncoding.EncodeToString([]byte("key-id:key-secret")), authHeader)
+}
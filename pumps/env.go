@@ -0,0 +1,198 @@
+package pumps
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// ProcessTypedEnvVars overrides the list and map fields of cfg, a pointer to a struct, from the env
+// vars with the given prefix. It complements envconfig, which is processed first:
+//   - Each field is looked up by its json name as well as by its envconfig name, so
+//     `TYK_PMP_PUMPS_CSV_FILTERS_ORG_IDS` sets the same field as `TYK_PMP_PUMPS_CSV_FILTERS_ORGSIDS`.
+//     The json name takes precedence.
+//   - A value starting with `[` or `{` is decoded as JSON, so the items can hold commas.
+//   - Otherwise lists are comma separated (`a,b,c`) and maps are comma separated `key:value` pairs
+//     (`a:1,b:2`), with the surrounding spaces trimmed.
+func ProcessTypedEnvVars(prefix string, cfg interface{}) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected a pointer to a struct, got %T", cfg)
+	}
+	return processTypedEnvStruct([]string{strings.ToUpper(prefix)}, v.Elem())
+}
+
+func processTypedEnvStruct(prefixes []string, s reflect.Value) error {
+	t := s.Type()
+	for i := 0; i < s.NumField(); i++ {
+		field, structField := s.Field(i), t.Field(i)
+		if !structField.IsExported() || structField.Tag.Get("ignored") == "true" {
+			continue
+		}
+
+		if structField.Anonymous {
+			if field.Kind() == reflect.Struct {
+				if err := processTypedEnvStruct(prefixes, field); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		// the fields with their own decoding are left to envconfig
+		if hasEnvDecoder(field) {
+			continue
+		}
+
+		keys := typedEnvKeys(prefixes, structField)
+		switch field.Kind() {
+		case reflect.Struct:
+			if err := processTypedEnvStruct(keys, field); err != nil {
+				return err
+			}
+		case reflect.Slice, reflect.Map:
+			for _, key := range keys {
+				value, found := os.LookupEnv(key)
+				if !found || strings.TrimSpace(value) == "" {
+					continue
+				}
+				if err := decodeTypedEnvValue(field, value); err != nil {
+					return fmt.Errorf("decoding %s: %w", key, err)
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func hasEnvDecoder(field reflect.Value) bool {
+	if !field.CanAddr() {
+		return false
+	}
+	switch field.Addr().Interface().(type) {
+	case envconfig.Decoder, envconfig.Setter, encoding.TextUnmarshaler, encoding.BinaryUnmarshaler:
+		return true
+	}
+	return false
+}
+
+// typedEnvKeys returns the env var names of the field under each of the prefixes, by json name first.
+func typedEnvKeys(prefixes []string, structField reflect.StructField) []string {
+	names := []string{}
+	if jsonName := strings.Split(structField.Tag.Get("json"), ",")[0]; jsonName != "" && jsonName != "-" {
+		names = append(names, strings.ToUpper(jsonName))
+	}
+	if envName := structField.Tag.Get("envconfig"); envName != "" {
+		names = append(names, strings.ToUpper(envName))
+	} else {
+		names = append(names, strings.ToUpper(structField.Name))
+	}
+
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		for _, prefix := range prefixes {
+			key := prefix + "_" + name
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+func decodeTypedEnvValue(field reflect.Value, value string) error {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{") {
+		decoded := reflect.New(field.Type())
+		if err := json.Unmarshal([]byte(value), decoded.Interface()); err != nil {
+			return err
+		}
+		field.Set(decoded.Elem())
+		return nil
+	}
+
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	if field.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setTypedEnvValue(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+
+	m := reflect.MakeMapWithSize(field.Type(), len(items))
+	for _, item := range items {
+		pair := strings.SplitN(item, ":", 2)
+		if len(pair) != 2 {
+			return fmt.Errorf("invalid map item %q, expected key:value", item)
+		}
+		key := reflect.New(field.Type().Key()).Elem()
+		if err := setTypedEnvValue(key, strings.TrimSpace(pair[0])); err != nil {
+			return err
+		}
+		elem := reflect.New(field.Type().Elem()).Elem()
+		if err := setTypedEnvValue(elem, strings.TrimSpace(pair[1])); err != nil {
+			return err
+		}
+		m.SetMapIndex(key, elem)
+	}
+	field.Set(m)
+	return nil
+}
+
+func setTypedEnvValue(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		v.Set(reflect.ValueOf(value))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package pumps
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type typedEnvTestConf struct {
+	EnvPrefix  string                 `json:"meta_env_prefix"`
+	Names      []string               `json:"names"`
+	Codes      []int                  `json:"response_codes"`
+	Headers    map[string]string      `json:"headers"`
+	Weights    map[string]float64     `json:"weights"`
+	BulkConfig map[string]interface{} `json:"bulk_config"`
+	Nested     struct {
+		APIIDs []string `json:"api_ids"`
+	} `json:"nested"`
+	Untouched []string `json:"untouched"`
+}
+
+func TestProcessTypedEnvVars(t *testing.T) {
+	testEnvVars := map[string]string{
+		"TEST_NAMES":          " a, b ,c ",
+		"TEST_RESPONSE_CODES": "[200, 404]",
+		"TEST_HEADERS":        `{"Authorization":"Bearer a,b:c","X-Tenant":"t1"}`,
+		"TEST_WEIGHTS":        "a:1.5,b:2",
+		"TEST_BULK_CONFIG":    `{"event_queue_size":100,"enabled":true}`,
+		"TEST_NESTED_APIIDS":  "api1,api2",
+	}
+	for env, val := range testEnvVars {
+		os.Setenv(env, val)
+	}
+	defer func() {
+		for env := range testEnvVars {
+			os.Unsetenv(env)
+		}
+	}()
+
+	conf := &typedEnvTestConf{Untouched: []string{"x"}}
+	err := ProcessTypedEnvVars("test", conf)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"a", "b", "c"}, conf.Names)
+	assert.Equal(t, []int{200, 404}, conf.Codes)
+	assert.Equal(t, map[string]string{"Authorization": "Bearer a,b:c", "X-Tenant": "t1"}, conf.Headers)
+	assert.Equal(t, map[string]float64{"a": 1.5, "b": 2}, conf.Weights)
+	assert.Equal(t, map[string]interface{}{"event_queue_size": float64(100), "enabled": true}, conf.BulkConfig)
+	assert.Equal(t, []string{"api1", "api2"}, conf.Nested.APIIDs)
+	assert.Equal(t, []string{"x"}, conf.Untouched)
+}
+
+func TestProcessTypedEnvVarsPrecedence(t *testing.T) {
+	os.Setenv("TEST_CODES", "500")
+	defer os.Unsetenv("TEST_CODES")
+
+	// the envconfig name is used without the json one
+	conf := &typedEnvTestConf{}
+	assert.Nil(t, ProcessTypedEnvVars("TEST", conf))
+	assert.Equal(t, []int{500}, conf.Codes)
+
+	// the json name takes precedence
+	os.Setenv("TEST_RESPONSE_CODES", "200")
+	defer os.Unsetenv("TEST_RESPONSE_CODES")
+	assert.Nil(t, ProcessTypedEnvVars("TEST", conf))
+	assert.Equal(t, []int{200}, conf.Codes)
+}
+
+func TestProcessTypedEnvVarsErrors(t *testing.T) {
+	tcs := []struct {
+		testName string
+		env      string
+		value    string
+		err      string
+	}{
+		{testName: "invalid int", env: "TEST_RESPONSE_CODES", value: "200,abc", err: "decoding TEST_RESPONSE_CODES"},
+		{testName: "invalid JSON", env: "TEST_NAMES", value: "[a", err: "decoding TEST_NAMES"},
+		{testName: "invalid map item", env: "TEST_HEADERS", value: "a", err: "expected key:value"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			os.Setenv(tc.env, tc.value)
+			defer os.Unsetenv(tc.env)
+
+			err := ProcessTypedEnvVars("TEST", &typedEnvTestConf{})
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+
+	assert.Error(t, ProcessTypedEnvVars("TEST", typedEnvTestConf{}))
+}
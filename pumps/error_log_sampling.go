@@ -0,0 +1,106 @@
+package pumps
+
+import "sync"
+
+const (
+	// errorLogSamplerMaxMessages bounds the error messages sampled on their own, so the errors
+	// with a varying message, e.g. holding a record ID, don't grow the counts without bound.
+	errorLogSamplerMaxMessages = 100
+	// errorLogSamplerOtherMessages is the message the errors beyond errorLogSamplerMaxMessages are
+	// sampled together as.
+	errorLogSamplerOtherMessages = "other errors"
+)
+
+// ErrorLogSamplingConf samples the logs of the failed writes of a pump, to keep a backend
+// rejecting every write from flooding the logs with identical errors.
+type ErrorLogSamplingConf struct {
+	// The first First occurrences of each error are logged. The first occurrence is always logged.
+	// Defaults to 0.
+	First int `json:"first" mapstructure:"first"`
+	// After the first ones, one of every Every occurrences of each error is logged. Defaults to 0,
+	// none of them until the pump writes successfully again.
+	Every int `json:"every" mapstructure:"every"`
+}
+
+// errorLogSampler counts the occurrences of each error of a pump, by message, since its last
+// successful write. Past errorLogSamplerMaxMessages messages, the new ones are counted together.
+type errorLogSampler struct {
+	conf ErrorLogSamplingConf
+
+	mu     sync.Mutex
+	counts map[string]*errorLogCount
+}
+
+type errorLogCount struct {
+	seen       int
+	suppressed int
+}
+
+func (p *CommonPumpConfig) SetErrorLogSampling(sampling ErrorLogSamplingConf) {
+	p.errorLogSampling = sampling
+	p.errorLogSampler = nil
+	if sampling.First > 0 || sampling.Every > 0 {
+		p.errorLogSampler = &errorLogSampler{conf: sampling, counts: map[string]*errorLogCount{}}
+	}
+}
+
+func (p *CommonPumpConfig) GetErrorLogSampling() ErrorLogSamplingConf {
+	return p.errorLogSampling
+}
+
+// SampleErrorLog returns whether the failed write with the error message msg is logged, and the
+// number of identical errors suppressed since the last one logged. Every error is logged when the
+// error logs aren't sampled, and the first occurrence of each error otherwise.
+func (p *CommonPumpConfig) SampleErrorLog(msg string) (bool, int) {
+	s := p.errorLogSampler
+	if s == nil {
+		return true, 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count, ok := s.counts[msg]
+	if !ok && len(s.counts) >= errorLogSamplerMaxMessages {
+		count, ok = s.counts[errorLogSamplerOtherMessages]
+		msg = errorLogSamplerOtherMessages
+	}
+	if !ok {
+		count = &errorLogCount{}
+		s.counts[msg] = count
+	}
+	count.seen++
+	first := s.conf.First
+	if first < 1 {
+		first = 1
+	}
+	if count.seen <= first || (s.conf.Every > 0 && (count.seen-first)%s.conf.Every == 0) {
+		suppressed := count.suppressed
+		count.suppressed = 0
+		return true, suppressed
+	}
+	count.suppressed++
+	return false, 0
+}
+
+// ResetErrorLogSampling restarts the sampling of the error logs, after a successful write, and
+// returns the number of errors suppressed since the last one logged, by message.
+func (p *CommonPumpConfig) ResetErrorLogSampling() map[string]int {
+	s := p.errorLogSampler
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var suppressed map[string]int
+	for msg, count := range s.counts {
+		if count.suppressed > 0 {
+			if suppressed == nil {
+				suppressed = map[string]int{}
+			}
+			suppressed[msg] = count.suppressed
+		}
+	}
+	s.counts = map[string]*errorLogCount{}
+	return suppressed
+}
@@ -0,0 +1,105 @@
+package pumps
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleErrorLog(t *testing.T) {
+	tcs := []struct {
+		testName           string
+		sampling           ErrorLogSamplingConf
+		expectedLogged     []int
+		expectedSuppressed []int
+	}{
+		{
+			testName:           "no sampling",
+			expectedLogged:     []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+			expectedSuppressed: []int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			testName:           "first and every",
+			sampling:           ErrorLogSamplingConf{First: 2, Every: 3},
+			expectedLogged:     []int{1, 2, 5, 8},
+			expectedSuppressed: []int{0, 0, 2, 2},
+		},
+		{
+			testName:           "first only",
+			sampling:           ErrorLogSamplingConf{First: 3},
+			expectedLogged:     []int{1, 2, 3},
+			expectedSuppressed: []int{0, 0, 0},
+		},
+		{
+			testName:           "every only",
+			sampling:           ErrorLogSamplingConf{Every: 4},
+			expectedLogged:     []int{1, 5, 9},
+			expectedSuppressed: []int{0, 3, 3},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.testName, func(t *testing.T) {
+			p := &CommonPumpConfig{}
+			p.SetErrorLogSampling(tc.sampling)
+
+			var logged, suppressed []int
+			for i := 1; i <= 10; i++ {
+				if ok, n := p.SampleErrorLog("backend unavailable"); ok {
+					logged = append(logged, i)
+					suppressed = append(suppressed, n)
+				}
+			}
+			assert.Equal(t, tc.expectedLogged, logged)
+			assert.Equal(t, tc.expectedSuppressed, suppressed)
+		})
+	}
+}
+
+func TestSampleErrorLog_Messages(t *testing.T) {
+	p := &CommonPumpConfig{}
+	p.SetErrorLogSampling(ErrorLogSamplingConf{First: 1})
+
+	// each error is sampled on its own
+	for i := 0; i < 3; i++ {
+		ok, _ := p.SampleErrorLog("backend unavailable")
+		assert.Equal(t, i == 0, ok)
+		ok, _ = p.SampleErrorLog("invalid record")
+		assert.Equal(t, i == 0, ok)
+	}
+
+	assert.Equal(t, map[string]int{"backend unavailable": 2, "invalid record": 2}, p.ResetErrorLogSampling())
+
+	// the sampling restarts after the reset
+	ok, suppressed := p.SampleErrorLog("backend unavailable")
+	assert.True(t, ok)
+	assert.Equal(t, 0, suppressed)
+	assert.Nil(t, p.ResetErrorLogSampling())
+}
+
+func TestSampleErrorLog_MaxMessages(t *testing.T) {
+	p := &CommonPumpConfig{}
+	p.SetErrorLogSampling(ErrorLogSamplingConf{First: 1})
+
+	for i := 0; i < errorLogSamplerMaxMessages; i++ {
+		ok, _ := p.SampleErrorLog("invalid record " + strconv.Itoa(i))
+		assert.True(t, ok)
+	}
+	assert.Len(t, p.errorLogSampler.counts, errorLogSamplerMaxMessages)
+
+	// the new messages beyond the bound are sampled together
+	for i := 0; i < 3; i++ {
+		ok, _ := p.SampleErrorLog("invalid record " + strconv.Itoa(errorLogSamplerMaxMessages+i))
+		assert.Equal(t, i == 0, ok)
+	}
+	assert.Len(t, p.errorLogSampler.counts, errorLogSamplerMaxMessages+1)
+	// the messages already counted are still sampled on their own
+	ok, _ := p.SampleErrorLog("invalid record 0")
+	assert.False(t, ok)
+
+	suppressed := p.ResetErrorLogSampling()
+	assert.Equal(t, 2, suppressed[errorLogSamplerOtherMessages])
+	assert.Equal(t, 1, suppressed["invalid record 0"])
+}
@@ -0,0 +1,213 @@
+package pumps
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+const (
+	fileManifestFormatJSON = "json"
+	fileManifestFormatCSV  = "csv"
+)
+
+var fileManifestCSVHeaders = []string{"path", "records", "first_timestamp", "last_timestamp", "size_bytes"}
+
+// FileManifestEntry describes a file written by a file based pump: its path, its number of
+// records, the time range of their timestamps and its size.
+type FileManifestEntry struct {
+	Path           string    `json:"path"`
+	Records        int64     `json:"records"`
+	FirstTimestamp time.Time `json:"first_timestamp"`
+	LastTimestamp  time.Time `json:"last_timestamp"`
+	SizeBytes      int64     `json:"size_bytes"`
+}
+
+// fileManifest is the manifest of the files written by a pump, for the downstream ETL to know
+// which files to process. It's rewritten after each write, atomically, as a JSON array or a CSV
+// file of the entries, in the order the files were created.
+type fileManifest struct {
+	path   string
+	format string
+
+	mu      sync.Mutex
+	entries []FileManifestEntry
+	index   map[string]int
+}
+
+// openFileManifest opens the manifest at path, in format, loading its entries if it exists.
+func openFileManifest(path, format string) (*fileManifest, error) {
+	if format == "" {
+		format = fileManifestFormatJSON
+	}
+	if format != fileManifestFormatJSON && format != fileManifestFormatCSV {
+		return nil, fmt.Errorf("unsupported manifest format %q, it must be json or csv", format)
+	}
+
+	m := &fileManifest{path: path, format: format, index: map[string]int{}}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []FileManifestEntry
+	if format == fileManifestFormatJSON {
+		err = json.Unmarshal(content, &entries)
+	} else {
+		entries, err = decodeCSVFileManifest(content)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading the manifest %s: %w", path, err)
+	}
+	for _, entry := range entries {
+		m.index[entry.Path] = len(m.entries)
+		m.entries = append(m.entries, entry)
+	}
+	return m, nil
+}
+
+// add records the records written to the file at path, from first to last, and its size once
+// written, then rewrites the manifest. The records written to an existing file, e.g. appended to
+// an hourly file, are added to its entry.
+func (m *fileManifest) add(path string, records int64, first, last time.Time, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, ok := m.index[path]
+	if !ok {
+		i = len(m.entries)
+		m.index[path] = i
+		m.entries = append(m.entries, FileManifestEntry{Path: path, FirstTimestamp: first, LastTimestamp: last})
+	}
+	entry := &m.entries[i]
+	entry.Records += records
+	// the zero timestamps, of the records without a timestamp, don't widen the range
+	if !first.IsZero() && (entry.FirstTimestamp.IsZero() || first.Before(entry.FirstTimestamp)) {
+		entry.FirstTimestamp = first
+	}
+	if last.After(entry.LastTimestamp) {
+		entry.LastTimestamp = last
+	}
+	entry.SizeBytes = size
+
+	return m.writeLocked()
+}
+
+// Entries returns a copy of the entries of the manifest.
+func (m *fileManifest) Entries() []FileManifestEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]FileManifestEntry{}, m.entries...)
+}
+
+// writeLocked rewrites the manifest through a temporary file, so the readers never see a partial
+// manifest. It must be called with mu held.
+func (m *fileManifest) writeLocked() error {
+	var content []byte
+	var err error
+	if m.format == fileManifestFormatJSON {
+		content, err = json.MarshalIndent(m.entries, "", "  ")
+	} else {
+		content, err = encodeCSVFileManifest(m.entries)
+	}
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(m.path), filepath.Base(m.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), m.path)
+}
+
+func encodeCSVFileManifest(entries []FileManifestEntry) ([]byte, error) {
+	rows := [][]string{fileManifestCSVHeaders}
+	for _, entry := range entries {
+		rows = append(rows, []string{
+			entry.Path,
+			strconv.FormatInt(entry.Records, 10),
+			entry.FirstTimestamp.Format(time.RFC3339Nano),
+			entry.LastTimestamp.Format(time.RFC3339Nano),
+			strconv.FormatInt(entry.SizeBytes, 10),
+		})
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeCSVFileManifest(content []byte) ([]FileManifestEntry, error) {
+	rows, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []FileManifestEntry{}
+	for i, row := range rows {
+		if i == 0 {
+			continue
+		}
+		if len(row) != len(fileManifestCSVHeaders) {
+			return nil, fmt.Errorf("line %d has %d columns instead of %d", i+1, len(row), len(fileManifestCSVHeaders))
+		}
+		entry := FileManifestEntry{Path: row[0]}
+		if entry.Records, err = strconv.ParseInt(row[1], 10, 64); err != nil {
+			return nil, err
+		}
+		if entry.FirstTimestamp, err = time.Parse(time.RFC3339Nano, row[2]); err != nil {
+			return nil, err
+		}
+		if entry.LastTimestamp, err = time.Parse(time.RFC3339Nano, row[3]); err != nil {
+			return nil, err
+		}
+		if entry.SizeBytes, err = strconv.ParseInt(row[4], 10, 64); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// recordsTimeRange returns the earliest and the latest timestamps of the records of data, leaving
+// out the zero ones.
+func recordsTimeRange(data []interface{}) (first, last time.Time) {
+	for _, v := range data {
+		record, ok := v.(analytics.AnalyticsRecord)
+		if !ok || record.TimeStamp.IsZero() {
+			continue
+		}
+		if first.IsZero() || record.TimeStamp.Before(first) {
+			first = record.TimeStamp
+		}
+		if record.TimeStamp.After(last) {
+			last = record.TimeStamp
+		}
+	}
+	return first, last
+}
@@ -0,0 +1,90 @@
+package pumps
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+func TestFileManifest(t *testing.T) {
+	ts := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, format := range []string{fileManifestFormatJSON, fileManifestFormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "manifest."+format)
+			manifest, err := openFileManifest(path, format)
+			assert.Nil(t, err)
+			assert.Empty(t, manifest.Entries())
+
+			assert.Nil(t, manifest.add("a.csv", 2, ts, ts.Add(time.Minute), 100))
+			assert.Nil(t, manifest.add("b.csv", 1, ts.Add(time.Hour), ts.Add(time.Hour), 50))
+			// the records appended to a file are added to its entry
+			assert.Nil(t, manifest.add("a.csv", 3, ts.Add(-time.Minute), ts.Add(2*time.Minute), 250))
+
+			expected := []FileManifestEntry{
+				{Path: "a.csv", Records: 5, FirstTimestamp: ts.Add(-time.Minute), LastTimestamp: ts.Add(2 * time.Minute), SizeBytes: 250},
+				{Path: "b.csv", Records: 1, FirstTimestamp: ts.Add(time.Hour), LastTimestamp: ts.Add(time.Hour), SizeBytes: 50},
+			}
+			assert.Equal(t, expected, manifest.Entries())
+
+			// the manifest is loaded back on restart
+			manifest, err = openFileManifest(path, format)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, manifest.Entries())
+
+			// and no temporary file is left behind
+			files, err := os.ReadDir(filepath.Dir(path))
+			assert.Nil(t, err)
+			assert.Len(t, files, 1)
+		})
+	}
+}
+
+func TestFileManifest_InvalidFormat(t *testing.T) {
+	_, err := openFileManifest(filepath.Join(t.TempDir(), "manifest.xml"), "xml")
+	assert.EqualError(t, err, `unsupported manifest format "xml", it must be json or csv`)
+}
+
+func TestCSVPump_Manifest(t *testing.T) {
+	dir := t.TempDir()
+	manifestPath := filepath.Join(dir, "manifest.json")
+	c := &CSVPump{}
+	err := c.Init(map[string]interface{}{"csv_dir": filepath.Join(dir, "csv"), "manifest_path": manifestPath})
+	assert.Nil(t, err)
+
+	ts := time.Now().UTC().Truncate(time.Second)
+	assert.Nil(t, c.WriteData(context.Background(), []interface{}{
+		analytics.AnalyticsRecord{APIID: "api1", TimeStamp: ts},
+		analytics.AnalyticsRecord{APIID: "api1", TimeStamp: ts.Add(time.Second)},
+	}))
+
+	readManifest := func() []FileManifestEntry {
+		content, err := os.ReadFile(manifestPath)
+		assert.Nil(t, err)
+		entries := []FileManifestEntry{}
+		assert.Nil(t, json.Unmarshal(content, &entries))
+		return entries
+	}
+	entries := readManifest()
+	assert.Len(t, entries, 1)
+	info, err := os.Stat(entries[0].Path)
+	assert.Nil(t, err)
+	assert.Equal(t, FileManifestEntry{Path: entries[0].Path, Records: 2, FirstTimestamp: ts, LastTimestamp: ts.Add(time.Second), SizeBytes: info.Size()}, entries[0])
+
+	// the manifest is updated after the next write to the file
+	assert.Nil(t, c.WriteData(context.Background(), []interface{}{analytics.AnalyticsRecord{APIID: "api1", TimeStamp: ts.Add(2 * time.Second)}}))
+	entries = readManifest()
+	assert.Len(t, entries, 1)
+	info, err = os.Stat(entries[0].Path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), entries[0].Records)
+	assert.Equal(t, ts.Add(2*time.Second), entries[0].LastTimestamp)
+	assert.Equal(t, info.Size(), entries[0].SizeBytes)
+}
@@ -0,0 +1,71 @@
+package pumps
+
+// goroutineSlots bounds the goroutines writing to the pumps, shared by all of them. It's nil, and
+// so unbounded, unless SetMaxGoroutines is called with a positive max.
+//
+// The long-lived goroutines of the pumps, like their tickers, the Prometheus listener, the SQL
+// aggregate background index creation and the Mongo janitor, don't hold a slot. The ticking ones
+// take one only while they write, like the OTel logs exports and the aggregate window flushes. The
+// Mongo async writer never takes one, since the writes blocked queueing to it hold theirs.
+var goroutineSlots chan struct{}
+
+// SetMaxGoroutines bounds to max the goroutines writing to the pumps. 0 or less removes the
+// bound. It must be called before the pumps start writing.
+func SetMaxGoroutines(max int) {
+	if max <= 0 {
+		goroutineSlots = nil
+		return
+	}
+	goroutineSlots = make(chan struct{}, max)
+}
+
+// TryAcquireGoroutine takes one of the goroutine slots if one is free. It returns the func
+// releasing the slot, to call once the write returns, and false if none is free. Without a bound,
+// it always succeeds.
+func TryAcquireGoroutine() (func(), bool) {
+	slots := goroutineSlots
+	if slots == nil {
+		return func() {}, true
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, true
+	default:
+		return nil, false
+	}
+}
+
+// AcquireGoroutine waits for a free goroutine slot and returns the func releasing it. It's meant
+// for the background writes, like the flushes of the buffering pumps, which can wait for the other
+// writes. It must not be called while holding a slot, or it may deadlock.
+func AcquireGoroutine() func() {
+	slots := goroutineSlots
+	if slots == nil {
+		return func() {}
+	}
+
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+// Go runs fn in a new goroutine if a goroutine slot is free, or in the calling goroutine
+// otherwise. Running fn in the caller slows down the writes instead of queueing them, and doesn't
+// deadlock when fn starts other goroutines with Go.
+func Go(fn func()) {
+	release, ok := TryAcquireGoroutine()
+	if !ok {
+		fn()
+		return
+	}
+
+	go func() {
+		defer release()
+		fn()
+	}()
+}
+
+// ActiveGoroutines returns the number of goroutine slots taken, when the goroutines are bounded.
+func ActiveGoroutines() int {
+	return len(goroutineSlots)
+}
@@ -0,0 +1,113 @@
+package pumps
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGo(t *testing.T) {
+	SetMaxGoroutines(3)
+	defer SetMaxGoroutines(0)
+
+	var running, maxRunning, maxActive, runs int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		Go(func() {
+			defer wg.Done()
+			n := atomic.AddInt32(&running, 1)
+			storeMax(&maxRunning, n)
+			storeMax(&maxActive, int32(ActiveGoroutines()))
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&runs, 1)
+		})
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(50), runs)
+	assert.LessOrEqual(t, maxActive, int32(3))
+	// the goroutines, and the caller once they're all busy
+	assert.LessOrEqual(t, maxRunning, int32(4))
+	// the slots are released once the goroutines return
+	assert.Eventually(t, func() bool {
+		return ActiveGoroutines() == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestGo_Nested(t *testing.T) {
+	SetMaxGoroutines(1)
+	defer SetMaxGoroutines(0)
+
+	// the nested goroutines run in their caller instead of waiting for a free slot
+	done := make(chan struct{})
+	Go(func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			Go(wg.Done)
+		}
+		wg.Wait()
+		close(done)
+	})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("nested goroutines deadlocked")
+	}
+}
+
+func TestGo_Unbounded(t *testing.T) {
+	done := make(chan struct{})
+	Go(func() {
+		close(done)
+	})
+	<-done
+	// the slots are released once the goroutines return
+	assert.Eventually(t, func() bool {
+		return ActiveGoroutines() == 0
+	}, time.Second, time.Millisecond)
+}
+
+func storeMax(max *int32, n int32) {
+	for {
+		current := atomic.LoadInt32(max)
+		if n <= current || atomic.CompareAndSwapInt32(max, current, n) {
+			return
+		}
+	}
+}
+
+func TestAcquireGoroutine(t *testing.T) {
+	SetMaxGoroutines(1)
+	defer SetMaxGoroutines(0)
+
+	release, ok := TryAcquireGoroutine()
+	assert.True(t, ok)
+	_, ok = TryAcquireGoroutine()
+	assert.False(t, ok)
+
+	// the background writes wait for the slot to be released
+	acquired := make(chan struct{})
+	go func() {
+		AcquireGoroutine()()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("the slot was acquired while taken")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("the slot wasn't acquired once released")
+	}
+	assert.Equal(t, 0, ActiveGoroutines())
+}
@@ -42,6 +42,10 @@ func (g *GraphMongoPump) SetDecodingResponse(decoding bool) {
 	}
 }
 
+func (g *GraphMongoPump) Shutdown() error {
+	return g.MongoPump.Shutdown()
+}
+
 func (g *GraphMongoPump) Init(config interface{}) error {
 	g.dbConf = &MongoConf{}
 	g.log = log.WithField("prefix", mongoGraphPrefix)
@@ -71,7 +75,9 @@ func (g *GraphMongoPump) Init(config interface{}) error {
 		g.dbConf.MaxDocumentSizeBytes = 10 * MiB
 	}
 
-	g.connect()
+	if err := g.connect(); err != nil {
+		return err
+	}
 
 	g.capCollection()
 
@@ -101,7 +107,8 @@ func (g *GraphMongoPump) WriteData(ctx context.Context, data []interface{}) erro
 
 	errCh := make(chan error, len(accumulateSet))
 	for _, dataSet := range accumulateSet {
-		go func(dataSet []model.DBObject, errCh chan error) {
+		dataSet := dataSet
+		Go(func() {
 			// make a graph record array with variable length in case there are errors with some conversion
 			finalSet := make([]model.DBObject, 0)
 			for _, d := range dataSet {
@@ -150,7 +157,7 @@ func (g *GraphMongoPump) WriteData(ctx context.Context, data []interface{}) erro
 				"collection":        collectionName,
 				"number of records": len(finalSet),
 			}).Info("Completed purging the records")
-		}(dataSet, errCh)
+		})
 	}
 
 	for range accumulateSet {
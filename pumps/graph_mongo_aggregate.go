@@ -0,0 +1,144 @@
+package pumps
+
+import (
+	"context"
+
+	"github.com/TykTechnologies/storage/persistent/model"
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	mongoGraphAggregatePrefix     = "mongo-graph-aggregate-pump"
+	mongoGraphAggregateDefaultEnv = PUMPS_ENV_PREFIX + "_MONGOGRAPHAGGREGATE" + PUMPS_ENV_META_PREFIX
+)
+
+// GraphMongoAggregatePump aggregates the GraphQL records per API and time bucket into Mongo, with
+// the counters of their operation types, types, fields and root fields. It takes the config of the
+// Mongo aggregate pump.
+type GraphMongoAggregatePump struct {
+	CommonPumpConfig
+	MongoAggregatePump
+}
+
+func (g *GraphMongoAggregatePump) New() Pump {
+	return &GraphMongoAggregatePump{}
+}
+
+func (g *GraphMongoAggregatePump) GetName() string {
+	return "MongoDB Graph Aggregate Pump"
+}
+
+func (g *GraphMongoAggregatePump) GetEnvPrefix() string {
+	return g.dbConf.EnvPrefix
+}
+
+func (g *GraphMongoAggregatePump) SetDecodingRequest(decoding bool) {
+	if decoding {
+		log.WithField("pump", g.GetName()).Warn("Decoding request is not supported for Graph Mongo Aggregate pump")
+	}
+}
+
+func (g *GraphMongoAggregatePump) SetDecodingResponse(decoding bool) {
+	if decoding {
+		log.WithField("pump", g.GetName()).Warn("Decoding response is not supported for Graph Mongo Aggregate pump")
+	}
+}
+
+func (g *GraphMongoAggregatePump) Init(config interface{}) error {
+	g.dbConf = &MongoAggregateConf{}
+	g.log = log.WithField("prefix", mongoGraphAggregatePrefix)
+
+	err := mapstructure.Decode(config, &g.dbConf)
+	if err == nil {
+		err = mapstructure.Decode(config, &g.dbConf.BaseMongoConf)
+	}
+	if err != nil {
+		g.log.WithError(err).Error("Failed to decode configuration")
+		return err
+	}
+
+	processPumpEnvVars(g, g.log, g.dbConf, mongoGraphAggregateDefaultEnv)
+
+	g.MongoAggregatePump.CommonPumpConfig = g.CommonPumpConfig
+	g.SetAggregationTime()
+
+	if err := g.connect(); err != nil {
+		return err
+	}
+
+	g.log.Debug("MongoDB DB CS: ", g.dbConf.GetBlurredURL())
+	g.log.Info(g.GetName() + " Initialized")
+	return nil
+}
+
+// dbIdentifier identifies the time buckets of the pump, apart from the ones of the Mongo aggregate
+// pumps writing to the same database.
+func (g *GraphMongoAggregatePump) dbIdentifier() string {
+	return "graph:" + g.dbConf.MongoURL
+}
+
+func (g *GraphMongoAggregatePump) WriteData(ctx context.Context, data []interface{}) error {
+	g.log.Debug("Attempting to write ", len(data), " records")
+
+	analyticsPerAPI := analytics.AggregateGraphData(data, g.dbIdentifier(), g.dbConf.AggregationTime)
+
+	writingAttempts := []bool{false}
+	if g.dbConf.UseMixedCollection {
+		writingAttempts = append(writingAttempts, true)
+	}
+	for apiID := range analyticsPerAPI {
+		ag := analyticsPerAPI[apiID]
+		for _, isMixedCollection := range writingAttempts {
+			if err := g.DoGraphAggregatedWriting(ctx, apiID, &ag, isMixedCollection); err != nil {
+				return err
+			}
+		}
+		g.log.Debug("Processed aggregated data for ", apiID)
+	}
+
+	g.log.Info("Purged ", len(data), " records...")
+	return nil
+}
+
+// DoGraphAggregatedWriting upserts the aggregation of the API, then updates the averages, lists
+// and error rates of the stored aggregation.
+func (g *GraphMongoAggregatePump) DoGraphAggregatedWriting(ctx context.Context, apiID string, ag *analytics.GraphRecordAggregate, mixed bool) error {
+	ag.Mixed = mixed
+	if err := g.ensureIndexes(ag.TableName()); err != nil {
+		g.log.Error(err)
+	}
+
+	query := model.DBM{
+		"orgid":     ag.OrgID,
+		"api":       apiID,
+		"timestamp": ag.TimeStamp,
+	}
+
+	if len(g.dbConf.IgnoreAggregationsList) > 0 {
+		ag.DiscardAggregations(g.dbConf.IgnoreAggregationsList)
+	}
+
+	doc := &analytics.GraphRecordAggregate{
+		AnalyticsRecordAggregate: analytics.AnalyticsRecordAggregate{OrgID: ag.OrgID, Mixed: mixed},
+	}
+	g.log.WithFields(logrus.Fields{
+		"collection": doc.TableName(),
+	}).Debug("Attempt to upsert aggregated doc")
+
+	if err := g.store.Upsert(ctx, doc, query, ag.AsChange()); err != nil {
+		g.log.WithField("query", query).Error("UPSERT Failure: ", err)
+		return err
+	}
+
+	// we have the new doc back, lets fix the averages
+	withTimeUpdate := &analytics.GraphRecordAggregate{
+		AnalyticsRecordAggregate: analytics.AnalyticsRecordAggregate{OrgID: ag.OrgID, Mixed: mixed},
+	}
+	if err := g.store.Upsert(ctx, withTimeUpdate, query, doc.AsTimeUpdate()); err != nil {
+		g.log.WithField("query", query).Error("AvgUpdate Failure: ", err)
+		return err
+	}
+	return nil
+}
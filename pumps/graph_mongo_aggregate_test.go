@@ -0,0 +1,187 @@
+package pumps
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/storage/persistent"
+	"github.com/TykTechnologies/storage/persistent/model"
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// decodingStore applies the upserts like mergingStore, one document per API, and decodes the
+// upserted document into the row like Mongo.
+type decodingStore struct {
+	persistent.PersistentStorage
+	docs map[string]model.DBM
+}
+
+func (s *decodingStore) HasTable(ctx context.Context, name string) (bool, error) {
+	return true, nil
+}
+
+func (s *decodingStore) CreateIndex(ctx context.Context, row model.DBObject, index model.Index) error {
+	return nil
+}
+
+func (s *decodingStore) Upsert(ctx context.Context, row model.DBObject, query, update model.DBM) error {
+	key := fmt.Sprint(row.TableName(), query["orgid"], query["api"], query["timestamp"])
+	doc, ok := s.docs[key]
+	if !ok {
+		doc = model.DBM{}
+		s.docs[key] = doc
+	}
+
+	for operator, fields := range update {
+		for field, value := range fields.(model.DBM) {
+			current, exists := doc[field]
+			switch {
+			case !exists || operator == "$set":
+				doc[field] = value
+			case operator == "$inc":
+				doc[field] = incValue(current, value)
+			case operator == "$max" && compareValues(value, current) > 0:
+				doc[field] = value
+			case operator == "$min" && compareValues(value, current) < 0:
+				doc[field] = value
+			}
+		}
+	}
+
+	// the fields of the document are dot separated paths
+	nested := map[string]interface{}{}
+	for field, value := range doc {
+		parent := nested
+		path := strings.Split(field, ".")
+		for _, name := range path[:len(path)-1] {
+			if _, ok := parent[name].(map[string]interface{}); !ok {
+				parent[name] = map[string]interface{}{}
+			}
+			parent = parent[name].(map[string]interface{})
+		}
+		parent[path[len(path)-1]] = value
+	}
+	encoded, err := bson.Marshal(nested)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(encoded, row)
+}
+
+func graphRecord(apiID string, opType analytics.GraphQLOperations, responseCode int, hasErrors bool, timestamp time.Time) analytics.AnalyticsRecord {
+	return analytics.AnalyticsRecord{
+		OrgID:        "org1",
+		APIID:        apiID,
+		ResponseCode: responseCode,
+		TimeStamp:    timestamp,
+		GraphQLStats: analytics.GraphQLStats{
+			IsGraphQL: true,
+			Types: map[string][]string{
+				"Characters": {"info", "results"},
+			},
+			RootFields:    []string{"characters"},
+			OperationType: opType,
+			HasErrors:     hasErrors,
+		},
+	}
+}
+
+func TestGraphMongoAggregatePump_WriteData(t *testing.T) {
+	store := &decodingStore{docs: map[string]model.DBM{}}
+	pmp := &GraphMongoAggregatePump{}
+	conf := &MongoAggregateConf{UseMixedCollection: true}
+	conf.MongoURL = "mongodb://localhost:27017/tyk_analytics"
+	conf.OmitIndexCreation = true
+	pmp.dbConf = conf
+	pmp.store = store
+	pmp.log = log.WithField("prefix", mongoGraphAggregatePrefix)
+	pmp.MongoAggregatePump.CommonPumpConfig = pmp.CommonPumpConfig
+	pmp.SetAggregationTime()
+
+	timestamp := time.Date(2024, 3, 1, 10, 15, 0, 0, time.UTC)
+	records := []interface{}{
+		graphRecord("api1", analytics.OperationQuery, 200, false, timestamp),
+		graphRecord("api1", analytics.OperationQuery, 200, true, timestamp),
+		graphRecord("api1", analytics.OperationMutation, 500, false, timestamp),
+		graphRecord("api2", analytics.OperationQuery, 200, false, timestamp),
+		// not a graph record
+		analytics.AnalyticsRecord{OrgID: "org1", APIID: "api3", ResponseCode: 200, TimeStamp: timestamp},
+	}
+	// written twice, the counters add up
+	assert.Nil(t, pmp.WriteData(context.Background(), records))
+	assert.Nil(t, pmp.WriteData(context.Background(), records))
+
+	// the org and the mixed collections, per API
+	assert.Len(t, store.docs, 4)
+	hour := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	tcs := []struct {
+		collection string
+		apiID      string
+		expected   map[string]interface{}
+	}{
+		{
+			collection: "z_tyk_graph_analyticz_aggregate_org1",
+			apiID:      "api1",
+			// the graph errors aren't errors of the total, which counts the HTTP ones
+			expected: map[string]interface{}{
+				"total.hits":                           6,
+				"total.errortotal":                     2,
+				"total.errorrate":                      2.0 / 6,
+				"operation.Query.hits":                 4,
+				"operation.Query.errortotal":           2,
+				"operation.Query.errorrate":            0.5,
+				"operation.Mutation.hits":              2,
+				"operation.Mutation.success":           0,
+				"operation.Mutation.errorrate":         1.0,
+				"types.Characters.hits":                6,
+				"fields.Characters_info.hits":          6,
+				"fields.Characters_results.errortotal": 4,
+				"rootfields.characters.hits":           6,
+			},
+		},
+		{
+			collection: "z_tyk_graph_analyticz_aggregate_org1",
+			apiID:      "api2",
+			expected: map[string]interface{}{
+				"total.hits":                2,
+				"total.errorrate":           0.0,
+				"operation.Query.hits":      2,
+				"operation.Query.errorrate": 0.0,
+			},
+		},
+		{
+			collection: analytics.GraphAggregateMixedCollectionName,
+			apiID:      "api1",
+			expected: map[string]interface{}{
+				"total.hits":           6,
+				"operation.Query.hits": 4,
+			},
+		},
+	}
+	for _, tc := range tcs {
+		doc := store.docs[fmt.Sprint(tc.collection, "org1", tc.apiID, hour)]
+		if !assert.NotNil(t, doc, tc.collection+" "+tc.apiID) {
+			continue
+		}
+		for field, value := range tc.expected {
+			assert.Equal(t, value, doc[field], tc.collection+" "+tc.apiID+" "+field)
+		}
+	}
+
+	// the lists of the graph dimensions are set from the stored aggregation
+	operations := store.docs[fmt.Sprint("z_tyk_graph_analyticz_aggregate_org1", "org1", "api1", hour)]["lists.operation"].([]analytics.Counter)
+	assert.Len(t, operations, 2)
+}
+
+func TestGraphRecordAggregate_TableName(t *testing.T) {
+	ag := analytics.NewGraphRecordAggregate()
+	ag.OrgID = "org1"
+	assert.Equal(t, "z_tyk_graph_analyticz_aggregate_org1", ag.TableName())
+	ag.Mixed = true
+	assert.Equal(t, analytics.GraphAggregateMixedCollectionName, ag.TableName())
+}
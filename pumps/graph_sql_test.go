@@ -271,10 +271,11 @@ func TestGraphSQLPump_WriteData(t *testing.T) {
 			// create the responses to be expected from the db
 			for _, item := range tc.responses {
 				r := analytics.GraphRecord{
-					Types:         item.types,
-					OperationType: item.operationType,
-					Errors:        []analytics.GraphError{},
-					Variables:     item.variables,
+					Types:                item.types,
+					OperationType:        item.operationType,
+					Errors:               []analytics.GraphError{},
+					Variables:            item.variables,
+					ResponseObjectCounts: map[string]int{},
 				}
 				if len(item.expectedErr) == 0 {
 					r.Errors = []analytics.GraphError{}
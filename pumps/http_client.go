@@ -0,0 +1,38 @@
+package pumps
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// HTTPClientConf caps the connections the HTTP client of a pump opens to its backend. The
+// Logz.io and Moesif pumps don't have it, their libraries don't accept a client.
+type HTTPClientConf struct {
+	// The maximum number of idle connections kept open, across all the hosts. Defaults to 100, 0
+	// keeps the default.
+	MaxIdleConns int `json:"max_idle_conns" mapstructure:"max_idle_conns"`
+	// The maximum number of connections to a host, including the ones in use. The requests beyond
+	// it wait for a connection to be available. It also sets the maximum number of idle
+	// connections to a host. Defaults to 0, no limit.
+	MaxConnsPerHost int `json:"max_conns_per_host" mapstructure:"max_conns_per_host"`
+}
+
+// newHTTPTransport returns a transport with the defaults of http.DefaultTransport, the given TLS
+// config and the connection limits of conf.
+func newHTTPTransport(conf HTTPClientConf, tlsConfig *tls.Config) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if conf.MaxIdleConns > 0 {
+		transport.MaxIdleConns = conf.MaxIdleConns
+	}
+	if conf.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = conf.MaxConnsPerHost
+		transport.MaxIdleConnsPerHost = conf.MaxConnsPerHost
+	}
+	return transport
+}
+
+// newHTTPClient returns a client using newHTTPTransport.
+func newHTTPClient(conf HTTPClientConf, tlsConfig *tls.Config) *http.Client {
+	return &http.Client{Transport: newHTTPTransport(conf, tlsConfig)}
+}
@@ -0,0 +1,63 @@
+package pumps
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHTTPTransport(t *testing.T) {
+	defaultTransport := http.DefaultTransport.(*http.Transport)
+
+	t.Run("defaults", func(t *testing.T) {
+		transport := newHTTPTransport(HTTPClientConf{}, nil)
+		assert.Equal(t, defaultTransport.MaxIdleConns, transport.MaxIdleConns)
+		assert.Equal(t, 0, transport.MaxConnsPerHost)
+		assert.Equal(t, defaultTransport.MaxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+		assert.NotNil(t, transport.Proxy)
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		tlsConfig := &tls.Config{ServerName: "splunk"}
+		transport := newHTTPTransport(HTTPClientConf{MaxIdleConns: 5, MaxConnsPerHost: 3}, tlsConfig)
+		assert.Equal(t, 5, transport.MaxIdleConns)
+		assert.Equal(t, 3, transport.MaxConnsPerHost)
+		assert.Equal(t, 3, transport.MaxIdleConnsPerHost)
+		assert.Equal(t, tlsConfig, transport.TLSClientConfig)
+
+		// the default transport is left untouched
+		assert.Equal(t, 0, defaultTransport.MaxConnsPerHost)
+	})
+}
+
+func TestHTTPPumpsConnectionLimits(t *testing.T) {
+	meta := map[string]interface{}{"max_idle_conns": 10, "max_conns_per_host": 4}
+
+	t.Run("splunk", func(t *testing.T) {
+		splunkMeta := map[string]interface{}{"collector_token": "token", "collector_url": "http://localhost:8088", "ssl_insecure_skip_verify": true}
+		for k, v := range meta {
+			splunkMeta[k] = v
+		}
+		pmp := &SplunkPump{}
+		assert.Nil(t, pmp.Init(splunkMeta))
+
+		transport := pmp.client.httpClient.Transport.(*http.Transport)
+		assert.Equal(t, 10, transport.MaxIdleConns)
+		assert.Equal(t, 4, transport.MaxConnsPerHost)
+		assert.True(t, transport.TLSClientConfig.InsecureSkipVerify)
+		// the splunk TLS config doesn't leak into the default client
+		assert.Nil(t, http.DefaultClient.Transport)
+	})
+
+	t.Run("otel logs", func(t *testing.T) {
+		pmp := &OtelLogsPump{}
+		assert.Nil(t, pmp.Init(meta))
+		defer pmp.Shutdown()
+
+		transport := pmp.exporter.(*otelLogsHTTPExporter).client.Transport.(*http.Transport)
+		assert.Equal(t, 10, transport.MaxIdleConns)
+		assert.Equal(t, 4, transport.MaxConnsPerHost)
+	})
+}
@@ -3,6 +3,7 @@ package pumps
 import (
 	"context"
 	"encoding/json"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,6 +22,8 @@ var (
 	influxPrefix     = "influx-pump"
 	influxDefaultENV = PUMPS_ENV_PREFIX + "_INFLUX" + PUMPS_ENV_META_PREFIX
 	table            = "analytics"
+
+	influxDefaultAggregateMeasurement = "analytics_aggregate"
 )
 
 // @PumpConf Influx
@@ -41,6 +44,16 @@ type InfluxConf struct {
 	Fields []string `json:"fields" mapstructure:"fields"`
 	// List of tags to be added to the metric.
 	Tags []string `json:"tags" mapstructure:"tags"`
+	// Setting this to true writes, for each batch, one point per org, API and response code with
+	// the hit and error counts and the latency stats of its records, instead of one point per
+	// record. `fields` and `tags` are ignored in this mode.
+	Aggregated bool `json:"aggregated" mapstructure:"aggregated"`
+	// Measurement of the aggregate points. Defaults to `analytics_aggregate`.
+	AggregateMeasurement string `json:"aggregate_measurement" mapstructure:"aggregate_measurement"`
+	// Set to `true` to add the network stats of the records to the points, as the
+	// `network_open_connections`, `network_closed_connections`, `network_bytes_in` and
+	// `network_bytes_out` fields, along with `fields`. Defaults to `false`.
+	NetworkStats bool `json:"network_stats" mapstructure:"network_stats"`
 }
 
 func (i *InfluxPump) New() Pump {
@@ -67,6 +80,10 @@ func (i *InfluxPump) Init(config interface{}) error {
 
 	processPumpEnvVars(i, i.log, i.dbConf, influxDefaultENV)
 
+	if i.dbConf.AggregateMeasurement == "" {
+		i.dbConf.AggregateMeasurement = influxDefaultAggregateMeasurement
+	}
+
 	i.connect()
 
 	i.log.Debug("Influx DB CS: ", i.dbConf.Addr)
@@ -101,6 +118,16 @@ func (i *InfluxPump) WriteData(ctx context.Context, data []interface{}) error {
 		Precision: "us",
 	})
 
+	if i.dbConf.Aggregated {
+		for _, pt := range i.aggregatePoints(data, time.Now()) {
+			bp.AddPoint(pt)
+		}
+		c.Write(bp)
+		i.log.Info("Purged ", len(data), " records as ", len(bp.Points()), " aggregate points...")
+
+		return nil
+	}
+
 	var pt *client.Point
 	var err error
 
@@ -146,6 +173,11 @@ func (i *InfluxPump) WriteData(ctx context.Context, data []interface{}) error {
 		for _, f := range i.dbConf.Fields {
 			fields[f] = mapping[f]
 		}
+		if i.dbConf.NetworkStats {
+			for field, value := range networkStatsFields(decoded.Network) {
+				fields[field] = value
+			}
+		}
 
 		// New record
 		if pt, err = client.NewPoint(table, tags, fields, time.Now()); err != nil {
@@ -163,3 +195,85 @@ func (i *InfluxPump) WriteData(ctx context.Context, data []interface{}) error {
 
 	return nil
 }
+
+// influxAggregateKey identifies the aggregate point of a record.
+type influxAggregateKey struct {
+	orgID        string
+	apiID        string
+	responseCode int
+}
+
+// influxAggregate holds the counts and latency stats of the records of an aggregate point.
+type influxAggregate struct {
+	hits            int64
+	errors          int64
+	latencyTotal    int64
+	latencyMax      int64
+	latencyMin      int64
+	latencyUpstream int64
+	requestTime     int64
+}
+
+// aggregatePoints returns one point per org, API and response code of the records in data.
+func (i *InfluxPump) aggregatePoints(data []interface{}, ts time.Time) []*client.Point {
+	keys := []influxAggregateKey{}
+	aggregates := map[influxAggregateKey]*influxAggregate{}
+	for _, v := range data {
+		decoded, ok := v.(analytics.AnalyticsRecord)
+		if !ok {
+			continue
+		}
+
+		key := influxAggregateKey{orgID: decoded.OrgID, apiID: decoded.APIID, responseCode: decoded.ResponseCode}
+		aggregate, found := aggregates[key]
+		if !found {
+			aggregate = &influxAggregate{latencyMin: decoded.Latency.Total}
+			aggregates[key] = aggregate
+			keys = append(keys, key)
+		}
+
+		aggregate.hits++
+		if decoded.ResponseCode >= 400 {
+			aggregate.errors++
+		}
+		aggregate.latencyTotal += decoded.Latency.Total
+		aggregate.latencyUpstream += decoded.Latency.Upstream
+		aggregate.requestTime += decoded.RequestTime
+		if decoded.Latency.Total > aggregate.latencyMax {
+			aggregate.latencyMax = decoded.Latency.Total
+		}
+		if decoded.Latency.Total < aggregate.latencyMin {
+			aggregate.latencyMin = decoded.Latency.Total
+		}
+	}
+
+	points := make([]*client.Point, 0, len(keys))
+	for _, key := range keys {
+		aggregate := aggregates[key]
+		tags := map[string]string{
+			"org_id":        key.orgID,
+			"api_id":        key.apiID,
+			"response_code": strconv.Itoa(key.responseCode),
+		}
+		fields := map[string]interface{}{
+			"hits":                 aggregate.hits,
+			"success":              aggregate.hits - aggregate.errors,
+			"errors":               aggregate.errors,
+			"latency_total":        aggregate.latencyTotal,
+			"latency_avg":          float64(aggregate.latencyTotal) / float64(aggregate.hits),
+			"latency_max":          aggregate.latencyMax,
+			"latency_min":          aggregate.latencyMin,
+			"upstream_latency_avg": float64(aggregate.latencyUpstream) / float64(aggregate.hits),
+			"request_time_avg":     float64(aggregate.requestTime) / float64(aggregate.hits),
+		}
+
+		pt, err := client.NewPoint(i.dbConf.AggregateMeasurement, tags, fields, ts)
+		if err != nil {
+			i.log.Error(err)
+			continue
+		}
+		points = append(points, pt)
+	}
+
+	return points
+}
@@ -0,0 +1,161 @@
+package pumps
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+func TestInfluxPumpAggregatePoints(t *testing.T) {
+	pmp := &InfluxPump{dbConf: &InfluxConf{AggregateMeasurement: influxDefaultAggregateMeasurement}}
+	pmp.log = log.WithField("prefix", influxPrefix)
+
+	data := []interface{}{
+		analytics.AnalyticsRecord{OrgID: "org1", APIID: "api1", ResponseCode: 200, RequestTime: 12, Latency: analytics.Latency{Total: 12, Upstream: 10}},
+		analytics.AnalyticsRecord{OrgID: "org1", APIID: "api1", ResponseCode: 200, RequestTime: 30, Latency: analytics.Latency{Total: 30, Upstream: 20}},
+		analytics.AnalyticsRecord{OrgID: "org1", APIID: "api1", ResponseCode: 200, RequestTime: 6, Latency: analytics.Latency{Total: 6, Upstream: 3}},
+		analytics.AnalyticsRecord{OrgID: "org1", APIID: "api1", ResponseCode: 500, RequestTime: 100, Latency: analytics.Latency{Total: 100, Upstream: 99}},
+		analytics.AnalyticsRecord{OrgID: "org1", APIID: "api2", ResponseCode: 404, RequestTime: 2, Latency: analytics.Latency{Total: 2}},
+		analytics.AnalyticsRecord{OrgID: "org1", APIID: "api2", ResponseCode: 404, RequestTime: 4, Latency: analytics.Latency{Total: 4}},
+	}
+
+	ts := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	points := pmp.aggregatePoints(data, ts)
+	assert.Len(t, points, 3)
+
+	expected := []struct {
+		tags   map[string]string
+		fields map[string]interface{}
+	}{
+		{
+			tags: map[string]string{"org_id": "org1", "api_id": "api1", "response_code": "200"},
+			fields: map[string]interface{}{
+				"hits": int64(3), "success": int64(3), "errors": int64(0),
+				"latency_total": int64(48), "latency_avg": 16.0, "latency_max": int64(30), "latency_min": int64(6),
+				"upstream_latency_avg": 11.0, "request_time_avg": 16.0,
+			},
+		},
+		{
+			tags: map[string]string{"org_id": "org1", "api_id": "api1", "response_code": "500"},
+			fields: map[string]interface{}{
+				"hits": int64(1), "success": int64(0), "errors": int64(1),
+				"latency_total": int64(100), "latency_avg": 100.0, "latency_max": int64(100), "latency_min": int64(100),
+				"upstream_latency_avg": 99.0, "request_time_avg": 100.0,
+			},
+		},
+		{
+			tags: map[string]string{"org_id": "org1", "api_id": "api2", "response_code": "404"},
+			fields: map[string]interface{}{
+				"hits": int64(2), "success": int64(0), "errors": int64(2),
+				"latency_total": int64(6), "latency_avg": 3.0, "latency_max": int64(4), "latency_min": int64(2),
+				"upstream_latency_avg": 0.0, "request_time_avg": 3.0,
+			},
+		},
+	}
+	for i, pt := range points {
+		assert.Equal(t, influxDefaultAggregateMeasurement, pt.Name())
+		assert.Equal(t, ts, pt.Time())
+		assert.Equal(t, expected[i].tags, pt.Tags())
+		fields, err := pt.Fields()
+		assert.Nil(t, err)
+		assert.Equal(t, expected[i].fields, fields)
+	}
+}
+
+func TestInfluxPumpWriteAggregated(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, "/write", r.URL.Path)
+		assert.Equal(t, "tyk", r.URL.Query().Get("db"))
+
+		mu.Lock()
+		lines = append(lines, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	pmp := &InfluxPump{}
+	assert.Nil(t, pmp.Init(map[string]interface{}{
+		"database_name": "tyk",
+		"address":       server.URL,
+		"aggregated":    true,
+	}))
+
+	data := make([]interface{}, 0, 100)
+	for i := 1; i <= 100; i++ {
+		responseCode := 200
+		if i%10 == 0 {
+			responseCode = 500
+		}
+		data = append(data, analytics.AnalyticsRecord{OrgID: "org1", APIID: "api1", ResponseCode: responseCode})
+	}
+	assert.Nil(t, pmp.WriteData(context.Background(), data))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "analytics_aggregate,api_id=api1,org_id=org1,response_code=200 "), lines[0])
+	assert.Contains(t, lines[0], "hits=90i")
+	assert.True(t, strings.HasPrefix(lines[1], "analytics_aggregate,api_id=api1,org_id=org1,response_code=500 "), lines[1])
+	assert.Contains(t, lines[1], "errors=10i")
+}
+
+func TestInfluxPumpWriteNetworkStats(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.Nil(t, err)
+
+		mu.Lock()
+		lines = append(lines, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	data := []interface{}{analytics.AnalyticsRecord{
+		APIID:        "api1",
+		ResponseCode: 200,
+		Network:      analytics.NetworkStats{OpenConnections: 1, ClosedConnection: 2, BytesIn: 300, BytesOut: 4000},
+	}}
+
+	for _, networkStats := range []bool{true, false} {
+		lines = nil
+		pmp := &InfluxPump{}
+		assert.Nil(t, pmp.Init(map[string]interface{}{
+			"database_name": "tyk",
+			"address":       server.URL,
+			"fields":        []string{"response_code"},
+			"tags":          []string{"api_id"},
+			"network_stats": networkStats,
+		}))
+		assert.Nil(t, pmp.WriteData(context.Background(), data))
+
+		mu.Lock()
+		assert.Len(t, lines, 1)
+		assert.True(t, strings.HasPrefix(lines[0], "analytics,api_id=api1 "), lines[0])
+		assert.Contains(t, lines[0], "response_code=200i")
+		for _, field := range []string{"network_open_connections=1i", "network_closed_connections=2i", "network_bytes_in=300i", "network_bytes_out=4000i"} {
+			if networkStats {
+				assert.Contains(t, lines[0], field)
+			} else {
+				assert.NotContains(t, lines[0], field)
+			}
+		}
+		mu.Unlock()
+	}
+}
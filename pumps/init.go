@@ -35,5 +35,11 @@ func init() {
 	AvailablePumps["mongo-graph"] = &GraphMongoPump{}
 	AvailablePumps["sql-graph"] = &GraphSQLPump{}
 	AvailablePumps["sql-graph-aggregate"] = &GraphSQLAggregatePump{}
+	AvailablePumps["mongo-graph-aggregate"] = &GraphMongoAggregatePump{}
 	AvailablePumps["resurfaceio"] = &ResurfacePump{}
+	AvailablePumps["s3-parquet"] = &S3ParquetPump{}
+	AvailablePumps["cassandra"] = &CassandraPump{}
+	AvailablePumps["otel-logs"] = &OtelLogsPump{}
+	AvailablePumps["kinesis"] = &KinesisPump{}
+	AvailablePumps["w3c"] = &W3CPump{}
 }
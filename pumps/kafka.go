@@ -1,11 +1,17 @@
 package pumps
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/TykTechnologies/tyk-pump/analytics"
@@ -20,9 +26,14 @@ import (
 )
 
 type KafkaPump struct {
-	kafkaConf    *KafkaConf
-	writerConfig kafka.WriterConfig
-	log          *logrus.Entry
+	kafkaConf     *KafkaConf
+	writerConfig  kafka.WriterConfig
+	log           *logrus.Entry
+	topicTemplate *template.Template
+	// topics remembers the topics produced by the topic template, up to kafkaMaxLoggedTopics, to
+	// log the first records routed to each of them.
+	topics   map[string]bool
+	topicsMu sync.Mutex
 	CommonPumpConfig
 }
 
@@ -31,6 +42,10 @@ type Json map[string]interface{}
 var kafkaPrefix = "kafka-pump"
 var kafkaDefaultENV = PUMPS_ENV_PREFIX + "_KAFKA" + PUMPS_ENV_META_PREFIX
 
+// kafkaMaxLoggedTopics bounds the topics of the topic template remembered by a pump. The records
+// routed to the later topics are logged at debug level.
+const kafkaMaxLoggedTopics = 1000
+
 // @PumpConf Kafka
 type KafkaConf struct {
 	EnvPrefix string `mapstructure:"meta_env_prefix"`
@@ -39,8 +54,16 @@ type KafkaConf struct {
 	Broker []string `json:"broker" mapstructure:"broker"`
 	// Unique identifier for client connections established with Kafka.
 	ClientId string `json:"client_id" mapstructure:"client_id"`
-	// The topic that the writer will produce messages to.
+	// The topic that the writer will produce messages to. If `topic_template` is set, this is the
+	// fallback topic used when the template yields an empty topic.
 	Topic string `json:"topic" mapstructure:"topic"`
+	// Go template used to route each record to its own topic. The template is executed against
+	// the analytics record, so any record field can be used, e.g. `analytics-{{.OrgID}}`. The
+	// `Tags` helper returns the value of a `key:value` (or `key-value`) tag, e.g.
+	// `analytics-{{.Tags "env"}}`. The helper shadows the `Tags` field of the record, whose list of
+	// tags isn't available to the template. If the tag isn't present or the template yields an
+	// empty topic, the record is sent to `topic`.
+	TopicTemplate string `json:"topic_template" mapstructure:"topic_template"`
 	// Timeout is the maximum amount of seconds to wait for a connect or write to complete.
 	Timeout interface{} `json:"timeout" mapstructure:"timeout"`
 	// Enable "github.com/golang/snappy" codec to be used to compress Kafka messages. By default
@@ -66,6 +89,11 @@ type KafkaConf struct {
 	// SASL algorithm. It's the algorithm specified for scram mechanism. It could be sha-512 or sha-256.
 	// Defaults to "sha-256".
 	Algorithm string `json:"sasl_algorithm" mapstructure:"sasl_algorithm"`
+	// Headers set on each message, mapped to the fields of the message they take their value from,
+	// e.g. `{"x-api-id": "api_id", "x-org-id": "org_id"}`, so the consumers can filter the messages
+	// without deserializing them. The `content_type` field is the content type of the message
+	// value, `application/json`. The headers whose field is empty aren't set.
+	Headers map[string]string `json:"headers" mapstructure:"headers"`
 }
 
 func (k *KafkaPump) New() Pump {
@@ -178,6 +206,20 @@ func (k *KafkaPump) Init(config interface{}) error {
 		k.writerConfig.CompressionCodec = snappy.NewCompressionCodec()
 	}
 
+	if err := k.validateHeaders(); err != nil {
+		k.log.Error("Invalid headers: ", err)
+		return err
+	}
+
+	if k.kafkaConf.TopicTemplate != "" {
+		k.topicTemplate, err = template.New("topic").Parse(k.kafkaConf.TopicTemplate)
+		if err != nil {
+			k.log.Error("Failed to parse topic_template: ", err)
+			return err
+		}
+		k.topics = make(map[string]bool)
+	}
+
 	k.log.Info(k.GetName() + " Initialized")
 
 	return nil
@@ -186,61 +228,180 @@ func (k *KafkaPump) Init(config interface{}) error {
 func (k *KafkaPump) WriteData(ctx context.Context, data []interface{}) error {
 	startTime := time.Now()
 	k.log.Debug("Attempting to write ", len(data), " records...")
-	kafkaMessages := make([]kafka.Message, len(data))
-	for i, v := range data {
-		//Build message format
+	kafkaMessages := make(map[string][]kafka.Message)
+	for _, v := range data {
 		decoded := v.(analytics.AnalyticsRecord)
-		message := Json{
-			"timestamp":       decoded.TimeStamp,
-			"method":          decoded.Method,
-			"path":            decoded.Path,
-			"raw_path":        decoded.RawPath,
-			"response_code":   decoded.ResponseCode,
-			"alias":           decoded.Alias,
-			"api_key":         decoded.APIKey,
-			"api_version":     decoded.APIVersion,
-			"api_name":        decoded.APIName,
-			"api_id":          decoded.APIID,
-			"org_id":          decoded.OrgID,
-			"oauth_id":        decoded.OauthID,
-			"raw_request":     decoded.RawRequest,
-			"request_time_ms": decoded.RequestTime,
-			"raw_response":    decoded.RawResponse,
-			"ip_address":      decoded.IPAddress,
-			"host":            decoded.Host,
-			"content_length":  decoded.ContentLength,
-			"user_agent":      decoded.UserAgent,
-			"tags":            decoded.Tags,
-		}
-		//Add static metadata to json
-		for key, value := range k.kafkaConf.MetaData {
-			message[key] = value
-		}
-
-		//Transform object to json string
-		json, jsonError := json.Marshal(message)
-		if jsonError != nil {
-			k.log.WithError(jsonError).Error("unable to marshal message")
-		}
+		message := k.kafkaMessage(decoded)
 
-		//Kafka message structure
-		kafkaMessages[i] = kafka.Message{
-			Time:  time.Now(),
-			Value: json,
-		}
+		topic := k.topicFor(decoded)
+		kafkaMessages[topic] = append(kafkaMessages[topic], message)
+	}
+	if k.topicTemplate != nil {
+		k.logTopics(kafkaMessages)
 	}
 	//Send kafka message
-	kafkaError := k.write(ctx, kafkaMessages)
-	if kafkaError != nil {
-		k.log.WithError(kafkaError).Error("unable to write message")
+	for topic, messages := range kafkaMessages {
+		kafkaError := k.write(ctx, topic, messages)
+		if kafkaError != nil {
+			k.log.WithError(kafkaError).WithField("topic", topic).Error("unable to write message")
+		}
 	}
 	k.log.Debug("ElapsedTime in seconds for ", len(data), " records:", time.Now().Sub(startTime))
 	k.log.Info("Purged ", len(data), " records...")
 	return nil
 }
 
-func (k *KafkaPump) write(ctx context.Context, messages []kafka.Message) error {
-	kafkaWriter := kafka.NewWriter(k.writerConfig)
+// kafkaMessageContentType is the content type of the values of the messages, set on the headers
+// mapped to the content_type field.
+const kafkaMessageContentType = "application/json"
+
+// messageFields returns the fields of the message of the record, with the static metadata.
+func (k *KafkaPump) messageFields(decoded analytics.AnalyticsRecord) Json {
+	//Build message format
+	message := Json{
+		"timestamp":       decoded.TimeStamp,
+		"method":          decoded.Method,
+		"path":            decoded.Path,
+		"raw_path":        decoded.RawPath,
+		"response_code":   decoded.ResponseCode,
+		"alias":           decoded.Alias,
+		"api_key":         decoded.APIKey,
+		"api_version":     decoded.APIVersion,
+		"api_name":        decoded.APIName,
+		"api_id":          decoded.APIID,
+		"org_id":          decoded.OrgID,
+		"oauth_id":        decoded.OauthID,
+		"raw_request":     decoded.RawRequest,
+		"request_time_ms": decoded.RequestTime,
+		"raw_response":    decoded.RawResponse,
+		"ip_address":      decoded.IPAddress,
+		"host":            decoded.Host,
+		"content_length":  decoded.ContentLength,
+		"user_agent":      decoded.UserAgent,
+		"tags":            decoded.Tags,
+	}
+	if len(decoded.TagMap) > 0 {
+		message["tag_map"] = decoded.TagMap
+	}
+	//Add static metadata to json
+	for key, value := range k.kafkaConf.MetaData {
+		message[key] = value
+	}
+	return message
+}
+
+// kafkaMessage returns the Kafka message of the record, with its headers.
+func (k *KafkaPump) kafkaMessage(decoded analytics.AnalyticsRecord) kafka.Message {
+	message := k.messageFields(decoded)
+
+	//Transform object to json string
+	json, jsonError := json.Marshal(message)
+	if jsonError != nil {
+		k.log.WithError(jsonError).Error("unable to marshal message")
+	}
+
+	return kafka.Message{
+		Time:    time.Now(),
+		Value:   json,
+		Headers: k.messageHeaders(message),
+	}
+}
+
+// messageHeaders returns the headers of the message, with the values of the fields they're mapped
+// to. The headers whose field is empty are left out.
+func (k *KafkaPump) messageHeaders(message Json) []kafka.Header {
+	if len(k.kafkaConf.Headers) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(k.kafkaConf.Headers))
+	for name := range k.kafkaConf.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	headers := make([]kafka.Header, 0, len(names))
+	for _, name := range names {
+		field := k.kafkaConf.Headers[name]
+		var value string
+		if field == "content_type" {
+			value = kafkaMessageContentType
+		} else if fieldValue, ok := message[field]; ok {
+			value = fmt.Sprint(fieldValue)
+		}
+		if value == "" {
+			continue
+		}
+		headers = append(headers, kafka.Header{Key: name, Value: []byte(value)})
+	}
+	return headers
+}
+
+// validateHeaders checks that the headers are mapped to fields of the messages.
+func (k *KafkaPump) validateHeaders() error {
+	fields := k.messageFields(analytics.AnalyticsRecord{})
+	for name, field := range k.kafkaConf.Headers {
+		if _, ok := fields[field]; !ok && field != "content_type" {
+			return fmt.Errorf("header %q is mapped to the unknown field %q", name, field)
+		}
+	}
+	return nil
+}
+
+// kafkaTopicRecord is the data the topic template is executed against.
+type kafkaTopicRecord struct {
+	analytics.AnalyticsRecord
+}
+
+// Tags returns the value of the `key:value` or `key-value` tag of the record. It fails if the
+// record doesn't have such tag, so the fallback topic is used. It shadows the Tags field of the
+// embedded record in the templates.
+func (r kafkaTopicRecord) Tags(key string) (string, error) {
+	if value, ok := r.AnalyticsRecord.TagValue(key); ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("tag %q not found", key)
+}
+
+// topicFor returns the topic the record must be written to.
+func (k *KafkaPump) topicFor(record analytics.AnalyticsRecord) string {
+	if k.topicTemplate == nil {
+		return k.kafkaConf.Topic
+	}
+
+	var buf bytes.Buffer
+	if err := k.topicTemplate.Execute(&buf, kafkaTopicRecord{record}); err != nil {
+		k.log.Debug("Using fallback topic: ", err)
+		return k.kafkaConf.Topic
+	}
+	topic := strings.TrimSpace(buf.String())
+	if topic == "" {
+		return k.kafkaConf.Topic
+	}
+	return topic
+}
+
+// logTopics logs the topics the records of a batch are routed to for the first time.
+func (k *KafkaPump) logTopics(messages map[string][]kafka.Message) {
+	k.topicsMu.Lock()
+	defer k.topicsMu.Unlock()
+	for topic := range messages {
+		if k.topics[topic] {
+			continue
+		}
+		if len(k.topics) >= kafkaMaxLoggedTopics {
+			k.log.Debug("Routing records to topic ", topic)
+			continue
+		}
+		k.log.Info("Routing records to topic ", topic)
+		k.topics[topic] = true
+	}
+}
+
+func (k *KafkaPump) write(ctx context.Context, topic string, messages []kafka.Message) error {
+	writerConfig := k.writerConfig
+	writerConfig.Topic = topic
+	kafkaWriter := kafka.NewWriter(writerConfig)
 	defer kafkaWriter.Close()
 	return kafkaWriter.WriteMessages(ctx, messages...)
 }
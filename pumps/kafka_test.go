@@ -0,0 +1,155 @@
+package pumps
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKafkaPump_TopicTemplate(t *testing.T) {
+	pmp := &KafkaPump{}
+	err := pmp.Init(map[string]interface{}{
+		"broker":         []string{"localhost:9092"},
+		"topic":          "analytics-fallback",
+		"topic_template": `analytics-{{.Tags "env"}}`,
+	})
+	assert.Nil(t, err)
+
+	tcs := []struct {
+		testName      string
+		tags          []string
+		expectedTopic string
+	}{
+		{
+			testName:      "colon separated tag",
+			tags:          []string{"key-abc", "env:prod"},
+			expectedTopic: "analytics-prod",
+		},
+		{
+			testName:      "dash separated tag",
+			tags:          []string{"env-staging"},
+			expectedTopic: "analytics-staging",
+		},
+		{
+			testName:      "missing tag uses fallback topic",
+			tags:          []string{"key-abc"},
+			expectedTopic: "analytics-fallback",
+		},
+		{
+			testName:      "no tags uses fallback topic",
+			expectedTopic: "analytics-fallback",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expectedTopic, pmp.topicFor(analytics.AnalyticsRecord{Tags: tc.tags}))
+		})
+	}
+}
+
+func TestKafkaPump_LogTopics(t *testing.T) {
+	pmp := &KafkaPump{log: log.WithField("prefix", kafkaPrefix), topics: map[string]bool{}}
+	pmp.logTopics(map[string][]kafka.Message{"analytics-prod": nil, "analytics-staging": nil})
+	pmp.logTopics(map[string][]kafka.Message{"analytics-prod": nil})
+	assert.Equal(t, map[string]bool{"analytics-prod": true, "analytics-staging": true}, pmp.topics)
+
+	// the remembered topics are bounded
+	for i := 0; i < kafkaMaxLoggedTopics; i++ {
+		pmp.logTopics(map[string][]kafka.Message{fmt.Sprintf("analytics-%d", i): nil})
+	}
+	assert.Len(t, pmp.topics, kafkaMaxLoggedTopics)
+}
+
+func TestKafkaPump_TopicTemplateRecordFields(t *testing.T) {
+	pmp := &KafkaPump{}
+	err := pmp.Init(map[string]interface{}{
+		"broker":         []string{"localhost:9092"},
+		"topic":          "analytics",
+		"topic_template": `{{.OrgID}}`,
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "org1", pmp.topicFor(analytics.AnalyticsRecord{OrgID: "org1"}))
+	assert.Equal(t, "analytics", pmp.topicFor(analytics.AnalyticsRecord{}))
+}
+
+func TestKafkaPump_WithoutTopicTemplate(t *testing.T) {
+	pmp := &KafkaPump{}
+	err := pmp.Init(map[string]interface{}{
+		"broker": []string{"localhost:9092"},
+		"topic":  "analytics",
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "analytics", pmp.topicFor(analytics.AnalyticsRecord{Tags: []string{"env:prod"}}))
+}
+
+func TestKafkaPump_InvalidTopicTemplate(t *testing.T) {
+	pmp := &KafkaPump{}
+	err := pmp.Init(map[string]interface{}{
+		"broker":         []string{"localhost:9092"},
+		"topic":          "analytics",
+		"topic_template": `analytics-{{.Tags "env"`,
+	})
+	assert.NotNil(t, err)
+}
+
+func TestKafkaPump_Headers(t *testing.T) {
+	pmp := &KafkaPump{}
+	err := pmp.Init(map[string]interface{}{
+		"broker": []string{"localhost:9092"},
+		"topic":  "analytics",
+		"headers": map[string]interface{}{
+			"x-api-id":     "api_id",
+			"x-org-id":     "org_id",
+			"x-status":     "response_code",
+			"x-oauth-id":   "oauth_id",
+			"x-env":        "env",
+			"content-type": "content_type",
+		},
+		"meta_data": map[string]interface{}{
+			"env": "prod",
+		},
+	})
+	assert.Nil(t, err)
+
+	message := pmp.kafkaMessage(analytics.AnalyticsRecord{APIID: "api1", OrgID: "org1", ResponseCode: 200})
+
+	// the headers of empty fields, here oauth_id, aren't set
+	assert.Equal(t, []kafka.Header{
+		{Key: "content-type", Value: []byte("application/json")},
+		{Key: "x-api-id", Value: []byte("api1")},
+		{Key: "x-env", Value: []byte("prod")},
+		{Key: "x-org-id", Value: []byte("org1")},
+		{Key: "x-status", Value: []byte("200")},
+	}, message.Headers)
+	assert.Contains(t, string(message.Value), `"api_id":"api1"`)
+}
+
+func TestKafkaPump_WithoutHeaders(t *testing.T) {
+	pmp := &KafkaPump{}
+	err := pmp.Init(map[string]interface{}{
+		"broker": []string{"localhost:9092"},
+		"topic":  "analytics",
+	})
+	assert.Nil(t, err)
+
+	message := pmp.kafkaMessage(analytics.AnalyticsRecord{APIID: "api1"})
+	assert.Nil(t, message.Headers)
+}
+
+func TestKafkaPump_InvalidHeaders(t *testing.T) {
+	pmp := &KafkaPump{}
+	err := pmp.Init(map[string]interface{}{
+		"broker": []string{"localhost:9092"},
+		"topic":  "analytics",
+		"headers": map[string]interface{}{
+			"x-api-id": "apiid",
+		},
+	})
+	assert.EqualError(t, err, `header "x-api-id" is mapped to the unknown field "apiid"`)
+}
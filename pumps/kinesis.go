@@ -0,0 +1,256 @@
+package pumps
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/gofrs/uuid"
+	"github.com/mitchellh/mapstructure"
+)
+
+type KinesisPutRecordsAPI interface {
+	PutRecords(ctx context.Context, params *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error)
+}
+
+type KinesisPump struct {
+	client KinesisPutRecordsAPI
+	conf   *KinesisConf
+	CommonPumpConfig
+}
+
+const (
+	kinesisPrefix              = "kinesis-pump"
+	kinesisDefaultENV          = PUMPS_ENV_PREFIX + "_KINESIS" + PUMPS_ENV_META_PREFIX
+	kinesisDefaultRegion       = "us-east-1"
+	kinesisDefaultPartitionKey = "api_id"
+	// https://docs.aws.amazon.com/kinesis/latest/APIReference/API_PutRecords.html
+	kinesisMaxRecordsCount     = 500
+	kinesisMaxRequestSize      = 5 * 1024 * 1024
+	kinesisMaxRecordSize       = 1024 * 1024
+	kinesisMaxPartitionKeySize = 256
+)
+
+// @PumpConf Kinesis
+type KinesisConf struct {
+	EnvPrefix string `mapstructure:"meta_env_prefix"`
+	// The name of the Kinesis data stream the records are put to.
+	StreamName string `json:"stream_name" mapstructure:"stream_name"`
+	// The AWS region of the stream. Defaults to `us-east-1`.
+	AWSRegion string `json:"aws_region" mapstructure:"aws_region"`
+	// The access key ID of the static credentials. If not set, the default credential chain of the
+	// AWS SDK is used.
+	AccessKeyID string `json:"aws_access_key_id" mapstructure:"aws_access_key_id"`
+	// The secret access key of the static credentials.
+	SecretAccessKey string `json:"aws_secret_access_key" mapstructure:"aws_secret_access_key"`
+	// The session token of the static credentials, for temporary credentials.
+	SessionToken string `json:"aws_session_token" mapstructure:"aws_session_token"`
+	// Custom Kinesis endpoint, e.g. `http://localhost:4566` for LocalStack.
+	Endpoint string `json:"endpoint" mapstructure:"endpoint"`
+	// The JSON name of the record field used as the partition key of the records, e.g. `org_id`.
+	// The records with the same value go to the same shard. The records with an empty value get a
+	// random partition key. Defaults to `api_id`.
+	PartitionKey string `json:"partition_key" mapstructure:"partition_key"`
+}
+
+// KinesisRejectedRecord is a record of a batch the Kinesis API rejected.
+type KinesisRejectedRecord struct {
+	// The index of the record in the written batch.
+	Index        int
+	PartitionKey string
+	ErrorCode    string
+	ErrorMessage string
+}
+
+// KinesisRejectedRecordsError is returned by WriteData when the Kinesis API rejects some of the
+// records. The other records are written.
+type KinesisRejectedRecordsError struct {
+	Records []KinesisRejectedRecord
+	Total   int
+}
+
+func (e *KinesisRejectedRecordsError) Error() string {
+	first := e.Records[0]
+	return fmt.Sprintf("kinesis rejected %d of %d records, first: %s: %s", len(e.Records), e.Total, first.ErrorCode, first.ErrorMessage)
+}
+
+func (k *KinesisPump) New() Pump {
+	newPump := KinesisPump{}
+	return &newPump
+}
+
+func (k *KinesisPump) GetName() string {
+	return "Kinesis Pump"
+}
+
+func (k *KinesisPump) GetEnvPrefix() string {
+	return k.conf.EnvPrefix
+}
+
+func (k *KinesisPump) Init(conf interface{}) error {
+	k.conf = &KinesisConf{}
+	k.log = log.WithField("prefix", kinesisPrefix)
+
+	err := mapstructure.Decode(conf, &k.conf)
+	if err != nil {
+		k.log.Fatal("Failed to decode configuration: ", err)
+	}
+
+	processPumpEnvVars(k, k.log, k.conf, kinesisDefaultENV)
+
+	if k.conf.StreamName == "" {
+		return errors.New("missing \"stream_name\" in pump configuration")
+	}
+	if k.conf.AWSRegion == "" {
+		k.conf.AWSRegion = kinesisDefaultRegion
+	}
+	if k.conf.PartitionKey == "" {
+		k.conf.PartitionKey = kinesisDefaultPartitionKey
+	}
+	if !hasRecordField(k.conf.PartitionKey) {
+		return fmt.Errorf("invalid \"partition_key\" %q: not a field of the records", k.conf.PartitionKey)
+	}
+	if (k.conf.AccessKeyID == "") != (k.conf.SecretAccessKey == "") {
+		return errors.New("\"aws_access_key_id\" and \"aws_secret_access_key\" must be set together")
+	}
+
+	k.client, err = k.newKinesisClient()
+	if err != nil {
+		k.log.Error("Failed to create Kinesis client: ", err)
+		return err
+	}
+
+	k.log.Info(k.GetName() + " Initialized")
+	return nil
+}
+
+func (k *KinesisPump) newKinesisClient() (*kinesis.Client, error) {
+	opts := []func(*config.LoadOptions) error{config.WithRegion(k.conf.AWSRegion)}
+	if k.conf.AccessKeyID != "" {
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(k.conf.AccessKeyID, k.conf.SecretAccessKey, k.conf.SessionToken)))
+	}
+	cfg, err := config.LoadDefaultConfig(context.TODO(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return kinesis.NewFromConfig(cfg, func(o *kinesis.Options) {
+		if k.conf.Endpoint != "" {
+			o.EndpointResolver = kinesis.EndpointResolverFromURL(k.conf.Endpoint)
+		}
+	}), nil
+}
+
+// WriteData puts the records to the stream, with PutRecords requests of up to 500 records and
+// 5MB. The requests are all sent even if some records are rejected, which then are reported by a
+// KinesisRejectedRecordsError.
+func (k *KinesisPump) WriteData(ctx context.Context, data []interface{}) error {
+	k.log.Debug("Attempting to write ", len(data), " records...")
+
+	var entries []types.PutRecordsRequestEntry
+	// the indexes of the entries in data, to report the rejected records
+	var indexes []int
+	size := 0
+	rejected := &KinesisRejectedRecordsError{Total: len(data)}
+	for i, v := range data {
+		record, ok := v.(analytics.AnalyticsRecord)
+		if !ok {
+			k.log.Error("Error while writing ", v, ": data not of type analytics.AnalyticsRecord")
+			continue
+		}
+		entry, err := k.entry(&record)
+		if err != nil {
+			k.log.Error("Error encoding record: ", err)
+			continue
+		}
+		entrySize := len(entry.Data) + len(*entry.PartitionKey)
+		if entrySize > kinesisMaxRecordSize {
+			k.log.Warning("Dropping a record of ", entrySize, " bytes, over the 1MB limit of Kinesis")
+			continue
+		}
+
+		if len(entries) == kinesisMaxRecordsCount || size+entrySize > kinesisMaxRequestSize {
+			if err := k.putRecords(ctx, entries, indexes, rejected); err != nil {
+				return err
+			}
+			entries, indexes, size = nil, nil, 0
+		}
+		entries = append(entries, entry)
+		indexes = append(indexes, i)
+		size += entrySize
+	}
+	if len(entries) > 0 {
+		if err := k.putRecords(ctx, entries, indexes, rejected); err != nil {
+			return err
+		}
+	}
+
+	if len(rejected.Records) > 0 {
+		k.log.Error(rejected)
+		return rejected
+	}
+	k.log.Info("Purged ", len(data), " records...")
+	return nil
+}
+
+// putRecords sends a PutRecords request of entries, and adds the entries the API rejected to
+// rejected.
+func (k *KinesisPump) putRecords(ctx context.Context, entries []types.PutRecordsRequestEntry, indexes []int, rejected *KinesisRejectedRecordsError) error {
+	out, err := k.client.PutRecords(ctx, &kinesis.PutRecordsInput{
+		StreamName: aws.String(k.conf.StreamName),
+		Records:    entries,
+	})
+	if err != nil {
+		k.log.Error("Error writing data to Kinesis: ", err)
+		return err
+	}
+	if aws.ToInt32(out.FailedRecordCount) == 0 {
+		return nil
+	}
+
+	for i, result := range out.Records {
+		if result.ErrorCode == nil {
+			continue
+		}
+		rejectedRecord := KinesisRejectedRecord{
+			Index:        indexes[i],
+			PartitionKey: aws.ToString(entries[i].PartitionKey),
+			ErrorCode:    aws.ToString(result.ErrorCode),
+			ErrorMessage: aws.ToString(result.ErrorMessage),
+		}
+		k.log.WithField("partition_key", rejectedRecord.PartitionKey).
+			Debugf("Record %d rejected: %s: %s", rejectedRecord.Index, rejectedRecord.ErrorCode, rejectedRecord.ErrorMessage)
+		rejected.Records = append(rejected.Records, rejectedRecord)
+	}
+	return nil
+}
+
+// entry returns the PutRecords entry of record, its JSON encoding partitioned by the partition_key
+// field.
+func (k *KinesisPump) entry(record *analytics.AnalyticsRecord) (types.PutRecordsRequestEntry, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return types.PutRecordsRequestEntry{}, err
+	}
+
+	partitionKey := recordFieldValue(record, k.conf.PartitionKey)
+	if partitionKey == "" {
+		partitionKey = uuid.Must(uuid.NewV4()).String()
+	}
+	if len(partitionKey) > kinesisMaxPartitionKeySize {
+		partitionKey = strings.ToValidUTF8(partitionKey[:kinesisMaxPartitionKeySize], "")
+	}
+	return types.PutRecordsRequestEntry{
+		Data:         data,
+		PartitionKey: aws.String(partitionKey),
+	}, nil
+}
@@ -0,0 +1,177 @@
+package pumps
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockKinesis records the PutRecords requests, and rejects the records whose partition key is in
+// reject.
+type mockKinesis struct {
+	requests [][]types.PutRecordsRequestEntry
+	reject   map[string]bool
+	err      error
+}
+
+func (m *mockKinesis) PutRecords(ctx context.Context, params *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.requests = append(m.requests, params.Records)
+
+	out := &kinesis.PutRecordsOutput{FailedRecordCount: aws.Int32(0)}
+	for i, entry := range params.Records {
+		if m.reject[aws.ToString(entry.PartitionKey)] {
+			*out.FailedRecordCount++
+			out.Records = append(out.Records, types.PutRecordsResultEntry{
+				ErrorCode:    aws.String("ProvisionedThroughputExceededException"),
+				ErrorMessage: aws.String("Rate exceeded for shard shardId-000000000001"),
+			})
+			continue
+		}
+		out.Records = append(out.Records, types.PutRecordsResultEntry{
+			SequenceNumber: aws.String(strconv.Itoa(i)),
+			ShardId:        aws.String("shardId-000000000000"),
+		})
+	}
+	return out, nil
+}
+
+func newTestKinesisPump(t *testing.T, conf map[string]interface{}) (*KinesisPump, *mockKinesis) {
+	t.Helper()
+	conf["aws_access_key_id"] = "test"
+	conf["aws_secret_access_key"] = "test"
+	pmp := &KinesisPump{}
+	assert.Nil(t, pmp.Init(conf))
+
+	client := &mockKinesis{}
+	pmp.client = client
+	return pmp, client
+}
+
+func TestKinesisPumpWriteData(t *testing.T) {
+	pmp, client := newTestKinesisPump(t, map[string]interface{}{
+		"stream_name":   "analytics",
+		"partition_key": "org_id",
+	})
+
+	records := make([]interface{}, 1201)
+	for i := range records {
+		records[i] = analytics.AnalyticsRecord{APIID: "api" + strconv.Itoa(i), OrgID: "org" + strconv.Itoa(i%3)}
+	}
+	assert.Nil(t, pmp.WriteData(context.Background(), records))
+
+	// the records are put in chunks of 500, in order
+	assert.Len(t, client.requests, 3)
+	assert.Len(t, client.requests[0], 500)
+	assert.Len(t, client.requests[1], 500)
+	assert.Len(t, client.requests[2], 201)
+
+	entry := client.requests[1][0]
+	assert.Equal(t, "org2", aws.ToString(entry.PartitionKey))
+	decoded := analytics.AnalyticsRecord{}
+	assert.Nil(t, json.Unmarshal(entry.Data, &decoded))
+	assert.Equal(t, "api500", decoded.APIID)
+	assert.Equal(t, "org2", decoded.OrgID)
+}
+
+func TestKinesisPumpWriteDataPartitionKey(t *testing.T) {
+	pmp, client := newTestKinesisPump(t, map[string]interface{}{
+		"stream_name": "analytics",
+	})
+
+	records := []interface{}{
+		analytics.AnalyticsRecord{APIID: "api1"},
+		analytics.AnalyticsRecord{},
+	}
+	assert.Nil(t, pmp.WriteData(context.Background(), records))
+	assert.Len(t, client.requests, 1)
+	// api_id by default
+	assert.Equal(t, "api1", aws.ToString(client.requests[0][0].PartitionKey))
+	// random for the records without one
+	assert.Len(t, aws.ToString(client.requests[0][1].PartitionKey), 36)
+}
+
+func TestKinesisPumpWriteDataRejectedRecords(t *testing.T) {
+	pmp, client := newTestKinesisPump(t, map[string]interface{}{
+		"stream_name": "analytics",
+	})
+	client.reject = map[string]bool{"api3": true, "api700": true}
+
+	records := make([]interface{}, 800)
+	for i := range records {
+		records[i] = analytics.AnalyticsRecord{APIID: "api" + strconv.Itoa(i)}
+	}
+	err := pmp.WriteData(context.Background(), records)
+
+	// the other chunks are still put
+	assert.Len(t, client.requests, 2)
+	rejected := &KinesisRejectedRecordsError{}
+	assert.True(t, errors.As(err, &rejected))
+	assert.Equal(t, 800, rejected.Total)
+	assert.Equal(t, []KinesisRejectedRecord{
+		{
+			Index:        3,
+			PartitionKey: "api3",
+			ErrorCode:    "ProvisionedThroughputExceededException",
+			ErrorMessage: "Rate exceeded for shard shardId-000000000001",
+		},
+		{
+			Index:        700,
+			PartitionKey: "api700",
+			ErrorCode:    "ProvisionedThroughputExceededException",
+			ErrorMessage: "Rate exceeded for shard shardId-000000000001",
+		},
+	}, rejected.Records)
+	assert.Equal(t, "kinesis rejected 2 of 800 records, first: ProvisionedThroughputExceededException: Rate exceeded for shard shardId-000000000001", err.Error())
+}
+
+func TestKinesisPumpWriteDataError(t *testing.T) {
+	pmp, client := newTestKinesisPump(t, map[string]interface{}{
+		"stream_name": "analytics",
+	})
+	client.err = errors.New("stream not found")
+
+	err := pmp.WriteData(context.Background(), []interface{}{analytics.AnalyticsRecord{APIID: "api1"}})
+	assert.EqualError(t, err, "stream not found")
+}
+
+func TestKinesisPumpInitInvalid(t *testing.T) {
+	tcs := []struct {
+		testName string
+		conf     map[string]interface{}
+		expected string
+	}{
+		{
+			testName: "missing stream name",
+			conf:     map[string]interface{}{},
+			expected: "missing \"stream_name\" in pump configuration",
+		},
+		{
+			testName: "unknown partition key",
+			conf:     map[string]interface{}{"stream_name": "analytics", "partition_key": "unknown"},
+			expected: "invalid \"partition_key\" \"unknown\": not a field of the records",
+		},
+		{
+			testName: "partial credentials",
+			conf:     map[string]interface{}{"stream_name": "analytics", "aws_access_key_id": "test"},
+			expected: "\"aws_access_key_id\" and \"aws_secret_access_key\" must be set together",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			pmp := &KinesisPump{}
+			assert.EqualError(t, pmp.Init(tc.conf), tc.expected)
+		})
+	}
+}
@@ -5,6 +5,8 @@ package pumps
 import (
 	"context"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/TykTechnologies/storage/persistent"
 	"github.com/TykTechnologies/storage/persistent/model"
@@ -144,3 +146,27 @@ func defaultSelectiveConf() MongoSelectiveConf {
 
 	return conf
 }
+
+// fakeStore is an in-memory persistent storage used to test the mongo pumps without a
+// running database. Only the methods used by the tests are implemented.
+type fakeStore struct {
+	persistent.PersistentStorage
+
+	mu          sync.Mutex
+	inserted    []model.DBObject
+	insertDelay time.Duration
+}
+
+func (f *fakeStore) Insert(ctx context.Context, rows ...model.DBObject) error {
+	time.Sleep(f.insertDelay)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inserted = append(f.inserted, rows...)
+	return nil
+}
+
+func (f *fakeStore) insertedCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.inserted)
+}
@@ -67,6 +67,15 @@ type MoesifConf struct {
 	UserIDHeader string `json:"user_id_header" mapstructure:"user_id_header"`
 	// An optional field name to identify Company (Account) from a request or response header.
 	CompanyIDHeader string `json:"company_id_header" mapstructure:"company_id_header"`
+	// An optional record field, by its JSON name, used as the Moesif User Id when the
+	// `user_id_header` isn't set or found. For example `api_key`. A value prefixed with `tag:` uses
+	// the value of a `key:value` or `key-value` tag of the record instead, e.g. `tag:user` for the
+	// tag `user-123`. The alias, the OAuth id and the authorization header are used otherwise.
+	UserIDField string `json:"user_id_field" mapstructure:"user_id_field"`
+	// An optional record field, by its JSON name, used as the Moesif Company Id when the
+	// `company_id_header` isn't set or found. For example `org_id`. As for `user_id_field`, a
+	// value prefixed with `tag:` uses a tag of the record instead.
+	CompanyIDField string `json:"company_id_field" mapstructure:"company_id_field"`
 	// Set this to `true` to enable `bulk_config`.
 	EnableBulk bool `json:"enable_bulk" mapstructure:"enable_bulk"`
 	// Batch writing trigger configuration.
@@ -162,6 +171,30 @@ func (p *MoesifPump) getSamplingPercentage(userID string, companyID string) int
 	return 100
 }
 
+// moesifTagPrefix is the prefix of the identifier fields naming a tag of the record.
+const moesifTagPrefix = "tag:"
+
+// validIDField reports whether field names a record field or a tag.
+func validIDField(field string) bool {
+	if strings.HasPrefix(field, moesifTagPrefix) {
+		return len(field) > len(moesifTagPrefix)
+	}
+	return hasRecordField(field)
+}
+
+// fetchIDFromRecord returns the value of the record field or tag named by field, or "" if it's
+// not set.
+func fetchIDFromRecord(record *analytics.AnalyticsRecord, field string) string {
+	if field == "" {
+		return ""
+	}
+	if strings.HasPrefix(field, moesifTagPrefix) {
+		value, _ := record.TagValue(strings.TrimPrefix(field, moesifTagPrefix))
+		return value
+	}
+	return recordFieldValue(record, field)
+}
+
 func fetchIDFromHeader(requestHeaders map[string]interface{}, responseHeaders map[string]interface{}, headerName string) string {
 	var id string
 	if requid, ok := requestHeaders[strings.ToLower(headerName)].(string); ok {
@@ -268,6 +301,12 @@ func (p *MoesifPump) Init(config interface{}) error {
 
 	processPumpEnvVars(p, p.log, p.moesifConf, moesifDefaultENV)
 
+	for _, field := range []string{p.moesifConf.UserIDField, p.moesifConf.CompanyIDField} {
+		if field != "" && !validIDField(field) {
+			return fmt.Errorf("invalid identifier field %q: it must be the JSON name of a record field, or a tag prefixed with %q", field, moesifTagPrefix)
+		}
+	}
+
 	var apiEndpoint string
 	var batchSize int
 	var eventQueueSize int
@@ -398,6 +437,10 @@ func (p *MoesifPump) WriteData(ctx context.Context, data []interface{}) error {
 			userID = fetchIDFromHeader(decodedReqBody.headers, decodedRspBody.headers, p.moesifConf.UserIDHeader)
 		}
 
+		if userID == "" {
+			userID = fetchIDFromRecord(&record, p.moesifConf.UserIDField)
+		}
+
 		if userID == "" {
 			if record.Alias != "" {
 				userID = record.Alias
@@ -450,6 +493,9 @@ func (p *MoesifPump) WriteData(ctx context.Context, data []interface{}) error {
 		if p.moesifConf.CompanyIDHeader != "" {
 			companyID = fetchIDFromHeader(decodedReqBody.headers, decodedRspBody.headers, p.moesifConf.CompanyIDHeader)
 		}
+		if companyID == "" {
+			companyID = fetchIDFromRecord(&record, p.moesifConf.CompanyIDField)
+		}
 
 		// Generate random percentage
 		rand.Seed(time.Now().UnixNano())
@@ -0,0 +1,92 @@
+package pumps
+
+import (
+	"context"
+	"testing"
+
+	"github.com/moesif/moesifapi-go"
+	"github.com/moesif/moesifapi-go/models"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+// fakeMoesifAPI keeps the queued events.
+type fakeMoesifAPI struct {
+	moesifapi.API
+	events []*models.EventModel
+}
+
+func (f *fakeMoesifAPI) QueueEvent(event *models.EventModel) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+func (f *fakeMoesifAPI) GetETag() string {
+	return ""
+}
+
+func TestMoesifPumpIdentifiers(t *testing.T) {
+	record := analytics.AnalyticsRecord{
+		APIKey: "key1",
+		OrgID:  "org1",
+		Alias:  "alias1",
+		Tags:   []string{"user-123", "company:acme"},
+	}
+
+	tcs := []struct {
+		testName          string
+		conf              MoesifConf
+		expectedUserID    string
+		expectedCompanyID string
+	}{
+		{
+			testName:          "record fields",
+			conf:              MoesifConf{UserIDField: "api_key", CompanyIDField: "org_id"},
+			expectedUserID:    "key1",
+			expectedCompanyID: "org1",
+		},
+		{
+			testName:          "tags",
+			conf:              MoesifConf{UserIDField: "tag:user", CompanyIDField: "tag:company"},
+			expectedUserID:    "123",
+			expectedCompanyID: "acme",
+		},
+		{
+			testName:          "missing tag",
+			conf:              MoesifConf{UserIDField: "tag:missing", CompanyIDField: "tag:missing"},
+			expectedUserID:    "alias1",
+			expectedCompanyID: "",
+		},
+		{
+			testName:          "no mapping",
+			conf:              MoesifConf{},
+			expectedUserID:    "alias1",
+			expectedCompanyID: "",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			api := &fakeMoesifAPI{}
+			conf := tc.conf
+			pmp := &MoesifPump{moesifAPI: api, moesifConf: &conf, samplingPercentage: 100}
+			pmp.log = log.WithField("prefix", moesifPrefix)
+
+			err := pmp.WriteData(context.Background(), []interface{}{record})
+			assert.Nil(t, err)
+			assert.Len(t, api.events, 1)
+			assert.Equal(t, tc.expectedUserID, *api.events[0].UserId)
+			assert.Equal(t, tc.expectedCompanyID, *api.events[0].CompanyId)
+		})
+	}
+}
+
+func TestMoesifPumpInvalidIdentifierField(t *testing.T) {
+	pmp := &MoesifPump{}
+	err := pmp.Init(map[string]interface{}{"user_id_field": "APIKey"})
+	assert.ErrorContains(t, err, `invalid identifier field "APIKey"`)
+
+	err = pmp.Init(map[string]interface{}{"company_id_field": "tag:"})
+	assert.ErrorContains(t, err, `invalid identifier field "tag:"`)
+}
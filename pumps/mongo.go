@@ -10,6 +10,9 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/TykTechnologies/storage/persistent"
 	"github.com/TykTechnologies/storage/persistent/model"
@@ -17,6 +20,7 @@ import (
 	"github.com/kelseyhightower/envconfig"
 	"github.com/mitchellh/mapstructure"
 	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
 
 	"gopkg.in/vmihailenco/msgpack.v2"
 )
@@ -33,6 +37,16 @@ type MongoPump struct {
 	IsUptime bool
 	store    persistent.PersistentStorage
 	dbConf   *MongoConf
+	// asyncQueue holds the batches waiting to be written when async_writes is enabled.
+	asyncQueue     chan []interface{}
+	asyncWorkers   sync.WaitGroup
+	asyncCloseOnce sync.Once
+	// rotatedCollections holds the rotated collections whose indexes were already ensured.
+	rotatedCollections sync.Map
+	janitorStop        chan struct{}
+	janitorDone        chan struct{}
+	// aggregatePump stores the aggregations of the records when enable_aggregation is set.
+	aggregatePump *MongoAggregatePump
 	CommonPumpConfig
 }
 
@@ -55,6 +69,14 @@ const (
 	CosmosDBError = 115
 )
 
+const (
+	DailyCollectionRotation   = "daily"
+	MonthlyCollectionRotation = "monthly"
+
+	mongoDailyCollectionLayout   = "2006_01_02"
+	mongoMonthlyCollectionLayout = "2006_01"
+)
+
 type BaseMongoConf struct {
 	EnvPrefix string `mapstructure:"meta_env_prefix"`
 	// The full URL to your MongoDB instance, this can be a clustered instance if necessary and
@@ -139,6 +161,38 @@ type MongoConf struct {
 	CollectionCapMaxSizeBytes int `json:"collection_cap_max_size_bytes" mapstructure:"collection_cap_max_size_bytes"`
 	// Enable collection capping. It's used to set a maximum size of the collection.
 	CollectionCapEnable bool `json:"collection_cap_enable" mapstructure:"collection_cap_enable"`
+	// Maximum number of documents of the capped collection, on top of its maximum size. The oldest
+	// documents are removed when either is reached. Defaults to 0, which only limits the size.
+	CollectionCapMaxDocs int `json:"collection_cap_max_docs" mapstructure:"collection_cap_max_docs"`
+	// Set to true to write the records asynchronously. Each batch is queued and inserted by a
+	// background worker, so the purge loop isn't blocked by the insert. When the queue is full,
+	// writes block until there's room again. Defaults to `false`.
+	AsyncWrites bool `json:"async_writes" mapstructure:"async_writes"`
+	// Maximum number of batches waiting to be written when `async_writes` is enabled. Defaults
+	// to 10.
+	AsyncQueueSize int `json:"async_queue_size" mapstructure:"async_queue_size"`
+	// Writes the records into time-rolled collections, suffixed with the date of their timestamp.
+	// The valid values are: `daily` (e.g. `tyk_analytics_2024_06_30`) and `monthly` (e.g.
+	// `tyk_analytics_2024_06`). Collection capping isn't applied to the rotated collections.
+	// Defaults to no rotation.
+	CollectionRotation string `json:"collection_rotation" mapstructure:"collection_rotation"`
+	// Number of days the rotated collections are kept. A background janitor drops the rotated
+	// collections whose whole period is older than this. Defaults to 0, which disables the janitor.
+	CollectionRetentionDays int `json:"collection_retention_days" mapstructure:"collection_retention_days"`
+	// Interval in seconds between the runs of the janitor. Defaults to 3600.
+	CollectionJanitorInterval int `json:"collection_janitor_interval" mapstructure:"collection_janitor_interval"`
+	// Set to true to omit the empty fields of the documents: the empty strings, the zero numbers
+	// and booleans, the zero timestamps and the empty lists and embedded documents. This shrinks
+	// the documents of the records which don't have all of the fields. Defaults to `false`.
+	OmitEmptyFields bool `json:"omit_empty_fields" mapstructure:"omit_empty_fields"`
+	// Set to true to also store the aggregations of the records, as the `mongo-pump-aggregate`
+	// pump does, in the same pass over each batch. This avoids configuring a separate aggregate
+	// pump for the same Mongo. Defaults to `false`.
+	EnableAggregation bool `json:"enable_aggregation" mapstructure:"enable_aggregation"`
+	// The configuration of the aggregations stored when `enable_aggregation` is set, with the
+	// same options as the `mongo-pump-aggregate` pump. The connection options are taken from
+	// this pump, so they don't need to be set.
+	Aggregation MongoAggregateConf `json:"aggregation" mapstructure:"aggregation"`
 }
 
 func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
@@ -233,13 +287,39 @@ func (m *MongoPump) Init(config interface{}) error {
 		m.dbConf.MaxDocumentSizeBytes = 10 * MiB
 	}
 
-	m.connect()
+	switch m.dbConf.CollectionRotation {
+	case "", DailyCollectionRotation, MonthlyCollectionRotation:
+	default:
+		return fmt.Errorf("invalid collection_rotation %q, the valid values are: %s, %s", m.dbConf.CollectionRotation, DailyCollectionRotation, MonthlyCollectionRotation)
+	}
 
-	m.capCollection()
+	if err := m.connect(); err != nil {
+		return err
+	}
+
+	if m.dbConf.CollectionRotation == "" {
+		m.capCollection()
+	} else if m.dbConf.CollectionCapEnable {
+		m.log.Warn("Collection capping isn't applied to rotated collections. Ignoring")
+	}
 
-	indexCreateErr := m.ensureIndexes(m.dbConf.CollectionName)
-	if indexCreateErr != nil {
-		m.log.Error(indexCreateErr)
+	if m.dbConf.AsyncWrites {
+		m.startAsyncWriter()
+	}
+
+	if m.dbConf.EnableAggregation && !m.IsUptime {
+		if err := m.initAggregation(); err != nil {
+			return err
+		}
+	}
+
+	if m.dbConf.CollectionRotation == "" {
+		indexCreateErr := m.ensureIndexes(m.dbConf.CollectionName)
+		if indexCreateErr != nil {
+			m.log.Error(indexCreateErr)
+		}
+	} else if m.dbConf.CollectionRetentionDays > 0 {
+		m.startJanitor()
 	}
 
 	m.log.Debug("MongoDB DB CS: ", m.dbConf.GetBlurredURL())
@@ -266,12 +346,6 @@ func (m *MongoPump) capCollection() (ok bool) {
 		return false
 	}
 
-	if exists {
-		m.log.Warnf("Collection (%s) already exists. Capping could result in data loss. Ignoring", colName)
-
-		return false
-	}
-
 	if strconv.IntSize < 64 {
 		m.log.Warn("Pump running < 64bit architecture. Not capping collection as max size would be 2gb")
 
@@ -289,7 +363,15 @@ func (m *MongoPump) capCollection() (ok bool) {
 		tableName: colName,
 	}
 
-	err = m.store.Migrate(context.Background(), []model.DBObject{d}, model.DBM{"capped": true, "maxBytes": colCapMaxSizeBytes})
+	if exists {
+		return m.checkCappedCollection(d, colCapMaxSizeBytes)
+	}
+
+	opts := model.DBM{"capped": true, "maxBytes": colCapMaxSizeBytes}
+	if m.dbConf.CollectionCapMaxDocs > 0 {
+		opts["maxDocs"] = m.dbConf.CollectionCapMaxDocs
+	}
+	err = m.store.Migrate(context.Background(), []model.DBObject{d}, opts)
 	if err != nil {
 		m.log.Errorf("Unable to create capped collection for (%s). %s", colName, err.Error())
 
@@ -301,6 +383,52 @@ func (m *MongoPump) capCollection() (ok bool) {
 	return true
 }
 
+// checkCappedCollection reports whether the existing collection is capped with maxSizeBytes and
+// the configured maximum number of documents. It isn't altered either way, as capping an existing
+// collection could result in data loss.
+func (m *MongoPump) checkCappedCollection(d dbObject, maxSizeBytes int) bool {
+	stats, err := m.store.DBTableStats(context.Background(), d)
+	if err != nil {
+		m.log.Errorf("Unable to check if collection (%s) is capped: %s", d.tableName, err.Error())
+
+		return false
+	}
+
+	if capped, _ := stats["capped"].(bool); !capped {
+		m.log.Warnf("Collection (%s) already exists. Capping could result in data loss. Ignoring", d.tableName)
+
+		return false
+	}
+
+	size, docs := dbmInt(stats["maxSize"]), dbmInt(stats["max"])
+	if size != int64(maxSizeBytes) || (m.dbConf.CollectionCapMaxDocs > 0 && docs != int64(m.dbConf.CollectionCapMaxDocs)) {
+		m.log.Warnf("Collection (%s) is already capped to %d bytes and %d documents, instead of %d bytes and %d documents. Ignoring",
+			d.tableName, size, docs, maxSizeBytes, m.dbConf.CollectionCapMaxDocs)
+
+		return false
+	}
+
+	m.log.Infof("Collection (%s) is already capped. %d bytes", d.tableName, size)
+
+	return true
+}
+
+// dbmInt returns the integer value of a number of a DBM, which may be of any integer type.
+func dbmInt(value interface{}) int64 {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	default:
+		return 0
+	}
+}
+
 // collectionExists checks to see if a collection name exists in the db.
 func (m *MongoPump) collectionExists(name string) (bool, error) {
 	return m.store.HasTable(context.Background(), name)
@@ -352,7 +480,7 @@ func (m *MongoPump) ensureIndexes(collectionName string) error {
 	return m.store.CreateIndex(context.Background(), d, logBrowserIndex)
 }
 
-func (m *MongoPump) connect() {
+func (m *MongoPump) connect() error {
 	if m.dbConf.MongoDriverType == "" {
 		// Default to mgo
 		m.dbConf.MongoDriverType = persistent.Mgo
@@ -371,13 +499,209 @@ func (m *MongoPump) connect() {
 		DirectConnection:         m.dbConf.MongoDirectConnection,
 	})
 	if err != nil {
-		m.log.Fatal("Failed to connect: ", err)
+		m.log.Error("Failed to connect: ", err)
+		return err
 	}
 
 	m.store = store
+	return nil
 }
 
 func (m *MongoPump) WriteData(ctx context.Context, data []interface{}) error {
+	var err error
+	if m.asyncQueue != nil {
+		err = m.enqueue(ctx, data)
+	} else {
+		err = m.writeData(ctx, data)
+	}
+	if err != nil || m.aggregatePump == nil {
+		return err
+	}
+	return m.aggregatePump.WriteData(ctx, data)
+}
+
+// initAggregation sets up the aggregate pump storing the aggregations of the records, sharing
+// the connection of this pump.
+func (m *MongoPump) initAggregation() error {
+	aggregationConf := m.dbConf.Aggregation
+	aggregationConf.BaseMongoConf = m.dbConf.BaseMongoConf
+
+	aggregatePump := &MongoAggregatePump{}
+	if err := aggregatePump.initWithStore(&aggregationConf, m.store); err != nil {
+		return err
+	}
+	m.aggregatePump = aggregatePump
+	m.log.Info("Aggregation enabled")
+	return nil
+}
+
+func (m *MongoPump) startAsyncWriter() {
+	if m.dbConf.AsyncQueueSize <= 0 {
+		m.log.Info("-- No async queue size set, defaulting to 10")
+		m.dbConf.AsyncQueueSize = 10
+	}
+	m.asyncQueue = make(chan []interface{}, m.dbConf.AsyncQueueSize)
+
+	m.asyncWorkers.Add(1)
+	go func() {
+		defer m.asyncWorkers.Done()
+		for data := range m.asyncQueue {
+			if err := m.writeData(context.Background(), data); err != nil {
+				m.log.Error("Problem writing queued records: ", err)
+			}
+		}
+	}()
+}
+
+// enqueue adds the batch to the async queue, blocking while the queue is full.
+func (m *MongoPump) enqueue(ctx context.Context, data []interface{}) error {
+	select {
+	case m.asyncQueue <- data:
+		m.log.Debug("Queued ", len(data), " records")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown stops the janitor and waits until all the queued batches are written.
+func (m *MongoPump) Shutdown() error {
+	if m.janitorStop != nil {
+		close(m.janitorStop)
+		<-m.janitorDone
+		m.janitorStop = nil
+	}
+	if m.asyncQueue == nil {
+		return nil
+	}
+	m.asyncCloseOnce.Do(func() {
+		m.log.Info("Draining ", len(m.asyncQueue), " queued batches...")
+		close(m.asyncQueue)
+	})
+	m.asyncWorkers.Wait()
+	return nil
+}
+
+// rotatedCollectionLayout returns the time layout of the suffix of the rotated collections, or
+// an empty string if the collections aren't rotated.
+func (m *MongoPump) rotatedCollectionLayout() string {
+	switch m.dbConf.CollectionRotation {
+	case DailyCollectionRotation:
+		return mongoDailyCollectionLayout
+	case MonthlyCollectionRotation:
+		return mongoMonthlyCollectionLayout
+	default:
+		return ""
+	}
+}
+
+// collectionNameFor returns the collection the records with timestamp are written to.
+func (m *MongoPump) collectionNameFor(timestamp time.Time) string {
+	layout := m.rotatedCollectionLayout()
+	if layout == "" {
+		return m.dbConf.CollectionName
+	}
+	return m.dbConf.CollectionName + "_" + timestamp.UTC().Format(layout)
+}
+
+// ensureRotatedCollection creates the indexes of a rotated collection the first time it's
+// written to.
+func (m *MongoPump) ensureRotatedCollection(collectionName string) {
+	if _, loaded := m.rotatedCollections.LoadOrStore(collectionName, struct{}{}); loaded {
+		return
+	}
+	if err := m.ensureIndexes(collectionName); err != nil {
+		m.log.Error(err)
+	}
+}
+
+// splitByCollection splits dataSet into consecutive sets of records of the same collection, as
+// each insert targets a single collection.
+func splitByCollection(dataSet []model.DBObject) [][]model.DBObject {
+	var sets [][]model.DBObject
+	for i, obj := range dataSet {
+		if i == 0 || obj.TableName() != dataSet[i-1].TableName() {
+			sets = append(sets, []model.DBObject{})
+		}
+		sets[len(sets)-1] = append(sets[len(sets)-1], obj)
+	}
+	return sets
+}
+
+func (m *MongoPump) startJanitor() {
+	interval := m.dbConf.CollectionJanitorInterval
+	if interval <= 0 {
+		m.log.Info("-- No collection janitor interval set, defaulting to 3600s")
+		interval = 3600
+		m.dbConf.CollectionJanitorInterval = interval
+	}
+
+	m.janitorStop = make(chan struct{})
+	m.janitorDone = make(chan struct{})
+	go func() {
+		defer close(m.janitorDone)
+
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			m.dropExpiredCollections(time.Now())
+			select {
+			case <-ticker.C:
+			case <-m.janitorStop:
+				return
+			}
+		}
+	}()
+}
+
+// dropExpiredCollections drops the rotated collections whose whole period ended more than the
+// retention days before now. It returns the dropped collections.
+func (m *MongoPump) dropExpiredCollections(now time.Time) []string {
+	layout := m.rotatedCollectionLayout()
+	if layout == "" || m.dbConf.CollectionRetentionDays <= 0 {
+		return nil
+	}
+
+	collections, err := m.store.GetTables(context.Background())
+	if err != nil {
+		m.log.Error("Unable to list the collections to drop: ", err)
+		return nil
+	}
+
+	cutoff := now.UTC().AddDate(0, 0, -m.dbConf.CollectionRetentionDays)
+	prefix := m.dbConf.CollectionName + "_"
+
+	var dropped []string
+	for _, collection := range collections {
+		suffix := strings.TrimPrefix(collection, prefix)
+		if suffix == collection || len(suffix) != len(layout) {
+			continue
+		}
+		periodStart, err := time.Parse(layout, suffix)
+		if err != nil {
+			continue
+		}
+
+		periodEnd := periodStart.AddDate(0, 1, 0)
+		if layout == mongoDailyCollectionLayout {
+			periodEnd = periodStart.AddDate(0, 0, 1)
+		}
+		if periodEnd.After(cutoff) {
+			continue
+		}
+
+		if _, err := m.store.DropTable(context.Background(), collection); err != nil {
+			m.log.Errorf("Unable to drop expired collection (%s): %s", collection, err)
+			continue
+		}
+		m.rotatedCollections.Delete(collection)
+		m.log.Info("Dropped expired collection ", collection)
+		dropped = append(dropped, collection)
+	}
+	return dropped
+}
+
+func (m *MongoPump) writeData(ctx context.Context, data []interface{}) error {
 	collectionName := m.dbConf.CollectionName
 	if collectionName == "" {
 		m.log.Fatal("No collection name!")
@@ -386,10 +710,29 @@ func (m *MongoPump) WriteData(ctx context.Context, data []interface{}) error {
 	m.log.Debug("Attempting to write ", len(data), " records...")
 
 	accumulateSet := m.AccumulateSet(data, false)
+	if m.dbConf.CollectionRotation != "" {
+		var rotatedSet [][]model.DBObject
+		for _, dataSet := range accumulateSet {
+			for _, collectionSet := range splitByCollection(dataSet) {
+				m.ensureRotatedCollection(collectionSet[0].TableName())
+				rotatedSet = append(rotatedSet, collectionSet)
+			}
+		}
+		accumulateSet = rotatedSet
+	}
+	if m.dbConf.OmitEmptyFields {
+		for _, dataSet := range accumulateSet {
+			for i := range dataSet {
+				dataSet[i] = omitEmptyRecord{dataSet[i].(*analytics.AnalyticsRecord)}
+			}
+		}
+	}
 
 	errCh := make(chan error, len(accumulateSet))
 	for _, dataSet := range accumulateSet {
-		go func(errCh chan error, dataSet ...model.DBObject) {
+		dataSet := dataSet
+		Go(func() {
+			collectionName := dataSet[0].TableName()
 			m.log.WithFields(logrus.Fields{
 				"collection":        collectionName,
 				"number of records": len(dataSet),
@@ -399,13 +742,14 @@ func (m *MongoPump) WriteData(ctx context.Context, data []interface{}) error {
 			if err != nil {
 				m.log.WithFields(logrus.Fields{"collection": collectionName, "number of records": len(dataSet)}).Error("Problem inserting to mongo collection: ", err)
 				errCh <- err
+				return
 			}
 			errCh <- nil
 			m.log.WithFields(logrus.Fields{
 				"collection":        collectionName,
 				"number of records": len(dataSet),
 			}).Info("Completed purging the records")
-		}(errCh, dataSet...)
+		})
 	}
 
 	for range accumulateSet {
@@ -421,6 +765,21 @@ func (m *MongoPump) WriteData(ctx context.Context, data []interface{}) error {
 	return nil
 }
 
+// omitEmptyRecord is a record written without its empty fields, with both Mongo drivers.
+type omitEmptyRecord struct {
+	*analytics.AnalyticsRecord
+}
+
+// GetBSON returns the document of the record for the mgo driver.
+func (r omitEmptyRecord) GetBSON() (interface{}, error) {
+	return r.NonEmptyFields(), nil
+}
+
+// MarshalBSON returns the document of the record for the mongo-go driver.
+func (r omitEmptyRecord) MarshalBSON() ([]byte, error) {
+	return bson.Marshal(r.NonEmptyFields())
+}
+
 // AccumulateSet groups data items into chunks based on the max batch size limit while handling graph analytics records separately.
 // It returns a 2D array of DBObjects.
 func (m *MongoPump) AccumulateSet(data []interface{}, isForGraphRecords bool) [][]model.DBObject {
@@ -436,7 +795,7 @@ func (m *MongoPump) AccumulateSet(data []interface{}, isForGraphRecords bool) []
 		}
 
 		// If collection name is not set, we'll use the default one
-		thisItem.CollectionName = m.dbConf.CollectionName
+		thisItem.CollectionName = m.collectionNameFor(thisItem.TimeStamp)
 
 		// Calculate the size of the current item
 		sizeBytes := m.getItemSizeBytes(thisItem)
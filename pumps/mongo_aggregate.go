@@ -61,9 +61,25 @@ type MongoAggregateConf struct {
 	// It also divide by 2 the AggregationTime field to avoid the same error in the future.
 	EnableAggregateSelfHealing bool `json:"enable_aggregate_self_healing" mapstructure:"enable_aggregate_self_healing"`
 	// This list determines which aggregations are going to be dropped and not stored in the collection.
-	// Posible values are: "APIID","errors","versions","apikeys","oauthids","geo","tags","endpoints","keyendpoints",
+	// Posible values are: "APIID","errors","versions","apikeys","oauthids","geo","nodeids","tags","endpoints","keyendpoints",
 	// "oauthendpoints", and "apiendpoints".
 	IgnoreAggregationsList []string `json:"ignore_aggregations" mapstructure:"ignore_aggregations"`
+	// Determines if the approximate p50, p95 and p99 latencies are stored in every aggregation, as
+	// `latencyp50`, `latencyp95` and `latencyp99`. A t-digest of the latencies is stored alongside
+	// (`latencydigest`) so the percentiles are merged correctly across partial updates of the same
+	// aggregation, which increases the size of the documents. Defaults to `false`.
+	StoreLatencyPercentiles bool `json:"store_latency_percentiles" mapstructure:"store_latency_percentiles"`
+	// Determines the number of leading error sources stored in every aggregation, as `toperrors`:
+	// the response code, API ID, path and count of the most frequent errors. Only that many are
+	// stored, so the counts of the sources dropping out of the top and coming back later are
+	// approximate. Defaults to 0, which disables them.
+	TopErrors int `json:"top_errors" mapstructure:"top_errors"`
+	// The counters of the aggregations are always incremented, so the updates of concurrent pumps
+	// writing the same aggregation add up. This map sets how the other fields are merged, keyed by
+	// field name. The fields are "lasttime", "identifier" and "humanidentifier", and the strategies are
+	// "set" (the last update is kept, the default), "max" and "min". For example,
+	// `{"lasttime": "max"}` keeps the latest time whichever pump writes last.
+	MergeStrategies map[string]string `json:"merge_strategies" mapstructure:"merge_strategies"`
 }
 
 func (m *MongoAggregatePump) New() Pump {
@@ -189,16 +205,48 @@ func (m *MongoAggregatePump) Init(config interface{}) error {
 		m.log.Error("Failed to process environment variables for mongo aggregate pump: ", overrideErr)
 	}
 
-	if m.dbConf.ThresholdLenTagList == 0 {
-		m.dbConf.ThresholdLenTagList = ThresholdLenTagList
+	if err := analytics.ValidateMergeStrategies(m.dbConf.MergeStrategies); err != nil {
+		return err
 	}
-	m.SetAggregationTime()
 
-	m.connect()
+	m.setDefaults()
+
+	if err := m.connect(); err != nil {
+		return err
+	}
 
 	m.log.Debug("MongoDB DB CS: ", m.dbConf.GetBlurredURL())
 	m.log.Info(m.GetName() + " Initialized")
 
+	m.loadLastDocumentTimestamp()
+
+	return nil
+}
+
+// initWithStore initialises the pump with conf, writing through an already connected store.
+// It's used by the mongo pump to store the aggregations of its records.
+func (m *MongoAggregatePump) initWithStore(conf *MongoAggregateConf, store persistent.PersistentStorage) error {
+	m.dbConf = conf
+	m.store = store
+	m.log = log.WithField("prefix", analytics.MongoAggregatePrefix)
+
+	if err := analytics.ValidateMergeStrategies(m.dbConf.MergeStrategies); err != nil {
+		return err
+	}
+
+	m.setDefaults()
+	m.loadLastDocumentTimestamp()
+	return nil
+}
+
+func (m *MongoAggregatePump) setDefaults() {
+	if m.dbConf.ThresholdLenTagList == 0 {
+		m.dbConf.ThresholdLenTagList = ThresholdLenTagList
+	}
+	m.SetAggregationTime()
+}
+
+func (m *MongoAggregatePump) loadLastDocumentTimestamp() {
 	// look for the last record timestamp stored in the collection
 	lastTimestampAgggregateRecord, err := m.getLastDocumentTimestamp()
 
@@ -208,11 +256,9 @@ func (m *MongoAggregatePump) Init(config interface{}) error {
 	} else {
 		analytics.SetlastTimestampAgggregateRecord(m.dbConf.MongoURL, lastTimestampAgggregateRecord)
 	}
-
-	return nil
 }
 
-func (m *MongoAggregatePump) connect() {
+func (m *MongoAggregatePump) connect() error {
 	var err error
 
 	if m.dbConf.MongoDriverType == "" {
@@ -233,8 +279,9 @@ func (m *MongoAggregatePump) connect() {
 		DirectConnection:         m.dbConf.MongoDirectConnection,
 	})
 	if err != nil {
-		m.log.Fatal("Failed to connect to mongo: ", err)
+		m.log.Error("Failed to connect to mongo: ", err)
 	}
+	return err
 }
 
 func (m *MongoAggregatePump) ensureIndexes(collectionName string) error {
@@ -289,7 +336,10 @@ func (m *MongoAggregatePump) ensureIndexes(collectionName string) error {
 func (m *MongoAggregatePump) WriteData(ctx context.Context, data []interface{}) error {
 	m.log.Debug("Attempting to write ", len(data), " records")
 	// calculate aggregates
-	analyticsPerOrg := analytics.AggregateData(data, m.dbConf.TrackAllPaths, m.dbConf.IgnoreTagPrefixList, m.dbConf.MongoURL, m.dbConf.AggregationTime)
+	analyticsPerOrg := analytics.AggregateDataWithOptions(data, m.dbConf.TrackAllPaths, m.dbConf.IgnoreTagPrefixList, m.dbConf.MongoURL, m.dbConf.AggregationTime, analytics.AggregateOptions{
+		TrackLatencyPercentiles: m.dbConf.StoreLatencyPercentiles,
+		TopErrors:               m.dbConf.TopErrors,
+	})
 	// put aggregated data into MongoDB
 	writingAttempts := []bool{false}
 	if m.dbConf.UseMixedCollection {
@@ -337,7 +387,7 @@ func (m *MongoAggregatePump) DoAggregatedWriting(ctx context.Context, filteredDa
 		filteredData.DiscardAggregations(m.dbConf.IgnoreAggregationsList)
 	}
 
-	updateDoc := filteredData.AsChange()
+	updateDoc := filteredData.AsChangeWithMergeStrategies(m.dbConf.MergeStrategies)
 	doc := &analytics.AnalyticsRecordAggregate{
 		OrgID: filteredData.OrgID,
 		Mixed: mixed,
@@ -354,6 +404,12 @@ func (m *MongoAggregatePump) DoAggregatedWriting(ctx context.Context, filteredDa
 	}
 
 	// We have the new doc back, lets fix the averages
+	if m.dbConf.StoreLatencyPercentiles {
+		doc.MergeLatencyDigests(filteredData)
+	}
+	if m.dbConf.TopErrors > 0 {
+		doc.MergeTopErrors(filteredData, m.dbConf.TopErrors)
+	}
 	avgUpdateDoc := doc.AsTimeUpdate()
 
 	withTimeUpdate := analytics.AnalyticsRecordAggregate{
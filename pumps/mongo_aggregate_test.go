@@ -3,7 +3,9 @@ package pumps
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -512,3 +514,137 @@ func TestDefaultDriverAggregate(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, persistent.Mgo, newPump.dbConf.MongoDriverType)
 }
+
+// mergingStore is a persistent storage applying the update operators of the upserts to in-memory
+// documents, serialising them as Mongo does.
+type mergingStore struct {
+	persistent.PersistentStorage
+	mu   sync.Mutex
+	docs map[string]model.DBM
+}
+
+func (s *mergingStore) HasTable(ctx context.Context, name string) (bool, error) {
+	return true, nil
+}
+
+func (s *mergingStore) Upsert(ctx context.Context, row model.DBObject, query, update model.DBM) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := fmt.Sprint(row.TableName(), query["orgid"], query["timestamp"])
+	doc, ok := s.docs[key]
+	if !ok {
+		doc = model.DBM{}
+		s.docs[key] = doc
+	}
+
+	for operator, fields := range update {
+		for field, value := range fields.(model.DBM) {
+			current, exists := doc[field]
+			switch {
+			case !exists || operator == "$set":
+				doc[field] = value
+			case operator == "$inc":
+				doc[field] = incValue(current, value)
+			case operator == "$max" && compareValues(value, current) > 0:
+				doc[field] = value
+			case operator == "$min" && compareValues(value, current) < 0:
+				doc[field] = value
+			}
+		}
+	}
+	return nil
+}
+
+func incValue(current, value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return current.(int) + v
+	case int64:
+		return current.(int64) + v
+	case float64:
+		return current.(float64) + v
+	}
+	return value
+}
+
+func compareValues(a, b interface{}) int {
+	switch v := a.(type) {
+	case int64:
+		return int(v - b.(int64))
+	case time.Time:
+		switch {
+		case v.After(b.(time.Time)):
+			return 1
+		case v.Before(b.(time.Time)):
+			return -1
+		}
+	}
+	return 0
+}
+
+func TestMongoAggregatePump_ConcurrentUpserts(t *testing.T) {
+	const writers = 20
+	base := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tcs := []struct {
+		testName         string
+		mergeStrategies  map[string]string
+		expectedLastTime bool
+	}{
+		{testName: "default merge strategies"},
+		{testName: "max last time", mergeStrategies: map[string]string{"lasttime": analytics.MergeStrategyMax}, expectedLastTime: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			store := &mergingStore{docs: map[string]model.DBM{}}
+			pmp := &MongoAggregatePump{}
+			conf := &MongoAggregateConf{MergeStrategies: tc.mergeStrategies}
+			conf.MongoURL = "mongodb://localhost:27017/tyk_analytics"
+			pmp.dbConf = conf
+			pmp.store = store
+			pmp.log = log.WithField("prefix", analytics.MongoAggregatePrefix)
+			pmp.setDefaults()
+
+			var wg sync.WaitGroup
+			for i := 0; i < writers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					timestamp := base.Add(time.Duration(i) * time.Second)
+					record := analytics.AnalyticsRecord{OrgID: "org1", APIID: "api1", ResponseCode: 200, TimeStamp: timestamp}
+					tcpRecord := analytics.AnalyticsRecord{OrgID: "org1", APIID: "api1", ResponseCode: -1, TimeStamp: timestamp}
+					tcpRecord.Network.BytesIn = 10
+					tcpRecord.Network.BytesOut = 20
+					for _, aggregate := range analytics.AggregateData([]interface{}{record, tcpRecord}, false, nil, conf.MongoURL, pmp.dbConf.AggregationTime) {
+						aggregate := aggregate
+						assert.Nil(t, pmp.DoAggregatedWriting(context.Background(), &aggregate, false))
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			assert.Len(t, store.docs, 1)
+			for _, doc := range store.docs {
+				assert.Equal(t, writers, doc["total.hits"])
+				assert.Equal(t, writers, doc["total.success"])
+				assert.Equal(t, int64(writers*10), doc["total.bytesin"])
+				assert.Equal(t, int64(writers*20), doc["total.bytesout"])
+				assert.Equal(t, writers, doc["apiid.api1.hits"])
+				if tc.expectedLastTime {
+					assert.True(t, base.Add((writers-1)*time.Second).Equal(doc["lasttime"].(time.Time)))
+				}
+			}
+		})
+	}
+}
+
+func TestMongoAggregatePump_InitMergeStrategies(t *testing.T) {
+	pmp := &MongoAggregatePump{}
+	err := pmp.Init(map[string]interface{}{
+		"mongo_url":        "mongodb://localhost:27017/tyk_analytics",
+		"merge_strategies": map[string]string{"hits": analytics.MergeStrategyMax},
+	})
+	assert.EqualError(t, err, `merge strategy of unsupported field "hits"`)
+}
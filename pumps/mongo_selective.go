@@ -102,7 +102,9 @@ func (m *MongoSelectivePump) Init(config interface{}) error {
 		m.dbConf.MaxDocumentSizeBytes = 10 * MiB
 	}
 
-	m.connect()
+	if err := m.connect(); err != nil {
+		return err
+	}
 
 	m.log.Debug("MongoDB DB CS: ", m.dbConf.GetBlurredURL())
 	m.log.Info(m.GetName() + " Initialized")
@@ -110,7 +112,7 @@ func (m *MongoSelectivePump) Init(config interface{}) error {
 	return nil
 }
 
-func (m *MongoSelectivePump) connect() {
+func (m *MongoSelectivePump) connect() error {
 	var err error
 
 	if m.dbConf.MongoDriverType == "" {
@@ -131,8 +133,9 @@ func (m *MongoSelectivePump) connect() {
 		DirectConnection:         m.dbConf.MongoDirectConnection,
 	})
 	if err != nil {
-		m.log.Fatal("Failed to connect to mongo: ", err)
+		m.log.Error("Failed to connect to mongo: ", err)
 	}
+	return err
 }
 
 func (m *MongoSelectivePump) ensureIndexes(collectionName string) error {
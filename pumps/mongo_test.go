@@ -3,6 +3,7 @@ package pumps
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"strconv"
 	"testing"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
 	"gopkg.in/vmihailenco/msgpack.v2"
 
 	"github.com/TykTechnologies/storage/persistent"
@@ -309,6 +311,80 @@ func TestMongoPump_capCollection_OverrideSize(t *testing.T) {
 	}
 }
 
+func TestMongoPump_capCollection_MaxDocs(t *testing.T) {
+	if strconv.IntSize < 64 {
+		t.Skip("skipping as < 64bit arch")
+	}
+
+	c := Conn{}
+	c.ConnectDb()
+	defer c.CleanDb()
+
+	pump := newPump()
+	conf := defaultConf()
+
+	mPump := pump.(*MongoPump)
+	mPump.dbConf = &conf
+	mPump.log = log.WithField("prefix", mongoPrefix)
+
+	mPump.dbConf.CollectionCapEnable = true
+	mPump.dbConf.CollectionCapMaxSizeBytes = MiB
+	mPump.dbConf.CollectionCapMaxDocs = 100
+
+	mPump.connect()
+
+	if ok := mPump.capCollection(); !ok {
+		t.Fatal("should have capped collection")
+	}
+
+	colStats := c.GetCollectionStats()
+	assert.Equal(t, true, colStats["capped"])
+	assert.Equal(t, int64(MiB), dbmInt(colStats["maxSize"]))
+	assert.Equal(t, int64(100), dbmInt(colStats["max"]))
+}
+
+func TestMongoPump_capCollection_ExistingCapped(t *testing.T) {
+	if strconv.IntSize < 64 {
+		t.Skip("skipping as < 64bit arch")
+	}
+
+	c := Conn{}
+	c.ConnectDb()
+	defer c.CleanDb()
+
+	newCappedPump := func(maxSizeBytes, maxDocs int) *MongoPump {
+		conf := defaultConf()
+		mPump := newPump().(*MongoPump)
+		mPump.dbConf = &conf
+		mPump.log = log.WithField("prefix", mongoPrefix)
+		mPump.dbConf.CollectionCapEnable = true
+		mPump.dbConf.CollectionCapMaxSizeBytes = maxSizeBytes
+		mPump.dbConf.CollectionCapMaxDocs = maxDocs
+		mPump.connect()
+		return mPump
+	}
+
+	assert.True(t, newCappedPump(MiB, 100).capCollection())
+
+	// the existing collection is validated against the configuration
+	assert.True(t, newCappedPump(MiB, 100).capCollection())
+	assert.True(t, newCappedPump(MiB, 0).capCollection())
+	assert.False(t, newCappedPump(2*MiB, 100).capCollection())
+	assert.False(t, newCappedPump(MiB, 50).capCollection())
+
+	colStats := c.GetCollectionStats()
+	assert.Equal(t, int64(MiB), dbmInt(colStats["maxSize"]))
+	assert.Equal(t, int64(100), dbmInt(colStats["max"]))
+}
+
+func TestDbmInt(t *testing.T) {
+	assert.Equal(t, int64(5), dbmInt(5))
+	assert.Equal(t, int64(5), dbmInt(int32(5)))
+	assert.Equal(t, int64(5), dbmInt(int64(5)))
+	assert.Equal(t, int64(5), dbmInt(float64(5)))
+	assert.Equal(t, int64(0), dbmInt(nil))
+}
+
 func TestMongoPump_AccumulateSet(t *testing.T) {
 	run := func(recordsGenerator func(numRecords int) []interface{}, expectedRecordsCount int) func(t *testing.T) {
 		return func(t *testing.T) {
@@ -657,3 +733,291 @@ func TestMongoPump_WriteData(t *testing.T) {
 		return records
 	}))
 }
+
+func TestMongoPump_AsyncWrites(t *testing.T) {
+	newAsyncPump := func(store *fakeStore, queueSize int) *MongoPump {
+		conf := defaultConf()
+		conf.AsyncWrites = true
+		conf.AsyncQueueSize = queueSize
+
+		pmp := &MongoPump{dbConf: &conf, store: store}
+		pmp.log = log.WithField("prefix", mongoPrefix)
+		pmp.startAsyncWriter()
+		return pmp
+	}
+
+	batch := func(size int) []interface{} {
+		data := make([]interface{}, size)
+		for i := range data {
+			data[i] = analytics.AnalyticsRecord{APIID: "api1", OrgID: "org1"}
+		}
+		return data
+	}
+
+	t.Run("all records are eventually written", func(t *testing.T) {
+		store := &fakeStore{}
+		pmp := newAsyncPump(store, 2)
+
+		for i := 0; i < 5; i++ {
+			assert.Nil(t, pmp.WriteData(context.Background(), batch(10)))
+		}
+		assert.Nil(t, pmp.Shutdown())
+		assert.Equal(t, 50, store.insertedCount())
+	})
+
+	t.Run("writes block when the queue is full", func(t *testing.T) {
+		store := &fakeStore{insertDelay: 200 * time.Millisecond}
+		pmp := newAsyncPump(store, 1)
+
+		// the first batch is picked by the worker, the second one fills the queue
+		assert.Nil(t, pmp.WriteData(context.Background(), batch(1)))
+		assert.Eventually(t, func() bool { return len(pmp.asyncQueue) == 0 }, time.Second, time.Millisecond)
+		assert.Nil(t, pmp.WriteData(context.Background(), batch(1)))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, pmp.WriteData(ctx, batch(1)), context.DeadlineExceeded)
+
+		start := time.Now()
+		assert.Nil(t, pmp.WriteData(context.Background(), batch(1)))
+		assert.Greater(t, time.Since(start), 50*time.Millisecond)
+
+		assert.Nil(t, pmp.Shutdown())
+		assert.Equal(t, 3, store.insertedCount())
+	})
+}
+
+// collectionsStore is a persistent storage holding only the names of its collections.
+type collectionsStore struct {
+	persistent.PersistentStorage
+	collections []string
+}
+
+func (s *collectionsStore) GetTables(ctx context.Context) ([]string, error) {
+	return append([]string(nil), s.collections...), nil
+}
+
+func (s *collectionsStore) DropTable(ctx context.Context, name string) (int, error) {
+	for i, collection := range s.collections {
+		if collection == name {
+			s.collections = append(s.collections[:i], s.collections[i+1:]...)
+			return 0, nil
+		}
+	}
+	return 0, nil
+}
+
+func TestMongoPump_CollectionRotation(t *testing.T) {
+	day1 := time.Date(2024, 6, 30, 23, 59, 0, 0, time.UTC)
+	day2 := time.Date(2024, 7, 1, 0, 1, 0, 0, time.UTC)
+	data := []interface{}{
+		analytics.AnalyticsRecord{APIID: "api1", TimeStamp: day1},
+		analytics.AnalyticsRecord{APIID: "api2", TimeStamp: day1},
+		analytics.AnalyticsRecord{APIID: "api3", TimeStamp: day2},
+	}
+
+	tcs := []struct {
+		testName            string
+		rotation            string
+		expectedCollections []string
+	}{
+		{testName: "no rotation", rotation: "", expectedCollections: []string{colName}},
+		{testName: "daily", rotation: DailyCollectionRotation, expectedCollections: []string{colName + "_2024_06_30", colName + "_2024_07_01"}},
+		{testName: "monthly", rotation: MonthlyCollectionRotation, expectedCollections: []string{colName + "_2024_06", colName + "_2024_07"}},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			conf := defaultConf()
+			conf.CollectionRotation = tc.rotation
+			mPump := &MongoPump{dbConf: &conf}
+			mPump.log = log.WithField("prefix", mongoPrefix)
+
+			var collections []string
+			var recordsCount int
+			for _, dataSet := range mPump.AccumulateSet(data, false) {
+				for _, collectionSet := range splitByCollection(dataSet) {
+					collections = append(collections, collectionSet[0].TableName())
+					for _, obj := range collectionSet {
+						// each set only holds records of a single collection
+						assert.Equal(t, collectionSet[0].TableName(), obj.TableName())
+						recordsCount++
+					}
+				}
+			}
+			assert.Equal(t, tc.expectedCollections, collections)
+			assert.Equal(t, len(data), recordsCount)
+		})
+	}
+}
+
+func TestMongoPump_dropExpiredCollections(t *testing.T) {
+	now := time.Date(2024, 7, 15, 12, 0, 0, 0, time.UTC)
+
+	t.Run("daily", func(t *testing.T) {
+		store := &collectionsStore{collections: []string{
+			colName + "_2024_07_04",
+			colName + "_2024_07_05",
+			colName + "_2024_07_14",
+			colName + "_2024_07",
+			colName,
+			"other_2024_07_01",
+		}}
+		conf := defaultConf()
+		conf.CollectionRotation = DailyCollectionRotation
+		conf.CollectionRetentionDays = 10
+		mPump := &MongoPump{dbConf: &conf, store: store}
+		mPump.log = log.WithField("prefix", mongoPrefix)
+
+		dropped := mPump.dropExpiredCollections(now)
+		assert.Equal(t, []string{colName + "_2024_07_04"}, dropped)
+		assert.Equal(t, []string{
+			colName + "_2024_07_05",
+			colName + "_2024_07_14",
+			colName + "_2024_07",
+			colName,
+			"other_2024_07_01",
+		}, store.collections)
+	})
+
+	t.Run("monthly", func(t *testing.T) {
+		store := &collectionsStore{collections: []string{
+			colName + "_2024_04",
+			colName + "_2024_05",
+			colName + "_2024_06",
+			colName + "_2024_07",
+		}}
+		conf := defaultConf()
+		conf.CollectionRotation = MonthlyCollectionRotation
+		conf.CollectionRetentionDays = 30
+		mPump := &MongoPump{dbConf: &conf, store: store}
+		mPump.log = log.WithField("prefix", mongoPrefix)
+
+		// june ended less than 30 days ago, so it's kept
+		dropped := mPump.dropExpiredCollections(now)
+		assert.Equal(t, []string{colName + "_2024_04", colName + "_2024_05"}, dropped)
+		assert.Equal(t, []string{colName + "_2024_06", colName + "_2024_07"}, store.collections)
+	})
+
+	t.Run("retention disabled", func(t *testing.T) {
+		store := &collectionsStore{collections: []string{colName + "_2020_01_01"}}
+		conf := defaultConf()
+		conf.CollectionRotation = DailyCollectionRotation
+		mPump := &MongoPump{dbConf: &conf, store: store}
+		mPump.log = log.WithField("prefix", mongoPrefix)
+
+		assert.Empty(t, mPump.dropExpiredCollections(now))
+		assert.Len(t, store.collections, 1)
+	})
+}
+
+// recordingStore is a persistent storage recording the collections written to.
+type recordingStore struct {
+	persistent.PersistentStorage
+	inserted map[string]int
+	upserted map[string]int
+}
+
+func (s *recordingStore) Insert(ctx context.Context, objects ...model.DBObject) error {
+	for _, object := range objects {
+		s.inserted[object.TableName()]++
+	}
+	return nil
+}
+
+func (s *recordingStore) Upsert(ctx context.Context, row model.DBObject, query, update model.DBM) error {
+	s.upserted[row.TableName()]++
+	return nil
+}
+
+func (s *recordingStore) HasTable(ctx context.Context, name string) (bool, error) {
+	return true, nil
+}
+
+func (s *recordingStore) Query(ctx context.Context, row model.DBObject, result interface{}, query model.DBM) error {
+	return errors.New("not found")
+}
+
+func TestMongoPump_EnableAggregation(t *testing.T) {
+	store := &recordingStore{inserted: map[string]int{}, upserted: map[string]int{}}
+	conf := defaultConf()
+	conf.EnableAggregation = true
+	conf.Aggregation.UseMixedCollection = true
+	mPump := &MongoPump{dbConf: &conf, store: store}
+	mPump.log = log.WithField("prefix", mongoPrefix)
+	assert.Nil(t, mPump.initAggregation())
+
+	assert.Equal(t, conf.MongoURL, mPump.aggregatePump.dbConf.MongoURL)
+	assert.Equal(t, ThresholdLenTagList, mPump.aggregatePump.dbConf.ThresholdLenTagList)
+
+	data := []interface{}{
+		analytics.AnalyticsRecord{OrgID: "org1", APIID: "api1", ResponseCode: 200, TimeStamp: time.Now()},
+		analytics.AnalyticsRecord{OrgID: "org1", APIID: "api2", ResponseCode: 500, TimeStamp: time.Now()},
+	}
+	assert.Nil(t, mPump.WriteData(context.Background(), data))
+
+	assert.Equal(t, map[string]int{colName: 2}, store.inserted)
+	assert.Contains(t, store.upserted, "z_tyk_analyticz_aggregate_org1")
+	assert.Contains(t, store.upserted, analytics.AgggregateMixedCollectionName)
+}
+
+// documentsStore is a persistent storage keeping the BSON documents of the objects inserted with
+// the mongo-go driver.
+type documentsStore struct {
+	persistent.PersistentStorage
+	documents []bson.M
+}
+
+func (s *documentsStore) Insert(ctx context.Context, objects ...model.DBObject) error {
+	for _, object := range objects {
+		encoded, err := bson.Marshal(object)
+		if err != nil {
+			return err
+		}
+		document := bson.M{}
+		if err := bson.Unmarshal(encoded, &document); err != nil {
+			return err
+		}
+		s.documents = append(s.documents, document)
+	}
+	return nil
+}
+
+func TestMongoPump_OmitEmptyFields(t *testing.T) {
+	record := analytics.AnalyticsRecord{
+		Method:       "GET",
+		Path:         "/get",
+		ResponseCode: 200,
+		APIID:        "api1",
+		TimeStamp:    time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		Geo:          analytics.GeoData{Country: analytics.Country{ISOCode: "ES"}},
+		Latency:      analytics.Latency{Total: 10},
+		Tags:         []string{},
+	}
+
+	store := &documentsStore{}
+	conf := defaultConf()
+	conf.OmitEmptyFields = true
+	mPump := &MongoPump{dbConf: &conf, store: store}
+	mPump.log = log.WithField("prefix", mongoPrefix)
+	assert.Nil(t, mPump.WriteData(context.Background(), []interface{}{record}))
+
+	assert.Len(t, store.documents, 1)
+	document := store.documents[0]
+	assert.Equal(t, "GET", document["method"])
+	assert.Equal(t, "/get", document["path"])
+	assert.Equal(t, int32(200), document["responsecode"])
+	assert.Equal(t, "api1", document["apiid"])
+	assert.Equal(t, bson.M{"country": bson.M{"isocode": "ES"}}, document["geo"])
+	assert.Equal(t, bson.M{"total": int64(10)}, document["latency"])
+	for _, field := range []string{"host", "apikey", "rawrequest", "tags", "network", "expireAt", "trackpath", "graphqlstats"} {
+		assert.NotContains(t, document, field)
+	}
+
+	// mgo gets the same document
+	getter, ok := interface{}(omitEmptyRecord{&record}).(interface{ GetBSON() (interface{}, error) })
+	assert.True(t, ok)
+	mgoDocument, err := getter.GetBSON()
+	assert.Nil(t, err)
+	assert.Equal(t, record.NonEmptyFields(), mgoDocument)
+}
@@ -0,0 +1,14 @@
+package pumps
+
+import "github.com/TykTechnologies/tyk-pump/analytics"
+
+// networkStatsFields returns the network stats of the record as flat fields, for the pumps with
+// the `network_stats` option.
+func networkStatsFields(network analytics.NetworkStats) map[string]interface{} {
+	return map[string]interface{}{
+		"network_open_connections":   network.OpenConnections,
+		"network_closed_connections": network.ClosedConnection,
+		"network_bytes_in":           network.BytesIn,
+		"network_bytes_out":          network.BytesOut,
+	}
+}
@@ -0,0 +1,355 @@
+package pumps
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+const (
+	otelLogsPrefix                = "otel-logs-pump"
+	otelLogsDefaultENV            = PUMPS_ENV_PREFIX + "_OTELLOGS" + PUMPS_ENV_META_PREFIX
+	otelLogsDefaultEndpoint       = "http://localhost:4318/v1/logs"
+	otelLogsDefaultServiceName    = "tyk-pump"
+	otelLogsDefaultTimeout        = 10
+	otelLogsDefaultBatchSize      = 512
+	otelLogsDefaultExportInterval = 5
+	otelLogsScopeName             = "github.com/TykTechnologies/tyk-pump"
+)
+
+// OtelLogsPump writes the records as OpenTelemetry log records, exported with OTLP over HTTP.
+// The log records are buffered and exported in batches, when a batch is full or every export
+// interval. Shutdown exports the buffered log records.
+type OtelLogsPump struct {
+	conf     *OtelLogsConf
+	exporter otelLogsExporter
+	resource *resourcepb.Resource
+
+	mu      sync.Mutex
+	pending []*logspb.LogRecord
+
+	stop    chan struct{}
+	stopped chan struct{}
+	CommonPumpConfig
+}
+
+// @PumpConf OtelLogs
+type OtelLogsConf struct {
+	EnvPrefix string `mapstructure:"meta_env_prefix"`
+	// The OTLP/HTTP logs endpoint of the collector. Defaults to `http://localhost:4318/v1/logs`.
+	Endpoint string `json:"endpoint" mapstructure:"endpoint"`
+	// The headers sent along with the exports, e.g. to authenticate.
+	Headers map[string]string `json:"headers" mapstructure:"headers"`
+	// The `service.name` resource attribute of the log records. Defaults to `tyk-pump`.
+	ServiceName string `json:"service_name" mapstructure:"service_name"`
+	// Additional resource attributes of the log records, e.g. `{"deployment.environment": "prod"}`.
+	ResourceAttributes map[string]string `json:"resource_attributes" mapstructure:"resource_attributes"`
+	// The timeout of the exports, in seconds. Defaults to 10.
+	Timeout int `json:"timeout" mapstructure:"timeout"`
+	// The maximum number of log records of an export. Defaults to 512.
+	BatchSize int `json:"batch_size" mapstructure:"batch_size"`
+	// The interval, in seconds, the buffered log records are exported at. Defaults to 5.
+	ExportInterval int `json:"export_interval" mapstructure:"export_interval"`
+	// Controls whether the pump client verifies the collector's certificate chain and host name.
+	SSLInsecureSkipVerify bool `json:"ssl_insecure_skip_verify" mapstructure:"ssl_insecure_skip_verify"`
+	// The `max_idle_conns` and `max_conns_per_host` limits of the connections to the collector.
+	HTTPClientConf `mapstructure:",squash"`
+}
+
+// otelLogsExporter exports the log records to the collector.
+type otelLogsExporter interface {
+	Export(ctx context.Context, logs *logspb.LogsData) error
+}
+
+// otelLogsHTTPExporter exports the log records with OTLP over HTTP, protobuf encoded.
+type otelLogsHTTPExporter struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+func (e *otelLogsHTTPExporter) Export(ctx context.Context, logs *logspb.LogsData) error {
+	// LogsData has the same wire format as ExportLogsServiceRequest
+	body, err := proto.Marshal(logs)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
+
+func (o *OtelLogsPump) New() Pump {
+	newPump := OtelLogsPump{}
+	return &newPump
+}
+
+func (o *OtelLogsPump) GetName() string {
+	return "OpenTelemetry Logs Pump"
+}
+
+func (o *OtelLogsPump) GetEnvPrefix() string {
+	return o.conf.EnvPrefix
+}
+
+func (o *OtelLogsPump) Init(conf interface{}) error {
+	o.conf = &OtelLogsConf{}
+	o.log = log.WithField("prefix", otelLogsPrefix)
+
+	err := mapstructure.Decode(conf, &o.conf)
+	if err != nil {
+		o.log.Fatal("Failed to decode configuration: ", err)
+	}
+
+	processPumpEnvVars(o, o.log, o.conf, otelLogsDefaultENV)
+
+	o.setDefaults()
+	o.exporter = &otelLogsHTTPExporter{
+		endpoint: o.conf.Endpoint,
+		headers:  o.conf.Headers,
+		// #nosec G402
+		client: newHTTPClient(o.conf.HTTPClientConf, &tls.Config{InsecureSkipVerify: o.conf.SSLInsecureSkipVerify}),
+	}
+	o.start()
+
+	o.log.Info(o.GetName() + " Initialized, exporting to " + o.conf.Endpoint)
+	return nil
+}
+
+// setDefaults sets the defaults of the missing options, and the resource of the log records.
+func (o *OtelLogsPump) setDefaults() {
+	if o.conf.Endpoint == "" {
+		o.conf.Endpoint = otelLogsDefaultEndpoint
+	}
+	if o.conf.ServiceName == "" {
+		o.conf.ServiceName = otelLogsDefaultServiceName
+	}
+	if o.conf.Timeout <= 0 {
+		o.conf.Timeout = otelLogsDefaultTimeout
+	}
+	if o.conf.BatchSize <= 0 {
+		o.conf.BatchSize = otelLogsDefaultBatchSize
+	}
+	if o.conf.ExportInterval <= 0 {
+		o.conf.ExportInterval = otelLogsDefaultExportInterval
+	}
+
+	o.resource = &resourcepb.Resource{
+		Attributes: []*commonpb.KeyValue{otelStringAttribute("service.name", o.conf.ServiceName)},
+	}
+	names := make([]string, 0, len(o.conf.ResourceAttributes))
+	for name := range o.conf.ResourceAttributes {
+		if name != "service.name" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		o.resource.Attributes = append(o.resource.Attributes, otelStringAttribute(name, o.conf.ResourceAttributes[name]))
+	}
+}
+
+// start starts exporting the buffered log records every export interval.
+func (o *OtelLogsPump) start() {
+	o.stop = make(chan struct{})
+	o.stopped = make(chan struct{})
+	go func() {
+		defer close(o.stopped)
+		ticker := time.NewTicker(time.Duration(o.conf.ExportInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				release := AcquireGoroutine()
+				if err := o.flush(context.Background()); err != nil {
+					o.log.Error("Failed to export the log records: ", err)
+				}
+				release()
+			case <-o.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (o *OtelLogsPump) WriteData(ctx context.Context, data []interface{}) error {
+	o.log.Debug("Attempting to write ", len(data), " records...")
+
+	o.mu.Lock()
+	for _, v := range data {
+		record, ok := v.(analytics.AnalyticsRecord)
+		if !ok {
+			o.log.Error("Error while writing ", v, ": data not of type analytics.AnalyticsRecord")
+			continue
+		}
+		o.pending = append(o.pending, otelLogRecord(record))
+	}
+	full := len(o.pending) >= o.conf.BatchSize
+	o.mu.Unlock()
+
+	if !full {
+		o.log.Debug("Buffered ", len(data), " records...")
+		return nil
+	}
+	if err := o.flush(ctx); err != nil {
+		o.log.Error("Failed to export the log records: ", err)
+		return err
+	}
+	return nil
+}
+
+// flush exports the buffered log records, in batches of BatchSize. The log records of a failed
+// export are dropped.
+func (o *OtelLogsPump) flush(ctx context.Context) error {
+	o.mu.Lock()
+	pending := o.pending
+	o.pending = nil
+	o.mu.Unlock()
+
+	var exportErr error
+	for len(pending) > 0 {
+		size := len(pending)
+		if size > o.conf.BatchSize {
+			size = o.conf.BatchSize
+		}
+		if err := o.export(ctx, pending[:size]); err != nil {
+			exportErr = err
+		} else {
+			o.log.Info("Purged ", size, " records...")
+		}
+		pending = pending[size:]
+	}
+	return exportErr
+}
+
+func (o *OtelLogsPump) export(ctx context.Context, logRecords []*logspb.LogRecord) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(o.conf.Timeout)*time.Second)
+	defer cancel()
+
+	return o.exporter.Export(ctx, &logspb.LogsData{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: o.resource,
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope:      &commonpb.InstrumentationScope{Name: otelLogsScopeName},
+				LogRecords: logRecords,
+			}},
+		}},
+	})
+}
+
+// Shutdown stops the periodic exports and exports the buffered log records.
+func (o *OtelLogsPump) Shutdown() error {
+	if o.stop == nil {
+		return nil
+	}
+	select {
+	case <-o.stop:
+	default:
+		close(o.stop)
+	}
+	<-o.stopped
+
+	if err := o.flush(context.Background()); err != nil {
+		return errors.New("failed to export the buffered log records: " + err.Error())
+	}
+	return nil
+}
+
+// otelSeverity derives the severity of the log record of a response code: ERROR for the server
+// errors, WARN for the client errors and INFO otherwise.
+func otelSeverity(responseCode int) (logspb.SeverityNumber, string) {
+	switch {
+	case responseCode >= 500:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR, "ERROR"
+	case responseCode >= 400:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_WARN, "WARN"
+	default:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO, "INFO"
+	}
+}
+
+// otelLogRecord maps a record to a log record. The attributes follow the HTTP semantic
+// conventions, and the Tyk specific fields are prefixed with `tyk.`.
+func otelLogRecord(record analytics.AnalyticsRecord) *logspb.LogRecord {
+	severityNumber, severityText := otelSeverity(record.ResponseCode)
+
+	attributes := []*commonpb.KeyValue{
+		otelStringAttribute("http.request.method", record.Method),
+		otelStringAttribute("url.path", record.Path),
+		otelIntAttribute("http.response.status_code", int64(record.ResponseCode)),
+		otelStringAttribute("server.address", record.Host),
+		otelStringAttribute("client.address", record.IPAddress),
+		otelStringAttribute("user_agent.original", record.UserAgent),
+		otelIntAttribute("http.request.body.size", record.ContentLength),
+		otelStringAttribute("tyk.api_id", record.APIID),
+		otelStringAttribute("tyk.api_name", record.APIName),
+		otelStringAttribute("tyk.api_version", record.APIVersion),
+		otelStringAttribute("tyk.org_id", record.OrgID),
+		otelStringAttribute("tyk.oauth_id", record.OauthID),
+		otelStringAttribute("tyk.alias", record.Alias),
+		otelIntAttribute("tyk.request_time", record.RequestTime),
+		otelIntAttribute("tyk.latency.total", record.Latency.Total),
+		otelIntAttribute("tyk.latency.upstream", record.Latency.Upstream),
+	}
+	if len(record.Tags) > 0 {
+		tags := make([]*commonpb.AnyValue, len(record.Tags))
+		for i, tag := range record.Tags {
+			tags[i] = &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: tag}}
+		}
+		attributes = append(attributes, &commonpb.KeyValue{
+			Key:   "tyk.tags",
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: tags}}},
+		})
+	}
+
+	return &logspb.LogRecord{
+		TimeUnixNano:         uint64(record.TimeStamp.UnixNano()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		SeverityNumber:       severityNumber,
+		SeverityText:         severityText,
+		Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{
+			StringValue: fmt.Sprintf("%s %s %d", record.Method, record.Path, record.ResponseCode),
+		}},
+		Attributes: attributes,
+	}
+}
+
+func otelStringAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func otelIntAttribute(key string, value int64) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: value}}}
+}
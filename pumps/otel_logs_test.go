@@ -0,0 +1,250 @@
+package pumps
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+// inMemoryLogsExporter keeps the exported log records.
+type inMemoryLogsExporter struct {
+	mu      sync.Mutex
+	exports []*logspb.LogsData
+}
+
+func (e *inMemoryLogsExporter) Export(ctx context.Context, logs *logspb.LogsData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.exports = append(e.exports, logs)
+	return nil
+}
+
+func (e *inMemoryLogsExporter) logRecords() []*logspb.LogRecord {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	logRecords := []*logspb.LogRecord{}
+	for _, export := range e.exports {
+		for _, resourceLogs := range export.ResourceLogs {
+			for _, scopeLogs := range resourceLogs.ScopeLogs {
+				logRecords = append(logRecords, scopeLogs.LogRecords...)
+			}
+		}
+	}
+	return logRecords
+}
+
+func newTestOtelLogsPump(t *testing.T, conf *OtelLogsConf) (*OtelLogsPump, *inMemoryLogsExporter) {
+	t.Helper()
+	exporter := &inMemoryLogsExporter{}
+	pmp := &OtelLogsPump{conf: conf, exporter: exporter}
+	pmp.log = log.WithField("prefix", otelLogsPrefix)
+	pmp.setDefaults()
+	pmp.start()
+	return pmp, exporter
+}
+
+func otelAttributes(logRecord *logspb.LogRecord) map[string]interface{} {
+	attributes := map[string]interface{}{}
+	for _, attribute := range logRecord.Attributes {
+		switch value := attribute.Value.Value.(type) {
+		case *commonpb.AnyValue_StringValue:
+			attributes[attribute.Key] = value.StringValue
+		case *commonpb.AnyValue_IntValue:
+			attributes[attribute.Key] = value.IntValue
+		case *commonpb.AnyValue_ArrayValue:
+			values := []string{}
+			for _, v := range value.ArrayValue.Values {
+				values = append(values, v.GetStringValue())
+			}
+			attributes[attribute.Key] = values
+		}
+	}
+	return attributes
+}
+
+func TestOtelLogsPumpWriteData(t *testing.T) {
+	pmp, exporter := newTestOtelLogsPump(t, &OtelLogsConf{
+		ServiceName:        "gateway-analytics",
+		ResourceAttributes: map[string]string{"deployment.environment": "test"},
+	})
+
+	timeStamp := time.Date(2023, 5, 1, 10, 30, 0, 0, time.UTC)
+	record := analytics.AnalyticsRecord{
+		Method:        "POST",
+		Host:          "api.example.com",
+		Path:          "/orders",
+		ContentLength: 42,
+		UserAgent:     "curl/8.0",
+		ResponseCode:  201,
+		APIID:         "api1",
+		APIName:       "Orders",
+		APIVersion:    "v1",
+		OrgID:         "org1",
+		IPAddress:     "10.0.0.1",
+		RequestTime:   12,
+		Latency:       analytics.Latency{Total: 12, Upstream: 10},
+		Tags:          []string{"key-abc", "org-org1"},
+		TimeStamp:     timeStamp,
+	}
+	err := pmp.WriteData(context.Background(), []interface{}{record})
+	assert.Nil(t, err)
+
+	// the log records are buffered until the shutdown
+	assert.Empty(t, exporter.logRecords())
+	assert.Nil(t, pmp.Shutdown())
+
+	assert.Len(t, exporter.exports, 1)
+	resourceLogs := exporter.exports[0].ResourceLogs[0]
+	assert.Equal(t, "gateway-analytics", resourceLogs.Resource.Attributes[0].Value.GetStringValue())
+	assert.Equal(t, "deployment.environment", resourceLogs.Resource.Attributes[1].Key)
+
+	logRecords := exporter.logRecords()
+	assert.Len(t, logRecords, 1)
+	logRecord := logRecords[0]
+	assert.Equal(t, uint64(timeStamp.UnixNano()), logRecord.TimeUnixNano)
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_INFO, logRecord.SeverityNumber)
+	assert.Equal(t, "INFO", logRecord.SeverityText)
+	assert.Equal(t, "POST /orders 201", logRecord.Body.GetStringValue())
+	assert.Equal(t, map[string]interface{}{
+		"http.request.method":       "POST",
+		"url.path":                  "/orders",
+		"http.response.status_code": int64(201),
+		"server.address":            "api.example.com",
+		"client.address":            "10.0.0.1",
+		"user_agent.original":       "curl/8.0",
+		"http.request.body.size":    int64(42),
+		"tyk.api_id":                "api1",
+		"tyk.api_name":              "Orders",
+		"tyk.api_version":           "v1",
+		"tyk.org_id":                "org1",
+		"tyk.oauth_id":              "",
+		"tyk.alias":                 "",
+		"tyk.request_time":          int64(12),
+		"tyk.latency.total":         int64(12),
+		"tyk.latency.upstream":      int64(10),
+		"tyk.tags":                  []string{"key-abc", "org-org1"},
+	}, otelAttributes(logRecord))
+}
+
+func TestOtelLogsPumpSeverity(t *testing.T) {
+	tcs := []struct {
+		responseCode   int
+		severityNumber logspb.SeverityNumber
+		severityText   string
+	}{
+		{responseCode: 200, severityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_INFO, severityText: "INFO"},
+		{responseCode: 302, severityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_INFO, severityText: "INFO"},
+		{responseCode: 404, severityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_WARN, severityText: "WARN"},
+		{responseCode: 429, severityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_WARN, severityText: "WARN"},
+		{responseCode: 500, severityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_ERROR, severityText: "ERROR"},
+		{responseCode: 503, severityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_ERROR, severityText: "ERROR"},
+	}
+
+	for _, tc := range tcs {
+		logRecord := otelLogRecord(analytics.AnalyticsRecord{ResponseCode: tc.responseCode})
+		assert.Equal(t, tc.severityNumber, logRecord.SeverityNumber, tc.responseCode)
+		assert.Equal(t, tc.severityText, logRecord.SeverityText, tc.responseCode)
+	}
+}
+
+func TestOtelLogsPumpBatches(t *testing.T) {
+	pmp, exporter := newTestOtelLogsPump(t, &OtelLogsConf{BatchSize: 2})
+
+	records := []interface{}{}
+	for i := 0; i < 5; i++ {
+		records = append(records, analytics.AnalyticsRecord{ResponseCode: 200})
+	}
+	// a full batch is exported right away
+	assert.Nil(t, pmp.WriteData(context.Background(), records))
+	assert.Len(t, exporter.exports, 3)
+	assert.Len(t, exporter.logRecords(), 5)
+
+	assert.Nil(t, pmp.WriteData(context.Background(), records[:1]))
+	assert.Len(t, exporter.logRecords(), 5)
+	assert.Nil(t, pmp.Shutdown())
+	assert.Len(t, exporter.logRecords(), 6)
+}
+
+// failingLogsExporter fails every export.
+type failingLogsExporter struct{}
+
+func (failingLogsExporter) Export(ctx context.Context, logs *logspb.LogsData) error {
+	return errors.New("collector unavailable")
+}
+
+func TestOtelLogsPumpExportError(t *testing.T) {
+	pmp := &OtelLogsPump{conf: &OtelLogsConf{BatchSize: 2}, exporter: failingLogsExporter{}}
+	pmp.log = log.WithField("prefix", otelLogsPrefix)
+	pmp.setDefaults()
+	pmp.start()
+	defer pmp.Shutdown()
+
+	// the records which aren't analytics records are skipped
+	assert.Nil(t, pmp.WriteData(context.Background(), []interface{}{"invalid", analytics.AnalyticsRecord{ResponseCode: 200}}))
+	err := pmp.WriteData(context.Background(), []interface{}{analytics.AnalyticsRecord{ResponseCode: 200}})
+	assert.EqualError(t, err, "collector unavailable")
+}
+
+func TestOtelLogsPumpExportInterval(t *testing.T) {
+	pmp, exporter := newTestOtelLogsPump(t, &OtelLogsConf{ExportInterval: 1})
+	defer pmp.Shutdown()
+
+	assert.Nil(t, pmp.WriteData(context.Background(), []interface{}{analytics.AnalyticsRecord{ResponseCode: 200}}))
+	assert.Eventually(t, func() bool {
+		return len(exporter.logRecords()) == 1
+	}, 3*time.Second, 50*time.Millisecond)
+}
+
+func TestOtelLogsHTTPExporter(t *testing.T) {
+	var received logspb.LogsData
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/logs", r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+		body, err := io.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.Nil(t, proto.Unmarshal(body, &received))
+	}))
+	defer server.Close()
+
+	pmp := &OtelLogsPump{}
+	err := pmp.Init(map[string]interface{}{
+		"endpoint": server.URL + "/v1/logs",
+		"headers":  map[string]string{"X-Api-Key": "secret"},
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, pmp.WriteData(context.Background(), []interface{}{analytics.AnalyticsRecord{Method: "GET", Path: "/get", ResponseCode: 500}}))
+	assert.Nil(t, pmp.Shutdown())
+
+	logRecords := received.ResourceLogs[0].ScopeLogs[0].LogRecords
+	assert.Len(t, logRecords, 1)
+	assert.Equal(t, "GET /get 500", logRecords[0].Body.GetStringValue())
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_ERROR, logRecords[0].SeverityNumber)
+}
+
+func TestOtelLogsHTTPExporterError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	pmp := &OtelLogsPump{}
+	assert.Nil(t, pmp.Init(map[string]interface{}{"endpoint": server.URL, "batch_size": 1}))
+	defer pmp.Shutdown()
+
+	err := pmp.WriteData(context.Background(), []interface{}{analytics.AnalyticsRecord{ResponseCode: 200}})
+	assert.ErrorContains(t, err, "unexpected status code 503")
+}
@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/TykTechnologies/tyk-pump/analytics"
 	"github.com/sirupsen/logrus"
@@ -14,6 +17,7 @@ import (
 	"github.com/mitchellh/mapstructure"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
 )
 
 type PrometheusPump struct {
@@ -24,8 +28,20 @@ type PrometheusPump struct {
 	KeyStatusMetrics    *prometheus.CounterVec
 	OauthStatusMetrics  *prometheus.CounterVec
 	TotalLatencyMetrics *prometheus.HistogramVec
+	// Sizes of the records per API, observed for the records with a record_size_bytes field
+	RecordSizeMetrics *prometheus.SummaryVec
+	// Aggregates of the records written during the last aggregate_interval
+	AggregateTotalRecords prometheus.Gauge
+	AggregateErrorRate    prometheus.Gauge
+	// Ratio of the cache hits to the hits and misses per API, for the records with a cache_status
+	CacheHitRatioMetrics *prometheus.GaugeVec
+
+	cacheMu     sync.Mutex
+	cacheCounts map[string]*cacheCount
 
 	allMetrics []*PrometheusMetric
+	window     *aggregateWindow
+	pusher     *coalescedPusher
 
 	CommonPumpConfig
 }
@@ -47,6 +63,25 @@ type PrometheusConf struct {
 	TrackAllPaths bool `json:"track_all_paths" mapstructure:"track_all_paths"`
 	// Custom Prometheus metrics.
 	CustomMetrics CustomMetrics `json:"custom_metrics" mapstructure:"custom_metrics"`
+	// The record field (any of the available custom metric labels) or tag (`<name>:<value>` or
+	// `<name>-<value>`) holding the trace id of the request. When set, the trace id is attached as
+	// a `trace_id` OpenMetrics exemplar to the histogram observations, and the metrics are served
+	// in the OpenMetrics format to scrapers that request it.
+	ExemplarTraceIDField string `json:"exemplar_trace_id_field" mapstructure:"exemplar_trace_id_field"`
+	// The interval, in seconds, of the `tyk_aggregate_total_records` and `tyk_aggregate_error_rate`
+	// gauges, set to the number of records written and the percentage of them with a response
+	// code >= 400 during the previous interval. Defaults to 0, which disables the gauges.
+	AggregateInterval int `json:"aggregate_interval" mapstructure:"aggregate_interval"`
+	// The URL of a Prometheus Pushgateway the metrics are pushed to after the batches, e.g.
+	// `http://localhost:9091`, for the deployments Prometheus can't scrape. The pushes are
+	// coalesced to one every `push_min_interval`. When it's set, `listen_address` is optional.
+	PushGatewayURL string `json:"push_gateway_url" mapstructure:"push_gateway_url"`
+	// The job the metrics are pushed under. Defaults to `tyk-pump`.
+	PushJob string `json:"push_job" mapstructure:"push_job"`
+	// The minimum number of seconds between the pushes to the Pushgateway. The batches written in
+	// between are pushed together with the next push, as the metrics accumulate their counts.
+	// Defaults to 10.
+	PushMinInterval int `json:"push_min_interval" mapstructure:"push_min_interval"`
 }
 
 type CustomMetrics []PrometheusMetric
@@ -68,8 +103,12 @@ type PrometheusMetric struct {
 	// Defines the partitions in the metrics. For example: ['response_code','api_name'].
 	// The available labels are: `["host","method",
 	// "path", "response_code", "api_key", "time_stamp", "api_version", "api_name", "api_id",
-	// "org_id", "oauth_id","request_time", "ip_address", "alias"]`.
+	// "org_id", "oauth_id","request_time", "ip_address", "alias", "time_bucket"]`.
 	Labels []string `json:"labels" mapstructure:"labels"`
+	// The granularity of the `time_bucket` label, computed from the UTC record timestamp:
+	// `hour_of_day` (`00` to `23`, the default) or `day_of_week` (`monday` to `sunday`). Unlike
+	// `time_stamp`, it has a bounded number of values. Only used when `time_bucket` is a label.
+	TimeBucket string `json:"time_bucket" mapstructure:"time_bucket"`
 
 	enabled      bool
 	counterVec   *prometheus.CounterVec
@@ -86,6 +125,8 @@ type histogramCounter struct {
 	totalRequestTime uint64
 	hits             uint64
 	labelValues      []string
+	// traceID is the trace id of the latest observation, exposed as exemplar.
+	traceID string
 }
 
 type counterStruct struct {
@@ -97,6 +138,14 @@ const (
 	counterType           = "counter"
 	histogramType         = "histogram"
 	prometheusUnknownPath = "unknown"
+	// prometheusExemplarLabel is the exemplar label holding the trace id.
+	prometheusExemplarLabel = "trace_id"
+
+	// timeBucketLabel is the label holding the time bucket of the records, and timeBucketHourOfDay
+	// and timeBucketDayOfWeek its granularities.
+	timeBucketLabel     = "time_bucket"
+	timeBucketHourOfDay = "hour_of_day"
+	timeBucketDayOfWeek = "day_of_week"
 )
 
 var (
@@ -104,6 +153,18 @@ var (
 	prometheusDefaultENV = PUMPS_ENV_PREFIX + "_PROMETHEUS" + PUMPS_ENV_META_PREFIX
 )
 
+// recordSizeMetricName is the summary of the record_size_bytes field of the records.
+const recordSizeMetricName = "tyk_record_size_bytes"
+
+// cacheHitRatioMetricName is the ratio of the cache hits of the records with a cache_status field.
+const cacheHitRatioMetricName = "tyk_cache_hit_ratio"
+
+// The gauges of the aggregates of the records written during the last aggregate_interval.
+const (
+	aggregateTotalRecordsMetricName = "tyk_aggregate_total_records"
+	aggregateErrorRateMetricName    = "tyk_aggregate_error_rate"
+)
+
 var buckets = []float64{1, 2, 5, 7, 10, 15, 20, 25, 30, 40, 50, 60, 70, 80, 90, 100, 200, 300, 400, 500, 1000, 2000, 5000, 10000, 30000, 60000}
 
 func (p *PrometheusPump) New() Pump {
@@ -176,19 +237,35 @@ func (p *PrometheusPump) Init(conf interface{}) error {
 		p.conf.Path = "/metrics"
 	}
 
-	if p.conf.Addr == "" {
+	if p.conf.Addr == "" && p.conf.PushGatewayURL == "" {
 		return errors.New("Prometheus listen_addr not set")
 	}
 
 	//first we init the base metrics
 	p.initBaseMetrics()
+	p.initRecordSizeMetrics()
+	p.initCacheHitRatioMetrics()
+	p.initAggregateMetrics()
 
 	// then we check the custom ones
 	p.InitCustomMetrics()
 
+	if p.conf.PushGatewayURL != "" {
+		p.initPusher()
+	}
+	if p.conf.Addr == "" {
+		p.log.Info(p.GetName() + " Initialized")
+		return nil
+	}
+
 	p.log.Info("Starting prometheus listener on:", p.conf.Addr)
 
-	http.Handle(p.conf.Path, promhttp.Handler())
+	handler := promhttp.Handler()
+	if p.conf.ExemplarTraceIDField != "" {
+		handler = promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+	}
+	http.Handle(p.conf.Path, handler)
 
 	go func() {
 		log.Fatal(http.ListenAndServe(p.conf.Addr, nil))
@@ -218,6 +295,164 @@ func (p *PrometheusPump) initBaseMetrics() {
 	p.allMetrics = trimmedAllMetrics
 }
 
+// initRecordSizeMetrics registers the summary of the record sizes, unless it's disabled.
+func (p *PrometheusPump) initRecordSizeMetrics() {
+	for _, metric := range p.conf.DisabledMetrics {
+		if metric == recordSizeMetricName {
+			return
+		}
+	}
+
+	summary := prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Name:       recordSizeMetricName,
+			Help:       "Serialized size of the analytics records per API, in bytes",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		},
+		[]string{"api"},
+	)
+	if err := prometheus.Register(summary); err != nil {
+		alreadyRegistered := prometheus.AlreadyRegisteredError{}
+		if !errors.As(err, &alreadyRegistered) {
+			p.log.Error("error registering prometheus metric ", recordSizeMetricName, ": ", err)
+			return
+		}
+		summary = alreadyRegistered.ExistingCollector.(*prometheus.SummaryVec)
+	}
+	p.RecordSizeMetrics = summary
+}
+
+// initCacheHitRatioMetrics registers the gauge of the cache hit ratios, unless it's disabled.
+func (p *PrometheusPump) initCacheHitRatioMetrics() {
+	for _, metric := range p.conf.DisabledMetrics {
+		if metric == cacheHitRatioMetricName {
+			return
+		}
+	}
+
+	gauge := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: cacheHitRatioMetricName,
+			Help: "Ratio of the cache hits to the cache hits and misses per API, from 0 to 1",
+		},
+		[]string{"api"},
+	)
+	if err := prometheus.Register(gauge); err != nil {
+		alreadyRegistered := prometheus.AlreadyRegisteredError{}
+		if !errors.As(err, &alreadyRegistered) {
+			p.log.Error("error registering prometheus metric ", cacheHitRatioMetricName, ": ", err)
+			return
+		}
+		gauge = alreadyRegistered.ExistingCollector.(*prometheus.GaugeVec)
+	}
+	p.CacheHitRatioMetrics = gauge
+	p.cacheCounts = map[string]*cacheCount{}
+}
+
+// cacheCount counts the cache hits and misses of an API since the pump started.
+type cacheCount struct {
+	hits   uint64
+	misses uint64
+}
+
+// ratio returns the ratio of the hits to the hits and misses, or 0 without any. The bypasses
+// aren't counted, as their responses can't be cached.
+func (c *cacheCount) ratio() float64 {
+	if c.hits+c.misses == 0 {
+		return 0
+	}
+	return float64(c.hits) / float64(c.hits+c.misses)
+}
+
+// observeCacheStatuses counts the cache hits and misses of the records, and sets the hit ratio of
+// their APIs.
+func (p *PrometheusPump) observeCacheStatuses(data []interface{}) {
+	p.cacheMu.Lock()
+	defer p.cacheMu.Unlock()
+
+	updated := map[string]bool{}
+	for _, item := range data {
+		record := item.(analytics.AnalyticsRecord)
+		if record.CacheStatus != analytics.CacheStatusHit && record.CacheStatus != analytics.CacheStatusMiss {
+			continue
+		}
+		count := p.cacheCounts[record.APIID]
+		if count == nil {
+			count = &cacheCount{}
+			p.cacheCounts[record.APIID] = count
+		}
+		if record.CacheStatus == analytics.CacheStatusHit {
+			count.hits++
+		} else {
+			count.misses++
+		}
+		updated[record.APIID] = true
+	}
+	for apiID := range updated {
+		p.CacheHitRatioMetrics.WithLabelValues(apiID).Set(p.cacheCounts[apiID].ratio())
+	}
+}
+
+// initAggregateMetrics registers the aggregate gauges, and starts their window, if
+// aggregate_interval is set.
+func (p *PrometheusPump) initAggregateMetrics() {
+	if p.conf.AggregateInterval <= 0 {
+		return
+	}
+
+	p.AggregateTotalRecords = registerPrometheusGauge(aggregateTotalRecordsMetricName, "Analytics records written during the last aggregate interval")
+	p.AggregateErrorRate = registerPrometheusGauge(aggregateErrorRateMetricName, "Percentage of the analytics records with a response code >= 400 during the last aggregate interval")
+	p.window = startAggregateWindow(time.Duration(p.conf.AggregateInterval)*time.Second, p.flushAggregate)
+}
+
+// registerPrometheusGauge registers the gauge, or returns the already registered one.
+func registerPrometheusGauge(name, help string) prometheus.Gauge {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: name, Help: help})
+	if err := prometheus.Register(gauge); err != nil {
+		alreadyRegistered := prometheus.AlreadyRegisteredError{}
+		if errors.As(err, &alreadyRegistered) {
+			return alreadyRegistered.ExistingCollector.(prometheus.Gauge)
+		}
+		log.WithField("prefix", prometheusPrefix).Error("error registering prometheus metric ", name, ": ", err)
+	}
+	return gauge
+}
+
+// initPusher sets up the coalesced pushes of the metrics to the Pushgateway.
+func (p *PrometheusPump) initPusher() {
+	job := p.conf.PushJob
+	if job == "" {
+		job = "tyk-pump"
+	}
+	minInterval := defaultPushMinInterval
+	if p.conf.PushMinInterval > 0 {
+		minInterval = time.Duration(p.conf.PushMinInterval) * time.Second
+	}
+
+	pusher := push.New(p.conf.PushGatewayURL, job).Gatherer(prometheus.DefaultGatherer)
+	p.pusher = newCoalescedPusher(pusher.Push, minInterval, func(err error) {
+		p.log.WithError(err).Error("Failed to push the metrics to the Pushgateway")
+	})
+	p.log.Info("Pushing the metrics to ", p.conf.PushGatewayURL, " at most every ", minInterval)
+}
+
+// flushAggregate sets the aggregate gauges to the aggregate of a window.
+func (p *PrometheusPump) flushAggregate(aggregate windowAggregate) {
+	p.AggregateTotalRecords.Set(float64(aggregate.TotalRecords))
+	p.AggregateErrorRate.Set(aggregate.ErrorRate)
+}
+
+// Shutdown stops the aggregate window.
+func (p *PrometheusPump) Shutdown() error {
+	if p.window != nil {
+		p.window.close()
+	}
+	if p.pusher != nil {
+		p.pusher.close()
+	}
+	return nil
+}
+
 // InitCustomMetrics initialise custom prometheus metrics based on p.conf.CustomMetrics and add them into p.allMetrics
 func (p *PrometheusPump) InitCustomMetrics() {
 	if len(p.conf.CustomMetrics) > 0 {
@@ -241,6 +476,13 @@ func (p *PrometheusPump) InitCustomMetrics() {
 func (p *PrometheusPump) WriteData(ctx context.Context, data []interface{}) error {
 	p.log.Debug("Attempting to write ", len(data), " records...")
 
+	if p.window != nil {
+		p.window.add(data)
+	}
+	if p.CacheHitRatioMetrics != nil {
+		p.observeCacheStatuses(data)
+	}
+
 	for i, item := range data {
 		select {
 		case <-ctx.Done():
@@ -254,6 +496,11 @@ func (p *PrometheusPump) WriteData(ctx context.Context, data []interface{}) erro
 			record.Path = prometheusUnknownPath
 		}
 
+		// the size is only set when the record_size enrichment is enabled
+		if p.RecordSizeMetrics != nil && record.RecordSizeBytes > 0 {
+			p.RecordSizeMetrics.WithLabelValues(record.APIID).Observe(float64(record.RecordSizeBytes))
+		}
+
 		// we loop through all the metrics available.
 		for _, metric := range p.allMetrics {
 			if metric.enabled {
@@ -276,7 +523,7 @@ func (p *PrometheusPump) WriteData(ctx context.Context, data []interface{}) erro
 				case histogramType:
 					if metric.histogramVec != nil {
 						// if the metric is an histogram, we Observe the request time with the given values
-						err := metric.Observe(record.RequestTime, values...)
+						err := metric.ObserveWithExemplar(record.RequestTime, p.traceID(record), values...)
 						if err != nil {
 							p.log.WithFields(logrus.Fields{
 								"metric_type": metric.MetricType,
@@ -302,14 +549,37 @@ func (p *PrometheusPump) WriteData(ctx context.Context, data []interface{}) erro
 		}
 	}
 
+	if p.pusher != nil {
+		p.pusher.request()
+	}
+
 	p.log.Info("Purged ", len(data), " records...")
 
 	return nil
 }
 
+// traceID returns the trace id of the record from the exemplar_trace_id_field field or tag.
+func (p *PrometheusPump) traceID(record analytics.AnalyticsRecord) string {
+	field := p.conf.ExemplarTraceIDField
+	if field == "" {
+		return ""
+	}
+	if val, ok := prometheusLabelMapping(record)[field]; ok {
+		return fmt.Sprint(val)
+	}
+	traceID, _ := record.TagValue(field)
+	return traceID
+}
+
 // InitVec inits the prometheus metric based on the metric_type. It only can create counter and histogram,
 // if the metric_type is anything else it returns an error
 func (pm *PrometheusMetric) InitVec() error {
+	switch pm.TimeBucket {
+	case "", timeBucketHourOfDay, timeBucketDayOfWeek:
+	default:
+		return errors.New("invalid time bucket:" + pm.TimeBucket)
+	}
+
 	switch pm.MetricType {
 	case counterType:
 		pm.counterVec = prometheus.NewCounterVec(
@@ -369,7 +639,32 @@ func (pm *PrometheusMetric) ensureLabels() {
 // GetLabelsValues return a list of string values based on the custom metric labels.
 func (pm *PrometheusMetric) GetLabelsValues(decoded analytics.AnalyticsRecord) []string {
 	values := []string{}
-	mapping := map[string]interface{}{
+	mapping := prometheusLabelMapping(decoded)
+
+	for _, label := range pm.Labels {
+		if label == timeBucketLabel {
+			values = append(values, timeBucket(decoded.TimeStamp, pm.TimeBucket))
+			continue
+		}
+		if val, ok := mapping[label]; ok {
+			values = append(values, fmt.Sprint(val))
+		}
+	}
+	return values
+}
+
+// timeBucket returns the bucket of t, in UTC, for the granularity of the time_bucket label.
+func timeBucket(t time.Time, granularity string) string {
+	t = t.UTC()
+	if granularity == timeBucketDayOfWeek {
+		return strings.ToLower(t.Weekday().String())
+	}
+	return fmt.Sprintf("%02d", t.Hour())
+}
+
+// prometheusLabelMapping returns the record values of the available labels.
+func prometheusLabelMapping(decoded analytics.AnalyticsRecord) map[string]interface{} {
+	return map[string]interface{}{
 		"host":          decoded.Host,
 		"method":        decoded.Method,
 		"path":          decoded.Path,
@@ -388,14 +683,8 @@ func (pm *PrometheusMetric) GetLabelsValues(decoded analytics.AnalyticsRecord) [
 		"request_time":  decoded.RequestTime,
 		"ip_address":    decoded.IPAddress,
 		"alias":         decoded.Alias,
+		"cache_status":  decoded.CacheStatus,
 	}
-
-	for _, label := range pm.Labels {
-		if val, ok := mapping[label]; ok {
-			values = append(values, fmt.Sprint(val))
-		}
-	}
-	return values
 }
 
 // Inc is going to fill counterMap and histogramMap with the data from record.
@@ -422,6 +711,11 @@ func (pm *PrometheusMetric) Inc(values ...string) error {
 
 // Observe will fill hitogramMap with the sum of totalRequest and hits per label value if aggregate_observations is true. If aggregate_observations is set to false (default) it will execute prometheus Observe directly.
 func (pm *PrometheusMetric) Observe(requestTime int64, values ...string) error {
+	return pm.ObserveWithExemplar(requestTime, "", values...)
+}
+
+// ObserveWithExemplar works as Observe, attaching traceID as exemplar of the observation when it's not empty.
+func (pm *PrometheusMetric) ObserveWithExemplar(requestTime int64, traceID string, values ...string) error {
 	switch pm.MetricType {
 	case histogramType:
 		labelValues := []string{"total"}
@@ -432,16 +726,20 @@ func (pm *PrometheusMetric) Observe(requestTime int64, values ...string) error {
 			if currentValue, ok := pm.histogramMap[key]; ok {
 				currentValue.hits += 1
 				currentValue.totalRequestTime += uint64(requestTime)
+				if traceID != "" {
+					currentValue.traceID = traceID
+				}
 				pm.histogramMap[key] = currentValue
 			} else {
 				pm.histogramMap[key] = histogramCounter{
 					hits:             1,
 					totalRequestTime: uint64(requestTime),
 					labelValues:      labelValues,
+					traceID:          traceID,
 				}
 			}
 		} else {
-			pm.histogramVec.WithLabelValues(labelValues...).Observe(float64(requestTime))
+			pm.observe(float64(requestTime), traceID, labelValues...)
 		}
 
 	default:
@@ -464,7 +762,7 @@ func (pm *PrometheusMetric) Expose() error {
 	case histogramType:
 		if pm.aggregatedObservations {
 			for _, value := range pm.histogramMap {
-				pm.histogramVec.WithLabelValues(value.labelValues...).Observe(value.getAverageRequestTime())
+				pm.observe(value.getAverageRequestTime(), value.traceID, value.labelValues...)
 			}
 			pm.histogramMap = make(map[string]histogramCounter)
 		}
@@ -474,6 +772,17 @@ func (pm *PrometheusMetric) Expose() error {
 	return nil
 }
 
+// observe executes prometheus Observe, attaching traceID as exemplar if it's a valid exemplar label value.
+func (pm *PrometheusMetric) observe(value float64, traceID string, labelValues ...string) {
+	observer := pm.histogramVec.WithLabelValues(labelValues...)
+	if traceID == "" || !utf8.ValidString(traceID) ||
+		utf8.RuneCountInString(prometheusExemplarLabel+traceID) > prometheus.ExemplarMaxRunes {
+		observer.Observe(value)
+		return
+	}
+	observer.(prometheus.ExemplarObserver).ObserveWithExemplar(value, prometheus.Labels{prometheusExemplarLabel: traceID})
+}
+
 // getAverageRequestTime returns the average request time of an histogramCounter dividing the sum of all the RequestTimes by the hits.
 func (c histogramCounter) getAverageRequestTime() float64 {
 	return float64(c.totalRequestTime / c.hits)
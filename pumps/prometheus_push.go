@@ -0,0 +1,78 @@
+package pumps
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultPushMinInterval is the default minimum interval between the pushes to the Pushgateway.
+const defaultPushMinInterval = 10 * time.Second
+
+// coalescedPusher coalesces the pushes requested while a push is pending, so push is called at
+// most once every minInterval whatever the frequency of the batches. The metrics are cumulative,
+// so the last push holds the counts of all the batches since the previous one.
+type coalescedPusher struct {
+	push        func() error
+	minInterval time.Duration
+	onError     func(error)
+
+	mu       sync.Mutex
+	lastPush time.Time
+	timer    *time.Timer
+	closed   bool
+	// scheduled tracks the scheduled pushes, for close to wait for them.
+	scheduled sync.WaitGroup
+}
+
+func newCoalescedPusher(push func() error, minInterval time.Duration, onError func(error)) *coalescedPusher {
+	return &coalescedPusher{push: push, minInterval: minInterval, onError: onError}
+}
+
+// request schedules a push, minInterval after the previous one, unless one is already pending.
+func (c *coalescedPusher) request() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || c.timer != nil {
+		return
+	}
+
+	delay := time.Until(c.lastPush.Add(c.minInterval))
+	if delay < 0 {
+		delay = 0
+	}
+	c.scheduled.Add(1)
+	c.timer = time.AfterFunc(delay, c.run)
+}
+
+// run does a scheduled push. The pushes are sequential, a push is only scheduled once the
+// previous one has started and the timer of the next one fires minInterval after it.
+func (c *coalescedPusher) run() {
+	defer c.scheduled.Done()
+	c.mu.Lock()
+	c.timer = nil
+	c.lastPush = time.Now()
+	c.mu.Unlock()
+
+	if err := c.push(); err != nil {
+		c.onError(err)
+	}
+}
+
+// close stops the scheduling of the pushes, and does the pending one right away, so the counts of
+// the last batches aren't lost.
+func (c *coalescedPusher) close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	pending := c.timer != nil && c.timer.Stop()
+	c.timer = nil
+	c.mu.Unlock()
+
+	if pending {
+		c.run()
+	}
+	c.scheduled.Wait()
+}
@@ -0,0 +1,93 @@
+package pumps
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+func TestCoalescedPusher(t *testing.T) {
+	var mu sync.Mutex
+	pushes := []time.Time{}
+	minInterval := 200 * time.Millisecond
+	pusher := newCoalescedPusher(func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		pushes = append(pushes, time.Now())
+		return nil
+	}, minInterval, func(err error) {})
+
+	// a batch every 10ms for 500ms
+	for i := 0; i < 50; i++ {
+		pusher.request()
+		time.Sleep(10 * time.Millisecond)
+	}
+	pusher.close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	// the first push right away, then one every 200ms, and the pending one on close
+	assert.GreaterOrEqual(t, len(pushes), 3)
+	assert.LessOrEqual(t, len(pushes), 4)
+	for i := 1; i < len(pushes)-1; i++ {
+		assert.GreaterOrEqual(t, pushes[i].Sub(pushes[i-1]), minInterval-10*time.Millisecond)
+	}
+
+	// no push is requested once closed
+	pusher.request()
+	time.Sleep(minInterval + 50*time.Millisecond)
+	assert.LessOrEqual(t, len(pushes), 4)
+}
+
+func TestCoalescedPusher_NothingPending(t *testing.T) {
+	pushes := 0
+	pusher := newCoalescedPusher(func() error {
+		pushes++
+		return nil
+	}, time.Second, func(err error) {})
+
+	pusher.close()
+	assert.Equal(t, 0, pushes)
+}
+
+func TestPrometheusPushGateway(t *testing.T) {
+	var mu sync.Mutex
+	paths := []string{}
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+	pushed := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, paths...)
+	}
+
+	p := &PrometheusPump{conf: &PrometheusConf{PushGatewayURL: gateway.URL, PushJob: "pump", PushMinInterval: 60}}
+	p.log = log.WithField("prefix", prometheusPrefix)
+	p.initPusher()
+
+	records := []interface{}{analytics.AnalyticsRecord{APIID: "api1", ResponseCode: 200, TimeStamp: time.Now()}}
+	assert.Nil(t, p.WriteData(context.Background(), records))
+	assert.Eventually(t, func() bool {
+		return len(pushed()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the next batches are coalesced into a single push, done at the latest on shutdown
+	assert.Nil(t, p.WriteData(context.Background(), records))
+	assert.Nil(t, p.WriteData(context.Background(), records))
+	assert.Len(t, pushed(), 1)
+
+	assert.Nil(t, p.Shutdown())
+	assert.Equal(t, []string{"PUT /metrics/job/pump", "PUT /metrics/job/pump"}, pushed())
+}
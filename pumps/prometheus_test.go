@@ -1,13 +1,19 @@
 package pumps
 
 import (
+	"context"
 	"errors"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/TykTechnologies/tyk-pump/analytics"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -59,6 +65,17 @@ func TestPrometheusInitVec(t *testing.T) {
 			expectedErr: errors.New("invalid metric type:RandomType"),
 			isEnabled:   false,
 		},
+		{
+			testName: "Invalid time bucket",
+			customMetric: PrometheusMetric{
+				Name:       "testCounterMetric",
+				MetricType: counterType,
+				Labels:     []string{"time_bucket"},
+				TimeBucket: "minute",
+			},
+			expectedErr: errors.New("invalid time bucket:minute"),
+			isEnabled:   false,
+		},
 	}
 
 	for _, tc := range tcs {
@@ -334,6 +351,46 @@ func TestPrometheusGetLabelsValues(t *testing.T) {
 			},
 			expectedLabels: []string{"200", "api_1", "apikey"},
 		},
+		{
+			testName: "hour of day time bucket",
+			customMetric: PrometheusMetric{
+				Name:       "testCounterMetric",
+				MetricType: counterType,
+				Labels:     []string{"api_id", "time_bucket"},
+			},
+			record: analytics.AnalyticsRecord{
+				APIID:     "api_1",
+				TimeStamp: time.Date(2023, 5, 1, 7, 59, 59, 0, time.UTC),
+			},
+			expectedLabels: []string{"api_1", "07"},
+		},
+		{
+			testName: "hour of day time bucket in UTC",
+			customMetric: PrometheusMetric{
+				Name:       "testCounterMetric",
+				MetricType: counterType,
+				Labels:     []string{"time_bucket"},
+				TimeBucket: "hour_of_day",
+			},
+			record: analytics.AnalyticsRecord{
+				TimeStamp: time.Date(2023, 5, 1, 23, 30, 0, 0, time.FixedZone("UTC+2", 2*60*60)),
+			},
+			expectedLabels: []string{"21"},
+		},
+		{
+			testName: "day of week time bucket",
+			customMetric: PrometheusMetric{
+				Name:       "testCounterMetric",
+				MetricType: counterType,
+				Labels:     []string{"time_bucket", "response_code"},
+				TimeBucket: "day_of_week",
+			},
+			record: analytics.AnalyticsRecord{
+				ResponseCode: 200,
+				TimeStamp:    time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC),
+			},
+			expectedLabels: []string{"monday", "200"},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -815,3 +872,165 @@ func TestPrometheusDisablingMetrics(t *testing.T) {
 	assert.Contains(t, metricMap, "tyk_http_status")
 	assert.NotContains(t, metricMap, "tyk_http_status_per_path")
 }
+
+func TestPrometheusExemplars(t *testing.T) {
+	tcs := []struct {
+		testName               string
+		metricName             string
+		traceIDField           string
+		aggregatedObservations bool
+		record                 analytics.AnalyticsRecord
+		expectedExemplar       string
+	}{
+		{
+			testName:         "trace id from tag",
+			metricName:       "tyk_latency_exemplar_tag",
+			traceIDField:     "trace_id",
+			record:           analytics.AnalyticsRecord{APIID: "api_1", RequestTime: 60, Tags: []string{"trace_id:4bf92f3577b34da6"}},
+			expectedExemplar: `trace_id="4bf92f3577b34da6"`,
+		},
+		{
+			testName:         "trace id from field",
+			metricName:       "tyk_latency_exemplar_field",
+			traceIDField:     "alias",
+			record:           analytics.AnalyticsRecord{APIID: "api_1", RequestTime: 60, Alias: "a3ce929d0e0e4736"},
+			expectedExemplar: `trace_id="a3ce929d0e0e4736"`,
+		},
+		{
+			testName:               "trace id with aggregated observations",
+			metricName:             "tyk_latency_exemplar_aggregated",
+			traceIDField:           "trace_id",
+			aggregatedObservations: true,
+			record:                 analytics.AnalyticsRecord{APIID: "api_1", RequestTime: 60, Tags: []string{"trace_id-00f067aa0ba902b7"}},
+			expectedExemplar:       `trace_id="00f067aa0ba902b7"`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			metric := &PrometheusMetric{
+				Name:                   tc.metricName,
+				Help:                   "Latency per API",
+				MetricType:             histogramType,
+				Labels:                 []string{"type", "api"},
+				aggregatedObservations: tc.aggregatedObservations,
+			}
+			err := metric.InitVec()
+			assert.Nil(t, err)
+			defer prometheus.Unregister(metric.histogramVec)
+
+			log := logrus.New()
+			log.Out = io.Discard
+			p := &PrometheusPump{
+				conf:       &PrometheusConf{ExemplarTraceIDField: tc.traceIDField},
+				allMetrics: []*PrometheusMetric{metric},
+			}
+			p.log = logrus.NewEntry(log)
+
+			err = p.WriteData(context.Background(), []interface{}{tc.record})
+			assert.Nil(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+			rec := httptest.NewRecorder()
+			promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}).ServeHTTP(rec, req)
+
+			assert.Contains(t, rec.Body.String(), tc.expectedExemplar)
+		})
+	}
+}
+
+func TestPrometheusRecordSizeMetric(t *testing.T) {
+	log := logrus.New()
+	log.Out = io.Discard
+	p := &PrometheusPump{conf: &PrometheusConf{}}
+	p.log = logrus.NewEntry(log)
+
+	p.initRecordSizeMetrics()
+	assert.NotNil(t, p.RecordSizeMetrics)
+	defer prometheus.Unregister(p.RecordSizeMetrics)
+
+	err := p.WriteData(context.Background(), []interface{}{
+		analytics.AnalyticsRecord{APIID: "api_size", Enrichment: analytics.Enrichment{RecordSizeBytes: 100}},
+		analytics.AnalyticsRecord{APIID: "api_size", Enrichment: analytics.Enrichment{RecordSizeBytes: 300}},
+		analytics.AnalyticsRecord{APIID: "api_size"},
+	})
+	assert.Nil(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{}).ServeHTTP(rec, req)
+
+	assert.Contains(t, rec.Body.String(), `tyk_record_size_bytes_sum{api="api_size"} 400`)
+	assert.Contains(t, rec.Body.String(), `tyk_record_size_bytes_count{api="api_size"} 2`)
+
+	disabled := &PrometheusPump{conf: &PrometheusConf{DisabledMetrics: []string{recordSizeMetricName}}}
+	disabled.log = logrus.NewEntry(log)
+	disabled.initRecordSizeMetrics()
+	assert.Nil(t, disabled.RecordSizeMetrics)
+}
+
+func TestPrometheusCacheHitRatioMetric(t *testing.T) {
+	log := logrus.New()
+	log.Out = io.Discard
+	p := &PrometheusPump{conf: &PrometheusConf{}}
+	p.log = logrus.NewEntry(log)
+
+	p.initCacheHitRatioMetrics()
+	assert.NotNil(t, p.CacheHitRatioMetrics)
+	defer prometheus.Unregister(p.CacheHitRatioMetrics)
+
+	err := p.WriteData(context.Background(), []interface{}{
+		analytics.AnalyticsRecord{APIID: "api_cached", Enrichment: analytics.Enrichment{CacheStatus: analytics.CacheStatusHit}},
+		analytics.AnalyticsRecord{APIID: "api_cached", Enrichment: analytics.Enrichment{CacheStatus: analytics.CacheStatusHit}},
+		analytics.AnalyticsRecord{APIID: "api_cached", Enrichment: analytics.Enrichment{CacheStatus: analytics.CacheStatusMiss}},
+		analytics.AnalyticsRecord{APIID: "api_cached", Enrichment: analytics.Enrichment{CacheStatus: analytics.CacheStatusBypass}},
+		analytics.AnalyticsRecord{APIID: "api_cached"},
+		analytics.AnalyticsRecord{APIID: "api_uncached", Enrichment: analytics.Enrichment{CacheStatus: analytics.CacheStatusBypass}},
+	})
+	assert.Nil(t, err)
+	assert.InDelta(t, 2.0/3, testutil.ToFloat64(p.CacheHitRatioMetrics.WithLabelValues("api_cached")), 0.0001)
+	// the APIs with neither hits nor misses have no ratio
+	assert.Equal(t, 1, testutil.CollectAndCount(p.CacheHitRatioMetrics))
+
+	// the ratio accumulates over the batches
+	err = p.WriteData(context.Background(), []interface{}{
+		analytics.AnalyticsRecord{APIID: "api_cached", Enrichment: analytics.Enrichment{CacheStatus: analytics.CacheStatusMiss}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 0.5, testutil.ToFloat64(p.CacheHitRatioMetrics.WithLabelValues("api_cached")))
+
+	disabled := &PrometheusPump{conf: &PrometheusConf{DisabledMetrics: []string{cacheHitRatioMetricName}}}
+	disabled.log = logrus.NewEntry(log)
+	disabled.initCacheHitRatioMetrics()
+	assert.Nil(t, disabled.CacheHitRatioMetrics)
+}
+
+func TestCacheCountRatio(t *testing.T) {
+	assert.Equal(t, float64(0), (&cacheCount{}).ratio())
+	assert.Equal(t, float64(1), (&cacheCount{hits: 3}).ratio())
+	assert.Equal(t, float64(0), (&cacheCount{misses: 3}).ratio())
+	assert.Equal(t, 0.25, (&cacheCount{hits: 1, misses: 3}).ratio())
+}
+
+func TestPrometheusAggregateInterval(t *testing.T) {
+	p := &PrometheusPump{conf: &PrometheusConf{}}
+	p.log = log.WithField("prefix", prometheusPrefix)
+	p.initAggregateMetrics()
+	assert.Nil(t, p.window)
+
+	p.conf.AggregateInterval = 60
+	p.initAggregateMetrics()
+	assert.NotNil(t, p.window)
+
+	records := []interface{}{
+		analytics.AnalyticsRecord{ResponseCode: 200, TimeStamp: time.Now()},
+		analytics.AnalyticsRecord{ResponseCode: 429, TimeStamp: time.Now()},
+	}
+	assert.Nil(t, p.WriteData(context.Background(), records))
+
+	// the current window is flushed on shutdown
+	assert.Nil(t, p.Shutdown())
+	assert.Equal(t, float64(2), testutil.ToFloat64(p.AggregateTotalRecords))
+	assert.Equal(t, float64(50), testutil.ToFloat64(p.AggregateErrorRate))
+}
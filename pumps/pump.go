@@ -32,10 +32,30 @@ type Pump interface {
 	SetLogLevel(logrus.Level)
 	SetIgnoreFields([]string)
 	GetIgnoreFields() []string
+	SetAllowedFields([]string)
+	GetAllowedFields() []string
+	SetCollapseWindow(int)
+	GetCollapseWindow() int
+	SetSortByTimestamp(bool)
+	GetSortByTimestamp() bool
+	SetProcessedBy(string)
+	GetProcessedBy() string
 	SetDecodingResponse(bool)
 	GetDecodedResponse() bool
 	SetDecodingRequest(bool)
 	GetDecodedRequest() bool
+	SetDetailedRecordingAPIIDs([]string)
+	GetDetailedRecordingAPIIDs() []string
+	SetLogSampleRate(int)
+	GetLogSampleRate() int
+	LogSampledRecords([]interface{})
+	SetSampling(SamplingConf)
+	GetSampling() SamplingConf
+	SampleRecord(analytics.AnalyticsRecord) bool
+	SetErrorLogSampling(ErrorLogSamplingConf)
+	GetErrorLogSampling() ErrorLogSamplingConf
+	SampleErrorLog(string) (bool, int)
+	ResetErrorLogSampling() map[string]int
 }
 
 type UptimePump interface {
@@ -54,17 +74,20 @@ func GetPumpByName(name string) (Pump, error) {
 }
 
 func processPumpEnvVars(pump Pump, log *logrus.Entry, cfg interface{}, defaultEnv string) {
-	if envVar := pump.GetEnvPrefix(); envVar != "" {
+	envVar := pump.GetEnvPrefix()
+	if envVar != "" {
 		log.Debug(fmt.Sprintf("Checking %s env variables with prefix %s", pump.GetName(), envVar))
-		overrideErr := envconfig.Process(envVar, cfg)
-		if overrideErr != nil {
-			log.Error(fmt.Sprintf("Failed to process environment variables for %s pump %s with err:%v ", envVar, pump.GetName(), overrideErr))
-		}
 	} else {
+		envVar = defaultEnv
 		log.Debug(fmt.Sprintf("Checking default %s env variables with prefix %s", pump.GetName(), defaultEnv))
-		overrideErr := envconfig.Process(defaultEnv, cfg)
-		if overrideErr != nil {
-			log.Error(fmt.Sprintf("Failed to process environment variables for %s pump %s with err:%v ", defaultEnv, pump.GetName(), overrideErr))
-		}
+	}
+
+	overrideErr := envconfig.Process(envVar, cfg)
+	if overrideErr != nil {
+		log.Error(fmt.Sprintf("Failed to process environment variables for %s pump %s with err:%v ", envVar, pump.GetName(), overrideErr))
+	}
+	typedErr := ProcessTypedEnvVars(envVar, cfg)
+	if typedErr != nil {
+		log.Error(fmt.Sprintf("Failed to process typed environment variables for %s pump %s with err:%v ", envVar, pump.GetName(), typedErr))
 	}
 }
@@ -0,0 +1,422 @@
+package pumps
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gofrs/uuid"
+	"github.com/mitchellh/mapstructure"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+type S3PutObjectAPI interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+type S3ParquetPump struct {
+	client   S3PutObjectAPI
+	conf     *S3ParquetConf
+	mu       sync.Mutex
+	buffer   []S3ParquetRecord
+	flushMu  sync.Mutex
+	stop     chan struct{}
+	done     chan struct{}
+	manifest *fileManifest
+	CommonPumpConfig
+}
+
+const (
+	s3ParquetPrefix               = "s3-parquet-pump"
+	s3ParquetDefaultENV           = PUMPS_ENV_PREFIX + "_S3PARQUET" + PUMPS_ENV_META_PREFIX
+	s3ParquetDefaultRegion        = "us-east-1"
+	s3ParquetDefaultMaxRecords    = 10000
+	s3ParquetDefaultFlushInterval = 60
+	// the default max_buffered_records, in multiples of max_records
+	s3ParquetDefaultBufferedBatches = 10
+	s3ParquetUnknownOrg             = "unknown"
+)
+
+// @PumpConf S3Parquet
+type S3ParquetConf struct {
+	EnvPrefix string `mapstructure:"meta_env_prefix"`
+	// The bucket the Parquet files are uploaded to.
+	Bucket string `json:"bucket" mapstructure:"bucket"`
+	// The prefix of the keys of the Parquet files. The files are uploaded to
+	// `s3://<bucket>/<prefix>/org=<org id>/dt=<YYYY-MM-DD>/<file>.parquet`.
+	Prefix string `json:"prefix" mapstructure:"prefix"`
+	// The AWS region of the bucket. Defaults to `us-east-1`.
+	AWSRegion string `json:"aws_region" mapstructure:"aws_region"`
+	// Custom S3 endpoint, for S3 compatible storages like MinIO. E.g. `http://localhost:9000`.
+	Endpoint string `json:"endpoint" mapstructure:"endpoint"`
+	// Set to true to use path style addressing (`<endpoint>/<bucket>/<key>`), which is usually
+	// required by S3 compatible storages. Defaults to `false`.
+	ForcePathStyle bool `json:"force_path_style" mapstructure:"force_path_style"`
+	// Number of buffered records that triggers an upload. Defaults to 10000.
+	MaxRecords int `json:"max_records" mapstructure:"max_records"`
+	// Maximum time in seconds the records are buffered before being uploaded. Defaults to 60.
+	FlushInterval int `json:"flush_interval" mapstructure:"flush_interval"`
+	// Maximum number of records kept in the buffer while the uploads fail. The oldest records
+	// beyond it are dropped. Defaults to 10 times `max_records`.
+	MaxBufferedRecords int `json:"max_buffered_records" mapstructure:"max_buffered_records"`
+	// The local path of a manifest of the uploaded Parquet files, listing the `s3://` URI, the
+	// number of records, the time range and the size of each of them, for the downstream ETL. It's
+	// rewritten after each upload. Disabled by default.
+	ManifestPath string `json:"manifest_path" mapstructure:"manifest_path"`
+	// The format of the manifest, `json` or `csv`. Defaults to `json`.
+	ManifestFormat string `json:"manifest_format" mapstructure:"manifest_format"`
+}
+
+// S3ParquetRecord is the Parquet schema of the analytics records written by the S3 Parquet pump.
+type S3ParquetRecord struct {
+	TimeStamp       int64    `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Method          string   `parquet:"name=method, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Host            string   `parquet:"name=host, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Path            string   `parquet:"name=path, type=BYTE_ARRAY, convertedtype=UTF8"`
+	RawPath         string   `parquet:"name=raw_path, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ContentLength   int64    `parquet:"name=content_length, type=INT64"`
+	UserAgent       string   `parquet:"name=user_agent, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ResponseCode    int32    `parquet:"name=response_code, type=INT32"`
+	APIKey          string   `parquet:"name=api_key, type=BYTE_ARRAY, convertedtype=UTF8"`
+	APIVersion      string   `parquet:"name=api_version, type=BYTE_ARRAY, convertedtype=UTF8"`
+	APIName         string   `parquet:"name=api_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	APIID           string   `parquet:"name=api_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	OrgID           string   `parquet:"name=org_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	OauthID         string   `parquet:"name=oauth_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	RequestTime     int64    `parquet:"name=request_time, type=INT64"`
+	RawRequest      string   `parquet:"name=raw_request, type=BYTE_ARRAY, convertedtype=UTF8"`
+	RawResponse     string   `parquet:"name=raw_response, type=BYTE_ARRAY, convertedtype=UTF8"`
+	IPAddress       string   `parquet:"name=ip_address, type=BYTE_ARRAY, convertedtype=UTF8"`
+	CountryISOCode  string   `parquet:"name=country_iso_code, type=BYTE_ARRAY, convertedtype=UTF8"`
+	LatencyTotal    int64    `parquet:"name=latency_total, type=INT64"`
+	LatencyUpstream int64    `parquet:"name=latency_upstream, type=INT64"`
+	Tags            []string `parquet:"name=tags, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	Alias           string   `parquet:"name=alias, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TrackPath       bool     `parquet:"name=track_path, type=BOOLEAN"`
+	// the enrichment fields of the record, JSON encoded
+	Enrichment string `parquet:"name=enrichment, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+// newS3ParquetRecord returns the Parquet row of record.
+func newS3ParquetRecord(record analytics.AnalyticsRecord) S3ParquetRecord {
+	return S3ParquetRecord{
+		TimeStamp:       record.TimeStamp.UnixMilli(),
+		Method:          record.Method,
+		Host:            record.Host,
+		Path:            record.Path,
+		RawPath:         record.RawPath,
+		ContentLength:   record.ContentLength,
+		UserAgent:       record.UserAgent,
+		ResponseCode:    int32(record.ResponseCode),
+		APIKey:          record.APIKey,
+		APIVersion:      record.APIVersion,
+		APIName:         record.APIName,
+		APIID:           record.APIID,
+		OrgID:           record.OrgID,
+		OauthID:         record.OauthID,
+		RequestTime:     record.RequestTime,
+		RawRequest:      record.RawRequest,
+		RawResponse:     record.RawResponse,
+		IPAddress:       record.IPAddress,
+		CountryISOCode:  record.Geo.Country.ISOCode,
+		LatencyTotal:    record.Latency.Total,
+		LatencyUpstream: record.Latency.Upstream,
+		Tags:            record.Tags,
+		Alias:           record.Alias,
+		TrackPath:       record.TrackPath,
+		Enrichment:      record.Enrichment.JSONValue(),
+	}
+}
+
+// s3ParquetPartition identifies the files a record is written to.
+type s3ParquetPartition struct {
+	orgID string
+	date  string
+}
+
+func (s *S3ParquetPump) New() Pump {
+	newPump := S3ParquetPump{}
+	return &newPump
+}
+
+func (s *S3ParquetPump) GetName() string {
+	return "S3 Parquet Pump"
+}
+
+func (s *S3ParquetPump) GetEnvPrefix() string {
+	return s.conf.EnvPrefix
+}
+
+func (s *S3ParquetPump) Init(conf interface{}) error {
+	s.conf = &S3ParquetConf{}
+	s.log = log.WithField("prefix", s3ParquetPrefix)
+
+	err := mapstructure.Decode(conf, &s.conf)
+	if err != nil {
+		s.log.Fatal("Failed to decode configuration: ", err)
+	}
+
+	processPumpEnvVars(s, s.log, s.conf, s3ParquetDefaultENV)
+
+	if s.conf.Bucket == "" {
+		return errors.New("missing \"bucket\" in pump configuration")
+	}
+	if s.conf.AWSRegion == "" {
+		s.conf.AWSRegion = s3ParquetDefaultRegion
+	}
+	if s.conf.MaxRecords <= 0 {
+		s.conf.MaxRecords = s3ParquetDefaultMaxRecords
+	}
+	if s.conf.FlushInterval <= 0 {
+		s.conf.FlushInterval = s3ParquetDefaultFlushInterval
+	}
+	if s.conf.MaxBufferedRecords <= 0 {
+		s.conf.MaxBufferedRecords = s3ParquetDefaultBufferedBatches * s.conf.MaxRecords
+	}
+
+	s.client, err = s.newS3Client()
+	if err != nil {
+		s.log.Error("Failed to create S3 client: ", err)
+		return err
+	}
+
+	if s.conf.ManifestPath != "" {
+		s.manifest, err = openFileManifest(s.conf.ManifestPath, s.conf.ManifestFormat)
+		if err != nil {
+			s.log.Error("Failed to open the manifest: ", err)
+			return err
+		}
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.flushLoop(time.Duration(s.conf.FlushInterval) * time.Second)
+
+	s.log.Info(s.GetName() + " Initialized")
+	return nil
+}
+
+func (s *S3ParquetPump) newS3Client() (*s3.Client, error) {
+	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(s.conf.AWSRegion))
+	if err != nil {
+		return nil, err
+	}
+
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if s.conf.Endpoint != "" {
+			o.EndpointResolver = s3.EndpointResolverFromURL(s.conf.Endpoint)
+		}
+		o.UsePathStyle = s.conf.ForcePathStyle
+	}), nil
+}
+
+// flushLoop uploads the buffered records every interval, until the pump is shut down.
+func (s *S3ParquetPump) flushLoop(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			release := AcquireGoroutine()
+			// the upload errors are logged by flush
+			_ = s.flush(context.Background())
+			release()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *S3ParquetPump) WriteData(ctx context.Context, data []interface{}) error {
+	s.log.Debug("Attempting to write ", len(data), " records...")
+
+	s.mu.Lock()
+	for _, v := range data {
+		record, ok := v.(analytics.AnalyticsRecord)
+		if !ok {
+			s.log.Error("Error while writing ", v, ": data not of type analytics.AnalyticsRecord")
+			continue
+		}
+		s.buffer = append(s.buffer, newS3ParquetRecord(record))
+	}
+	s.trimBuffer()
+	full := len(s.buffer) >= s.conf.MaxRecords
+	s.mu.Unlock()
+
+	if full {
+		return s.flush(ctx)
+	}
+	return nil
+}
+
+// flush uploads the buffered records, one Parquet file per partition. The records of the
+// partitions that fail to upload are kept in the buffer for the next flush. The buffer isn't
+// locked during the uploads, the records written meanwhile are buffered after the failed ones.
+func (s *S3ParquetPump) flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	buffered := s.buffer
+	s.buffer = nil
+	s.mu.Unlock()
+
+	if len(buffered) == 0 {
+		return nil
+	}
+
+	partitions := make(map[s3ParquetPartition][]S3ParquetRecord)
+	for _, record := range buffered {
+		partition := s3ParquetPartitionOf(record)
+		partitions[partition] = append(partitions[partition], record)
+	}
+
+	var failed []S3ParquetRecord
+	var lastErr error
+	for _, partition := range sortedS3ParquetPartitions(partitions) {
+		records := partitions[partition]
+		if err := s.upload(ctx, partition, records); err != nil {
+			s.log.Error(err)
+			failed = append(failed, records...)
+			lastErr = err
+			continue
+		}
+		s.log.Info("Purged ", len(records), " records to org=", partition.orgID, "/dt=", partition.date)
+	}
+
+	if len(failed) > 0 {
+		s.mu.Lock()
+		s.buffer = append(failed, s.buffer...)
+		s.trimBuffer()
+		s.mu.Unlock()
+	}
+
+	return lastErr
+}
+
+// trimBuffer drops the oldest buffered records beyond max_buffered_records. s.mu must be held.
+func (s *S3ParquetPump) trimBuffer() {
+	max := s.conf.MaxBufferedRecords
+	if max <= 0 || len(s.buffer) <= max {
+		return
+	}
+	dropped := len(s.buffer) - max
+	s.log.Warning("Buffer full, dropping the ", dropped, " oldest records")
+	s.buffer = append([]S3ParquetRecord(nil), s.buffer[dropped:]...)
+}
+
+func (s *S3ParquetPump) upload(ctx context.Context, partition s3ParquetPartition, records []S3ParquetRecord) error {
+	body, err := encodeS3ParquetRecords(records)
+	if err != nil {
+		return fmt.Errorf("error writing parquet file: %w", err)
+	}
+
+	key, err := s.objectKey(partition)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.conf.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/vnd.apache.parquet"),
+	})
+	if err != nil {
+		return fmt.Errorf("error uploading %s: %w", key, err)
+	}
+
+	if s.manifest != nil {
+		var first, last int64
+		for i, record := range records {
+			if i == 0 || record.TimeStamp < first {
+				first = record.TimeStamp
+			}
+			if record.TimeStamp > last {
+				last = record.TimeStamp
+			}
+		}
+		uri := "s3://" + s.conf.Bucket + "/" + key
+		if err := s.manifest.add(uri, int64(len(records)), time.UnixMilli(first).UTC(), time.UnixMilli(last).UTC(), int64(len(body))); err != nil {
+			s.log.Error("Failed to update the manifest: ", err)
+		}
+	}
+	return nil
+}
+
+// encodeS3ParquetRecords returns the Snappy compressed Parquet file of records.
+func encodeS3ParquetRecords(records []S3ParquetRecord) ([]byte, error) {
+	var body bytes.Buffer
+	pw, err := writer.NewParquetWriterFromWriter(&body, new(S3ParquetRecord), 1)
+	if err != nil {
+		return nil, err
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	for _, record := range records {
+		if err := pw.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// objectKey returns a unique key for a new file of partition.
+func (s *S3ParquetPump) objectKey(partition s3ParquetPartition) (string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%d-%s.parquet", time.Now().UnixNano(), id)
+	return path.Join(s.conf.Prefix, "org="+url.PathEscape(partition.orgID), "dt="+partition.date, name), nil
+}
+
+func s3ParquetPartitionOf(record S3ParquetRecord) s3ParquetPartition {
+	orgID := record.OrgID
+	if orgID == "" {
+		orgID = s3ParquetUnknownOrg
+	}
+	return s3ParquetPartition{
+		orgID: orgID,
+		date:  time.UnixMilli(record.TimeStamp).UTC().Format("2006-01-02"),
+	}
+}
+
+func sortedS3ParquetPartitions(partitions map[s3ParquetPartition][]S3ParquetRecord) []s3ParquetPartition {
+	sorted := make([]s3ParquetPartition, 0, len(partitions))
+	for partition := range partitions {
+		sorted = append(sorted, partition)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].orgID != sorted[j].orgID {
+			return sorted[i].orgID < sorted[j].orgID
+		}
+		return sorted[i].date < sorted[j].date
+	})
+	return sorted
+}
+
+// Shutdown stops the periodic uploads and uploads the buffered records.
+func (s *S3ParquetPump) Shutdown() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+		s.stop = nil
+	}
+	return s.flush(context.Background())
+}
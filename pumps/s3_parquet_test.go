@@ -0,0 +1,269 @@
+package pumps
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// fakeS3 stores the objects uploaded with PutObject, keyed by path.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	f.mu.Lock()
+	f.objects[r.URL.Path] = body
+	f.mu.Unlock()
+	w.Header().Set("ETag", `"etag"`)
+}
+
+func (f *fakeS3) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func readS3ParquetRecords(t *testing.T, data []byte) []S3ParquetRecord {
+	t.Helper()
+	file, err := buffer.NewBufferFile(data)
+	assert.Nil(t, err)
+	pr, err := reader.NewParquetReader(file, new(S3ParquetRecord), 1)
+	assert.Nil(t, err)
+	defer pr.ReadStop()
+
+	records := make([]S3ParquetRecord, pr.GetNumRows())
+	assert.Nil(t, pr.Read(&records))
+	return records
+}
+
+func TestS3ParquetPump(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	s3Server := &fakeS3{objects: map[string][]byte{}}
+	server := httptest.NewServer(s3Server)
+	defer server.Close()
+
+	pmp := &S3ParquetPump{}
+	err := pmp.Init(map[string]interface{}{
+		"bucket":           "analytics",
+		"prefix":           "tyk",
+		"endpoint":         server.URL,
+		"force_path_style": true,
+		"max_records":      3,
+		"flush_interval":   3600,
+	})
+	assert.Nil(t, err)
+
+	day1 := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	records := []interface{}{
+		analytics.AnalyticsRecord{OrgID: "org1", APIID: "api1", Path: "/get", ResponseCode: 200, TimeStamp: day1, Tags: []string{"a", "b"}, Enrichment: analytics.Enrichment{IsBot: true}},
+		analytics.AnalyticsRecord{OrgID: "org1", APIID: "api1", Path: "/post", ResponseCode: 201, TimeStamp: day1},
+		analytics.AnalyticsRecord{OrgID: "org2", APIID: "api2", Path: "/get", ResponseCode: 500, TimeStamp: day2},
+	}
+
+	// the records are buffered until max_records are reached
+	assert.Nil(t, pmp.WriteData(context.Background(), records[:2]))
+	assert.Empty(t, s3Server.keys())
+	assert.Nil(t, pmp.WriteData(context.Background(), records[2:]))
+
+	keys := s3Server.keys()
+	assert.Len(t, keys, 2)
+	assert.True(t, strings.HasPrefix(keys[0], "/analytics/tyk/org=org1/dt=2023-10-01/"), keys[0])
+	assert.True(t, strings.HasPrefix(keys[1], "/analytics/tyk/org=org2/dt=2023-10-02/"), keys[1])
+	for _, key := range keys {
+		assert.True(t, strings.HasSuffix(key, ".parquet"), key)
+	}
+
+	rows := readS3ParquetRecords(t, s3Server.objects[keys[0]])
+	assert.Equal(t, []S3ParquetRecord{
+		{OrgID: "org1", APIID: "api1", Path: "/get", ResponseCode: 200, TimeStamp: day1.UnixMilli(), Tags: []string{"a", "b"}, Enrichment: `{"is_bot":true}`},
+		{OrgID: "org1", APIID: "api1", Path: "/post", ResponseCode: 201, TimeStamp: day1.UnixMilli(), Tags: []string{}, Enrichment: "{}"},
+	}, rows)
+	rows = readS3ParquetRecords(t, s3Server.objects[keys[1]])
+	assert.Len(t, rows, 1)
+	assert.Equal(t, "api2", rows[0].APIID)
+	assert.Equal(t, int32(500), rows[0].ResponseCode)
+
+	// shutdown uploads the current buffer
+	assert.Nil(t, pmp.WriteData(context.Background(), []interface{}{analytics.AnalyticsRecord{APIID: "api3", TimeStamp: day2}}))
+	assert.Len(t, s3Server.keys(), 2)
+	assert.Nil(t, pmp.Shutdown())
+
+	keys = s3Server.keys()
+	assert.Len(t, keys, 3)
+	var unknownOrgKey string
+	for _, key := range keys {
+		if strings.HasPrefix(key, "/analytics/tyk/org=unknown/dt=2023-10-02/") {
+			unknownOrgKey = key
+		}
+	}
+	assert.NotEmpty(t, unknownOrgKey)
+	rows = readS3ParquetRecords(t, s3Server.objects[unknownOrgKey])
+	assert.Len(t, rows, 1)
+	assert.Equal(t, "api3", rows[0].APIID)
+}
+
+type failingS3Client struct {
+	fail  bool
+	calls int
+}
+
+func (f *failingS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	f.calls++
+	if f.fail {
+		return nil, errors.New("unavailable")
+	}
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestS3ParquetPumpFailedUpload(t *testing.T) {
+	client := &failingS3Client{fail: true}
+	pmp := &S3ParquetPump{
+		client: client,
+		conf:   &S3ParquetConf{Bucket: "analytics", MaxRecords: 1},
+	}
+	pmp.log = log.WithField("prefix", s3ParquetPrefix)
+
+	record := analytics.AnalyticsRecord{OrgID: "org1", TimeStamp: time.Now()}
+	assert.NotNil(t, pmp.WriteData(context.Background(), []interface{}{record}))
+	assert.Len(t, pmp.buffer, 1)
+
+	// the records are kept and uploaded by the next flush
+	client.fail = false
+	assert.Nil(t, pmp.Shutdown())
+	assert.Empty(t, pmp.buffer)
+	assert.Equal(t, 2, client.calls)
+}
+
+func TestS3ParquetPumpMaxBufferedRecords(t *testing.T) {
+	client := &failingS3Client{fail: true}
+	pmp := &S3ParquetPump{
+		client: client,
+		conf:   &S3ParquetConf{Bucket: "analytics", MaxRecords: 1, MaxBufferedRecords: 2},
+	}
+	pmp.log = log.WithField("prefix", s3ParquetPrefix)
+
+	for _, apiID := range []string{"api1", "api2", "api3"} {
+		record := analytics.AnalyticsRecord{APIID: apiID, OrgID: "org1", TimeStamp: time.Now()}
+		assert.NotNil(t, pmp.WriteData(context.Background(), []interface{}{record}))
+	}
+
+	// the oldest record is dropped
+	assert.Len(t, pmp.buffer, 2)
+	assert.Equal(t, "api2", pmp.buffer[0].APIID)
+	assert.Equal(t, "api3", pmp.buffer[1].APIID)
+}
+
+// blockingS3Client blocks the uploads until release is closed.
+type blockingS3Client struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	close(b.started)
+	<-b.release
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestS3ParquetPumpWriteDuringUpload(t *testing.T) {
+	client := &blockingS3Client{started: make(chan struct{}), release: make(chan struct{})}
+	pmp := &S3ParquetPump{
+		client: client,
+		conf:   &S3ParquetConf{Bucket: "analytics", MaxRecords: 2},
+	}
+	pmp.log = log.WithField("prefix", s3ParquetPrefix)
+
+	record := analytics.AnalyticsRecord{OrgID: "org1", TimeStamp: time.Now()}
+	uploaded := make(chan error)
+	go func() {
+		uploaded <- pmp.WriteData(context.Background(), []interface{}{record, record})
+	}()
+	<-client.started
+
+	// the records are buffered while the upload is in progress
+	assert.Nil(t, pmp.WriteData(context.Background(), []interface{}{record}))
+	close(client.release)
+	assert.Nil(t, <-uploaded)
+	assert.Len(t, pmp.buffer, 1)
+}
+
+func TestS3ParquetPumpInit(t *testing.T) {
+	pmp := &S3ParquetPump{}
+	err := pmp.Init(map[string]interface{}{})
+	assert.EqualError(t, err, "missing \"bucket\" in pump configuration")
+}
+
+func TestS3ParquetPumpManifest(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	s3Server := &fakeS3{objects: map[string][]byte{}}
+	server := httptest.NewServer(s3Server)
+	defer server.Close()
+
+	manifestPath := filepath.Join(t.TempDir(), "manifest.csv")
+	pmp := &S3ParquetPump{}
+	err := pmp.Init(map[string]interface{}{
+		"bucket":           "analytics",
+		"endpoint":         server.URL,
+		"force_path_style": true,
+		"flush_interval":   3600,
+		"manifest_path":    manifestPath,
+		"manifest_format":  "csv",
+	})
+	assert.Nil(t, err)
+
+	day1 := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	assert.Nil(t, pmp.WriteData(context.Background(), []interface{}{
+		analytics.AnalyticsRecord{OrgID: "org1", TimeStamp: day1.Add(time.Minute)},
+		analytics.AnalyticsRecord{OrgID: "org1", TimeStamp: day1},
+	}))
+	assert.Nil(t, pmp.Shutdown())
+
+	keys := s3Server.keys()
+	assert.Len(t, keys, 1)
+	manifest, err := openFileManifest(manifestPath, "csv")
+	assert.Nil(t, err)
+	assert.Equal(t, []FileManifestEntry{{
+		Path:           "s3:/" + keys[0],
+		Records:        2,
+		FirstTimestamp: day1,
+		LastTimestamp:  day1.Add(time.Minute),
+		SizeBytes:      int64(len(s3Server.objects[keys[0]])),
+	}}, manifest.Entries())
+}
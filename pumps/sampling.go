@@ -0,0 +1,36 @@
+package pumps
+
+import (
+	"sync/atomic"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+// SamplingConf samples the records written to a pump.
+type SamplingConf struct {
+	// One of every Rate records is written. Defaults to 0, all of them.
+	Rate int `json:"rate" mapstructure:"rate"`
+	// Writes all the records with an error response code, 400 or above, and only samples the
+	// others. Defaults to false, the errors are sampled too.
+	KeepErrors bool `json:"keep_errors" mapstructure:"keep_errors"`
+}
+
+func (p *CommonPumpConfig) SetSampling(sampling SamplingConf) {
+	p.sampling = sampling
+}
+
+func (p *CommonPumpConfig) GetSampling() SamplingConf {
+	return p.sampling
+}
+
+// SampleRecord returns whether the record is written: one of every sampling rate records, and
+// every error record when the errors are kept. The count is kept across writes.
+func (p *CommonPumpConfig) SampleRecord(record analytics.AnalyticsRecord) bool {
+	if p.sampling.Rate <= 1 {
+		return true
+	}
+	if p.sampling.KeepErrors && record.ResponseCode >= 400 {
+		return true
+	}
+	return atomic.AddUint64(&p.sampleCounter, 1)%uint64(p.sampling.Rate) == 0
+}
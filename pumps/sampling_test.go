@@ -0,0 +1,57 @@
+package pumps
+
+import (
+	"testing"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleRecord(t *testing.T) {
+	tcs := []struct {
+		testName        string
+		sampling        SamplingConf
+		expectedSuccess int
+		expectedErrors  int
+	}{
+		{
+			testName:        "no sampling",
+			expectedSuccess: 100,
+			expectedErrors:  100,
+		},
+		{
+			testName:        "errors sampled",
+			sampling:        SamplingConf{Rate: 10},
+			expectedSuccess: 10,
+			expectedErrors:  10,
+		},
+		{
+			testName:        "errors kept",
+			sampling:        SamplingConf{Rate: 10, KeepErrors: true},
+			expectedSuccess: 10,
+			expectedErrors:  100,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			p := &CommonPumpConfig{}
+			p.SetSampling(tc.sampling)
+
+			success, errors := 0, 0
+			for i := 0; i < 100; i++ {
+				if p.SampleRecord(analytics.AnalyticsRecord{ResponseCode: 200}) {
+					success++
+				}
+			}
+			for i := 0; i < 100; i++ {
+				// the errors are 4xx and 5xx
+				if p.SampleRecord(analytics.AnalyticsRecord{ResponseCode: 400 + i%2*100}) {
+					errors++
+				}
+			}
+			assert.Equal(t, tc.expectedSuccess, success)
+			assert.Equal(t, tc.expectedErrors, errors)
+		})
+	}
+}
@@ -2,10 +2,12 @@ package pumps
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
@@ -22,6 +24,8 @@ const (
 	splunkPumpPrefix = "splunk-pump"
 	splunkPumpName   = "Splunk Pump"
 	splunkDefaultENV = PUMPS_ENV_PREFIX + "_SPLUNK" + PUMPS_ENV_META_PREFIX
+
+	splunkCompressionGzip = "gzip"
 )
 
 var (
@@ -35,6 +39,8 @@ type SplunkClient struct {
 	Token         string
 	CollectorURL  string
 	TLSSkipVerify bool
+	// Compression is the encoding of the request bodies, `gzip` or empty for none.
+	Compression string
 
 	httpClient *http.Client
 }
@@ -85,6 +91,17 @@ type SplunkPumpConfig struct {
 	// the amount of bytes, they're send anyways in each `purge_loop`. Default value is 838860800
 	// (~ 800 MB), the same default value as Splunk config.
 	BatchMaxContentLength int `json:"batch_max_content_length" mapstructure:"batch_max_content_length"`
+	// The compression of the requests sent to Splunk, `gzip` or empty for none. The batches are
+	// compressed as a whole, and `batch_max_content_length` applies to their uncompressed size.
+	// Default value is `""`, no compression.
+	Compression string `json:"compression" mapstructure:"compression"`
+	// The maximum size in bytes of the body of each request sent to Splunk, to stay under the
+	// intake limits. If set, the records are sent in batches of at most this size, as with
+	// `enable_batch` and a lower `batch_max_content_length`. A record bigger than the limit is sent
+	// on its own. The limit applies to the uncompressed size. Default value is `0`, no limit.
+	MaxPayloadBytes int `json:"max_payload_bytes" mapstructure:"max_payload_bytes"`
+	// The `max_idle_conns` and `max_conns_per_host` limits of the connections to Splunk.
+	HTTPClientConf `mapstructure:",squash"`
 }
 
 // New initializes a new pump.
@@ -113,12 +130,27 @@ func (p *SplunkPump) Init(config interface{}) error {
 
 	processPumpEnvVars(p, p.log, p.config, splunkDefaultENV)
 
+	if p.config.Compression != "" && p.config.Compression != splunkCompressionGzip {
+		return fmt.Errorf("invalid compression %q, expected %q or none", p.config.Compression, splunkCompressionGzip)
+	}
+
 	p.log.Infof("%s Endpoint: %s", splunkPumpName, p.config.CollectorURL)
 
-	p.client, err = NewSplunkClient(p.config.CollectorToken, p.config.CollectorURL, p.config.SSLInsecureSkipVerify, p.config.SSLCertFile, p.config.SSLKeyFile, p.config.SSLServerName)
+	p.client, err = NewSplunkClient(p.config.CollectorToken, p.config.CollectorURL, p.config.SSLInsecureSkipVerify, p.config.SSLCertFile, p.config.SSLKeyFile, p.config.SSLServerName, p.config.HTTPClientConf)
 	if err != nil {
 		return err
 	}
+	p.client.Compression = p.config.Compression
+
+	if p.config.MaxPayloadBytes < 0 {
+		return fmt.Errorf("invalid max_payload_bytes %d", p.config.MaxPayloadBytes)
+	}
+	if p.config.MaxPayloadBytes > 0 {
+		p.config.EnableBatch = true
+		if p.config.BatchMaxContentLength == 0 || p.config.BatchMaxContentLength > p.config.MaxPayloadBytes {
+			p.config.BatchMaxContentLength = p.config.MaxPayloadBytes
+		}
+	}
 
 	if p.config.EnableBatch && p.config.BatchMaxContentLength == 0 {
 		p.config.BatchMaxContentLength = maxContentLength
@@ -196,6 +228,7 @@ func (p *SplunkPump) WriteData(ctx context.Context, data []interface{}) error {
 			"network":        decoded.Network,
 			"latency":        decoded.Latency,
 			"tags":           decoded.Tags,
+			"tag_map":        decoded.TagMap,
 			"alias":          decoded.Alias,
 			"track_path":     decoded.TrackPath,
 		}
@@ -252,12 +285,15 @@ func (p *SplunkPump) WriteData(ctx context.Context, data []interface{}) error {
 
 		if p.config.EnableBatch {
 			//if we're batching and the len of our data is already bigger than max_content_length, we send the data and reset the buffer
-			if batchBuffer.Len()+len(data) > p.config.BatchMaxContentLength {
+			if batchBuffer.Len() > 0 && batchBuffer.Len()+len(data) > p.config.BatchMaxContentLength {
 				if err := fnSendBytes(batchBuffer.Bytes()); err != nil {
 					return err
 				}
 				batchBuffer.Reset()
 			}
+			if len(data) > p.config.BatchMaxContentLength {
+				p.log.Warning("Record of ", len(data), " bytes over the max content length of ", p.config.BatchMaxContentLength, " bytes, sending it on its own")
+			}
 			batchBuffer.Write(data)
 		} else {
 			if err := fnSendBytes(data); err != nil {
@@ -279,8 +315,8 @@ func (p *SplunkPump) WriteData(ctx context.Context, data []interface{}) error {
 	return nil
 }
 
-// NewSplunkClient initializes a new SplunkClient.
-func NewSplunkClient(token string, collectorURL string, skipVerify bool, certFile string, keyFile string, serverName string) (c *SplunkClient, err error) {
+// NewSplunkClient initializes a new SplunkClient, with its connections limited by httpConf.
+func NewSplunkClient(token string, collectorURL string, skipVerify bool, certFile string, keyFile string, serverName string, httpConf HTTPClientConf) (c *SplunkClient, err error) {
 	if token == "" || collectorURL == "" {
 		return c, errInvalidSettings
 	}
@@ -300,19 +336,29 @@ func NewSplunkClient(token string, collectorURL string, skipVerify bool, certFil
 		}
 		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, ServerName: serverName}
 	}
-	http.DefaultClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
 	// Append the default collector API path:
 	u.Path = defaultPath
 	c = &SplunkClient{
 		Token:        token,
 		CollectorURL: u.String(),
-		httpClient:   http.DefaultClient,
+		httpClient:   newHTTPClient(httpConf, tlsConfig),
 	}
 	return c, nil
 }
 
 // Send sends an event to the Splunk HTTP Event Collector interface.
 func (c *SplunkClient) Send(ctx context.Context, data []byte) (*http.Response, error) {
+	if c.Compression == splunkCompressionGzip {
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		data = compressed.Bytes()
+	}
 
 	reader := bytes.NewReader(data)
 	req, err := http.NewRequest("POST", c.CollectorURL, reader)
@@ -321,5 +367,8 @@ func (c *SplunkClient) Send(ctx context.Context, data []byte) (*http.Response, e
 	}
 	req = req.WithContext(ctx)
 	req.Header.Add(authHeaderName, authHeaderPrefix+c.Token)
+	if c.Compression == splunkCompressionGzip {
+		req.Header.Set("Content-Encoding", splunkCompressionGzip)
+	}
 	return c.httpClient.Do(req)
 }
@@ -1,6 +1,8 @@
 package pumps
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -65,15 +67,15 @@ func (h *testHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func TestSplunkInit(t *testing.T) {
-	_, err := NewSplunkClient("", testEndpointURL, true, "", "", "")
+	_, err := NewSplunkClient("", testEndpointURL, true, "", "", "", HTTPClientConf{})
 	if err == nil {
 		t.Fatal("A token needs to be present")
 	}
-	_, err = NewSplunkClient(testToken, "", true, "", "", "")
+	_, err = NewSplunkClient(testToken, "", true, "", "", "", HTTPClientConf{})
 	if err == nil {
 		t.Fatal("An endpoint needs to be present", "", "")
 	}
-	_, err = NewSplunkClient("", "", true, "", "", "")
+	_, err = NewSplunkClient("", "", true, "", "", "", HTTPClientConf{})
 	if err == nil {
 		t.Fatal("Empty parameters should return an error")
 	}
@@ -151,6 +153,125 @@ func Test_SplunkWriteDataBatch(t *testing.T) {
 
 }
 
+func Test_SplunkWriteDataCompression(t *testing.T) {
+	var bodies [][]byte
+	var encodings []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, body)
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		w.Write([]byte(`{"text":"Success","code":0}`))
+	}))
+	defer server.Close()
+
+	keys := []interface{}{
+		analytics.AnalyticsRecord{OrgID: "1", APIID: "123", Path: "/test-path", Method: "POST", TimeStamp: time.Now()},
+		analytics.AnalyticsRecord{OrgID: "1", APIID: "456", Path: "/other-path", Method: "GET", TimeStamp: time.Now()},
+	}
+
+	pmp := SplunkPump{}
+	cfg := map[string]interface{}{
+		"collector_token":          testToken,
+		"collector_url":            server.URL,
+		"ssl_insecure_skip_verify": true,
+		"enable_batch":             true,
+		"compression":              "gzip",
+	}
+	assert.NoError(t, pmp.Init(cfg))
+	assert.NoError(t, pmp.WriteData(context.TODO(), keys))
+
+	assert.Len(t, bodies, 1)
+	assert.Equal(t, []string{"gzip"}, encodings)
+
+	reader, err := gzip.NewReader(bytes.NewReader(bodies[0]))
+	assert.NoError(t, err)
+	decompressed, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, getEventBytes(keys), len(decompressed))
+
+	decoder := json.NewDecoder(bytes.NewReader(decompressed))
+	for _, key := range keys {
+		event := struct {
+			Event map[string]interface{} `json:"event"`
+		}{}
+		assert.NoError(t, decoder.Decode(&event))
+		assert.Equal(t, key.(analytics.AnalyticsRecord).APIID, event.Event["api_id"])
+	}
+	assert.False(t, decoder.More())
+
+	// the requests are uncompressed by default
+	bodies, encodings = nil, nil
+	delete(cfg, "compression")
+	pmp = SplunkPump{}
+	assert.NoError(t, pmp.Init(cfg))
+	assert.NoError(t, pmp.WriteData(context.TODO(), keys))
+	assert.Equal(t, []string{""}, encodings)
+	assert.Equal(t, getEventBytes(keys), len(bodies[0]))
+
+	cfg["compression"] = "zstd"
+	assert.Error(t, (&SplunkPump{}).Init(cfg))
+}
+
+func Test_SplunkWriteDataMaxPayloadBytes(t *testing.T) {
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, body)
+		w.Write([]byte(`{"text":"Success","code":0}`))
+	}))
+	defer server.Close()
+
+	keys := []interface{}{}
+	for i := 0; i < 10; i++ {
+		keys = append(keys, analytics.AnalyticsRecord{APIID: fmt.Sprint(i), RawRequest: strings.Repeat("a", 1000), TimeStamp: time.Now()})
+	}
+	recordBytes := getEventBytes(keys[:1])
+
+	pmp := SplunkPump{}
+	cfg := map[string]interface{}{
+		"collector_token":          testToken,
+		"collector_url":            server.URL,
+		"ssl_insecure_skip_verify": true,
+		"max_payload_bytes":        3*recordBytes + 10,
+	}
+	assert.NoError(t, pmp.Init(cfg))
+	assert.NoError(t, pmp.WriteData(context.TODO(), keys))
+
+	// the records are batched 3 by 3, each request under the limit
+	assert.Len(t, bodies, 4)
+	total := 0
+	for _, body := range bodies {
+		assert.LessOrEqual(t, len(body), 3*recordBytes+10)
+		total += len(body)
+	}
+	assert.Equal(t, getEventBytes(keys), total)
+
+	// max_payload_bytes lowers batch_max_content_length
+	bodies = nil
+	cfg["enable_batch"] = true
+	cfg["batch_max_content_length"] = 100 * recordBytes
+	pmp = SplunkPump{}
+	assert.NoError(t, pmp.Init(cfg))
+	assert.NoError(t, pmp.WriteData(context.TODO(), keys))
+	assert.Len(t, bodies, 4)
+
+	// a record bigger than the limit is sent on its own
+	bodies = nil
+	cfg["max_payload_bytes"] = recordBytes / 2
+	pmp = SplunkPump{}
+	assert.NoError(t, pmp.Init(cfg))
+	assert.NoError(t, pmp.WriteData(context.TODO(), keys))
+	assert.Len(t, bodies, 10)
+	for _, body := range bodies {
+		assert.NotEmpty(t, body)
+	}
+
+	cfg["max_payload_bytes"] = -1
+	assert.Error(t, (&SplunkPump{}).Init(cfg))
+}
+
 // getEventBytes returns the bytes amount of the marshalled events struct
 func getEventBytes(records []interface{}) int {
 	result := 0
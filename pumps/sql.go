@@ -5,8 +5,12 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/TykTechnologies/tyk-pump/analytics"
+	"github.com/gofrs/uuid"
 	"github.com/mitchellh/mapstructure"
 	"gopkg.in/vmihailenco/msgpack.v2"
 	"gorm.io/gorm/clause"
@@ -45,6 +49,16 @@ type SQLPump struct {
 	db      *gorm.DB
 	dbType  string
 	dialect gorm.Dialector
+	// shardTables holds the sharded tables already checked by ensureShardTable.
+	shardTables map[string]bool
+	// partitions holds the partitions already created by ensurePartition.
+	partitions map[string]bool
+	// tagColumns are the tag_columns.
+	tagColumns []sqlTagColumn
+	// rowModel is the model of the analytics table when it doesn't match the records, with the
+	// tag_columns, the json_columns, the latency_columns or the enrichment_column. It's nil
+	// otherwise.
+	rowModel reflect.Type
 }
 
 // @PumpConf SQL
@@ -70,6 +84,61 @@ type SQLConf struct {
 	// Specifies the amount of records that are going to be written each batch. Type int. By
 	// default, it writes 1000 records max per batch.
 	BatchSize int `json:"batch_size" mapstructure:"batch_size"`
+	// Specifies the record field (by its JSON name, e.g. `correlation_id`) whose value is used as
+	// the `id` primary key of the analytics table. Records with an empty value get a generated id.
+	// Records whose key already exists are skipped, making writes idempotent. The field must be
+	// unique per request: the records sharing the value of a field which isn't, like `oauth_id` or
+	// `api_key`, are dropped but the first. By default, the analytics table has no primary key.
+	// Only applies to new tables.
+	PrimaryKeyField string `json:"primary_key_field" mapstructure:"primary_key_field"`
+	// Set to true to add the missing columns to the existing sharded tables, e.g. when an upgrade
+	// adds fields to the analytics records. Each table is migrated the first time it's written
+	// to. The non sharded table is always migrated on start up. By default, only the new sharded
+	// tables are created with the current schema.
+	AutoMigrate bool `json:"auto_migrate" mapstructure:"auto_migrate"`
+	// Set to true to check the schema of the existing tables instead of migrating them. The pump
+	// fails to start, or to write to a sharded table, if the table lacks any column of the
+	// records. New tables are still created. It takes precedence over `auto_migrate`.
+	StrictSchema bool `json:"strict_schema" mapstructure:"strict_schema"`
+	// Set to true to create the analytics table partitioned by month on the record timestamp,
+	// with Postgres declarative partitioning. The monthly partitions, e.g. `tyk_analytics_202301`,
+	// are created on demand, and Postgres routes the records to them. Only supported with
+	// `postgres`, and not with `table_sharding` or `primary_key_field`. The table mustn't already
+	// exist unpartitioned. By default, `false`.
+	TimePartitioning bool `json:"time_partitioning" mapstructure:"time_partitioning"`
+	// Set to true to leave the network stats columns of the records empty, the
+	// `network_open_connections`, `network_closed_connections`, `network_bytes_in` and
+	// `network_bytes_out` columns, or the `network` column with `json_columns`. The columns are
+	// part of the table either way. By default, `false`, the network stats are written.
+	OmitNetworkStats bool `json:"omit_network_stats" mapstructure:"omit_network_stats"`
+	// Maps tag prefixes to dedicated columns of the analytics table, holding the suffix of the
+	// first tag of the record with the prefix. E.g. `{"team-": "team"}` writes `payments` in the
+	// `team` column for a `team-payments` tag. The columns are lowercase letters, digits and
+	// underscores, and can't be columns of the records.
+	TagColumns map[string]string `json:"tag_columns" mapstructure:"tag_columns"`
+	// Set to true to store the geo data, network stats and tags of the records as JSON documents,
+	// in the `geo`, `network` and `tags` columns, instead of spreading the geo data and network
+	// stats over several columns. The columns are `JSONB` with postgres, `JSON` with mysql and
+	// `TEXT` with sqlite. As it changes the columns, it's better set before the table is created.
+	// By default, `false`.
+	JSONColumns bool `json:"json_columns" mapstructure:"json_columns"`
+	// Set to true to write the flat latency fields of `latency_breakdown` in the `latencytotal`,
+	// `latencyupstream` and `latencygateway` columns. It adds the columns to the table, so it
+	// requires the table to be migrated. By default, `false`, they aren't written.
+	LatencyColumns bool `json:"latency_columns" mapstructure:"latency_columns"`
+	// Set to true to write the fields the pump derives from the records, e.g. the latency
+	// breakdown, the user agent families or the cache status, in an `enrichment` column holding a
+	// JSON document of the fields which are set. It adds the column to the table, so it requires
+	// the table to be migrated. By default, `false`, they aren't written.
+	EnrichmentColumn bool `json:"enrichment_column" mapstructure:"enrichment_column"`
+}
+
+// sqlPrimaryKeyRecord is the row written by the SQL pump when `primary_key_field` is set. The
+// record is inlined, otherwise its columns would be prefixed with `_`, as they're named after
+// the json tags.
+type sqlPrimaryKeyRecord struct {
+	ID                        string `json:"id" gorm:"column:id;primaryKey"`
+	analytics.AnalyticsRecord `json:",inline" gorm:"embedded"`
 }
 
 func Dialect(cfg *SQLConf) (gorm.Dialector, error) {
@@ -150,6 +219,22 @@ func (c *SQLPump) Init(conf interface{}) error {
 		processPumpEnvVars(c, c.log, c.SQLConf, SQLDefaultENV)
 	}
 
+	if c.SQLConf.TimePartitioning && !c.IsUptime {
+		var errPartitioning error
+		switch {
+		case c.SQLConf.Type != "postgres":
+			errPartitioning = errors.New("time_partitioning is only supported with postgres")
+		case c.SQLConf.TableSharding:
+			errPartitioning = errors.New("time_partitioning can't be used with table_sharding")
+		case c.SQLConf.PrimaryKeyField != "":
+			errPartitioning = errors.New("time_partitioning can't be used with primary_key_field")
+		}
+		if errPartitioning != nil {
+			c.log.Error(errPartitioning)
+			return errPartitioning
+		}
+	}
+
 	logLevel := gorm_logger.Silent
 
 	switch c.SQLConf.LogLevel {
@@ -178,11 +263,33 @@ func (c *SQLPump) Init(conf interface{}) error {
 	}
 	c.db = db
 
+	if c.SQLConf.PrimaryKeyField != "" && !hasRecordField(c.SQLConf.PrimaryKeyField) {
+		err := fmt.Errorf("unknown primary_key_field %q", c.SQLConf.PrimaryKeyField)
+		c.log.Error(err)
+		return err
+	}
+
+	if !c.IsUptime {
+		if err := c.initTagColumns(); err != nil {
+			c.log.Error(err)
+			return err
+		}
+		c.initRowModel()
+	}
+
 	if !c.SQLConf.TableSharding {
-		if c.IsUptime {
-			c.db.Table(analytics.UptimeSQLTable).AutoMigrate(&analytics.UptimeReportAggregateSQL{})
-		} else {
-			c.db.Table(analytics.SQLTable).AutoMigrate(&analytics.AnalyticsRecord{})
+		var migrateErr error
+		switch {
+		case c.IsUptime:
+			migrateErr = c.migrateTable(analytics.UptimeSQLTable, &analytics.UptimeReportAggregateSQL{})
+		case c.SQLConf.TimePartitioning:
+			migrateErr = c.migratePartitionedTable(analytics.SQLTable, c.recordModel())
+		default:
+			migrateErr = c.migrateTable(analytics.SQLTable, c.recordModel())
+		}
+		if migrateErr != nil {
+			c.log.Error(migrateErr)
+			return migrateErr
 		}
 	}
 
@@ -228,12 +335,20 @@ func (c *SQLPump) WriteData(ctx context.Context, data []interface{}) error {
 			endIndex = i
 
 			table := analytics.SQLTable + "_" + recDate
-			c.db = c.db.Table(table)
-			if !c.db.Migrator().HasTable(table) {
-				c.db.AutoMigrate(&analytics.AnalyticsRecord{})
+			if err := c.ensureShardTable(table, c.recordModel()); err != nil {
+				c.log.Error(err)
+				return err
 			}
+			c.db = c.db.Table(table)
 		} else {
 			i = dataLen // write all records at once for non-sharded case, stop for loop after 1 iteration
+			if c.SQLConf.TimePartitioning {
+				for _, rec := range typedData {
+					if err := c.ensurePartition(analytics.SQLTable, rec.TimeStamp); err != nil {
+						c.log.Error(err)
+					}
+				}
+			}
 		}
 
 		recs := typedData[startIndex:endIndex]
@@ -243,7 +358,7 @@ func (c *SQLPump) WriteData(ctx context.Context, data []interface{}) error {
 			if ends > len(recs) {
 				ends = len(recs)
 			}
-			tx := c.db.WithContext(ctx).Create(recs[i:ends])
+			tx := c.create(ctx, recs[i:ends])
 			if tx.Error != nil {
 				c.log.Error(tx.Error)
 			}
@@ -258,6 +373,196 @@ func (c *SQLPump) WriteData(ctx context.Context, data []interface{}) error {
 	return nil
 }
 
+// migrateTable creates the table of model or, if it already exists, adds its missing columns.
+// With strict_schema, it checks the schema of an existing table instead.
+func (c *SQLPump) migrateTable(table string, model interface{}) error {
+	db := c.tableDB(table)
+	if c.SQLConf.StrictSchema && db.Migrator().HasTable(table) {
+		return c.checkSchema(table, model)
+	}
+	return db.AutoMigrate(model)
+}
+
+// checkSchema returns an error listing the columns of model that the table lacks, if any.
+func (c *SQLPump) checkSchema(table string, model interface{}) error {
+	missing, err := c.missingColumns(table, model)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("table %s doesn't match the schema of the records, missing columns: %s", table, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// ensureShardTable creates the sharded table if it doesn't exist. With auto_migrate or
+// strict_schema, an existing table gets its missing columns added, or is checked, the first time
+// it's written to.
+func (c *SQLPump) ensureShardTable(table string, model interface{}) error {
+	db := c.tableDB(table)
+	if !db.Migrator().HasTable(table) {
+		// the indexes are named after the base table, so they may already exist for another shard
+		db.AutoMigrate(model)
+		return nil
+	}
+	if !(c.SQLConf.AutoMigrate || c.SQLConf.StrictSchema) || c.shardTables[table] {
+		return nil
+	}
+
+	if c.SQLConf.StrictSchema {
+		if err := c.checkSchema(table, model); err != nil {
+			return err
+		}
+	} else {
+		missing, err := c.missingColumns(table, model)
+		if err != nil {
+			return err
+		}
+		for _, column := range missing {
+			if err := db.Migrator().AddColumn(model, column); err != nil {
+				return err
+			}
+			c.log.Info("Added column ", column, " to table ", table)
+		}
+	}
+
+	if c.shardTables == nil {
+		c.shardTables = map[string]bool{}
+	}
+	c.shardTables[table] = true
+	return nil
+}
+
+// missingColumns returns the columns of model that the table lacks, sorted.
+func (c *SQLPump) missingColumns(table string, model interface{}) ([]string, error) {
+	db := c.tableDB(table)
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+
+	columnTypes, err := db.Migrator().ColumnTypes(model)
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]bool, len(columnTypes))
+	for _, columnType := range columnTypes {
+		columns[columnType.Name()] = true
+	}
+
+	missing := []string{}
+	for name, field := range stmt.Schema.FieldsByDBName {
+		if !field.IgnoreMigration && !columns[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
+
+// tableDB returns a session on table, which doesn't alter the statement of c.db.
+func (c *SQLPump) tableDB(table string) *gorm.DB {
+	return c.db.Session(&gorm.Session{NewDB: true}).Table(table)
+}
+
+// recordModel returns the model used to migrate the analytics table.
+func (c *SQLPump) recordModel() interface{} {
+	if c.rowModel != nil {
+		return reflect.New(c.rowModel).Interface()
+	}
+	if c.SQLConf.PrimaryKeyField != "" {
+		return &sqlPrimaryKeyRecord{}
+	}
+	return &analytics.AnalyticsRecord{}
+}
+
+// create writes recs, keyed by the configured primary key field if any.
+func (c *SQLPump) create(ctx context.Context, recs []*analytics.AnalyticsRecord) *gorm.DB {
+	db := c.db.WithContext(ctx)
+	if c.SQLConf.OmitNetworkStats {
+		omitted := analytics.NetworkStatsColumns
+		if c.SQLConf.JSONColumns {
+			omitted = []string{sqlJSONNetworkColumn}
+		}
+		db = db.Omit(omitted...)
+	}
+	if c.rowModel != nil && !c.SQLConf.TableSharding {
+		// the row model doesn't have the table name of the records
+		db = db.Table(analytics.SQLTable)
+	}
+	if c.SQLConf.PrimaryKeyField == "" {
+		if c.rowModel != nil {
+			return db.Create(c.modelRows(recs, nil))
+		}
+		return db.Create(recs)
+	}
+
+	ids := make([]string, len(recs))
+	for i, rec := range recs {
+		id := recordFieldValue(rec, c.SQLConf.PrimaryKeyField)
+		if id == "" {
+			generated, err := uuid.NewV4()
+			if err != nil {
+				return &gorm.DB{Error: err}
+			}
+			id = generated.String()
+		}
+		ids[i] = id
+	}
+
+	var rows interface{}
+	if c.rowModel != nil {
+		rows = c.modelRows(recs, ids)
+	} else {
+		keyed := make([]*sqlPrimaryKeyRecord, len(recs))
+		for i, rec := range recs {
+			keyed[i] = &sqlPrimaryKeyRecord{ID: ids[i], AnalyticsRecord: *rec}
+		}
+		rows = keyed
+	}
+
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoNothing: true,
+	}).Create(rows)
+}
+
+// recordField returns the AnalyticsRecord field whose JSON name is name.
+func recordField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			// the enrichment fields are inlined in the JSON of the record
+			if inlined, ok := recordField(v.Field(i), name); ok {
+				return inlined, true
+			}
+			continue
+		}
+		if strings.Split(field.Tag.Get("json"), ",")[0] == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func hasRecordField(name string) bool {
+	_, ok := recordField(reflect.ValueOf(analytics.AnalyticsRecord{}), name)
+	return ok
+}
+
+// recordFieldValue returns the value of the named field of rec, or "" if it's empty.
+func recordFieldValue(rec *analytics.AnalyticsRecord, name string) string {
+	field, ok := recordField(reflect.ValueOf(rec).Elem(), name)
+	if !ok || field.IsZero() {
+		return ""
+	}
+	return fmt.Sprint(field.Interface())
+}
+
 func (c *SQLPump) WriteUptimeData(data []interface{}) {
 	dataLen := len(data)
 	c.log.Debug("Attempting to write ", dataLen, " records...")
@@ -301,10 +606,11 @@ func (c *SQLPump) WriteUptimeData(data []interface{}) {
 			endIndex = i
 
 			table = analytics.UptimeSQLTable + "_" + recDate
-			c.db = c.db.Table(table)
-			if !c.db.Migrator().HasTable(table) {
-				c.db.AutoMigrate(&analytics.UptimeReportAggregateSQL{})
+			if err := c.ensureShardTable(table, &analytics.UptimeReportAggregateSQL{}); err != nil {
+				c.log.Error(err)
+				return
 			}
+			c.db = c.db.Table(table)
 		} else {
 			i = dataLen // write all records at once for non-sharded case, stop for loop after 1 iteration
 			table = analytics.UptimeSQLTable
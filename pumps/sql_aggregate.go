@@ -27,10 +27,18 @@ type SQLAggregatePumpConf struct {
 	IgnoreTagPrefixList []string `json:"ignore_tag_prefix_list" mapstructure:"ignore_tag_prefix_list"`
 	ThresholdLenTagList int      `json:"threshold_len_tag_list" mapstructure:"threshold_len_tag_list"`
 	// Determines if the aggregations should be made per minute instead of per hour.
-	StoreAnalyticsPerMinute bool     `json:"store_analytics_per_minute" mapstructure:"store_analytics_per_minute"`
-	IgnoreAggregationsList  []string `json:"ignore_aggregations" mapstructure:"ignore_aggregations"`
+	StoreAnalyticsPerMinute bool `json:"store_analytics_per_minute" mapstructure:"store_analytics_per_minute"`
+	// This list determines which aggregations are going to be dropped and not stored in the
+	// table. E.g. `["oauthids", "oauthendpoints"]` to skip the per OAuth client aggregations.
+	// Possible values are the ones of `ignore_aggregations` of the Mongo aggregate pump.
+	IgnoreAggregationsList []string `json:"ignore_aggregations" mapstructure:"ignore_aggregations"`
 	// Set to true to disable the default tyk index creation.
 	OmitIndexCreation bool `json:"omit_index_creation" mapstructure:"omit_index_creation"`
+	// Set to true to write denormalized wide rows, one per time bucket, API and response code,
+	// into the `tyk_aggregated_wide` table instead of the rows per dimension of `tyk_aggregated`.
+	// They can be queried directly by BI tools. `track_all_paths`, `ignore_tag_prefix_list` and
+	// `ignore_aggregations` don't apply to them.
+	WideRows bool `json:"wide_rows" mapstructure:"wide_rows"`
 }
 
 type SQLAggregatePump struct {
@@ -121,7 +129,11 @@ func (c *SQLAggregatePump) Init(conf interface{}) error {
 
 	c.db = db
 
-	if !c.SQLConf.TableSharding {
+	if !c.SQLConf.TableSharding && c.SQLConf.WideRows {
+		if err := c.ensureTable(analytics.AggregateWideSQLTable); err != nil {
+			return err
+		}
+	} else if !c.SQLConf.TableSharding {
 		// if table doesn't exist, create it
 		if err := c.ensureTable(analytics.AggregateSQLTable); err != nil {
 			return err
@@ -206,7 +218,11 @@ func (c *SQLAggregatePump) ensureTable(tableName string) error {
 	if !c.db.Migrator().HasTable(tableName) {
 		c.db = c.db.Table(tableName)
 
-		if err := c.db.Migrator().CreateTable(&analytics.SQLAnalyticsRecordAggregate{}); err != nil {
+		var model interface{} = &analytics.SQLAnalyticsRecordAggregate{}
+		if c.SQLConf.WideRows {
+			model = &analytics.SQLAnalyticsRecordAggregateWide{}
+		}
+		if err := c.db.Migrator().CreateTable(model); err != nil {
 			c.log.Error("error creating table", err)
 			return err
 		}
@@ -248,17 +264,19 @@ func (c *SQLAggregatePump) WriteData(ctx context.Context, data []interface{}) er
 
 			endIndex = i
 
-			table = analytics.AggregateSQLTable + "_" + recDate
+			table = c.tableName() + "_" + recDate
 			c.db = c.db.Table(table)
 			if errTable := c.ensureTable(table); errTable != nil {
 				return errTable
 			}
-			if err := c.ensureIndex(table, false); err != nil {
-				return err
+			if !c.SQLConf.WideRows {
+				if err := c.ensureIndex(table, false); err != nil {
+					return err
+				}
 			}
 		} else {
 			i = dataLen // write all records at once for non-sharded case, stop for loop after 1 iteration
-			table = analytics.AggregateSQLTable
+			table = c.tableName()
 		}
 
 		// if StoreAnalyticsPerMinute is set to true, we will create new documents with records every 1 minute
@@ -269,9 +287,20 @@ func (c *SQLAggregatePump) WriteData(ctx context.Context, data []interface{}) er
 			aggregationTime = 60
 		}
 
+		if c.SQLConf.WideRows {
+			if err := c.DoWideAggregatedWriting(ctx, table, analytics.AggregateWideData(data[startIndex:endIndex], aggregationTime)); err != nil {
+				return err
+			}
+			startIndex = i
+			continue
+		}
+
 		analyticsPerOrg := analytics.AggregateData(data[startIndex:endIndex], c.SQLConf.TrackAllPaths, c.SQLConf.IgnoreTagPrefixList, "", aggregationTime)
 
 		for orgID, ag := range analyticsPerOrg {
+			if len(c.SQLConf.IgnoreAggregationsList) > 0 {
+				ag.DiscardAggregations(c.SQLConf.IgnoreAggregationsList)
+			}
 
 			err := c.DoAggregatedWriting(ctx, table, orgID, ag)
 			if err != nil {
@@ -287,6 +316,37 @@ func (c *SQLAggregatePump) WriteData(ctx context.Context, data []interface{}) er
 	return nil
 }
 
+// tableName returns the table the aggregates are written to, or the prefix of the tables when
+// table sharding is enabled.
+func (c *SQLAggregatePump) tableName() string {
+	if c.SQLConf.WideRows {
+		return analytics.AggregateWideSQLTable
+	}
+	return analytics.AggregateSQLTable
+}
+
+// DoWideAggregatedWriting writes the wide rows, adding their counters to the ones of the rows
+// already written for the same time bucket, API and response code.
+func (c *SQLAggregatePump) DoWideAggregatedWriting(ctx context.Context, table string, rows []analytics.SQLAnalyticsRecordAggregateWide) error {
+	for i := 0; i < len(rows); i += c.SQLConf.BatchSize {
+		ends := i + c.SQLConf.BatchSize
+		if ends > len(rows) {
+			ends = len(rows)
+		}
+
+		tx := c.db.WithContext(ctx).Table(table).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.Assignments(analytics.WideOnConflictAssignments(table, "excluded")),
+		}).Create(rows[i:ends])
+		if tx.Error != nil {
+			c.log.Error("error writing wide aggregated records into "+table+":", tx.Error)
+			return tx.Error
+		}
+	}
+
+	return nil
+}
+
 func (c *SQLAggregatePump) DoAggregatedWriting(ctx context.Context, table, orgID string, ag analytics.AnalyticsRecordAggregate) error {
 	recs := []analytics.SQLAnalyticsRecordAggregate{}
 
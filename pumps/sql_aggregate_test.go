@@ -315,6 +315,126 @@ func TestSQLAggregateWriteDataValues(t *testing.T) {
 	}
 }
 
+func TestSQLAggregateWriteData_OauthIDs(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.Local)
+	records := []interface{}{
+		analytics.AnalyticsRecord{OrgID: "1", APIID: "api1", OauthID: "client1", ResponseCode: 200, TimeStamp: now},
+		analytics.AnalyticsRecord{OrgID: "1", APIID: "api1", OauthID: "client1", ResponseCode: 500, TimeStamp: now},
+		analytics.AnalyticsRecord{OrgID: "1", APIID: "api1", OauthID: "client2", ResponseCode: 200, TimeStamp: now},
+		analytics.AnalyticsRecord{OrgID: "1", APIID: "api1", ResponseCode: 200, TimeStamp: now},
+	}
+
+	tcs := []struct {
+		testName           string
+		ignoreAggregations []string
+		expected           map[string][2]int
+	}{
+		{
+			testName: "per oauth client",
+			// hits and errors per client, the records without client aren't counted
+			expected: map[string][2]int{"client1": {2, 1}, "client2": {1, 0}},
+		},
+		{
+			testName:           "oauth ids ignored",
+			ignoreAggregations: []string{"oauthids"},
+			expected:           map[string][2]int{},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			pmp := &SQLAggregatePump{}
+			cfg := map[string]interface{}{
+				"type":                "sqlite",
+				"ignore_aggregations": tc.ignoreAggregations,
+			}
+			if err := pmp.Init(cfg); err != nil {
+				t.Fatal("SQL Pump Aggregate couldn't be initialized with err: ", err)
+			}
+			defer func() {
+				if err := pmp.db.Migrator().DropTable(analytics.AggregateSQLTable); err != nil {
+					t.Error(err)
+				}
+			}()
+
+			assert.Nil(t, pmp.WriteData(context.TODO(), records))
+
+			dbRecords := []analytics.SQLAnalyticsRecordAggregate{}
+			if err := pmp.db.Table(analytics.AggregateSQLTable).Where("dimension = ?", "oauthids").Find(&dbRecords).Error; err != nil {
+				t.Fatal("Error getting analytics records from SQL")
+			}
+
+			counters := map[string][2]int{}
+			for _, rec := range dbRecords {
+				counters[rec.DimensionValue] = [2]int{rec.Hits, rec.ErrorTotal}
+			}
+			assert.Equal(t, tc.expected, counters)
+		})
+	}
+}
+
+func TestSQLAggregateWriteData_WideRows(t *testing.T) {
+	pmp := &SQLAggregatePump{}
+	cfg := map[string]interface{}{
+		"type":      "sqlite",
+		"wide_rows": true,
+	}
+	if err := pmp.Init(cfg); err != nil {
+		t.Fatal("SQL Pump Aggregate couldn't be initialized with err: ", err)
+	}
+	defer func() {
+		if err := pmp.db.Migrator().DropTable(analytics.AggregateWideSQLTable); err != nil {
+			t.Error(err)
+		}
+	}()
+	assert.True(t, pmp.db.Migrator().HasTable(analytics.AggregateWideSQLTable))
+	assert.False(t, pmp.db.Migrator().HasTable(analytics.AggregateSQLTable))
+
+	hour1 := time.Date(2019, 1, 1, 10, 15, 0, 0, time.UTC)
+	hour2 := hour1.Add(time.Hour)
+	records := []interface{}{
+		analytics.AnalyticsRecord{OrgID: "1", APIID: "api1", APIName: "API 1", ResponseCode: 200, RequestTime: 10, TimeStamp: hour1},
+		analytics.AnalyticsRecord{OrgID: "1", APIID: "api1", APIName: "API 1", ResponseCode: 200, RequestTime: 20, TimeStamp: hour1.Add(time.Minute)},
+		analytics.AnalyticsRecord{OrgID: "1", APIID: "api1", APIName: "API 1", ResponseCode: 500, RequestTime: 30, TimeStamp: hour1},
+		analytics.AnalyticsRecord{OrgID: "1", APIID: "api2", ResponseCode: 200, RequestTime: 40, TimeStamp: hour1},
+		analytics.AnalyticsRecord{OrgID: "1", APIID: "api1", APIName: "API 1", ResponseCode: 200, RequestTime: 50, TimeStamp: hour2},
+		// no org
+		analytics.AnalyticsRecord{APIID: "api1", ResponseCode: 200, TimeStamp: hour1},
+	}
+	// written twice, the counters add up
+	assert.Nil(t, pmp.WriteData(context.TODO(), records))
+	assert.Nil(t, pmp.WriteData(context.TODO(), records))
+
+	dbRecords := []analytics.SQLAnalyticsRecordAggregateWide{}
+	if err := pmp.db.Table(analytics.AggregateWideSQLTable).Order("timestamp, api_id, response_code").Find(&dbRecords).Error; err != nil {
+		t.Fatal("Error getting analytics records from SQL")
+	}
+
+	type row struct {
+		timestamp    int64
+		apiID        string
+		apiName      string
+		responseCode int
+		hits         int
+		success      int
+		errors       int
+		requestTime  float64
+	}
+	rows := []row{}
+	for _, rec := range dbRecords {
+		assert.Equal(t, "1", rec.OrgID)
+		rows = append(rows, row{rec.TimeStamp, rec.APIID, rec.APIName, rec.ResponseCode, rec.Hits, rec.Success, rec.ErrorTotal, rec.TotalRequestTime})
+	}
+	bucket1 := time.Date(2019, 1, 1, 10, 0, 0, 0, time.UTC).Unix()
+	bucket2 := time.Date(2019, 1, 1, 11, 0, 0, 0, time.UTC).Unix()
+	assert.Equal(t, []row{
+		{bucket1, "api1", "API 1", 200, 4, 4, 0, 60},
+		{bucket1, "api1", "API 1", 500, 2, 0, 2, 60},
+		{bucket1, "api2", "", 200, 2, 2, 0, 80},
+		{bucket2, "api1", "API 1", 200, 2, 2, 0, 100},
+	}, rows)
+}
+
 func TestDecodeRequestAndDecodeResponseSQLAggregate(t *testing.T) {
 	newPump := &SQLAggregatePump{}
 	cfg := make(map[string]interface{})
@@ -0,0 +1,66 @@
+package pumps
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// sqlPartitionBoundFormat formats the bounds of the monthly partitions, in UTC.
+const sqlPartitionBoundFormat = "2006-01-02 15:04:05-07"
+
+// partitionName returns the name of the monthly partition of table holding t, e.g.
+// `tyk_analytics_202301`.
+func partitionName(table string, t time.Time) string {
+	return table + "_" + t.UTC().Format("200601")
+}
+
+// partitionBounds returns the start, inclusive, and the end, exclusive, of the month of t in UTC.
+func partitionBounds(t time.Time) (from, to time.Time) {
+	t = t.UTC()
+	from = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return from, from.AddDate(0, 1, 0)
+}
+
+// migratePartitionedTable creates table partitioned by month on its timestamp, or, if it already
+// exists, checks that it's partitioned and migrates it as migrateTable does.
+func (c *SQLPump) migratePartitionedTable(table string, model interface{}) error {
+	db := c.tableDB(table)
+	if !db.Migrator().HasTable(table) {
+		return db.Set("gorm:table_options", " PARTITION BY RANGE (timestamp)").AutoMigrate(model)
+	}
+
+	var partitioned int64
+	if err := c.db.Raw("SELECT count(*) FROM pg_partitioned_table WHERE partrelid = to_regclass(?)", table).Scan(&partitioned).Error; err != nil {
+		return err
+	}
+	if partitioned == 0 {
+		return fmt.Errorf("table %s already exists and isn't partitioned, time_partitioning requires a new table", table)
+	}
+	return c.migrateTable(table, model)
+}
+
+// ensurePartition creates the monthly partition of table holding t, if it doesn't exist. The
+// inserts into table are routed to the partition by Postgres.
+func (c *SQLPump) ensurePartition(table string, t time.Time) error {
+	partition := partitionName(table, t)
+	if c.partitions[partition] {
+		return nil
+	}
+
+	from, to := partitionBounds(t)
+	err := c.db.Session(&gorm.Session{NewDB: true}).Exec(fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %q PARTITION OF %q FOR VALUES FROM ('%s') TO ('%s')",
+		partition, table, from.Format(sqlPartitionBoundFormat), to.Format(sqlPartitionBoundFormat),
+	)).Error
+	if err != nil {
+		return err
+	}
+
+	if c.partitions == nil {
+		c.partitions = map[string]bool{}
+	}
+	c.partitions[partition] = true
+	return nil
+}
@@ -0,0 +1,187 @@
+package pumps
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+const sqlJSONNetworkColumn = "network"
+
+// sqlJSONColumns are the columns of the record fields stored as JSON with json_columns, by field
+// name.
+var sqlJSONColumns = map[string]string{
+	"Geo":     "geo",
+	"Network": sqlJSONNetworkColumn,
+	"Tags":    "tags",
+}
+
+// sqlJSONColumnNames are the sqlJSONColumns which aren't columns of the records without
+// json_columns.
+var sqlJSONColumnNames = map[string]bool{"geo": true, sqlJSONNetworkColumn: true}
+
+// sqlJSON is a JSON document stored in a column of the JSON type of the dialect.
+type sqlJSON string
+
+// GormDBDataType returns the JSON type of the dialect, falling back to text.
+func (sqlJSON) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return "JSONB"
+	case "mysql":
+		return "JSON"
+	default:
+		return "TEXT"
+	}
+}
+
+func (j sqlJSON) Value() (driver.Value, error) {
+	return string(j), nil
+}
+
+func (j *sqlJSON) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		*j = sqlJSON(v)
+	case []byte:
+		*j = sqlJSON(v)
+	case nil:
+		*j = ""
+	default:
+		return fmt.Errorf("unsupported JSON column value of type %T", value)
+	}
+	return nil
+}
+
+// initRowModel builds the model of the analytics table with the tag_columns, the json_columns,
+// the latency_columns or the enrichment_column: the primary key if any, the record, the latency
+// columns, the enrichment column, then a string field per tag column. With json_columns, the
+// fields of the record are inlined, with an sqlJSON field in place of each of the sqlJSONColumns.
+// Without any of them, the model is the records and rowModel is left nil.
+func (c *SQLPump) initRowModel() {
+	c.rowModel = nil
+	if len(c.tagColumns) == 0 && !c.SQLConf.JSONColumns && !c.SQLConf.LatencyColumns && !c.SQLConf.EnrichmentColumn {
+		return
+	}
+
+	fields := []reflect.StructField{}
+	if c.SQLConf.PrimaryKeyField != "" {
+		fields = append(fields, reflect.StructField{
+			Name: "ID",
+			Type: reflect.TypeOf(""),
+			Tag:  `json:"id" gorm:"column:id;primaryKey"`,
+		})
+	}
+	if c.SQLConf.JSONColumns {
+		recordType := reflect.TypeOf(analytics.AnalyticsRecord{})
+		for i := 0; i < recordType.NumField(); i++ {
+			field := recordType.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if column, ok := sqlJSONColumns[field.Name]; ok {
+				field = reflect.StructField{
+					Name: field.Name,
+					Type: reflect.TypeOf(sqlJSON("")),
+					Tag:  reflect.StructTag(fmt.Sprintf(`json:"%s" gorm:"column:%s"`, column, column)),
+				}
+			}
+			fields = append(fields, reflect.StructField{Name: field.Name, Type: field.Type, Tag: field.Tag})
+		}
+	} else {
+		fields = append(fields, reflect.StructField{
+			Name:      "AnalyticsRecord",
+			Type:      reflect.TypeOf(analytics.AnalyticsRecord{}),
+			Tag:       `json:",inline" gorm:"embedded"`,
+			Anonymous: true,
+		})
+	}
+	if c.SQLConf.LatencyColumns {
+		for i, column := range analytics.LatencyColumns {
+			fields = append(fields, reflect.StructField{
+				Name: analytics.LatencyFieldNames[i] + "Column",
+				Type: reflect.TypeOf(int64(0)),
+				Tag:  reflect.StructTag(fmt.Sprintf(`json:"%s" gorm:"column:%s"`, column, column)),
+			})
+		}
+	}
+	if c.SQLConf.EnrichmentColumn {
+		fields = append(fields, reflect.StructField{
+			Name: "EnrichmentColumn",
+			Type: reflect.TypeOf(sqlJSON("")),
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:"%s" gorm:"column:%s"`, analytics.EnrichmentColumn, analytics.EnrichmentColumn)),
+		})
+	}
+	for i, tagColumn := range c.tagColumns {
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("TagColumn%d", i),
+			Type: reflect.TypeOf(""),
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:"%s" gorm:"column:%s"`, tagColumn.column, tagColumn.column)),
+		})
+	}
+	c.rowModel = reflect.StructOf(fields)
+}
+
+// modelRows returns the rows of recs for the rowModel, keyed by ids if the primary key field is
+// set.
+func (c *SQLPump) modelRows(recs []*analytics.AnalyticsRecord, ids []string) interface{} {
+	rows := reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(c.rowModel)), len(recs), len(recs))
+	for i, rec := range recs {
+		row := reflect.New(c.rowModel).Elem()
+		if c.SQLConf.JSONColumns {
+			setJSONColumnsRow(row, rec)
+		} else {
+			row.FieldByName("AnalyticsRecord").Set(reflect.ValueOf(*rec))
+		}
+		if ids != nil {
+			row.FieldByName("ID").SetString(ids[i])
+		}
+		if c.SQLConf.LatencyColumns {
+			row.FieldByName("LatencyTotalColumn").SetInt(rec.LatencyTotal)
+			row.FieldByName("LatencyUpstreamColumn").SetInt(rec.LatencyUpstream)
+			row.FieldByName("LatencyGatewayColumn").SetInt(rec.LatencyGateway)
+		}
+		if c.SQLConf.EnrichmentColumn {
+			row.FieldByName("EnrichmentColumn").SetString(rec.Enrichment.JSONValue())
+		}
+		for j, tagColumn := range c.tagColumns {
+			row.FieldByName(fmt.Sprintf("TagColumn%d", j)).SetString(tagSuffix(rec.Tags, tagColumn.prefix))
+		}
+		rows.Index(i).Set(row.Addr())
+	}
+	return rows.Interface()
+}
+
+// setJSONColumnsRow copies the fields of rec to the inlined fields of row, JSON encoding the
+// sqlJSONColumns.
+func setJSONColumnsRow(row reflect.Value, rec *analytics.AnalyticsRecord) {
+	record := reflect.ValueOf(rec).Elem()
+	recordType := record.Type()
+	for i := 0; i < recordType.NumField(); i++ {
+		field := recordType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if _, ok := sqlJSONColumns[field.Name]; !ok {
+			row.FieldByName(field.Name).Set(record.Field(i))
+			continue
+		}
+
+		value := record.Field(i).Interface()
+		if tags, ok := value.([]string); ok && tags == nil {
+			// the records without tags have an empty list rather than null
+			value = []string{}
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			encoded = []byte("null")
+		}
+		row.FieldByName(field.Name).SetString(string(encoded))
+	}
+}
@@ -0,0 +1,65 @@
+package pumps
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+var sqlColumnNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// sqlTagColumn is a column of the analytics table holding the suffix of the tags with prefix.
+type sqlTagColumn struct {
+	prefix string
+	column string
+}
+
+// initTagColumns validates the tag_columns, sorted by prefix.
+func (c *SQLPump) initTagColumns() error {
+	c.tagColumns = nil
+	if len(c.SQLConf.TagColumns) == 0 {
+		return nil
+	}
+
+	stmt := &gorm.Statement{DB: c.db}
+	if err := stmt.Parse(&analytics.AnalyticsRecord{}); err != nil {
+		return err
+	}
+
+	columns := map[string]string{}
+	for prefix, column := range c.SQLConf.TagColumns {
+		switch {
+		case prefix == "":
+			return fmt.Errorf("empty tag_columns prefix for column %q", column)
+		case !sqlColumnNamePattern.MatchString(column):
+			return fmt.Errorf("invalid tag_columns column %q, expected lowercase letters, digits and underscores", column)
+		case column == "id" || stmt.Schema.FieldsByDBName[column] != nil || (c.SQLConf.JSONColumns && sqlJSONColumnNames[column]) ||
+			(c.SQLConf.LatencyColumns && contains(analytics.LatencyColumns, column)) ||
+			(c.SQLConf.EnrichmentColumn && column == analytics.EnrichmentColumn):
+			return fmt.Errorf("tag_columns column %q is already a column of the records", column)
+		case columns[column] != "":
+			return fmt.Errorf("tag_columns column %q is mapped to both %q and %q", column, columns[column], prefix)
+		}
+		columns[column] = prefix
+		c.tagColumns = append(c.tagColumns, sqlTagColumn{prefix: prefix, column: column})
+	}
+	sort.Slice(c.tagColumns, func(i, j int) bool {
+		return c.tagColumns[i].prefix < c.tagColumns[j].prefix
+	})
+	return nil
+}
+
+// tagSuffix returns the suffix of the first of tags starting with prefix, or an empty string.
+func tagSuffix(tags []string, prefix string) string {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, prefix) {
+			return strings.TrimPrefix(tag, prefix)
+		}
+	}
+	return ""
+}
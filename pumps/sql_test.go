@@ -2,6 +2,8 @@ package pumps
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
@@ -85,6 +87,308 @@ func TestSQLWriteData(t *testing.T) {
 	})
 }
 
+func TestSQLWriteDataNetworkStats(t *testing.T) {
+	network := analytics.NetworkStats{OpenConnections: 1, ClosedConnection: 2, BytesIn: 300, BytesOut: 4000}
+	keys := []interface{}{analytics.AnalyticsRecord{APIID: "api1", OrgID: "123", TimeStamp: time.Now(), Network: network}}
+
+	for _, tc := range []struct {
+		testName         string
+		omitNetworkStats bool
+		expected         analytics.NetworkStats
+	}{
+		{testName: "default", omitNetworkStats: false, expected: network},
+		{testName: "omitted", omitNetworkStats: true, expected: analytics.NetworkStats{}},
+	} {
+		t.Run(tc.testName, func(t *testing.T) {
+			pmp := SQLPump{}
+			cfg := map[string]interface{}{
+				"type":               "sqlite",
+				"connection_string":  "",
+				"omit_network_stats": tc.omitNetworkStats,
+			}
+			assert.NoError(t, pmp.Init(cfg))
+			defer pmp.db.Migrator().DropTable(analytics.SQLTable)
+
+			for _, column := range analytics.NetworkStatsColumns {
+				assert.True(t, pmp.db.Table(analytics.SQLTable).Migrator().HasColumn(&analytics.AnalyticsRecord{}, column), column)
+			}
+
+			assert.NoError(t, pmp.WriteData(context.TODO(), keys))
+			var dbRecords []analytics.AnalyticsRecord
+			assert.NoError(t, pmp.db.Table(analytics.SQLTable).Find(&dbRecords).Error)
+			assert.Len(t, dbRecords, 1)
+			assert.Equal(t, "api1", dbRecords[0].APIID)
+			assert.Equal(t, tc.expected, dbRecords[0].Network)
+		})
+	}
+}
+
+func TestSQLWriteDataTagColumns(t *testing.T) {
+	keys := []interface{}{
+		analytics.AnalyticsRecord{APIID: "api1", TimeStamp: time.Now(), Tags: []string{"key-abc", "team-payments", "env-prod"}},
+		analytics.AnalyticsRecord{APIID: "api2", TimeStamp: time.Now(), Tags: []string{"org-xyz", "team-search", "team-other"}},
+		analytics.AnalyticsRecord{APIID: "api3", TimeStamp: time.Now()},
+	}
+	type row struct {
+		APIID       string
+		Team        string
+		Environment string
+	}
+	expected := []row{
+		{APIID: "api1", Team: "payments", Environment: "prod"},
+		{APIID: "api2", Team: "search"},
+		{APIID: "api3"},
+	}
+
+	for _, tc := range []struct {
+		testName string
+		cfg      map[string]interface{}
+		table    string
+	}{
+		{testName: "table", cfg: map[string]interface{}{}, table: analytics.SQLTable},
+		{testName: "primary key field", cfg: map[string]interface{}{"primary_key_field": "api_id"}, table: analytics.SQLTable},
+		{testName: "sharded", cfg: map[string]interface{}{"table_sharding": true}, table: analytics.SQLTable + "_" + time.Now().Format("20060102")},
+	} {
+		t.Run(tc.testName, func(t *testing.T) {
+			pmp := SQLPump{}
+			tc.cfg["type"] = "sqlite"
+			tc.cfg["connection_string"] = ""
+			tc.cfg["tag_columns"] = map[string]interface{}{"team-": "team", "env-": "environment"}
+			assert.NoError(t, pmp.Init(tc.cfg))
+			defer pmp.db.Migrator().DropTable(tc.table)
+
+			assert.NoError(t, pmp.WriteData(context.TODO(), keys))
+
+			var rows []row
+			err := pmp.tableDB(tc.table).Select("apiid AS api_id, team, environment").Order("apiid").Scan(&rows).Error
+			assert.NoError(t, err)
+			assert.Equal(t, expected, rows)
+
+			// the records are read back as usual
+			var dbRecords []analytics.AnalyticsRecord
+			assert.NoError(t, pmp.tableDB(tc.table).Order("apiid").Find(&dbRecords).Error)
+			assert.Len(t, dbRecords, 3)
+			assert.Equal(t, []string{"key-abc", "team-payments", "env-prod"}, dbRecords[0].Tags)
+		})
+	}
+
+	for _, tagColumns := range []map[string]interface{}{
+		{"team-": "Team"},
+		{"team-": "team; DROP TABLE"},
+		{"team-": "apiid"},
+		{"team-": "id"},
+		{"": "team"},
+		{"team-": "team", "squad-": "team"},
+	} {
+		pmp := SQLPump{}
+		cfg := map[string]interface{}{"type": "sqlite", "connection_string": "", "tag_columns": tagColumns}
+		assert.Error(t, pmp.Init(cfg), tagColumns)
+	}
+}
+
+func TestSQLWriteDataJSONColumns(t *testing.T) {
+	record := analytics.AnalyticsRecord{
+		APIID:     "api1",
+		TimeStamp: time.Now(),
+		Tags:      []string{"key-abc", "team-payments"},
+		Network:   analytics.NetworkStats{OpenConnections: 1, BytesIn: 300},
+	}
+	record.Geo.Country.ISOCode = "GB"
+	record.Geo.City.Names = map[string]string{"en": "London"}
+	keys := []interface{}{record, analytics.AnalyticsRecord{APIID: "api2", TimeStamp: time.Now()}}
+
+	for _, tc := range []struct {
+		testName string
+		cfg      map[string]interface{}
+		table    string
+	}{
+		{testName: "table", cfg: map[string]interface{}{}, table: analytics.SQLTable},
+		{testName: "omit network stats", cfg: map[string]interface{}{"omit_network_stats": true}, table: analytics.SQLTable},
+		{testName: "primary key field", cfg: map[string]interface{}{"primary_key_field": "api_id"}, table: analytics.SQLTable},
+		{testName: "tag columns", cfg: map[string]interface{}{"tag_columns": map[string]interface{}{"team-": "team"}}, table: analytics.SQLTable},
+		{testName: "sharded", cfg: map[string]interface{}{"table_sharding": true}, table: analytics.SQLTable + "_" + time.Now().Format("20060102")},
+	} {
+		t.Run(tc.testName, func(t *testing.T) {
+			pmp := SQLPump{}
+			tc.cfg["type"] = "sqlite"
+			tc.cfg["connection_string"] = ""
+			tc.cfg["json_columns"] = true
+			assert.NoError(t, pmp.Init(tc.cfg))
+			defer pmp.db.Migrator().DropTable(tc.table)
+
+			assert.NoError(t, pmp.WriteData(context.TODO(), keys))
+
+			columnTypes, err := pmp.tableDB(tc.table).Migrator().ColumnTypes(pmp.recordModel())
+			assert.NoError(t, err)
+			types := map[string]string{}
+			for _, columnType := range columnTypes {
+				types[columnType.Name()] = columnType.DatabaseTypeName()
+			}
+			for _, column := range []string{"geo", "network", "tags"} {
+				assert.Equal(t, "TEXT", types[column], column)
+			}
+			// the geo data and network stats aren't spread over several columns
+			assert.NotContains(t, types, "geo_country_iso_code")
+			assert.NotContains(t, types, "network_bytes_in")
+
+			type row struct {
+				APIID   string
+				Geo     string
+				Network *string
+				Tags    string
+			}
+			var rows []row
+			err = pmp.tableDB(tc.table).Select("apiid AS api_id, geo, network, tags").Order("apiid").Scan(&rows).Error
+			assert.NoError(t, err)
+			assert.Len(t, rows, 2)
+			assert.Equal(t, "api1", rows[0].APIID)
+			assert.JSONEq(t, `["key-abc","team-payments"]`, rows[0].Tags)
+			assert.JSONEq(t, `[]`, rows[1].Tags)
+			var geo analytics.GeoData
+			assert.NoError(t, json.Unmarshal([]byte(rows[0].Geo), &geo))
+			assert.Equal(t, record.Geo, geo)
+			if tc.cfg["omit_network_stats"] == true {
+				assert.Nil(t, rows[0].Network)
+			} else {
+				assert.NotNil(t, rows[0].Network)
+				assert.JSONEq(t, `{"open_connections":1,"closed_connections":0,"bytes_in":300,"bytes_out":0}`, *rows[0].Network)
+			}
+		})
+	}
+
+	pmp := SQLPump{}
+	cfg := map[string]interface{}{"type": "sqlite", "connection_string": "", "json_columns": true, "tag_columns": map[string]interface{}{"team-": "geo"}}
+	assert.Error(t, pmp.Init(cfg))
+}
+
+func TestSQLWriteDataEnrichmentColumn(t *testing.T) {
+	keys := []interface{}{
+		analytics.AnalyticsRecord{APIID: "api1", TimeStamp: time.Now(), Enrichment: analytics.Enrichment{Browser: "Firefox", LatencyDNS: 3}},
+		analytics.AnalyticsRecord{APIID: "api2", TimeStamp: time.Now()},
+	}
+
+	for _, tc := range []struct {
+		testName string
+		cfg      map[string]interface{}
+	}{
+		{testName: "table", cfg: map[string]interface{}{}},
+		{testName: "primary key field", cfg: map[string]interface{}{"primary_key_field": "api_id"}},
+		{testName: "json columns", cfg: map[string]interface{}{"json_columns": true}},
+	} {
+		t.Run(tc.testName, func(t *testing.T) {
+			pmp := SQLPump{}
+			tc.cfg["type"] = "sqlite"
+			tc.cfg["connection_string"] = ""
+			tc.cfg["enrichment_column"] = true
+			assert.NoError(t, pmp.Init(tc.cfg))
+			defer pmp.db.Migrator().DropTable(analytics.SQLTable)
+
+			assert.NoError(t, pmp.WriteData(context.TODO(), keys))
+
+			// the enrichment fields are in a single column
+			migrator := pmp.tableDB(analytics.SQLTable).Migrator()
+			assert.True(t, migrator.HasColumn(pmp.recordModel(), "enrichment"))
+			assert.False(t, migrator.HasColumn(pmp.recordModel(), "browser"))
+
+			type row struct {
+				APIID      string `gorm:"column:apiid"`
+				Enrichment string
+			}
+			var rows []row
+			assert.NoError(t, pmp.db.Table(analytics.SQLTable).Order("apiid").Find(&rows).Error)
+			assert.Equal(t, []row{
+				{APIID: "api1", Enrichment: `{"browser":"Firefox","latency_dns":3}`},
+				{APIID: "api2", Enrichment: "{}"},
+			}, rows)
+		})
+	}
+
+	// without enrichment_column, the table doesn't have the column
+	pmp := SQLPump{}
+	assert.NoError(t, pmp.Init(map[string]interface{}{"type": "sqlite", "connection_string": ""}))
+	defer pmp.db.Migrator().DropTable(analytics.SQLTable)
+	assert.NoError(t, pmp.WriteData(context.TODO(), keys))
+	assert.False(t, pmp.db.Migrator().HasColumn(&analytics.AnalyticsRecord{}, "enrichment"))
+	assert.False(t, pmp.db.Migrator().HasColumn(&analytics.AnalyticsRecord{}, "browser"))
+}
+
+func TestSQLWriteDataLatencyColumns(t *testing.T) {
+	keys := []interface{}{
+		analytics.AnalyticsRecord{APIID: "api1", TimeStamp: time.Now(), Enrichment: analytics.Enrichment{LatencyTotal: 120, LatencyUpstream: 100, LatencyGateway: 20}},
+	}
+
+	for _, tc := range []struct {
+		testName string
+		cfg      map[string]interface{}
+	}{
+		{testName: "table", cfg: map[string]interface{}{}},
+		{testName: "json columns", cfg: map[string]interface{}{"json_columns": true}},
+	} {
+		t.Run(tc.testName, func(t *testing.T) {
+			pmp := SQLPump{}
+			tc.cfg["type"] = "sqlite"
+			tc.cfg["connection_string"] = ""
+			tc.cfg["latency_columns"] = true
+			assert.NoError(t, pmp.Init(tc.cfg))
+			defer pmp.db.Migrator().DropTable(analytics.SQLTable)
+
+			assert.NoError(t, pmp.WriteData(context.TODO(), keys))
+
+			type row struct {
+				APIID           string `gorm:"column:apiid"`
+				LatencyTotal    int64  `gorm:"column:latencytotal"`
+				LatencyUpstream int64  `gorm:"column:latencyupstream"`
+				LatencyGateway  int64  `gorm:"column:latencygateway"`
+			}
+			var rows []row
+			assert.NoError(t, pmp.db.Table(analytics.SQLTable).Find(&rows).Error)
+			assert.Equal(t, []row{{APIID: "api1", LatencyTotal: 120, LatencyUpstream: 100, LatencyGateway: 20}}, rows)
+		})
+	}
+
+	// the latency columns can't be tag columns
+	pmp := SQLPump{}
+	assert.Error(t, pmp.Init(map[string]interface{}{
+		"type": "sqlite", "connection_string": "", "latency_columns": true,
+		"tag_columns": map[string]string{"latency-": "latencytotal"},
+	}))
+}
+
+func TestSQLJSONColumnsPostgres(t *testing.T) {
+	pmp := &SQLPump{}
+	err := pmp.Init(map[string]interface{}{
+		"type":              "postgres",
+		"connection_string": "host=localhost user=postgres password=postgres dbname=postgres port=5432 sslmode=disable",
+		"json_columns":      true,
+	})
+	if err != nil {
+		t.Fatal("Postgres must be available on localhost:5432: ", err)
+	}
+	defer pmp.db.Migrator().DropTable(analytics.SQLTable)
+
+	record := analytics.AnalyticsRecord{APIID: "api1", TimeStamp: time.Now(), Tags: []string{"team-payments"}}
+	record.Geo.Country.ISOCode = "GB"
+	record.Network.BytesIn = 300
+	assert.Nil(t, pmp.WriteData(context.Background(), []interface{}{record, analytics.AnalyticsRecord{APIID: "api2", TimeStamp: time.Now()}}))
+
+	for _, column := range []string{"geo", "network", "tags"} {
+		var dataType string
+		assert.Nil(t, pmp.db.Raw("SELECT data_type FROM information_schema.columns WHERE table_name = ? AND column_name = ?", analytics.SQLTable, column).Scan(&dataType).Error)
+		assert.Equal(t, "jsonb", dataType, column)
+	}
+
+	// the documents can be queried with the JSONB operators
+	var apiIDs []string
+	assert.Nil(t, pmp.db.Raw("SELECT apiid FROM tyk_analytics WHERE geo->'country'->>'iso_code' = ?", "GB").Scan(&apiIDs).Error)
+	assert.Equal(t, []string{"api1"}, apiIDs)
+	apiIDs = nil
+	assert.Nil(t, pmp.db.Raw("SELECT apiid FROM tyk_analytics WHERE tags @> ?::jsonb", `["team-payments"]`).Scan(&apiIDs).Error)
+	assert.Equal(t, []string{"api1"}, apiIDs)
+	var bytesIn int64
+	assert.Nil(t, pmp.db.Raw("SELECT (network->>'bytes_in')::bigint FROM tyk_analytics WHERE apiid = ?", "api1").Scan(&bytesIn).Error)
+	assert.Equal(t, int64(300), bytesIn)
+}
+
 func TestSQLWriteDataSharded(t *testing.T) {
 	pmp := SQLPump{}
 	cfg := make(map[string]interface{})
@@ -148,6 +452,111 @@ func TestSQLWriteDataSharded(t *testing.T) {
 	}
 }
 
+func TestSQLWriteDataPrimaryKeyField(t *testing.T) {
+	pmp := SQLPump{}
+	cfg := make(map[string]interface{})
+	cfg["type"] = "sqlite"
+	cfg["connection_string"] = ""
+	cfg["primary_key_field"] = "oauth_id"
+
+	err := pmp.Init(cfg)
+	if err != nil {
+		t.Fatal("SQL Pump couldn't be initialized with err: ", err)
+	}
+	defer func() {
+		pmp.db.Migrator().DropTable(analytics.SQLTable)
+	}()
+
+	// the columns are the same as without the primary key
+	assert.True(t, pmp.tableDB(analytics.SQLTable).Migrator().HasColumn(&analytics.AnalyticsRecord{}, "apiid"))
+
+	keys := []interface{}{
+		analytics.AnalyticsRecord{APIID: "api111", OauthID: "req1", TimeStamp: time.Now()},
+		analytics.AnalyticsRecord{APIID: "api111", OauthID: "req2", TimeStamp: time.Now()},
+		analytics.AnalyticsRecord{APIID: "api111", TimeStamp: time.Now()},
+	}
+
+	ctx := context.TODO()
+	// writing the same records twice shouldn't duplicate the keyed ones
+	for i := 0; i < 2; i++ {
+		if errWrite := pmp.WriteData(ctx, keys); errWrite != nil {
+			t.Fatal("SQL Pump couldn't write records with err:", errWrite)
+		}
+	}
+
+	var dbRecords []sqlPrimaryKeyRecord
+	err = pmp.db.Table(analytics.SQLTable).Order("id").Find(&dbRecords).Error
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(dbRecords))
+
+	ids := map[string]string{}
+	for _, rec := range dbRecords {
+		assert.NotEmpty(t, rec.ID)
+		ids[rec.ID] = rec.OauthID
+	}
+	assert.Equal(t, "req1", ids["req1"])
+	assert.Equal(t, "req2", ids["req2"])
+
+	t.Run("unknown_field", func(t *testing.T) {
+		cfg["primary_key_field"] = "unknown"
+		assert.NotNil(t, (&SQLPump{}).Init(cfg))
+	})
+}
+
+func TestSQLWriteDataPrimaryKeyEnrichmentField(t *testing.T) {
+	pmp := SQLPump{}
+	assert.Nil(t, pmp.Init(map[string]interface{}{"type": "sqlite", "connection_string": "", "primary_key_field": "correlation_id"}))
+	defer pmp.db.Migrator().DropTable(analytics.SQLTable)
+
+	keys := []interface{}{
+		analytics.AnalyticsRecord{APIID: "api111", TimeStamp: time.Now(), Enrichment: analytics.Enrichment{CorrelationID: "req1"}},
+		analytics.AnalyticsRecord{APIID: "api111", TimeStamp: time.Now(), Enrichment: analytics.Enrichment{CorrelationID: "req1"}},
+		analytics.AnalyticsRecord{APIID: "api111", TimeStamp: time.Now(), Enrichment: analytics.Enrichment{CorrelationID: "req2"}},
+	}
+	// the records of the same request are written once
+	assert.Nil(t, pmp.WriteData(context.TODO(), keys))
+
+	var dbRecords []sqlPrimaryKeyRecord
+	assert.Nil(t, pmp.db.Table(analytics.SQLTable).Order("id").Find(&dbRecords).Error)
+	assert.Len(t, dbRecords, 2)
+	assert.Equal(t, "req1", dbRecords[0].ID)
+	assert.Equal(t, "req2", dbRecords[1].ID)
+}
+
+func TestSQLPrimaryKeyFieldColumns(t *testing.T) {
+	columnNames := func(cfg map[string]interface{}) []string {
+		pmp := SQLPump{}
+		cfg["type"] = "sqlite"
+		cfg["connection_string"] = ""
+		assert.NoError(t, pmp.Init(cfg))
+		defer pmp.db.Migrator().DropTable(analytics.SQLTable)
+
+		keys := []interface{}{analytics.AnalyticsRecord{APIID: "a", OauthID: "req1", TimeStamp: time.Now()}}
+		assert.NoError(t, pmp.WriteData(context.TODO(), keys))
+		// the rows can be queried by the columns of the records
+		var rows int64
+		assert.NoError(t, pmp.db.Table(analytics.SQLTable).Where("apiid = ?", "a").Count(&rows).Error)
+		assert.Equal(t, int64(1), rows)
+
+		columnTypes, err := pmp.tableDB(analytics.SQLTable).Migrator().ColumnTypes(pmp.recordModel())
+		assert.NoError(t, err)
+		names := []string{}
+		for _, columnType := range columnTypes {
+			names = append(names, columnType.Name())
+		}
+		return names
+	}
+
+	columns := columnNames(map[string]interface{}{})
+	keyedColumns := columnNames(map[string]interface{}{"primary_key_field": "oauth_id"})
+
+	// the keyed table has the columns of the records, not prefixed, and the id
+	for _, column := range keyedColumns {
+		assert.False(t, strings.HasPrefix(column, "_"), column)
+	}
+	assert.ElementsMatch(t, append(columns, "id"), keyedColumns)
+}
+
 func TestSQLWriteUptimeData(t *testing.T) {
 	pmp := SQLPump{IsUptime: true}
 	cfg := make(map[string]interface{})
@@ -363,3 +772,170 @@ func TestDecodeRequestAndDecodeResponseSQL(t *testing.T) {
 	assert.False(t, newPump.GetDecodedRequest())
 	assert.False(t, newPump.GetDecodedResponse())
 }
+
+// sqlOldRecord is an analytics record lacking the fields added since its table was created.
+type sqlOldRecord struct {
+	APIID     string    `json:"api_id" gorm:"column:apiid"`
+	OrgID     string    `json:"org_id" gorm:"column:orgid"`
+	TimeStamp time.Time `json:"timestamp" gorm:"column:timestamp"`
+}
+
+func TestSQLSchemaDrift(t *testing.T) {
+	timestamp := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	shard := analytics.SQLTable + "_20240101"
+
+	tcs := []struct {
+		testName       string
+		autoMigrate    bool
+		strictSchema   bool
+		expectedColumn bool
+		expectedRows   int64
+		expectedErr    bool
+	}{
+		{testName: "default", expectedColumn: false, expectedRows: 0},
+		{testName: "auto migrate", autoMigrate: true, expectedColumn: true, expectedRows: 1},
+		{testName: "strict schema", autoMigrate: true, strictSchema: true, expectedColumn: false, expectedRows: 0, expectedErr: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			pmp := &SQLPump{}
+			err := pmp.Init(map[string]interface{}{
+				"type":              "sqlite",
+				"connection_string": "file:schema_drift?mode=memory&cache=shared",
+				"table_sharding":    true,
+				"auto_migrate":      tc.autoMigrate,
+				"strict_schema":     tc.strictSchema,
+			})
+			assert.Nil(t, err)
+			defer pmp.db.Migrator().DropTable(shard)
+
+			// the table was created before the records had the newer fields
+			assert.Nil(t, pmp.db.Table(shard).AutoMigrate(&sqlOldRecord{}))
+			assert.False(t, pmp.db.Table(shard).Migrator().HasColumn(&analytics.AnalyticsRecord{}, "useragent"))
+
+			record := analytics.AnalyticsRecord{APIID: "api1", OrgID: "org1", TimeStamp: timestamp, UserAgent: "curl"}
+			err = pmp.WriteData(context.Background(), []interface{}{record})
+			if tc.expectedErr {
+				assert.ErrorContains(t, err, "table "+shard+" doesn't match the schema of the records")
+			} else {
+				assert.Nil(t, err)
+			}
+
+			assert.Equal(t, tc.expectedColumn, pmp.db.Table(shard).Migrator().HasColumn(&analytics.AnalyticsRecord{}, "useragent"))
+			var rows int64
+			assert.Nil(t, pmp.db.Table(shard).Count(&rows).Error)
+			assert.Equal(t, tc.expectedRows, rows)
+		})
+	}
+}
+
+func TestSQLStrictSchemaInit(t *testing.T) {
+	cfg := map[string]interface{}{
+		"type":              "sqlite",
+		"connection_string": "file:strict_schema?mode=memory&cache=shared",
+		"table_sharding":    true,
+	}
+	oldPmp := &SQLPump{}
+	assert.Nil(t, oldPmp.Init(cfg))
+	defer oldPmp.db.Migrator().DropTable(analytics.SQLTable)
+	assert.Nil(t, oldPmp.db.Table(analytics.SQLTable).AutoMigrate(&sqlOldRecord{}))
+
+	cfg["table_sharding"] = false
+	cfg["strict_schema"] = true
+	pmp := &SQLPump{}
+	err := pmp.Init(cfg)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "table tyk_analytics doesn't match the schema of the records, missing columns: ")
+	assert.Contains(t, err.Error(), "useragent")
+	assert.NotContains(t, err.Error(), "apiid")
+
+	// without strict_schema, the table is migrated
+	cfg["strict_schema"] = false
+	pmp = &SQLPump{}
+	assert.Nil(t, pmp.Init(cfg))
+	assert.True(t, pmp.db.Table(analytics.SQLTable).Migrator().HasColumn(&analytics.AnalyticsRecord{}, "useragent"))
+	cfg["strict_schema"] = true
+	assert.Nil(t, (&SQLPump{}).Init(cfg))
+}
+
+func TestSQLTimePartitioningInit(t *testing.T) {
+	tcs := []struct {
+		testName    string
+		cfg         map[string]interface{}
+		expectedErr string
+	}{
+		{
+			testName:    "sqlite",
+			cfg:         map[string]interface{}{"type": "sqlite", "time_partitioning": true},
+			expectedErr: "time_partitioning is only supported with postgres",
+		},
+		{
+			testName:    "table_sharding",
+			cfg:         map[string]interface{}{"type": "postgres", "time_partitioning": true, "table_sharding": true},
+			expectedErr: "time_partitioning can't be used with table_sharding",
+		},
+		{
+			testName:    "primary_key_field",
+			cfg:         map[string]interface{}{"type": "postgres", "time_partitioning": true, "primary_key_field": "api_key"},
+			expectedErr: "time_partitioning can't be used with primary_key_field",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			err := (&SQLPump{}).Init(tc.cfg)
+			assert.EqualError(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestPartitionBounds(t *testing.T) {
+	timestamp := time.Date(2023, 12, 31, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*60*60))
+	from, to := partitionBounds(timestamp)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), to)
+	assert.Equal(t, "tyk_analytics_202401", partitionName(analytics.SQLTable, timestamp))
+}
+
+func TestSQLTimePartitioning(t *testing.T) {
+	pmp := &SQLPump{}
+	err := pmp.Init(map[string]interface{}{
+		"type":              "postgres",
+		"connection_string": "host=localhost user=postgres password=postgres dbname=postgres port=5432 sslmode=disable",
+		"time_partitioning": true,
+	})
+	if err != nil {
+		t.Fatal("Postgres must be available on localhost:5432: ", err)
+	}
+	defer pmp.db.Migrator().DropTable(analytics.SQLTable)
+
+	keys := []interface{}{
+		analytics.AnalyticsRecord{APIID: "api1", OrgID: "org1", TimeStamp: time.Date(2023, 1, 31, 23, 59, 0, 0, time.UTC)},
+		analytics.AnalyticsRecord{APIID: "api2", OrgID: "org1", TimeStamp: time.Date(2023, 2, 1, 0, 1, 0, 0, time.UTC)},
+		analytics.AnalyticsRecord{APIID: "api3", OrgID: "org1", TimeStamp: time.Date(2023, 2, 15, 12, 0, 0, 0, time.UTC)},
+	}
+	assert.Nil(t, pmp.WriteData(context.Background(), keys))
+
+	// each record lands in the partition of its month
+	for apiID, expected := range map[string]string{
+		"api1": "tyk_analytics_202301",
+		"api2": "tyk_analytics_202302",
+		"api3": "tyk_analytics_202302",
+	} {
+		var partition string
+		assert.Nil(t, pmp.db.Raw("SELECT tableoid::regclass::text FROM tyk_analytics WHERE apiid = ?", apiID).Scan(&partition).Error)
+		assert.Equal(t, expected, partition)
+	}
+
+	var rows int64
+	assert.Nil(t, pmp.db.Table("tyk_analytics_202302").Count(&rows).Error)
+	assert.Equal(t, int64(2), rows)
+
+	// the existing partitioned table is reused
+	assert.Nil(t, (&SQLPump{}).Init(map[string]interface{}{
+		"type":              "postgres",
+		"connection_string": "host=localhost user=postgres password=postgres dbname=postgres port=5432 sslmode=disable",
+		"time_partitioning": true,
+	}))
+}
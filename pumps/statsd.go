@@ -14,6 +14,7 @@ import (
 
 type StatsdPump struct {
 	dbConf *StatsdConf
+	window *aggregateWindow
 	CommonPumpConfig
 }
 
@@ -31,6 +32,10 @@ type StatsdConf struct {
 	Tags []string `json:"tags" mapstructure:"tags"`
 	// Allows to have a separated method field instead of having it embedded in the path field.
 	SeparatedMethod bool `json:"separated_method" mapstructure:"separated_method"`
+	// The interval, in seconds, of the `aggregate.total_records` and `aggregate.error_rate` gauges,
+	// the number of records written and the percentage of them with a response code >= 400 since
+	// the previous interval. Defaults to 0, which disables the gauges.
+	AggregateInterval int `json:"aggregate_interval" mapstructure:"aggregate_interval"`
 }
 
 func (s *StatsdPump) New() Pump {
@@ -59,6 +64,10 @@ func (s *StatsdPump) Init(config interface{}) error {
 
 	s.connect()
 
+	if s.dbConf.AggregateInterval > 0 {
+		s.window = startAggregateWindow(time.Duration(s.dbConf.AggregateInterval)*time.Second, s.flushAggregate)
+	}
+
 	s.log.Debug("StatsD CS: ", s.dbConf.Address)
 	s.log.Info(s.GetName() + " Initialized")
 
@@ -95,6 +104,10 @@ func (s *StatsdPump) WriteData(ctx context.Context, data []interface{}) error {
 	client := s.connect()
 	defer client.Close()
 
+	if s.window != nil {
+		s.window.add(data)
+	}
+
 	for _, v := range data {
 		// Convert to AnalyticsRecord
 		decoded := v.(analytics.AnalyticsRecord)
@@ -139,6 +152,27 @@ func (s *StatsdPump) WriteData(ctx context.Context, data []interface{}) error {
 	return nil
 }
 
+// flushAggregate sends the gauges of the aggregate of a window.
+func (s *StatsdPump) flushAggregate(aggregate windowAggregate) {
+	client := s.connect()
+	defer client.Close()
+
+	if err := client.Gauge("aggregate.total_records", aggregate.TotalRecords); err != nil {
+		s.log.Error("Error sending the aggregate total records: ", err)
+	}
+	if err := client.FGauge("aggregate.error_rate", aggregate.ErrorRate); err != nil {
+		s.log.Error("Error sending the aggregate error rate: ", err)
+	}
+}
+
+// Shutdown flushes the current aggregate window.
+func (s *StatsdPump) Shutdown() error {
+	if s.window != nil {
+		s.window.close()
+	}
+	return nil
+}
+
 func (s *StatsdPump) getMappings(decoded analytics.AnalyticsRecord) map[string]interface{} {
 	// Format TimeStamp to Unix Time
 	unixTime := time.Unix(decoded.TimeStamp.Unix(), 0)
@@ -1,6 +1,8 @@
 package pumps
 
 import (
+	"context"
+	"net"
 	"strings"
 	"testing"
 	"time"
@@ -86,3 +88,36 @@ func TestGetMappings(t *testing.T) {
 		})
 	}
 }
+
+func TestStatsdAggregateInterval(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	pmp := StatsdPump{dbConf: &StatsdConf{Address: conn.LocalAddr().String()}}
+	pmp.log = log.WithField("prefix", statsdPrefix)
+	pmp.window = startAggregateWindow(100*time.Millisecond, pmp.flushAggregate)
+	defer pmp.Shutdown()
+
+	records := []interface{}{
+		analytics.AnalyticsRecord{ResponseCode: 200},
+		analytics.AnalyticsRecord{ResponseCode: 200},
+		analytics.AnalyticsRecord{ResponseCode: 200},
+		analytics.AnalyticsRecord{ResponseCode: 500},
+	}
+	assert.Nil(t, pmp.WriteData(context.Background(), records))
+
+	// the gauges of the window are sent at the interval
+	assert.Nil(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	packets := []string{}
+	buf := make([]byte, 1024)
+	for len(packets) < 2 {
+		n, _, err := conn.ReadFrom(buf)
+		assert.Nil(t, err)
+		if err != nil {
+			break
+		}
+		packets = append(packets, string(buf[:n]))
+	}
+	assert.Equal(t, []string{"aggregate.total_records:4|g", "aggregate.error_rate:25|g"}, packets)
+}
@@ -0,0 +1,167 @@
+package pumps
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+func TestSyslogPump_RFC5424(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	pmp := &SyslogPump{}
+	err = pmp.Init(map[string]interface{}{
+		"transport":    "udp",
+		"network_addr": conn.LocalAddr().String(),
+		"log_level":    6,
+		"tag":          "tyk-pump",
+		"format":       "rfc5424",
+		"sd_id":        "tyk@12345",
+	})
+	assert.Nil(t, err)
+
+	record := analytics.AnalyticsRecord{
+		APIID:        "api1",
+		OrgID:        "org1",
+		Method:       "GET",
+		Path:         "/users",
+		ResponseCode: 200,
+		RequestTime:  42,
+		Latency:      analytics.Latency{Total: 42, Upstream: 30},
+		TimeStamp:    time.Date(2022, 3, 14, 9, 30, 0, 123456000, time.UTC),
+	}
+	assert.Nil(t, pmp.WriteData(context.TODO(), []interface{}{record}))
+
+	buf := make([]byte, 65536)
+	assert.Nil(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	assert.Nil(t, err)
+	message := string(buf[:n])
+
+	hostname, _ := os.Hostname()
+	assert.True(t, strings.HasPrefix(message, "<6>1 2022-03-14T09:30:00.123456Z "+hostname+" tyk-pump "+strconv.Itoa(os.Getpid())+" - "), message)
+	assert.Contains(t, message, `[tyk@12345 api_id="api1" org_id="org1" method="GET" path="/users" response_code="200" request_time_ms="42" latency_total="42" latency_upstream="30"]`)
+	assert.Contains(t, message, "api_name")
+}
+
+func TestSyslogPump_RFC5424TCPFraming(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	pmp := &SyslogPump{}
+	err = pmp.Init(map[string]interface{}{
+		"transport":    "tcp",
+		"network_addr": listener.Addr().String(),
+		"log_level":    6,
+		"format":       "rfc5424",
+	})
+	assert.Nil(t, err)
+
+	server, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	go pmp.WriteData(context.TODO(), []interface{}{analytics.AnalyticsRecord{APIID: "api1", Path: `/a"b]c\`}})
+
+	assert.Nil(t, server.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reader := bufio.NewReader(server)
+	length, err := reader.ReadString(' ')
+	assert.Nil(t, err)
+	size, err := strconv.Atoi(strings.TrimSpace(length))
+	assert.Nil(t, err)
+	message := make([]byte, size)
+	_, err = io.ReadFull(reader, message)
+	assert.Nil(t, err)
+
+	// the default SD-ID, and the escaped param values
+	assert.Contains(t, string(message), `[tyk@32473 api_id="api1" org_id="" method="" path="/a\"b\]c\\" `)
+}
+
+func TestSyslogPump_RFC5424ConcurrentWrites(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	pmp := &SyslogPump{}
+	err = pmp.Init(map[string]interface{}{
+		"transport":    "tcp",
+		"network_addr": listener.Addr().String(),
+		"log_level":    6,
+		"format":       "rfc5424",
+	})
+	assert.Nil(t, err)
+
+	server, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	const batches, records = 4, 25
+	for i := 0; i < batches; i++ {
+		data := make([]interface{}, records)
+		for j := range data {
+			data[j] = analytics.AnalyticsRecord{APIID: "api" + strconv.Itoa(i)}
+		}
+		go pmp.WriteData(context.TODO(), data)
+	}
+
+	// the messages of the parallel batches don't interleave, so every frame is whole
+	assert.Nil(t, server.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reader := bufio.NewReader(server)
+	for i := 0; i < batches*records; i++ {
+		length, err := reader.ReadString(' ')
+		assert.Nil(t, err)
+		size, err := strconv.Atoi(strings.TrimSpace(length))
+		assert.Nil(t, err)
+		message := make([]byte, size)
+		_, err = io.ReadFull(reader, message)
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(string(message), "<6>1 "), string(message))
+	}
+}
+
+func TestSyslogPump_InvalidFormat(t *testing.T) {
+	exit := log.ExitFunc
+	defer func() {
+		log.ExitFunc = exit
+	}()
+	log.ExitFunc = func(int) {
+		panic("exit")
+	}
+
+	pmp := &SyslogPump{}
+	assert.Panics(t, func() {
+		_ = pmp.Init(map[string]interface{}{"format": "rfc3164"})
+	})
+}
+
+func TestValidateSDID(t *testing.T) {
+	assert.Nil(t, validateSDID("tyk@32473"))
+	assert.Nil(t, validateSDID("origin"))
+	assert.NotNil(t, validateSDID(""))
+	assert.NotNil(t, validateSDID("tyk 32473"))
+	assert.NotNil(t, validateSDID("tyk=1"))
+	assert.NotNil(t, validateSDID(strings.Repeat("a", 33)))
+}
@@ -0,0 +1,245 @@
+package pumps
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+type W3CPump struct {
+	w3cConf  *W3CConf
+	manifest *fileManifest
+	CommonPumpConfig
+}
+
+// @PumpConf W3C
+type W3CConf struct {
+	EnvPrefix string `mapstructure:"meta_env_prefix"`
+	// The directory where the hourly log files are written.
+	LogDir string `json:"log_dir" mapstructure:"log_dir"`
+	// The fields of the log lines, in order, with their W3C Extended Log Format identifiers. Defaults
+	// to `["date", "time", "c-ip", "cs-method", "cs-uri-stem", "cs-uri-query", "sc-status",
+	// "time-taken", "cs(User-Agent)"]`.
+	Fields []string `json:"fields" mapstructure:"fields"`
+	// The path of a manifest of the log files, listing the path, the number of records, the time
+	// range and the size of each of them. It's rewritten after each write. Disabled by default.
+	ManifestPath string `json:"manifest_path" mapstructure:"manifest_path"`
+	// The format of the manifest, `json` or `csv`. Defaults to `json`.
+	ManifestFormat string `json:"manifest_format" mapstructure:"manifest_format"`
+}
+
+var (
+	w3cPrefix     = "w3c-pump"
+	w3cDefaultENV = PUMPS_ENV_PREFIX + "_W3C" + PUMPS_ENV_META_PREFIX
+
+	w3cDefaultFields = []string{"date", "time", "c-ip", "cs-method", "cs-uri-stem", "cs-uri-query", "sc-status", "time-taken", "cs(User-Agent)"}
+)
+
+// w3cFieldValue returns the value of a field of the record, and whether it's of the string type,
+// written quoted.
+type w3cFieldValue func(record *analytics.AnalyticsRecord) (value string, quoted bool)
+
+// w3cFields are the supported W3C Extended Log Format fields. The `x-` ones are Tyk specific.
+var w3cFields = map[string]w3cFieldValue{
+	"date": func(r *analytics.AnalyticsRecord) (string, bool) {
+		return r.TimeStamp.UTC().Format("2006-01-02"), false
+	},
+	"time": func(r *analytics.AnalyticsRecord) (string, bool) {
+		return r.TimeStamp.UTC().Format("15:04:05"), false
+	},
+	"c-ip": func(r *analytics.AnalyticsRecord) (string, bool) {
+		return r.IPAddress, false
+	},
+	"cs-method": func(r *analytics.AnalyticsRecord) (string, bool) {
+		return r.Method, false
+	},
+	"cs-host": func(r *analytics.AnalyticsRecord) (string, bool) {
+		return r.Host, false
+	},
+	"cs-uri": func(r *analytics.AnalyticsRecord) (string, bool) {
+		if r.RawPath != "" {
+			return r.RawPath, false
+		}
+		return r.Path, false
+	},
+	"cs-uri-stem": func(r *analytics.AnalyticsRecord) (string, bool) {
+		return r.Path, false
+	},
+	"cs-uri-query": func(r *analytics.AnalyticsRecord) (string, bool) {
+		if i := strings.Index(r.RawPath, "?"); i >= 0 {
+			return r.RawPath[i+1:], false
+		}
+		return "", false
+	},
+	"sc-status": func(r *analytics.AnalyticsRecord) (string, bool) {
+		return strconv.Itoa(r.ResponseCode), false
+	},
+	"cs-bytes": func(r *analytics.AnalyticsRecord) (string, bool) {
+		return strconv.FormatInt(r.ContentLength, 10), false
+	},
+	"sc-bytes": func(r *analytics.AnalyticsRecord) (string, bool) {
+		return strconv.FormatInt(r.ResponseContentLength, 10), false
+	},
+	// in seconds, the record has milliseconds
+	"time-taken": func(r *analytics.AnalyticsRecord) (string, bool) {
+		return strconv.FormatFloat(float64(r.RequestTime)/1000, 'f', 3, 64), false
+	},
+	"cs(User-Agent)": func(r *analytics.AnalyticsRecord) (string, bool) {
+		return r.UserAgent, true
+	},
+	"x-api-id": func(r *analytics.AnalyticsRecord) (string, bool) {
+		return r.APIID, true
+	},
+	"x-api-name": func(r *analytics.AnalyticsRecord) (string, bool) {
+		return r.APIName, true
+	},
+	"x-api-version": func(r *analytics.AnalyticsRecord) (string, bool) {
+		return r.APIVersion, true
+	},
+	"x-org-id": func(r *analytics.AnalyticsRecord) (string, bool) {
+		return r.OrgID, true
+	},
+	"x-oauth-id": func(r *analytics.AnalyticsRecord) (string, bool) {
+		return r.OauthID, true
+	},
+	"x-alias": func(r *analytics.AnalyticsRecord) (string, bool) {
+		return r.Alias, true
+	},
+}
+
+func (w *W3CPump) New() Pump {
+	newPump := W3CPump{}
+	return &newPump
+}
+
+func (w *W3CPump) GetName() string {
+	return "W3C Pump"
+}
+
+func (w *W3CPump) GetEnvPrefix() string {
+	return w.w3cConf.EnvPrefix
+}
+
+func (w *W3CPump) Init(conf interface{}) error {
+	w.w3cConf = &W3CConf{}
+	w.log = log.WithField("prefix", w3cPrefix)
+
+	err := mapstructure.Decode(conf, &w.w3cConf)
+	if err != nil {
+		w.log.Fatal("Failed to decode configuration: ", err)
+	}
+
+	processPumpEnvVars(w, w.log, w.w3cConf, w3cDefaultENV)
+
+	if len(w.w3cConf.Fields) == 0 {
+		w.w3cConf.Fields = w3cDefaultFields
+	}
+	for _, field := range w.w3cConf.Fields {
+		if _, ok := w3cFields[field]; !ok {
+			return fmt.Errorf("unsupported W3C field %q", field)
+		}
+	}
+
+	if err := os.MkdirAll(w.w3cConf.LogDir, 0777); err != nil {
+		w.log.Error(err.Error() + " dir: " + w.w3cConf.LogDir)
+		return err
+	}
+
+	if w.w3cConf.ManifestPath != "" {
+		w.manifest, err = openFileManifest(w.w3cConf.ManifestPath, w.w3cConf.ManifestFormat)
+		if err != nil {
+			w.log.Error("Failed to open the manifest: ", err)
+			return err
+		}
+	}
+
+	w.log.Info(w.GetName() + " Initialized")
+	return nil
+}
+
+// header returns the directives starting a log file created at created.
+func (w *W3CPump) header(created time.Time) string {
+	return "#Version: 1.0\n" +
+		"#Software: Tyk Pump " + VERSION + "\n" +
+		"#Date: " + created.UTC().Format("2006-01-02 15:04:05") + "\n" +
+		"#Fields: " + strings.Join(w.w3cConf.Fields, " ") + "\n"
+}
+
+// line returns the log line of the record, with the configured fields separated by spaces. The
+// missing values are written as `-`.
+func (w *W3CPump) line(record *analytics.AnalyticsRecord) string {
+	values := make([]string, len(w.w3cConf.Fields))
+	for i, field := range w.w3cConf.Fields {
+		value, quoted := w3cFields[field](record)
+		switch {
+		case value == "":
+			value = "-"
+		case quoted:
+			// the quotes of the strings are doubled
+			value = `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+		default:
+			// the fields are separated by spaces
+			value = strings.Join(strings.Fields(value), "+")
+		}
+		values[i] = value
+	}
+	return strings.Join(values, " ") + "\n"
+}
+
+func (w *W3CPump) WriteData(ctx context.Context, data []interface{}) error {
+	w.log.Debug("Attempting to write ", len(data), " records...")
+
+	curtime := time.Now()
+	fname := fmt.Sprintf("%d-%s-%d-%d.log", curtime.Year(), curtime.Month().String(), curtime.Day(), curtime.Hour())
+	fname = path.Join(w.w3cConf.LogDir, fname)
+
+	var lines strings.Builder
+	if _, err := os.Stat(fname); os.IsNotExist(err) {
+		lines.WriteString(w.header(curtime))
+	}
+	for _, v := range data {
+		decoded, ok := v.(analytics.AnalyticsRecord)
+		if !ok {
+			return fmt.Errorf("couldn't convert %v to analytics.AnalyticsRecord", v)
+		}
+		lines.WriteString(w.line(&decoded))
+	}
+
+	outfile, err := os.OpenFile(fname, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		w.log.Error("Failed to open W3C log file: ", err)
+		return err
+	}
+	defer outfile.Close()
+
+	if _, err := outfile.WriteString(lines.String()); err != nil {
+		w.log.Error("File write failed:", err)
+		return err
+	}
+	if w.manifest != nil {
+		w.updateManifest(outfile, data)
+	}
+	w.log.Info("Purged ", len(data), " records...")
+	return nil
+}
+
+// updateManifest adds the records written to the log file to the manifest.
+func (w *W3CPump) updateManifest(file *os.File, data []interface{}) {
+	info, err := file.Stat()
+	if err != nil {
+		w.log.Error("Failed to update the manifest: ", err)
+		return
+	}
+	first, last := recordsTimeRange(data)
+	if err := w.manifest.add(file.Name(), int64(len(data)), first, last, info.Size()); err != nil {
+		w.log.Error("Failed to update the manifest: ", err)
+	}
+}
@@ -0,0 +1,74 @@
+package pumps
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk-pump/analytics"
+)
+
+func TestW3CPump_WriteData(t *testing.T) {
+	dir := t.TempDir()
+	pmp := &W3CPump{}
+	err := pmp.Init(map[string]interface{}{
+		"log_dir": dir,
+		"fields":  []string{"date", "time", "c-ip", "cs-method", "cs-uri-stem", "cs-uri-query", "sc-status", "sc-bytes", "time-taken", "cs(User-Agent)", "x-api-id"},
+	})
+	assert.Nil(t, err)
+
+	timestamp := time.Date(2023, 10, 1, 9, 5, 30, 0, time.FixedZone("CEST", 2*60*60))
+	records := []interface{}{
+		analytics.AnalyticsRecord{
+			TimeStamp:    timestamp,
+			IPAddress:    "172.18.0.1",
+			Method:       "GET",
+			Path:         "/get",
+			RawPath:      "/get?name=tyk&page=2",
+			ResponseCode: 200,
+			Enrichment:   analytics.Enrichment{ResponseContentLength: 512},
+			RequestTime:  1234,
+			UserAgent:    `Mozilla/5.0 (X11; Linux x86_64) "quoted"`,
+			APIID:        "api1",
+		},
+		// the missing values
+		analytics.AnalyticsRecord{TimeStamp: timestamp, Method: "POST", Path: "/post", ResponseCode: 201},
+	}
+	assert.Nil(t, pmp.WriteData(context.Background(), records))
+	// appended to the same hourly file, without a second header
+	assert.Nil(t, pmp.WriteData(context.Background(), records[1:]))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+	content, err := os.ReadFile(files[0])
+	assert.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	assert.Len(t, lines, 7)
+	assert.Equal(t, "#Version: 1.0", lines[0])
+	assert.Equal(t, "#Software: Tyk Pump "+VERSION, lines[1])
+	assert.Regexp(t, `^#Date: \d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}$`, lines[2])
+	assert.Equal(t, "#Fields: date time c-ip cs-method cs-uri-stem cs-uri-query sc-status sc-bytes time-taken cs(User-Agent) x-api-id", lines[3])
+	// the date and time are UTC, the time taken in seconds
+	assert.Equal(t, `2023-10-01 07:05:30 172.18.0.1 GET /get name=tyk&page=2 200 512 1.234 "Mozilla/5.0 (X11; Linux x86_64) ""quoted""" "api1"`, lines[4])
+	assert.Equal(t, `2023-10-01 07:05:30 - POST /post - 201 0 0.000 - -`, lines[5])
+	assert.Equal(t, lines[5], lines[6])
+}
+
+func TestW3CPump_Init(t *testing.T) {
+	dir := t.TempDir()
+
+	pmp := &W3CPump{}
+	assert.Nil(t, pmp.Init(map[string]interface{}{"log_dir": dir}))
+	assert.Equal(t, w3cDefaultFields, pmp.w3cConf.Fields)
+	assert.Equal(t, "#Fields: date time c-ip cs-method cs-uri-stem cs-uri-query sc-status time-taken cs(User-Agent)", strings.Split(pmp.header(time.Now()), "\n")[3])
+
+	err := pmp.Init(map[string]interface{}{"log_dir": dir, "fields": []string{"date", "s-sitename"}})
+	assert.EqualError(t, err, `unsupported W3C field "s-sitename"`)
+}
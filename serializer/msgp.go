@@ -9,7 +9,10 @@ type MsgpSerializer struct {
 }
 
 func (serializer *MsgpSerializer) Encode(record *analytics.AnalyticsRecord) ([]byte, error) {
-	return msgpack.Marshal(record)
+	// the expiry is encoded like the protobuf serializer encodes it, without changing the record
+	encoded := *record
+	encoded.NormalizeExpireAt()
+	return msgpack.Marshal(&encoded)
 }
 
 func (serializer *MsgpSerializer) Decode(analyticsData interface{}, record *analytics.AnalyticsRecord) error {
@@ -21,7 +24,11 @@ func (serializer *MsgpSerializer) Decode(analyticsData interface{}, record *anal
 		data = analyticsData.([]byte)
 	}
 
-	return msgpack.Unmarshal(data, record)
+	if err := msgpack.Unmarshal(data, record); err != nil {
+		return err
+	}
+	record.NormalizeExpireAt()
+	return nil
 }
 
 func (serializer *MsgpSerializer) GetSuffix() string {
@@ -7,9 +7,12 @@ import (
 
 	"github.com/TykTechnologies/tyk-pump/analytics"
 	"github.com/TykTechnologies/tyk-pump/analytics/demo"
+	analyticsproto "github.com/TykTechnologies/tyk-pump/analytics/proto"
+	"github.com/golang/protobuf/proto"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/vmihailenco/msgpack.v2"
 )
 
 func TestSerializer_Encode(t *testing.T) {
@@ -63,7 +66,8 @@ func TestSerializer_Decode(t *testing.T) {
 				APIID: "api_1",
 				OrgID: "org_1",
 				// The canonical way to strip a monotonic clock reading is to use t = t.Round(0)
-				ExpireAt:  time.Now().Add(time.Hour).Round(0),
+				// The expiry is kept with millisecond precision.
+				ExpireAt:  time.Now().Add(time.Hour).Round(0).Truncate(time.Millisecond),
 				TimeStamp: time.Now().Round(0),
 			}
 
@@ -81,6 +85,72 @@ func TestSerializer_Decode(t *testing.T) {
 	}
 }
 
+func TestSerializer_ExpireAt(t *testing.T) {
+	cest := time.FixedZone("CEST", 2*60*60)
+	tcs := []struct {
+		testName string
+		expireAt time.Time
+		expected time.Time
+	}{
+		{testName: "no expiry", expireAt: time.Time{}, expected: time.Time{}},
+		{testName: "utc", expireAt: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), expected: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)},
+		{testName: "milliseconds", expireAt: time.Date(2024, 3, 1, 10, 0, 0, 123000000, time.UTC), expected: time.Date(2024, 3, 1, 10, 0, 0, 123000000, time.UTC)},
+		{testName: "truncated to milliseconds", expireAt: time.Date(2024, 3, 1, 10, 0, 0, 123456789, time.UTC), expected: time.Date(2024, 3, 1, 10, 0, 0, 123000000, time.UTC)},
+		{testName: "other zone", expireAt: time.Date(2024, 3, 1, 12, 0, 0, 0, cest), expected: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)},
+	}
+
+	for _, serializerType := range []string{MSGP_SERIALIZER, PROTOBUF_SERIALIZER} {
+		serializer := NewAnalyticsSerializer(serializerType)
+		for _, tc := range tcs {
+			t.Run(serializerType+" "+tc.testName, func(t *testing.T) {
+				record := analytics.AnalyticsRecord{APIID: "api_1", TimeStamp: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC), ExpireAt: tc.expireAt}
+				bytes, err := serializer.Encode(&record)
+				assert.Nil(t, err)
+				// the record itself isn't changed
+				assert.Equal(t, tc.expireAt, record.ExpireAt)
+
+				decoded := analytics.AnalyticsRecord{}
+				assert.Nil(t, serializer.Decode(bytes, &decoded))
+				// in UTC, and the same zero value
+				assert.Equal(t, tc.expected, decoded.ExpireAt)
+				assert.Equal(t, analytics.ExpireAtMillis(tc.expireAt), analytics.ExpireAtMillis(decoded.ExpireAt))
+			})
+		}
+	}
+}
+
+func TestProtobufSerializer_UnsetExpireAt(t *testing.T) {
+	// a record without expiry is encoded without it, and isn't decoded as expiring at the epoch
+	serializer := NewAnalyticsSerializer(PROTOBUF_SERIALIZER)
+	bytes, err := serializer.Encode(&analytics.AnalyticsRecord{APIID: "api_1", TimeStamp: time.Now()})
+	assert.Nil(t, err)
+	protoRecord := analyticsproto.AnalyticsRecord{}
+	assert.Nil(t, proto.Unmarshal(bytes, &protoRecord))
+	assert.Nil(t, protoRecord.ExpireAt)
+
+	decoded := analytics.AnalyticsRecord{}
+	assert.Nil(t, serializer.Decode(bytes, &decoded))
+	assert.Equal(t, time.Time{}, decoded.ExpireAt)
+}
+
+func TestProtobufSerializer_UnknownTimeZone(t *testing.T) {
+	// the zone abbreviations can't be loaded, the timestamps are kept in UTC
+	cest := time.FixedZone("CEST", 2*60*60)
+	record := analytics.AnalyticsRecord{
+		APIID:     "api_1",
+		TimeStamp: time.Date(2024, 3, 1, 11, 0, 0, 0, cest),
+		ExpireAt:  time.Date(2024, 3, 8, 11, 0, 0, 0, cest),
+	}
+	serializer := NewAnalyticsSerializer(PROTOBUF_SERIALIZER)
+	bytes, err := serializer.Encode(&record)
+	assert.Nil(t, err)
+
+	decoded := analytics.AnalyticsRecord{}
+	assert.Nil(t, serializer.Decode(bytes, &decoded))
+	assert.Equal(t, time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC), decoded.TimeStamp)
+	assert.Equal(t, time.Date(2024, 3, 8, 9, 0, 0, 0, time.UTC), decoded.ExpireAt)
+}
+
 func TestSerializer_GetSuffix(t *testing.T) {
 	tcs := []struct {
 		testName       string
@@ -106,6 +176,23 @@ func TestSerializer_GetSuffix(t *testing.T) {
 	}
 }
 
+func TestMsgpSerializer_Enrichment(t *testing.T) {
+	serializer := NewAnalyticsSerializer(MSGP_SERIALIZER)
+	record := analytics.AnalyticsRecord{APIID: "api_1", Enrichment: analytics.Enrichment{LatencyTotal: 120, LatencyGateway: 20}}
+	bytes, err := serializer.Encode(&record)
+	assert.Nil(t, err)
+
+	// the enrichment fields are inlined, like the other fields of the record
+	document := map[string]interface{}{}
+	assert.Nil(t, msgpack.Unmarshal(bytes, &document))
+	assert.Contains(t, document, "LatencyTotal")
+	assert.NotContains(t, document, "Enrichment")
+
+	decoded := analytics.AnalyticsRecord{}
+	assert.Nil(t, serializer.Decode(bytes, &decoded))
+	assert.Equal(t, record.Enrichment, decoded.Enrichment)
+}
+
 func BenchmarkProtobufEncoding(b *testing.B) {
 	serializer := NewAnalyticsSerializer(PROTOBUF_SERIALIZER)
 	records := []analytics.AnalyticsRecord{
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk-pump/logger"
+)
+
+// logLevelSecretHeader is the header holding the secret of the log level endpoint.
+const logLevelSecretHeader = "X-Tyk-Authorization"
+
+// logLevelRequest is the body of the PUT requests of the log level endpoint.
+type logLevelRequest struct {
+	Level string `json:"level"`
+	// If set, the level is reverted to the previous one after this duration, e.g. `10m`.
+	Duration string `json:"duration"`
+}
+
+// logLevelResponse is the body of the responses of the log level endpoint.
+type logLevelResponse struct {
+	Level    string `json:"level,omitempty"`
+	RevertAt string `json:"revert_at,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// logLevelHandler reads and changes the level of the logger at runtime. The requests must have the
+// secret in their X-Tyk-Authorization header.
+type logLevelHandler struct {
+	secret string
+
+	mu sync.Mutex
+	// the pending revert and the level it reverts to
+	revert      *time.Timer
+	revertAt    time.Time
+	revertLevel logrus.Level
+}
+
+func newLogLevelHandler(secret string) *logLevelHandler {
+	return &logLevelHandler{secret: secret}
+}
+
+func (h *logLevelHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-type", "application/json")
+
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(logLevelSecretHeader)), []byte(h.secret)) != 1 {
+		writeLogLevelResponse(rw, http.StatusForbidden, logLevelResponse{Error: "attempted access with invalid or missing secret"})
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		writeLogLevelResponse(rw, http.StatusOK, h.current())
+		return
+	}
+
+	req := logLevelRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeLogLevelResponse(rw, http.StatusBadRequest, logLevelResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+	level, err := logger.ParseLevel(req.Level)
+	if err != nil {
+		writeLogLevelResponse(rw, http.StatusBadRequest, logLevelResponse{Error: err.Error()})
+		return
+	}
+	var duration time.Duration
+	if req.Duration != "" {
+		if duration, err = time.ParseDuration(req.Duration); err != nil || duration <= 0 {
+			writeLogLevelResponse(rw, http.StatusBadRequest, logLevelResponse{Error: "invalid duration " + req.Duration})
+			return
+		}
+	}
+
+	h.set(level, duration)
+	writeLogLevelResponse(rw, http.StatusOK, h.current())
+}
+
+// set changes the level of the logger and, if duration is set, reverts it after duration. A change
+// replaces the pending revert, if any, keeping the level it reverts to.
+func (h *logLevelHandler) set(level logrus.Level, duration time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	revertLevel := log.GetLevel()
+	if h.revert != nil && h.revert.Stop() {
+		revertLevel = h.revertLevel
+	}
+	h.revert = nil
+
+	log.SetLevel(level)
+	log.WithFields(logrus.Fields{
+		"prefix": serverPrefix,
+	}).Info("Log level set to ", level)
+
+	if duration <= 0 {
+		return
+	}
+	h.revertLevel = revertLevel
+	h.revertAt = time.Now().Add(duration)
+	var revert *time.Timer
+	revert = time.AfterFunc(duration, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.revert != revert {
+			return
+		}
+		h.revert = nil
+		log.SetLevel(revertLevel)
+		log.WithFields(logrus.Fields{
+			"prefix": serverPrefix,
+		}).Info("Log level reverted to ", revertLevel)
+	})
+	h.revert = revert
+}
+
+// current returns the level of the logger, and when it's reverted if a revert is pending.
+func (h *logLevelHandler) current() logLevelResponse {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	response := logLevelResponse{Level: log.GetLevel().String()}
+	if h.revert != nil {
+		response.RevertAt = h.revertAt.UTC().Format(time.RFC3339)
+	}
+	return response
+}
+
+func writeLogLevelResponse(rw http.ResponseWriter, code int, response logLevelResponse) {
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(response)
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func logLevelRequestTo(t *testing.T, h http.Handler, method, secret, body string) (int, logLevelResponse) {
+	t.Helper()
+	req := httptest.NewRequest(method, "/loglevel", strings.NewReader(body))
+	if secret != "" {
+		req.Header.Set(logLevelSecretHeader, secret)
+	}
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+
+	response := logLevelResponse{}
+	assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &response))
+	return rw.Code, response
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	log.SetLevel(logrus.InfoLevel)
+	h := newLogLevelHandler("secret")
+
+	code, response := logLevelRequestTo(t, h, http.MethodGet, "secret", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, logLevelResponse{Level: "info"}, response)
+
+	code, response = logLevelRequestTo(t, h, http.MethodPut, "secret", `{"level": "debug"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, logLevelResponse{Level: "debug"}, response)
+	assert.Equal(t, logrus.DebugLevel, log.GetLevel())
+
+	code, response = logLevelRequestTo(t, h, http.MethodPut, "secret", `{"level": "WARN"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "warning", response.Level)
+	assert.Equal(t, logrus.WarnLevel, log.GetLevel())
+}
+
+func TestLogLevelHandlerRevert(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	log.SetLevel(logrus.InfoLevel)
+	h := newLogLevelHandler("secret")
+
+	code, response := logLevelRequestTo(t, h, http.MethodPut, "secret", `{"level": "debug", "duration": "100ms"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "debug", response.Level)
+	assert.NotEmpty(t, response.RevertAt)
+	assert.Equal(t, logrus.DebugLevel, log.GetLevel())
+
+	// a change before the revert keeps the level it reverts to
+	_, response = logLevelRequestTo(t, h, http.MethodPut, "secret", `{"level": "error", "duration": "100ms"}`)
+	assert.Equal(t, "error", response.Level)
+	assert.Equal(t, logrus.ErrorLevel, log.GetLevel())
+
+	assert.Eventually(t, func() bool {
+		return log.GetLevel() == logrus.InfoLevel
+	}, time.Second, 10*time.Millisecond)
+	_, response = logLevelRequestTo(t, h, http.MethodGet, "secret", "")
+	assert.Equal(t, logLevelResponse{Level: "info"}, response)
+
+	// a change without duration cancels the pending revert
+	logLevelRequestTo(t, h, http.MethodPut, "secret", `{"level": "debug", "duration": "50ms"}`)
+	logLevelRequestTo(t, h, http.MethodPut, "secret", `{"level": "warn"}`)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, logrus.WarnLevel, log.GetLevel())
+}
+
+func TestLogLevelHandlerUnauthorized(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	log.SetLevel(logrus.InfoLevel)
+	h := newLogLevelHandler("secret")
+
+	for _, secret := range []string{"", "wrong"} {
+		code, response := logLevelRequestTo(t, h, http.MethodPut, secret, `{"level": "debug"}`)
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.Equal(t, "attempted access with invalid or missing secret", response.Error)
+
+		code, _ = logLevelRequestTo(t, h, http.MethodGet, secret, "")
+		assert.Equal(t, http.StatusForbidden, code)
+	}
+	assert.Equal(t, logrus.InfoLevel, log.GetLevel())
+}
+
+func TestLogLevelHandlerInvalid(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	log.SetLevel(logrus.InfoLevel)
+	h := newLogLevelHandler("secret")
+
+	tcs := []struct {
+		testName string
+		body     string
+		expected string
+	}{
+		{
+			testName: "invalid body",
+			body:     `debug`,
+			expected: "invalid request body: invalid character 'd' looking for beginning of value",
+		},
+		{
+			testName: "invalid level",
+			body:     `{"level": "trace"}`,
+			expected: `invalid log level "trace", must be error, warn, info or debug`,
+		},
+		{
+			testName: "invalid duration",
+			body:     `{"level": "debug", "duration": "10"}`,
+			expected: "invalid duration 10",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.testName, func(t *testing.T) {
+			code, response := logLevelRequestTo(t, h, http.MethodPut, "secret", tc.body)
+			assert.Equal(t, http.StatusBadRequest, code)
+			assert.Equal(t, tc.expected, response.Error)
+			assert.Equal(t, logrus.InfoLevel, log.GetLevel())
+		})
+	}
+}
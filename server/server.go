@@ -1,9 +1,11 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	pprof_http "net/http/pprof"
+	"sync"
 
 	"github.com/TykTechnologies/tyk-pump/logger"
 	"github.com/gorilla/mux"
@@ -15,7 +17,23 @@ var defaultHealthPort = 8083
 var serverPrefix = "server"
 var log = logger.GetLogger()
 
-func ServeHealthCheck(configHealthEndpoint string, configHealthPort int, enableProfiling bool) {
+// healthInfo holds the functions returning the extra fields of the health check response.
+var healthInfo = struct {
+	sync.RWMutex
+	fields map[string]func() interface{}
+}{fields: map[string]func() interface{}{}}
+
+// SetHealthInfo adds the field key to the health check response, set to the value returned by fn
+// on each request.
+func SetHealthInfo(key string, fn func() interface{}) {
+	healthInfo.Lock()
+	defer healthInfo.Unlock()
+	healthInfo.fields[key] = fn
+}
+
+// ServeHealthCheck serves the health check endpoint, along with the profiling endpoints if
+// enableProfiling is set, and the /loglevel endpoint if logLevelSecret is set.
+func ServeHealthCheck(configHealthEndpoint string, configHealthPort int, enableProfiling bool, logLevelSecret string) {
 	healthEndpoint := configHealthEndpoint
 	if healthEndpoint == "" {
 		healthEndpoint = defaultHealthEndpoint
@@ -32,6 +50,9 @@ func ServeHealthCheck(configHealthEndpoint string, configHealthPort int, enableP
 		r.HandleFunc("/debug/pprof/profile", pprof_http.Profile)
 		r.HandleFunc("/debug/pprof/{_:.*}", pprof_http.Index)
 	}
+	if logLevelSecret != "" {
+		r.Handle("/loglevel", newLogLevelHandler(logLevelSecret)).Methods("GET", "PUT")
+	}
 
 	log.WithFields(logrus.Fields{
 		"prefix": serverPrefix,
@@ -46,6 +67,20 @@ func ServeHealthCheck(configHealthEndpoint string, configHealthPort int, enableP
 
 func Healthcheck(rw http.ResponseWriter, r *http.Request) {
 	rw.Header().Set("Content-type", "application/json")
+
+	healthInfo.RLock()
+	if len(healthInfo.fields) == 0 {
+		healthInfo.RUnlock()
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte(`{"status": "ok"}`))
+		return
+	}
+	response := map[string]interface{}{"status": "ok"}
+	for key, fn := range healthInfo.fields {
+		response[key] = fn()
+	}
+	healthInfo.RUnlock()
+
 	rw.WriteHeader(http.StatusOK)
-	rw.Write([]byte(`{"status": "ok"}`))
+	json.NewEncoder(rw).Encode(response)
 }
@@ -82,6 +82,9 @@ type RedisClusterStorageManager struct {
 	KeyPrefix string
 	HashKeys  bool
 	Config    RedisStorageConfig
+	// Dedicated storage managers have their own connection pool, instead of the shared one, and
+	// their configuration isn't overridden by the Redis environment variables.
+	Dedicated bool
 }
 
 func NewRedisClusterPool(forceReconnect bool, config RedisStorageConfig) redis.UniversalClient {
@@ -98,6 +101,11 @@ func NewRedisClusterPool(forceReconnect bool, config RedisStorageConfig) redis.U
 		}
 	}
 
+	redisClusterSingleton = newRedisClient(config)
+	return redisClusterSingleton
+}
+
+func newRedisClient(config RedisStorageConfig) redis.UniversalClient {
 	log.WithFields(logrus.Fields{
 		"prefix": redisLogPrefix,
 	}).Debug("Creating new Redis connection pool")
@@ -147,8 +155,6 @@ func NewRedisClusterPool(forceReconnect bool, config RedisStorageConfig) redis.U
 		client = redis.NewClient(opts.Simple())
 	}
 
-	redisClusterSingleton = client
-
 	return client
 }
 
@@ -183,9 +189,11 @@ func (r *RedisClusterStorageManager) Init(config interface{}) error {
 		}).Fatal("Failed to decode configuration: ", err)
 	}
 
-	overrideErr := envconfig.Process(ENV_REDIS_PREFIX, &r.Config)
-	if overrideErr != nil {
-		log.Error("Failed to process environment variables for redis: ", overrideErr)
+	if !r.Dedicated {
+		overrideErr := envconfig.Process(ENV_REDIS_PREFIX, &r.Config)
+		if overrideErr != nil {
+			log.Error("Failed to process environment variables for redis: ", overrideErr)
+		}
 	}
 
 	if r.Config.RedisKeyPrefix == "" {
@@ -202,7 +210,15 @@ func (r *RedisClusterStorageManager) Connect() bool {
 		log.WithFields(logrus.Fields{
 			"prefix": redisLogPrefix,
 		}).Debug("Connecting to redis cluster")
-		r.db = NewRedisClusterPool(false, r.Config)
+		if r.Dedicated {
+			r.db = newRedisClient(r.Config)
+		} else {
+			r.db = NewRedisClusterPool(false, r.Config)
+		}
+		return true
+	}
+
+	if r.Dedicated {
 		return true
 	}
 
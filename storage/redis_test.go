@@ -97,6 +97,39 @@ var testData = []struct {
 	{in: []string{"one", "two", "three", "four", "five"}, chunk: int64(3)},
 }
 
+func TestRedisClusterStorageManager_Dedicated(t *testing.T) {
+	t.Setenv(ENV_REDIS_PREFIX+"_HOST", "env-host")
+
+	shared := RedisClusterStorageManager{}
+	if err := shared.Init(map[string]interface{}{"host": "localhost", "port": 6379}); err != nil {
+		t.Fatal(err)
+	}
+	if shared.Config.Host != "env-host" {
+		t.Fatal("The env variables should override the config of the shared storage")
+	}
+
+	dedicated := RedisClusterStorageManager{Dedicated: true}
+	if err := dedicated.Init(map[string]interface{}{"host": "other", "port": 6380}); err != nil {
+		t.Fatal(err)
+	}
+	if dedicated.Config.Host != "other" {
+		t.Fatal("The env variables shouldn't override the config of a dedicated storage")
+	}
+
+	shared.Connect()
+	dedicated.Connect()
+	defer dedicated.db.Close()
+	if shared.db != redisClusterSingleton || dedicated.db == redisClusterSingleton {
+		t.Fatal("A dedicated storage should have its own connection pool")
+	}
+	// connecting again keeps the connection pool
+	db := dedicated.db
+	dedicated.Connect()
+	if dedicated.db != db {
+		t.Fatal("The connection pool of a dedicated storage should be kept")
+	}
+}
+
 func TestRedisClusterStorageManager_GetAndDeleteSet(t *testing.T) {
 	conf := make(map[string]interface{})
 	conf["host"] = "localhost"